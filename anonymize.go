@@ -0,0 +1,93 @@
+package sharealyzer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+// SaltSize is the size in bytes of newly generated salts
+const SaltSize = 32
+
+// MinSaltSize is the minimum size in bytes of a loaded salt. Pseudonyms keyed with a shorter salt can be
+// reversed by trying all identifiers.
+const MinSaltSize = 16
+
+// Pseudonymizer replaces user identifiers with salted HMAC pseudonyms. The same identifier always
+// results in the same pseudonym as long as the same salt is used, so trips of one user can still
+// be correlated without knowing the real identifier.
+type Pseudonymizer struct {
+	salt []byte
+}
+
+// NewPseudonymizer creates a new Pseudonymizer with the given salt
+func NewPseudonymizer(salt []byte) *Pseudonymizer {
+	return &Pseudonymizer{
+		salt: salt,
+	}
+}
+
+// LoadOrCreateSalt reads the salt from path. If the file does not exist a new random salt is created
+// and stored there. Salts shorter than MinSaltSize are rejected. Keep this file separate from any data
+// you share.
+func LoadOrCreateSalt(path string) ([]byte, error) {
+	if fileDoesExist(path) {
+		salt, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(salt) < MinSaltSize {
+			return nil, fmt.Errorf("Salt in %s has %d bytes, at least %d are required", path, len(salt), MinSaltSize)
+		}
+		return salt, nil
+	}
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, salt, 0600); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Pseudonym returns the pseudonym for id. Empty identifiers stay empty.
+func (p *Pseudonymizer) Pseudonym(id string) string {
+	if id == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AnonymizeTrips replaces the UserID of all trips with its pseudonym
+func (p *Pseudonymizer) AnonymizeTrips(in <-chan *Trip) <-chan *Trip {
+	out := make(chan *Trip, 100)
+	go func() {
+		for trip := range in {
+			trip.UserID = p.Pseudonym(trip.UserID)
+			out <- trip
+		}
+		close(out)
+	}()
+	return out
+}
+
+// AnonymizeScrapeResults replaces the StateUpdatedByUserID of all scooters with its pseudonym
+func (p *Pseudonymizer) AnonymizeScrapeResults(in <-chan ScrapeResult) <-chan ScrapeResult {
+	out := make(chan ScrapeResult, 100)
+	go func() {
+		for res := range in {
+			for _, scooter := range res.Scooters() {
+				scooter.StateUpdatedByUserID = p.Pseudonym(scooter.StateUpdatedByUserID)
+			}
+			out <- res
+		}
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,65 @@
+package sharealyzer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPseudonym(t *testing.T) {
+	p := NewPseudonymizer([]byte("salt"))
+	pseudonym := p.Pseudonym("user-1")
+	assert.Equal(t, pseudonym, p.Pseudonym("user-1"))
+	assert.Len(t, pseudonym, 64)
+	assert.NotContains(t, pseudonym, "user-1")
+	assert.NotEqual(t, pseudonym, p.Pseudonym("user-2"))
+	assert.NotEqual(t, pseudonym, NewPseudonymizer([]byte("other salt")).Pseudonym("user-1"))
+	assert.Empty(t, p.Pseudonym(""))
+}
+
+func TestAnonymizeTripsAndScrapeResults(t *testing.T) {
+	p := NewPseudonymizer([]byte("salt"))
+	trips := make(chan *Trip, 2)
+	trips <- &Trip{UserID: "user-1"}
+	trips <- &Trip{UserID: "user-1"}
+	close(trips)
+	var anonymized []*Trip
+	for trip := range p.AnonymizeTrips(trips) {
+		anonymized = append(anonymized, trip)
+	}
+	require.Len(t, anonymized, 2)
+	assert.Equal(t, p.Pseudonym("user-1"), anonymized[0].UserID)
+	assert.Equal(t, anonymized[0].UserID, anonymized[1].UserID)
+
+	results := make(chan ScrapeResult, 1)
+	results <- NewScrapeResult("circ", time.Now(), []*Scooter{{ID: "a", StateUpdatedByUserID: "user-1"}, {ID: "b"}})
+	close(results)
+	res := <-p.AnonymizeScrapeResults(results)
+	assert.Equal(t, p.Pseudonym("user-1"), res.Scooters()[0].StateUpdatedByUserID)
+	assert.Empty(t, res.Scooters()[1].StateUpdatedByUserID)
+}
+
+func TestLoadOrCreateSalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "salt")
+	salt, err := LoadOrCreateSalt(path)
+	require.NoError(t, err)
+	assert.Len(t, salt, SaltSize)
+	loaded, err := LoadOrCreateSalt(path)
+	require.NoError(t, err)
+	assert.Equal(t, salt, loaded)
+}
+
+func TestLoadOrCreateSaltRejectsShortSalts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "salt")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	_, err := LoadOrCreateSalt(path)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("short salt"), 0600))
+	_, err = LoadOrCreateSalt(path)
+	assert.Error(t, err)
+}
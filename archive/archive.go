@@ -0,0 +1,236 @@
+// Package archive contains helpers to work with the on disk layout of scrape archives. Scrape results
+// are stored as gzipped JSON arrays or JSON Lines in one folder per provider and day, i.e.
+// baseDir/circ_2019-10-08/circ_2019-10-08T05:11:27+01:00.json.gz
+// Every day folder may contain an index.jsonl describing its files, which lets readers select files
+// without listing the folder.
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FolderTimeFormat is the time format used for the day part of folder names
+const FolderTimeFormat = "2006-01-02"
+
+// FileSuffix is the suffix of every scrape file
+const FileSuffix = ".json.gz"
+
+var (
+	fileNameRegex   = regexp.MustCompile(`^([a-z0-9]+)_([0-9-T:+Z]+)\.json\.gz$`)
+	folderNameRegex = regexp.MustCompile(`^([a-z0-9]+)_([0-9]{4}-[0-9]{2}-[0-9]{2})$`)
+)
+
+// FolderName returns the name of the day folder for the given provider and date
+func FolderName(provider string, date time.Time) string {
+	return fmt.Sprintf("%s_%s", provider, date.Format(FolderTimeFormat))
+}
+
+// FileName returns the name of the scrape file for the given provider and scrape date
+func FileName(provider string, date time.Time) string {
+	return fmt.Sprintf("%s_%s%s", provider, date.Format(time.RFC3339), FileSuffix)
+}
+
+// ParseFileName extracts the provider and the scrape date in UTC from the name of a scrape file
+func ParseFileName(fileName string) (provider string, date time.Time, err error) {
+	provider, date, _, err = parseFileName(fileName)
+	return
+}
+
+// ParseLocalFileName works like ParseFileName but returns the scrape date in the time zone of the host which
+// scraped the file
+func ParseLocalFileName(fileName string) (provider string, date time.Time, err error) {
+	provider, date, offset, err := parseFileName(fileName)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return provider, date.In(time.FixedZone("", offset)), nil
+}
+
+// parseFileName works like ParseFileName but also returns the UTC offset of the host which scraped the file
+func parseFileName(fileName string) (provider string, date time.Time, offset int, err error) {
+	matches := fileNameRegex.FindStringSubmatch(filepath.Base(fileName))
+	if matches == nil {
+		return "", time.Time{}, 0, fmt.Errorf("%s is not a valid scrape file name", fileName)
+	}
+	date, offset, err = ParseScrapeDate(matches[2])
+	if err != nil {
+		return "", time.Time{}, 0, errors.Wrapf(err, "Invalid date in file name %s", fileName)
+	}
+	return matches[1], date, offset, nil
+}
+
+// ParseScrapeDate parses the date of a scrape file name. File names embed the UTC offset of the host which
+// scraped them, so the date is normalized to UTC and the original offset is returned in seconds east of UTC.
+func ParseScrapeDate(value string) (date time.Time, offset int, err error) {
+	date, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	_, offset = date.Zone()
+	return date.UTC(), offset, nil
+}
+
+// ParseFolderName extracts the provider and the day from the name of a day folder
+func ParseFolderName(folderName string) (provider string, day time.Time, err error) {
+	matches := folderNameRegex.FindStringSubmatch(filepath.Base(folderName))
+	if matches == nil {
+		return "", time.Time{}, fmt.Errorf("%s is not a valid day folder name", folderName)
+	}
+	day, err = time.Parse(FolderTimeFormat, matches[2])
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "Invalid date in folder name %s", folderName)
+	}
+	return matches[1], day, nil
+}
+
+// IsDayFolder returns true if the given name is a valid day folder name
+func IsDayFolder(name string) bool {
+	return folderNameRegex.MatchString(filepath.Base(name))
+}
+
+// DayFolders returns the sorted paths of all day folders within baseDir. Days packed into a tar file are
+// returned as the path of their former day folder. Other files and folders are ignored.
+func DayFolders(baseDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read base directory")
+	}
+	var folders []string
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && info.Mode().IsRegular() && strings.HasSuffix(name, TarSuffix) {
+			name = strings.TrimSuffix(name, TarSuffix)
+		} else if !info.IsDir() {
+			continue
+		}
+		if IsDayFolder(name) && !seen[name] {
+			seen[name] = true
+			folders = append(folders, filepath.Join(baseDir, name))
+		}
+	}
+	sort.Strings(folders)
+	return folders, nil
+}
+
+// ScrapeFiles returns the sorted paths of all scrape files within a day folder, which may be packed. Files
+// written to a packed day recreate its folder and are returned together with the files of the tar.
+func ScrapeFiles(dayFolder string) ([]string, error) {
+	if !Packed(dayFolder) {
+		return folderScrapeFiles(dayFolder)
+	}
+	files, err := packedScrapeFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dayFolder); os.IsNotExist(err) {
+		return files, nil
+	}
+	folderFiles, err := folderScrapeFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	return mergeFiles(files, folderFiles), nil
+}
+
+// folderScrapeFiles returns the sorted paths of the scrape files stored in the day folder itself, files of
+// the tar of a packed day are ignored
+func folderScrapeFiles(dayFolder string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dayFolder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read day folder %s", dayFolder)
+	}
+	var files []string
+	for _, info := range infos {
+		if !info.IsDir() && fileNameRegex.MatchString(info.Name()) {
+			files = append(files, filepath.Join(dayFolder, info.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FoldersInRange returns the sorted paths of all day folders within baseDir which may contain scrape files
+// with a scrape date in [from, to). Folders are named after the local day of the scrapes, so folders
+// within a day of time zone offset around the range are included.
+func FoldersInRange(baseDir string, from, to time.Time) ([]string, error) {
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	var folders []string
+	for _, dayFolder := range dayFolders {
+		_, day, err := ParseFolderName(dayFolder)
+		if err != nil {
+			return nil, err
+		}
+		if !day.Before(from.AddDate(0, 0, -2)) && !day.After(to.AddDate(0, 0, 1)) {
+			folders = append(folders, dayFolder)
+		}
+	}
+	return folders, nil
+}
+
+// FilesInRange returns the sorted paths of all scrape files within baseDir with a scrape date
+// in [from, to). Only the day folders returned by FoldersInRange are looked into and the index of a day
+// folder is used instead of listing it if it is fresh.
+func FilesInRange(baseDir string, from, to time.Time) ([]string, error) {
+	dayFolders, err := FoldersInRange(baseDir, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, dayFolder := range dayFolders {
+		entries, err := DayFiles(dayFolder)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Date.Before(from) && entry.Date.Before(to) {
+				files = append(files, filepath.Join(dayFolder, entry.File))
+			}
+		}
+	}
+	return files, nil
+}
+
+// ErrNoScrapeFiles is returned if an archive does not contain any scrape files
+var ErrNoScrapeFiles = errors.New("No scrape files found")
+
+// LatestFile returns the path of the most recent scrape file within baseDir
+func LatestFile(baseDir string) (string, error) {
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return "", err
+	}
+	for i := len(dayFolders) - 1; i >= 0; i-- {
+		files, err := ScrapeFiles(dayFolders[i])
+		if err != nil {
+			return "", err
+		}
+		var latest string
+		var latestDate time.Time
+		for _, file := range files {
+			_, date, err := ParseFileName(file)
+			if err != nil {
+				continue
+			}
+			if latest == "" || date.After(latestDate) {
+				latest, latestDate = file, date
+			}
+		}
+		if latest != "" {
+			return latest, nil
+		}
+	}
+	return "", ErrNoScrapeFiles
+}
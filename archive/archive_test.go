@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileName(t *testing.T) {
+	provider, date, err := ParseFileName("circ_2019-10-08T05:11:27+01:00.json.gz")
+	require.NoError(t, err)
+	assert.Equal(t, "circ", provider)
+	assert.Equal(t, time.Date(2019, 10, 8, 4, 11, 27, 0, time.UTC), date)
+
+	date, offset, err := ParseScrapeDate("2019-10-08T05:11:27+01:00")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, date.Location())
+	assert.Equal(t, 3600, offset)
+
+	_, _, err = ParseFileName("circ_garbage.json.gz")
+	assert.Error(t, err)
+	_, _, err = ParseFileName("something.txt")
+	assert.Error(t, err)
+}
+
+func TestRepairQuarantinesCorruptFiles(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	dayFolder := filepath.Join(baseDir, FolderName("circ", date))
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+
+	validFile := filepath.Join(dayFolder, FileName("circ", date))
+	require.NoError(t, WriteFile(validFile, []byte(`[{"identifier":"abc"}]`)))
+	corruptFile := filepath.Join(dayFolder, FileName("circ", date.Add(time.Minute)))
+	require.NoError(t, ioutil.WriteFile(corruptFile, []byte{0x1f, 0x8b, 0x08}, 0660))
+
+	report, err := Repair(baseDir, RepairOptions{Recompress: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, []string{corruptFile}, report.Quarantined)
+	assert.Equal(t, 1, report.Recompressed)
+
+	_, err = os.Stat(filepath.Join(baseDir, DefaultQuarantineFolder, filepath.Base(dayFolder), filepath.Base(corruptFile)))
+	assert.NoError(t, err)
+
+	// The newest day isn't repacked, the scraper may still write to it
+	nextDay := filepath.Join(baseDir, FolderName("circ", date.AddDate(0, 0, 1)))
+	require.NoError(t, os.MkdirAll(nextDay, 0770))
+	report, err = Repair(baseDir, RepairOptions{Repack: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{dayFolder + ".tar"}, report.Repacked)
+	_, err = os.Stat(dayFolder)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileChecksum returns the hex encoded SHA-256 checksum of the file at path
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyReport summarizes the result of Verify
+type VerifyReport struct {
+	Checked int
+	// Mismatched files differ from their checksum, they are corrupt or were changed without updating the index
+	Mismatched []string
+	// Missing files are in the index but don't exist
+	Missing []string
+	// Unindexed files exist but aren't in the index
+	Unindexed []string
+	// Unverified is the number of indexed files without checksum, i.e. indexed by older versions
+	Unverified int
+}
+
+// Failed returns true if any file didn't match the index
+func (r *VerifyReport) Failed() bool {
+	return len(r.Mismatched) > 0 || len(r.Missing) > 0 || len(r.Unindexed) > 0
+}
+
+// Verify compares the scrape files of all day folders within baseDir to the checksums in their index. Day
+// folders without index are skipped.
+func Verify(baseDir string) (*VerifyReport, error) {
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{}
+	for _, dayFolder := range dayFolders {
+		if err := VerifyDay(dayFolder, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// VerifyDay compares the scrape files of a day folder to the checksums in its index and adds the result to
+// report. The index is used even if it is stale, since corrupting a file doesn't touch the folder. Files of
+// a packed day which are stored in its tar aren't indexed and not verified.
+func VerifyDay(dayFolder string, report *VerifyReport) error {
+	entries, err := ReadIndex(dayFolder)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	files, err := folderScrapeFiles(dayFolder)
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		indexed[entry.File] = true
+		path := filepath.Join(dayFolder, entry.File)
+		if entry.SHA256 == "" {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				report.Missing = append(report.Missing, path)
+			} else {
+				report.Unverified++
+			}
+			continue
+		}
+		checksum, err := FileChecksum(path)
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, path)
+			continue
+		} else if err != nil {
+			return err
+		}
+		report.Checked++
+		if checksum != entry.SHA256 {
+			report.Mismatched = append(report.Mismatched, path)
+		}
+	}
+	for _, file := range files {
+		if !indexed[filepath.Base(file)] {
+			report.Unindexed = append(report.Unindexed, file)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DownsampleReport summarizes what Downsample did
+type DownsampleReport struct {
+	Kept    int
+	Dropped int
+}
+
+// Downsample copies the archive in baseDir to outDir, keeping only the first scrape file of every interval.
+// The kept files are copied unchanged, so their names still contain the real scrape date. An interval of
+// 5 or 15 minutes still allows detecting trips which are longer than the interval.
+func Downsample(baseDir, outDir string, interval time.Duration) (*DownsampleReport, error) {
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &DownsampleReport{}
+	for _, dayFolder := range dayFolders {
+		files, err := ScrapeFiles(dayFolder)
+		if err != nil {
+			return report, err
+		}
+		outFolder := filepath.Join(outDir, filepath.Base(dayFolder))
+		if err := os.MkdirAll(outFolder, 0770); err != nil {
+			return report, errors.Wrapf(err, "Failed to create output folder %s", outFolder)
+		}
+
+		var lastBucket time.Time
+		for _, file := range files {
+			_, date, err := ParseFileName(file)
+			if err != nil {
+				return report, err
+			}
+			bucket := date.Truncate(interval)
+			if !lastBucket.IsZero() && bucket.Equal(lastBucket) {
+				report.Dropped++
+				continue
+			}
+			lastBucket = bucket
+
+			if err := copyScrapeFile(file, filepath.Join(outFolder, filepath.Base(file))); err != nil {
+				return report, err
+			}
+			report.Kept++
+		}
+	}
+	return report, nil
+}
+
+// copyScrapeFile copies a scrape file, which can be a member of a packed day
+func copyScrapeFile(from, to string) error {
+	in, err := OpenFile(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
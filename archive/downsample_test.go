@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsample(t *testing.T) {
+	baseDir, outDir := t.TempDir(), t.TempDir()
+	// Intervals are aligned to the clock
+	date := time.Date(2019, 10, 8, 23, 30, 0, 0, time.UTC)
+	var kept []string
+	for _, offset := range []time.Duration{
+		0,
+		// Same interval as the first file
+		5 * time.Minute,
+		14*time.Minute + 59*time.Second,
+		// Next interval, the first file in it is kept
+		15*time.Minute + 30*time.Second,
+		16 * time.Minute,
+		// The next day starts with a new interval
+		30 * time.Minute,
+		35 * time.Minute,
+		50 * time.Minute,
+	} {
+		path := writeScrapeFile(t, baseDir, date.Add(offset), record{ID: offset.String()})
+		switch offset {
+		case 0, 15*time.Minute + 30*time.Second, 30 * time.Minute, 50 * time.Minute:
+			kept = append(kept, path)
+		}
+	}
+
+	// Packed days are downsampled as well
+	_, err := RepackDay(filepath.Dir(kept[len(kept)-1]))
+	require.NoError(t, err)
+
+	report, err := Downsample(baseDir, outDir, 15*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, &DownsampleReport{Kept: 4, Dropped: 4}, report)
+
+	dayFolders, err := DayFolders(outDir)
+	require.NoError(t, err)
+	require.Len(t, dayFolders, 2)
+	var files []string
+	for _, dayFolder := range dayFolders {
+		dayFiles, err := ScrapeFiles(dayFolder)
+		require.NoError(t, err)
+		for _, file := range dayFiles {
+			files = append(files, filepath.Base(file))
+		}
+	}
+	var expected []string
+	for _, path := range kept {
+		expected = append(expected, filepath.Base(path))
+	}
+	assert.Equal(t, expected, files)
+
+	// Kept files are copied unchanged
+	for _, path := range []string{kept[0], kept[len(kept)-1]} {
+		original, err := ReadFile(path)
+		require.NoError(t, err)
+		copied, err := ReadFile(filepath.Join(outDir, filepath.Base(filepath.Dir(path)), filepath.Base(path)))
+		require.NoError(t, err)
+		assert.Equal(t, original, copied)
+	}
+}
@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the encoding of the scooters within a scrape file. Both formats use FileSuffix, readers detect
+// the format from the content.
+type Format string
+
+const (
+	// FormatJSON stores the scooters as a single JSON array
+	FormatJSON Format = "json"
+	// FormatJSONL stores one scooter JSON object per line. These files can be decoded while streaming and
+	// all complete lines of a truncated file can be recovered.
+	FormatJSONL Format = "jsonl"
+)
+
+// ErrTruncated is returned if a scrape file ends within a record
+var ErrTruncated = errors.New("Scrape file is truncated")
+
+// ParseFormat parses the name of a format
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatJSON, FormatJSONL:
+		return Format(name), nil
+	}
+	return "", fmt.Errorf("Unknown scrape file format %s", name)
+}
+
+// DetectFormat returns the format of the decompressed content of a scrape file
+func DetectFormat(data []byte) Format {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return FormatJSON
+	}
+	return FormatJSONL
+}
+
+// jsonNull is the encoding of a nil slice and a record readers reject
+var jsonNull = []byte("null")
+
+// Marshal encodes the scooters, which need to marshal to a JSON array, in the given format. A nil slice
+// is encoded as a scrape without scooters.
+func Marshal(scooters interface{}, format Format) ([]byte, error) {
+	data, err := json.Marshal(scooters)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(data, jsonNull) {
+		data = []byte("[]")
+	}
+	if format != FormatJSONL {
+		return data, nil
+	}
+	records, err := Records(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode writes the scooters, which need to marshal to a JSON array, in the given format to w
+func Encode(w io.Writer, scooters interface{}, format Format) error {
+	data, err := Marshal(scooters, format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode reads the scooters of a scrape file in either format from r and calls fn with the JSON object of
+// every scooter. An empty stream is a JSON Lines file without scooters. Both formats are decoded while streaming, so only one record is held in memory at a time.
+// If Decode fails because the file is truncated or a record is corrupt, fn has already been called for all
+// records before.
+func Decode(r io.Reader, fn func(record json.RawMessage) error) error {
+	_, err := decode(r, fn)
+	return err
+}
+
+// DecodeFile decompresses the scrape file at path while decoding it as Decode does and returns its format.
+// Files of packed days are read from their tar file.
+func DecodeFile(path string, fn func(record json.RawMessage) error) (Format, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gzipReader, err := NewGzipReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gzipReader.Close()
+	return decode(gzipReader, fn)
+}
+
+func decode(r io.Reader, fn func(record json.RawMessage) error) (Format, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			// JSON Lines files of scrapes without scooters are empty
+			return FormatJSONL, nil
+		} else if err != nil {
+			return "", err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		reader.ReadByte()
+	}
+
+	if b, _ := reader.Peek(1); b[0] == '[' {
+		return FormatJSON, decodeArray(reader, fn)
+	}
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.ErrUnexpectedEOF {
+			return FormatJSONL, ErrTruncated
+		} else if err != nil && err != io.EOF {
+			return FormatJSONL, err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if !json.Valid(trimmed) {
+				if err == io.EOF {
+					return FormatJSONL, ErrTruncated
+				}
+				return FormatJSONL, fmt.Errorf("Invalid JSON in line %d", lineNumber)
+			}
+			if bytes.Equal(trimmed, jsonNull) {
+				return FormatJSONL, fmt.Errorf("Null record in line %d", lineNumber)
+			}
+			if err := fn(json.RawMessage(trimmed)); err != nil {
+				return FormatJSONL, err
+			}
+		}
+		if err == io.EOF {
+			return FormatJSONL, nil
+		}
+	}
+}
+
+// decodeArray decodes the elements of a JSON array one by one
+func decodeArray(r io.Reader, fn func(record json.RawMessage) error) error {
+	truncated := func(err error) error {
+		// The decoder reports the end of the input within the array as syntax error
+		if syntaxErr, ok := err.(*json.SyntaxError); ok && syntaxErr.Error() == "unexpected end of JSON input" {
+			return ErrTruncated
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return truncated(err)
+	}
+	for i := 0; dec.More(); i++ {
+		var record json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return truncated(err)
+		}
+		if bytes.Equal(record, jsonNull) {
+			return fmt.Errorf("Null record at index %d", i)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return truncated(err)
+	}
+	return nil
+}
+
+// Records returns the JSON objects of all scooters in the content of a scrape file in either format
+func Records(data []byte) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	err := Decode(bytes.NewReader(data), func(record json.RawMessage) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// Unmarshal decodes the content of a scrape file in either format into v, which needs to be a pointer
+// to a slice
+func Unmarshal(data []byte, v interface{}) error {
+	if DetectFormat(data) == FormatJSON {
+		return json.Unmarshal(data, v)
+	}
+	records, err := Records(data)
+	if err != nil {
+		return err
+	}
+	var array bytes.Buffer
+	array.WriteByte('[')
+	for i, record := range records {
+		if i > 0 {
+			array.WriteByte(',')
+		}
+		array.Write(record)
+	}
+	array.WriteByte(']')
+	return json.Unmarshal(array.Bytes(), v)
+}
@@ -0,0 +1,153 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	ID string `json:"identifier"`
+}
+
+func TestMarshalJSONL(t *testing.T) {
+	data, err := Marshal([]record{{ID: "a"}, {ID: "b"}}, FormatJSONL)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"identifier\":\"a\"}\n{\"identifier\":\"b\"}\n", string(data))
+	assert.Equal(t, FormatJSONL, DetectFormat(data))
+
+	data, err = Marshal([]record{{ID: "a"}}, FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, DetectFormat(data))
+}
+
+func TestEmptyScrapes(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatJSONL} {
+		var scooters []record
+		data, err := Marshal(scooters, format)
+		require.NoError(t, err)
+		records, err := Records(data)
+		require.NoError(t, err, "format %s", format)
+		assert.Empty(t, records)
+	}
+
+	// A JSON Lines scrape without scooters is an empty file
+	data, err := Marshal([]record{}, FormatJSONL)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	detected, err := decode(bytes.NewReader(data), func(json.RawMessage) error {
+		t.Fatal("Empty scrape has no records")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSONL, detected)
+
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	dayFolder := filepath.Join(baseDir, FolderName("circ", date))
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+	require.NoError(t, WriteFile(filepath.Join(dayFolder, FileName("circ", date)), data))
+	report, err := Repair(baseDir, RepairOptions{Salvage: true})
+	require.NoError(t, err)
+	assert.Empty(t, report.Quarantined)
+	assert.Empty(t, report.Salvaged)
+}
+
+func TestDecodeRejectsNullRecords(t *testing.T) {
+	_, err := Records([]byte("{\"identifier\":\"a\"}\nnull\n"))
+	assert.EqualError(t, err, "Null record in line 2")
+
+	_, err = Records([]byte(`[{"identifier":"a"},null]`))
+	assert.EqualError(t, err, "Null record at index 1")
+}
+
+func TestUnmarshalDetectsFormat(t *testing.T) {
+	for _, data := range []string{
+		`[{"identifier":"a"},{"identifier":"b"}]`,
+		"{\"identifier\":\"a\"}\n\n{\"identifier\":\"b\"}",
+	} {
+		var records []record
+		require.NoError(t, Unmarshal([]byte(data), &records))
+		assert.Equal(t, []record{{ID: "a"}, {ID: "b"}}, records)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	records, err := Records([]byte("{\"identifier\":\"a\"}\n{\"identifier\":\"b\"}\n{\"ident"))
+	assert.Equal(t, ErrTruncated, err)
+	assert.Len(t, records, 2)
+
+	// JSON arrays are decoded element by element as well
+	records, err = Records([]byte(`[{"identifier":"a"},{"ident`))
+	assert.Equal(t, ErrTruncated, err)
+	assert.Len(t, records, 1)
+
+	_, err = Records([]byte(`[{"identifier":"a"}`))
+	assert.Equal(t, ErrTruncated, err)
+
+	_, err = Records([]byte("{\"identifier\":\"a\"}\n{garbage}\n{\"identifier\":\"b\"}\n"))
+	assert.EqualError(t, err, "Invalid JSON in line 2")
+}
+
+func TestRepairSalvagesTruncatedFiles(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	dayFolder := filepath.Join(baseDir, FolderName("circ", date))
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+
+	// A gzip stream cut off in the middle of the third record
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write([]byte("{\"identifier\":\"a\"}\n{\"identifier\":\"b\"}\n{\"ident"))
+	gzipWriter.Flush()
+	truncatedFile := filepath.Join(dayFolder, FileName("circ", date))
+	require.NoError(t, ioutil.WriteFile(truncatedFile, buf.Bytes(), 0660))
+
+	report, err := Repair(baseDir, RepairOptions{Salvage: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{truncatedFile}, report.Salvaged)
+	assert.Empty(t, report.Quarantined)
+
+	data, err := ReadFile(truncatedFile)
+	require.NoError(t, err)
+	var records []json.RawMessage
+	require.NoError(t, Unmarshal(data, &records))
+	assert.Len(t, records, 2)
+}
+
+func TestDecodeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, format := range []Format{FormatJSON, FormatJSONL} {
+		path := filepath.Join(dir, string(format)+FileSuffix)
+		data, err := Marshal([]record{{ID: "a"}, {ID: "b"}}, format)
+		require.NoError(t, err)
+		require.NoError(t, WriteFile(path, data))
+
+		var ids []string
+		detected, err := DecodeFile(path, func(raw json.RawMessage) error {
+			var r record
+			require.NoError(t, json.Unmarshal(raw, &r))
+			ids = append(ids, r.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, format, detected)
+		assert.Equal(t, []string{"a", "b"}, ids)
+	}
+}
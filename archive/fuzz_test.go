@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func FuzzParseFileName(f *testing.F) {
+	f.Add("circ_2019-10-08T05:11:27+01:00.json.gz")
+	f.Add("circ_2019-10-08T04:11:27Z.json.gz")
+	f.Add("circ_2019-10-08.json.gz")
+	f.Add("index.jsonl")
+	f.Fuzz(func(t *testing.T, name string) {
+		provider, date, err := ParseFileName(name)
+		if err != nil {
+			return
+		}
+		if date.Location() != time.UTC {
+			t.Errorf("Date %s of %s is not in UTC", date, name)
+		}
+		// Names written for the parsed date are parsed to the same date
+		_, again, err := ParseFileName(FileName(provider, date))
+		if err != nil || !again.Equal(date) {
+			t.Errorf("Round trip of %s failed: %s %v", name, again, err)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte(`[{"id":"a"},{"id":"b"}]`))
+	f.Add([]byte("{\"id\":\"a\"}\n{\"id\":\"b\"}\n"))
+	f.Add([]byte(`[{"id":"a"},{"id"`))
+	f.Add([]byte("  \n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		records := 0
+		err := Decode(bytes.NewReader(data), func(record json.RawMessage) error {
+			if !json.Valid(record) {
+				t.Errorf("Decoded invalid record %q", record)
+			}
+			records++
+			return nil
+		})
+		if err == nil && DetectFormat(data) == FormatJSON {
+			var array []json.RawMessage
+			if json.Unmarshal(data, &array) == nil && len(array) != records {
+				t.Errorf("Decoded %d records of an array with %d", records, len(array))
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/pgzip"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ParallelGzipBlockSize is the amount of uncompressed data a single goroutine of a parallel GzipWriter
+	// compresses
+	ParallelGzipBlockSize = 256 << 10
+	// ParallelGzipThreshold is the input size from which a GzipWriter compresses blocks in parallel. Below
+	// it the goroutines cost more than they save.
+	ParallelGzipThreshold = 2 * ParallelGzipBlockSize
+)
+
+// NewGzipReader returns a reader decompressing the gzip stream in r. All reading of gzipped scrape files
+// goes through here, so the implementation can be exchanged in one place. Concatenated gzip members, as
+// written by earlier versions, are read as one stream.
+func NewGzipReader(r io.Reader) (*gzip.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// GzipWriter compresses its input into a single gzip member. Inputs smaller than ParallelGzipThreshold
+// are buffered and compressed by a single gzip.Writer, larger ones are compressed in blocks of
+// ParallelGzipBlockSize by one goroutine per CPU.
+type GzipWriter struct {
+	w     io.Writer
+	level int
+
+	buf    []byte
+	out    io.WriteCloser
+	closed bool
+}
+
+// NewGzipWriter returns a writer compressing to w with the given compression level. All writing of gzipped
+// scrape files goes through here, so the implementation can be exchanged in one place.
+func NewGzipWriter(w io.Writer, level int) (*GzipWriter, error) {
+	// Validate the level early, the compressing writer is only created once the input size is known
+	if _, err := pgzip.NewWriterLevel(nil, level); err != nil {
+		return nil, err
+	}
+	return &GzipWriter{w: w, level: level}, nil
+}
+
+// Write buffers p until the input reaches ParallelGzipThreshold, after which it is compressed in parallel
+func (g *GzipWriter) Write(p []byte) (int, error) {
+	if g.closed {
+		return 0, errGzipWriterClosed
+	}
+	if g.out != nil {
+		return g.out.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) < ParallelGzipThreshold {
+		return len(p), nil
+	}
+	out, err := pgzip.NewWriterLevel(g.w, g.level)
+	if err != nil {
+		return 0, err
+	}
+	if err := out.SetConcurrency(ParallelGzipBlockSize, runtime.NumCPU()); err != nil {
+		return 0, err
+	}
+	g.out = out
+	buffered := g.buf
+	g.buf = nil
+	if _, err := g.out.Write(buffered); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close compresses the remaining input and waits until everything is written. It doesn't close the
+// underlying writer.
+func (g *GzipWriter) Close() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	if g.out == nil {
+		out, err := gzip.NewWriterLevel(g.w, g.level)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(g.buf); err != nil {
+			return err
+		}
+		g.out = out
+		g.buf = nil
+	}
+	return g.out.Close()
+}
+
+var errGzipWriterClosed = errors.New("gzip writer is closed")
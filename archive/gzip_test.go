@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipWriter(t *testing.T) {
+	// Compressed by a single writer and in parallel blocks
+	for _, scooters := range []int{0, 100, 2000} {
+		data := scrapeFileData(scooters)
+		buf := &bytes.Buffer{}
+		w, err := NewGzipWriter(buf, gzip.BestCompression)
+		require.NoError(t, err)
+		// Write in odd chunks, so the threshold is crossed within a write
+		for rest := data; len(rest) > 0; {
+			chunk := 100003
+			if chunk > len(rest) {
+				chunk = len(rest)
+			}
+			n, err := w.Write(rest[:chunk])
+			require.NoError(t, err)
+			assert.Equal(t, chunk, n)
+			rest = rest[chunk:]
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, w.Close())
+		_, err = w.Write([]byte("x"))
+		assert.Error(t, err)
+
+		// The output is a single gzip member any reader can decompress
+		r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		r.Multistream(false)
+		decompressed, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, decompressed, "%d scooters", scooters)
+	}
+
+	// Files written as several gzip members by earlier versions are read as one stream
+	data := scrapeFileData(100)
+	buf := &bytes.Buffer{}
+	for _, part := range [][]byte{data[:1000], data[1000:]} {
+		w, err := NewGzipWriter(buf, gzip.BestCompression)
+		require.NoError(t, err)
+		_, err = w.Write(part)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+	r, err := NewGzipReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+
+	_, err = NewGzipWriter(&bytes.Buffer{}, 42)
+	assert.Error(t, err)
+}
+
+// scrapeFileData returns the JSON of a scrape of the given number of scooters, about 1 KB per scooter like
+// the devices returned by Circ
+func scrapeFileData(scooters int) []byte {
+	var data []byte
+	data = append(data, '[')
+	for i := 0; i < scooters; i++ {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, fmt.Sprintf(`{"actions":["RESERVE","RIDE"],"broken":false,"brokenUpdateAt":null,`+
+			`"brokenUpdatedByUserIdentifier":null,"brokenUpdatedUserType":null,"connected":true,"currency":"EUR",`+
+			`"description":"","energyLevel":%d,"gpsRefreshRate":60,"hornTimeInMs":500,`+
+			`"identifier":"2e0c7f24-61b1-4a0a-9d0c-%012d","image":null,"initPrice":100,"lastGnssUpdate":%d,`+
+			`"latitude":51.%05d,"locked":true,"longitude":7.%05d,"missing":false,"missingUpdateAt":null,`+
+			`"missingUpdatedByUserIdentifier":null,"missingUpdatedUserType":null,"name":"Circ %d","operational":true,`+
+			`"pricePerMinute":20,"reserved":false,"status":"AVAILABLE","vehicleType":"SCOOTER",`+
+			`"zoneIdentifier":"dortmund-center","zoneName":"Dortmund Center","tags":[],"accessories":[]}`,
+			(i*37)%100, i, 1570366812000+int64(i)*1000, (i*7919)%100000, (i*104729)%100000, i)...)
+	}
+	return append(data, ']')
+}
+
+// BenchmarkGzipWriter compresses scrape files of realistic sizes with GzipWriter and compress/gzip, a fleet
+// of 500 scooters results in about 500 KB of JSON
+func BenchmarkGzipWriter(b *testing.B) {
+	for _, scooters := range []int{100, 500, 2000} {
+		data := scrapeFileData(scooters)
+		b.Run(fmt.Sprintf("%d", scooters), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w, _ := NewGzipWriter(ioutil.Discard, gzip.BestCompression)
+				w.Write(data)
+				w.Close()
+			}
+		})
+		b.Run(fmt.Sprintf("%d/stdlib", scooters), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w, _ := gzip.NewWriterLevel(ioutil.Discard, gzip.BestCompression)
+				w.Write(data)
+				w.Close()
+			}
+		})
+	}
+}
+
+// BenchmarkGzipReader decompresses a scrape file of 500 scooters with NewGzipReader and compress/gzip
+func BenchmarkGzipReader(b *testing.B) {
+	data := scrapeFileData(500)
+	buf := &bytes.Buffer{}
+	w, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	w.Write(data)
+	w.Close()
+	b.Run("archive", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			r, _ := NewGzipReader(bytes.NewReader(buf.Bytes()))
+			io.Copy(ioutil.Discard, r)
+		}
+	})
+	b.Run("stdlib", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			r, _ := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+			io.Copy(ioutil.Discard, r)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// IndexFileName is the name of the index within a day folder
+const IndexFileName = "index.jsonl"
+
+// IndexEntry describes a scrape file of a day folder
+type IndexEntry struct {
+	// File is the name of the scrape file within the day folder
+	File string    `json:"file"`
+	Date time.Time `json:"date"`
+	// Scooters is the number of scooters in the file
+	Scooters int `json:"scooters"`
+	// Size is the size of the compressed file in bytes
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded checksum of the compressed file, it is empty for files indexed by older
+	// versions
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// IndexFresh returns true if the day folder has an index which is at least as new as the folder itself.
+// Adding, removing or replacing files changes the modification time of the folder, so an index which
+// wasn't updated afterwards is stale.
+func IndexFresh(dayFolder string) bool {
+	folderInfo, err := os.Stat(dayFolder)
+	if err != nil {
+		return false
+	}
+	indexInfo, err := os.Stat(filepath.Join(dayFolder, IndexFileName))
+	if err != nil {
+		return false
+	}
+	return !indexInfo.ModTime().Before(folderInfo.ModTime())
+}
+
+// ReadIndex reads the index of a day folder. Entries are sorted by date, if a file was indexed
+// several times the last entry is used.
+func ReadIndex(dayFolder string) ([]IndexEntry, error) {
+	f, err := os.Open(filepath.Join(dayFolder, IndexFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	byFile := make(map[string]IndexEntry)
+	if _, err := decode(bufio.NewReader(f), func(record json.RawMessage) error {
+		var entry IndexEntry
+		if err := json.Unmarshal(record, &entry); err != nil {
+			return err
+		}
+		byFile[entry.File] = entry
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	entries := make([]IndexEntry, 0, len(byFile))
+	for _, entry := range byFile {
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func sortEntries(entries []IndexEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].File < entries[j].File
+		}
+		return entries[i].Date.Before(entries[j].Date)
+	})
+}
+
+// AppendIndex adds an entry to the index of a day folder, the index is created if it doesn't exist
+func AppendIndex(dayFolder string, entry IndexEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dayFolder, IndexFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// BuildIndex indexes all scrape files of a day folder and replaces its index. Files which can't be
+// decoded completely are indexed with the number of scooters read before the error. Files of a packed day
+// which are stored in its tar aren't indexed.
+func BuildIndex(dayFolder string) ([]IndexEntry, error) {
+	files, err := folderScrapeFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]IndexEntry, 0, len(files))
+	var data []byte
+	for _, file := range files {
+		_, date, err := ParseFileName(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := FileChecksum(file)
+		if err != nil {
+			return nil, err
+		}
+		entry := IndexEntry{File: filepath.Base(file), Date: date, Size: info.Size(), SHA256: checksum}
+		DecodeFile(file, func(json.RawMessage) error {
+			entry.Scooters++
+			return nil
+		})
+		entries = append(entries, entry)
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	sortEntries(entries)
+
+	indexPath := filepath.Join(dayFolder, IndexFileName)
+	tmpPath := indexPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0660); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		return nil, err
+	}
+	// Renaming changed the modification time of the folder, the index needs to be at least as new
+	now := time.Now()
+	return entries, os.Chtimes(indexPath, now, now)
+}
+
+// DayFiles returns the entries of all scrape files of a day folder sorted by date. The index is used if it
+// is fresh, otherwise the folder is listed and only the file name and date of the entries are set. The index
+// of a packed day only covers the files written after it was packed, so packed days are always listed.
+func DayFiles(dayFolder string) ([]IndexEntry, error) {
+	if IndexFresh(dayFolder) && !Packed(dayFolder) {
+		if entries, err := ReadIndex(dayFolder); err == nil {
+			return entries, nil
+		}
+	}
+	files, err := ScrapeFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]IndexEntry, 0, len(files))
+	for _, file := range files {
+		_, date, err := ParseFileName(file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, IndexEntry{File: filepath.Base(file), Date: date})
+	}
+	sortEntries(entries)
+	return entries, nil
+}
@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeScrapeFile(t *testing.T, baseDir string, date time.Time, records ...record) string {
+	dayFolder := filepath.Join(baseDir, FolderName("circ", date))
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+	data, err := Marshal(records, FormatJSON)
+	require.NoError(t, err)
+	path := filepath.Join(dayFolder, FileName("circ", date))
+	require.NoError(t, WriteFile(path, data))
+	return path
+}
+
+func TestBuildIndex(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	writeScrapeFile(t, baseDir, date.Add(time.Minute), record{ID: "a"})
+	path := writeScrapeFile(t, baseDir, date, record{ID: "a"}, record{ID: "b"})
+	dayFolder := filepath.Dir(path)
+	assert.False(t, IndexFresh(dayFolder))
+
+	entries, err := BuildIndex(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, filepath.Base(path), entries[0].File)
+	assert.True(t, entries[0].Date.Equal(date))
+	assert.Equal(t, 2, entries[0].Scooters)
+	assert.NotZero(t, entries[0].Size)
+	assert.True(t, IndexFresh(dayFolder))
+
+	read, err := ReadIndex(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, read, 2)
+	assert.Equal(t, 1, read[1].Scooters)
+}
+
+func TestDayFilesUsesFreshIndex(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	path := writeScrapeFile(t, baseDir, date, record{ID: "a"})
+	dayFolder := filepath.Dir(path)
+	_, err = BuildIndex(dayFolder)
+	require.NoError(t, err)
+
+	// An indexed file which is not in the folder proves that the index is used
+	require.NoError(t, AppendIndex(dayFolder, IndexEntry{File: "circ_indexed.json.gz", Date: date.Add(time.Hour)}))
+	entries, err := DayFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	files, err := FilesInRange(baseDir, date, date.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{path, filepath.Join(dayFolder, "circ_indexed.json.gz")}, files)
+
+	// Changing the folder after the index makes the index stale, so the folder is listed again
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(dayFolder, future, future))
+	assert.False(t, IndexFresh(dayFolder))
+	entries, err = DayFiles(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, filepath.Base(path), entries[0].File)
+}
+
+func TestFilesInRangeSkipsDistantDays(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	path := writeScrapeFile(t, baseDir, date, record{ID: "a"})
+	// A folder far outside of the range is not looked into, even if its index claims a file in range
+	distantFolder := filepath.Join(baseDir, "circ_2019-12-01")
+	require.NoError(t, os.MkdirAll(distantFolder, 0770))
+	require.NoError(t, AppendIndex(distantFolder, IndexEntry{File: "circ_distant.json.gz", Date: date}))
+	require.True(t, IndexFresh(distantFolder))
+
+	files, err := FilesInRange(baseDir, date.Add(-time.Hour), date.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, files)
+}
+
+func TestVerify(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	intact := writeScrapeFile(t, baseDir, date, record{ID: "a"})
+	corrupt := writeScrapeFile(t, baseDir, date.Add(time.Minute), record{ID: "a"})
+	missing := writeScrapeFile(t, baseDir, date.Add(2*time.Minute), record{ID: "a"})
+	dayFolder := filepath.Dir(intact)
+	entries, err := BuildIndex(dayFolder)
+	require.NoError(t, err)
+	checksum, err := FileChecksum(intact)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, entries[0].SHA256)
+
+	report, err := Verify(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Checked)
+	assert.False(t, report.Failed())
+
+	// Flip a byte within the compressed data without changing the size
+	data, err := ioutil.ReadFile(corrupt)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(corrupt, data, 0660))
+	require.NoError(t, os.Remove(missing))
+	unindexed := writeScrapeFile(t, baseDir, date.Add(3*time.Minute), record{ID: "a"})
+
+	report, err = Verify(baseDir)
+	require.NoError(t, err)
+	assert.True(t, report.Failed())
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, []string{corrupt}, report.Mismatched)
+	assert.Equal(t, []string{missing}, report.Missing)
+	assert.Equal(t, []string{unindexed}, report.Unindexed)
+}
@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot groups all scrape files which belong to the same canonical point in time
+type Snapshot struct {
+	Provider string
+	// Time is the canonical time of the snapshot in UTC
+	Time time.Time
+	// ZoneOffset is the UTC offset in seconds of the host which scraped the first file of the snapshot
+	ZoneOffset int
+	Files      []string
+}
+
+// LocalTime returns the canonical time in the time zone of the host which scraped the first file. Merged
+// files are named after it, so they end up in the same day folders as the files they were merged from.
+func (s *Snapshot) LocalTime() time.Time {
+	return s.Time.In(time.FixedZone("", s.ZoneOffset))
+}
+
+// Snapshots collects the scrape files of all given base directories and groups them into snapshots. The
+// scrape date of every file is rounded to interval, this rounded date is the canonical time of the snapshot.
+// The snapshots are returned sorted by their canonical time and provider. Files of the first base directories
+// take precedence for the time zone of a snapshot.
+func Snapshots(baseDirs []string, interval time.Duration) ([]*Snapshot, error) {
+	snapshots := make(map[string]*Snapshot)
+	for _, baseDir := range baseDirs {
+		dayFolders, err := DayFolders(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, dayFolder := range dayFolders {
+			files, err := ScrapeFiles(dayFolder)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				provider, date, offset, err := parseFileName(file)
+				if err != nil {
+					return nil, err
+				}
+				canonicalTime := date.Round(interval)
+				key := provider + canonicalTime.UTC().Format(time.RFC3339)
+				snapshot, exists := snapshots[key]
+				if !exists {
+					snapshot = &Snapshot{
+						Provider:   provider,
+						Time:       canonicalTime,
+						ZoneOffset: offset,
+					}
+					snapshots[key] = snapshot
+				}
+				snapshot.Files = append(snapshot.Files, file)
+			}
+		}
+	}
+
+	sorted := make([]*Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		sorted = append(sorted, snapshot)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].Provider < sorted[j].Provider
+	})
+	return sorted, nil
+}
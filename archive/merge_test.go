@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	write := func(baseDir, provider string, date time.Time) string {
+		dayFolder := filepath.Join(baseDir, FolderName(provider, date))
+		require.NoError(t, os.MkdirAll(dayFolder, 0770))
+		path := filepath.Join(dayFolder, FileName(provider, date))
+		require.NoError(t, WriteFile(path, []byte(`[]`)))
+		return path
+	}
+	date := time.Date(2019, 10, 8, 23, 59, 50, 0, time.UTC)
+	// Both scrapers saw the same point in time a few seconds apart
+	late := write(first, "circ", date.Add(-35*time.Second))
+	early := write(second, "circ", date.Add(-40*time.Second))
+	other := write(second, "tier", date.Add(-35*time.Second))
+	// Rounded to the next day across a day boundary
+	nextDay := write(first, "circ", date)
+	separate := write(second, "circ", date.Add(-2*time.Minute))
+
+	snapshots, err := Snapshots([]string{first, second}, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 4)
+
+	assert.Equal(t, date.Add(-2*time.Minute).Round(time.Minute), snapshots[0].Time)
+	assert.Equal(t, []string{separate}, snapshots[0].Files)
+
+	assert.Equal(t, "circ", snapshots[1].Provider)
+	assert.Equal(t, time.Date(2019, 10, 8, 23, 59, 0, 0, time.UTC), snapshots[1].Time)
+	assert.Equal(t, []string{late, early}, snapshots[1].Files)
+	assert.Equal(t, "tier", snapshots[2].Provider)
+	assert.Equal(t, snapshots[1].Time, snapshots[2].Time)
+	assert.Equal(t, []string{other}, snapshots[2].Files)
+
+	assert.Equal(t, time.Date(2019, 10, 9, 0, 0, 0, 0, time.UTC), snapshots[3].Time)
+	assert.Equal(t, []string{nextDay}, snapshots[3].Files)
+
+	// Snapshots keep the UTC offset of the scraping host
+	cest := time.FixedZone("", 2*60*60)
+	local := write(first, "circ", time.Date(2019, 10, 9, 0, 30, 5, 0, cest))
+	snapshots, err = Snapshots([]string{first}, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+	assert.Equal(t, []string{local}, snapshots[0].Files)
+	assert.Equal(t, time.Date(2019, 10, 8, 22, 30, 0, 0, time.UTC), snapshots[0].Time)
+	assert.Equal(t, 2*60*60, snapshots[0].ZoneOffset)
+	assert.Equal(t, "circ_2019-10-09", FolderName("circ", snapshots[0].LocalTime()))
+	assert.Equal(t, "circ_2019-10-09T00:30:00+02:00"+FileSuffix, FileName("circ", snapshots[0].LocalTime()))
+
+	_, err = Snapshots([]string{filepath.Join(first, "missing")}, time.Minute)
+	assert.Error(t, err)
+}
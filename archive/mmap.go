@@ -0,0 +1,19 @@
+package archive
+
+// MappedFile is the content of a file mapped into memory by MapFile
+type MappedFile struct {
+	Data []byte
+
+	unmap func() error
+}
+
+// Close releases the mapping, Data must not be used afterwards
+func (m *MappedFile) Close() error {
+	m.Data = nil
+	if m.unmap == nil {
+		return nil
+	}
+	unmap := m.unmap
+	m.unmap = nil
+	return unmap()
+}
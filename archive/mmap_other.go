@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package archive
+
+import (
+	"io/ioutil"
+)
+
+// MapFile reads the file at path into memory, since memory mapping isn't supported on this platform
+func MapFile(path string) (*MappedFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{Data: data}, nil
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package archive
+
+import (
+	"os"
+	"syscall"
+)
+
+// MapFile maps the file at path read only into memory. Data stays valid until the MappedFile is closed,
+// so nothing referencing it may be kept after Close.
+func MapFile(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		// Empty files can't be mapped
+		return &MappedFile{}, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return &MappedFile{Data: data, unmap: func() error {
+		return syscall.Munmap(data)
+	}}, nil
+}
@@ -0,0 +1,295 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultQuarantineFolder is the folder within the base directory where corrupt files are moved to
+const DefaultQuarantineFolder = "quarantine"
+
+// RepairOptions controls what Repair does with the files of an archive
+type RepairOptions struct {
+	// QuarantineDir is the directory corrupt files are moved to. Defaults to baseDir/quarantine
+	QuarantineDir string
+	// Recompress rewrites all valid files with the best gzip compression
+	Recompress bool
+	// Repack packs all files of a day into a single tar file next to the day folder and removes the folder.
+	// The newest day of every provider isn't packed, since the scraper may still write to it.
+	Repack bool
+	// Salvage rewrites truncated JSON Lines files with their complete records instead of quarantining them
+	Salvage bool
+}
+
+// RepairReport summarizes what Repair did
+type RepairReport struct {
+	Checked      int
+	Quarantined  []string
+	Recompressed int
+	Repacked     []string
+	Salvaged     []string
+}
+
+// Repair checks every scrape file within baseDir. Files which can't be decompressed or don't contain valid
+// JSON (usually because the scraper crashed while writing them) are moved to the quarantine directory.
+func Repair(baseDir string, opts RepairOptions) (*RepairReport, error) {
+	if opts.QuarantineDir == "" {
+		opts.QuarantineDir = filepath.Join(baseDir, DefaultQuarantineFolder)
+	}
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	newestDays := make(map[string]string)
+	for _, dayFolder := range dayFolders {
+		if provider, _, err := ParseFolderName(dayFolder); err == nil {
+			newestDays[provider] = dayFolder
+		}
+	}
+
+	report := &RepairReport{}
+	for _, dayFolder := range dayFolders {
+		if _, err := os.Stat(dayFolder); os.IsNotExist(err) {
+			// The files of packed days were checked before they were packed
+			continue
+		}
+		files, err := folderScrapeFiles(dayFolder)
+		if err != nil {
+			return report, err
+		}
+		// Rewritten files no longer match the checksums of the index
+		changed := false
+		for _, file := range files {
+			report.Checked++
+			data, err := ReadFile(file)
+			if err != nil && opts.Salvage {
+				if salvaged, salvageErr := salvage(file); salvageErr == nil {
+					log.Printf("[WARNING] Salvaged %d records of truncated file %s", salvaged, file)
+					report.Salvaged = append(report.Salvaged, file)
+					changed = true
+					continue
+				}
+			}
+			if err != nil {
+				log.Printf("[WARNING] Quarantining corrupt file %s: %s", file, err)
+				if err := quarantine(file, filepath.Join(opts.QuarantineDir, filepath.Base(dayFolder))); err != nil {
+					return report, err
+				}
+				report.Quarantined = append(report.Quarantined, file)
+				changed = true
+				continue
+			}
+			if opts.Recompress {
+				if err := WriteFile(file, data); err != nil {
+					return report, errors.Wrapf(err, "Failed to recompress %s", file)
+				}
+				report.Recompressed++
+				changed = true
+			}
+		}
+		if changed {
+			if _, err := os.Stat(filepath.Join(dayFolder, IndexFileName)); err == nil {
+				if _, err := BuildIndex(dayFolder); err != nil {
+					return report, errors.Wrapf(err, "Failed to rebuild index of %s", dayFolder)
+				}
+			}
+		}
+		if provider, _, _ := ParseFolderName(dayFolder); opts.Repack && newestDays[provider] != dayFolder {
+			tarPath, err := RepackDay(dayFolder)
+			if err != nil {
+				return report, err
+			}
+			report.Repacked = append(report.Repacked, tarPath)
+		}
+	}
+	return report, nil
+}
+
+// ReadFile decompresses a scrape file and verifies that it contains valid JSON
+func ReadFile(path string) ([]byte, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gzipReader, err := NewGzipReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	data, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Records(data); err != nil {
+		return nil, errors.Wrap(err, "File does not contain valid JSON")
+	}
+	return data, nil
+}
+
+// salvage rewrites a truncated JSON Lines file with all complete records and returns their number
+func salvage(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	gzipReader, err := NewGzipReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gzipReader.Close()
+
+	var buf bytes.Buffer
+	records := 0
+	err = Decode(gzipReader, func(record json.RawMessage) error {
+		buf.Write(record)
+		buf.WriteByte('\n')
+		records++
+		return nil
+	})
+	if err != ErrTruncated || records == 0 {
+		return 0, errors.New("File can't be salvaged")
+	}
+	return records, WriteFile(path, buf.Bytes())
+}
+
+// WriteFile writes data gzip compressed to path. The data is written to a temporary file first which is then
+// renamed, so path never contains a partially written file.
+func WriteFile(path string, data []byte) error {
+	buf := &bytes.Buffer{}
+	gzipWriter, err := NewGzipWriter(buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := gzipWriter.Write(data); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// RepackDay packs all scrape files of a day folder into a single uncompressed tar file (the members
+// stay gzipped) and removes the packed files and the day folder afterwards. If the day was packed before,
+// the files of the folder are merged into the existing tar. It returns the path of the tar file. The readers
+// of this package read packed days through their former day folder.
+func RepackDay(dayFolder string) (string, error) {
+	files, err := folderScrapeFiles(dayFolder)
+	if err != nil {
+		return "", err
+	}
+	tarPath := DayTarPath(dayFolder)
+	var packed *DayTar
+	if Packed(dayFolder) {
+		if packed, err = OpenDayTar(tarPath); err != nil {
+			return "", err
+		}
+		defer packed.Close()
+	}
+	tmpPath := tarPath + ".tmp"
+	tarFile, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer tarFile.Close()
+
+	tarWriter := tar.NewWriter(tarFile)
+	writeMember := func(name string, data []byte) error {
+		_, date, err := ParseFileName(name)
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0660,
+			Size:    int64(len(data)),
+			ModTime: date,
+		}); err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(data)
+		return err
+	}
+	inFolder := make(map[string]bool, len(files))
+	for _, file := range files {
+		inFolder[filepath.Base(file)] = true
+	}
+	if packed != nil {
+		for _, name := range packed.Files() {
+			if inFolder[name] || !fileNameRegex.MatchString(name) {
+				// Files written again after the day was packed replace their packed version
+				continue
+			}
+			data, err := packed.Member(name)
+			if err != nil {
+				return "", err
+			}
+			if err := writeMember(name, data); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if err := writeMember(filepath.Base(file), data); err != nil {
+			return "", err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := tarFile.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, tarPath); err != nil {
+		return "", err
+	}
+	dayTars.forget(tarPath)
+	return tarPath, removePacked(dayFolder, files)
+}
+
+// removePacked removes the packed files and the index of a day folder. The folder itself is only removed if
+// it is empty afterwards, files written while the day was packed are kept for the next RepackDay.
+func removePacked(dayFolder string, files []string) error {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(dayFolder, IndexFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	infos, err := ioutil.ReadDir(dayFolder)
+	if err != nil {
+		return err
+	}
+	if len(infos) > 0 {
+		return nil
+	}
+	return os.Remove(dayFolder)
+}
+
+func quarantine(path, quarantineDir string) error {
+	if err := os.MkdirAll(quarantineDir, 0770); err != nil {
+		return errors.Wrap(err, "Failed to create quarantine directory")
+	}
+	return os.Rename(path, filepath.Join(quarantineDir, filepath.Base(path)))
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DayStats summarizes the scrape files of a day folder
+type DayStats struct {
+	Folder    string    `json:"folder"`
+	Provider  string    `json:"provider"`
+	Day       time.Time `json:"day"`
+	Snapshots int       `json:"snapshots"`
+	// Size is the size of all compressed files in bytes
+	Size    int64 `json:"size"`
+	MinSize int64 `json:"min_size"`
+	MaxSize int64 `json:"max_size"`
+	// MinScooters, MaxScooters and MeanScooters describe the number of available scooters per snapshot
+	MinScooters  int     `json:"min_scooters"`
+	MaxScooters  int     `json:"max_scooters"`
+	MeanScooters float64 `json:"mean_scooters"`
+	// Empty is the number of snapshots without any scooter, usually failed scrapes
+	Empty int `json:"empty"`
+}
+
+// IntervalCount is the number of consecutive snapshots which are Interval apart
+type IntervalCount struct {
+	Interval time.Duration `json:"interval"`
+	Count    int           `json:"count"`
+}
+
+// Gap is a range without snapshots of a provider which is longer than the expected interval
+type Gap struct {
+	Provider string    `json:"provider"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// Duration returns the length of the gap
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// Stats summarizes the data quality of an archive
+type Stats struct {
+	Days []DayStats `json:"days"`
+	// Intervals is the distribution of the time between consecutive snapshots rounded to seconds, ordered
+	// by interval
+	Intervals []IntervalCount `json:"intervals"`
+	Gaps      []Gap           `json:"gaps"`
+}
+
+// Snapshots returns the number of snapshots in the archive
+func (s *Stats) Snapshots() int {
+	snapshots := 0
+	for _, day := range s.Days {
+		snapshots += day.Snapshots
+	}
+	return snapshots
+}
+
+// Size returns the size of all scrape files in bytes
+func (s *Stats) Size() int64 {
+	var size int64
+	for _, day := range s.Days {
+		size += day.Size
+	}
+	return size
+}
+
+// IntervalPercentile returns the interval which p percent of all intervals don't exceed
+func (s *Stats) IntervalPercentile(p float64) time.Duration {
+	total := 0
+	for _, interval := range s.Intervals {
+		total += interval.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(total)))
+	seen := 0
+	for _, interval := range s.Intervals {
+		seen += interval.Count
+		if seen >= rank {
+			return interval.Interval
+		}
+	}
+	return s.Intervals[len(s.Intervals)-1].Interval
+}
+
+// ComputeStats summarizes all day folders within baseDir. Gaps between snapshots of a provider longer
+// than maxGap are reported as missing ranges. Fresh indexes are used for the sizes and scooter counts,
+// files of day folders without fresh index are read.
+func ComputeStats(baseDir string, maxGap time.Duration) (*Stats, error) {
+	dayFolders, err := DayFolders(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{}
+	intervals := make(map[time.Duration]int)
+	lastSnapshots := make(map[string]time.Time)
+	for _, dayFolder := range dayFolders {
+		provider, day, err := ParseFolderName(filepath.Base(dayFolder))
+		if err != nil {
+			return nil, err
+		}
+		entries, err := describedFiles(dayFolder)
+		if err != nil {
+			return nil, err
+		}
+		dayStats := DayStats{Folder: filepath.Base(dayFolder), Provider: provider, Day: day, Snapshots: len(entries)}
+		scooters := 0
+		for i, entry := range entries {
+			dayStats.Size += entry.Size
+			scooters += entry.Scooters
+			if i == 0 || entry.Size < dayStats.MinSize {
+				dayStats.MinSize = entry.Size
+			}
+			if entry.Size > dayStats.MaxSize {
+				dayStats.MaxSize = entry.Size
+			}
+			if i == 0 || entry.Scooters < dayStats.MinScooters {
+				dayStats.MinScooters = entry.Scooters
+			}
+			if entry.Scooters > dayStats.MaxScooters {
+				dayStats.MaxScooters = entry.Scooters
+			}
+			if entry.Scooters == 0 {
+				dayStats.Empty++
+			}
+
+			if last, exists := lastSnapshots[provider]; exists {
+				interval := entry.Date.Sub(last)
+				intervals[interval.Round(time.Second)]++
+				if maxGap > 0 && interval > maxGap {
+					stats.Gaps = append(stats.Gaps, Gap{Provider: provider, From: last, To: entry.Date})
+				}
+			}
+			lastSnapshots[provider] = entry.Date
+		}
+		if len(entries) > 0 {
+			dayStats.MeanScooters = float64(scooters) / float64(len(entries))
+		}
+		stats.Days = append(stats.Days, dayStats)
+	}
+	for interval, count := range intervals {
+		stats.Intervals = append(stats.Intervals, IntervalCount{Interval: interval, Count: count})
+	}
+	sort.Slice(stats.Intervals, func(i, j int) bool {
+		return stats.Intervals[i].Interval < stats.Intervals[j].Interval
+	})
+	return stats, nil
+}
+
+// describedFiles returns the entries of all scrape files of a day folder with their size and number of
+// scooters, which are read from the files if the index isn't fresh
+func describedFiles(dayFolder string) ([]IndexEntry, error) {
+	if IndexFresh(dayFolder) {
+		if entries, err := ReadIndex(dayFolder); err == nil {
+			return entries, nil
+		}
+	}
+	entries, err := DayFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		path := filepath.Join(dayFolder, entries[i].File)
+		size, err := fileSize(path)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Size = size
+		DecodeFile(path, func(json.RawMessage) error {
+			entries[i].Scooters++
+			return nil
+		})
+	}
+	return entries, nil
+}
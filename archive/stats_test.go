@@ -0,0 +1,50 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeStats(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	start := time.Date(2019, 10, 8, 23, 58, 0, 0, time.UTC)
+	writeScrapeFile(t, baseDir, start, record{ID: "a"}, record{ID: "b"})
+	writeScrapeFile(t, baseDir, start.Add(time.Minute), record{ID: "a"})
+	// The scraper was down for an hour after midnight
+	path := writeScrapeFile(t, baseDir, start.Add(2*time.Minute), record{ID: "a"}, record{ID: "b"}, record{ID: "c"})
+	writeScrapeFile(t, baseDir, start.Add(62*time.Minute), []record{}...)
+	_, err = BuildIndex(filepath.Dir(path))
+	require.NoError(t, err)
+
+	stats, err := ComputeStats(baseDir, 30*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, stats.Days, 2)
+	first, second := stats.Days[0], stats.Days[1]
+	assert.Equal(t, "circ", first.Provider)
+	assert.Equal(t, 2, first.Snapshots)
+	assert.Equal(t, 1, first.MinScooters)
+	assert.Equal(t, 2, first.MaxScooters)
+	assert.Equal(t, 1.5, first.MeanScooters)
+	assert.NotZero(t, first.MinSize)
+	assert.Equal(t, 2, second.Snapshots)
+	assert.Equal(t, 3, second.MaxScooters)
+	assert.Equal(t, 1, second.Empty)
+	assert.Equal(t, 4, stats.Snapshots())
+	assert.Equal(t, first.Size+second.Size, stats.Size())
+
+	assert.Equal(t, []IntervalCount{{Interval: time.Minute, Count: 2}, {Interval: time.Hour, Count: 1}}, stats.Intervals)
+	assert.Equal(t, time.Minute, stats.IntervalPercentile(50))
+	assert.Equal(t, time.Hour, stats.IntervalPercentile(100))
+	require.Len(t, stats.Gaps, 1)
+	assert.True(t, stats.Gaps[0].From.Equal(start.Add(2*time.Minute)))
+	assert.Equal(t, time.Hour, stats.Gaps[0].Duration())
+}
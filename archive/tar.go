@@ -0,0 +1,316 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TarSuffix is the suffix of the tar file a day folder is packed into by RepackDay
+const TarSuffix = ".tar"
+
+// DayTarPath returns the path of the tar file the day folder is packed into
+func DayTarPath(dayFolder string) string {
+	return filepath.Clean(dayFolder) + TarSuffix
+}
+
+// Packed returns true if the day folder was packed into a tar file by RepackDay. The files of a packed day
+// keep their paths within the day folder for all readers of this package. A scraper still writing to the day
+// recreates the folder, its files are read together with the files of the tar.
+func Packed(dayFolder string) bool {
+	info, err := os.Stat(DayTarPath(dayFolder))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// DayModTime returns the last time files were added to or removed from a day, which is the modification time
+// of the day folder or of the tar file of a packed day, whichever is newer
+func DayModTime(dayFolder string) (time.Time, error) {
+	folderInfo, folderErr := os.Stat(dayFolder)
+	tarInfo, tarErr := os.Stat(DayTarPath(dayFolder))
+	switch {
+	case folderErr == nil && tarErr == nil && tarInfo.ModTime().After(folderInfo.ModTime()):
+		return tarInfo.ModTime(), nil
+	case folderErr == nil:
+		return folderInfo.ModTime(), nil
+	case tarErr == nil:
+		return tarInfo.ModTime(), nil
+	}
+	return time.Time{}, folderErr
+}
+
+// OpenFile opens the gzipped scrape file at path. Files of packed days are read from the mapped tar file of
+// their day.
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err == nil {
+		return f, nil
+	}
+	dayFolder := filepath.Dir(path)
+	if !os.IsNotExist(err) || !Packed(dayFolder) {
+		return nil, err
+	}
+	dayTar, release, err := dayTars.acquire(DayTarPath(dayFolder))
+	if err != nil {
+		return nil, err
+	}
+	data, err := dayTar.Member(filepath.Base(path))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &tarMember{Reader: bytes.NewReader(data), release: release}, nil
+}
+
+// fileSize returns the compressed size of the scrape file at path, which may be the member of a packed day
+func fileSize(path string) (int64, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if member, ok := f.(*tarMember); ok {
+		return member.Size(), nil
+	}
+	info, err := f.(*os.File).Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// packedScrapeFiles returns the sorted paths of the scrape files of a packed day
+func packedScrapeFiles(dayFolder string) ([]string, error) {
+	dayTar, release, err := dayTars.acquire(DayTarPath(dayFolder))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var files []string
+	for _, name := range dayTar.Files() {
+		if fileNameRegex.MatchString(name) {
+			files = append(files, filepath.Join(dayFolder, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// mergeFiles returns the sorted union of two sorted lists of paths
+func mergeFiles(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	merged = append(append(merged, a...), b...)
+	sort.Strings(merged)
+	unique := merged[:0]
+	for i, file := range merged {
+		if i == 0 || file != merged[i-1] {
+			unique = append(unique, file)
+		}
+	}
+	return unique
+}
+
+// tarMember is a member of a mapped tar file, it keeps the mapping alive until it is closed
+type tarMember struct {
+	*bytes.Reader
+	release func()
+	once    sync.Once
+}
+
+func (m *tarMember) Close() error {
+	m.once.Do(m.release)
+	return nil
+}
+
+// maxMappedTars is the number of day tars which stay mapped after they were read
+const maxMappedTars = 4
+
+// dayTars keeps recently read day tars mapped, so reading the files of a packed day one by one indexes
+// its tar only once
+var dayTars = &tarCache{tars: make(map[string]*cachedTar)}
+
+type cachedTar struct {
+	dayTar  *DayTar
+	modTime time.Time
+	size    int64
+	refs    int
+	used    uint64
+	// stale tars were replaced on disk, they are unmapped as soon as they aren't read anymore
+	stale bool
+}
+
+// tarCache maps day tars on demand and unmaps the least recently used ones which aren't read anymore
+type tarCache struct {
+	lock  sync.Mutex
+	tars  map[string]*cachedTar
+	clock uint64
+}
+
+// acquire returns the mapped day tar at path. It stays mapped until release is called. Tars which were
+// replaced on disk since they were mapped, i.e. because RepackDay merged new files into them, are mapped again.
+func (c *tarCache) acquire(path string) (dayTar *DayTar, release func(), err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, exists := c.tars[path]
+	if exists && (!cached.modTime.Equal(info.ModTime()) || cached.size != info.Size()) {
+		c.invalidate(path)
+		exists = false
+	}
+	if !exists {
+		dayTar, err := OpenDayTar(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		cached = &cachedTar{dayTar: dayTar, modTime: info.ModTime(), size: info.Size()}
+		c.tars[path] = cached
+	}
+	cached.refs++
+	c.evict()
+	return cached.dayTar, func() { c.release(cached) }, nil
+}
+
+func (c *tarCache) release(cached *cachedTar) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached.refs--
+	c.clock++
+	cached.used = c.clock
+	if cached.stale && cached.refs == 0 {
+		cached.dayTar.Close()
+	}
+	c.evict()
+}
+
+// invalidate removes the tar at path from the cache, it is unmapped once it isn't read anymore.
+// The lock must be held.
+func (c *tarCache) invalidate(path string) {
+	cached, exists := c.tars[path]
+	if !exists {
+		return
+	}
+	delete(c.tars, path)
+	cached.stale = true
+	if cached.refs == 0 {
+		cached.dayTar.Close()
+	}
+}
+
+// forget removes the tar at path from the cache after it was replaced
+func (c *tarCache) forget(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.invalidate(path)
+}
+
+// evict unmaps unused tars until at most maxMappedTars are mapped, tars which are read stay mapped
+func (c *tarCache) evict() {
+	for len(c.tars) > maxMappedTars {
+		var oldestPath string
+		var oldest *cachedTar
+		for path, cached := range c.tars {
+			if cached.refs == 0 && (oldest == nil || cached.used < oldest.used) {
+				oldestPath, oldest = path, cached
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		oldest.dayTar.Close()
+		delete(c.tars, oldestPath)
+	}
+}
+
+// DayTar reads the scrape files of a day repacked by RepackDay. The tar file is mapped into memory and its
+// members are decompressed straight from the mapping, so repeated scans neither issue read syscalls nor copy
+// the compressed data.
+type DayTar struct {
+	Path string
+
+	mapped  *MappedFile
+	names   []string
+	members map[string][]byte
+}
+
+// OpenDayTar maps the tar file at path and indexes its members. Close it after use.
+func OpenDayTar(path string) (*DayTar, error) {
+	mapped, err := MapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &DayTar{
+		Path:    path,
+		mapped:  mapped,
+		members: make(map[string][]byte),
+	}
+	r := bytes.NewReader(mapped.Data)
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			mapped.Close()
+			return nil, fmt.Errorf("Invalid day tar %s: %s", path, err)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		// The tar reader stops right at the beginning of the member's content
+		offset := r.Size() - int64(r.Len())
+		if offset+header.Size > int64(len(mapped.Data)) {
+			mapped.Close()
+			return nil, fmt.Errorf("Invalid day tar %s: %s is truncated", path, header.Name)
+		}
+		if _, exists := d.members[header.Name]; !exists {
+			d.names = append(d.names, header.Name)
+		}
+		d.members[header.Name] = mapped.Data[offset : offset+header.Size]
+	}
+	return d, nil
+}
+
+// Files returns the names of the members in the order of the tar file
+func (d *DayTar) Files() []string {
+	return d.names
+}
+
+// Member returns the gzipped content of the member with the given name. It is only valid until the DayTar
+// is closed.
+func (d *DayTar) Member(name string) ([]byte, error) {
+	data, exists := d.members[name]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: d.Path + "/" + name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+// Decode decompresses the member with the given name while decoding it as Decode does and returns its format.
+// The records passed to fn don't reference the mapping.
+func (d *DayTar) Decode(name string, fn func(record json.RawMessage) error) (Format, error) {
+	data, err := d.Member(name)
+	if err != nil {
+		return "", err
+	}
+	gzipReader, err := NewGzipReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer gzipReader.Close()
+	return decode(gzipReader, fn)
+}
+
+// Close releases the mapping of the tar file
+func (d *DayTar) Close() error {
+	d.members = nil
+	return d.mapped.Close()
+}
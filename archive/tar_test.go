@@ -0,0 +1,230 @@
+package archive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDayTar(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	path := writeScrapeFile(t, baseDir, date, record{ID: "a"}, record{ID: "b"})
+	writeScrapeFile(t, baseDir, date.Add(time.Minute), record{ID: "c"})
+	tarPath, err := RepackDay(filepath.Dir(path))
+	require.NoError(t, err)
+
+	dayTar, err := OpenDayTar(tarPath)
+	require.NoError(t, err)
+	defer dayTar.Close()
+	require.Equal(t, []string{FileName("circ", date), FileName("circ", date.Add(time.Minute))}, dayTar.Files())
+
+	var ids []string
+	format, err := dayTar.Decode(FileName("circ", date), func(raw json.RawMessage) error {
+		var r record
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+		ids = append(ids, r.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	_, err = dayTar.Member("missing.json.gz")
+	assert.True(t, os.IsNotExist(err))
+
+	// Tar files cut off within a member are rejected
+	data, err := ioutil.ReadFile(tarPath)
+	require.NoError(t, err)
+	truncatedPath := filepath.Join(baseDir, "truncated.tar")
+	require.NoError(t, ioutil.WriteFile(truncatedPath, data[:520], 0660))
+	_, err = OpenDayTar(truncatedPath)
+	assert.Error(t, err)
+}
+
+func TestReadPackedDay(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	first := writeScrapeFile(t, baseDir, date, record{ID: "a"}, record{ID: "b"})
+	second := writeScrapeFile(t, baseDir, date.Add(time.Minute), record{ID: "c"})
+	nextDay := writeScrapeFile(t, baseDir, date.Add(24*time.Hour), record{ID: "d"})
+	dayFolder := filepath.Dir(first)
+	_, err = RepackDay(dayFolder)
+	require.NoError(t, err)
+	assert.True(t, Packed(dayFolder))
+	assert.False(t, Packed(filepath.Dir(nextDay)))
+
+	folders, err := DayFolders(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dayFolder, filepath.Dir(nextDay)}, folders)
+	files, err := ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, files)
+	files, err = FilesInRange(baseDir, date, date.Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second, nextDay}, files)
+
+	var ids []string
+	for _, file := range files {
+		_, err := DecodeFile(file, func(raw json.RawMessage) error {
+			var r record
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return err
+			}
+			ids = append(ids, r.ID)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+	_, err = OpenFile(filepath.Join(dayFolder, FileName("circ", date.Add(time.Hour))))
+	assert.True(t, os.IsNotExist(err))
+
+	// Packed days are neither checked nor packed again by Repair, the newest day may still be written to
+	newest := writeScrapeFile(t, baseDir, date.Add(48*time.Hour), record{ID: "e"})
+	report, err := Repair(baseDir, RepairOptions{Repack: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, []string{filepath.Dir(nextDay) + TarSuffix}, report.Repacked)
+	assert.False(t, Packed(filepath.Dir(newest)))
+}
+
+func TestRepackWrittenDay(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	first := writeScrapeFile(t, baseDir, date, record{ID: "a"})
+	dayFolder := filepath.Dir(first)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dayFolder, IndexFileName), nil, 0660))
+	_, err = RepackDay(dayFolder)
+	require.NoError(t, err)
+	_, err = os.Stat(dayFolder)
+	assert.True(t, os.IsNotExist(err))
+	files, err := ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, files)
+
+	// A scraper still writing to the day recreates its folder, the files of the tar are still read
+	second := writeScrapeFile(t, baseDir, date.Add(time.Minute), record{ID: "b"})
+	_, err = BuildIndex(dayFolder)
+	require.NoError(t, err)
+	assert.True(t, Packed(dayFolder))
+	files, err = ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, files)
+	entries, err := DayFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	readIDs := func() []string {
+		var ids []string
+		for _, file := range files {
+			_, err := DecodeFile(file, func(raw json.RawMessage) error {
+				var r record
+				if err := json.Unmarshal(raw, &r); err != nil {
+					return err
+				}
+				ids = append(ids, r.ID)
+				return nil
+			})
+			require.NoError(t, err)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"a", "b"}, readIDs())
+	report := &VerifyReport{}
+	require.NoError(t, VerifyDay(dayFolder, report))
+	assert.False(t, report.Failed())
+	assert.Equal(t, 1, report.Checked)
+
+	// Packing the day again merges the new files into the tar
+	_, err = RepackDay(dayFolder)
+	require.NoError(t, err)
+	_, err = os.Stat(dayFolder)
+	assert.True(t, os.IsNotExist(err))
+	dayTar, err := OpenDayTar(DayTarPath(dayFolder))
+	require.NoError(t, err)
+	defer dayTar.Close()
+	assert.Equal(t, []string{filepath.Base(first), filepath.Base(second)}, dayTar.Files())
+	files, err = ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, files)
+	assert.Equal(t, []string{"a", "b"}, readIDs())
+
+	// Files which aren't packed keep the folder
+	third := writeScrapeFile(t, baseDir, date.Add(2*time.Minute), record{ID: "c"})
+	require.NoError(t, ioutil.WriteFile(third+".tmp", nil, 0660))
+	_, err = RepackDay(dayFolder)
+	require.NoError(t, err)
+	_, err = os.Stat(third + ".tmp")
+	assert.NoError(t, err)
+	files, err = ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second, third}, files)
+}
+
+func TestTarCacheEvictsUnusedTars(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	cache := &tarCache{tars: make(map[string]*cachedTar)}
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	var releases []func()
+	for day := 0; day < maxMappedTars+2; day++ {
+		path := writeScrapeFile(t, baseDir, date.AddDate(0, 0, day), record{ID: "a"})
+		tarPath, err := RepackDay(filepath.Dir(path))
+		require.NoError(t, err)
+		_, release, err := cache.acquire(tarPath)
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	// Tars which are read stay mapped
+	assert.Len(t, cache.tars, maxMappedTars+2)
+	for _, release := range releases {
+		release()
+	}
+	assert.Len(t, cache.tars, maxMappedTars)
+	_, exists := cache.tars[DayTarPath(filepath.Join(baseDir, FolderName("circ", date)))]
+	assert.False(t, exists)
+}
+
+func TestMapFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "mapped")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("mapped content")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	mapped, err := MapFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "mapped content", string(mapped.Data))
+	require.NoError(t, mapped.Close())
+	assert.Nil(t, mapped.Data)
+	require.NoError(t, mapped.Close())
+
+	empty, err := ioutil.TempFile("", "mapped")
+	require.NoError(t, err)
+	defer os.Remove(empty.Name())
+	empty.Close()
+	mapped, err = MapFile(empty.Name())
+	require.NoError(t, err)
+	assert.Empty(t, mapped.Data)
+	assert.NoError(t, mapped.Close())
+}
@@ -0,0 +1,138 @@
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reader decodes the Avro binary encoding for the tests
+type reader struct {
+	data []byte
+}
+
+func (r *reader) long() int64 {
+	var u uint64
+	for shift := uint(0); ; shift += 7 {
+		b := r.data[0]
+		r.data = r.data[1:]
+		u |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *reader) double() float64 {
+	f := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return f
+}
+
+func (r *reader) string() string {
+	n := r.long()
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func TestSchemasAreValidJSON(t *testing.T) {
+	for _, schema := range []string{ScooterSchema, ScrapeResultSchema, TripSchema} {
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(schema), &v))
+	}
+}
+
+func TestLongEncoding(t *testing.T) {
+	for value, expected := range map[int64][]byte{0: {0}, -1: {1}, 1: {2}, 64: {0x80, 1}, -65: {0x81, 1}} {
+		var b buffer
+		b.long(value)
+		assert.Equal(t, expected, []byte(b))
+	}
+}
+
+func TestMarshalTrip(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	r := &reader{MarshalTrip(&sharealyzer.Trip{
+		ID:            "trip-1",
+		ScooterID:     "scooter-1",
+		StartLocation: sharealyzer.NewGeoLocation(51.5, 7.4),
+		Duration:      90 * time.Second,
+		Cost:          215,
+		StartTime:     start,
+		Distance:      1.5,
+		Type:          sharealyzer.CHARGING_TRIP,
+	})}
+
+	assert.Equal(t, "trip-1", r.string())
+	assert.Equal(t, "scooter-1", r.string())
+	assert.Equal(t, "", r.string())
+	assert.Equal(t, 0.0, r.double())
+	assert.Equal(t, 0.0, r.double())
+	assert.Equal(t, int64(1), r.long())
+	assert.Equal(t, 51.5, r.double())
+	assert.Equal(t, 7.4, r.double())
+	assert.Equal(t, int64(0), r.long(), "end location is null")
+	assert.Equal(t, "", r.string())
+	assert.Equal(t, int64(90000), r.long())
+	assert.Equal(t, int64(215), r.long())
+	assert.Equal(t, int64(1), r.long())
+	assert.Equal(t, start.Unix()*1000, r.long())
+	assert.Equal(t, int64(0), r.long(), "end time is null")
+	assert.Equal(t, 1.5, r.double())
+	assert.Equal(t, int64(2), r.long())
+	assert.Empty(t, r.data)
+}
+
+func TestTripTypeSymbols(t *testing.T) {
+	var schema struct {
+		Fields []struct {
+			Name string
+			Type json.RawMessage
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(TripSchema), &schema))
+	var enum struct {
+		Symbols []string
+	}
+	typeField := schema.Fields[len(schema.Fields)-1]
+	require.Equal(t, "type", typeField.Name)
+	require.NoError(t, json.Unmarshal(typeField.Type, &enum))
+
+	for _, tripType := range []sharealyzer.TripType{sharealyzer.CUSTOMER_TRIP, sharealyzer.CHARGING_TRIP,
+		sharealyzer.RELOCATION_TRIP, sharealyzer.BATTERY_SWAP_TRIP, sharealyzer.OPEN_TRIP, sharealyzer.LOST_TRIP, sharealyzer.RESERVATION} {
+		data := MarshalTrip(&sharealyzer.Trip{Type: tripType})
+		// The type is the last field of a trip
+		r := &reader{data[len(data)-1:]}
+		index := r.long()
+		require.True(t, int(index) < len(enum.Symbols), "%s is missing in the schema", tripType)
+		assert.Equal(t, string(tripType), enum.Symbols[index])
+	}
+}
+
+func TestMarshalScrapeResult(t *testing.T) {
+	date := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	scooter := &sharealyzer.Scooter{ID: "a", Provider: "circ", State: sharealyzer.InUse}
+	r := &reader{MarshalScrapeResult(sharealyzer.NewScrapeResult("circ", date, []*sharealyzer.Scooter{scooter, scooter}))}
+
+	assert.Equal(t, "circ", r.string())
+	assert.Equal(t, date.Unix()*1000, r.long())
+	require.Equal(t, int64(2), r.long())
+	encoded := MarshalScooter(scooter)
+	assert.Equal(t, append(append([]byte{}, encoded...), encoded...), r.data[:2*len(encoded)])
+	assert.Equal(t, []byte{0}, r.data[2*len(encoded):])
+
+	empty := MarshalScrapeResult(sharealyzer.NewScrapeResult("circ", date, nil))
+	assert.Equal(t, byte(0), empty[len(empty)-1])
+
+	// The state follows the empty id and provider, MISSING is the fifth symbol
+	missing := MarshalScooter(&sharealyzer.Scooter{State: sharealyzer.Missing})
+	assert.Equal(t, byte(4<<1), missing[2])
+}
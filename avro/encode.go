@@ -0,0 +1,134 @@
+package avro
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+var (
+	scooterStates = []sharealyzer.ScooterState{"", sharealyzer.IdleRentable, sharealyzer.Broken, sharealyzer.InUse,
+		sharealyzer.Missing}
+	tripTypes = []sharealyzer.TripType{"", sharealyzer.CUSTOMER_TRIP, sharealyzer.CHARGING_TRIP, sharealyzer.RELOCATION_TRIP,
+		sharealyzer.BATTERY_SWAP_TRIP, sharealyzer.OPEN_TRIP, sharealyzer.LOST_TRIP, sharealyzer.RESERVATION}
+)
+
+// buffer appends values in the Avro binary encoding
+type buffer []byte
+
+// long appends a zigzag encoded variable length integer, which is also used for int, enums and lengths
+func (b *buffer) long(v int64) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for u >= 0x80 {
+		*b = append(*b, byte(u)|0x80)
+		u >>= 7
+	}
+	*b = append(*b, byte(u))
+}
+
+func (b *buffer) double(f float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	*b = append(*b, buf[:]...)
+}
+
+func (b *buffer) string(s string) {
+	b.long(int64(len(s)))
+	*b = append(*b, s...)
+}
+
+// timestamp appends t as timestamp-millis
+func (b *buffer) timestamp(t time.Time) {
+	b.long(t.UnixNano() / int64(time.Millisecond))
+}
+
+// nullableTimestamp appends the union index followed by the timestamp, the zero time is encoded as null
+func (b *buffer) nullableTimestamp(t time.Time) {
+	if t.IsZero() {
+		b.long(0)
+		return
+	}
+	b.long(1)
+	b.timestamp(t)
+}
+
+func (b *buffer) location(loc *sharealyzer.GeoLocation) {
+	if loc == nil {
+		b.long(0)
+		return
+	}
+	b.long(1)
+	b.double(loc.Latitude)
+	b.double(loc.Longitude)
+}
+
+func (b *buffer) scooter(s *sharealyzer.Scooter) {
+	b.string(s.ID)
+	b.string(s.Provider)
+	state := 0
+	for i, st := range scooterStates {
+		if st == s.State {
+			state = i
+		}
+	}
+	b.long(int64(state))
+	b.location(s.Location)
+	b.double(s.ChargeLevel)
+	b.nullableTimestamp(s.LastUpdate)
+	b.string(s.QRContent)
+	b.string(s.StateUpdatedByUserID)
+	b.nullableTimestamp(s.StateUpdatedAt)
+	b.long(int64(s.InitPrice))
+	b.long(int64(s.UnitPrice))
+}
+
+// MarshalScooter encodes the scooter with ScooterSchema
+func MarshalScooter(s *sharealyzer.Scooter) []byte {
+	var b buffer
+	b.scooter(s)
+	return b
+}
+
+// MarshalScrapeResult encodes the scrape with ScrapeResultSchema
+func MarshalScrapeResult(res sharealyzer.ScrapeResult) []byte {
+	var b buffer
+	b.string(res.Provider())
+	b.timestamp(res.ScrapeDate())
+	scooters := res.Scooters()
+	if len(scooters) > 0 {
+		b.long(int64(len(scooters)))
+		for _, s := range scooters {
+			b.scooter(s)
+		}
+	}
+	b.long(0)
+	return b
+}
+
+// MarshalTrip encodes the trip with TripSchema
+func MarshalTrip(t *sharealyzer.Trip) []byte {
+	var b buffer
+	b.string(t.ID)
+	b.string(t.ScooterID)
+	b.string(t.ScooterProvider)
+	b.double(t.StartChargeLevel)
+	b.double(t.EndChargeLevel)
+	b.location(t.StartLocation)
+	b.location(t.EndLocation)
+	b.string(t.UserID)
+	b.long(int64(t.Duration / time.Millisecond))
+	b.long(int64(t.Cost))
+	b.nullableTimestamp(t.StartTime)
+	b.nullableTimestamp(t.EndTime)
+	b.double(t.Distance)
+	tripType := 0
+	for i, tt := range tripTypes {
+		if tt == t.Type {
+			tripType = i
+		}
+	}
+	b.long(int64(tripType))
+	return b
+}
@@ -0,0 +1,148 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// magicByte starts every message framed for the schema registry
+const magicByte = 0
+
+// ErrInvalidFrame is returned if a message doesn't start with the schema registry header
+var ErrInvalidFrame = errors.New("Message is not framed for a schema registry")
+
+// RegistryOption lets you specify options for the registry client
+type RegistryOption func(r *Registry)
+
+// WithHTTPClient allows you to specify a custom http client instead of Go's default client
+func WithHTTPClient(client *http.Client) RegistryOption {
+	return func(r *Registry) {
+		r.httpClient = client
+	}
+}
+
+// WithBasicAuth sets the credentials sent to the registry, i.e. an API key and secret
+func WithBasicAuth(username, password string) RegistryOption {
+	return func(r *Registry) {
+		r.username, r.password = username, password
+	}
+}
+
+// Registry is a client to a Confluent compatible schema registry. Registered schema IDs are cached.
+type Registry struct {
+	URL string
+
+	httpClient         *http.Client
+	username, password string
+	lock               sync.Mutex
+	ids                map[string]int
+}
+
+// NewRegistry creates a client for the registry at url
+func NewRegistry(url string, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		URL:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: sharealyzer.DefaultRequestTimeout},
+		ids:        make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register registers the schema under subject and returns its ID. Registering an already known
+// schema returns the existing ID.
+func (r *Registry) Register(subject, schema string) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := subject + "\x00" + schema
+	if id, exists := r.ids[key]; exists {
+		return id, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.URL+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		ID      int    `json:"id"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && resp.StatusCode < 400 {
+		return 0, err
+	}
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("Schema registry returned status %d: %s", resp.StatusCode, result.Message)
+	}
+	r.ids[key] = result.ID
+	return result.ID, nil
+}
+
+// Frame prefixes the payload with the magic byte and the schema ID as expected by registry aware consumers
+func Frame(schemaID int, payload []byte) []byte {
+	msg := make([]byte, 5, 5+len(payload))
+	msg[0] = magicByte
+	binary.BigEndian.PutUint32(msg[1:], uint32(schemaID))
+	return append(msg, payload...)
+}
+
+// ParseFrame returns the schema ID and the payload of a framed message
+func ParseFrame(msg []byte) (int, []byte, error) {
+	if len(msg) < 5 || msg[0] != magicByte {
+		return 0, nil, ErrInvalidFrame
+	}
+	return int(binary.BigEndian.Uint32(msg[1:])), msg[5:], nil
+}
+
+// Serializer encodes values as framed messages for a topic. Schemas are registered under the subject
+// <topic>-value, the default subject naming strategy of Kafka clients.
+type Serializer struct {
+	Registry *Registry
+	Topic    string
+}
+
+func (s *Serializer) frame(schema string, payload []byte) ([]byte, error) {
+	id, err := s.Registry.Register(s.Topic+"-value", schema)
+	if err != nil {
+		return nil, err
+	}
+	return Frame(id, payload), nil
+}
+
+// Scooter encodes the scooter as framed message
+func (s *Serializer) Scooter(scooter *sharealyzer.Scooter) ([]byte, error) {
+	return s.frame(ScooterSchema, MarshalScooter(scooter))
+}
+
+// ScrapeResult encodes the scrape as framed message
+func (s *Serializer) ScrapeResult(res sharealyzer.ScrapeResult) ([]byte, error) {
+	return s.frame(ScrapeResultSchema, MarshalScrapeResult(res))
+}
+
+// Trip encodes the trip as framed message
+func (s *Serializer) Trip(t *sharealyzer.Trip) ([]byte, error) {
+	return s.frame(TripSchema, MarshalTrip(t))
+}
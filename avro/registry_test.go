@@ -0,0 +1,59 @@
+package avro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializer(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/subjects/trips-value/versions", r.URL.Path)
+		username, password, _ := r.BasicAuth()
+		assert.Equal(t, "key", username)
+		assert.Equal(t, "secret", password)
+		var req map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, TripSchema, req["schema"])
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	defer server.Close()
+
+	serializer := &Serializer{Registry: NewRegistry(server.URL, WithBasicAuth("key", "secret")), Topic: "trips"}
+	trip := &sharealyzer.Trip{ID: "trip-1"}
+	for i := 0; i < 2; i++ {
+		msg, err := serializer.Trip(trip)
+		require.NoError(t, err)
+		id, payload, err := ParseFrame(msg)
+		require.NoError(t, err)
+		assert.Equal(t, 42, id)
+		assert.Equal(t, MarshalTrip(trip), payload)
+	}
+	assert.Equal(t, 1, requests, "schema id is cached")
+}
+
+func TestRegistryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error_code": 409, "message": "Schema being registered is incompatible"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewRegistry(server.URL).Register("trips-value", TripSchema)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "incompatible")
+}
+
+func TestParseFrame(t *testing.T) {
+	_, _, err := ParseFrame([]byte{1, 0, 0, 0, 1})
+	assert.Equal(t, ErrInvalidFrame, err)
+	_, _, err = ParseFrame([]byte{0, 0})
+	assert.Equal(t, ErrInvalidFrame, err)
+}
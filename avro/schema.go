@@ -0,0 +1,57 @@
+// Package avro encodes the core sharealyzer types as Avro records and frames them for a Confluent style
+// schema registry, as an alternative payload format for message brokers like Kafka
+package avro
+
+const geoLocationSchema = `{"type": "record", "name": "GeoLocation", "fields": [
+	{"name": "latitude", "type": "double"},
+	{"name": "longitude", "type": "double"}
+]}`
+
+// Times are nullable since the zero time is used for unknown times
+const nullableTimestamp = `["null", {"type": "long", "logicalType": "timestamp-millis"}]`
+
+const scooterSchema = `{"type": "record", "name": "Scooter", "namespace": "sharealyzer", "fields": [
+	{"name": "id", "type": "string"},
+	{"name": "provider", "type": "string"},
+	{"name": "state", "type": {"type": "enum", "name": "ScooterState",
+		"symbols": ["UNKNOWN", "IDLE_RENTABLE", "BROKEN", "IN_USE", "MISSING"], "default": "UNKNOWN"}},
+	{"name": "location", "type": ["null", ` + geoLocationSchema + `], "default": null},
+	{"name": "charge_level", "type": "double"},
+	{"name": "last_update", "type": ` + nullableTimestamp + `, "default": null},
+	{"name": "qr_content", "type": "string"},
+	{"name": "state_updated_by_user_id", "type": "string"},
+	{"name": "state_updated_at", "type": ` + nullableTimestamp + `, "default": null},
+	{"name": "init_price", "type": "long"},
+	{"name": "unit_price", "type": "long"}
+]}`
+
+// ScooterSchema is the Avro schema of a scooter
+const ScooterSchema = scooterSchema
+
+// ScrapeResultSchema is the Avro schema of a scrape with all scooters seen
+const ScrapeResultSchema = `{"type": "record", "name": "ScrapeResult", "namespace": "sharealyzer", "fields": [
+	{"name": "provider", "type": "string"},
+	{"name": "date", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+	{"name": "scooters", "type": {"type": "array", "items": ` + scooterSchema + `}}
+]}`
+
+// TripSchema is the Avro schema of a trip. The duration is given in milliseconds, the cost in euro cents
+// and the distance in kilometers.
+const TripSchema = `{"type": "record", "name": "Trip", "namespace": "sharealyzer", "fields": [
+	{"name": "id", "type": "string"},
+	{"name": "scooter_id", "type": "string"},
+	{"name": "provider", "type": "string"},
+	{"name": "start_charge_level", "type": "double"},
+	{"name": "end_charge_level", "type": "double"},
+	{"name": "start_location", "type": ["null", ` + geoLocationSchema + `], "default": null},
+	{"name": "end_location", "type": ["null", "GeoLocation"], "default": null},
+	{"name": "user_id", "type": "string"},
+	{"name": "duration_ms", "type": "long"},
+	{"name": "cost", "type": "long"},
+	{"name": "start_time", "type": ` + nullableTimestamp + `, "default": null},
+	{"name": "end_time", "type": ` + nullableTimestamp + `, "default": null},
+	{"name": "distance", "type": "double"},
+	{"name": "type", "type": {"type": "enum", "name": "TripType",
+		"symbols": ["UNKNOWN", "CUSTOMER_TRIP", "CHARGING_TRIP", "RELOCATION_TRIP", "BATTERY_SWAP_TRIP",
+			"OPEN_TRIP", "LOST_TRIP", "RESERVATION"], "default": "UNKNOWN"}}
+]}`
@@ -0,0 +1,103 @@
+package sharealyzer
+
+import (
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the number of trips sent as one batch if the consumer doesn't care
+	DefaultBatchSize = 256
+	// DefaultBatchLatency is the time a trip waits at most for its batch to fill up
+	DefaultBatchLatency = time.Second
+)
+
+// tripBatcher collects trips into batches. A batch is sent once it holds size trips or its first trip
+// waited for maxLatency, a maxLatency of 0 only sends full batches and the remainder when flushed.
+type tripBatcher struct {
+	out        chan []*Trip
+	size       int
+	maxLatency time.Duration
+
+	batch []*Trip
+	timer *time.Timer
+}
+
+func newTripBatcher(size int, maxLatency time.Duration) *tripBatcher {
+	if size < 1 {
+		size = 1
+	}
+	return &tripBatcher{
+		out:        make(chan []*Trip, 10),
+		size:       size,
+		maxLatency: maxLatency,
+	}
+}
+
+func (b *tripBatcher) add(trip *Trip) {
+	if len(b.batch) == 0 {
+		b.batch = make([]*Trip, 0, b.size)
+		if b.maxLatency > 0 {
+			b.timer = time.NewTimer(b.maxLatency)
+		}
+	}
+	b.batch = append(b.batch, trip)
+	if len(b.batch) >= b.size {
+		b.flush()
+	}
+}
+
+// expired fires when the current batch waited long enough, it never fires without a pending batch
+func (b *tripBatcher) expired() <-chan time.Time {
+	if b.timer == nil {
+		return nil
+	}
+	return b.timer.C
+}
+
+func (b *tripBatcher) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.batch) == 0 {
+		return
+	}
+	b.out <- b.batch
+	b.batch = nil
+}
+
+// BatchTrips collects the trips from in into batches of up to size trips. A batch is sent early if its first
+// trip waited for maxLatency, so slow producers don't hold back trips. A maxLatency of 0 disables this.
+func BatchTrips(in <-chan *Trip, size int, maxLatency time.Duration) <-chan []*Trip {
+	b := newTripBatcher(size, maxLatency)
+	go func() {
+		for {
+			select {
+			case trip, ok := <-in:
+				if !ok {
+					b.flush()
+					close(b.out)
+					return
+				}
+				b.add(trip)
+			case <-b.expired():
+				b.flush()
+			}
+		}
+	}()
+	return b.out
+}
+
+// UnbatchTrips sends the trips of all batches from in one by one
+func UnbatchTrips(in <-chan []*Trip) <-chan *Trip {
+	out := make(chan *Trip, 100)
+	go func() {
+		for batch := range in {
+			for _, trip := range batch {
+				out <- trip
+			}
+		}
+		close(out)
+	}()
+	return out
+}
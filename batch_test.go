@@ -0,0 +1,69 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchTrips(t *testing.T) {
+	in := make(chan *Trip)
+	batches := BatchTrips(in, 2, 20*time.Millisecond)
+	in <- &Trip{ID: "1"}
+	in <- &Trip{ID: "2"}
+	batch := <-batches
+	require.Len(t, batch, 2)
+	assert.Equal(t, "1", batch[0].ID)
+
+	// A single trip is sent once it waited for the maximum latency
+	in <- &Trip{ID: "3"}
+	select {
+	case batch = <-batches:
+		require.Len(t, batch, 1)
+		assert.Equal(t, "3", batch[0].ID)
+	case <-time.After(time.Second):
+		t.Fatal("Batch wasn't flushed after the maximum latency")
+	}
+
+	in <- &Trip{ID: "4"}
+	close(in)
+	var ids []string
+	for trip := range UnbatchTrips(batches) {
+		ids = append(ids, trip.ID)
+	}
+	assert.Equal(t, []string{"4"}, ids)
+}
+
+func TestAggregateBatches(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40)}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41)}
+	snapshots := [][]*Scooter{{a, b}, {}, {a, b}, {a}, {a, b}, {b}, {a, b}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*time.Minute), snapshot))
+	}
+	expected := aggregateTrips(NewTripAggregator(), results)
+	require.Len(t, expected, 4)
+
+	in := make(chan ScrapeResult, len(results))
+	for _, res := range results {
+		in <- res
+	}
+	close(in)
+	trips := make(map[string]Trip)
+	batchCount := 0
+	for batch := range ClassifyTripBatches(NewTripAggregator().AggregateBatches(in, 3, 0)) {
+		assert.True(t, len(batch) <= 3)
+		for _, trip := range batch {
+			assert.NotEmpty(t, trip.Type)
+			trip.Type = ""
+			trips[trip.ID] = *trip
+		}
+		batchCount++
+	}
+	assert.Equal(t, 2, batchCount)
+	assert.Equal(t, expected, trips)
+}
@@ -0,0 +1,53 @@
+package sharealyzer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/circ/circtest"
+)
+
+// benchmarkSnapshots generates the scrape results of a simulated fleet
+func benchmarkSnapshots(b *testing.B, opts circtest.ArchiveOptions) []sharealyzer.ScrapeResult {
+	var results []sharealyzer.ScrapeResult
+	err := circtest.GenerateFleet(opts, func(date time.Time, scooters []*circ.Scooter) error {
+		res := &circ.ScrapeResult{Date: date}
+		for _, scooter := range scooters {
+			copied := *scooter
+			res.Scooters = append(res.Scooters, &copied)
+		}
+		results = append(results, res.Generic())
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return results
+}
+
+func BenchmarkTripAggregator(b *testing.B) {
+	for name, tripProbability := range map[string]float64{"unchanged": 0, "busy": 0.005} {
+		b.Run(name, func(b *testing.B) {
+			opts := circtest.DefaultArchiveOptions()
+			opts.Files = 240
+			opts.TripProbability = tripProbability
+			results := benchmarkSnapshots(b, opts)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				in := make(chan sharealyzer.ScrapeResult, len(results))
+				for _, res := range results {
+					in <- res
+				}
+				close(in)
+				aggregator := sharealyzer.NewTripAggregator()
+				for batch := range sharealyzer.ClassifyTripBatches(aggregator.AggregateBatches(in, sharealyzer.DefaultBatchSize, 0)) {
+					_ = batch
+				}
+			}
+		})
+	}
+}
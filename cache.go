@@ -0,0 +1,146 @@
+package sharealyzer
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// CachingTransport is a http.RoundTripper which caches responses to GET requests. Cached responses younger
+// than TTL are returned without contacting the server. Older responses are revalidated with conditional
+// requests using ETag and Last-Modified, so unchanged data doesn't need to be transferred again.
+type CachingTransport struct {
+	Transport http.RoundTripper
+	TTL       time.Duration
+	// MaxEntries limits the number of cached responses, the least recently used are evicted first. Zero
+	// means DefaultCacheEntries.
+	MaxEntries int
+	// MaxAge is the time after which unused responses are evicted, i.e. those cached for an expired
+	// Authorization header. Zero means DefaultCacheMaxAge.
+	MaxAge time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+const (
+	// DefaultCacheEntries is the default number of responses a CachingTransport keeps
+	DefaultCacheEntries = 100
+	// DefaultCacheMaxAge is the default time a CachingTransport keeps unused responses
+	DefaultCacheMaxAge = 24 * time.Hour
+)
+
+type cacheEntry struct {
+	response []byte
+	fetched  time.Time
+	used     time.Time
+}
+
+// NewCachingTransport wraps transport, or http.DefaultTransport if it is nil, with a response cache
+func NewCachingTransport(transport http.RoundTripper, ttl time.Duration) *CachingTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &CachingTransport{
+		Transport: transport,
+		TTL:       ttl,
+		entries:   make(map[string]*cacheEntry),
+	}
+}
+
+// cacheKey separates cached responses by credentials, so different users never see each other's responses
+func cacheKey(r *http.Request) string {
+	return r.URL.String() + "\n" + r.Header.Get("Authorization")
+}
+
+// RoundTrip serves the request from the cache if possible
+func (c *CachingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodGet {
+		return c.Transport.RoundTrip(r)
+	}
+	key := cacheKey(r)
+	var response []byte
+	fresh := false
+	c.lock.Lock()
+	entry := c.entries[key]
+	if entry != nil {
+		entry.used = time.Now()
+		response = entry.response
+		fresh = time.Since(entry.fetched) < c.TTL
+	}
+	c.lock.Unlock()
+
+	var cached *http.Response
+	if response != nil {
+		cached, _ = http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), r)
+	}
+	if cached != nil && fresh {
+		return cached, nil
+	}
+
+	if cached != nil {
+		r = r.Clone(r.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			r.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	resp, err := c.Transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		c.lock.Lock()
+		entry.fetched = time.Now()
+		c.lock.Unlock()
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, dump)
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), r)
+}
+
+// store caches a response and evicts expired and, if the cache is full, the least recently used responses
+func (c *CachingTransport) store(key string, response []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+	maxEntries, maxAge := c.MaxEntries, c.MaxAge
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheEntries
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultCacheMaxAge
+	}
+	now := time.Now()
+	c.entries[key] = &cacheEntry{response: response, fetched: now, used: now}
+	for k, entry := range c.entries {
+		if now.Sub(entry.used) > maxAge {
+			delete(c.entries, k)
+		}
+	}
+	for len(c.entries) > maxEntries {
+		var lru string
+		for k, entry := range c.entries {
+			if lru == "" || entry.used.Before(c.entries[lru].used) {
+				lru = k
+			}
+		}
+		delete(c.entries, lru)
+	}
+}
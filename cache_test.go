@@ -0,0 +1,90 @@
+package sharealyzer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingTransport(t *testing.T) {
+	requests := 0
+	revalidations := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("devices"))
+	}))
+	defer server.Close()
+
+	transport := NewCachingTransport(nil, time.Hour)
+	client := &http.Client{Transport: transport}
+	get := func() string {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "devices", get())
+	assert.Equal(t, "devices", get())
+	assert.Equal(t, 1, requests)
+
+	transport.TTL = 0
+	assert.Equal(t, "devices", get())
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, revalidations)
+}
+
+func TestCachingTransportEviction(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	// Usable without the constructor
+	transport := &CachingTransport{Transport: http.DefaultTransport, TTL: time.Hour, MaxEntries: 2}
+	client := &http.Client{Transport: transport}
+	get := func(token string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", token)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "a", get("a"))
+	assert.Equal(t, "b", get("b"))
+	assert.Equal(t, "a", get("a"))
+	assert.Equal(t, 2, requests)
+	// Evicts b, the least recently used
+	assert.Equal(t, "c", get("c"))
+	assert.Len(t, transport.entries, 2)
+	assert.Equal(t, "a", get("a"))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, "b", get("b"))
+	assert.Equal(t, 4, requests)
+
+	// Responses of expired tokens are dropped
+	transport.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	get("d")
+	assert.Len(t, transport.entries, 1)
+}
@@ -0,0 +1,51 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// FileCheckpoint persists the date of the last processed scrape file, so ingestion can be resumed
+// where it stopped
+type FileCheckpoint struct {
+	Path string
+}
+
+type checkpointData struct {
+	LastProcessed time.Time `json:"last_processed"`
+}
+
+// Load returns the date of the last processed scrape file. If no checkpoint exists yet the zero time
+// is returned.
+func (f *FileCheckpoint) Load() (time.Time, error) {
+	checkpointFile, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	defer checkpointFile.Close()
+	var data checkpointData
+	if err := json.NewDecoder(checkpointFile).Decode(&data); err != nil {
+		return time.Time{}, err
+	}
+	return data.LastProcessed, nil
+}
+
+// Save stores the date of the last processed scrape file
+func (f *FileCheckpoint) Save(lastProcessed time.Time) error {
+	tmpPath := f.Path + ".tmp"
+	checkpointFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(checkpointFile).Encode(&checkpointData{LastProcessed: lastProcessed}); err != nil {
+		checkpointFile.Close()
+		return err
+	}
+	if err := checkpointFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, f.Path)
+}
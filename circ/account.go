@@ -0,0 +1,61 @@
+package circ
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	profilePath = `/user/profile`
+	ridesPath   = `/user/rides`
+)
+
+// getJSON requests path with the current tokens and decodes the JSON response into v
+func (c *Client) getJSON(path string, v interface{}) error {
+	if err := c.refreshAuth(); err != nil {
+		return err
+	}
+	r, err := c.request(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hooks.Do(c.httpClient, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := c.checkResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Profile returns the profile of the authenticated account
+func (c *Client) Profile() (*Profile, error) {
+	var profile Profile
+	if err := c.getJSON(profilePath, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Statistics returns the account statistics, i.e. the total distance driven with circ
+func (c *Client) Statistics() ([]Statistic, error) {
+	profile, err := c.Profile()
+	if err != nil {
+		return nil, err
+	}
+	return profile.Statistic, nil
+}
+
+// Rides returns the official ride history of the authenticated account. Compare it with detected trips
+// to check how well trip detection works.
+func (c *Client) Rides() ([]*Ride, error) {
+	ridesResponse := struct {
+		Rides []*Ride `json:"rides"`
+	}{}
+	if err := c.getJSON(ridesPath, &ridesResponse); err != nil {
+		return nil, err
+	}
+	return ridesResponse.Rides, nil
+}
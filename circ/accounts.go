@@ -0,0 +1,125 @@
+package circ
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// AccountKey identifies an account in an AccountTokenStore
+func AccountKey(provider, phonePrefix, phoneNumber string) string {
+	return provider + ":" + phonePrefix + phoneNumber
+}
+
+// AccountTokenStore stores the tokens of multiple accounts in one file. A file written by FileTokenStore
+// is migrated on the first write, its tokens are kept for DefaultAccount.
+type AccountTokenStore struct {
+	Path           string
+	DefaultAccount string
+
+	lock sync.Mutex
+}
+
+type accountFile struct {
+	Accounts map[string]tokenData `json:"accounts"`
+
+	// Tokens of the single account format written by FileTokenStore
+	AccessToken  string `json:",omitempty"`
+	RefreshToken string `json:",omitempty"`
+}
+
+// Account returns a TokenStore for the account with the given key
+func (a *AccountTokenStore) Account(key string) TokenStore {
+	return &accountTokenStore{store: a, key: key}
+}
+
+// Accounts returns the keys of all accounts with stored tokens
+func (a *AccountTokenStore) Accounts() ([]string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	accounts, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(accounts))
+	for key := range accounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// load reads all accounts, the caller needs to hold the lock
+func (a *AccountTokenStore) load() (map[string]tokenData, error) {
+	data, err := ioutil.ReadFile(a.Path)
+	if os.IsNotExist(err) {
+		return make(map[string]tokenData), nil
+	} else if err != nil {
+		return nil, err
+	}
+	var file accountFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Accounts == nil {
+		file.Accounts = make(map[string]tokenData)
+	}
+	if file.AccessToken != "" && a.DefaultAccount != "" {
+		if _, exists := file.Accounts[a.DefaultAccount]; !exists {
+			file.Accounts[a.DefaultAccount] = tokenData{
+				AccessToken:  file.AccessToken,
+				RefreshToken: file.RefreshToken,
+			}
+		}
+	}
+	return file.Accounts, nil
+}
+
+// save writes all accounts, the caller needs to hold the lock
+func (a *AccountTokenStore) save(accounts map[string]tokenData) error {
+	data, err := json.MarshalIndent(accountFile{Accounts: accounts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0700); err != nil {
+		return err
+	}
+	tmpPath := a.Path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, a.Path)
+}
+
+type accountTokenStore struct {
+	store *AccountTokenStore
+	key   string
+}
+
+func (s *accountTokenStore) Store(accessToken, refreshToken string) error {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	accounts, err := s.store.load()
+	if err != nil {
+		return err
+	}
+	accounts[s.key] = tokenData{AccessToken: accessToken, RefreshToken: refreshToken}
+	return s.store.save(accounts)
+}
+
+func (s *accountTokenStore) Load() (string, string, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	accounts, err := s.store.load()
+	if err != nil {
+		return "", "", err
+	}
+	tokens, exists := accounts[s.key]
+	if !exists {
+		return "", "", os.ErrNotExist
+	}
+	return tokens.AccessToken, tokens.RefreshToken, nil
+}
@@ -0,0 +1,38 @@
+package circ
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountTokenStoreMigratesSingleAccountFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accounts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tokens")
+	require.NoError(t, (&FileTokenStore{Path: path}).Store("access", "refresh"))
+
+	primary := AccountKey("circ", "+49", "1701")
+	store := &AccountTokenStore{Path: path, DefaultAccount: primary}
+	accessToken, refreshToken, err := store.Account(primary).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+	assert.Equal(t, "refresh", refreshToken)
+
+	second := AccountKey("circ", "+49", "1702")
+	_, _, err = store.Account(second).Load()
+	assert.Error(t, err)
+	require.NoError(t, store.Account(second).Store("access2", "refresh2"))
+
+	accounts, err := store.Accounts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{primary, second}, accounts)
+	accessToken, _, err = store.Account(primary).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+}
@@ -0,0 +1,326 @@
+package circ
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/pkg/errors"
+)
+
+// ArchiveAggregator reads the circ scrape files of an archive in order for aggregations which need the raw
+// circ scooters. Unlike ReadArchive it walks calendar days, records missing days and can reuse the
+// scooters of previous files to avoid allocations.
+type ArchiveAggregator struct {
+	baseDir string
+	// Workers is the number of day folders which are read concurrently
+	Workers int
+	// Cache is used to read day folders if it is set
+	Cache *DayCache
+	// Reuse allows to reuse the scooters passed to aggr once aggr returned for the following file. aggr
+	// may keep the scooters of the previous file, but not older ones.
+	Reuse bool
+	// Location is the time zone the day folders are named in, defaults to the location of the start time
+	Location *time.Location
+
+	interner     *Interner
+	pool         ScooterPool
+	skippedFiles map[string]bool
+	missingDays  map[string]bool
+}
+
+// NewArchiveAggregator creates an aggregator of the archive in baseDir
+func NewArchiveAggregator(baseDir string) *ArchiveAggregator {
+	return &ArchiveAggregator{
+		baseDir:      baseDir,
+		Workers:      runtime.NumCPU(),
+		interner:     NewInterner(),
+		skippedFiles: make(map[string]bool),
+		missingDays:  make(map[string]bool),
+	}
+}
+
+// listDayFiles returns the files of the day folder of date relative to baseDir, using the index of the
+// folder if it is fresh. A missing folder has no files, unless the day was packed into a tar file.
+func (c *ArchiveAggregator) listDayFiles(date time.Time) (circFiles []string, err error) {
+	dayFolderName := archive.FolderName("circ", date)
+	dayFolder := filepath.Join(c.baseDir, dayFolderName)
+	if _, err := os.Stat(dayFolder); os.IsNotExist(err) && !archive.Packed(dayFolder) {
+		return nil, nil
+	}
+	entries, err := archive.DayFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		circFiles = append(circFiles, filepath.Join(dayFolderName, entry.File))
+	}
+	return
+}
+
+// walk lists the day folders of every calendar day in Location from the day of from on and calls day with
+// the files of every folder until a file at or after to is reached. Folders are named after the local day of
+// the scraping host, so the folder of the day before is looked into for files at or after from as well. Days without files within the range
+// are recorded as missing instead of stopping the walk, the folder after the last day is only looked into
+// for the first file at or after to. archive.ErrNoScrapeFiles is returned if no day has any files. Only
+// file names are looked at, so walking is cheap compared to reading the files.
+func (c *ArchiveAggregator) walk(from, to time.Time, day func(files []string) bool) error {
+	loc := c.Location
+	if loc == nil {
+		loc = from.Location()
+	}
+	from, to = from.In(loc), to.In(loc)
+	// Calendar days are stepped with AddDate, so days with daylight saving transitions don't drift
+	firstDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	lastDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	found := false
+	for currDay := firstDay.AddDate(0, 0, -1); !currDay.After(lastDay.AddDate(0, 0, 1)); currDay = currDay.AddDate(0, 0, 1) {
+		files, err := c.listDayFiles(currDay)
+		if err != nil {
+			return err
+		}
+		if currDay.Before(firstDay) {
+			files = filesFrom(files, from)
+		}
+		if len(files) == 0 {
+			if !currDay.Before(firstDay) && !currDay.After(lastDay) {
+				c.missingDay(currDay)
+			}
+			continue
+		}
+		found = true
+		reachedEnd := false
+		for i, file := range files {
+			fileTime, _, err := extractDateFromFilename(filepath.Base(file))
+			if err != nil {
+				// Reported as skipped file when the day is read
+				continue
+			}
+			if !fileTime.Before(to) {
+				files = files[:i+1]
+				reachedEnd = true
+				break
+			}
+		}
+		if !day(files) || reachedEnd {
+			return nil
+		}
+	}
+	if !found {
+		return archive.ErrNoScrapeFiles
+	}
+	return nil
+}
+
+// filesFrom returns the sorted files scraped at or after from
+func filesFrom(files []string, from time.Time) []string {
+	for i, file := range files {
+		if fileTime, _, err := extractDateFromFilename(filepath.Base(file)); err == nil && !fileTime.Before(from) {
+			return files[i:]
+		}
+	}
+	return nil
+}
+
+// missingDay records a day without scrape files
+func (c *ArchiveAggregator) missingDay(day time.Time) {
+	name := day.Format(archive.FolderTimeFormat)
+	if !c.missingDays[name] {
+		log.Printf("[WARNING] No scrape files for %s", name)
+		c.missingDays[name] = true
+	}
+}
+
+// MissingDays returns the sorted days without any scrape files which were walked so far
+func (c *ArchiveAggregator) MissingDays() []string {
+	days := make([]string, 0, len(c.missingDays))
+	for day := range c.missingDays {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// dayFile is a read scrape file, err is a fileError if the file couldn't be read
+type dayFile struct {
+	date     time.Time
+	scooters []*Scooter
+	err      error
+}
+
+// readDay reads the files of a day folder, files from before from are left out
+func (c *ArchiveAggregator) readDay(files []string, from time.Time) []dayFile {
+	var cached *CachedDay
+	if c.Cache != nil && len(files) > 0 {
+		var err error
+		if cached, err = c.Cache.ReadDay(filepath.Join(c.baseDir, filepath.Dir(files[0]))); err != nil {
+			log.Printf("[WARNING] Reading day without cache: %s", err)
+		}
+	}
+	cachedResults := make(map[string]*ScrapeResult)
+	if cached != nil {
+		for i, name := range cached.Files {
+			cachedResults[name] = cached.Results[i]
+		}
+	}
+
+	day := make([]dayFile, 0, len(files))
+	for _, scooterFileName := range files {
+		fileTime, _, err := extractDateFromFilename(filepath.Base(scooterFileName))
+		if err != nil {
+			day = append(day, dayFile{err: fileError{Path: scooterFileName, Err: err}})
+			continue
+		}
+		if fileTime.Before(from) {
+			// Day folders also contain files from before the start time
+			continue
+		}
+		if res, exists := cachedResults[filepath.Base(scooterFileName)]; exists {
+			for _, scooter := range res.Scooters {
+				scooter.Intern(c.interner)
+			}
+			day = append(day, dayFile{date: fileTime, scooters: res.Scooters})
+			continue
+		}
+		if cached != nil {
+			if msg, failed := cached.Failed[filepath.Base(scooterFileName)]; failed {
+				day = append(day, dayFile{err: fileError{Path: scooterFileName, Err: errors.New(msg)}})
+				continue
+			}
+		}
+		scooters, err := c.readScooterFile(filepath.Join(c.baseDir, scooterFileName))
+		if err != nil {
+			c.pool.Put(scooters)
+			scooters = nil
+			err = fileError{Path: scooterFileName, Err: err}
+		}
+		day = append(day, dayFile{date: fileTime, scooters: scooters, err: err})
+	}
+	return day
+}
+
+// readScooterFile reads the scooters of a scrape file into a slice from the pool and interns their strings
+func (c *ArchiveAggregator) readScooterFile(filePath string) ([]*Scooter, error) {
+	scooters := c.pool.Get()
+	_, err := archive.DecodeFile(filePath, func(record json.RawMessage) error {
+		var scooter *Scooter
+		scooters, scooter = AppendScooter(scooters)
+		if err := json.Unmarshal(record, scooter); err != nil {
+			return err
+		}
+		scooter.Intern(c.interner)
+		return nil
+	})
+	if scooters == nil {
+		scooters = []*Scooter{}
+	}
+	return scooters, err
+}
+
+// fileError is returned if a single file couldn't be read. These files are skipped.
+type fileError struct {
+	Path string
+	Err  error
+}
+
+func (f fileError) Error() string {
+	return "Reading " + f.Path + " failed: " + f.Err.Error()
+}
+
+// skipFile records a file which couldn't be read and returns true if err was caused by a single file
+func (c *ArchiveAggregator) skipFile(err error) bool {
+	fErr, ok := err.(fileError)
+	if !ok {
+		return false
+	}
+	if !c.skippedFiles[fErr.Path] {
+		log.Printf("[WARNING] Skipping file: %s", fErr)
+		c.skippedFiles[fErr.Path] = true
+	}
+	return true
+}
+
+// SkippedFiles returns the number of distinct files which were skipped because they couldn't be read
+func (c *ArchiveAggregator) SkippedFiles() int {
+	return len(c.skippedFiles)
+}
+
+// Aggregate calls aggr with every scrape file between from and to in the order of the files. Up to Workers
+// day folders are read concurrently ahead of aggr, while aggr itself is always called sequentially, so
+// the observations of every scooter arrive in order.
+func (c *ArchiveAggregator) Aggregate(from, to time.Time, aggr func(fileDate time.Time, scooters []*Scooter) error) (err error) {
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	// Every read day is delivered through its own channel, which are queued in the order of the days
+	days := make(chan chan []dayFile, workers)
+	readers := make(chan struct{}, workers)
+	stop := make(chan struct{})
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(days)
+		walkErr <- c.walk(from, to, func(files []string) bool {
+			select {
+			case readers <- struct{}{}:
+			case <-stop:
+				return false
+			}
+			day := make(chan []dayFile, 1)
+			days <- day
+			go func() {
+				day <- c.readDay(files, from)
+				<-readers
+			}()
+			return true
+		})
+	}()
+
+	// The scooters of the previous file, which can be reused once aggr returned for the current file
+	var previous []*Scooter
+	for day := range days {
+		for _, file := range <-day {
+			if c.skipFile(file.err) {
+				continue
+			}
+			err = aggr(file.date, file.scooters)
+			if c.Reuse {
+				c.pool.Put(previous)
+				previous = file.scooters
+			}
+			if err != nil {
+				close(stop)
+				// Drain the queue, so the walker can finish
+				for range days {
+				}
+				return err
+			}
+		}
+	}
+	if err = <-walkErr; err != nil {
+		log.Printf("Breaking because of error: %s", err)
+	}
+	return err
+}
+
+// AggregateUniqueScooters returns the identifiers of all scooters seen between from and to
+func (c *ArchiveAggregator) AggregateUniqueScooters(from, to time.Time) ([]string, error) {
+	uniqueIDs := make(map[string]bool)
+	err := c.Aggregate(from, to, func(fileDate time.Time, s []*Scooter) error {
+		for _, scooter := range s {
+			uniqueIDs[scooter.Identifier] = true
+		}
+		return nil
+	})
+
+	scooterIDs := make([]string, 0, len(uniqueIDs))
+	for id := range uniqueIDs {
+		scooterIDs = append(scooterIDs, id)
+	}
+	return scooterIDs, err
+}
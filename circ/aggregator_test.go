@@ -0,0 +1,245 @@
+package circ
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractDateFromFilename(t *testing.T) {
+	fileName := "circ_2019-10-08T05:11:27+01:00.json.gz"
+
+	date, offset, err := extractDateFromFilename(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 8, 4, 11, 27, 0, time.UTC), date)
+	assert.Equal(t, 3600, offset)
+
+	// Files named in UTC are read as well
+	date, offset, err = extractDateFromFilename("circ_2019-10-08T04:11:27Z.json.gz")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 8, 4, 11, 27, 0, time.UTC), date)
+	assert.Equal(t, 0, offset)
+
+	_, _, err = extractDateFromFilename("circ_garbage.json.gz")
+	assert.Error(t, err)
+}
+
+func TestAggregateInOrder(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "aggregator")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.FixedZone("CET", 3600))
+	var dates []time.Time
+	for day := 0; day < 5; day++ {
+		for hour := 0; hour < 3; hour++ {
+			date := start.Add(time.Duration(day)*24*time.Hour + time.Duration(hour)*time.Hour)
+			writeArchiveFile(t, baseDir, date, []*Scooter{{Identifier: date.Format(time.RFC3339)}})
+			dates = append(dates, date)
+		}
+	}
+	// A broken file is skipped
+	brokenPath := filepath.Join(baseDir, "circ_2019-10-07", "circ_2019-10-07T09:30:00+01:00.json.gz")
+	require.NoError(t, ioutil.WriteFile(brokenPath, []byte("broken"), 0660))
+
+	// The first file at or after the end of the range is aggregated as well
+	var expected []string
+	for _, date := range dates[1:12] {
+		expected = append(expected, date.Format(time.RFC3339))
+	}
+	end := dates[10].Add(30 * time.Minute)
+	aggregate := func(aggregator *ArchiveAggregator) {
+		var seen []string
+		err := aggregator.Aggregate(start.Add(time.Hour), end, func(fileDate time.Time, scooters []*Scooter) error {
+			require.Len(t, scooters, 1)
+			assert.Equal(t, time.UTC, fileDate.Location())
+			written, err := time.Parse(time.RFC3339, scooters[0].Identifier)
+			require.NoError(t, err)
+			assert.True(t, fileDate.Equal(written))
+			seen = append(seen, scooters[0].Identifier)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, seen)
+		assert.Equal(t, 1, aggregator.SkippedFiles())
+	}
+
+	aggregator := NewArchiveAggregator(baseDir)
+	aggregator.Workers = 3
+	aggregate(aggregator)
+
+	// The first cached run fills the cache, the second one reads it
+	cachedAggregator := NewArchiveAggregator(baseDir)
+	cachedAggregator.Cache = &DayCache{Dir: filepath.Join(baseDir, "cache")}
+	aggregate(cachedAggregator)
+	_, err = cachedAggregator.Cache.Load(filepath.Join(baseDir, "circ_2019-10-07"))
+	require.NoError(t, err)
+	aggregate(cachedAggregator)
+
+	// The scooters of the previous file stay untouched when reusing scooters
+	reusingAggregator := NewArchiveAggregator(baseDir)
+	reusingAggregator.Reuse = true
+	aggregate(reusingAggregator)
+	var previous *Scooter
+	var previousID string
+	err = reusingAggregator.Aggregate(start.Add(time.Hour), end, func(fileDate time.Time, scooters []*Scooter) error {
+		if previous != nil {
+			assert.Equal(t, previousID, previous.Identifier)
+		}
+		previous, previousID = scooters[0], scooters[0].Identifier
+		return nil
+	})
+	require.NoError(t, err)
+
+	aggrErr := errors.New("aggregation failed")
+	calls := 0
+	err = aggregator.Aggregate(start, dates[len(dates)-1], func(time.Time, []*Scooter) error {
+		calls++
+		return aggrErr
+	})
+	assert.Equal(t, aggrErr, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestAggregateCalendarDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data is not available: %s", err)
+	}
+	baseDir, err := ioutil.TempDir("", "aggregator")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	// Daylight saving time ends on the 27th and nothing was scraped on the 28th
+	var dates []time.Time
+	for _, day := range []int{26, 27, 29, 30} {
+		for _, hour := range []int{0, 23} {
+			date := time.Date(2019, 10, day, hour, 30, 0, 0, berlin)
+			writeArchiveFile(t, baseDir, date, []*Scooter{{Identifier: date.Format(time.RFC3339)}})
+			dates = append(dates, date)
+		}
+	}
+
+	aggregator := NewArchiveAggregator(baseDir)
+	aggregator.Location = berlin
+	var seen []time.Time
+	err = aggregator.Aggregate(time.Date(2019, 10, 26, 0, 0, 0, 0, berlin), time.Date(2019, 10, 30, 12, 0, 0, 0, berlin),
+		func(fileDate time.Time, scooters []*Scooter) error {
+			seen = append(seen, fileDate)
+			return nil
+		})
+	require.NoError(t, err)
+	require.Len(t, seen, len(dates))
+	for i := range dates {
+		assert.True(t, dates[i].Equal(seen[i]), "expected %s, got %s", dates[i], seen[i])
+	}
+	assert.Equal(t, []string{"2019-10-28"}, aggregator.MissingDays())
+}
+
+func TestAggregateFilesOfWesternHosts(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "aggregator")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	// A host five hours west of UTC writes files of the UTC day into the folder of its previous day
+	west := time.FixedZone("", -5*60*60)
+	for _, hour := range []int{18, 20, 22} {
+		date := time.Date(2019, 10, 8, hour, 30, 0, 0, west)
+		writeArchiveFile(t, baseDir, date, []*Scooter{{Identifier: date.UTC().Format(time.RFC3339)}})
+	}
+
+	aggregator := NewArchiveAggregator(baseDir)
+	aggregator.Location = time.UTC
+	var seen []string
+	err = aggregator.Aggregate(time.Date(2019, 10, 9, 0, 0, 0, 0, time.UTC), time.Date(2019, 10, 9, 2, 0, 0, 0, time.UTC),
+		func(fileDate time.Time, scooters []*Scooter) error {
+			seen = append(seen, scooters[0].Identifier)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2019-10-09T01:30:00Z", "2019-10-09T03:30:00Z"}, seen)
+}
+
+func TestAggregateEmptyArchive(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "aggregator")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	aggregator := NewArchiveAggregator(baseDir)
+	calls := 0
+	aggr := func(time.Time, []*Scooter) error {
+		calls++
+		return nil
+	}
+	assert.Equal(t, archive.ErrNoScrapeFiles, aggregator.Aggregate(start, start.Add(time.Hour), aggr))
+
+	// A day folder with an index only has no files either
+	dayFolder := filepath.Join(baseDir, "circ_2019-10-06")
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dayFolder, "index.jsonl"), nil, 0660))
+	assert.Equal(t, archive.ErrNoScrapeFiles, aggregator.Aggregate(start, start.Add(time.Hour), aggr))
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, []string{"2019-10-06"}, aggregator.MissingDays())
+}
+
+func TestReadPackedDays(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "aggregator")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	var expected []string
+	for day := 0; day < 2; day++ {
+		for hour := 0; hour < 2; hour++ {
+			date := start.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour)
+			writeArchiveFile(t, baseDir, date, []*Scooter{{Identifier: date.Format(time.RFC3339)}})
+			expected = append(expected, date.Format(time.RFC3339))
+		}
+	}
+	_, err = archive.RepackDay(filepath.Join(baseDir, "circ_2019-10-06"))
+	require.NoError(t, err)
+
+	aggregator := NewArchiveAggregator(baseDir)
+	var seen []string
+	err = aggregator.Aggregate(start, start.AddDate(0, 0, 1).Add(2*time.Hour), func(fileDate time.Time, scooters []*Scooter) error {
+		seen = append(seen, scooters[0].Identifier)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, seen)
+	assert.Empty(t, aggregator.MissingDays())
+
+	// Packed days are cached like day folders
+	cache := &DayCache{Dir: filepath.Join(baseDir, "cache")}
+	_, err = cache.ReadDay(filepath.Join(baseDir, "circ_2019-10-06"))
+	require.NoError(t, err)
+	day, err := cache.Load(filepath.Join(baseDir, "circ_2019-10-06"))
+	require.NoError(t, err)
+	assert.Len(t, day.Results, 2)
+
+	results, _, err := ReadArchive(baseDir, start, start.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	seen = nil
+	for res := range results {
+		seen = append(seen, res.Scooters[0].Identifier)
+	}
+	assert.Equal(t, expected, seen)
+
+	results, err = NewFileScraper(baseDir).Scrape(context.Background(), false)
+	require.NoError(t, err)
+	seen = nil
+	for res := range results {
+		seen = append(seen, res.Scooters[0].Identifier)
+	}
+	assert.Equal(t, expected, seen)
+}
@@ -0,0 +1,72 @@
+package circ
+
+import (
+	"encoding/json"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// AnonymizeScooters replaces all user identifiers of the given scooters with their pseudonyms
+func AnonymizeScooters(scooters []*Scooter, p *sharealyzer.Pseudonymizer) {
+	for _, scooter := range scooters {
+		scooter.StateUpdatedByUserIdentifier = p.Pseudonym(scooter.StateUpdatedByUserIdentifier)
+		scooter.BrokenUpdatedByUserIdentifier = pseudonymPtr(scooter.BrokenUpdatedByUserIdentifier, p)
+		scooter.MissingUpdatedByUserIdentifier = pseudonymPtr(scooter.MissingUpdatedByUserIdentifier, p)
+	}
+}
+
+// userIdentifierFields are the fields of a scooter record which contain user identifiers
+var userIdentifierFields = []string{
+	"stateUpdatedByUserIdentifier",
+	"brokenUpdatedByUserIdentifier",
+	"missingUpdatedByUserIdentifier",
+}
+
+// AnonymizeRecord replaces all user identifiers of the JSON record of a scooter with their pseudonyms.
+// Unlike AnonymizeScooters it keeps fields unknown to Scooter, so anonymized archives don't lose data.
+func AnonymizeRecord(record json.RawMessage, p *sharealyzer.Pseudonymizer) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range userIdentifierFields {
+		value, exists := fields[name]
+		if !exists {
+			continue
+		}
+		var id *string
+		if err := json.Unmarshal(value, &id); err != nil {
+			return nil, err
+		}
+		if id == nil {
+			continue
+		}
+		pseudonym, err := json.Marshal(p.Pseudonym(*id))
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = pseudonym
+	}
+	return json.Marshal(fields)
+}
+
+// Anonymize is a pipeline stage replacing all user identifiers in the ScrapeResults with their pseudonyms
+func Anonymize(in <-chan *ScrapeResult, p *sharealyzer.Pseudonymizer) <-chan *ScrapeResult {
+	out := make(chan *ScrapeResult, 100)
+	go func() {
+		for res := range in {
+			AnonymizeScooters(res.Scooters, p)
+			out <- res
+		}
+		close(out)
+	}()
+	return out
+}
+
+func pseudonymPtr(id *string, p *sharealyzer.Pseudonymizer) *string {
+	if id == nil {
+		return nil
+	}
+	pseudonym := p.Pseudonym(*id)
+	return &pseudonym
+}
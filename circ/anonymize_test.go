@@ -0,0 +1,58 @@
+package circ
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymize(t *testing.T) {
+	p := sharealyzer.NewPseudonymizer([]byte("salt"))
+	broken := "user-2"
+	in := make(chan *ScrapeResult, 1)
+	in <- &ScrapeResult{Date: time.Now(), Scooters: []*Scooter{
+		{Identifier: "a", StateUpdatedByUserIdentifier: "user-1", BrokenUpdatedByUserIdentifier: &broken},
+		{Identifier: "b", StateUpdatedByUserIdentifier: "user-1"},
+	}}
+	close(in)
+	res := <-Anonymize(in, p)
+
+	a, b := res.Scooters[0], res.Scooters[1]
+	assert.Equal(t, p.Pseudonym("user-1"), a.StateUpdatedByUserIdentifier)
+	assert.Equal(t, a.StateUpdatedByUserIdentifier, b.StateUpdatedByUserIdentifier)
+	require.NotNil(t, a.BrokenUpdatedByUserIdentifier)
+	assert.Equal(t, p.Pseudonym("user-2"), *a.BrokenUpdatedByUserIdentifier)
+	assert.NotEqual(t, a.StateUpdatedByUserIdentifier, *a.BrokenUpdatedByUserIdentifier)
+	assert.Nil(t, a.MissingUpdatedByUserIdentifier)
+	assert.Equal(t, "user-2", broken, "the original identifier must not be modified in place")
+
+	data, err := json.Marshal(res.Scooters)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "user-1")
+	assert.NotContains(t, string(data), "user-2")
+}
+
+func TestAnonymizeRecord(t *testing.T) {
+	p := sharealyzer.NewPseudonymizer([]byte("salt"))
+	record := json.RawMessage(`{"identifier":"a","stateUpdatedByUserIdentifier":"user-1",` +
+		`"brokenUpdatedByUserIdentifier":"user-2","missingUpdatedByUserIdentifier":null,"newField":{"x":1}}`)
+	anonymized, err := AnonymizeRecord(record, p)
+	require.NoError(t, err)
+	assert.NotContains(t, string(anonymized), "user-1")
+	assert.NotContains(t, string(anonymized), "user-2")
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(anonymized, &fields))
+	assert.Equal(t, p.Pseudonym("user-1"), fields["stateUpdatedByUserIdentifier"])
+	assert.Equal(t, p.Pseudonym("user-2"), fields["brokenUpdatedByUserIdentifier"])
+	assert.Nil(t, fields["missingUpdatedByUserIdentifier"])
+	// Fields unknown to Scooter are kept
+	assert.Equal(t, map[string]interface{}{"x": float64(1)}, fields["newField"])
+
+	_, err = AnonymizeRecord(json.RawMessage(`{"stateUpdatedByUserIdentifier":42}`), p)
+	assert.Error(t, err)
+}
@@ -8,14 +8,22 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/pkg/errors"
 )
 
 const (
-	loginURL        = `https://node.goflash.com/verification/phone/start`
-	signupURL       = `https://node.goflash.com/signup/phone`
-	tokenRefreshURL = `https://node.goflash.com/login/refresh`
-	devicesURL      = `https://node.goflash.com/devices`
+	// DefaultBaseURL is the base URL of the circ API
+	DefaultBaseURL = `https://node.goflash.com`
+
+	loginPath        = `/verification/phone/start`
+	signupPath       = `/signup/phone`
+	tokenRefreshPath = `/login/refresh`
+	devicesPath      = `/devices`
 )
 
 var (
@@ -43,39 +51,130 @@ func WithHTTPClient(client *http.Client) ClientOption {
 	}
 }
 
+// WithUserAgent sets the User-Agent header sent to the circ API, i.e. to mimic the official app
+func WithUserAgent(userAgent string) ClientOption {
+	return WithHeader("User-Agent", userAgent)
+}
+
+// WithHeader sets an additional header sent with every request, i.e. the app version of the official app
+func WithHeader(name, value string) ClientOption {
+	return func(c *Client) {
+		c.headers.Set(name, value)
+	}
+}
+
+// WithResponseCache caches responses for ttl and revalidates them with conditional requests afterwards.
+// Keep ttl shorter than the scrape interval, otherwise scrapes return stale data.
+func WithResponseCache(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithBaseURL lets the client talk to a different server than the circ API, i.e. a fake server in tests
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithTimeout sets the timeout of a single request, sharealyzer.DefaultRequestTimeout is used by default
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithDecoder sets the decoder of scooters received from the API, i.e. to decode strictly or to share the
+// detected schema drift between several clients
+func WithDecoder(decoder *sharealyzer.RecordDecoder) ClientOption {
+	return func(c *Client) {
+		c.decoder = decoder
+	}
+}
+
 // ClientOption lets you specify options for the client
 type ClientOption func(c *Client)
 
-// Client is a client to the circ API
+// WithRequestHook adds a hook which is called with every request before it is sent
+func WithRequestHook(hook sharealyzer.RequestHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Request = append(c.hooks.Request, hook)
+	}
+}
+
+// WithResponseHook adds a hook which is called with every received response
+func WithResponseHook(hook sharealyzer.ResponseHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Response = append(c.hooks.Response, hook)
+	}
+}
+
+// Client is a client to the circ API. It is safe for concurrent use, so multiple scrapers can share
+// one client and its tokens.
 type Client struct {
 	httpClient *http.Client
+	baseURL    string
+	hooks      sharealyzer.Hooks
+	headers    http.Header
+	cacheTTL   time.Duration
+	timeout    time.Duration
+
+	loginLimiter *LoginLimiter
 
+	tokenLock        sync.Mutex
 	accessToken      string
 	refreshToken     string
+	tokenExpiry      time.Time
 	lastTokenRefresh time.Time
+	refreshing       *refreshCall
 	tokenStore       TokenStore
+
+	decoder *sharealyzer.RecordDecoder
+}
+
+// refreshCall represents a token refresh in progress, which concurrent callers wait for instead of
+// refreshing the tokens again
+type refreshCall struct {
+	done chan struct{}
+	err  error
 }
 
 // New creates a new client for the Circ API with the specified options
 func New(opts ...ClientOption) *Client {
 	c := &Client{
-		httpClient: http.DefaultClient,
+		httpClient: &http.Client{Timeout: sharealyzer.DefaultRequestTimeout},
+		baseURL:    DefaultBaseURL,
+		headers:    make(http.Header),
+		decoder:    NewScooterDecoder(sharealyzer.DecodeLenient),
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.timeout > 0 {
+		timeoutClient := *c.httpClient
+		timeoutClient.Timeout = c.timeout
+		c.httpClient = &timeoutClient
+	}
+	if c.cacheTTL > 0 {
+		cachingClient := *c.httpClient
+		cachingClient.Transport = sharealyzer.NewCachingTransport(c.httpClient.Transport, c.cacheTTL)
+		c.httpClient = &cachingClient
+	}
 
 	if c.tokenStore != nil {
 		accesstoken, refreshtoken, err := c.tokenStore.Load()
 		if err == nil {
-			c.accessToken = accesstoken
-			c.refreshToken = refreshtoken
+			c.setTokens(accesstoken, refreshtoken)
 		}
 	}
 	return c
 }
 
 func (c *Client) checkResponse(resp *http.Response) error {
+	if err := sharealyzer.CheckRateLimit(resp); err != nil {
+		return err
+	}
 	if resp.StatusCode >= 400 {
 		fmt.Printf("Received error from circ API")
 		var circErr CircError
@@ -88,43 +187,103 @@ func (c *Client) checkResponse(resp *http.Response) error {
 	return nil
 }
 
-func (c *Client) request(method string, url string, body io.Reader) (*http.Request, error) {
-	r, err := http.NewRequest(method, url, body)
+func (c *Client) request(method string, path string, body io.Reader) (*http.Request, error) {
+	r, err := http.NewRequest(method, c.baseURL+path, body)
 	if err != nil {
 		return nil, err
 	}
 	r.Header.Set("Content-type", "application/json")
 	r.Header.Set("Accept", "application/json")
+	for name, values := range c.headers {
+		r.Header[name] = values
+	}
 
-	if c.accessToken != "" {
-		r.Header.Set("Authorization", c.accessToken)
+	c.tokenLock.Lock()
+	accessToken := c.accessToken
+	c.tokenLock.Unlock()
+	if accessToken != "" {
+		r.Header.Set("Authorization", accessToken)
 	}
 
 	return r, nil
 }
 
+// setTokens sets the current tokens and determines when the access token expires
+func (c *Client) setTokens(accessToken, refreshToken string) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+	c.accessToken = accessToken
+	c.refreshToken = refreshToken
+	c.tokenExpiry, _ = jwtExpiry(accessToken)
+}
+
+// needsRefresh returns true if the access token expires soon. If the expiry of the token is unknown
+// the token is refreshed every DefaultTokenRefreshDuration. The caller needs to hold tokenLock.
+func (c *Client) needsRefresh() bool {
+	if !c.tokenExpiry.IsZero() {
+		return time.Now().After(c.tokenExpiry.Add(-TokenRefreshMargin))
+	}
+	return !time.Now().Before(c.lastTokenRefresh.Add(DefaultTokenRefreshDuration))
+}
+
+// refreshAuth refreshes the tokens if necessary. If a refresh is already in progress it waits for
+// this refresh and returns its result.
 func (c *Client) refreshAuth() error {
-	if time.Now().Before(c.lastTokenRefresh.Add(DefaultTokenRefreshDuration)) {
+	c.tokenLock.Lock()
+	if !c.needsRefresh() {
+		c.tokenLock.Unlock()
 		return nil
 	}
-	defer func() {
-		c.lastTokenRefresh = time.Now()
-	}()
+	if call := c.refreshing; call != nil {
+		c.tokenLock.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	c.refreshing = call
+	accessToken, refreshToken := c.accessToken, c.refreshToken
+	c.tokenLock.Unlock()
+
+	call.err = c.doRefresh(accessToken, refreshToken)
+
+	c.tokenLock.Lock()
+	c.refreshing = nil
+	c.lastTokenRefresh = time.Now()
+	c.tokenLock.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// doRefresh exchanges the refresh token for new tokens. If the refresh token is missing or expired a
+// CircError with status 401 is returned, so callers know they need to login again.
+func (c *Client) doRefresh(accessToken, refreshToken string) error {
+	if refreshToken == "" {
+		return CircError{
+			Timestamp: time.Now(),
+			Status:    http.StatusUnauthorized,
+			Err:       "Unauthorized",
+			Message:   "No refresh token available",
+			Path:      tokenRefreshPath,
+		}
+	}
 	buf := &bytes.Buffer{}
 	json.NewEncoder(buf).Encode(map[string]string{
-		"accessToken":  c.accessToken,
-		"refreshToken": c.refreshToken,
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
 	})
-	r, err := c.request(http.MethodPost, tokenRefreshURL, buf)
+	r, err := c.request(http.MethodPost, tokenRefreshPath, buf)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.httpClient.Do(r)
+	resp, err := c.hooks.Do(c.httpClient, r)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if err := c.checkResponse(resp); err != nil {
+		return err
+	}
 	body, _ := ioutil.ReadAll(resp.Body)
 	var refreshResponse TokenRefreshResponse
 	if err := json.Unmarshal(body, &refreshResponse); err != nil {
@@ -135,10 +294,9 @@ func (c *Client) refreshAuth() error {
 		}
 		return circErr
 	}
-	c.accessToken = refreshResponse.AccessToken
-	c.refreshToken = refreshResponse.RefreshToken
+	c.setTokens(refreshResponse.AccessToken, refreshResponse.RefreshToken)
 	if c.tokenStore != nil {
-		if err = c.tokenStore.Store(c.accessToken, c.refreshToken); err != nil {
+		if err = c.tokenStore.Store(refreshResponse.AccessToken, refreshResponse.RefreshToken); err != nil {
 			return nil
 		}
 	}
@@ -154,18 +312,30 @@ func (c *Client) ForceTokenRefresh() error {
 // i.e. '+49' and your phone number without the leading zero and a callback function which returns the received
 // auth token.
 func (c *Client) Login(countryCode, phoneNumber string, provideCode func() string) error {
+	return c.LoginWith(countryCode, phoneNumber, CodeProviderFunc(func() (string, error) {
+		return provideCode(), nil
+	}))
+}
+
+// LoginWith works like Login but receives the SMS code from the given CodeProvider
+func (c *Client) LoginWith(countryCode, phoneNumber string, codeProvider CodeProvider) error {
+	if c.loginLimiter != nil {
+		if err := c.loginLimiter.Attempt(); err != nil {
+			return err
+		}
+	}
 	buf := &bytes.Buffer{}
 	json.NewEncoder(buf).Encode(map[string]string{
 		"phoneCountryCode": countryCode,
 		"phoneNumber":      phoneNumber,
 	})
 
-	r, err := c.request(http.MethodPost, loginURL, buf)
+	r, err := c.request(http.MethodPost, loginPath, buf)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.httpClient.Do(r)
+	resp, err := c.hooks.Do(c.httpClient, r)
 	if err != nil {
 		return err
 	}
@@ -173,7 +343,10 @@ func (c *Client) Login(countryCode, phoneNumber string, provideCode func() strin
 	if err := c.checkResponse(resp); err != nil {
 		return err
 	}
-	authCode := provideCode()
+	authCode, err := codeProvider.Code()
+	if err != nil {
+		return errors.Wrap(err, "Failed to receive SMS code")
+	}
 
 	buf.Reset()
 	json.NewEncoder(buf).Encode(map[string]string{
@@ -182,11 +355,11 @@ func (c *Client) Login(countryCode, phoneNumber string, provideCode func() strin
 		"token":            authCode,
 	})
 
-	r, err = c.request(http.MethodPost, signupURL, buf)
+	r, err = c.request(http.MethodPost, signupPath, buf)
 	if err != nil {
 		return err
 	}
-	resp, err = c.httpClient.Do(r)
+	resp, err = c.hooks.Do(c.httpClient, r)
 	if err != nil {
 		return err
 	}
@@ -199,29 +372,76 @@ func (c *Client) Login(countryCode, phoneNumber string, provideCode func() strin
 		return err
 	}
 
-	c.accessToken = authResponse.AccessToken
-	c.refreshToken = authResponse.RefreshToken
+	c.setTokens(authResponse.AccessToken, authResponse.RefreshToken)
 	if c.tokenStore != nil {
-		if err := c.tokenStore.Store(c.accessToken, c.refreshToken); err != nil {
+		if err := c.tokenStore.Store(authResponse.AccessToken, authResponse.RefreshToken); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// MaxTilingDepth limits how often Scooters splits an area into quadrants if the API returns fewer devices
+// than its reported total
+var MaxTilingDepth = 4
+
 // Scooters returns all available scooters at this point in time. You need to specify the area
-// to scrape as a rectangle with a top left and a bottom right corner. It is unknown how large
-// this rectangle can get before things break down
+// to scrape as a rectangle with a top left and a bottom right corner. If the API truncates the
+// result for large areas, the area is split into tiles which are requested separately.
 func (c *Client) Scooters(latitudeTopLeft,
 	longitudeTopLeft, latitudeBottomRight, longitudeBottomRight float64) ([]*Scooter, error) {
 
 	if err := c.refreshAuth(); err != nil {
 		return nil, err
 	}
-	r, err := c.request(http.MethodGet, devicesURL, nil)
+	return c.scootersInTile(latitudeTopLeft, longitudeTopLeft, latitudeBottomRight, longitudeBottomRight, 0)
+}
+
+// scootersInTile requests the scooters in the given area and recursively splits it into four quadrants
+// if the response contains fewer devices than the reported total
+func (c *Client) scootersInTile(latitudeTopLeft,
+	longitudeTopLeft, latitudeBottomRight, longitudeBottomRight float64, depth int) ([]*Scooter, error) {
+
+	devices, total, err := c.devices(latitudeTopLeft, longitudeTopLeft, latitudeBottomRight, longitudeBottomRight)
 	if err != nil {
 		return nil, err
 	}
+	if total <= len(devices) {
+		return devices, nil
+	}
+	if depth >= MaxTilingDepth {
+		log.Printf("[WARNING] Received only %d of %d devices after splitting the area %d times", len(devices), total, depth)
+		return devices, nil
+	}
+
+	latCenter := (latitudeTopLeft + latitudeBottomRight) / 2
+	lonCenter := (longitudeTopLeft + longitudeBottomRight) / 2
+	tiles := [][4]float64{
+		{latitudeTopLeft, longitudeTopLeft, latCenter, lonCenter},
+		{latitudeTopLeft, lonCenter, latCenter, longitudeBottomRight},
+		{latCenter, longitudeTopLeft, latitudeBottomRight, lonCenter},
+		{latCenter, lonCenter, latitudeBottomRight, longitudeBottomRight},
+	}
+	sets := [][]*Scooter{devices}
+	for _, tile := range tiles {
+		tileDevices, err := c.scootersInTile(tile[0], tile[1], tile[2], tile[3], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, tileDevices)
+	}
+	return MergeScooters(sets...), nil
+}
+
+// devices requests the devices in the given area and returns them with the total number of devices
+// reported by the API
+func (c *Client) devices(latitudeTopLeft,
+	longitudeTopLeft, latitudeBottomRight, longitudeBottomRight float64) ([]*Scooter, int, error) {
+
+	r, err := c.request(http.MethodGet, devicesPath, nil)
+	if err != nil {
+		return nil, 0, err
+	}
 	q := r.URL.Query()
 	q.Add("latitudeTopLeft", floatToString(latitudeTopLeft))
 	q.Add("longitudeTopLeft", floatToString(longitudeTopLeft))
@@ -229,24 +449,43 @@ func (c *Client) Scooters(latitudeTopLeft,
 	q.Add("longitudeBottomRight", floatToString(longitudeBottomRight))
 	r.URL.RawQuery = q.Encode()
 
-	resp, err := c.httpClient.Do(r)
+	resp, err := c.hooks.Do(c.httpClient, r)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	if err := c.checkResponse(resp); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	body, _ := ioutil.ReadAll(resp.Body)
+	devices, total, err := decodeDevices(body, c.decoder)
+	if err != nil {
+		if _, drift := sharealyzer.IsSchemaDrift(err); !drift {
+			log.Printf("Unexpected body (code: %d): %s", resp.StatusCode, string(body))
+		}
+		return nil, 0, err
+	}
+	return devices, total, nil
+}
+
+// decodeDevices decodes the body of a devices response
+func decodeDevices(body []byte, decoder *sharealyzer.RecordDecoder) ([]*Scooter, int, error) {
 	devicesResponse := struct {
-		Devices []*Scooter `json:"devices"`
-		Total   int        `json:"total"`
+		Devices []json.RawMessage `json:"devices"`
+		Total   int               `json:"total"`
 	}{}
 	if err := json.Unmarshal(body, &devicesResponse); err != nil {
-		log.Printf("Unexpected body (code: %d): %s", resp.StatusCode, string(body))
-		return nil, err
+		return nil, 0, err
+	}
+	devices := make([]*Scooter, 0, len(devicesResponse.Devices))
+	for _, device := range devicesResponse.Devices {
+		scooter := &Scooter{}
+		if err := decoder.Decode(device, scooter); err != nil {
+			return nil, 0, err
+		}
+		devices = append(devices, scooter)
 	}
-	return devicesResponse.Devices, nil
+	return devices, devicesResponse.Total, nil
 }
 
 func floatToString(in float64) string {
@@ -0,0 +1,154 @@
+package circ
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestConcurrentRefreshAuth(t *testing.T) {
+	var refreshes int32
+	freshToken := testToken(`{"exp":` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `}`)
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&refreshes, 1)
+		time.Sleep(time.Millisecond * 50)
+		rec := httptest.NewRecorder()
+		json.NewEncoder(rec).Encode(TokenRefreshResponse{AccessToken: freshToken, RefreshToken: "refresh"})
+		return rec.Result(), nil
+	})
+
+	c := New(WithHTTPClient(&http.Client{Transport: transport}))
+	c.setTokens(testToken(`{"exp":1}`), "refresh")
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.refreshAuth())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&refreshes))
+	assert.Equal(t, freshToken, c.accessToken)
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Retry-After", "120")
+		rec.WriteHeader(http.StatusTooManyRequests)
+		return rec.Result(), nil
+	})
+	c := New(WithHTTPClient(&http.Client{Transport: transport}))
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`), "refresh")
+
+	_, err := c.Scooters(1, 1, 0, 0)
+	rateErr, ok := sharealyzer.IsRateLimit(err)
+	if assert.True(t, ok) {
+		assert.Equal(t, time.Minute*2, rateErr.RetryAfter)
+	}
+}
+
+func TestRequestAndResponseHooks(t *testing.T) {
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, "trace-id", r.Header.Get("X-Trace-Id"))
+		rec := httptest.NewRecorder()
+		rec.WriteString(`{"devices":[],"total":0}`)
+		return rec.Result(), nil
+	})
+	var statusCodes []int
+	c := New(WithHTTPClient(&http.Client{Transport: transport}),
+		WithRequestHook(func(r *http.Request) {
+			r.Header.Set("X-Trace-Id", "trace-id")
+		}),
+		WithResponseHook(func(resp *http.Response) {
+			statusCodes = append(statusCodes, resp.StatusCode)
+		}))
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`), "refresh")
+
+	_, err := c.Scooters(1, 1, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{http.StatusOK}, statusCodes)
+}
+
+func TestScootersSplitsTruncatedArea(t *testing.T) {
+	fleet := []*Scooter{
+		{Identifier: "a", Latitude: 51.9, Longitude: 7.1},
+		{Identifier: "b", Latitude: 51.8, Longitude: 7.2},
+		{Identifier: "c", Latitude: 51.1, Longitude: 7.9},
+		{Identifier: "d", Latitude: 51.2, Longitude: 7.8},
+		{Identifier: "e", Latitude: 51.3, Longitude: 7.3},
+	}
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		q := r.URL.Query()
+		param := func(name string) float64 {
+			f, _ := strconv.ParseFloat(q.Get(name), 64)
+			return f
+		}
+		var inArea []*Scooter
+		for _, s := range fleet {
+			if s.Latitude <= param("latitudeTopLeft") && s.Latitude >= param("latitudeBottomRight") &&
+				s.Longitude >= param("longitudeTopLeft") && s.Longitude <= param("longitudeBottomRight") {
+				inArea = append(inArea, s)
+			}
+		}
+		devices := inArea
+		if len(devices) > 2 {
+			devices = devices[:2]
+		}
+		rec := httptest.NewRecorder()
+		json.NewEncoder(rec).Encode(map[string]interface{}{"devices": devices, "total": len(inArea)})
+		return rec.Result(), nil
+	})
+	c := New(WithHTTPClient(&http.Client{Transport: transport}))
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`), "refresh")
+
+	scooters, err := c.Scooters(52, 7, 51, 8)
+	assert.NoError(t, err)
+	assert.Len(t, scooters, len(fleet))
+}
+
+func TestScootersDetectsSchemaDrift(t *testing.T) {
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.WriteString(`{"devices":[{"identifier":"a","lat":51.5,"longitude":7.4,"energyLevel":80}],"total":1}`)
+		return rec.Result(), nil
+	})
+	token := testToken(`{"exp":` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `}`)
+
+	lenient := NewScooterDecoder(sharealyzer.DecodeLenient)
+	c := New(WithHTTPClient(&http.Client{Transport: transport}), WithDecoder(lenient))
+	c.setTokens(token, "refresh")
+	scooters, err := c.Scooters(1, 1, 0, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, scooters, 1) {
+		assert.Equal(t, "a", scooters[0].Identifier)
+	}
+	drift := lenient.Drift()
+	assert.Equal(t, map[string]int{"lat": 1}, drift.Unknown)
+	assert.Equal(t, map[string]int{"latitude": 1}, drift.Missing)
+
+	c = New(WithHTTPClient(&http.Client{Transport: transport}), WithDecoder(NewScooterDecoder(sharealyzer.DecodeStrict)))
+	c.setTokens(token, "refresh")
+	_, err = c.Scooters(1, 1, 0, 0)
+	driftErr, ok := sharealyzer.IsSchemaDrift(err)
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{"lat"}, driftErr.Unknown)
+		assert.Equal(t, []string{"latitude"}, driftErr.Missing)
+	}
+}
@@ -0,0 +1,108 @@
+package circ
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
+
+// ReadScrapeFile reads a single gzipped scrape file written by the scraper
+func ReadScrapeFile(path string) (*ScrapeResult, error) {
+	fileDate, offset, err := extractDateFromFilename(filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := archive.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gzipReader, err := archive.NewGzipReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	scooters, err := decodeScooters(gzipReader)
+	if err != nil {
+		return nil, err
+	}
+	return &ScrapeResult{
+		Date:       fileDate,
+		ZoneOffset: offset,
+		Scooters:   scooters,
+	}, nil
+}
+
+// decodeScooters decodes the scooters of an uncompressed scrape file in either format
+func decodeScooters(r io.Reader) ([]*Scooter, error) {
+	scooters := []*Scooter{}
+	err := archive.Decode(r, func(record json.RawMessage) error {
+		scooter := &Scooter{}
+		if err := json.Unmarshal(record, scooter); err != nil {
+			return err
+		}
+		scooters = append(scooters, scooter)
+		return nil
+	})
+	return scooters, err
+}
+
+// ReadStats counts the files read by ReadArchive. It is only complete after the returned channel is closed.
+type ReadStats struct {
+	Read   int
+	Failed []string
+}
+
+// ReadArchive reads all scrape files within baseDir with a scrape date between from and to and returns
+// them ordered by their scrape date. Up to one file per CPU is decoded ahead of the consumer. Files which
+// can't be read are logged, skipped and recorded in the returned ReadStats.
+func ReadArchive(baseDir string, from, to time.Time) (<-chan *ScrapeResult, *ReadStats, error) {
+	files, err := archive.FilesInRange(baseDir, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type readResult struct {
+		res *ScrapeResult
+		err error
+	}
+	// Every file is delivered through its own channel, which are queued in the order of the files
+	pending := make(chan chan readResult, runtime.NumCPU())
+	go func() {
+		for _, file := range files {
+			result := make(chan readResult, 1)
+			pending <- result
+			go func(file string) {
+				res, err := ReadScrapeFile(file)
+				result <- readResult{res: res, err: err}
+			}(file)
+		}
+		close(pending)
+	}()
+
+	stats := &ReadStats{}
+	out := make(chan *ScrapeResult, 100)
+	go func() {
+		i := 0
+		for result := range pending {
+			read := <-result
+			file, res, err := files[i], read.res, read.err
+			i++
+			if err != nil {
+				log.Printf("[ERROR] Failed to process file %s: %s", file, err)
+				stats.Failed = append(stats.Failed, file)
+				continue
+			}
+			stats.Read++
+			out <- res
+		}
+		close(out)
+	}()
+	return out, stats, nil
+}
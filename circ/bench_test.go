@@ -0,0 +1,129 @@
+package circ_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/circ/circtest"
+)
+
+// benchmarkArchive writes a synthetic archive of a few hours, removed by the returned function
+func benchmarkArchive(b *testing.B, files int) (string, []time.Time, func()) {
+	baseDir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := circtest.DefaultArchiveOptions()
+	opts.Files = files
+	dates, err := circtest.WriteArchive(baseDir, opts)
+	if err != nil {
+		os.RemoveAll(baseDir)
+		b.Fatal(err)
+	}
+	return baseDir, dates, func() { os.RemoveAll(baseDir) }
+}
+
+func BenchmarkReadScrapeFile(b *testing.B) {
+	for _, format := range []archive.Format{archive.FormatJSON, archive.FormatJSONL} {
+		b.Run(string(format), func(b *testing.B) {
+			baseDir, err := ioutil.TempDir("", "bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(baseDir)
+			opts := circtest.DefaultArchiveOptions()
+			opts.Files = 1
+			opts.Format = format
+			dates, err := circtest.WriteArchive(baseDir, opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			files, err := archive.FilesInRange(baseDir, dates[0], dates[0].Add(time.Minute))
+			if err != nil || len(files) != 1 {
+				b.Fatalf("Expected one file: %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := circ.ReadScrapeFile(files[0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadArchive(b *testing.B) {
+	baseDir, dates, cleanup := benchmarkArchive(b, 120)
+	defer cleanup()
+	cacheDir := filepath.Join(baseDir, "cache")
+	readers := map[string]func(string, time.Time, time.Time) (<-chan *circ.ScrapeResult, *circ.ReadStats, error){
+		"files": circ.ReadArchive,
+		"cache": (&circ.DayCache{Dir: cacheDir}).ReadArchive,
+	}
+	for name, readArchive := range readers {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				results, _, err := readArchive(baseDir, dates[0], dates[len(dates)-1].Add(time.Minute))
+				if err != nil {
+					b.Fatal(err)
+				}
+				read := 0
+				for range results {
+					read++
+				}
+				if read != len(dates) {
+					b.Fatalf("Read %d of %d files", read, len(dates))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkArchiveAggregator(b *testing.B) {
+	baseDir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+	opts := circtest.DefaultArchiveOptions()
+	// Several days, so scooters of aggregated days can be reused
+	opts.Files = 144
+	opts.Interval = 30 * time.Minute
+	dates, err := circtest.WriteArchive(baseDir, opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "allocating"
+		if reuse {
+			name = "reusing"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				aggregator := circ.NewArchiveAggregator(baseDir)
+				aggregator.Reuse = reuse
+				files := 0
+				err := aggregator.Aggregate(dates[0], dates[len(dates)-1], func(fileDate time.Time, scooters []*circ.Scooter) error {
+					files++
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if files != len(dates) {
+					b.Fatalf("Aggregated %d of %d files", files, len(dates))
+				}
+			}
+		})
+	}
+}
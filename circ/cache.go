@@ -0,0 +1,489 @@
+package circ
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
+
+// cacheMagic starts every cache file, it changes with incompatible changes of the format
+const cacheMagic = "SACOL1\n"
+
+var (
+	// ErrCacheStale is returned if a cached day doesn't exist or is older than its day folder
+	ErrCacheStale = errors.New("Cached day is stale")
+	// ErrInvalidCache is returned if a cache file can't be decoded
+	ErrInvalidCache = errors.New("Invalid cache file")
+
+	scooterType = reflect.TypeOf(Scooter{})
+)
+
+// CachedDay are the scrapes of a day folder together with the files which couldn't be read
+type CachedDay struct {
+	Results []*ScrapeResult
+	// Files are the names of the files of the results
+	Files []string
+	// Failed maps the names of unreadable files to their error
+	Failed map[string]string
+}
+
+// DayCache caches the scrapes of day folders in a compact binary columnar format, so analyses running
+// repeatedly over the same days don't need to decompress and decode JSON every time. All columns of a day
+// are stored in one file in Dir, strings are dictionary encoded. A cached day is used as long as it is
+// at least as new as its day folder.
+type DayCache struct {
+	Dir string
+}
+
+// Path returns the path of the cache file of a day folder
+func (c *DayCache) Path(dayFolder string) string {
+	return filepath.Join(c.Dir, filepath.Base(dayFolder)+".col")
+}
+
+// Load reads the cached scrapes of a day folder. ErrCacheStale is returned if there is no cache file or
+// the day folder changed after it was written. Packed days are also compared to their tar file.
+func (c *DayCache) Load(dayFolder string) (*CachedDay, error) {
+	dayModTime, err := archive.DayModTime(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	cacheInfo, err := os.Stat(c.Path(dayFolder))
+	if os.IsNotExist(err) || (err == nil && cacheInfo.ModTime().Before(dayModTime)) {
+		return nil, ErrCacheStale
+	} else if err != nil {
+		return nil, err
+	}
+	// Decoding copies every value out of the mapping, so it can be released right away
+	mapped, err := archive.MapFile(c.Path(dayFolder))
+	if err != nil {
+		return nil, err
+	}
+	defer mapped.Close()
+	return decodeDay(mapped.Data)
+}
+
+// Store writes the scrapes of a day folder to the cache
+func (c *DayCache) Store(dayFolder string, day *CachedDay) error {
+	data, err := encodeDay(day)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0770); err != nil {
+		return err
+	}
+	path := c.Path(dayFolder)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ReadDay returns the scrapes of a day folder from the cache and reads and caches the folder if the
+// cache is stale or invalid
+func (c *DayCache) ReadDay(dayFolder string) (*CachedDay, error) {
+	day, err := c.Load(dayFolder)
+	if err == nil {
+		return day, nil
+	} else if err != ErrCacheStale {
+		log.Printf("[WARNING] Rebuilding cache of %s: %s", dayFolder, err)
+	}
+
+	entries, err := archive.DayFiles(dayFolder)
+	if err != nil {
+		return nil, err
+	}
+	day = &CachedDay{Failed: make(map[string]string)}
+	for _, entry := range entries {
+		res, err := ReadScrapeFile(filepath.Join(dayFolder, entry.File))
+		if err != nil {
+			day.Failed[entry.File] = err.Error()
+			continue
+		}
+		day.Results = append(day.Results, res)
+		day.Files = append(day.Files, entry.File)
+	}
+	if err := c.Store(dayFolder, day); err != nil {
+		log.Printf("[WARNING] Failed to cache %s: %s", dayFolder, err)
+	}
+	return day, nil
+}
+
+// ReadArchive works like ReadArchive, but reads the scrapes through the cache. Up to one day folder per
+// CPU is read ahead of the consumer.
+func (c *DayCache) ReadArchive(baseDir string, from, to time.Time) (<-chan *ScrapeResult, *ReadStats, error) {
+	dayFolders, err := archive.FoldersInRange(baseDir, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type readResult struct {
+		day *CachedDay
+		err error
+	}
+	pending := make(chan chan readResult, runtime.NumCPU())
+	go func() {
+		for _, dayFolder := range dayFolders {
+			result := make(chan readResult, 1)
+			pending <- result
+			go func(dayFolder string) {
+				day, err := c.ReadDay(dayFolder)
+				result <- readResult{day: day, err: err}
+			}(dayFolder)
+		}
+		close(pending)
+	}()
+
+	stats := &ReadStats{}
+	out := make(chan *ScrapeResult, 100)
+	go func() {
+		i := 0
+		for result := range pending {
+			read := <-result
+			dayFolder := dayFolders[i]
+			i++
+			if read.err != nil {
+				log.Printf("[ERROR] Failed to read day folder %s: %s", dayFolder, read.err)
+				stats.Failed = append(stats.Failed, dayFolder)
+				continue
+			}
+			for file, err := range read.day.Failed {
+				if _, date, _ := archive.ParseFileName(file); !date.Before(from) && date.Before(to) {
+					log.Printf("[ERROR] Failed to process file %s: %s", file, err)
+					stats.Failed = append(stats.Failed, filepath.Join(dayFolder, file))
+				}
+			}
+			for _, res := range read.day.Results {
+				if !res.Date.Before(from) && res.Date.Before(to) {
+					stats.Read++
+					out <- res
+				}
+			}
+		}
+		close(out)
+	}()
+	return out, stats, nil
+}
+
+// cacheWriter appends values to a cache file
+type cacheWriter struct {
+	bytes.Buffer
+}
+
+func (w *cacheWriter) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (w *cacheWriter) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (w *cacheWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.WriteString(s)
+}
+
+// dictionary assigns numbers to distinct strings in the order they are seen
+type dictionary struct {
+	numbers map[string]uint64
+	values  []string
+}
+
+func (d *dictionary) number(s string) uint64 {
+	if d.numbers == nil {
+		d.numbers = make(map[string]uint64)
+	}
+	n, exists := d.numbers[s]
+	if !exists {
+		n = uint64(len(d.values))
+		d.numbers[s] = n
+		d.values = append(d.values, s)
+	}
+	return n
+}
+
+func encodeDay(day *CachedDay) ([]byte, error) {
+	w := &cacheWriter{}
+	w.WriteString(cacheMagic)
+	w.uvarint(uint64(scooterType.NumField()))
+	for i := 0; i < scooterType.NumField(); i++ {
+		w.string(scooterType.Field(i).Name)
+		w.string(scooterType.Field(i).Type.String())
+	}
+
+	var rows []reflect.Value
+	w.uvarint(uint64(len(day.Results)))
+	for i, res := range day.Results {
+		w.string(day.Files[i])
+		w.varint(res.Date.Unix())
+		w.varint(int64(res.Date.Nanosecond()))
+		w.varint(int64(res.ZoneOffset))
+		w.uvarint(uint64(len(res.Scooters)))
+		for _, scooter := range res.Scooters {
+			rows = append(rows, reflect.ValueOf(scooter).Elem())
+		}
+	}
+	w.uvarint(uint64(len(day.Failed)))
+	for file, err := range day.Failed {
+		w.string(file)
+		w.string(err)
+	}
+
+	for i := 0; i < scooterType.NumField(); i++ {
+		if err := encodeColumn(w, scooterType.Field(i).Type, rows, i); err != nil {
+			return nil, err
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// encodeColumn writes field i of all rows
+func encodeColumn(w *cacheWriter, fieldType reflect.Type, rows []reflect.Value, i int) error {
+	column := &cacheWriter{}
+	dict := &dictionary{}
+	switch {
+	case fieldType.Kind() == reflect.String:
+		for _, row := range rows {
+			column.uvarint(dict.number(row.Field(i).String()))
+		}
+	case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.String:
+		// 0 is nil, all other numbers are shifted by one
+		for _, row := range rows {
+			if f := row.Field(i); f.IsNil() {
+				column.uvarint(0)
+			} else {
+				column.uvarint(dict.number(f.Elem().String()) + 1)
+			}
+		}
+	case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.String:
+		// 0 is nil, otherwise the length is shifted by one
+		for _, row := range rows {
+			f := row.Field(i)
+			if f.IsNil() {
+				column.uvarint(0)
+				continue
+			}
+			column.uvarint(uint64(f.Len()) + 1)
+			for j := 0; j < f.Len(); j++ {
+				column.uvarint(dict.number(f.Index(j).String()))
+			}
+		}
+	case fieldType.Kind() == reflect.Bool:
+		for _, row := range rows {
+			if row.Field(i).Bool() {
+				column.WriteByte(1)
+			} else {
+				column.WriteByte(0)
+			}
+		}
+	case fieldType.Kind() == reflect.Int:
+		for _, row := range rows {
+			column.varint(row.Field(i).Int())
+		}
+	case fieldType.Kind() == reflect.Uint64:
+		for _, row := range rows {
+			column.uvarint(row.Field(i).Uint())
+		}
+	case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Uint64:
+		for _, row := range rows {
+			if f := row.Field(i); f.IsNil() {
+				column.WriteByte(0)
+			} else {
+				column.WriteByte(1)
+				column.uvarint(f.Elem().Uint())
+			}
+		}
+	case fieldType.Kind() == reflect.Float64:
+		var buf [8]byte
+		for _, row := range rows {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(row.Field(i).Float()))
+			column.Write(buf[:])
+		}
+	default:
+		return fmt.Errorf("Field %s of type %s can't be cached", scooterType.Field(i).Name, fieldType)
+	}
+	w.uvarint(uint64(len(dict.values)))
+	for _, value := range dict.values {
+		w.string(value)
+	}
+	w.Write(column.Bytes())
+	return nil
+}
+
+// cacheReader reads values from a cache file. The first error is kept and all following reads return
+// zero values.
+type cacheReader struct {
+	data []byte
+	err  error
+}
+
+func (r *cacheReader) fail() {
+	r.err = ErrInvalidCache
+	r.data = nil
+}
+
+func (r *cacheReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *cacheReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *cacheReader) bytes(n uint64) []byte {
+	if uint64(len(r.data)) < n {
+		r.fail()
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *cacheReader) string() string {
+	return string(r.bytes(r.uvarint()))
+}
+
+// count reads a number of following elements which take at least one byte each
+func (r *cacheReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func decodeDay(data []byte) (*CachedDay, error) {
+	r := &cacheReader{data: data}
+	if string(r.bytes(uint64(len(cacheMagic)))) != cacheMagic {
+		return nil, ErrInvalidCache
+	}
+	// The cache is stale if the Scooter type changed since it was written
+	fields := r.count()
+	for i := 0; i < fields && r.err == nil; i++ {
+		name, fieldType := r.string(), r.string()
+		if fields != scooterType.NumField() || name != scooterType.Field(i).Name ||
+			fieldType != scooterType.Field(i).Type.String() {
+			return nil, ErrCacheStale
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if fields != scooterType.NumField() {
+		return nil, ErrCacheStale
+	}
+
+	day := &CachedDay{Failed: make(map[string]string)}
+	var rows []reflect.Value
+	results := r.count()
+	for i := 0; i < results && r.err == nil; i++ {
+		file := r.string()
+		seconds, nanos, offset := r.varint(), r.varint(), r.varint()
+		scooters := r.count()
+		res := &ScrapeResult{
+			Date:       time.Unix(seconds, nanos).UTC(),
+			ZoneOffset: int(offset),
+			Scooters:   make([]*Scooter, scooters),
+		}
+		for j := range res.Scooters {
+			res.Scooters[j] = &Scooter{}
+			rows = append(rows, reflect.ValueOf(res.Scooters[j]).Elem())
+		}
+		day.Results = append(day.Results, res)
+		day.Files = append(day.Files, file)
+	}
+	failed := r.count()
+	for i := 0; i < failed && r.err == nil; i++ {
+		day.Failed[r.string()] = r.string()
+	}
+
+	for i := 0; i < scooterType.NumField() && r.err == nil; i++ {
+		decodeColumn(r, scooterType.Field(i).Type, rows, i)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return day, nil
+}
+
+// decodeColumn reads field i of all rows
+func decodeColumn(r *cacheReader, fieldType reflect.Type, rows []reflect.Value, i int) {
+	dict := make([]string, r.count())
+	for j := range dict {
+		dict[j] = r.string()
+	}
+	lookup := func(n uint64) string {
+		if n >= uint64(len(dict)) {
+			r.fail()
+			return ""
+		}
+		return dict[n]
+	}
+	for _, row := range rows {
+		if r.err != nil {
+			return
+		}
+		f := row.Field(i)
+		switch {
+		case fieldType.Kind() == reflect.String:
+			f.SetString(lookup(r.uvarint()))
+		case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.String:
+			if n := r.uvarint(); n > 0 {
+				s := lookup(n - 1)
+				f.Set(reflect.ValueOf(&s))
+			}
+		case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.String:
+			if n := r.count(); n > 0 {
+				values := make([]string, n-1)
+				for j := range values {
+					values[j] = lookup(r.uvarint())
+				}
+				f.Set(reflect.ValueOf(values))
+			}
+		case fieldType.Kind() == reflect.Bool:
+			if b := r.bytes(1); len(b) == 1 {
+				f.SetBool(b[0] == 1)
+			}
+		case fieldType.Kind() == reflect.Int:
+			f.SetInt(r.varint())
+		case fieldType.Kind() == reflect.Uint64:
+			f.SetUint(r.uvarint())
+		case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Uint64:
+			if b := r.bytes(1); len(b) == 1 && b[0] == 1 {
+				v := r.uvarint()
+				f.Set(reflect.ValueOf(&v))
+			}
+		case fieldType.Kind() == reflect.Float64:
+			if b := r.bytes(8); len(b) == 8 {
+				f.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			}
+		}
+	}
+}
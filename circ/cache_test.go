@@ -0,0 +1,104 @@
+package circ
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArchiveFile(t *testing.T, baseDir string, date time.Time, scooters []*Scooter) string {
+	dayFolder := filepath.Join(baseDir, archive.FolderName("circ", date))
+	require.NoError(t, os.MkdirAll(dayFolder, 0770))
+	data, err := json.Marshal(scooters)
+	require.NoError(t, err)
+	path := filepath.Join(dayFolder, archive.FileName("circ", date))
+	require.NoError(t, archive.WriteFile(path, data))
+	return path
+}
+
+func TestDayCache(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	brokenAt := uint64(1570514000000)
+	userType := "SERVICE"
+	scooters := []*Scooter{{
+		Identifier:            "a",
+		Actions:               []string{"ring", "unlock"},
+		Broken:                true,
+		BrokenUpdateAt:        &brokenAt,
+		BrokenUpdatedUserType: &userType,
+		EnergyLevel:           -1,
+		LastGnssUpdate:        1570514087000,
+		Latitude:              51.51,
+		Longitude:             7.46,
+		ZoneIdentifier:        "center",
+	}, {
+		Identifier:     "b",
+		Actions:        []string{},
+		ZoneIdentifier: "center",
+	}}
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.FixedZone("", 3600))
+	path := writeArchiveFile(t, baseDir, date, scooters)
+	writeArchiveFile(t, baseDir, date.Add(time.Minute), scooters[1:])
+	dayFolder := filepath.Dir(path)
+	brokenPath := filepath.Join(dayFolder, archive.FileName("circ", date.Add(2*time.Minute)))
+	require.NoError(t, ioutil.WriteFile(brokenPath, []byte("broken"), 0660))
+
+	cache := &DayCache{Dir: filepath.Join(baseDir, "cache")}
+	_, err = cache.Load(dayFolder)
+	assert.Equal(t, ErrCacheStale, err)
+
+	day, err := cache.ReadDay(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, day.Results, 2)
+	assert.Len(t, day.Failed, 1)
+
+	cached, err := cache.Load(dayFolder)
+	require.NoError(t, err)
+	assert.Equal(t, day.Files, cached.Files)
+	assert.Equal(t, day.Failed, cached.Failed)
+	require.Len(t, cached.Results, 2)
+	assert.True(t, date.Equal(cached.Results[0].Date))
+	// Dates are in UTC, the offset of the scraping host is kept
+	assert.Equal(t, time.UTC, cached.Results[0].Date.Location())
+	assert.Equal(t, 3600, cached.Results[0].ZoneOffset)
+	assert.Equal(t, date.Format(time.RFC3339), cached.Results[0].LocalDate().Format(time.RFC3339))
+	assert.Equal(t, scooters, cached.Results[0].Scooters)
+	assert.Equal(t, scooters[1:], cached.Results[1].Scooters)
+
+	// The cached and the uncached archive contain the same scrapes
+	results, stats, err := cache.ReadArchive(baseDir, date, date.Add(time.Hour))
+	require.NoError(t, err)
+	var read []*ScrapeResult
+	for res := range results {
+		read = append(read, res)
+	}
+	assert.Equal(t, 2, stats.Read)
+	assert.Equal(t, []string{brokenPath}, stats.Failed)
+	assert.Equal(t, cached.Results, read)
+
+	// Invalid caches are rebuilt
+	require.NoError(t, ioutil.WriteFile(cache.Path(dayFolder), []byte(cacheMagic+"garbage"), 0660))
+	_, err = cache.Load(dayFolder)
+	assert.Equal(t, ErrInvalidCache, err)
+	day, err = cache.ReadDay(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, day.Results, 2)
+	_, err = cache.Load(dayFolder)
+	assert.NoError(t, err)
+
+	// Changing the day folder invalidates the cache
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(dayFolder, future, future))
+	_, err = cache.Load(dayFolder)
+	assert.Equal(t, ErrCacheStale, err)
+}
@@ -1,11 +1,8 @@
 package circ
 
 import (
-	"bufio"
-	"compress/gzip"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -13,13 +10,13 @@ import (
 	"regexp"
 	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
-	"github.com/umahmood/haversine"
 )
 
 // Scraper uses a circ client to scrape a region for available circ scooters
@@ -36,8 +33,15 @@ type Scraper struct {
 
 	maxAuthRetries int
 
+	// ScrapeDeadline limits how long a single scrape including retries may take. Scrape uses the scrape
+	// interval if it is not set, so a hung scrape can't delay the following scrapes.
+	ScrapeDeadline time.Duration
+
 	phonePrefix string
 	phoneNumber string
+
+	// CodeProvider provides the SMS code when the scraper needs to authenticate again
+	CodeProvider CodeProvider
 }
 
 // NewScraper creates a new Scraper with the the given Client. It lets you specify
@@ -54,13 +58,15 @@ func NewScraper(client *Client,
 		maxAuthRetries:       5,
 		phonePrefix:          phonePrefix,
 		phoneNumber:          phoneNumber,
+		CodeProvider:         &StdinCodeProvider{},
 	}
 }
 
 // Scrape starts the scraping process with the specified interval and returns a channel with items containing
-// the scrape date and all scraped scooters
+// the scrape date and all scraped scooters. Scrapes which fail are logged and skipped.
 func (c *Scraper) Scrape(ctx context.Context, scrapeInterval time.Duration) <-chan *ScrapeResult {
 	out := make(chan *ScrapeResult, 100)
+	c.scrapeInterval = scrapeInterval
 	go func() {
 		scrapeTimer := time.NewTimer(scrapeInterval)
 		for {
@@ -70,13 +76,28 @@ func (c *Scraper) Scrape(ctx context.Context, scrapeInterval time.Duration) <-ch
 				return
 			case <-scrapeTimer.C:
 				scrapeTimer.Stop()
-				scooters, err := c.doScrape()
+				deadline := c.ScrapeDeadline
+				if deadline == 0 {
+					deadline = c.scrapeInterval
+				}
+				scooters, err := c.doScrape(time.Now().Add(deadline))
+				if _, cooldown := err.(*LoginCooldownError); err == ErrScrapeDeadline || cooldown {
+					log.Printf("[WARNING] Skipping scrape: %s", err)
+					scrapeTimer = time.NewTimer(c.scrapeInterval)
+					continue
+				}
 				if err != nil {
-					log.Fatalf("Failed to scrape circ finally: %s", err)
+					// The API may recover until the next scrape, so failed scrapes don't stop scraping
+					log.Printf("[ERROR] Skipping scrape, failed to scrape circ: %s", err)
+					scrapeTimer = time.NewTimer(c.scrapeInterval)
+					continue
 				}
+				now := time.Now()
+				_, offset := now.Zone()
 				out <- &ScrapeResult{
-					Scooters: scooters,
-					Date:     time.Now(),
+					Scooters:   scooters,
+					Date:       now.UTC(),
+					ZoneOffset: offset,
 				}
 				scrapeTimer = time.NewTimer(c.scrapeInterval)
 			}
@@ -85,41 +106,65 @@ func (c *Scraper) Scrape(ctx context.Context, scrapeInterval time.Duration) <-ch
 	return out
 }
 
-func (c *Scraper) doScrape() (scooters []*Scooter, err error) {
+// ScrapeOnce immediately scrapes the configured region once, authenticating if necessary
+func (c *Scraper) ScrapeOnce() ([]*Scooter, error) {
+	var deadline time.Time
+	if c.ScrapeDeadline > 0 {
+		deadline = time.Now().Add(c.ScrapeDeadline)
+	}
+	return c.doScrape(deadline)
+}
+
+// ErrScrapeDeadline is returned if a scrape could not be completed within the ScrapeDeadline
+var ErrScrapeDeadline = errors.New("Scrape deadline exceeded")
+
+// doScrape scrapes the configured area and retries on errors until the deadline, a zero deadline means no deadline
+func (c *Scraper) doScrape(deadline time.Time) (scooters []*Scooter, err error) {
 	retryCounter := 0
 	maxRetries := 5
 	authCounter := 0
 
 	success := false
-	for ; retryCounter < maxRetries || !success; retryCounter = retryCounter + 1 {
+	for ; retryCounter < maxRetries && !success; retryCounter = retryCounter + 1 {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, ErrScrapeDeadline
+		}
 		if scooters, err = c.client.Scooters(c.latTopLeft, c.lonTopLeft, c.latBottomRight, c.lonBottomRight); err != nil {
-			if circErr, ok := err.(CircError); ok {
-				if circErr.Status >= 400 && circErr.Status < 500 {
-
-					for ; authCounter < c.maxAuthRetries; authCounter = authCounter + 1 {
-						err := c.client.Login(c.phonePrefix, c.phoneNumber, func() string {
-							fmt.Print("Please enter SMS code: ")
-							reader := bufio.NewReader(os.Stdin)
-							code, _ := reader.ReadString('\n')
-							code = strings.Replace(code, "\n", "", -1)
-							fmt.Println("Thank you")
-							return code
-						})
-						if err == nil {
-							break
-						}
+			if rateErr, ok := sharealyzer.IsRateLimit(err); ok {
+				backoff := rateErr.RetryAfter
+				if !deadline.IsZero() {
+					// The deadline limits how long we back off, so rate limits don't use up the retries
+					retryCounter--
+					if remaining := time.Until(deadline); remaining < backoff {
+						backoff = remaining
+					}
+				}
+				log.Printf("[WARNING] Rate limited by Circ, backing off for %s", backoff)
+				time.Sleep(backoff)
+				continue
+			}
+			if IsAuthError(err) {
+				log.Printf("Authentication with Circ expired, logging in again: %s", err)
+				for ; authCounter < c.maxAuthRetries; authCounter = authCounter + 1 {
+					loginErr := c.client.LoginWith(c.phonePrefix, c.phoneNumber, c.CodeProvider)
+					if loginErr == nil {
+						break
 					}
-					if authCounter >= c.maxAuthRetries {
-						log.Fatalf("Failed to authenticate with Circ")
+					if cooldownErr, ok := loginErr.(*LoginCooldownError); ok {
+						return nil, cooldownErr
 					}
-				} else {
-					log.Fatalf("Unhandable error from Circ: %s", circErr.Error())
+					log.Printf("[WARNING] Failed to login with Circ: %s", loginErr)
+				}
+				if authCounter >= c.maxAuthRetries {
+					return nil, errors.Wrap(err, "Failed to authenticate with Circ")
 				}
+			} else if _, ok := err.(CircError); ok {
+				return nil, errors.Wrap(err, "Unhandable error from Circ")
 			} else {
 				retryCounter++
 
 				if retryCounter == maxRetries {
-					log.Fatalf("Failed to retrieve scooters with unknown error: %s", err)
+					return nil, errors.Wrap(err, "Failed to retrieve scooters with unknown error")
 				} else {
 					log.Printf("Failed to retrieve scooters with unknown error, retrying: %s", err)
 				}
@@ -136,8 +181,16 @@ func (c *Scraper) doScrape() (scooters []*Scooter, err error) {
 
 // ScrapeResult contains all scraped scooters with the date when these scooters were scraped from the API
 type ScrapeResult struct {
-	Date     time.Time
-	Scooters []*Scooter
+	// Date is always in UTC, so results scraped on hosts in different time zones line up
+	Date time.Time
+	// ZoneOffset is the UTC offset in seconds of the host which scraped the result
+	ZoneOffset int
+	Scooters   []*Scooter
+}
+
+// LocalDate returns the scrape date in the time zone of the host which scraped the result
+func (c *ScrapeResult) LocalDate() time.Time {
+	return c.Date.In(time.FixedZone("", c.ZoneOffset))
 }
 
 // ScrapeDate returns the date when this ScrapeResult was created
@@ -172,101 +225,40 @@ func SplitChan(in <-chan *ScrapeResult) (<-chan *ScrapeResult, <-chan *ScrapeRes
 	return out1, out2
 }
 
-// TripAggregator tries to aggregate ScrapeResults to Trips
+// TripAggregator aggregates circ ScrapeResults to Trips. It is a sharealyzer.TripAggregator converting the
+// results first, so trips of circ are detected like the trips of every other provider.
 type TripAggregator struct {
-	unfinishedTrips map[string]*sharealyzer.Trip
-	lastScooters    Scooters
-
-	debug bool
+	*sharealyzer.TripAggregator
 }
 
 // NewTripAggregator creates a new TripAggregator
 func NewTripAggregator() *TripAggregator {
-	return &TripAggregator{
-		unfinishedTrips: make(map[string]*sharealyzer.Trip),
-		lastScooters:    NewScooters([]*Scooter{}),
-		debug:           true,
-	}
+	return &TripAggregator{TripAggregator: sharealyzer.NewTripAggregator()}
 }
 
 // Aggregate takes a channel of ScrapeResult and returns a channel of aggregated Trips
 func (c *TripAggregator) Aggregate(in <-chan *ScrapeResult) <-chan *sharealyzer.Trip {
-	out := make(chan *sharealyzer.Trip, 100)
-	go func() {
-		for res := range in {
-			scooters := NewScooters(res.Scooters)
-			vanishedScooter := scooters.Difference(c.lastScooters)
-			for id, scooter := range vanishedScooter {
-				trip := &sharealyzer.Trip{
-					ScooterID:        id,
-					ScooterProvider:  "circ",
-					StartChargeLevel: float64(scooter.EnergyLevel),
-					StartLocation:    sharealyzer.NewGeoLocation(scooter.Latitude, scooter.Longitude),
-					StartTime:        res.ScrapeDate(),
-				}
-				c.unfinishedTrips[id] = trip
-			}
-
-			for id, trip := range c.unfinishedTrips {
-				if scooter, exists := scooters[id]; exists {
-					trip.EndChargeLevel = float64(scooter.EnergyLevel)
-					trip.EndLocation = sharealyzer.NewGeoLocation(scooter.Latitude, scooter.Longitude)
-					trip.UserID = scooter.StateUpdatedByUserIdentifier
-					trip.EndTime = res.ScrapeDate()
-					trip.Duration = trip.EndTime.Sub(trip.StartTime)
-					trip.Cost = uint64(scooter.InitPrice + (scooter.Price * int(trip.Duration.Minutes())))
-
-					_, distanceKm := haversine.Distance(
-						haversine.Coord{Lat: trip.StartLocation.Latitude, Lon: trip.StartLocation.Longitude},
-						haversine.Coord{Lat: trip.EndLocation.Latitude, Lon: trip.EndLocation.Longitude},
-					)
-					trip.Distance = distanceKm
-					delete(c.unfinishedTrips, id)
-					out <- trip
-				}
-			}
-			c.lastScooters = scooters
-		}
-		close(out)
-	}()
-	return out
+	return c.TripAggregator.Aggregate(ConvertScrapeResult(in))
 }
 
 // Scooters is a map of Scooters in a ScrapeResult. This makes it easier to create differences
 // from other sets of Scooters and to look up Scooters
-type Scooters map[string]*Scooter
+type Scooters = sharealyzer.KeyedSet[string, *Scooter]
 
 // NewScooters creates a new map based Scooters type from a slice of Scooters
 func NewScooters(in []*Scooter) Scooters {
-	s := make(Scooters)
-	for _, scooter := range in {
-		s[scooter.Identifier] = scooter
-	}
-	return s
-}
-
-// Difference returns all scooters which exist in ns but not in this Scooters instance
-func (s Scooters) Difference(ns Scooters) Scooters {
-	s2 := make(Scooters)
-
-	for id, scooter := range ns {
-		if _, exists := s[id]; !exists {
-			s2[id] = scooter
-		}
-	}
-	return s2
+	return sharealyzer.NewKeyedSet(in, func(scooter *Scooter) string { return scooter.Identifier })
 }
 
 // FileScraper uses a folder structure as input to generate a channel of ScrapeResults.
 // It also watches for new subfolders and files and feeds them to the channel.
 type FileScraper struct {
-	baseDir string
+	// SettleTime is how long a new file needs to stay unchanged until it is read, defaults to
+	// DefaultSettleTime
+	SettleTime time.Duration
 
-	fileNameChan           chan string
-	fileWatcher            *fsnotify.Watcher
-	folderWatcher          *fsnotify.Watcher
-	currentlyWatchedFolder string
-	watchMutex             *sync.Mutex
+	baseDir     string
+	failedFiles int64
 
 	debug bool
 }
@@ -274,15 +266,20 @@ type FileScraper struct {
 // NewFileScraper creates a new FileScraper scraping the given baseDir
 func NewFileScraper(baseDir string) *FileScraper {
 	return &FileScraper{
-		baseDir:      baseDir,
-		fileNameChan: make(chan string, 10000),
-		watchMutex:   &sync.Mutex{},
-		debug:        false,
+		baseDir: baseDir,
+		debug:   false,
 	}
 }
 
+// watchedFile is a new file read by the watcher
+type watchedFile struct {
+	path string
+	res  *ScrapeResult
+}
+
 // Scrape actually starts the scraping process. This means reading all existing files and then
-// watching for new files.
+// watching for new files. Without watching, archive.ErrNoScrapeFiles is returned if baseDir has no
+// subfolders. When watching, the first new day folder is waited for.
 func (c *FileScraper) Scrape(ctx context.Context, watch bool) (<-chan *ScrapeResult, error) {
 	var subfolderNames []string
 
@@ -290,196 +287,263 @@ func (c *FileScraper) Scrape(ctx context.Context, watch bool) (<-chan *ScrapeRes
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to read base directory")
 	}
+	seen := make(map[string]bool)
 	for _, f := range subFiles {
-		if f.IsDir() {
-			subfolderNames = append(subfolderNames, filepath.Join(c.baseDir, f.Name()))
+		name := f.Name()
+		// Packed days are read through the path of their former day folder
+		if packed := strings.TrimSuffix(name, archive.TarSuffix); packed != name && f.Mode().IsRegular() && archive.IsDayFolder(packed) {
+			name = packed
+		} else if !f.IsDir() {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			subfolderNames = append(subfolderNames, filepath.Join(c.baseDir, name))
 		}
 	}
 	sort.Strings(subfolderNames)
-	if watch {
-		c.fileWatcher, err = fsnotify.NewWatcher()
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to create file watcher")
-		}
-		c.folderWatcher, err = fsnotify.NewWatcher()
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to create folder watcher")
+
+	out := make(chan *ScrapeResult, 1000)
+	if !watch {
+		if len(subfolderNames) == 0 {
+			return nil, archive.ErrNoScrapeFiles
 		}
+		go func() {
+			defer close(out)
+			c.readFolders(ctx, subfolderNames, out)
+		}()
+		return out, nil
 	}
 
-	out := make(chan *ScrapeResult, 1000)
-	fileBufferChan := make(chan *ScrapeResult, 1000)
-	buffering := true
-	if watch {
-		err = c.folderWatcher.Add(c.baseDir)
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to watch base dir")
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create watcher")
+	}
+	if err := watcher.Add(c.baseDir); err != nil {
+		watcher.Close()
+		return nil, errors.Wrap(err, "Failed to watch base dir")
+	}
+	// Only the latest day folder gets new files, without one the first new folder is waited for
+	current := ""
+	if len(subfolderNames) > 0 && isDir(subfolderNames[len(subfolderNames)-1]) {
+		current = subfolderNames[len(subfolderNames)-1]
+		if err := watcher.Add(current); err != nil {
+			watcher.Close()
+			return nil, errors.Wrapf(err, "Failed to watch latest sub folder %s", current)
 		}
 	}
-	if watch {
-		folderCtx, folderCancel := context.WithCancel(ctx)
-		go func() {
-			defer folderCancel()
-			for {
-				select {
-				case <-folderCtx.Done():
-					return
-				case evt := <-c.folderWatcher.Events:
-					if evt.Op == fsnotify.Create {
-						c.watchMutex.Lock()
-						c.fileWatcher.Remove(c.currentlyWatchedFolder)
-						newFolder := filepath.Join(c.baseDir, evt.Name)
-						c.currentlyWatchedFolder = newFolder
-						err := c.fileWatcher.Add(newFolder)
-						if err != nil {
-							log.Fatalf("[ERROR] Failed to watch folder %s: %s", newFolder, err)
-						}
-						c.watchMutex.Unlock()
-					}
-				}
+
+	// New files are buffered until all existing files are read
+	watched := make(chan watchedFile, 1000)
+	go c.watch(ctx, watcher, current, watched)
+	go func() {
+		defer close(out)
+		read := c.readFolders(ctx, subfolderNames, out)
+		for file := range watched {
+			if read[file.path] {
+				// Created after the folder was watched but before it was read
+				continue
+			}
+			select {
+			case out <- file.res:
+			case <-ctx.Done():
+				return
 			}
+		}
+	}()
 
-		}()
-		c.currentlyWatchedFolder = subfolderNames[len(subfolderNames)-1]
-		err = c.fileWatcher.Add(c.currentlyWatchedFolder)
+	return out, nil
+}
+
+// readFolders sends the content of all scrape files in the given folders in order to out and returns the
+// files read from the last folder
+func (c *FileScraper) readFolders(ctx context.Context, folders []string, out chan<- *ScrapeResult) map[string]bool {
+	read := make(map[string]bool)
+	for i, subFolder := range folders {
+		files, err := archive.ScrapeFiles(subFolder)
 		if err != nil {
-			return nil, errors.Wrapf(err, "Failed to watch latest sub folder %s", c.currentlyWatchedFolder)
+			log.Printf("[ERROR] Failed to read directory %s: %s", subFolder, err)
+			atomic.AddInt64(&c.failedFiles, 1)
+			continue
 		}
-		fileCtx, fileCancel := context.WithCancel(ctx)
-		go func() {
-			defer fileCancel()
-			for {
-				select {
-				case <-fileCtx.Done():
-					close(out)
-					return
-				case evt := <-c.fileWatcher.Events:
-					if evt.Op == fsnotify.Create {
-						// FIXME this file is not really finished writing, we need to fix this
-						scrapeFilePath := evt.Name
-						res, err := c.handleNewFile(scrapeFilePath)
-						if err != nil {
-							log.Printf("[ERROR]: Failed to process created file %s: %s", evt.Name, err)
-							continue
-						}
-						c.watchMutex.Lock()
-						if buffering {
-							fileBufferChan <- res
-						} else {
-							out <- res
-						}
-						c.watchMutex.Lock()
-					}
-				}
+		// Indexes, files which are still written and files of other providers aren't circ scrape files
+		scrapeFileNames := make([]string, 0, len(files))
+		for _, file := range files {
+			if fileNameRegex.MatchString(filepath.Base(file)) {
+				scrapeFileNames = append(scrapeFileNames, file)
 			}
-		}()
-	}
+		}
 
-	go func() {
-		for _, subFolder := range subfolderNames {
-			subFilesInfos, err := ioutil.ReadDir(subFolder)
+		for _, scrapeFile := range scrapeFileNames {
+			circFilePath := scrapeFile
+			res, err := c.handleNewFile(circFilePath)
 			if err != nil {
-				log.Fatalf("[ERROR] Failed to read directory %s: %s", subFolder, err)
+				log.Printf("[ERROR] Failed to process file %s: %s", circFilePath, err)
+				atomic.AddInt64(&c.failedFiles, 1)
 				continue
 			}
-			scrapeFileNames := make([]string, 0, len(subFilesInfos))
-			for _, subInfo := range subFilesInfos {
-				scrapeFileNames = append(scrapeFileNames, filepath.Join(subFolder, subInfo.Name()))
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return read
+			}
+			if i == len(folders)-1 {
+				read[circFilePath] = true
 			}
-			sort.Strings(scrapeFileNames)
+		}
+	}
+	return read
+}
 
-			for _, scrapeFile := range scrapeFileNames {
-				circFilePath := scrapeFile
-				res, err := c.handleNewFile(circFilePath)
-				if err != nil {
-					log.Fatalf("[ERROR] Failed to process file %s: %s", circFilePath, err)
+// watch reads new files in the watched day folders once they are complete and sends them to out until ctx
+// is done. When a new day folder shows up, it is watched in addition to the current one, which may still
+// get late files, and files created before the new folder was watched are picked up.
+func (c *FileScraper) watch(ctx context.Context, watcher *fsnotify.Watcher, current string, out chan<- watchedFile) {
+	defer close(out)
+	defer watcher.Close()
+
+	baseDir := filepath.Clean(c.baseDir)
+	previous := ""
+	tracker := newWriteTracker(c.SettleTime)
+	ticker := time.NewTicker(tracker.pollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			log.Printf("[ERROR] Failed to watch %s: %s", c.baseDir, err)
+		case evt := <-watcher.Events:
+			if filepath.Dir(evt.Name) != baseDir {
+				tracker.event(evt, time.Now())
+				continue
+			}
+			// evt.Name already contains the base dir
+			if evt.Op&fsnotify.Create == 0 || evt.Name <= current || !isDir(evt.Name) {
+				continue
+			}
+			if err := watcher.Add(evt.Name); err != nil {
+				log.Printf("[ERROR] Failed to watch folder %s: %s", evt.Name, err)
+				atomic.AddInt64(&c.failedFiles, 1)
+				continue
+			}
+			if previous != "" {
+				// Ignore the error, the folder might be gone already
+				watcher.Remove(previous)
+			}
+			now := time.Now()
+			for _, folder := range []string{current, evt.Name} {
+				if folder == "" {
 					continue
 				}
-				out <- res
+				if err := tracker.drain(folder, now); err != nil {
+					log.Printf("[WARNING] Failed to drain folder %s: %s", folder, err)
+				}
 			}
-		}
-		if watch {
-			c.watchMutex.Lock()
-			buffering = false
-			close(fileBufferChan)
-			// drain the buffer
-			for res := range fileBufferChan {
-				out <- res
+			previous, current = current, evt.Name
+			tracker.forget(previous, current)
+		case now := <-ticker.C:
+			for _, scrapeFilePath := range tracker.complete(now) {
+				res, err := c.handleNewFile(scrapeFilePath)
+				if err != nil {
+					log.Printf("[ERROR]: Failed to process created file %s: %s", scrapeFilePath, err)
+					atomic.AddInt64(&c.failedFiles, 1)
+					continue
+				}
+				select {
+				case out <- watchedFile{path: scrapeFilePath, res: res}:
+				case <-ctx.Done():
+					return
+				}
 			}
-			c.watchMutex.Unlock()
-		} else {
-			close(out)
 		}
+	}
+}
 
-	}()
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
 
-	return out, nil
+// FailedFiles returns the number of files and folders which couldn't be read and were skipped
+func (c *FileScraper) FailedFiles() int {
+	return int(atomic.LoadInt64(&c.failedFiles))
 }
 
 func (c *FileScraper) handleNewFile(path string) (*ScrapeResult, error) {
 	if c.debug {
 		log.Printf("Processing file %s", path)
 	}
-	scrapeFileName := filepath.Base(path)
-	scrapeFile, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer scrapeFile.Close()
-	fileDate, err := extractDateFromFilename(scrapeFileName)
-	if err != nil {
-		return nil, err
-	}
-
-	res := &ScrapeResult{
-		Date:     fileDate,
-		Scooters: []*Scooter{},
-	}
-	gzipReader, err := gzip.NewReader(scrapeFile)
-	if err != nil {
-		return nil, err
-	}
-	defer gzipReader.Close()
-	if err = json.NewDecoder(gzipReader).Decode(&res.Scooters); err != nil {
-		return nil, err
-	}
-	return res, nil
+	return ReadScrapeFile(path)
 }
 
 var (
-	fileNameRegex = regexp.MustCompile(`^circ_([0-9-T:+]+).json.gz$`)
+	fileNameRegex = regexp.MustCompile(`^circ_([0-9-T:+Z]+).json.gz$`)
 )
 
-func extractDateFromFilename(fileName string) (time.Time, error) {
-	matches := fileNameRegex.FindAllStringSubmatch(fileName, -1)
-
-	stringDate := matches[0][1]
-
-	return time.Parse(time.RFC3339, stringDate)
+// extractDateFromFilename returns the scrape date in UTC and the UTC offset embedded in the file name
+func extractDateFromFilename(fileName string) (time.Time, int, error) {
+	matches := fileNameRegex.FindStringSubmatch(fileName)
+	if matches == nil {
+		return time.Time{}, 0, errors.Errorf("%s is not a valid scrape file name", fileName)
+	}
+	return archive.ParseScrapeDate(matches[1])
 }
 
 func ConvertScrapeResult(in <-chan *ScrapeResult) <-chan sharealyzer.ScrapeResult {
 	out := make(chan sharealyzer.ScrapeResult, 100)
 	go func() {
 		for res := range in {
-			sc := make([]*sharealyzer.Scooter, len(res.Scooters))
-			for i, circScooter := range res.Scooters {
-				sc[i] = &sharealyzer.Scooter{
-					ID:                   circScooter.Identifier,
-					Provider:             "circ",
-					State:                sharealyzer.IdleRentable,
-					Location:             sharealyzer.NewGeoLocation(circScooter.Latitude, circScooter.Longitude),
-					ChargeLevel:          float64(circScooter.EnergyLevel),
-					LastUpdate:           res.ScrapeDate(),
-					QRContent:            circScooter.QrCode,
-					StateUpdatedByUserID: circScooter.StateUpdatedByUserIdentifier,
-					InitPrice:            circScooter.InitPrice,
-					UnitPrice:            circScooter.Price,
-				}
-			}
-			out <- sharealyzer.NewScrapeResult("circ", res.Date, sc)
+			out <- res.Generic()
 		}
 		close(out)
 	}()
 	return out
 }
+
+// Generic converts the scrape result into a provider independent sharealyzer.ScrapeResult
+func (res *ScrapeResult) Generic() sharealyzer.ScrapeResult {
+	sc := make([]*sharealyzer.Scooter, len(res.Scooters))
+	for i, circScooter := range res.Scooters {
+		// circ hides rented scooters, so visible scooters are never in use
+		state := sharealyzer.IdleRentable
+		if circScooter.Broken {
+			state = sharealyzer.Broken
+		} else if circScooter.Missing {
+			state = sharealyzer.Missing
+		}
+		sc[i] = &sharealyzer.Scooter{
+			ID:                   circScooter.Identifier,
+			Provider:             "circ",
+			State:                state,
+			Location:             sharealyzer.NewGeoLocation(circScooter.Latitude, circScooter.Longitude),
+			ChargeLevel:          float64(circScooter.EnergyLevel),
+			LastUpdate:           res.ScrapeDate(),
+			QRContent:            circScooter.QrCode,
+			StateUpdatedByUserID: circScooter.StateUpdatedByUserIdentifier,
+			StateUpdatedAt:       time.Unix(0, int64(circScooter.StateUpdateAt)*int64(time.Millisecond)),
+			InitPrice:            circScooter.InitPrice,
+			UnitPrice:            circScooter.Price,
+			LocationAge:          circScooter.LocationAge(res.Date),
+			Zone:                 circScooter.ZoneIdentifier,
+		}
+	}
+	return sharealyzer.NewScrapeResult("circ", res.Date, sc)
+}
+
+// LocationAge returns how old the GPS fix was when the scooter reported its state. Scooters without
+// timestamp are compared to the scrape date, scooters without GPS update time have an unknown age of 0.
+func (s *Scooter) LocationAge(scrapeDate time.Time) time.Duration {
+	if s.LastGnssUpdate == 0 {
+		return 0
+	}
+	reported := scrapeDate
+	if timestamp, err := time.Parse(time.RFC3339, s.Timestamp); err == nil {
+		reported = timestamp
+	}
+	age := reported.Sub(time.Unix(0, int64(s.LastGnssUpdate)*int64(time.Millisecond)))
+	if age < 0 {
+		return 0
+	}
+	return age
+}
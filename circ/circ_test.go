@@ -0,0 +1,70 @@
+package circ
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScooterLocationAge(t *testing.T) {
+	scrapeDate := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	millis := func(date time.Time) uint64 {
+		return uint64(date.UnixNano() / int64(time.Millisecond))
+	}
+
+	scooter := &Scooter{
+		LastGnssUpdate: millis(scrapeDate.Add(-time.Hour)),
+		Timestamp:      scrapeDate.Add(-10 * time.Minute).Format(time.RFC3339),
+	}
+	assert.Equal(t, 50*time.Minute, scooter.LocationAge(scrapeDate))
+	res := &ScrapeResult{Date: scrapeDate, Scooters: []*Scooter{scooter}}
+	assert.Equal(t, 50*time.Minute, res.Generic().Scooters()[0].LocationAge)
+
+	// The scrape date is used without timestamp
+	scooter.Timestamp = ""
+	assert.Equal(t, time.Hour, scooter.LocationAge(scrapeDate))
+
+	// GPS fixes from the future are fresh
+	scooter.LastGnssUpdate = millis(scrapeDate.Add(time.Minute))
+	assert.Equal(t, time.Duration(0), scooter.LocationAge(scrapeDate))
+
+	// The age is unknown without GPS update time
+	assert.Equal(t, time.Duration(0), (&Scooter{}).LocationAge(scrapeDate))
+}
+
+func TestGenericScooterStates(t *testing.T) {
+	res := &ScrapeResult{Date: time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC), Scooters: []*Scooter{
+		{Identifier: "idle"},
+		{Identifier: "broken", Broken: true},
+		{Identifier: "missing", Missing: true},
+		{Identifier: "both", Broken: true, Missing: true},
+	}}
+	var states []sharealyzer.ScooterState
+	for _, scooter := range res.Generic().Scooters() {
+		states = append(states, scooter.State)
+	}
+	assert.Equal(t, []sharealyzer.ScooterState{sharealyzer.IdleRentable, sharealyzer.Broken, sharealyzer.Missing,
+		sharealyzer.Broken}, states)
+}
+
+func TestTripAggregator(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	parked := &Scooter{Identifier: "a", Latitude: 51.51, Longitude: 7.46, EnergyLevel: 80, InitPrice: 100, Price: 20}
+	moved := &Scooter{Identifier: "a", Latitude: 51.52, Longitude: 7.47, EnergyLevel: 70, InitPrice: 100, Price: 20}
+	in := make(chan *ScrapeResult, 3)
+	in <- &ScrapeResult{Date: start, Scooters: []*Scooter{parked}}
+	in <- &ScrapeResult{Date: start.Add(time.Minute), Scooters: []*Scooter{}}
+	in <- &ScrapeResult{Date: start.Add(11 * time.Minute), Scooters: []*Scooter{moved}}
+	close(in)
+
+	var trips []*sharealyzer.Trip
+	for trip := range NewTripAggregator().Aggregate(in) {
+		trips = append(trips, trip)
+	}
+	assert.Len(t, trips, 1)
+	assert.Equal(t, "a", trips[0].ScooterID)
+	assert.Equal(t, 10*time.Minute, trips[0].Duration)
+	assert.Equal(t, sharealyzer.TripID("circ", "a", start.Add(time.Minute)), trips[0].ID)
+}
@@ -0,0 +1,148 @@
+package circtest
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+// ArchiveOptions describe a synthetic fleet and how often it is scraped
+type ArchiveOptions struct {
+	// Scooters is the size of the fleet
+	Scooters int
+	// From is the date of the first scrape, its zone is used in the file names
+	From time.Time
+	// Files is the number of scrapes
+	Files int
+	// Interval is the time between two scrapes
+	Interval time.Duration
+	// TripProbability is the chance of an available scooter to go on a trip between two scrapes
+	TripProbability float64
+	// Seed makes the generated fleet reproducible
+	Seed int64
+	// Format of the written scrape files, defaults to archive.FormatJSON
+	Format archive.Format
+}
+
+// DefaultArchiveOptions describe a day of scrapes every minute of a fleet of 500 scooters in Dortmund
+func DefaultArchiveOptions() ArchiveOptions {
+	return ArchiveOptions{
+		Scooters:        500,
+		From:            time.Date(2019, 10, 6, 0, 0, 0, 0, time.FixedZone("CET", 3600)),
+		Files:           24 * 60,
+		Interval:        time.Minute,
+		TripProbability: 0.005,
+		Seed:            1,
+		Format:          archive.FormatJSON,
+	}
+}
+
+var zones = []string{"dortmund-center", "dortmund-north", "dortmund-south"}
+
+type simulatedScooter struct {
+	scooter *circ.Scooter
+	// tripScrapes is the number of scrapes until the scooter is available again, 0 if it is available
+	tripScrapes int
+}
+
+// GenerateFleet simulates the fleet and calls fn with the available scooters of every scrape. Scooters on a
+// trip are missing and show up again with less energy at a different position. The scooters passed to fn
+// are only valid until fn returns.
+func GenerateFleet(opts ArchiveOptions, fn func(date time.Time, scooters []*circ.Scooter) error) error {
+	random := rand.New(rand.NewSource(opts.Seed))
+	fleet := make([]*simulatedScooter, opts.Scooters)
+	for i := range fleet {
+		fleet[i] = &simulatedScooter{scooter: &circ.Scooter{
+			Identifier:        fmt.Sprintf("SCO-%05d", i),
+			QrCode:            fmt.Sprintf("QR%05d", i),
+			Name:              fmt.Sprintf("Scooter %d", i),
+			Currency:          "EUR",
+			Partner:           "circ",
+			Type:              "scooter",
+			State:             "active",
+			ZoneIdentifier:    zones[i%len(zones)],
+			EnergyLevel:       50 + random.Intn(51),
+			InitPrice:         100,
+			Price:             15,
+			Latitude:          51.475 + random.Float64()*0.107,
+			Longitude:         7.326 + random.Float64()*0.232,
+			StateUpdateAt:     uint64(opts.From.UnixNano() / int64(time.Millisecond)),
+			Actions:           []string{"ring", "unlock"},
+			GpsRefreshRate:    60,
+			StatusRefreshRate: 60,
+		}}
+	}
+
+	available := make([]*circ.Scooter, 0, opts.Scooters)
+	for file := 0; file < opts.Files; file++ {
+		date := opts.From.Add(time.Duration(file) * opts.Interval)
+		available = available[:0]
+		for _, s := range fleet {
+			if s.tripScrapes > 0 {
+				s.tripScrapes--
+				if s.tripScrapes > 0 {
+					continue
+				}
+				// The trip is over, the scooter is somewhere else with less energy
+				s.scooter.Latitude = s.scooter.Latitude + (random.Float64()-0.5)*0.02
+				s.scooter.Longitude = s.scooter.Longitude + (random.Float64()-0.5)*0.03
+				s.scooter.EnergyLevel = s.scooter.EnergyLevel - 1 - random.Intn(10)
+				if s.scooter.EnergyLevel < 10 {
+					s.scooter.EnergyLevel = 100
+				}
+				s.scooter.StateUpdateAt = uint64(date.UnixNano() / int64(time.Millisecond))
+				s.scooter.StateUpdatedByUserIdentifier = fmt.Sprintf("user-%d", random.Intn(opts.Scooters*4+1))
+			} else if file > 0 && random.Float64() < opts.TripProbability {
+				s.tripScrapes = 5 + random.Intn(26)
+				continue
+			}
+			s.scooter.LastGnssUpdate = uint64(date.UnixNano() / int64(time.Millisecond))
+			s.scooter.Timestamp = date.Format(time.RFC3339)
+			available = append(available, s.scooter)
+		}
+		if err := fn(date, available); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteArchive writes the scrapes of a simulated fleet into baseDir, laid out like the scraper does, and
+// returns the dates of the written files
+func WriteArchive(baseDir string, opts ArchiveOptions) ([]time.Time, error) {
+	format := opts.Format
+	if format == "" {
+		format = archive.FormatJSON
+	}
+	var dates []time.Time
+	err := GenerateFleet(opts, func(date time.Time, scooters []*circ.Scooter) error {
+		dayFolder := filepath.Join(baseDir, "circ_"+date.Format("2006-01-02"))
+		if err := os.MkdirAll(dayFolder, 0770); err != nil {
+			return err
+		}
+		f, err := os.Create(filepath.Join(dayFolder, "circ_"+date.Format(time.RFC3339)+".json.gz"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := archive.NewGzipWriter(f, gzip.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		if err := archive.Encode(w, scooters, format); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		dates = append(dates, date)
+		return f.Close()
+	})
+	return dates, err
+}
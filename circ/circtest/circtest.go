@@ -0,0 +1,234 @@
+// Package circtest provides a fake circ API server serving a configurable fleet and the phone
+// authentication flow, so Client and Scraper can be tested end to end
+package circtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/providertest"
+)
+
+const (
+	// DefaultCode is the SMS code the server accepts by default
+	DefaultCode = "1234"
+
+	// Paths of the circ API endpoints served by the server
+	LoginPath        = "/verification/phone/start"
+	SignupPath       = "/signup/phone"
+	TokenRefreshPath = "/login/refresh"
+	DevicesPath      = "/devices"
+	ProfilePath      = "/user/profile"
+	RidesPath        = "/user/rides"
+)
+
+// Server is a fake circ API
+type Server struct {
+	*providertest.Server
+
+	// Code is the SMS code expected during login
+	Code string
+	// MaxDevices limits the number of devices per response, the total is still reported, 0 means unlimited
+	MaxDevices int
+	// TokenLifetime is the lifetime of issued access tokens
+	TokenLifetime time.Duration
+
+	lock         sync.Mutex
+	scooters     []*circ.Scooter
+	profile      circ.Profile
+	rides        []*circ.Ride
+	accessToken  string
+	refreshToken string
+	tokenSerial  int
+}
+
+// NewServer creates and starts a fake circ API server. Close it after use.
+func NewServer() *Server {
+	s := &Server{
+		Server:        providertest.NewServer(),
+		Code:          DefaultCode,
+		TokenLifetime: time.Hour,
+		profile:       circ.Profile{Identifier: "circtest"},
+	}
+	s.Handle(LoginPath, s.handleLogin)
+	s.Handle(SignupPath, s.handleSignup)
+	s.Handle(TokenRefreshPath, s.handleRefresh)
+	s.Handle(DevicesPath, s.handleDevices)
+	s.Handle(ProfilePath, s.handleProfile)
+	s.Handle(RidesPath, s.handleRides)
+	return s
+}
+
+// Client creates a circ client talking to this server
+func (s *Server) Client(opts ...circ.ClientOption) *circ.Client {
+	return circ.New(append([]circ.ClientOption{circ.WithBaseURL(s.URL)}, opts...)...)
+}
+
+// AuthenticatedClient creates a circ client talking to this server, which is seeded with freshly
+// issued tokens and doesn't need to login
+func (s *Server) AuthenticatedClient(opts ...circ.ClientOption) *circ.Client {
+	accessToken, refreshToken := s.IssueTokens()
+	return s.Client(append(opts, circ.WithTokens(accessToken, refreshToken))...)
+}
+
+// SetScooters sets the fleet served by the devices endpoint
+func (s *Server) SetScooters(scooters ...*circ.Scooter) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.scooters = scooters
+}
+
+// SetProfile sets the profile of the account
+func (s *Server) SetProfile(profile circ.Profile) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.profile = profile
+}
+
+// SetRides sets the ride history of the account
+func (s *Server) SetRides(rides ...*circ.Ride) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rides = rides
+}
+
+// IssueTokens issues a new pair of valid tokens, i.e. to prepare a token store
+func (s *Server) IssueTokens() (accessToken, refreshToken string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.issueTokens()
+}
+
+// RevokeTokens invalidates the current tokens, so the client needs to login again
+func (s *Server) RevokeTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.accessToken = ""
+	s.refreshToken = ""
+}
+
+// issueTokens needs to be called with the lock held
+func (s *Server) issueTokens() (string, string) {
+	s.tokenSerial++
+	exp := time.Now().Add(s.TokenLifetime).Unix()
+	payload := fmt.Sprintf(`{"sub":"circtest","serial":%d,"exp":%d}`, s.tokenSerial, exp)
+	s.accessToken = "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+	s.refreshToken = "refresh-" + strconv.Itoa(s.tokenSerial)
+	return s.accessToken, s.refreshToken
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	providertest.WriteJSON(w, status, circ.CircError{
+		Timestamp: time.Now(),
+		Status:    status,
+		Err:       http.StatusText(status),
+		Message:   message,
+		Path:      r.URL.Path,
+	})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["phoneNumber"] == "" {
+		writeError(w, r, http.StatusBadRequest, "Phone number missing")
+		return
+	}
+	providertest.WriteJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (s *Server) handleSignup(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["token"] != s.Code {
+		writeError(w, r, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	s.lock.Lock()
+	accessToken, refreshToken := s.issueTokens()
+	profile := s.profile
+	s.lock.Unlock()
+	providertest.WriteJSON(w, http.StatusOK, circ.AuthResponse{
+		Profile:      profile,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	json.NewDecoder(r.Body).Decode(&req)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.refreshToken == "" || req["refreshToken"] != s.refreshToken {
+		writeError(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	accessToken, refreshToken := s.issueTokens()
+	providertest.WriteJSON(w, http.StatusOK, circ.TokenRefreshResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// authorized needs to be called with the lock held. It writes an error response if the request does not
+// carry the current access token.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.accessToken == "" || r.Header.Get("Authorization") != s.accessToken {
+		writeError(w, r, http.StatusUnauthorized, "Invalid access token")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.authorized(w, r) {
+		providertest.WriteJSON(w, http.StatusOK, s.profile)
+	}
+}
+
+func (s *Server) handleRides(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.authorized(w, r) {
+		rides := s.rides
+		if rides == nil {
+			rides = make([]*circ.Ride, 0)
+		}
+		providertest.WriteJSON(w, http.StatusOK, map[string]interface{}{"rides": rides})
+	}
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.authorized(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	param := func(name string) float64 {
+		f, _ := strconv.ParseFloat(q.Get(name), 64)
+		return f
+	}
+	inArea := make([]*circ.Scooter, 0)
+	for _, scooter := range s.scooters {
+		if scooter.Latitude <= param("latitudeTopLeft") && scooter.Latitude >= param("latitudeBottomRight") &&
+			scooter.Longitude >= param("longitudeTopLeft") && scooter.Longitude <= param("longitudeBottomRight") {
+			inArea = append(inArea, scooter)
+		}
+	}
+	devices := inArea
+	if s.MaxDevices > 0 && len(devices) > s.MaxDevices {
+		devices = devices[:s.MaxDevices]
+	}
+	providertest.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"devices": devices,
+		"total":   len(inArea),
+	})
+}
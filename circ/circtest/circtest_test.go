@@ -0,0 +1,208 @@
+package circtest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/providertest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fleet = []*circ.Scooter{
+	{Identifier: "a", Latitude: 51.5, Longitude: 7.4},
+	{Identifier: "b", Latitude: 51.52, Longitude: 7.45},
+	{Identifier: "outside", Latitude: 52.5, Longitude: 13.4},
+}
+
+func TestScraperLogsInAndScrapes(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+
+	codes := 0
+	scraper := circ.NewScraper(server.Client(), 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scraper.CodeProvider = circ.CodeProviderFunc(func() (string, error) {
+		codes++
+		return DefaultCode, nil
+	})
+
+	scooters, err := scraper.ScrapeOnce()
+	require.NoError(t, err)
+	assert.Len(t, scooters, 2)
+	assert.Equal(t, 1, codes)
+	assert.Equal(t, 1, server.Requests(SignupPath))
+}
+
+func TestClientBacksOffOnRateLimit(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+	server.MaxDevices = 1
+
+	client := server.AuthenticatedClient()
+	server.RateLimit(DevicesPath, 0)
+
+	scraper := circ.NewScraper(client, 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scooters, err := scraper.ScrapeOnce()
+	require.NoError(t, err)
+	assert.Len(t, scooters, 2)
+	assert.Equal(t, 0, server.Requests(SignupPath))
+}
+
+func TestScraperLogsInAgainWhenRefreshTokenExpired(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+	server.TokenLifetime = time.Minute
+
+	accessToken, refreshToken := server.IssueTokens()
+	server.RevokeTokens()
+	server.TokenLifetime = time.Hour
+	client := server.Client(circ.WithTokens(accessToken, refreshToken))
+
+	scraper := circ.NewScraper(client, 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scraper.CodeProvider = circ.CodeProviderFunc(func() (string, error) {
+		return DefaultCode, nil
+	})
+	scooters, err := scraper.ScrapeOnce()
+	require.NoError(t, err)
+	assert.Len(t, scooters, 2)
+	assert.Equal(t, 1, server.Requests(TokenRefreshPath))
+	assert.Equal(t, 1, server.Requests(SignupPath))
+}
+
+func TestScraperDoesNotLoginOnOtherClientErrors(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+	server.InjectFailure(providertest.Failure{Path: DevicesPath, Status: http.StatusNotFound,
+		Body: `{"status":404,"error":"Not Found","message":"No message available","path":"/devices"}`})
+
+	scraper := circ.NewScraper(server.AuthenticatedClient(), 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scraper.CodeProvider = circ.CodeProviderFunc(func() (string, error) {
+		t.Fatal("The scraper must not login again")
+		return "", nil
+	})
+	_, err := scraper.ScrapeOnce()
+	require.Error(t, err)
+	circErr, ok := errors.Cause(err).(circ.CircError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, circErr.Status)
+	assert.False(t, circ.IsAuthError(circErr))
+	assert.Equal(t, 0, server.Requests(LoginPath))
+}
+
+func TestScrapeSkipsFailedScrapes(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+	server.InjectFailure(providertest.Failure{Path: DevicesPath, Status: http.StatusInternalServerError,
+		Body: `{"status":500,"error":"Internal Server Error","message":"No message available","path":"/devices"}`})
+
+	scraper := circ.NewScraper(server.AuthenticatedClient(), 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := scraper.Scrape(ctx, time.Millisecond*10)
+	select {
+	case res := <-results:
+		assert.Len(t, res.Scooters, 2)
+	case <-time.After(time.Second * 5):
+		t.Fatal("The scraper stopped after a failed scrape")
+	}
+	assert.Equal(t, 2, server.Requests(DevicesPath))
+}
+
+func TestAccountEndpoints(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetProfile(circ.Profile{
+		Identifier: "me",
+		Statistic:  []circ.Statistic{{Unit: "km", Value: "42.5", Measurement: "distance"}},
+	})
+	server.SetRides(&circ.Ride{Identifier: "ride", DeviceIdentifier: "a", StartedAt: 1570366800000})
+
+	client := server.AuthenticatedClient()
+
+	statistics, err := client.Statistics()
+	require.NoError(t, err)
+	assert.Equal(t, "42.5", statistics[0].Value)
+
+	rides, err := client.Rides()
+	require.NoError(t, err)
+	require.Len(t, rides, 1)
+	assert.Equal(t, time.Unix(1570366800, 0), rides[0].StartTime())
+}
+
+func TestScrapeDeadline(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := server.AuthenticatedClient(circ.WithTimeout(time.Millisecond * 100))
+	server.RateLimit(DevicesPath, time.Second)
+
+	scraper := circ.NewScraper(client, 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scraper.ScrapeDeadline = time.Millisecond * 500
+	start := time.Now()
+	_, err := scraper.ScrapeOnce()
+	assert.Equal(t, circ.ErrScrapeDeadline, err)
+	// Backing off is cut short at the deadline
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRateLimitsDoNotUseUpRetries(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetScooters(fleet...)
+	for i := 0; i < 8; i++ {
+		server.RateLimit(DevicesPath, 0)
+	}
+
+	scraper := circ.NewScraper(server.AuthenticatedClient(), 51.6, 7.3, 51.4, 7.6, "+49", "1701234567")
+	scraper.ScrapeDeadline = time.Minute
+	scooters, err := scraper.ScrapeOnce()
+	require.NoError(t, err)
+	assert.Len(t, scooters, 2)
+	assert.Equal(t, 9, server.Requests(DevicesPath))
+}
+
+func TestWriteArchive(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "synth")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	opts := DefaultArchiveOptions()
+	opts.Scooters = 50
+	opts.Files = 30
+	opts.TripProbability = 0.1
+	dates, err := WriteArchive(baseDir, opts)
+	require.NoError(t, err)
+	require.Len(t, dates, 30)
+
+	var first []int
+	err = GenerateFleet(opts, func(date time.Time, scooters []*circ.Scooter) error {
+		first = append(first, len(scooters))
+		return nil
+	})
+	require.NoError(t, err)
+	var second []int
+	err = GenerateFleet(opts, func(date time.Time, scooters []*circ.Scooter) error {
+		second = append(second, len(scooters))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 50, first[0])
+	assert.True(t, first[len(first)-1] < 50, "Some scooters should be on a trip")
+
+	res, err := circ.ReadScrapeFile(filepath.Join(baseDir, "circ_2019-10-06", "circ_2019-10-06T00:29:00+01:00.json.gz"))
+	require.NoError(t, err)
+	assert.Len(t, res.Scooters, first[29])
+}
@@ -0,0 +1,230 @@
+package circ
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultCodeTimeout is how long the polling CodeProviders wait for the SMS code by default
+	DefaultCodeTimeout = time.Minute * 10
+	// DefaultCodePollInterval is the interval in which the polling CodeProviders check for the SMS code by default
+	DefaultCodePollInterval = time.Second * 5
+
+	// ErrCodeTimeout is returned if no SMS code was provided in time
+	ErrCodeTimeout = errors.New("Timed out waiting for SMS code")
+
+	smsCodeRegex = regexp.MustCompile(`\b([0-9]{4,8})\b`)
+)
+
+// CodeProvider provides the SMS code received during authentication
+type CodeProvider interface {
+	Code() (string, error)
+}
+
+// CodeProviderFunc lets you use a simple function as CodeProvider
+type CodeProviderFunc func() (string, error)
+
+// Code calls the function
+func (f CodeProviderFunc) Code() (string, error) {
+	return f()
+}
+
+// poll calls check every interval until it returns a code or an error, or the timeout elapses
+func poll(timeout, interval time.Duration, check func() (string, error)) (string, error) {
+	if timeout == 0 {
+		timeout = DefaultCodeTimeout
+	}
+	if interval == 0 {
+		interval = DefaultCodePollInterval
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		code, err := check()
+		if err != nil {
+			return "", err
+		}
+		if code != "" {
+			return code, nil
+		}
+		time.Sleep(interval)
+	}
+	return "", ErrCodeTimeout
+}
+
+// StdinCodeProvider prompts for the SMS code on the terminal
+type StdinCodeProvider struct {
+	In io.Reader
+}
+
+// Code prompts for the code and reads it from stdin
+func (s *StdinCodeProvider) Code() (string, error) {
+	in := s.In
+	if in == nil {
+		in = os.Stdin
+	}
+	fmt.Print("Please enter SMS code: ")
+	code, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	fmt.Println("Thank you")
+	return strings.TrimSpace(code), nil
+}
+
+// FileCodeProvider waits for the SMS code to be written to a file and consumes it
+type FileCodeProvider struct {
+	Path         string
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// Code waits for the file to appear and removes it after reading the code
+func (f *FileCodeProvider) Code() (string, error) {
+	log.Printf("Waiting for SMS code in %s", f.Path)
+	return poll(f.Timeout, f.PollInterval, func() (string, error) {
+		data, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			return "", nil
+		}
+		os.Remove(f.Path)
+		return strings.TrimSpace(string(data)), nil
+	})
+}
+
+// HTTPCodeProvider polls an HTTP endpoint until it responds with the SMS code, i.e. a webhook receiver
+// of an SMS gateway. Responses with a status other than 200 or an empty body are treated as not yet available.
+type HTTPCodeProvider struct {
+	URL          string
+	Timeout      time.Duration
+	PollInterval time.Duration
+	HTTPClient   *http.Client
+}
+
+// Code polls the endpoint for the SMS code
+func (h *HTTPCodeProvider) Code() (string, error) {
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	log.Printf("Waiting for SMS code from %s", h.URL)
+	return poll(h.Timeout, h.PollInterval, func() (string, error) {
+		resp, err := client.Get(h.URL)
+		if err != nil {
+			log.Printf("[WARNING] Failed to poll SMS code: %s", err)
+			return "", nil
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", nil
+		}
+		return strings.TrimSpace(string(body)), nil
+	})
+}
+
+// TelegramCodeProvider asks for the SMS code via a Telegram bot and waits for a reply in the given chat
+type TelegramCodeProvider struct {
+	BotToken   string
+	ChatID     int64
+	Timeout    time.Duration
+	HTTPClient *http.Client
+	apiURL     string
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Date int64 `json:"date"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+func (t *TelegramCodeProvider) call(method string, payload, result interface{}) error {
+	client := t.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	apiURL := t.apiURL
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(payload); err != nil {
+		return err
+	}
+	resp, err := client.Post(fmt.Sprintf("%s/bot%s/%s", apiURL, url.PathEscape(t.BotToken), method),
+		"application/json", buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	apiResponse := struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+		return err
+	}
+	if !apiResponse.OK {
+		return fmt.Errorf("Telegram API call %s failed: %s", method, apiResponse.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(apiResponse.Result, result)
+}
+
+// Code sends a message asking for the SMS code and waits for a reply containing a code
+func (t *TelegramCodeProvider) Code() (string, error) {
+	if err := t.call("sendMessage", map[string]interface{}{
+		"chat_id": t.ChatID,
+		"text":    "Please reply with the SMS code sent by Circ",
+	}, nil); err != nil {
+		return "", errors.Wrap(err, "Failed to ask for SMS code via Telegram")
+	}
+	asked := time.Now().Unix()
+	var offset int64
+	// Telegram long polls getUpdates itself, so no additional interval is necessary
+	return poll(t.Timeout, time.Millisecond, func() (string, error) {
+		var updates []telegramUpdate
+		if err := t.call("getUpdates", map[string]interface{}{
+			"offset":  offset,
+			"timeout": 30,
+		}, &updates); err != nil {
+			log.Printf("[WARNING] Failed to poll Telegram updates: %s", err)
+			time.Sleep(DefaultCodePollInterval)
+			return "", nil
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Chat.ID != t.ChatID || update.Message.Date < asked {
+				continue
+			}
+			if matches := smsCodeRegex.FindStringSubmatch(update.Message.Text); matches != nil {
+				return matches[1], nil
+			}
+		}
+		return "", nil
+	})
+}
@@ -0,0 +1,59 @@
+package circ
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCodeProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "code")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	provider := &FileCodeProvider{
+		Path:         filepath.Join(dir, "code"),
+		Timeout:      time.Second,
+		PollInterval: time.Millisecond * 10,
+	}
+	_, err = provider.Code()
+	assert.Equal(t, ErrCodeTimeout, err)
+
+	require.NoError(t, ioutil.WriteFile(provider.Path, []byte("1234\n"), 0600))
+	code, err := provider.Code()
+	require.NoError(t, err)
+	assert.Equal(t, "1234", code)
+	_, err = os.Stat(provider.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTelegramCodeProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.URL.Path, "/botbot-token/"))
+		var result interface{} = true
+		if strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			result = []map[string]interface{}{
+				{"update_id": 1, "message": map[string]interface{}{
+					"date": time.Now().Unix(), "chat": map[string]int64{"id": 23}, "text": "Code is 5678"}},
+				{"update_id": 2, "message": map[string]interface{}{
+					"date": time.Now().Unix(), "chat": map[string]int64{"id": 42}, "text": "Code is 1234"}},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+	}))
+	defer server.Close()
+
+	provider := &TelegramCodeProvider{BotToken: "bot-token", ChatID: 42, Timeout: time.Second, apiURL: server.URL}
+	code, err := provider.Code()
+	require.NoError(t, err)
+	assert.Equal(t, "1234", code)
+}
@@ -0,0 +1,151 @@
+package circ
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	keySize          = 32
+	pbkdf2Iterations = 200000
+)
+
+// EncryptedFileTokenStore is a TokenStore which saves the auth tokens AES-GCM encrypted in a file. Either
+// specify a Passphrase, from which the key is derived via PBKDF2, or a KeyFile containing a 32 byte key.
+type EncryptedFileTokenStore struct {
+	Path       string
+	Passphrase string
+	KeyFile    string
+}
+
+type encryptedTokenData struct {
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (e *EncryptedFileTokenStore) key(salt []byte) ([]byte, error) {
+	if e.KeyFile != "" {
+		key, err := ioutil.ReadFile(e.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != keySize {
+			return nil, errors.New("Key file needs to contain exactly 32 bytes")
+		}
+		return key, nil
+	}
+	if e.Passphrase == "" {
+		return nil, errors.New("Neither passphrase nor key file specified")
+	}
+	return pbkdf2SHA256([]byte(e.Passphrase), salt, pbkdf2Iterations), nil
+}
+
+// pbkdf2SHA256 derives a key of keySize bytes as specified in RFC 8018. Since a single block of
+// HMAC-SHA256 output is exactly keySize bytes, only the first block needs to be calculated.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blockIndex := make([]byte, 4)
+	binary.BigEndian.PutUint32(blockIndex, 1)
+	prf.Write(salt)
+	prf.Write(blockIndex)
+	u := prf.Sum(nil)
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// Store encrypts the tokens and stores them in the file
+func (e *EncryptedFileTokenStore) Store(accessToken, refreshToken string) error {
+	plaintext, err := json.Marshal(&tokenData{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	data := &encryptedTokenData{}
+	if e.KeyFile == "" {
+		data.Salt = make([]byte, 16)
+		if _, err := rand.Read(data.Salt); err != nil {
+			return err
+		}
+	}
+	key, err := e.key(data.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	data.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(data.Nonce); err != nil {
+		return err
+	}
+	data.Ciphertext = gcm.Seal(nil, data.Nonce, plaintext, nil)
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(e.Path, content, 0600)
+}
+
+// Load reads and decrypts the tokens from the file
+func (e *EncryptedFileTokenStore) Load() (accessToken string, refreshToken string, err error) {
+	content, err := ioutil.ReadFile(e.Path)
+	if err != nil {
+		return
+	}
+	var data encryptedTokenData
+	if err = json.Unmarshal(content, &data); err != nil {
+		return
+	}
+	key, err := e.key(data.Salt)
+	if err != nil {
+		return
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return
+	}
+	plaintext, err := gcm.Open(nil, data.Nonce, data.Ciphertext, nil)
+	if err != nil {
+		return "", "", errors.New("Failed to decrypt tokens, wrong passphrase or key?")
+	}
+	var tokens tokenData
+	if err = json.Unmarshal(plaintext, &tokens); err != nil {
+		return
+	}
+	return tokens.AccessToken, tokens.RefreshToken, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,45 @@
+package circ
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPBKDF2(t *testing.T) {
+	key := pbkdf2SHA256([]byte("password"), []byte("salt"), 4096)
+	assert.Equal(t, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a", hex.EncodeToString(key))
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := &EncryptedFileTokenStore{
+		Path:       filepath.Join(dir, "tokens"),
+		Passphrase: "secret",
+	}
+	require.NoError(t, store.Store("access", "refresh"))
+
+	content, err := ioutil.ReadFile(store.Path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "access")
+
+	accessToken, refreshToken, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+	assert.Equal(t, "refresh", refreshToken)
+
+	wrongStore := &EncryptedFileTokenStore{
+		Path:       store.Path,
+		Passphrase: "wrong",
+	}
+	_, _, err = wrongStore.Load()
+	assert.Error(t, err)
+}
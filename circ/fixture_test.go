@@ -0,0 +1,26 @@
+package circ
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/providertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRecordedDevices(t *testing.T) {
+	recorder, err := providertest.NewRecorder(providertest.ModeReplay, "testdata/devices.json")
+	require.NoError(t, err)
+	c := New(WithHTTPClient(recorder.Client()))
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`), "refresh")
+
+	scooters, err := c.Scooters(51.582780, 7.325945, 51.475727, 7.558172)
+	require.NoError(t, err)
+	require.Len(t, scooters, 1)
+	assert.Equal(t, "2e0c7f24-61b1-4a0a-9d0c-3d4f5a6b7c8d", scooters[0].Identifier)
+	assert.Equal(t, 87, scooters[0].EnergyLevel)
+	assert.Equal(t, uint64(1570366800000), scooters[0].StateUpdateAt)
+	assert.Equal(t, "dortmund", scooters[0].ZoneIdentifier)
+}
@@ -0,0 +1,80 @@
+//go:build go1.18
+// +build go1.18
+
+package circ
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+func FuzzExtractDateFromFilename(f *testing.F) {
+	f.Add("circ_2019-10-08T05:11:27+01:00.json.gz")
+	f.Add("circ_2019-10-08T04:11:27Z.json.gz")
+	f.Add("circ_.json.gz")
+	f.Add("index.jsonl")
+	f.Fuzz(func(t *testing.T, name string) {
+		date, offset, err := extractDateFromFilename(name)
+		if err != nil {
+			return
+		}
+		if date.Location() != time.UTC {
+			t.Errorf("Date %s of %s is not in UTC", date, name)
+		}
+		if offset <= -24*3600 || offset >= 24*3600 {
+			t.Errorf("Offset %d of %s is out of range", offset, name)
+		}
+	})
+}
+
+func FuzzDecodeScooters(f *testing.F) {
+	f.Add([]byte(`[{"identifier":"a","latitude":51.5,"longitude":7.4,"energyLevel":80}]`))
+	f.Add([]byte("{\"identifier\":\"a\"}\n{\"identifier\":\"b\"}\n"))
+	f.Add([]byte(`[{"identifier":"a","latitude":"north"}]`))
+	f.Add([]byte(`[null]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		scooters, err := decodeScooters(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, scooter := range scooters {
+			if scooter == nil {
+				t.Errorf("Decoded nil scooter from %q", data)
+			}
+		}
+	})
+}
+
+func FuzzDecodeDevices(f *testing.F) {
+	var interactions []struct {
+		Response struct {
+			Body string `json:"body"`
+		} `json:"response"`
+	}
+	if data, err := ioutil.ReadFile("testdata/devices.json"); err == nil && json.Unmarshal(data, &interactions) == nil {
+		for _, interaction := range interactions {
+			f.Add([]byte(interaction.Response.Body))
+		}
+	}
+	f.Add([]byte(`{"devices":[],"total":0}`))
+	f.Add([]byte(`{"devices":[{"identifier":"a","lat":51.5}],"total":1}`))
+	f.Add([]byte(`{"devices":[null,1],"total":"many"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, mode := range []sharealyzer.DecodeMode{sharealyzer.DecodeLenient, sharealyzer.DecodeStrict} {
+			devices, _, err := decodeDevices(body, NewScooterDecoder(mode))
+			if err != nil {
+				continue
+			}
+			for _, device := range devices {
+				if device == nil {
+					t.Errorf("Decoded nil device from %q", body)
+				}
+			}
+		}
+	})
+}
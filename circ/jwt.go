@@ -0,0 +1,32 @@
+package circ
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// TokenRefreshMargin is how long before the expiry of the access token we refresh it
+var TokenRefreshMargin = time.Minute * 2
+
+// jwtExpiry extracts the expiry date from the exp claim of a JWT. The signature is not verified, we only
+// need to know when the API will stop accepting the token.
+func jwtExpiry(token string) (time.Time, bool) {
+	token = strings.TrimPrefix(token, "Bearer ")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	claims := struct {
+		Exp *int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*claims.Exp, 0), true
+}
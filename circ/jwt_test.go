@@ -0,0 +1,38 @@
+package circ
+
+import (
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testToken(payload string) string {
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestJWTExpiry(t *testing.T) {
+	expiry, ok := jwtExpiry(testToken(`{"sub":"123","exp":1571234567}`))
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1571234567, 0), expiry)
+
+	expiry, ok = jwtExpiry("Bearer " + testToken(`{"exp":1571234567}`))
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1571234567, 0), expiry)
+
+	_, ok = jwtExpiry(testToken(`{"sub":"123"}`))
+	assert.False(t, ok)
+	_, ok = jwtExpiry("not-a-jwt")
+	assert.False(t, ok)
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	c := New()
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`), "refresh")
+	assert.False(t, c.needsRefresh())
+
+	c.setTokens(testToken(`{"exp":`+strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)+`}`), "refresh")
+	assert.True(t, c.needsRefresh())
+}
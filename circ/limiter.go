@@ -0,0 +1,103 @@
+package circ
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultMaxLoginAttempts is how many SMS logins a LoginLimiter allows within its window by default
+	DefaultMaxLoginAttempts = 3
+	// DefaultLoginWindow is the window in which a LoginLimiter counts SMS logins by default
+	DefaultLoginWindow = time.Hour * 6
+)
+
+// LoginCooldownError is returned by Login if too many logins were attempted recently
+type LoginCooldownError struct {
+	Until time.Time
+}
+
+func (l *LoginCooldownError) Error() string {
+	return fmt.Sprintf("Too many login attempts, waiting until %s before requesting another SMS code",
+		l.Until.Format(time.RFC3339))
+}
+
+// LoginLimiter tracks SMS login attempts in a file, usually next to the persisted tokens, and refuses
+// further logins if MaxAttempts logins were attempted within Window. This keeps a scraper stuck in an
+// auth loop from triggering the SMS abuse protection of the provider, even across restarts.
+type LoginLimiter struct {
+	Path        string
+	MaxAttempts int
+	Window      time.Duration
+
+	lock sync.Mutex
+}
+
+func (l *LoginLimiter) limits() (int, time.Duration) {
+	maxAttempts, window := l.MaxAttempts, l.Window
+	if maxAttempts == 0 {
+		maxAttempts = DefaultMaxLoginAttempts
+	}
+	if window == 0 {
+		window = DefaultLoginWindow
+	}
+	return maxAttempts, window
+}
+
+// attempts loads the attempts within the window, the caller needs to hold the lock
+func (l *LoginLimiter) attempts(now time.Time) ([]time.Time, error) {
+	data, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var attempts []time.Time
+	if err := json.Unmarshal(data, &attempts); err != nil {
+		return nil, err
+	}
+	_, window := l.limits()
+	var recent []time.Time
+	for _, attempt := range attempts {
+		if now.Sub(attempt) < window {
+			recent = append(recent, attempt)
+		}
+	}
+	return recent, nil
+}
+
+// Attempt records a login attempt or returns a LoginCooldownError if no further attempts are allowed yet
+func (l *LoginLimiter) Attempt() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	attempts, err := l.attempts(now)
+	if err != nil {
+		return err
+	}
+	maxAttempts, window := l.limits()
+	if len(attempts) >= maxAttempts {
+		return &LoginCooldownError{Until: attempts[len(attempts)-maxAttempts].Add(window)}
+	}
+
+	data, err := json.Marshal(append(attempts, now))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(l.Path, data, 0600)
+}
+
+// WithLoginLimiter protects the client from requesting too many SMS codes
+func WithLoginLimiter(limiter *LoginLimiter) ClientOption {
+	return func(c *Client) {
+		c.loginLimiter = limiter
+	}
+}
@@ -0,0 +1,29 @@
+package circ
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logins")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	limiter := &LoginLimiter{Path: filepath.Join(dir, "tokens.logins"), MaxAttempts: 2, Window: time.Hour}
+	require.NoError(t, limiter.Attempt())
+	require.NoError(t, limiter.Attempt())
+	err = limiter.Attempt()
+	if assert.IsType(t, &LoginCooldownError{}, err) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), err.(*LoginCooldownError).Until, time.Minute)
+	}
+
+	restarted := &LoginLimiter{Path: limiter.Path, MaxAttempts: 2, Window: time.Hour}
+	assert.Error(t, restarted.Attempt())
+}
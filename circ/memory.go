@@ -0,0 +1,44 @@
+package circ
+
+import (
+	"os"
+	"sync"
+)
+
+// MemoryTokenStore keeps the tokens in memory only, i.e. for tests or ephemeral environments where the
+// tokens don't need to survive a restart
+type MemoryTokenStore struct {
+	lock         sync.Mutex
+	accessToken  string
+	refreshToken string
+}
+
+// NewMemoryTokenStore creates a MemoryTokenStore seeded with the given tokens
+func NewMemoryTokenStore(accessToken, refreshToken string) *MemoryTokenStore {
+	return &MemoryTokenStore{accessToken: accessToken, refreshToken: refreshToken}
+}
+
+// Store keeps the tokens
+func (m *MemoryTokenStore) Store(accessToken, refreshToken string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.accessToken = accessToken
+	m.refreshToken = refreshToken
+	return nil
+}
+
+// Load returns the kept tokens or os.ErrNotExist if no tokens were stored yet
+func (m *MemoryTokenStore) Load() (string, string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.accessToken == "" {
+		return "", "", os.ErrNotExist
+	}
+	return m.accessToken, m.refreshToken, nil
+}
+
+// WithTokens seeds the client with the given tokens, refreshed tokens are kept in memory only.
+// Use WithTokenStore instead if the tokens need to be persisted.
+func WithTokens(accessToken, refreshToken string) ClientOption {
+	return WithTokenStore(NewMemoryTokenStore(accessToken, refreshToken))
+}
@@ -0,0 +1,64 @@
+package circ
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// MergeScooters combines several sets of scooters, i.e. scraped by different scraper instances with
+// overlapping areas, into one set without duplicates. If a scooter is contained in several sets the
+// observation with the most recent state update wins.
+func MergeScooters(sets ...[]*Scooter) []*Scooter {
+	merged := make(Scooters)
+	for _, set := range sets {
+		for _, scooter := range set {
+			if existing, exists := merged[scooter.Identifier]; exists && existing.StateUpdateAt >= scooter.StateUpdateAt {
+				continue
+			}
+			merged[scooter.Identifier] = scooter
+		}
+	}
+
+	scooters := make([]*Scooter, 0, len(merged))
+	for _, scooter := range merged {
+		scooters = append(scooters, scooter)
+	}
+	sort.Slice(scooters, func(i, j int) bool {
+		return scooters[i].Identifier < scooters[j].Identifier
+	})
+	return scooters
+}
+
+// MergeRecords works like MergeScooters on the JSON records of scooters. The records are passed on
+// unchanged, so fields unknown to Scooter are kept in merged archives.
+func MergeRecords(sets ...[]json.RawMessage) ([]json.RawMessage, error) {
+	type observation struct {
+		Identifier    string `json:"identifier"`
+		StateUpdateAt uint64 `json:"stateUpdateAt"`
+		record        json.RawMessage
+	}
+	merged := make(map[string]*observation)
+	for _, set := range sets {
+		for _, record := range set {
+			scooter := &observation{record: record}
+			if err := json.Unmarshal(record, scooter); err != nil {
+				return nil, err
+			}
+			if existing, exists := merged[scooter.Identifier]; exists && existing.StateUpdateAt >= scooter.StateUpdateAt {
+				continue
+			}
+			merged[scooter.Identifier] = scooter
+		}
+	}
+
+	ids := make([]string, 0, len(merged))
+	for id := range merged {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	records := make([]json.RawMessage, len(ids))
+	for i, id := range ids {
+		records[i] = merged[id].record
+	}
+	return records, nil
+}
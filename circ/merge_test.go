@@ -0,0 +1,53 @@
+package circ
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeScooters(t *testing.T) {
+	scooter := func(id string, stateUpdateAt uint64, state string) *Scooter {
+		return &Scooter{Identifier: id, StateUpdateAt: stateUpdateAt, State: state}
+	}
+	// Two scraper instances with overlapping areas
+	north := []*Scooter{scooter("c", 100, "IDLE"), scooter("a", 200, "IN_USE"), scooter("b", 100, "IDLE")}
+	south := []*Scooter{scooter("b", 300, "IN_USE"), scooter("a", 100, "IDLE"), scooter("d", 100, "IDLE")}
+	// The same scooter twice within one set
+	duplicates := []*Scooter{scooter("d", 400, "BROKEN"), scooter("d", 50, "IDLE")}
+
+	merged := MergeScooters(north, south, duplicates)
+	require.Len(t, merged, 4)
+	var ids, states []string
+	for _, s := range merged {
+		ids = append(ids, s.Identifier)
+		states = append(states, s.State)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+	assert.Equal(t, []string{"IN_USE", "IN_USE", "IDLE", "BROKEN"}, states)
+
+	// The first observation wins on equal state updates
+	first, second := scooter("a", 100, "IDLE"), scooter("a", 100, "IN_USE")
+	assert.Equal(t, []*Scooter{first}, MergeScooters([]*Scooter{first}, []*Scooter{second}))
+	assert.Empty(t, MergeScooters())
+}
+
+func TestMergeRecords(t *testing.T) {
+	north := []json.RawMessage{
+		json.RawMessage(`{"identifier":"a","stateUpdateAt":200,"state":"IN_USE","newField":{"x":1}}`),
+		json.RawMessage(`{"identifier":"b","stateUpdateAt":100,"state":"IDLE"}`),
+	}
+	south := []json.RawMessage{
+		json.RawMessage(`{"identifier":"b","stateUpdateAt":300,"state":"IN_USE","newField":2}`),
+		json.RawMessage(`{"identifier":"a","stateUpdateAt":100,"state":"IDLE"}`),
+	}
+	merged, err := MergeRecords(north, south)
+	require.NoError(t, err)
+	// Fields unknown to Scooter are kept
+	assert.Equal(t, []json.RawMessage{north[0], south[0]}, merged)
+
+	_, err = MergeRecords([]json.RawMessage{json.RawMessage(`[]`)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package circ
+
+import (
+	"sync"
+)
+
+// Interner deduplicates strings which are repeated across many observations, like scooter identifiers,
+// zones and user identifiers, so every distinct value is only kept in memory once. It is safe for
+// concurrent use.
+type Interner struct {
+	lock    sync.Mutex
+	strings map[string]string
+}
+
+// NewInterner creates an empty Interner
+func NewInterner() *Interner {
+	return &Interner{
+		strings: make(map[string]string),
+	}
+}
+
+// Intern returns the first instance of a string equal to s
+func (in *Interner) Intern(s string) string {
+	if s == "" {
+		return s
+	}
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	if interned, exists := in.strings[s]; exists {
+		return interned
+	}
+	in.strings[s] = s
+	return s
+}
+
+// Len returns the number of distinct strings
+func (in *Interner) Len() int {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+	return len(in.strings)
+}
+
+func (in *Interner) internPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	interned := in.Intern(*s)
+	return &interned
+}
+
+// Intern replaces the repeated string fields of the scooter with their interned instances
+func (s *Scooter) Intern(in *Interner) {
+	for i, action := range s.Actions {
+		s.Actions[i] = in.Intern(action)
+	}
+	s.BrokenUpdatedByUserIdentifier = in.internPtr(s.BrokenUpdatedByUserIdentifier)
+	s.BrokenUpdatedUserType = in.internPtr(s.BrokenUpdatedUserType)
+	s.Currency = in.Intern(s.Currency)
+	s.Identifier = in.Intern(s.Identifier)
+	s.MissingUpdatedByUserIdentifier = in.internPtr(s.MissingUpdatedByUserIdentifier)
+	s.MissingUpdatedUserType = in.internPtr(s.MissingUpdatedUserType)
+	s.Name = in.Intern(s.Name)
+	s.Partner = in.Intern(s.Partner)
+	s.QrCode = in.Intern(s.QrCode)
+	s.State = in.Intern(s.State)
+	s.StateUpdatedByUserIdentifier = in.Intern(s.StateUpdatedByUserIdentifier)
+	s.StateUpdatedUserType = in.Intern(s.StateUpdatedUserType)
+	s.Type = in.Intern(s.Type)
+	s.ZoneIdentifier = in.Intern(s.ZoneIdentifier)
+}
+
+// ScooterPool keeps slices of Scooters for reuse, so reading scrape files doesn't allocate a new Scooter
+// for every observation. A slice must not be used anymore after it was put back into the pool.
+type ScooterPool struct {
+	pool sync.Pool
+}
+
+// Get returns an empty slice, its capacity may hold Scooters which are reused by AppendScooter
+func (p *ScooterPool) Get() []*Scooter {
+	if s, ok := p.pool.Get().([]*Scooter); ok {
+		return s[:0]
+	}
+	return nil
+}
+
+// Put hands s back to the pool
+func (p *ScooterPool) Put(s []*Scooter) {
+	if cap(s) == 0 {
+		return
+	}
+	p.pool.Put(s[:0])
+}
+
+// AppendScooter extends s by a zeroed Scooter and returns the extended slice together with the new Scooter.
+// A Scooter left in the capacity of s is reused instead of allocating a new one.
+func AppendScooter(s []*Scooter) ([]*Scooter, *Scooter) {
+	if len(s) < cap(s) {
+		s = s[:len(s)+1]
+		if scooter := s[len(s)-1]; scooter != nil {
+			*scooter = Scooter{}
+			return s, scooter
+		}
+		scooter := &Scooter{}
+		s[len(s)-1] = scooter
+		return s, scooter
+	}
+	scooter := &Scooter{}
+	return append(s, scooter), scooter
+}
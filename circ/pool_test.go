@@ -0,0 +1,53 @@
+package circ
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterner(t *testing.T) {
+	in := NewInterner()
+	first := string([]byte("zone-1"))
+	second := string([]byte("zone-1"))
+
+	assert.Equal(t, first, in.Intern(first))
+	interned := in.Intern(second)
+	assert.Equal(t, "zone-1", interned)
+	assert.Equal(t, 1, in.Len())
+	assert.Equal(t, "", in.Intern(""))
+	assert.Equal(t, 1, in.Len())
+
+	user := "user-1"
+	a := &Scooter{Identifier: string([]byte("scooter")), ZoneIdentifier: "zone-1", BrokenUpdatedByUserIdentifier: &user}
+	b := &Scooter{Identifier: string([]byte("scooter")), ZoneIdentifier: "zone-1"}
+	a.Intern(in)
+	b.Intern(in)
+	assert.Equal(t, "scooter", b.Identifier)
+	require.NotNil(t, a.BrokenUpdatedByUserIdentifier)
+	assert.Equal(t, user, *a.BrokenUpdatedByUserIdentifier)
+	assert.Nil(t, b.BrokenUpdatedByUserIdentifier)
+	assert.Equal(t, 3, in.Len())
+}
+
+func TestAppendScooter(t *testing.T) {
+	var s []*Scooter
+	s, first := AppendScooter(s)
+	first.Identifier = "a"
+	s, second := AppendScooter(s)
+	second.Identifier = "b"
+	require.Len(t, s, 2)
+	assert.Same(t, first, s[0])
+	assert.Same(t, second, s[1])
+
+	// A released slice hands out its zeroed scooters again
+	reused, scooter := AppendScooter(s[:0])
+	assert.Same(t, first, scooter)
+	assert.Equal(t, Scooter{}, *scooter)
+	assert.Len(t, reused, 1)
+
+	var pool ScooterPool
+	pool.Put(nil)
+	assert.Len(t, pool.Get(), 0)
+}
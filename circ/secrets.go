@@ -0,0 +1,278 @@
+package circ
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultAccessTokenEnv is the environment variable EnvTokenStore reads the access token from by default
+	DefaultAccessTokenEnv = "CIRC_ACCESS_TOKEN"
+	// DefaultRefreshTokenEnv is the environment variable EnvTokenStore reads the refresh token from by default
+	DefaultRefreshTokenEnv = "CIRC_REFRESH_TOKEN"
+)
+
+type secretTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// EnvTokenStore reads the tokens from environment variables. Since the environment can't be persisted,
+// refreshed tokens are only kept in the environment of the running process.
+type EnvTokenStore struct {
+	AccessTokenVar  string
+	RefreshTokenVar string
+}
+
+func (e *EnvTokenStore) names() (string, string) {
+	accessVar, refreshVar := e.AccessTokenVar, e.RefreshTokenVar
+	if accessVar == "" {
+		accessVar = DefaultAccessTokenEnv
+	}
+	if refreshVar == "" {
+		refreshVar = DefaultRefreshTokenEnv
+	}
+	return accessVar, refreshVar
+}
+
+// Store sets the tokens in the environment of the current process
+func (e *EnvTokenStore) Store(accessToken, refreshToken string) error {
+	accessVar, refreshVar := e.names()
+	if err := os.Setenv(accessVar, accessToken); err != nil {
+		return err
+	}
+	return os.Setenv(refreshVar, refreshToken)
+}
+
+// Load reads the tokens from the environment
+func (e *EnvTokenStore) Load() (string, string, error) {
+	accessVar, refreshVar := e.names()
+	accessToken, refreshToken := os.Getenv(accessVar), os.Getenv(refreshVar)
+	if accessToken == "" || refreshToken == "" {
+		return "", "", fmt.Errorf("Environment variables %s and %s need to be set", accessVar, refreshVar)
+	}
+	return accessToken, refreshToken, nil
+}
+
+// VaultTokenStore stores the tokens in a HashiCorp Vault KV version 2 secrets engine. Path is the API path
+// of the secret, i.e. "secret/data/sharealyzer/circ".
+type VaultTokenStore struct {
+	Address    string
+	Token      string
+	Path       string
+	HTTPClient *http.Client
+}
+
+func (v *VaultTokenStore) do(method string, payload interface{}) (*http.Response, error) {
+	buf := &bytes.Buffer{}
+	if payload != nil {
+		if err := json.NewEncoder(buf).Encode(payload); err != nil {
+			return nil, err
+		}
+	}
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(v.Path, "/")
+	r, err := http.NewRequest(method, url, buf)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("X-Vault-Token", v.Token)
+	r.Header.Set("Content-Type", "application/json")
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Vault returned status %d for %s", resp.StatusCode, v.Path)
+	}
+	return resp, nil
+}
+
+// Store writes the tokens as a new version of the secret
+func (v *VaultTokenStore) Store(accessToken, refreshToken string) error {
+	resp, err := v.do(http.MethodPost, map[string]interface{}{
+		"data": secretTokens{AccessToken: accessToken, RefreshToken: refreshToken},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to store tokens in vault")
+	}
+	return resp.Body.Close()
+}
+
+// Load reads the latest version of the secret
+func (v *VaultTokenStore) Load() (string, string, error) {
+	resp, err := v.do(http.MethodGet, nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Failed to load tokens from vault")
+	}
+	defer resp.Body.Close()
+	secret := struct {
+		Data struct {
+			Data secretTokens `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", "", errors.Wrap(err, "Failed to decode vault secret")
+	}
+	return secret.Data.Data.AccessToken, secret.Data.Data.RefreshToken, nil
+}
+
+// AWSSecretTokenStore stores the tokens as JSON in an existing AWS Secrets Manager secret. If no credentials
+// are specified, they are taken from the usual AWS_* environment variables.
+type AWSSecretTokenStore struct {
+	Region          string
+	SecretID        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint replaces the regional endpoint, i.e. a VPC endpoint like https://vpce-1234.secretsmanager.eu-central-1.vpce.amazonaws.com
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+func (a *AWSSecretTokenStore) credentials() (region, keyID, secretKey, sessionToken string) {
+	region, keyID, secretKey, sessionToken = a.Region, a.AccessKeyID, a.SecretAccessKey, a.SessionToken
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if keyID == "" {
+		keyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	return
+}
+
+func (a *AWSSecretTokenStore) call(action string, payload, result interface{}) error {
+	region, keyID, secretKey, sessionToken := a.credentials()
+	if region == "" || keyID == "" || secretKey == "" {
+		return errors.New("AWS region and credentials need to be specified")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+	r, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	host := r.URL.Host
+	r.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	r.Header.Set("X-Amz-Target", "secretsmanager."+action)
+	if sessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signV4(r, body, host, region, "secretsmanager", keyID, secretKey, time.Now().UTC())
+
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("AWS Secrets Manager returned status %d for %s", resp.StatusCode, action)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Store writes the tokens as a new version of the secret
+func (a *AWSSecretTokenStore) Store(accessToken, refreshToken string) error {
+	secret, err := json.Marshal(secretTokens{AccessToken: accessToken, RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+	err = a.call("PutSecretValue", map[string]string{
+		"SecretId":     a.SecretID,
+		"SecretString": string(secret),
+	}, nil)
+	return errors.Wrap(err, "Failed to store tokens in AWS Secrets Manager")
+}
+
+// Load reads the current version of the secret
+func (a *AWSSecretTokenStore) Load() (string, string, error) {
+	result := struct {
+		SecretString string `json:"SecretString"`
+	}{}
+	if err := a.call("GetSecretValue", map[string]string{"SecretId": a.SecretID}, &result); err != nil {
+		return "", "", errors.Wrap(err, "Failed to load tokens from AWS Secrets Manager")
+	}
+	var tokens secretTokens
+	if err := json.Unmarshal([]byte(result.SecretString), &tokens); err != nil {
+		return "", "", errors.Wrap(err, "Failed to decode AWS secret")
+	}
+	return tokens.AccessToken, tokens.RefreshToken, nil
+}
+
+// signV4 signs a request to the root path of an AWS service with AWS Signature Version 4
+func signV4(r *http.Request, body []byte, host, region, service, keyID, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	r.Host = host
+	r.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": host}
+	for name := range r.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(r.Header.Get(name))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		r.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
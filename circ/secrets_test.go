@@ -0,0 +1,105 @@
+package circ
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultTokenStore(t *testing.T) {
+	var stored map[string]secretTokens
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/circ", r.URL.Path)
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&stored))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": stored})
+	}))
+	defer server.Close()
+
+	store := &VaultTokenStore{Address: server.URL, Token: "vault-token", Path: "secret/data/circ"}
+	require.NoError(t, store.Store("access", "refresh"))
+	accessToken, refreshToken, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+	assert.Equal(t, "refresh", refreshToken)
+}
+
+func TestEnvTokenStore(t *testing.T) {
+	store := &EnvTokenStore{AccessTokenVar: "TEST_CIRC_ACCESS", RefreshTokenVar: "TEST_CIRC_REFRESH"}
+	_, _, err := store.Load()
+	assert.Error(t, err)
+
+	require.NoError(t, store.Store("access", "refresh"))
+	accessToken, refreshToken, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+	assert.Equal(t, "refresh", refreshToken)
+}
+
+// TestSignV4 uses the get-vanilla and post-vanilla requests of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for method, signature := range map[string]string{
+		http.MethodGet:  "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		http.MethodPost: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+	} {
+		r, err := http.NewRequest(method, "https://example.amazonaws.com/", nil)
+		require.NoError(t, err)
+		signV4(r, nil, "example.amazonaws.com", "us-east-1", "service", "AKIDEXAMPLE",
+			"wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now)
+		assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, Signature="+signature, r.Header.Get("Authorization"), method)
+	}
+}
+
+func TestAWSSecretTokenStore(t *testing.T) {
+	secret := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=key/")
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-central-1/secretsmanager/aws4_request")
+		assert.Contains(t, r.Header.Get("Authorization"), "x-amz-security-token;x-amz-target")
+		var payload map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		if payload["SecretId"] != "circ" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.PutSecretValue":
+			secret = payload["SecretString"]
+			w.Write([]byte(`{}`))
+		case "secretsmanager.GetSecretValue":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": secret})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	store := &AWSSecretTokenStore{Region: "eu-central-1", SecretID: "circ", AccessKeyID: "key",
+		SecretAccessKey: "secret", SessionToken: "session", Endpoint: server.URL}
+	require.NoError(t, store.Store("access", "refresh"))
+	accessToken, refreshToken, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessToken)
+	assert.Equal(t, "refresh", refreshToken)
+
+	store.SecretID = "missing"
+	_, _, err = store.Load()
+	assert.Error(t, err)
+	_, _, err = (&AWSSecretTokenStore{Region: "eu-central-1", Endpoint: server.URL}).Load()
+	assert.Error(t, err)
+}
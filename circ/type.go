@@ -1,6 +1,10 @@
 package circ
 
-import "time"
+import (
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
 
 // CircError represents an error returned by the circ API. Unfortunately error handling
 // is pretty inconsistent so this is only a best effort
@@ -16,27 +20,67 @@ func (c CircError) Error() string {
 	return "[CircError] " + c.Err + ": " + c.Message
 }
 
+// IsAuthError returns true if err is a CircError signaling that we need to login again
+func IsAuthError(err error) bool {
+	circErr, ok := err.(CircError)
+	return ok && (circErr.Status == 401 || circErr.Status == 403)
+}
+
+// Statistic is one entry of the account statistics, i.e. the distance driven
+type Statistic struct {
+	Unit        string `json:"unit"`
+	Value       string `json:"value"`
+	Measurement string `json:"measurement"`
+}
+
+// Profile is the profile of the authenticated account
+type Profile struct {
+	ID                        uint64        `json:"id"`
+	Identifier                string        `json:"identifier"`
+	FirstName                 *string       `json:"firstName"`
+	LastName                  *string       `json:"lastName"`
+	Email                     *string       `json:"email"`
+	EmailVerified             bool          `json:"emailVerified"`
+	PhoneMobile               string        `json:"phoneMobile"`
+	PhoneMobileVerified       bool          `json:"phoneMobileVerified"`
+	Birthday                  *string       `json:"birthday"`
+	Language                  *string       `json:"language"`
+	PaymentProviderRegistered bool          `json:"paymentProviderRegistered"`
+	Statistic                 []Statistic   `json:"statistic"`
+	Addresses                 []interface{} `json:"addresses"`
+}
+
 // AuthResponse is the data received after successfull authentication. It contains the auth tokens and your profile
 type AuthResponse struct {
-	ID                        uint64  `json:"id"`
-	Identifier                string  `json:"identifier"`
-	FirstName                 *string `json:"firstName"`
-	LastName                  *string `json:"lastName"`
-	Email                     *string `json:"email"`
-	EmailVerified             bool    `json:"emailVerified"`
-	PhoneMobile               string  `json:"phoneMobile"`
-	PhoneMobileVerified       bool    `json:"phoneMobileVerified"`
-	Birthday                  *string `json:"birthday"`
-	Language                  *string `json:"language"`
-	PaymentProviderRegistered bool    `json:"paymentProviderRegistered"`
-	Statistic                 []struct {
-		Unit        string `json:"unit"`
-		Value       string `json:"value"`
-		Measurement string `json:"measurement"`
-	} `json:"statistic"`
-	Addresses    []interface{} `json:"addresses`
-	AccessToken  string        `json:"accessToken"`
-	RefreshToken string        `json:"refreshToken"`
+	Profile
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Ride is a ride of the authenticated account from its official ride history
+type Ride struct {
+	Identifier       string  `json:"identifier"`
+	DeviceIdentifier string  `json:"deviceIdentifier"`
+	DeviceName       string  `json:"deviceName"`
+	StartedAt        uint64  `json:"startedAt"`
+	EndedAt          uint64  `json:"endedAt"`
+	StartLatitude    float64 `json:"startLatitude"`
+	StartLongitude   float64 `json:"startLongitude"`
+	EndLatitude      float64 `json:"endLatitude"`
+	EndLongitude     float64 `json:"endLongitude"`
+	DistanceInMeters float64 `json:"distance"`
+	Price            int     `json:"price"`
+	Currency         string  `json:"currency"`
+}
+
+// StartTime returns the start of the ride
+func (r *Ride) StartTime() time.Time {
+	return time.Unix(0, int64(r.StartedAt)*int64(time.Millisecond))
+}
+
+// EndTime returns the end of the ride
+func (r *Ride) EndTime() time.Time {
+	return time.Unix(0, int64(r.EndedAt)*int64(time.Millisecond))
 }
 
 // TokenRefreshResponse is the response when successfully refreshing tokens
@@ -47,6 +91,14 @@ type TokenRefreshResponse struct {
 	UserUUID     string `json:"userUuid"`
 }
 
+// RequiredScooterFields are the fields of a scooter without which trips can't be detected
+var RequiredScooterFields = []string{"identifier", "latitude", "longitude", "energyLevel"}
+
+// NewScooterDecoder creates a decoder for scooters which requires RequiredScooterFields
+func NewScooterDecoder(mode sharealyzer.DecodeMode) *sharealyzer.RecordDecoder {
+	return sharealyzer.NewRecordDecoder(mode, RequiredScooterFields...)
+}
+
 // Scooter represents one circ scooter within its API
 type Scooter struct {
 	Actions                        []string `json:"actions"`
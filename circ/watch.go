@@ -0,0 +1,127 @@
+package circ
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultSettleTime is how long a new scrape file needs to stay unchanged until it is considered complete
+const DefaultSettleTime = 2 * time.Second
+
+// pendingFile is a new file which may still be written
+type pendingFile struct {
+	size    int64
+	changed time.Time
+}
+
+// writeTracker follows new scrape files until they are completely written. fsnotify doesn't report when a
+// writer closes a file, so a file is complete once its size didn't change for the settle time. Files
+// renamed or removed in the meantime are forgotten. Completed files are remembered, so later events for them
+// or draining their folder again doesn't return them twice.
+type writeTracker struct {
+	settle    time.Duration
+	files     map[string]*pendingFile
+	completed map[string]bool
+}
+
+func newWriteTracker(settle time.Duration) *writeTracker {
+	if settle <= 0 {
+		settle = DefaultSettleTime
+	}
+	return &writeTracker{
+		settle:    settle,
+		files:     make(map[string]*pendingFile),
+		completed: make(map[string]bool),
+	}
+}
+
+// pollInterval is how often complete should be called
+func (w *writeTracker) pollInterval() time.Duration {
+	return w.settle / 4
+}
+
+// event records a file system event at now
+func (w *writeTracker) event(evt fsnotify.Event, now time.Time) {
+	if !fileNameRegex.MatchString(filepath.Base(evt.Name)) {
+		// Temporary files, indexes etc. are no scrape files
+		return
+	}
+	if evt.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(w.files, evt.Name)
+		return
+	}
+	if evt.Op&(fsnotify.Create|fsnotify.Write) == 0 || w.completed[evt.Name] {
+		return
+	}
+	if file, exists := w.files[evt.Name]; exists {
+		file.changed = now
+		return
+	}
+	w.files[evt.Name] = &pendingFile{size: -1, changed: now}
+}
+
+// complete returns the files which didn't change for the settle time in the order of their names and stops
+// tracking them
+func (w *writeTracker) complete(now time.Time) []string {
+	var completed []string
+	for path, file := range w.files {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				delete(w.files, path)
+			}
+			continue
+		}
+		if info.Size() != file.size {
+			file.size = info.Size()
+			file.changed = now
+			continue
+		}
+		if now.Sub(file.changed) >= w.settle {
+			completed = append(completed, path)
+			delete(w.files, path)
+			w.completed[path] = true
+		}
+	}
+	sort.Strings(completed)
+	return completed
+}
+
+// pending returns the number of files which may still be written
+func (w *writeTracker) pending() int {
+	return len(w.files)
+}
+
+// drain tracks all scrape files in folder which weren't seen yet. Files created before a folder is watched
+// or whose events got lost are picked up this way.
+func (w *writeTracker) drain(folder string, now time.Time) error {
+	infos, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			w.event(fsnotify.Event{Name: filepath.Join(folder, info.Name()), Op: fsnotify.Create}, now)
+		}
+	}
+	return nil
+}
+
+// forget drops the completed files of all folders except the given ones
+func (w *writeTracker) forget(keep ...string) {
+	for path := range w.completed {
+		folder := filepath.Dir(path)
+		kept := false
+		for _, k := range keep {
+			kept = kept || folder == k
+		}
+		if !kept {
+			delete(w.completed, path)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package circ
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "circ_2019-10-08T05:11:27+01:00.json.gz")
+	renamed := filepath.Join(dir, "circ_2019-10-08T05:12:27+01:00.json.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, ioutil.WriteFile(renamed, []byte("data"), 0660))
+
+	now := time.Now()
+	tracker := newWriteTracker(time.Second)
+	tracker.event(fsnotify.Event{Name: path, Op: fsnotify.Create}, now)
+	tracker.event(fsnotify.Event{Name: renamed, Op: fsnotify.Create}, now)
+	tracker.event(fsnotify.Event{Name: filepath.Join(dir, "index.jsonl"), Op: fsnotify.Create}, now)
+	tracker.event(fsnotify.Event{Name: path + ".tmp", Op: fsnotify.Create}, now)
+	assert.Equal(t, 2, tracker.pending())
+	tracker.event(fsnotify.Event{Name: renamed, Op: fsnotify.Rename}, now)
+	assert.Equal(t, 1, tracker.pending())
+
+	// The file is still written
+	assert.Empty(t, tracker.complete(now))
+	_, err = f.Write([]byte("first part"))
+	require.NoError(t, err)
+	now = now.Add(900 * time.Millisecond)
+	assert.Empty(t, tracker.complete(now))
+	_, err = f.Write([]byte("second part"))
+	require.NoError(t, err)
+	now = now.Add(900 * time.Millisecond)
+	assert.Empty(t, tracker.complete(now))
+	now = now.Add(900 * time.Millisecond)
+	assert.Empty(t, tracker.complete(now))
+
+	// Unchanged for the settle time
+	now = now.Add(200 * time.Millisecond)
+	assert.Equal(t, []string{path}, tracker.complete(now))
+	assert.Equal(t, 0, tracker.pending())
+
+	// Removed files are forgotten
+	tracker.event(fsnotify.Event{Name: path, Op: fsnotify.Write}, now)
+	require.NoError(t, os.Remove(path))
+	assert.Empty(t, tracker.complete(now.Add(time.Hour)))
+	assert.Equal(t, 0, tracker.pending())
+}
+
+func receiveDates(t *testing.T, results <-chan *ScrapeResult, n int) []time.Time {
+	var dates []time.Time
+	timeout := time.After(10 * time.Second)
+	for len(dates) < n {
+		select {
+		case res := <-results:
+			dates = append(dates, res.Date)
+		case <-timeout:
+			require.FailNow(t, "Timed out waiting for scrape results", "received %d of %d", len(dates), n)
+		}
+	}
+	return dates
+}
+
+func TestFileScraperRollover(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "rollover")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	zone := time.FixedZone("CET", 3600)
+	existing := time.Date(2019, 10, 7, 23, 58, 0, 0, zone)
+	writeArchiveFile(t, baseDir, existing, []*Scooter{{Identifier: "1"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scraper := NewFileScraper(baseDir)
+	scraper.SettleTime = 100 * time.Millisecond
+	results, err := scraper.Scrape(ctx, true)
+	require.NoError(t, err)
+	assert.True(t, existing.Equal(receiveDates(t, results, 1)[0]))
+
+	beforeMidnight := existing.Add(time.Minute)
+	writeArchiveFile(t, baseDir, beforeMidnight, []*Scooter{{Identifier: "1"}})
+	assert.True(t, beforeMidnight.Equal(receiveDates(t, results, 1)[0]))
+
+	// The new day folder is watched and the old one still gets late files
+	afterMidnight := existing.Add(2 * time.Minute)
+	writeArchiveFile(t, baseDir, afterMidnight, []*Scooter{{Identifier: "1"}})
+	assert.True(t, afterMidnight.Equal(receiveDates(t, results, 1)[0]))
+	late := beforeMidnight.Add(30 * time.Second)
+	writeArchiveFile(t, baseDir, late, []*Scooter{{Identifier: "1"}})
+	assert.True(t, late.Equal(receiveDates(t, results, 1)[0]))
+	next := afterMidnight.Add(time.Minute)
+	writeArchiveFile(t, baseDir, next, []*Scooter{{Identifier: "1"}})
+	assert.True(t, next.Equal(receiveDates(t, results, 1)[0]))
+
+	// No file is sent twice
+	select {
+	case res := <-results:
+		assert.Fail(t, "Unexpected scrape result", "%s", res.Date)
+	case <-time.After(5 * scraper.SettleTime):
+	}
+	assert.Equal(t, 0, scraper.FailedFiles())
+
+	cancel()
+	for range results {
+	}
+}
+
+func TestFileScraperWithoutDayFolders(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "rollover")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scraper := NewFileScraper(baseDir)
+	scraper.SettleTime = 100 * time.Millisecond
+	results, err := scraper.Scrape(ctx, true)
+	require.NoError(t, err)
+
+	first := time.Date(2019, 10, 8, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	writeArchiveFile(t, baseDir, first, []*Scooter{{Identifier: "1"}})
+	assert.True(t, first.Equal(receiveDates(t, results, 1)[0]))
+}
+
+func TestFileScraperEmptyArchive(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "empty")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	_, err = NewFileScraper(baseDir).Scrape(context.Background(), false)
+	assert.Equal(t, archive.ErrNoScrapeFiles, err)
+
+	// Indexes and temporary files are no scrape files
+	date := time.Date(2019, 10, 8, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	path := writeArchiveFile(t, baseDir, date, []*Scooter{{Identifier: "1"}})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(path), "index.jsonl"), nil, 0660))
+	require.NoError(t, ioutil.WriteFile(path+".tmp", nil, 0660))
+	scraper := NewFileScraper(baseDir)
+	results, err := scraper.Scrape(context.Background(), false)
+	require.NoError(t, err)
+	var dates []time.Time
+	for res := range results {
+		dates = append(dates, res.Date)
+	}
+	require.Len(t, dates, 1)
+	assert.True(t, date.Equal(dates[0]))
+	assert.Equal(t, 0, scraper.FailedFiles())
+}
@@ -0,0 +1,108 @@
+package circ
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// ZoneCount is the number of scooters seen in a zone
+type ZoneCount struct {
+	ZoneIdentifier string
+	Scooters       int
+}
+
+// CountZones returns the number of scooters per zone, sorted by the number of scooters descending
+func CountZones(scooters []*Scooter) []ZoneCount {
+	counts := make(map[string]int)
+	for _, scooter := range scooters {
+		counts[scooter.ZoneIdentifier]++
+	}
+	zones := make([]ZoneCount, 0, len(counts))
+	for zone, count := range counts {
+		zones = append(zones, ZoneCount{
+			ZoneIdentifier: zone,
+			Scooters:       count,
+		})
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		if zones[i].Scooters == zones[j].Scooters {
+			return zones[i].ZoneIdentifier < zones[j].ZoneIdentifier
+		}
+		return zones[i].Scooters > zones[j].Scooters
+	})
+	return zones
+}
+
+// ZoneStatistic summarizes a zone over a period of scrapes
+type ZoneStatistic struct {
+	ZoneIdentifier string
+	// Center is the mean location of all scooters seen in the zone
+	Center *sharealyzer.GeoLocation
+	// Scooters is the average number of scooters per scrape
+	Scooters float64
+	// TripStarts is the number of trips of scooters which belonged to the zone
+	TripStarts int
+}
+
+// ZoneStatistics computes the statistics of all zones seen in the results. Trips are assigned to the zone
+// their scooter was last seen in before the trip started. The statistics are sorted by zone.
+func ZoneStatistics(results <-chan *ScrapeResult, trips []*sharealyzer.Trip) []*ZoneStatistic {
+	type zoneSums struct {
+		scooters       int
+		latSum, lonSum float64
+	}
+	type sighting struct {
+		zone string
+		date time.Time
+	}
+	zones := make(map[string]*zoneSums)
+	sightings := make(map[string][]sighting)
+	scrapes := 0
+	for res := range results {
+		scrapes++
+		for _, scooter := range res.Scooters {
+			sums, exists := zones[scooter.ZoneIdentifier]
+			if !exists {
+				sums = &zoneSums{}
+				zones[scooter.ZoneIdentifier] = sums
+			}
+			sums.scooters++
+			sums.latSum += scooter.Latitude
+			sums.lonSum += scooter.Longitude
+			seen := sightings[scooter.Identifier]
+			if len(seen) == 0 || seen[len(seen)-1].zone != scooter.ZoneIdentifier {
+				sightings[scooter.Identifier] = append(seen, sighting{zone: scooter.ZoneIdentifier, date: res.Date})
+			}
+		}
+	}
+
+	tripStarts := make(map[string]int)
+	for _, trip := range trips {
+		zone, found := "", false
+		for _, s := range sightings[trip.ScooterID] {
+			if s.date.After(trip.StartTime) {
+				break
+			}
+			zone, found = s.zone, true
+		}
+		if found {
+			tripStarts[zone]++
+		}
+	}
+
+	stats := make([]*ZoneStatistic, 0, len(zones))
+	for zone, sums := range zones {
+		stats = append(stats, &ZoneStatistic{
+			ZoneIdentifier: zone,
+			Center:         sharealyzer.NewGeoLocation(sums.latSum/float64(sums.scooters), sums.lonSum/float64(sums.scooters)),
+			Scooters:       float64(sums.scooters) / float64(scrapes),
+			TripStarts:     tripStarts[zone],
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ZoneIdentifier < stats[j].ZoneIdentifier
+	})
+	return stats
+}
@@ -0,0 +1,38 @@
+package circ
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneStatistics(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	results := make(chan *ScrapeResult, 2)
+	results <- &ScrapeResult{Date: start, Scooters: []*Scooter{
+		{Identifier: "a", ZoneIdentifier: "center", Latitude: 51.0, Longitude: 7.0},
+		{Identifier: "b", ZoneIdentifier: "center", Latitude: 51.2, Longitude: 7.2},
+	}}
+	results <- &ScrapeResult{Date: start.Add(time.Hour), Scooters: []*Scooter{
+		{Identifier: "a", ZoneIdentifier: "north", Latitude: 52.0, Longitude: 7.0},
+	}}
+	close(results)
+
+	stats := ZoneStatistics(results, []*sharealyzer.Trip{
+		{ScooterID: "a", StartTime: start.Add(30 * time.Minute)},
+		{ScooterID: "b", StartTime: start.Add(30 * time.Minute)},
+		{ScooterID: "a", StartTime: start.Add(2 * time.Hour)},
+		{ScooterID: "unknown", StartTime: start},
+	})
+	require.Len(t, stats, 2)
+	assert.Equal(t, "center", stats[0].ZoneIdentifier)
+	assert.Equal(t, 1.0, stats[0].Scooters)
+	assert.Equal(t, 2, stats[0].TripStarts)
+	assert.InDelta(t, 51.1, stats[0].Center.Latitude, 1e-9)
+	assert.Equal(t, "north", stats[1].ZoneIdentifier)
+	assert.Equal(t, 0.5, stats[1].Scooters)
+	assert.Equal(t, 1, stats[1].TripStarts)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+var (
+	baseDir  = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	outDir   = flag.String("out", "./anonymized", "Directory where to put the anonymized archive")
+	saltPath = flag.String("salt", "./.salt", "Path of the salt file, created if it does not exist. Do not share it!")
+)
+
+func main() {
+	flag.Parse()
+
+	salt, err := sharealyzer.LoadOrCreateSalt(*saltPath)
+	if err != nil {
+		log.Fatalf("Failed to load salt: %s", err)
+	}
+	pseudonymizer := sharealyzer.NewPseudonymizer(salt)
+
+	dayFolders, err := archive.DayFolders(*baseDir)
+	if err != nil {
+		log.Fatalf("Failed to list day folders: %s", err)
+	}
+	filesWritten := 0
+	skipped := 0
+	// The anonymized files are indexed like freshly scraped ones
+	writer := &sharealyzer.GZippedFileWriter{BaseDir: *outDir}
+	for _, dayFolder := range dayFolders {
+		files, err := archive.ScrapeFiles(dayFolder)
+		if err != nil {
+			log.Fatalf("Failed to list scrape files: %s", err)
+		}
+		for _, file := range files {
+			provider, date, err := archive.ParseLocalFileName(file)
+			if err != nil {
+				log.Printf("[WARNING] Skipping file %s: %s", file, err)
+				skipped++
+				continue
+			}
+			records, format, err := readAnonymized(file, pseudonymizer)
+			if err != nil {
+				log.Printf("[WARNING] Skipping unreadable file %s: %s", file, err)
+				skipped++
+				continue
+			}
+			// The anonymized file keeps the format and the name of the original one
+			writer.Format = format
+			if err := writer.WriteFile(&sharealyzer.RawScrapeFile{ProviderName: provider, Date: date, Records: records}); err != nil {
+				log.Fatalf("Failed to write anonymized file of %s: %s", file, err)
+			}
+			filesWritten++
+		}
+	}
+	log.Printf("Wrote %d anonymized files to %s", filesWritten, *outDir)
+	if skipped > 0 {
+		sharealyzer.Exitf(sharealyzer.ExitPartialData, "Skipped %d files", skipped)
+	}
+}
+
+// readAnonymized decodes and anonymizes the scooter records of a scrape file and returns them with the
+// format of the file
+func readAnonymized(path string, p *sharealyzer.Pseudonymizer) ([]json.RawMessage, archive.Format, error) {
+	var records []json.RawMessage
+	format, err := archive.DecodeFile(path, func(record json.RawMessage) error {
+		anonymized, err := circ.AnonymizeRecord(record, p)
+		if err != nil {
+			return err
+		}
+		records = append(records, anonymized)
+		return nil
+	})
+	return records, format, err
+}
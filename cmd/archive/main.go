@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/report"
+)
+
+var (
+	baseDir = flag.String("baseDir", "./out", "Base directory with scraped data")
+	maxGap  = flag.Duration("maxGap", sharealyzer.DefaultMaxScrapeGap, "Report time ranges without snapshots longer than this as missing, used by stats")
+	asJSON  = flag.Bool("json", false, "Print the statistics, tariff changes, survival curves or time budgets as JSON, used by stats, tariffs, survival and timebudget")
+
+	retiredAfter = flag.Duration("retiredAfter", 7*24*time.Hour, "Scooters not seen for this long before the last snapshot are retired, used by survival")
+	cohort       = flag.String("cohort", "month", "Group scooters by the month or week they were deployed in, used by survival")
+	timezone     = flag.String("timezone", "UTC", "Time zone of the months and weeks of the cohorts and the days of the time budgets, used by survival and timebudget")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] stats|tariffs|survival|timebudget\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  stats: summarize snapshots, intervals, file sizes, scooter counts and missing ranges\n")
+	fmt.Fprintf(os.Stderr, "  tariffs: list the changes of the tariffs per provider and zone\n")
+	fmt.Fprintf(os.Stderr, "  survival: estimate the lifetime of scooters per deployment cohort\n")
+	fmt.Fprintf(os.Stderr, "  timebudget: show the time the fleet spent in each state per day\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	switch {
+	case flag.NArg() == 1 && flag.Arg(0) == "stats":
+		showStats()
+	case flag.NArg() == 1 && flag.Arg(0) == "tariffs":
+		showTariffs()
+	case flag.NArg() == 1 && flag.Arg(0) == "survival":
+		showSurvival()
+	case flag.NArg() == 1 && flag.Arg(0) == "timebudget":
+		showTimeBudgets()
+	default:
+		usage()
+		os.Exit(sharealyzer.ExitConfigError)
+	}
+}
+
+// showStats prints the data quality statistics of the archive
+func showStats() {
+	stats, err := archive.ComputeStats(*baseDir, *maxGap)
+	if err != nil {
+		log.Fatalf("Failed to compute statistics of %s: %s", *baseDir, err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			log.Fatalf("Failed to write statistics: %s", err)
+		}
+	} else {
+		printStats(stats)
+	}
+	if stats.Snapshots() == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No snapshots in %s", *baseDir)
+	}
+}
+
+// showTariffs prints the timeline of tariff changes found in the archive
+func showTariffs() {
+	results, err := circ.NewFileScraper(*baseDir).Scrape(context.Background(), false)
+	if err == archive.ErrNoScrapeFiles {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No snapshots in %s", *baseDir)
+	} else if err != nil {
+		log.Fatalf("Failed to read %s: %s", *baseDir, err)
+	}
+	tracker := sharealyzer.NewTariffTracker()
+	for res := range circ.ConvertScrapeResult(results) {
+		tracker.Observe(res)
+	}
+	timeline := tracker.Timeline()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(timeline); err != nil {
+			log.Fatalf("Failed to write tariff changes: %s", err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "Date\tProvider\tZone\tUnlock\tPer minute\tBefore\t")
+		for _, change := range timeline {
+			before := "-"
+			if change.Previous != nil {
+				before = fmt.Sprintf("%s + %s/min", euro(change.Previous.InitPrice), euro(change.Previous.UnitPrice))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", change.Date.Format(time.RFC3339), change.Provider, change.Zone,
+				euro(change.Tariff.InitPrice), euro(change.Tariff.UnitPrice), before)
+		}
+		w.Flush()
+	}
+	if len(timeline) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No snapshots in %s", *baseDir)
+	}
+}
+
+// showSurvival prints Kaplan-Meier survival curves of the scooters per deployment cohort
+func showSurvival() {
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid time zone %s: %s", *timezone, err)
+	}
+	var cohortOf report.Cohort
+	switch *cohort {
+	case "month":
+		cohortOf = report.MonthlyCohort(loc)
+	case "week":
+		cohortOf = report.WeeklyCohort(loc)
+	default:
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Unknown cohort %s, use month or week", *cohort)
+	}
+	results, err := circ.NewFileScraper(*baseDir).Scrape(context.Background(), false)
+	if err == archive.ErrNoScrapeFiles {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No snapshots in %s", *baseDir)
+	} else if err != nil {
+		log.Fatalf("Failed to read %s: %s", *baseDir, err)
+	}
+	tracker := report.NewLifetimeTracker()
+	for res := range circ.ConvertScrapeResult(results) {
+		tracker.Observe(res)
+	}
+	lifetimes := tracker.Lifetimes(*retiredAfter)
+	if len(lifetimes) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No scooters in %s", *baseDir)
+	}
+	curves := report.SurvivalCurves(lifetimes, cohortOf)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(curves); err != nil {
+			log.Fatalf("Failed to write survival curves: %s", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Cohort\tScooters\tRetired\tMedian lifetime\t")
+	for _, curve := range curves {
+		median := "-"
+		if lifetime, found := curve.MedianLifetime(); found {
+			median = fmt.Sprintf("%.1f days", lifetime.Hours()/24)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t\n", curve.Cohort, curve.Scooters, curve.Retired, median)
+	}
+	w.Flush()
+	for _, curve := range curves {
+		fmt.Printf("\n%s:\n", curve.Cohort)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "Age (days)\tAt risk\tRetired\tSurvival\t")
+		for _, p := range curve.Points {
+			fmt.Fprintf(w, "%.1f\t%d\t%d\t%.3f\t\n", p.Age.Hours()/24, p.AtRisk, p.Retired, p.Survival)
+		}
+		w.Flush()
+	}
+}
+
+// budgetStates are the states shown by timebudget in the order they are stacked, with the symbol of their bar
+var budgetStates = []struct {
+	state  sharealyzer.ScooterState
+	symbol string
+}{
+	{sharealyzer.IdleRentable, "#"},
+	{sharealyzer.InUse, ">"},
+	{sharealyzer.Broken, "x"},
+	{sharealyzer.Missing, "."},
+}
+
+// showTimeBudgets prints the share of time the fleet spent in each state per day as stacked bars
+func showTimeBudgets() {
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid time zone %s: %s", *timezone, err)
+	}
+	results, err := circ.NewFileScraper(*baseDir).Scrape(context.Background(), false)
+	if err == archive.ErrNoScrapeFiles {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No snapshots in %s", *baseDir)
+	} else if err != nil {
+		log.Fatalf("Failed to read %s: %s", *baseDir, err)
+	}
+	// circ hides rented scooters, so the trips detected from their disappearance tell in use from missing
+	observed, detected := circ.SplitChan(results)
+	tripsDone := make(chan []*sharealyzer.Trip)
+	go func() {
+		var trips []*sharealyzer.Trip
+		for trip := range sharealyzer.ClassifyTrip(circ.NewTripAggregator().Aggregate(detected)) {
+			trips = append(trips, trip)
+		}
+		tripsDone <- trips
+	}()
+	tracker := report.NewTimeBudgetTracker(loc)
+	for res := range circ.ConvertScrapeResult(observed) {
+		tracker.Observe(res)
+	}
+	tracker.AddTrips(<-tripsDone)
+	budgets := tracker.Budgets()
+	if len(budgets) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "Less than two snapshots in %s", *baseDir)
+	}
+	fleet := report.FleetTimeBudgets(budgets)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(struct {
+			Fleet    []report.FleetTimeBudget `json:"fleet"`
+			Scooters []report.TimeBudget      `json:"scooters"`
+		}{fleet, budgets}); err != nil {
+			log.Fatalf("Failed to write time budgets: %s", err)
+		}
+		return
+	}
+
+	const barWidth = 40
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "Day\tScooters\t")
+	for _, s := range budgetStates {
+		fmt.Fprintf(w, "%s (%s)\t", s.state, s.symbol)
+	}
+	fmt.Fprintln(w, "\t")
+	for _, day := range fleet {
+		fmt.Fprintf(w, "%s\t%d\t", day.Day, day.Scooters)
+		bar, width := "", 0
+		for _, s := range budgetStates {
+			share := day.Share(s.state)
+			fmt.Fprintf(w, "%.1f%%\t", share*100)
+			n := int(share*barWidth + 0.5)
+			if width+n > barWidth {
+				n = barWidth - width
+			}
+			bar += strings.Repeat(s.symbol, n)
+			width += n
+		}
+		fmt.Fprintf(w, "%s\t\n", bar)
+	}
+	w.Flush()
+}
+
+func euro(cents int) string {
+	return fmt.Sprintf("%.2f €", float64(cents)/100)
+}
+
+func printStats(stats *archive.Stats) {
+	fmt.Printf("%d snapshots in %d day folders, %s\n\n", stats.Snapshots(), len(stats.Days), byteSize(stats.Size()))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Folder\tSnapshots\tEmpty\tSize\tMin size\tMax size\tMin scooters\tMean scooters\tMax scooters\t")
+	for _, day := range stats.Days {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%d\t%.1f\t%d\t\n", day.Folder, day.Snapshots, day.Empty,
+			byteSize(day.Size), byteSize(day.MinSize), byteSize(day.MaxSize), day.MinScooters, day.MeanScooters, day.MaxScooters)
+	}
+	w.Flush()
+
+	fmt.Println("\nIntervals between snapshots:")
+	if len(stats.Intervals) > 0 {
+		fmt.Printf("  min %s, median %s, p95 %s, p99 %s, max %s\n", stats.Intervals[0].Interval,
+			stats.IntervalPercentile(50), stats.IntervalPercentile(95), stats.IntervalPercentile(99),
+			stats.Intervals[len(stats.Intervals)-1].Interval)
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, interval := range stats.Intervals {
+		fmt.Fprintf(w, "  %s\t%d\t\n", interval.Interval, interval.Count)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d missing ranges:\n", len(stats.Gaps))
+	for _, gap := range stats.Gaps {
+		fmt.Printf("  %s %s - %s (%s)\n", gap.Provider, gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339), gap.Duration())
+	}
+}
+
+func byteSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/nominatim"
+	"github.com/dereulenspiegel/sharealyzer/overpass"
+)
+
+var (
+	baseDir        = flag.String("baseDir", "./out", "Base directory of the scrape archive, layers are stored in its context folder")
+	layers         = flag.String("layers", "bike_lanes,transit_stops,city_boundaries", "Comma separated context layers to fetch")
+	overpassURL    = flag.String("overpassURL", overpass.DefaultURL, "Interpreter endpoint of the Overpass API")
+	city           = flag.String("city", "", "Derive the area from the bounding box of this city via Nominatim")
+	latTopLeft     = flag.Float64("latTopLeft", 51.582780, "Latitude Top Left")
+	lonTopLeft     = flag.Float64("lonTopLeft", 7.325945, "Longitude Top Left")
+	latBottomRight = flag.Float64("latBottomRight", 51.475727, "Latitude Bottom Right")
+	lonBottomRight = flag.Float64("lonBottomRight", 7.558172, "Longitude Bottom Right")
+)
+
+func main() {
+	flag.Parse()
+
+	box := nominatim.BoundingBox{
+		LatTopLeft:     *latTopLeft,
+		LonTopLeft:     *lonTopLeft,
+		LatBottomRight: *latBottomRight,
+		LonBottomRight: *lonBottomRight,
+	}
+	if *city != "" {
+		place, err := nominatim.New().City(*city)
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to resolve city %s: %s", *city, err)
+		}
+		box = place.BoundingBox
+	}
+
+	client := overpass.New(overpass.WithURL(*overpassURL))
+	for _, name := range strings.Split(*layers, ",") {
+		layer := overpass.Layer(strings.TrimSpace(name))
+		if _, err := overpass.Query(layer, box); err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s", err)
+		}
+		contextLayer, err := client.Fetch(layer, box)
+		if err != nil {
+			log.Fatalf("Failed to fetch %s: %s", layer, err)
+		}
+		if err := contextLayer.Save(*baseDir); err != nil {
+			log.Fatalf("Failed to store %s: %s", layer, err)
+		}
+		log.Printf("Stored %d features of %s in %s", len(contextLayer.Features), layer, overpass.LayerPath(*baseDir, layer))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+var (
+	baseDir        = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	zonesPath      = flag.String("zones", "", "GeoJSON FeatureCollection with a polygon per zone, named by the name property. The properties min_scooters and min_charge override the defaults per zone.")
+	minScooters    = flag.Int("minScooters", 3, "Number of available scooters every zone needs at least")
+	minCharge      = flag.Float64("minCharge", 20, "Charge in percent a rentable scooter needs to count as available")
+	violationsPath = flag.String("violations", "./coverage.jsonl", "Append all violations as JSON lines to this file")
+	followFiles    = flag.Bool("follow", true, "Continuously evaluate new scrape files, otherwise stop after the existing files")
+	pprof          = flag.String("pprof", "", "Serve profiling endpoints on this address, i.e. localhost:6060")
+)
+
+func main() {
+	flag.Parse()
+	sharealyzer.ServeProfiling(*pprof)
+
+	if *zonesPath == "" {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "No zones given, use -zones")
+	}
+	data, err := ioutil.ReadFile(*zonesPath)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to read zones: %s", err)
+	}
+	zones, err := sharealyzer.ParseCoverageZones(data, *minScooters, *minCharge)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse zones %s: %s", *zonesPath, err)
+	}
+	if len(zones) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s contains no zone", *zonesPath)
+	}
+
+	f, err := os.OpenFile(*violationsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %s", *violationsPath, err)
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("Exiting due to signal %s", sig.String())
+		cancel()
+	}()
+
+	results, err := circ.NewFileScraper(*baseDir).Scrape(ctx, *followFiles)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %s", *baseDir, err)
+	}
+	monitor := sharealyzer.NewCoverageMonitor(zones)
+	violations := 0
+	for res := range circ.ConvertScrapeResult(results) {
+		started, ended := monitor.Observe(res)
+		for _, violation := range started {
+			log.Printf("[WARNING] %s has %d of %d available scooters since %s", violation.Zone, violation.MinAvailable,
+				violation.Required, violation.From.Format(time.RFC3339))
+		}
+		for _, violation := range ended {
+			log.Printf("%s is covered again after %s", violation.Zone, violation.Duration())
+			if err := encoder.Encode(violation); err != nil {
+				log.Fatalf("Failed to record violation: %s", err)
+			}
+			violations++
+		}
+	}
+	// Violations which still last are recorded without end
+	for _, violation := range monitor.Open() {
+		if err := encoder.Encode(violation); err != nil {
+			log.Fatalf("Failed to record violation: %s", err)
+		}
+		violations++
+	}
+	log.Printf("Recorded %d violations of %d zones in %s", violations, len(zones), *violationsPath)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
+
+var (
+	baseDir  = flag.String("baseDir", "./out", "Base directory with scraped data")
+	outDir   = flag.String("out", "./downsampled", "Directory where to put the downsampled archive")
+	interval = flag.Duration("interval", time.Minute*5, "Interval of the downsampled archive, i.e. 5m or 15m")
+)
+
+func main() {
+	flag.Parse()
+
+	report, err := archive.Downsample(*baseDir, *outDir, *interval)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitFailure, "Failed to downsample archive: %s", err)
+	}
+	log.Printf("Kept %d files, dropped %d files", report.Kept, report.Dropped)
+	if report.Kept == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No scrape files in %s", *baseDir)
+	}
+}
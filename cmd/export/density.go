@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/export"
+)
+
+var (
+	minZoom  = flag.Int("minZoom", 10, "Lowest zoom level of the exported tiles, used by tiles")
+	maxZoom  = flag.Int("maxZoom", 16, "Highest zoom level of the exported tiles, also determines the grid of the kepler density")
+	timezone = flag.String("timezone", "UTC", "Time zone of the hours of day of tiles and the kepler density, i.e. Europe/Berlin")
+)
+
+// exportTiles writes vector tiles with the average density of available scooters and the density of trip
+// starts per hour of day within -from and -to
+func exportTiles(dir string) {
+	if *minZoom < 0 || *minZoom > *maxZoom || *maxZoom > 20 {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid zoom range %d to %d", *minZoom, *maxZoom)
+	}
+	scooters, tripStarts, _ := readDensities()
+	written, err := export.WriteMVTTiles(dir, *minZoom,
+		export.DensityLayer{Name: "scooters", Density: scooters},
+		export.DensityLayer{Name: "trip_starts", Density: tripStarts})
+	if err != nil {
+		log.Fatalf("Failed to write tiles: %s", err)
+	}
+	log.Printf("Wrote %d tiles to %s", written, dir)
+}
+
+// readDensities returns the average density of available scooters and the density of trip starts per hour
+// of day within -from and -to on a grid for -maxZoom, together with the trips within -from and -to
+func readDensities() (*export.Density, *export.Density, []*sharealyzer.Trip) {
+	start, end := timeRange()
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid time zone %s: %s", *timezone, err)
+	}
+
+	scooters := export.NewDensity(*maxZoom, loc)
+	results, err := readArchive()
+	if err != nil {
+		log.Fatalf("Failed to read archive: %s", err)
+	}
+	for res := range results {
+		scooters.AddSample(res.ScrapeDate())
+		for _, scooter := range res.Scooters() {
+			if scooter.State != sharealyzer.InUse && scooter.Location != nil {
+				scooters.Add(scooter.Location, res.ScrapeDate())
+			}
+		}
+	}
+
+	tripStarts := export.NewDensity(*maxZoom, loc)
+	allTrips, err := readTrips(nil)
+	if err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	var trips []*sharealyzer.Trip
+	for _, trip := range allTrips {
+		if !trip.StartTime.Before(start) && trip.StartTime.Before(end) && trip.StartLocation != nil {
+			tripStarts.Add(trip.StartLocation, trip.StartTime)
+			trips = append(trips, trip)
+		}
+	}
+	return scooters, tripStarts, trips
+}
+
+// exportKepler writes a kepler.gl map with trip arcs and a scooter density hexagon layer together with
+// the datasets as CSV into dir
+func exportKepler(dir string) {
+	scooters, _, trips := readDensities()
+	tripsDataset := export.TripsDataset(trips)
+	densityDataset := export.DensityDataset("scooter_density", "Available scooters", scooters)
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		log.Fatalf("Failed to create %s: %s", dir, err)
+	}
+	files := map[string]func(io.Writer) error{
+		"kepler.json":         export.NewKeplerMap(tripsDataset, densityDataset).Write,
+		"trips.csv":           tripsDataset.WriteCSV,
+		"scooter_density.csv": densityDataset.WriteCSV,
+	}
+	for name, write := range files {
+		if err := writeFile(filepath.Join(dir, name), write); err != nil {
+			log.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+	log.Printf("Wrote kepler.gl map with %d trips and %d density cells to %s", len(tripsDataset.Rows),
+		len(densityDataset.Rows), dir)
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
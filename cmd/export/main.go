@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/duckdb"
+	"github.com/dereulenspiegel/sharealyzer/export"
+)
+
+var (
+	timeFormat    = "2006-01-02T15:04"
+	format        = flag.String("format", "", "Output format, defaults to the first format supported by the command")
+	outPath       = flag.String("out", "-", "Output file, - writes to stdout")
+	tripStorePath = flag.String("tripStore", "./trips.jsonl", "File with trips written by the ingester, used by trips, tiles, kepler, duckdb, ics and shapefile")
+	baseDir       = flag.String("baseDir", "./out", "Base directory with scraped circ data, used by all commands reading scrapes")
+	startTime     = flag.String("from", "2019-10-06T00:01", "Start of the time range, used by all commands reading scrapes")
+	endTime       = flag.String("to", "2019-10-07T00:01", "End of the time range, used by all commands reading scrapes")
+	cacheDir      = flag.String("cacheDir", "", "Cache the parsed scrape days in this directory, used by all commands reading scrapes")
+	saltPath      = flag.String("salt", "", "Salt used to anonymize the trips, used by ics to find the trips of a real user ID")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] trips [trip id...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] trace <scooter id>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] positions <time>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] observations\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] tiles <directory>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] kepler <directory>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] duckdb <database>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] ics <user id>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] shapefile <directory>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Formats:\n")
+	for _, command := range []string{"trips", "trace", "positions", "observations", "tiles", "kepler", "duckdb", "ics", "shapefile"} {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", command, strings.Join(formats[command], ", "))
+	}
+	flag.PrintDefaults()
+}
+
+// formats lists the supported output formats of every command
+var formats = map[string][]string{
+	"trips":        {"gpx", "kml", "kmz", "arrow"},
+	"trace":        {"gpx"},
+	"positions":    {"kml", "kmz"},
+	"observations": {"csv", "jsonl", "arrow"},
+	"tiles":        {"mvt"},
+	"kepler":       {"kepler"},
+	"duckdb":       {"duckdb"},
+	"ics":          {"ics"},
+	"shapefile":    {"shapefile"},
+}
+
+// checkFormat applies the default format of the command and exits if the format isn't supported
+func checkFormat(command string) {
+	supported := formats[command]
+	if len(supported) == 0 {
+		return
+	}
+	if *format == "" {
+		*format = supported[0]
+	}
+	for _, f := range supported {
+		if f == *format {
+			return
+		}
+	}
+	sharealyzer.Exitf(sharealyzer.ExitConfigError, "Format %s can't be used for %s, use one of %s",
+		*format, command, strings.Join(supported, ", "))
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	checkFormat(flag.Arg(0))
+
+	var write func(io.Writer) error
+	switch {
+	case flag.NArg() >= 1 && flag.Arg(0) == "trips":
+		trips, err := readTrips(flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Failed to read trips: %s", err)
+		}
+		switch *format {
+		case "gpx":
+			write = export.TripsGPX(trips).Write
+		case "arrow":
+			write = func(w io.Writer) error {
+				return export.WriteTripsArrow(w, trips)
+			}
+		default:
+			write = kmlWriter(export.TripsKML(trips))
+		}
+	case flag.NArg() == 2 && flag.Arg(0) == "trace":
+		trace, err := readTrace(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+		write = export.TraceGPX("Scooter "+flag.Arg(1), trace).Write
+	case flag.NArg() == 2 && flag.Arg(0) == "positions":
+		at, err := time.Parse(timeFormat, flag.Arg(1))
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse time: %s", err)
+		}
+		results, err := readArchive()
+		if err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+		res := export.ScrapeAt(results, at)
+		if res == nil {
+			log.Fatalf("No scrape before %s", at)
+		}
+		write = kmlWriter(export.ScootersKML(res))
+	case flag.NArg() == 1 && flag.Arg(0) == "observations":
+		results, err := readArchive()
+		if err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+		write = func(w io.Writer) error {
+			writeObservations := export.WriteObservationsCSV
+			switch *format {
+			case "jsonl":
+				writeObservations = export.WriteObservationsJSONL
+			case "arrow":
+				writeObservations = export.WriteObservationsArrow
+			}
+			rows, err := writeObservations(w, results)
+			log.Printf("Exported %d observations", rows)
+			return err
+		}
+	case flag.NArg() == 2 && flag.Arg(0) == "tiles":
+		exportTiles(flag.Arg(1))
+		return
+	case flag.NArg() == 2 && flag.Arg(0) == "kepler":
+		exportKepler(flag.Arg(1))
+		return
+	case flag.NArg() == 2 && flag.Arg(0) == "shapefile":
+		exportShapefile(flag.Arg(1))
+		return
+	case flag.NArg() == 2 && flag.Arg(0) == "duckdb":
+		results, err := readArchive()
+		if err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+		rows, err := duckdb.Materialize(duckdb.Open(flag.Arg(1)), results, *tripStorePath)
+		if err != nil {
+			log.Fatalf("Failed to materialize archive: %s", err)
+		}
+		log.Printf("Loaded %d observations into %s", rows, flag.Arg(1))
+		return
+	case flag.NArg() == 2 && flag.Arg(0) == "ics":
+		trips, err := userTrips(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to read trips: %s", err)
+		}
+		log.Printf("Found %d trips of user %s", len(trips), flag.Arg(1))
+		write = func(w io.Writer) error {
+			return export.WriteTripsICS(w, "Scooter trips", trips, time.Now())
+		}
+	default:
+		usage()
+		os.Exit(sharealyzer.ExitConfigError)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %s", *outPath, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := write(out); err != nil {
+		log.Fatalf("Failed to write %s: %s", *format, err)
+	}
+}
+
+// readTrips reads the trips with the given ids or all trips if no id is given
+func readTrips(ids []string) ([]*sharealyzer.Trip, error) {
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var trips []*sharealyzer.Trip
+	store := &sharealyzer.FileTripStore{Path: *tripStorePath}
+	err := store.Each(func(t *sharealyzer.Trip) bool {
+		if len(wanted) == 0 || wanted[t.ID] {
+			trips = append(trips, t)
+		}
+		return true
+	})
+	return trips, err
+}
+
+// userTrips reads all trips of the user. The user ID may be given as is or, if the trips were anonymized,
+// as pseudonym. With -salt the pseudonym is derived from the real user ID.
+func userTrips(userID string) ([]*sharealyzer.Trip, error) {
+	ids := map[string]bool{userID: true}
+	if *saltPath != "" {
+		salt, err := ioutil.ReadFile(*saltPath)
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to read salt: %s", err)
+		}
+		ids[sharealyzer.NewPseudonymizer(salt).Pseudonym(userID)] = true
+	}
+	var trips []*sharealyzer.Trip
+	store := &sharealyzer.FileTripStore{Path: *tripStorePath}
+	err := store.Each(func(t *sharealyzer.Trip) bool {
+		if t.UserID != "" && ids[t.UserID] {
+			trips = append(trips, t)
+		}
+		return true
+	})
+	return trips, err
+}
+
+func kmlWriter(doc *export.KML) func(io.Writer) error {
+	if *format == "kmz" {
+		return doc.WriteKMZ
+	}
+	return doc.Write
+}
+
+// timeRange parses -from and -to
+func timeRange() (time.Time, time.Time) {
+	start, err := time.Parse(timeFormat, *startTime)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse start time: %s", err)
+	}
+	end, err := time.Parse(timeFormat, *endTime)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse end time: %s", err)
+	}
+	return start, end
+}
+
+// readArchive reads the scrapes between -from and -to
+func readArchive() (<-chan sharealyzer.ScrapeResult, error) {
+	results, err := readCircArchive()
+	if err != nil {
+		return nil, err
+	}
+	return circ.ConvertScrapeResult(results), nil
+}
+
+// readCircArchive reads the scrapes between -from and -to with the circ specific fields like zones
+func readCircArchive() (<-chan *circ.ScrapeResult, error) {
+	start, end := timeRange()
+	readArchive := circ.ReadArchive
+	if *cacheDir != "" {
+		readArchive = (&circ.DayCache{Dir: *cacheDir}).ReadArchive
+	}
+	results, _, err := readArchive(*baseDir, start, end)
+	return results, err
+}
+
+// readTrace reads the positions of the scooter from the archive
+func readTrace(scooterID string) ([]export.TracePoint, error) {
+	results, err := readArchive()
+	if err != nil {
+		return nil, err
+	}
+	return export.ScooterTrace(results, scooterID), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/export"
+)
+
+// exportShapefile writes the endpoints of the trips within -from and -to and the statistics of the circ zones
+// as shapefiles into dir
+func exportShapefile(dir string) {
+	start, end := timeRange()
+	allTrips, err := readTrips(nil)
+	if err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	var trips []*sharealyzer.Trip
+	for _, trip := range allTrips {
+		if !trip.StartTime.Before(start) && trip.StartTime.Before(end) {
+			trips = append(trips, trip)
+		}
+	}
+	results, err := readCircArchive()
+	if err != nil {
+		log.Fatalf("Failed to read archive: %s", err)
+	}
+	stats := circ.ZoneStatistics(results, trips)
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		log.Fatalf("Failed to create %s: %s", dir, err)
+	}
+	if err := export.TripEndpointsShapefile(filepath.Join(dir, "trip_endpoints"), trips); err != nil {
+		log.Fatalf("Failed to write trip endpoints: %s", err)
+	}
+
+	fields := []export.ShapeField{
+		{Name: "zone", Type: export.ShapeCharacter, Length: 80},
+		{Name: "scooters", Type: export.ShapeNumeric, Length: 10, Decimals: 2},
+		{Name: "trips", Type: export.ShapeNumeric, Length: 10},
+	}
+	points := make([]export.ShapePoint, 0, len(stats))
+	for _, zone := range stats {
+		points = append(points, export.ShapePoint{
+			Location: zone.Center,
+			Values:   []interface{}{zone.ZoneIdentifier, zone.Scooters, zone.TripStarts},
+		})
+	}
+	if err := export.WritePointShapefile(filepath.Join(dir, "zones"), fields, points); err != nil {
+		log.Fatalf("Failed to write zones: %s", err)
+	}
+	log.Printf("Wrote shapefiles with %d trips and %d zones to %s", len(trips), len(stats), dir)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/gbfs"
+)
+
+var (
+	baseDir  = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	listen   = flag.String("listen", ":8080", "Address to serve the GBFS feed on")
+	baseURL  = flag.String("baseURL", "http://localhost:8080", "Public URL of the feed, used in gbfs.json")
+	saltPath = flag.String("salt", "./.salt", "Path of the salt used to pseudonymize bike identifiers, created if it does not exist")
+	systemID = flag.String("systemID", "sharealyzer_circ", "System ID of the feed")
+	name     = flag.String("name", "circ (sharealyzer)", "Name of the system")
+	language = flag.String("language", "en", "Language of the feed")
+	timezone = flag.String("timezone", "Europe/Berlin", "Timezone of the system")
+	ttl      = flag.Duration("ttl", time.Minute*1, "How long clients and the server cache the feed, usually the scrape interval")
+	pprof    = flag.String("pprof", "", "Serve profiling endpoints on this address, i.e. localhost:6060")
+)
+
+// latestScrape reads the most recent scrape file of the archive
+func latestScrape() (sharealyzer.ScrapeResult, error) {
+	path, err := archive.LatestFile(*baseDir)
+	if err != nil {
+		return nil, err
+	}
+	res, err := circ.ReadScrapeFile(path)
+	if err != nil {
+		log.Printf("[WARNING] Failed to read latest scrape %s: %s", path, err)
+		return nil, err
+	}
+	return res.Generic(), nil
+}
+
+func main() {
+	flag.Parse()
+	sharealyzer.ServeProfiling(*pprof)
+
+	salt, err := sharealyzer.LoadOrCreateSalt(*saltPath)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to load salt: %s", err)
+	}
+	server := gbfs.NewServer(gbfs.SystemInformation{
+		SystemID: *systemID,
+		Language: *language,
+		Name:     *name,
+		Timezone: *timezone,
+	}, latestScrape, *baseURL, salt)
+	server.TTL = *ttl
+
+	log.Printf("Serving GBFS feed on %s", *listen)
+	if err := http.ListenAndServe(*listen, server); err != nil {
+		log.Fatalf("Failed to serve GBFS feed: %s", err)
+	}
+}
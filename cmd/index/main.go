@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
+
+var (
+	baseDir = flag.String("baseDir", "./out", "Base directory with scraped data")
+	force   = flag.Bool("force", false, "Rebuild the index of every day folder, not only of those without a fresh index")
+	verify  = flag.Bool("verify", false, "Verify the checksums of all indexed files instead of indexing")
+)
+
+func main() {
+	flag.Parse()
+
+	if *verify {
+		verifyChecksums()
+		return
+	}
+
+	dayFolders, err := archive.DayFolders(*baseDir)
+	if err != nil {
+		log.Fatalf("Failed to list day folders: %s", err)
+	}
+	indexed := 0
+	for _, dayFolder := range dayFolders {
+		if !*force && archive.IndexFresh(dayFolder) {
+			continue
+		}
+		entries, err := archive.BuildIndex(dayFolder)
+		if err != nil {
+			log.Fatalf("Failed to index %s: %s", dayFolder, err)
+		}
+		log.Printf("Indexed %d files in %s", len(entries), dayFolder)
+		indexed++
+	}
+	log.Printf("Indexed %d of %d day folders", indexed, len(dayFolders))
+}
+
+func verifyChecksums() {
+	report, err := archive.Verify(*baseDir)
+	if err != nil {
+		log.Fatalf("Failed to verify checksums: %s", err)
+	}
+	for _, file := range report.Mismatched {
+		log.Printf("[WARNING] Checksum mismatch of %s", file)
+	}
+	for _, file := range report.Missing {
+		log.Printf("[WARNING] Indexed file %s is missing", file)
+	}
+	for _, file := range report.Unindexed {
+		log.Printf("[WARNING] File %s is not indexed", file)
+	}
+	log.Printf("Verified %d files, %d mismatched, %d missing, %d unindexed, %d without checksum",
+		report.Checked, len(report.Mismatched), len(report.Missing), len(report.Unindexed), report.Unverified)
+	if report.Failed() {
+		sharealyzer.Exitf(sharealyzer.ExitPartialData, "Archive in %s failed verification", *baseDir)
+	}
+}
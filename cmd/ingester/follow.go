@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/postgres"
+)
+
+// follow continuously aggregates new scrape files into trips and stores them in the sinks until
+// the process receives SIGINT or SIGTERM. Observations rejected by the validator are left out.
+func follow(baseDir string, sinks map[string]sharealyzer.TripSink, validator *sharealyzer.Validator) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("Exiting due to signal %s", sig.String())
+		cancel()
+	}()
+
+	results, err := circ.NewFileScraper(baseDir).Scrape(ctx, true)
+	if err != nil {
+		return fmt.Errorf("Failed to watch %s: %s", baseDir, err)
+	}
+	aggregator := newTripAggregator()
+	defer aggregator.Spill.Close()
+	if *tripHistoryPath != "" {
+		// Trips stored before a restart are finished again while the existing files are read
+		aggregator.History = &sharealyzer.TripHistory{Path: *tripHistoryPath}
+		if err := aggregator.History.Load(); err != nil {
+			return fmt.Errorf("Failed to load trip history: %s", err)
+		}
+	}
+	tripCount, openCount := 0, 0
+	aggregator.OpenTrips = func(trip *sharealyzer.Trip) {
+		openCount++
+	}
+	sequencer := &sharealyzer.Sequencer{Window: *reorderWindow}
+	batches := aggregator.AggregateBatches(
+		sharealyzer.ValidateScrapeResults(sequencer.Sequence(circ.ConvertScrapeResult(results)), validator),
+		sharealyzer.DefaultBatchSize, sharealyzer.DefaultBatchLatency)
+	group := &sharealyzer.SinkGroup{Sinks: sinks}
+	err = group.Deliver(sharealyzer.ClassifyTripBatches(batches), func(batch []*sharealyzer.Trip) {
+		tripCount = tripCount + len(batch)
+		if aggregator.History != nil {
+			aggregator.History.Add(batch)
+			if err := aggregator.History.Save(); err != nil {
+				log.Printf("[WARNING] Failed to save trip history: %s", err)
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to store trips after %d stored trips: %s", tripCount, err)
+	}
+	log.Printf("Stored %d trips, dropped %d already stored trips, %d scooters were still on a trip, %d trips never finished, %d reservations, %d outages",
+		tripCount, aggregator.DuplicateTrips(), openCount, aggregator.LostTripCount(), aggregator.ReservationCount(), aggregator.OutageCount())
+	return nil
+}
+
+// newTripAggregator creates a TripAggregator configured by the flags, which is used for batch runs and
+// following alike
+func newTripAggregator() *sharealyzer.TripAggregator {
+	aggregator := sharealyzer.NewTripAggregator()
+	aggregator.MaxUnfinishedTrips = *maxUnfinished
+	aggregator.MaxLocationAge = *maxLocationAge
+	aggregator.MaxReservationDuration = *maxReservation
+	aggregator.MaxTripAge = *maxTripAge
+	aggregator.MaxScrapeGap = *maxScrapeGap
+	aggregator.Spill = &sharealyzer.TripSpill{Dir: *spillDir}
+	return aggregator
+}
+
+// newSinks returns the sinks enabled by the flags, the Postgres database is provisioned first. The trip store
+// is returned as well, so it can be closed after storing.
+func newSinks() (map[string]sharealyzer.TripSink, *sharealyzer.FileTripStore, error) {
+	sinks := make(map[string]sharealyzer.TripSink)
+	var tripStore *sharealyzer.FileTripStore
+	if *tripStorePath != "" {
+		tripStore = &sharealyzer.FileTripStore{Path: *tripStorePath}
+		sinks["tripStore"] = sharealyzer.TripStoreSink{TripStore: tripStore}
+	}
+	if *postgresURL != "" {
+		db := postgres.Open(*postgresURL)
+		if err := postgres.Provision(db); err != nil {
+			return nil, nil, err
+		}
+		sinks["postgres"] = &postgres.Sink{DB: db}
+	}
+	return sinks, tripStore, nil
+}
@@ -2,36 +2,128 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
 	"github.com/dereulenspiegel/sharealyzer/circ"
-	"github.com/umahmood/haversine"
 )
 
 var (
-	timeFormat = "2006-01-02T15:04"
-	baseDir    = flag.String("baseDir", "./out", "Base directory with scraped circ data")
-	startTime  = flag.String("startTime", "2019-10-06T00:01", "Parseable time string with  a start time and date")
-	endTime    = flag.String("endTime", "2019-10-07T00:01", "Parseable end time")
+	timeFormat      = "2006-01-02T15:04"
+	baseDir         = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	startTime       = flag.String("startTime", "2019-10-06T00:01", "Parseable time string with  a start time and date")
+	endTime         = flag.String("endTime", "2019-10-07T00:01", "Parseable end time")
+	resume          = flag.Bool("resume", false, "Continue after the last processed file recorded in the checkpoint, storing trips requires -tripHistory")
+	checkpointPath  = flag.String("checkpoint", "./.ingest-checkpoint", "The path where to persist the last processed file date")
+	jsonOutput      = flag.String("json", "", "Write the summary as JSON to this path instead of logging it, use - for stdout")
+	traceScooter    = flag.String("traceScooter", "", "Log every observation and state transition of the scooter with this identifier")
+	tripStorePath   = flag.String("tripStore", "", "Append all detected trips as JSON lines to this file")
+	postgresURL     = flag.String("postgres", "", "Insert all detected trips into the trips table of this Postgres/Timescale database, i.e. postgres://user@localhost/sharealyzer, after creating the table and the views of grafana/views.sql")
+	tripHistoryPath = flag.String("tripHistory", "", "Remember recently stored trips in this file, so following again or resuming after a restart doesn't store them twice")
+	followFiles     = flag.Bool("follow", false, "Continuously aggregate new scrape files into trips and write them to the trip store")
+	cacheDir        = flag.String("cacheDir", "", "Cache the parsed scrape days in this directory, so repeated runs over the same days are faster")
+	workers         = flag.Int("workers", runtime.NumCPU(), "Number of day folders which are read concurrently")
+	maxUnfinished   = flag.Int("maxUnfinishedTrips", 0, "Keep at most this many unfinished trips in memory and spill the rest to disk, 0 means no limit")
+	spillDir        = flag.String("spillDir", "", "Directory for spilled unfinished trips, defaults to the temporary directory")
+	pprof           = flag.String("pprof", "", "Serve profiling endpoints on this address, i.e. localhost:6060")
+	area            = flag.String("area", "", "Drop observations outside of this area given as latTopLeft,lonTopLeft,latBottomRight,lonBottomRight")
+	maxLocationAge  = flag.Duration("maxLocationAge", sharealyzer.DefaultMaxLocationAge, "GPS fixes older than this are stale and not used as trip locations, 0 disables the check")
+	maxReservation  = flag.Duration("maxReservationDuration", sharealyzer.DefaultMaxReservationDuration, "Shorter disappearances without movement or charge loss are reservations instead of trips, 0 disables the check")
+	reorderWindow   = flag.Duration("reorderWindow", sharealyzer.DefaultReorderWindow, "Wait this long for scrape files which are out of order when following")
+	maxTripAge      = flag.Duration("maxTripAge", sharealyzer.TripNeverFinishedTime, "Unfinished trips older than this are considered lost, i.e. because the scooter was removed from service")
+	maxScrapeGap    = flag.Duration("maxScrapeGap", sharealyzer.DefaultMaxScrapeGap, "Gaps between scrape files longer than this are outages after which trip detection restarts, 0 disables this")
+	timezone        = flag.String("timezone", "UTC", "Time zone of the start and end time and of the day folder names, i.e. Europe/Berlin")
 )
 
 func main() {
 	flag.Parse()
-	aggregator := NewCircAggregator(*baseDir)
+	sharealyzer.ServeProfiling(*pprof)
+	validator := &sharealyzer.Validator{}
+	if *area != "" {
+		box, err := sharealyzer.ParseBoundingBox(*area)
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse area: %s", err)
+		}
+		validator.Area = box
+	}
+	if *followFiles {
+		if *tripStorePath == "" && *postgresURL == "" {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Following requires a trip store or a Postgres database")
+		}
+		sinks, tripStore, err := newSinks()
+		if err == nil {
+			err = follow(*baseDir, sinks, validator)
+		}
+		if tripStore != nil {
+			if closeErr := tripStore.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("Failed to close trip store: %s", closeErr)
+			}
+		}
+		sharealyzer.ExitOnError(err)
+		return
+	}
+	sharealyzer.ExitOnError(ingest(validator))
+}
+
+// ingest aggregates the trips between the start and end time. Errors are returned instead of exiting, so the
+// trip store and spill are closed before the process exits.
+func ingest(validator *sharealyzer.Validator) error {
+	aggregator := circ.NewArchiveAggregator(*baseDir)
+	aggregator.Workers = *workers
+	// Trip detection only keeps the scooters of the previous file around
+	aggregator.Reuse = true
+	if *cacheDir != "" {
+		aggregator.Cache = &circ.DayCache{Dir: *cacheDir}
+	}
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return sharealyzer.ExitErrorf(sharealyzer.ExitConfigError, "Failed to load time zone: %s", err)
+	}
+	aggregator.Location = location
 
-	start, err := time.Parse(timeFormat, *startTime)
+	start, err := time.ParseInLocation(timeFormat, *startTime, location)
 	if err != nil {
-		log.Fatalf("Failed to parse start time: %s", err)
+		return sharealyzer.ExitErrorf(sharealyzer.ExitConfigError, "Failed to parse start time: %s", err)
 	}
-	end, err := time.Parse(timeFormat, *endTime)
+	end, err := time.ParseInLocation(timeFormat, *endTime, location)
 	if err != nil {
-		log.Fatalf("Failed to parse end time: %s", err)
+		return sharealyzer.ExitErrorf(sharealyzer.ExitConfigError, "Failed to parse end time: %s", err)
+	}
+	tripAge := *maxTripAge
+	if tripAge <= 0 {
+		tripAge = sharealyzer.TripNeverFinishedTime
+	}
+	checkpoint := &sharealyzer.FileCheckpoint{Path: *checkpointPath}
+	if *resume {
+		// The Postgres sink skips stored trips itself
+		if *tripStorePath != "" && *tripHistoryPath == "" {
+			return sharealyzer.ExitErrorf(sharealyzer.ExitConfigError, "Resuming into a trip store requires a trip history")
+		}
+		lastProcessed, err := checkpoint.Load()
+		if err != nil {
+			return fmt.Errorf("Failed to load checkpoint: %s", err)
+		}
+		// Trips which were unfinished at the checkpoint started at most tripAge before it. Reading their
+		// files again finishes them, the trips finished before the checkpoint are dropped by the history.
+		if resumeTime := lastProcessed.Add(-tripAge); resumeTime.After(start) {
+			log.Printf("Resuming before last processed file from %s at %s", lastProcessed.Format(time.RFC3339),
+				resumeTime.Format(time.RFC3339))
+			start = resumeTime
+		}
 	}
 	log.Printf("Looking at a duration of %.2f hours", end.Sub(start).Hours())
 
 	uniqueScooterIDs, err := aggregator.AggregateUniqueScooters(start, end)
+	if err == archive.ErrNoScrapeFiles {
+		return sharealyzer.ExitErrorf(sharealyzer.ExitNoData, "No scrape files between %s and %s in %s", start.Format(time.RFC3339),
+			end.Format(time.RFC3339), *baseDir)
+	}
 	if err == nil {
 		log.Printf("%d different scooters seem to be active", len(uniqueScooterIDs))
 	} else {
@@ -49,61 +141,139 @@ func main() {
 	})
 	log.Printf("Have found %d unique userIDs", len(uniqueUserIDs))
 
-	lastScooters := make(scooters)
-	var trips []*sharealyzer.Trip
-	var unusuallyLongTrips []*sharealyzer.Trip
-	var chargingTrips []*sharealyzer.Trip
-	unfinishedTrips := make(map[string]*sharealyzer.Trip)
-	filesInspected := 0
-	err = aggregator.Aggregate(start, end, func(fileTime time.Time, sc []*circ.Scooter) error {
-		scooters := newScooters(sc)
-		vanishedScooter := scooters.difference(lastScooters)
-
-		for id, scooter := range vanishedScooter {
-			//log.Printf("Starting trip for scooter: %s", scooter.Identifier)
-			trip := &sharealyzer.Trip{
-				ScooterID:        id,
-				ScooterProvider:  "circ",
-				StartChargeLevel: float64(scooter.EnergyLevel),
-				StartLocation:    sharealyzer.NewGeoLocation(scooter.Latitude, scooter.Longitude),
-				StartTime:        fileTime,
+	var trips, longTrips, chargingTrips, swapTrips, relocationTrips, openTrips, lostTrips []*sharealyzer.Trip
+	tripAggregator := newTripAggregator()
+	defer tripAggregator.Spill.Close()
+	tripAggregator.LostTrips = func(trip *sharealyzer.Trip) {
+		lostTrips = append(lostTrips, trip)
+	}
+	tripAggregator.OpenTrips = func(trip *sharealyzer.Trip) {
+		openTrips = append(openTrips, trip)
+	}
+	if *tripHistoryPath != "" {
+		// The history needs to remember trips as long as they can be finished again after resuming
+		tripAggregator.History = &sharealyzer.TripHistory{Path: *tripHistoryPath}
+		if tripAge > sharealyzer.DefaultTripHistoryRetention {
+			tripAggregator.History.Retention = tripAge
+		}
+		if err := tripAggregator.History.Load(); err != nil {
+			return fmt.Errorf("Failed to load trip history: %s", err)
+		}
+	}
+	tracer := newScooterTracer(*traceScooter)
+	sinks, tripStore, err := newSinks()
+	if err != nil {
+		return err
+	}
+	if tripStore != nil {
+		defer tripStore.Close()
+	}
+	// The trips are stored in batches, so the Postgres sink doesn't run psql for every trip
+	group := &sharealyzer.SinkGroup{Sinks: sinks}
+	batches := make(chan []*sharealyzer.Trip)
+	var storeErr error
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		storeErr = group.Deliver(batches, func(batch []*sharealyzer.Trip) {
+			if tripAggregator.History != nil {
+				tripAggregator.History.Add(batch)
 			}
-			unfinishedTrips[id] = trip
-		}
-		for id, trip := range unfinishedTrips {
-			if scooter, exists := scooters[id]; exists {
-				//log.Printf("Ending trip for scooter: %s", scooter.Identifier)
-				//Scooter is available again, trip is finished
-
-				trip.EndChargeLevel = float64(scooter.EnergyLevel)
-				trip.EndLocation = sharealyzer.NewGeoLocation(scooter.Latitude, scooter.Longitude)
-				trip.UserID = scooter.StateUpdatedByUserIdentifier
-				trip.EndTime = fileTime
-				trip.Duration = trip.EndTime.Sub(trip.StartTime)
-				trip.Cost = uint64(scooter.InitPrice + (scooter.Price * int(trip.Duration.Minutes())))
-
-				_, distanceKm := haversine.Distance(
-					haversine.Coord{Lat: trip.StartLocation.Latitude, Lon: trip.StartLocation.Longitude},
-					haversine.Coord{Lat: trip.EndLocation.Latitude, Lon: trip.EndLocation.Longitude},
-				)
-				trip.Distance = distanceKm
-				if trip.StartChargeLevel-trip.EndChargeLevel > 0 && trip.Duration.Minutes() < 60.0 {
+		})
+	}()
+	// Sending stops once delivering failed, the remaining trips are still counted
+	store := func(batch []*sharealyzer.Trip) {
+		select {
+		case batches <- batch:
+		case <-delivered:
+		}
+	}
+
+	results := make(chan sharealyzer.ScrapeResult, 100)
+	finished := sharealyzer.ClassifyTrip(tripAggregator.Aggregate(sharealyzer.ValidateScrapeResults(results, validator)))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var batch []*sharealyzer.Trip
+		for trip := range finished {
+			switch trip.Type {
+			case sharealyzer.CUSTOMER_TRIP:
+				if trip.Duration >= time.Hour {
+					longTrips = append(longTrips, trip)
+				} else {
 					trips = append(trips, trip)
-				} else if trip.StartChargeLevel-trip.EndChargeLevel < 0 {
-					//log.Printf("scooter %s was charged", scooter.Identifier)
-					chargingTrips = append(chargingTrips, trip)
-				} else if trip.Duration.Minutes() >= 60.0 {
-					unusuallyLongTrips = append(unusuallyLongTrips, trip)
 				}
-
-				delete(unfinishedTrips, id)
+			case sharealyzer.CHARGING_TRIP:
+				chargingTrips = append(chargingTrips, trip)
+			case sharealyzer.BATTERY_SWAP_TRIP:
+				swapTrips = append(swapTrips, trip)
+			case sharealyzer.RELOCATION_TRIP:
+				relocationTrips = append(relocationTrips, trip)
 			}
+			tracer.tripFinished(trip)
+			if len(sinks) > 0 {
+				if batch = append(batch, trip); len(batch) >= sharealyzer.DefaultBatchSize {
+					store(batch)
+					batch = nil
+				}
+			}
+		}
+		if len(batch) > 0 {
+			store(batch)
 		}
+		close(batches)
+		<-delivered
+	}()
+	filesInspected := 0
+	var lastProcessed time.Time
+	err = aggregator.Aggregate(start, end, func(fileTime time.Time, sc []*circ.Scooter) error {
+		// The circ scooters are reused for the next file, the generic result is a copy of them
+		res := (&circ.ScrapeResult{Date: fileTime, Scooters: sc}).Generic()
+		tracer.observe(fileTime, sharealyzer.NewScooters(res.Scooters()))
+		results <- res
 		filesInspected = filesInspected + 1
-		lastScooters = scooters
+		lastProcessed = fileTime
 		return nil
 	})
-	log.Printf("Found %d charging trips in %d files", len(chargingTrips), filesInspected)
+	close(results)
+	<-done
+	if err != nil {
+		log.Printf("[WARNING] Aggregation stopped early: %s", err)
+	}
+	if tripAggregator.History != nil && len(sinks) > 0 {
+		// Saved even if storing failed, so the stored trips aren't stored again
+		if err := tripAggregator.History.Save(); err != nil {
+			log.Printf("[ERROR] Failed to save trip history: %s", err)
+		}
+	}
+	if storeErr != nil {
+		return fmt.Errorf("Failed to store trips: %s", storeErr)
+	}
+	log.Printf("Found %d charging trips and %d battery swaps in %d files", len(chargingTrips), len(swapTrips), filesInspected)
+	log.Printf("%d relocations, %d reservations, %d outages, dropped %d already stored trips", len(relocationTrips),
+		tripAggregator.ReservationCount(), tripAggregator.OutageCount(), tripAggregator.DuplicateTrips())
+	log.Printf("%d scooters were still on a trip at the end, %d trips never finished", len(openTrips), len(lostTrips))
+	if !lastProcessed.IsZero() {
+		if err := checkpoint.Save(lastProcessed); err != nil {
+			log.Printf("[ERROR] Failed to save checkpoint: %s", err)
+		}
+	}
+	if *jsonOutput != "" {
+		summary := newSummary(start, end, filesInspected, len(uniqueScooterIDs), len(uniqueUserIDs), map[string][]*sharealyzer.Trip{
+			"regular":      trips,
+			"charging":     chargingTrips,
+			"battery_swap": swapTrips,
+			"relocation":   relocationTrips,
+			"long":         longTrips,
+			"open":         openTrips,
+			"lost":         lostTrips,
+		})
+		summary.MissingDays = aggregator.MissingDays()
+		if err := writeSummary(*jsonOutput, summary); err != nil {
+			return fmt.Errorf("Failed to write summary: %s", err)
+		}
+		return partialData(aggregator)
+	}
 	totalCost := uint64(0)
 	var maxTripDuration time.Duration
 	var maxDistance float64
@@ -116,6 +286,10 @@ func main() {
 			maxDistance = t.Distance
 		}
 	}
+	if len(trips) == 0 {
+		log.Printf("Found no trips")
+		return partialData(aggregator)
+	}
 	averageCost := float64(trips[0].Cost)
 	averageBatteryUsage := float64(trips[0].StartChargeLevel - trips[0].EndChargeLevel)
 	averageDistance := trips[0].Distance
@@ -133,9 +307,21 @@ func main() {
 	log.Printf("Found %d trips, with \ntotal cost of %.2f € (average %.2f €)\n average energy usage of %.2f\nmax duration %.2f\naverage distance %.2fkm\nmax distance %.2f",
 		len(trips), float64(totalCost)/100.0, averageCost/100.0, averageBatteryUsage, maxTripDuration.Minutes(), averageDistance, maxDistance)
 
-	log.Printf("Got %d trips over 60 Minutes", len(unusuallyLongTrips))
+	log.Printf("Got %d trips over 60 Minutes", len(longTrips))
 
-	for _, t := range unusuallyLongTrips {
+	for _, t := range longTrips {
 		log.Printf("Long trip with scooter %s\nUsedEnergy: %.2f\nTrip duration %.2f\nDistance: %.2fkm", t.ScooterID, t.StartChargeLevel-t.EndChargeLevel, t.Duration.Minutes(), t.Distance)
 	}
+	return partialData(aggregator)
+}
+
+// partialData returns an ExitError if the aggregator skipped files or days
+func partialData(aggregator *circ.ArchiveAggregator) error {
+	if skipped := aggregator.SkippedFiles(); skipped > 0 {
+		return sharealyzer.ExitErrorf(sharealyzer.ExitPartialData, "Skipped %d unreadable files", skipped)
+	}
+	if missing := aggregator.MissingDays(); len(missing) > 0 {
+		return sharealyzer.ExitErrorf(sharealyzer.ExitPartialData, "No scrape files for %d days: %s", len(missing), strings.Join(missing, ", "))
+	}
+	return nil
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/report"
+)
+
+// Summary is the machine readable result of an ingester run
+type Summary struct {
+	From           time.Time      `json:"from"`
+	To             time.Time      `json:"to"`
+	FilesInspected int            `json:"files_inspected"`
+	UniqueScooters int            `json:"unique_scooters"`
+	UniqueUsers    int            `json:"unique_users"`
+	TripCounts     map[string]int `json:"trip_counts"`
+	TotalCost      uint64         `json:"total_cost"` // Total cost of all regular trips in euro cents
+	Distance       report.Summary `json:"distance"`   // Distance of regular trips in kilometers
+	Duration       report.Summary `json:"duration"`   // Duration of regular trips in minutes
+	Cost           report.Summary `json:"cost"`       // Cost of regular trips in euro cents
+	EnergyUsage    report.Summary `json:"energy_usage"`
+	// MissingDays are the days within the range without any scrape files
+	MissingDays []string `json:"missing_days,omitempty"`
+
+	Trips map[string][]*sharealyzer.Trip `json:"trips"`
+}
+
+// newSummary summarizes the trips grouped by their kind, the statistics cover the regular trips
+func newSummary(from, to time.Time, filesInspected, uniqueScooters, uniqueUsers int,
+	groups map[string][]*sharealyzer.Trip) *Summary {
+
+	s := &Summary{
+		From:           from,
+		To:             to,
+		FilesInspected: filesInspected,
+		UniqueScooters: uniqueScooters,
+		UniqueUsers:    uniqueUsers,
+		Trips:          groups,
+		TripCounts:     make(map[string]int),
+	}
+	for tripType, t := range s.Trips {
+		s.TripCounts[tripType] = len(t)
+	}
+	trips := groups["regular"]
+
+	distances := make([]float64, 0, len(trips))
+	durations := make([]float64, 0, len(trips))
+	costs := make([]float64, 0, len(trips))
+	energy := make([]float64, 0, len(trips))
+	for _, t := range trips {
+		s.TotalCost = s.TotalCost + t.Cost
+		distances = append(distances, t.Distance)
+		durations = append(durations, t.Duration.Minutes())
+		costs = append(costs, float64(t.Cost))
+		energy = append(energy, t.StartChargeLevel-t.EndChargeLevel)
+	}
+	s.Distance = report.NewSummary(distances)
+	s.Duration = report.NewSummary(durations)
+	s.Cost = report.NewSummary(costs)
+	s.EnergyUsage = report.NewSummary(energy)
+	return s
+}
+
+// writeSummary writes the summary as JSON to path, or to stdout if path is "-"
+func writeSummary(path string, s *Summary) error {
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		outFile, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// scooterTracer logs every observation and state transition of a single scooter, which helps to
+// understand why a trip was classified the way it was
+type scooterTracer struct {
+	scooterID string
+	visible   bool
+}
+
+func newScooterTracer(scooterID string) *scooterTracer {
+	if scooterID == "" {
+		return nil
+	}
+	return &scooterTracer{
+		scooterID: scooterID,
+	}
+}
+
+func (t *scooterTracer) observe(fileTime time.Time, s sharealyzer.Scooters) {
+	if t == nil {
+		return
+	}
+	scooter, exists := s[t.scooterID]
+	if !exists {
+		if t.visible {
+			log.Printf("[TRACE] %s %s vanished", fileTime.Format(time.RFC3339), t.scooterID)
+		}
+		t.visible = false
+		return
+	}
+	if !t.visible {
+		log.Printf("[TRACE] %s %s appeared", fileTime.Format(time.RFC3339), t.scooterID)
+	}
+	t.visible = true
+	log.Printf("[TRACE] %s %s at %.6f,%.6f energy %.0f%% state %s updated by %s",
+		fileTime.Format(time.RFC3339), t.scooterID, scooter.Location.Latitude, scooter.Location.Longitude,
+		scooter.ChargeLevel, scooter.State, scooter.StateUpdatedByUserID)
+}
+
+func (t *scooterTracer) tripFinished(trip *sharealyzer.Trip) {
+	if t == nil || trip.ScooterID != t.scooterID {
+		return
+	}
+	log.Printf("[TRACE] %s %s finished trip started %s: duration %.1fmin, distance %.2fkm, energy %.0f -> %.0f, classified as %s",
+		trip.EndTime.Format(time.RFC3339), t.scooterID, trip.StartTime.Format(time.RFC3339), trip.Duration.Minutes(),
+		trip.Distance, trip.StartChargeLevel, trip.EndChargeLevel, trip.Type)
+}
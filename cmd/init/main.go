@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+var (
+	configPath = flag.String("config", "./sharealyzer.json", "Path where to write the config file")
+
+	reader = bufio.NewReader(os.Stdin)
+)
+
+// ask prompts for a value and returns defaultValue if the user just hits enter
+func ask(question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue
+	}
+	return answer
+}
+
+func askFloat(question, defaultValue string) string {
+	for {
+		answer := ask(question, defaultValue)
+		if _, err := strconv.ParseFloat(answer, 64); err == nil {
+			return answer
+		}
+		fmt.Println("Please enter a valid number")
+	}
+}
+
+// askBoundingBox lets the user either paste a box as "latTopLeft,lonTopLeft,latBottomRight,lonBottomRight"
+// (i.e. copied from a map tool) or enter the corners one by one
+func askBoundingBox() (latTopLeft, lonTopLeft, latBottomRight, lonBottomRight string) {
+	fmt.Println("Enter the area to scrape. You can paste a box as latTopLeft,lonTopLeft,latBottomRight,lonBottomRight")
+	fmt.Println("or just hit enter to enter the corners one by one.")
+	if box := ask("Bounding box", ""); box != "" {
+		parts := strings.Split(box, ",")
+		if len(parts) == 4 {
+			valid := true
+			for i := range parts {
+				parts[i] = strings.TrimSpace(parts[i])
+				if _, err := strconv.ParseFloat(parts[i], 64); err != nil {
+					valid = false
+				}
+			}
+			if valid {
+				return parts[0], parts[1], parts[2], parts[3]
+			}
+		}
+		fmt.Println("Could not parse the bounding box, please enter the corners one by one")
+	}
+	return askFloat("Latitude top left", "51.582780"),
+		askFloat("Longitude top left", "7.325945"),
+		askFloat("Latitude bottom right", "51.475727"),
+		askFloat("Longitude bottom right", "7.558172")
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Println("Welcome to sharealyzer! This wizard creates a config file for the scraper.")
+	provider := ask("Provider (circ)", "circ")
+	if provider != "circ" {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Unsupported provider %s", provider)
+	}
+
+	config := make(map[string]string)
+	config["phonePrefix"] = ask("Country prefix of your phone number", "+49")
+	config["phoneNumber"] = ask("Your phone number without leading zero", "")
+	config["tokenPath"] = ask("Where to store the auth tokens", "./.tokens")
+
+	if strings.ToLower(ask("Authenticate now? (y/n)", "y")) == "y" {
+		cc := circ.New(circ.WithTokenStore(&circ.FileTokenStore{Path: config["tokenPath"]}))
+		err := cc.Login(config["phonePrefix"], config["phoneNumber"], func() string {
+			return ask("Please enter SMS code", "")
+		})
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitAuthError, "Failed to authenticate: %s", err)
+		}
+		fmt.Println("Successfully authenticated")
+	}
+
+	config["latTopLef"], config["lonTopLeft"], config["larBottomLeft"], config["lonBottomRight"] = askBoundingBox()
+	config["zone"] = ask("Only accept scooters from this zone (leave empty for all zones)", "")
+
+	fmt.Println("Scrape results are written as gzipped JSON files to a directory")
+	config["out"] = ask("Output directory", "./out")
+	for {
+		config["interval"] = ask("Scrape interval", "1m")
+		if _, err := time.ParseDuration(config["interval"]); err == nil {
+			break
+		}
+		fmt.Println("Please enter a valid duration like 1m or 30s")
+	}
+
+	configFile, err := os.Create(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to create config file: %s", err)
+	}
+	defer configFile.Close()
+	encoder := json.NewEncoder(configFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		log.Fatalf("Failed to write config file: %s", err)
+	}
+	fmt.Printf("Config written to %s, start the scraper with -config %s\n", *configPath, *configPath)
+}
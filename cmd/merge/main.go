@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+var (
+	inDirs   = flag.String("in", "", "Comma separated list of base directories to merge")
+	outDir   = flag.String("out", "./merged", "Directory where to put the merged archive")
+	interval = flag.Duration("interval", time.Minute*1, "Scrape interval, used to determine canonical snapshot times")
+)
+
+func main() {
+	flag.Parse()
+	if *inDirs == "" {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "You need to specify at least one input directory")
+	}
+
+	snapshots, err := archive.Snapshots(strings.Split(*inDirs, ","), *interval)
+	if err != nil {
+		log.Fatalf("Failed to collect snapshots: %s", err)
+	}
+
+	duplicates := 0
+	skipped := 0
+	// The merged files are indexed like freshly scraped ones
+	writer := &sharealyzer.GZippedFileWriter{BaseDir: *outDir}
+	for _, snapshot := range snapshots {
+		if snapshot.Provider != "circ" {
+			log.Printf("[WARNING] Skipping snapshot of unsupported provider %s", snapshot.Provider)
+			continue
+		}
+		var sets [][]json.RawMessage
+		var format archive.Format
+		for _, file := range snapshot.Files {
+			var records []json.RawMessage
+			fileFormat, err := archive.DecodeFile(file, func(record json.RawMessage) error {
+				records = append(records, record)
+				return nil
+			})
+			if err != nil {
+				log.Printf("[WARNING] Skipping unreadable file %s: %s", file, err)
+				skipped++
+				continue
+			}
+			// The merged file keeps the format of the first readable file
+			if len(sets) == 0 {
+				format = fileFormat
+			}
+			sets = append(sets, records)
+		}
+		if len(sets) == 0 {
+			continue
+		}
+		records, err := circ.MergeRecords(sets...)
+		if err != nil {
+			log.Printf("[WARNING] Skipping snapshot %s, failed to merge files: %s", snapshot.Time.Format(time.RFC3339), err)
+			skipped += len(sets)
+			continue
+		}
+		duplicates = duplicates + len(snapshot.Files) - 1
+		writer.Format = format
+		if err := writer.WriteFile(&sharealyzer.RawScrapeFile{ProviderName: snapshot.Provider, Date: snapshot.LocalTime(),
+			Records: records}); err != nil {
+			log.Fatalf("Failed to write merged file of %s: %s", snapshot.LocalTime().Format(time.RFC3339), err)
+		}
+	}
+	log.Printf("Merged %d snapshots, %d files were combined with overlapping ones", len(snapshots), duplicates)
+	if skipped > 0 {
+		sharealyzer.Exitf(sharealyzer.ExitPartialData, "Skipped %d files", skipped)
+	}
+}
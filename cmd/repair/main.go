@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
+
+var (
+	baseDir       = flag.String("baseDir", "./out", "Base directory with scraped data")
+	quarantineDir = flag.String("quarantine", "", "Directory for corrupt files, defaults to <baseDir>/quarantine")
+	recompress    = flag.Bool("recompress", true, "Recompress all valid files with the best compression")
+	repack        = flag.Bool("repack", false, "Pack every day except the newest into a single tar file")
+	salvage       = flag.Bool("salvage", false, "Keep the complete records of truncated JSON Lines files instead of quarantining them")
+)
+
+func main() {
+	flag.Parse()
+
+	report, err := archive.Repair(*baseDir, archive.RepairOptions{
+		QuarantineDir: *quarantineDir,
+		Recompress:    *recompress,
+		Repack:        *repack,
+		Salvage:       *salvage,
+	})
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitFailure, "Failed to repair archive: %s", err)
+	}
+	log.Printf("Checked %d files, quarantined %d, salvaged %d, recompressed %d, repacked %d days",
+		report.Checked, len(report.Quarantined), len(report.Salvaged), report.Recompressed, len(report.Repacked))
+	for _, f := range report.Quarantined {
+		log.Printf("Quarantined %s", f)
+	}
+	for _, f := range report.Salvaged {
+		log.Printf("Salvaged %s", f)
+	}
+	if len(report.Quarantined) > 0 {
+		sharealyzer.Exitf(sharealyzer.ExitPartialData, "Quarantined %d corrupt files", len(report.Quarantined))
+	}
+}
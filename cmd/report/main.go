@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/report"
+)
+
+var (
+	timeFormat     = "2006-01-02T15:04"
+	baseDir        = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	startTime      = flag.String("from", "2019-10-06T00:01", "Parseable time string with a start time and date")
+	endTime        = flag.String("to", "2019-10-07T00:01", "Parseable end time")
+	outPath        = flag.String("out", "report.html", "Path of the generated HTML report")
+	cacheDir       = flag.String("cacheDir", "", "Cache the parsed scrape days in this directory, so repeated reports are faster")
+	rollupDir      = flag.String("rollupDir", "", "Store rollups of the aggregated trips in this directory and only rescan periods without rollup")
+	rollup         = flag.String("rollupPeriod", string(report.Daily), "Period of the rollups, hourly or daily")
+	warmup         = flag.Duration("warmup", 2*time.Hour, "Scan this long before periods without rollup, so trips started earlier are found")
+	maxTrips       = flag.Int("maxUnfinishedTrips", 0, "Keep at most this many unfinished trips in memory and spill the rest to disk, 0 means no limit")
+	maxAge         = flag.Duration("maxLocationAge", sharealyzer.DefaultMaxLocationAge, "GPS fixes older than this are stale and not used as trip locations, 0 disables the check")
+	maxReservation = flag.Duration("maxReservationDuration", sharealyzer.DefaultMaxReservationDuration, "Shorter disappearances without movement or charge loss are reservations instead of trips, 0 disables the check")
+	reorderWindow  = flag.Duration("reorderWindow", sharealyzer.DefaultReorderWindow, "Wait this long for scrape files which are out of order")
+	maxTripAge     = flag.Duration("maxTripAge", sharealyzer.TripNeverFinishedTime, "Unfinished trips older than this are considered lost")
+	maxScrapeGap   = flag.Duration("maxScrapeGap", sharealyzer.DefaultMaxScrapeGap, "Gaps between scrape files longer than this are outages after which trip detection restarts, 0 disables this")
+	groupTimeDiff  = flag.Duration("groupMaxTimeDiff", sharealyzer.GroupMaxTimeDiff, "Trips starting and ending within this time of each other may be ridden together")
+	groupDistance  = flag.Float64("groupMaxDistance", sharealyzer.GroupMaxDistance, "Trips starting and ending within this distance in km of each other may be ridden together")
+	area           = flag.String("area", "", "Drop observations outside of this area given as latTopLeft,lonTopLeft,latBottomRight,lonBottomRight")
+	timezone       = flag.String("timezone", "UTC", "Time zone of the start and end time and of the trips per hour, i.e. Europe/Berlin")
+	spillDir       = flag.String("spillDir", "", "Directory for spilled unfinished trips, defaults to the temporary directory")
+	demandPath     = flag.String("demand", "", "Write the raw and supply normalized demand per zone and hour of day as CSV to this file, not supported with rollups")
+
+	// validator drops implausible observations of all scans
+	validator = &sharealyzer.Validator{}
+)
+
+// scan aggregates and classifies the trips of the scrape files between from and to. observe is called with
+// every scrape result before its trips are aggregated.
+func scan(from, to time.Time, observe func(res *circ.ScrapeResult)) ([]*sharealyzer.Trip, *circ.ReadStats, error) {
+	readArchive := circ.ReadArchive
+	if *cacheDir != "" {
+		readArchive = (&circ.DayCache{Dir: *cacheDir}).ReadArchive
+	}
+	results, readStats, err := readArchive(*baseDir, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	observed := make(chan *circ.ScrapeResult, 100)
+	go func() {
+		for res := range results {
+			observe(res)
+			observed <- res
+		}
+		close(observed)
+	}()
+
+	aggregator := sharealyzer.NewTripAggregator()
+	aggregator.MaxUnfinishedTrips = *maxTrips
+	aggregator.MaxLocationAge = *maxAge
+	aggregator.MaxReservationDuration = *maxReservation
+	aggregator.MaxTripAge = *maxTripAge
+	aggregator.MaxScrapeGap = *maxScrapeGap
+	aggregator.Spill = &sharealyzer.TripSpill{Dir: *spillDir}
+	defer aggregator.Spill.Close()
+	var trips []*sharealyzer.Trip
+	openTrips := 0
+	aggregator.OpenTrips = func(trip *sharealyzer.Trip) {
+		openTrips++
+	}
+	sequencer := &sharealyzer.Sequencer{Window: *reorderWindow}
+	validated := sharealyzer.ValidateScrapeResults(sequencer.Sequence(circ.ConvertScrapeResult(observed)), validator)
+	batches := aggregator.AggregateBatches(validated, sharealyzer.DefaultBatchSize, 0)
+	for batch := range sharealyzer.ClassifyTripBatches(batches) {
+		trips = append(trips, batch...)
+	}
+	groups := sharealyzer.GroupDetector{MaxTimeDiff: *groupTimeDiff, MaxDistance: *groupDistance}.Detect(trips)
+	if groups > 0 {
+		log.Printf("Found %d groups of trips ridden together", groups)
+	}
+	if openTrips > 0 || aggregator.LostTripCount() > 0 {
+		log.Printf("%d scooters were still on a trip at %s, %d trips never finished", openTrips, to.Format(time.RFC3339),
+			aggregator.LostTripCount())
+	}
+	if aggregator.ReservationCount() > 0 {
+		log.Printf("%d disappearances were reservations and aren't counted as trips", aggregator.ReservationCount())
+	}
+	return trips, readStats, nil
+}
+
+// rollupStats combines the stored rollups of the periods between from and to. Consecutive periods without
+// rollup are rescanned and their rollups are stored, as long as the periods are over.
+func rollupStats(store *report.FileRollupStore, period report.Period, from, to time.Time) (*report.Stats, *circ.ReadStats, error) {
+	readStats := &circ.ReadStats{}
+	starts := report.PeriodStarts(period, from, to)
+	rollups := make([]*report.Rollup, len(starts))
+	for i, start := range starts {
+		r, err := store.Load(period, start)
+		if err == nil {
+			rollups[i] = r
+		} else if !os.IsNotExist(err) {
+			log.Printf("[WARNING] Rescanning period: %s", err)
+		}
+	}
+
+	for i := 0; i < len(starts); i++ {
+		if rollups[i] != nil {
+			continue
+		}
+		j := i
+		for j < len(starts) && rollups[j] == nil {
+			j++
+		}
+		missingFrom, missingTo := starts[i], starts[i].Add(time.Duration(j-i)*period.Duration())
+		log.Printf("Scanning %s to %s for missing rollups", missingFrom.Format(time.RFC3339), missingTo.Format(time.RFC3339))
+		roller := report.NewRoller(period)
+		trips, scanStats, err := scan(missingFrom.Add(-*warmup), missingTo, func(res *circ.ScrapeResult) {
+			if res.Date.Before(missingFrom) {
+				return
+			}
+			ids := make([]string, 0, len(res.Scooters))
+			for _, scooter := range res.Scooters {
+				ids = append(ids, scooter.Identifier)
+			}
+			roller.Observe(res.Date, ids)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		readStats.Read = readStats.Read + scanStats.Read
+		readStats.Failed = append(readStats.Failed, scanStats.Failed...)
+		for _, trip := range trips {
+			if !trip.EndTime.Before(missingFrom) {
+				roller.Add(trip)
+			}
+		}
+		for k, r := range roller.Rollups(missingFrom, missingTo) {
+			rollups[i+k] = r
+			// Periods which aren't over yet or lack files will be rescanned next time
+			if r.End().After(time.Now()) || len(scanStats.Failed) > 0 {
+				continue
+			}
+			if err := store.Store(r); err != nil {
+				log.Printf("[WARNING] Failed to store rollup: %s", err)
+			}
+		}
+		i = j
+	}
+	if len(starts) > 0 {
+		// Rollups always cover whole periods
+		from, to = starts[0], starts[len(starts)-1].Add(period.Duration())
+	}
+	return report.Combine(rollups, from, to), readStats, nil
+}
+
+// writeDemand writes the demand cells as CSV to the demand file
+func writeDemand(cells []report.DemandCell) {
+	f, err := os.Create(*demandPath)
+	if err != nil {
+		log.Fatalf("Failed to create demand file: %s", err)
+	}
+	if err := report.WriteDemandCSV(f, cells); err != nil {
+		log.Fatalf("Failed to write demand: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write demand: %s", err)
+	}
+	log.Printf("Wrote demand of %d zone hours to %s", len(cells), *demandPath)
+}
+
+func main() {
+	flag.Parse()
+	if *area != "" {
+		box, err := sharealyzer.ParseBoundingBox(*area)
+		if err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse area: %s", err)
+		}
+		validator.Area = box
+	}
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to load time zone: %s", err)
+	}
+	start, err := time.ParseInLocation(timeFormat, *startTime, location)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse start time: %s", err)
+	}
+	end, err := time.ParseInLocation(timeFormat, *endTime, location)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse end time: %s", err)
+	}
+
+	var stats *report.Stats
+	var readStats *circ.ReadStats
+	if *rollupDir != "" && *demandPath != "" {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "The demand can't be computed from rollups")
+	}
+	if *rollupDir != "" {
+		period := report.Period(*rollup)
+		if period.Duration() == 0 {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Unknown rollup period %s", *rollup)
+		}
+		store := &report.FileRollupStore{Dir: *rollupDir}
+		if stats, readStats, err = rollupStats(store, period, start, end); err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+	} else {
+		fleet := make(map[string]bool)
+		demand := report.NewDemandEstimator(location)
+		trips, scanStats, err := scan(start, end, func(res *circ.ScrapeResult) {
+			for _, scooter := range res.Scooters {
+				fleet[scooter.Identifier] = true
+			}
+			if *demandPath != "" {
+				demand.Observe(res.Generic())
+			}
+		})
+		if err != nil {
+			log.Fatalf("Failed to read archive: %s", err)
+		}
+		if scanStats.Read == 0 && len(scanStats.Failed) == 0 {
+			sharealyzer.Exitf(sharealyzer.ExitNoData, "No scrape files between %s and %s in %s", start.Format(time.RFC3339),
+				end.Format(time.RFC3339), *baseDir)
+		}
+		stats, readStats = report.Compute(trips, start, end, len(fleet)), scanStats
+		if *demandPath != "" {
+			for _, trip := range trips {
+				demand.AddTrip(trip)
+			}
+			writeDemand(demand.Demand())
+		}
+	}
+
+	outFile, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatalf("Failed to create report file: %s", err)
+	}
+	if err := report.WriteHTML(outFile, stats); err != nil {
+		log.Fatalf("Failed to render report: %s", err)
+	}
+	outFile.Close()
+	log.Printf("Wrote report with %d trips from %d files to %s", stats.Trips, readStats.Read, *outPath)
+	if len(readStats.Failed) > 0 {
+		sharealyzer.Exitf(sharealyzer.ExitPartialData, "Skipped %d unreadable files", len(readStats.Failed))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+// account is one provider account the scraper can use
+type account struct {
+	phonePrefix string
+	phoneNumber string
+	client      *circ.Client
+	authCounter int
+	disabled    bool
+}
+
+// accountPool rotates between accounts to spread the request load. Accounts which can't authenticate
+// anymore, i.e. because they were banned, are skipped.
+type accountPool struct {
+	accounts []*account
+	next     int
+}
+
+// newAccountPool creates the configured accounts. With additional accounts the tokens of all accounts
+// are stored in the token file keyed by phone number.
+func newAccountPool(clientOpts []circ.ClientOption) *accountPool {
+	primary := &account{phonePrefix: *phonePrefix, phoneNumber: *phoneNumber}
+	if *additionalAccounts == "" {
+		opts := append(clientOpts, circ.WithTokenStore(newTokenStore()))
+		if *tokenBackend == "file" {
+			opts = append(opts, circ.WithLoginLimiter(loginLimiter(*tokenStorePath+".logins")))
+		}
+		primary.client = circ.New(opts...)
+		return &accountPool{accounts: []*account{primary}}
+	}
+
+	if *tokenBackend != "file" || *tokenPassword != "" || *tokenKeyFile != "" {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Multiple accounts are only supported with unencrypted file token storage")
+	}
+	accounts := []*account{primary}
+	for _, spec := range strings.Split(*additionalAccounts, ",") {
+		parts := strings.SplitN(strings.TrimSpace(spec), ":", 2)
+		if len(parts) != 2 {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid account %s, expected prefix:number", spec)
+		}
+		accounts = append(accounts, &account{phonePrefix: parts[0], phoneNumber: parts[1]})
+	}
+	store := &circ.AccountTokenStore{
+		Path:           *tokenStorePath,
+		DefaultAccount: circ.AccountKey("circ", primary.phonePrefix, primary.phoneNumber),
+	}
+	for _, acc := range accounts {
+		key := circ.AccountKey("circ", acc.phonePrefix, acc.phoneNumber)
+		acc.client = circ.New(append(clientOpts, circ.WithTokenStore(store.Account(key)),
+			circ.WithLoginLimiter(loginLimiter(*tokenStorePath+"."+key+".logins")))...)
+	}
+	return &accountPool{accounts: accounts}
+}
+
+// loginLimiter creates the limiter for SMS logins, the attempts are persisted next to the tokens
+func loginLimiter(path string) *circ.LoginLimiter {
+	return &circ.LoginLimiter{Path: path, MaxAttempts: *maxLogins, Window: *loginWindow}
+}
+
+// pick returns the next usable account or nil if no account is usable anymore
+func (p *accountPool) pick() *account {
+	for i := 0; i < len(p.accounts); i++ {
+		acc := p.accounts[p.next]
+		p.next = (p.next + 1) % len(p.accounts)
+		if !acc.disabled {
+			return acc
+		}
+	}
+	return nil
+}
+
+// disable removes the account from the rotation
+func (p *accountPool) disable(acc *account) {
+	acc.disabled = true
+	log.Printf("[ERROR] Failed to authenticate account %s%s, removing it from the rotation", acc.phonePrefix, acc.phoneNumber)
+}
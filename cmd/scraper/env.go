@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const envPrefix = "SHAREALYZER_"
+
+// envName converts a flag name like phoneNumber to its environment variable SHAREALYZER_PHONE_NUMBER
+func envName(flagName string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range flagName {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// setFlagsFromEnv sets every flag for which an environment variable exists. Call it before flag.Parse
+// so flags on the command line still take precedence.
+func setFlagsFromEnv() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if value, exists := os.LookupEnv(envName(f.Name)); exists {
+			if err := f.Value.Set(value); err != nil {
+				sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid value for %s: %s", envName(f.Name), err)
+			}
+		}
+	})
+}
+
+// setFlagsFromConfig sets all flags contained in the JSON config file at path, i.e. written by the init
+// command. Flags set on the command line or via environment variables take precedence.
+func setFlagsFromConfig(path string) error {
+	configFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer configFile.Close()
+	config := make(map[string]string)
+	if err := json.NewDecoder(configFile).Decode(&config); err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, value := range config {
+		if explicit[name] {
+			continue
+		}
+		if _, exists := os.LookupEnv(envName(name)); exists {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid config value for %s: %s", name, err)
+		}
+	}
+	return nil
+}
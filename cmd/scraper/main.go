@@ -1,53 +1,117 @@
 package main
 
 import (
-	"bufio"
-	"compress/gzip"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
 	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/nominatim"
 )
 
 var (
-	phonePrefix    = flag.String("phonePrefix", "+49", "Country prefix of your phone number in + format")
-	phoneNumber    = flag.String("phoneNumber", "", "Your phone number to authenticate")
-	tokenStorePath = flag.String("tokenPath", "./.tokens", "The path where to persist tokens")
-	latTopLeft     = flag.Float64("latTopLef", 51.582780, "Latitude Top Left")
-	lonTopLeft     = flag.Float64("lonTopLeft", 7.325945, "Longitude Top Left")
-	latBottomRight = flag.Float64("larBottomLeft", 51.475727, "Latitude Bottom Left")
-	lonBottomRight = flag.Float64("lonBottomRight", 7.558172, "Longitude Bottom right")
+	configPath         = flag.String("config", "", "Path of a config file written by the init command")
+	phonePrefix        = flag.String("phonePrefix", "+49", "Country prefix of your phone number in + format")
+	phoneNumber        = flag.String("phoneNumber", "", "Your phone number to authenticate")
+	tokenStorePath     = flag.String("tokenPath", "./.tokens", "The path where to persist tokens, the secret path for vault or the secret ID for aws")
+	proxyURL           = flag.String("proxy", "", "Route requests to the provider through this HTTP or SOCKS5 proxy, i.e. socks5://localhost:1080")
+	caBundle           = flag.String("caBundle", "", "Path of a PEM file with additional CAs to trust")
+	requestTimeout     = flag.Duration("requestTimeout", sharealyzer.DefaultRequestTimeout, "Timeout of a single request to the provider API")
+	cacheTTL           = flag.Duration("cacheTTL", 0, "Cache provider responses for this duration and revalidate them afterwards, disabled if 0")
+	userAgent          = flag.String("userAgent", "", "User-Agent sent to the provider API")
+	additionalAccounts = flag.String("accounts", "", "Comma separated additional accounts as prefix:number, the scraper rotates between all accounts")
+	maxLogins          = flag.Int("maxLogins", circ.DefaultMaxLoginAttempts, "Maximum SMS logins per account within the login window")
+	loginWindow        = flag.Duration("loginWindow", circ.DefaultLoginWindow, "Window in which SMS logins are counted")
+	tokenBackend       = flag.String("tokenBackend", "file", "Where to persist tokens, one of file, memory, env, vault or aws")
+	tokenPassword      = flag.String("tokenPassphrase", "", "Encrypt the persisted tokens with a key derived from this passphrase")
+	tokenKeyFile       = flag.String("tokenKeyFile", "", "Encrypt the persisted tokens with the 32 byte key from this file")
+	latTopLeft         = flag.Float64("latTopLef", 51.582780, "Latitude Top Left")
+	lonTopLeft         = flag.Float64("lonTopLeft", 7.325945, "Longitude Top Left")
+	latBottomRight     = flag.Float64("larBottomLeft", 51.475727, "Latitude Bottom Left")
+	lonBottomRight     = flag.Float64("lonBottomRight", 7.558172, "Longitude Bottom right")
 
 	expectedZone   = flag.String("zone", "", "Only accept scooters from the specified zone")
+	city           = flag.String("city", "", "Derive the area to scrape from the boundary of this city via Nominatim")
 	outPath        = flag.String("out", "./out", "Directory where to put scrape results")
+	fileFormat     = flag.String("fileFormat", string(archive.FormatJSON), "Format of the scrape files, json for a JSON array or jsonl for one scooter per line")
 	scrapeInterval = flag.Duration("interval", time.Minute*1, "Scrape Interval")
+	once           = flag.Bool("once", false, "Scrape once immediately and exit, i.e. when running from cron")
+	backfill       = flag.Bool("backfill", false, "Scrape immediately on startup instead of waiting for the first interval")
+	pprof          = flag.String("pprof", "", "Serve profiling endpoints on this address while scraping continuously, i.e. localhost:6060")
+	decodeMode     = flag.String("decodeMode", string(sharealyzer.DecodeLenient), "How to decode scooters, strict skips scrapes with unknown or missing fields, lenient only reports them")
+	driftReport    = flag.String("schemaDriftReport", "", "Write the unknown and missing fields of scraped scooters as JSON to this path after every scrape")
+
+	nonInteractive = flag.Bool("nonInteractive", false, "Never prompt on stdin and log JSON to stdout, i.e. when running in a container")
+	smsCodeSource  = flag.String("smsCodeSource", "stdin", "Where to receive the SMS code from, one of stdin, file, http or telegram")
+	smsCodeURL     = flag.String("smsCodeURL", "", "URL polled for the SMS code if the source is http")
+	telegramToken  = flag.String("telegramToken", "", "Token of the Telegram bot asking for the SMS code")
+	telegramChatID = flag.Int64("telegramChatID", 0, "ID of the Telegram chat the bot asks for the SMS code")
+	smsCodeFile    = flag.String("smsCodeFile", "./.smscode", "In non interactive mode the SMS code is read from this file")
+	smsCodeTimeout = flag.Duration("smsCodeTimeout", time.Minute*10, "How long to wait for the SMS code file in non interactive mode")
 
-	authCounter  = 0
 	maxAuthTries = 3
+
+	extraHeaders headerFlags
+	cityBoundary sharealyzer.Polygons
+	codeProvider circ.CodeProvider
+	decoder      *sharealyzer.RecordDecoder
 )
 
+func init() {
+	flag.Var(&extraHeaders, "header", "Additional header sent to the provider API as 'Name: value', can be repeated")
+}
+
 func main() {
+	setFlagsFromEnv()
 	flag.Parse()
+	if *configPath != "" {
+		if err := setFlagsFromConfig(*configPath); err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to load config %s: %s", *configPath, err)
+		}
+	}
+	if *nonInteractive {
+		log.SetFlags(0)
+		log.SetOutput(sharealyzer.NewJSONLogWriter(os.Stdout))
+	}
+	if _, err := archive.ParseFormat(*fileFormat); err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s", err)
+	}
+	mode, err := sharealyzer.ParseDecodeMode(*decodeMode)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s", err)
+	}
+	// All accounts share the decoder, so the drift report covers every scrape
+	decoder = circ.NewScooterDecoder(mode)
+	if *city != "" {
+		resolveCity(*city)
+	}
+	pool := newAccountPool(newClientOptions())
+	codeProvider = newCodeProvider()
+	if *once {
+		sharealyzer.ExitOnError(doScrape(pool))
+		return
+	}
+	sharealyzer.ServeProfiling(*pprof)
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	ctx := context.Background()
 	scrapeCtx, scrapeCancel := context.WithCancel(ctx)
 
 	go func() {
+		if *backfill {
+			scrapeOrSkip(pool)
+		}
 
-		tokenStore := &circ.FileTokenStore{*tokenStorePath}
-		cc := circ.New(circ.WithTokenStore(tokenStore))
-
-		go scrape(scrapeCtx, cc)
+		go scrape(scrapeCtx, pool)
 	}()
 
 	select {
@@ -58,9 +122,88 @@ func main() {
 	}
 }
 
-const folderTimeFormat = "2006-01-02"
+// headerFlags collects repeated -header flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("Header %s needs to be in the format 'Name: value'", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// newClientOptions creates the options for the provider client from the proxy, TLS and header flags
+func newClientOptions() []circ.ClientOption {
+	httpClient, err := sharealyzer.NewHTTPClient(*proxyURL, *caBundle, *requestTimeout)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to configure HTTP client: %s", err)
+	}
+	opts := []circ.ClientOption{circ.WithHTTPClient(httpClient), circ.WithDecoder(decoder)}
+	if *cacheTTL > 0 {
+		opts = append(opts, circ.WithResponseCache(*cacheTTL))
+	}
+	if *userAgent != "" {
+		opts = append(opts, circ.WithUserAgent(*userAgent))
+	}
+	for _, header := range extraHeaders {
+		parts := strings.SplitN(header, ":", 2)
+		opts = append(opts, circ.WithHeader(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])))
+	}
+	return opts
+}
+
+// newTokenStore creates the token store for the configured backend. Vault is configured via the
+// VAULT_ADDR and VAULT_TOKEN environment variables, AWS via the usual AWS_* variables.
+func newTokenStore() circ.TokenStore {
+	switch *tokenBackend {
+	case "file":
+		if *tokenPassword != "" || *tokenKeyFile != "" {
+			return &circ.EncryptedFileTokenStore{
+				Path:       *tokenStorePath,
+				Passphrase: *tokenPassword,
+				KeyFile:    *tokenKeyFile,
+			}
+		}
+		return &circ.FileTokenStore{Path: *tokenStorePath}
+	case "memory":
+		return &circ.MemoryTokenStore{}
+	case "env":
+		return &circ.EnvTokenStore{}
+	case "vault":
+		return &circ.VaultTokenStore{
+			Address: os.Getenv("VAULT_ADDR"),
+			Token:   os.Getenv("VAULT_TOKEN"),
+			Path:    *tokenStorePath,
+		}
+	case "aws":
+		return &circ.AWSSecretTokenStore{SecretID: *tokenStorePath}
+	}
+	sharealyzer.Exitf(sharealyzer.ExitConfigError, "Unknown token backend %s", *tokenBackend)
+	return nil
+}
+
+// resolveCity replaces the configured bounding box with the one of the city and only accepts scooters
+// within the city boundary
+func resolveCity(name string) {
+	place, err := nominatim.New().City(name)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to resolve city %s: %s", name, err)
+	}
+	*latTopLeft = place.BoundingBox.LatTopLeft
+	*lonTopLeft = place.BoundingBox.LonTopLeft
+	*latBottomRight = place.BoundingBox.LatBottomRight
+	*lonBottomRight = place.BoundingBox.LonBottomRight
+	cityBoundary = place.Boundary
+	log.Printf("Scraping %s within %.5f,%.5f %.5f,%.5f", place.DisplayName,
+		*latTopLeft, *lonTopLeft, *latBottomRight, *lonBottomRight)
+}
 
-func writeResult(scooters []*circ.Scooter) {
+func writeResult(scooters []*circ.Scooter) error {
 	if *expectedZone != "" {
 		filteredScooters := make([]*circ.Scooter, 0, len(scooters))
 		for _, s := range scooters {
@@ -70,36 +213,27 @@ func writeResult(scooters []*circ.Scooter) {
 		}
 		scooters = filteredScooters
 	}
-
-	timestamp := time.Now().Format(time.RFC3339)
-	folderName := fmt.Sprintf("circ_%s", time.Now().Format(folderTimeFormat))
-	fileName := fmt.Sprintf("circ_%s.json.gz", timestamp)
-	folderPath := filepath.Join(*outPath, folderName)
-
-	if !fileDoesExist(folderPath) {
-		if err := os.MkdirAll(folderPath, 0770); err != nil {
-			log.Fatalf("Failed to create output folder(%s): %s", folderPath, err)
+	if len(cityBoundary) > 0 {
+		filteredScooters := make([]*circ.Scooter, 0, len(scooters))
+		for _, s := range scooters {
+			if cityBoundary.Contains(sharealyzer.NewGeoLocation(s.Latitude, s.Longitude)) {
+				filteredScooters = append(filteredScooters, s)
+			}
 		}
+		scooters = filteredScooters
 	}
-	path := filepath.Join(folderPath, fileName)
 
-	outFile, err := os.Create(path)
-	if err != nil {
-		log.Fatalf("Failed to create output file %s: %s", path, err)
-		return
-	}
-	defer outFile.Close()
-	gzipWriter, err := gzip.NewWriterLevel(outFile, gzip.BestCompression)
-	if err != nil {
-		log.Fatalf("Failed to create GZIP writer: %s", err)
-	}
-	defer gzipWriter.Close()
-	if err := json.NewEncoder(gzipWriter).Encode(scooters); err != nil {
-		log.Fatalf("Failed to serialize scooter to %s: %s", path, err)
+	now := time.Now()
+	_, offset := now.Zone()
+	writer := &sharealyzer.GZippedFileWriter{BaseDir: *outPath, Format: archive.Format(*fileFormat)}
+	res := &circ.ScrapeResult{Date: now.UTC(), ZoneOffset: offset, Scooters: scooters}
+	if err := writer.WriteFile(res); err != nil {
+		return sharealyzer.ExitErrorf(sharealyzer.ExitFailure, "Failed to write scrape result to %s: %s", *outPath, err)
 	}
+	return nil
 }
 
-func scrape(ctx context.Context, cc *circ.Client) {
+func scrape(ctx context.Context, pool *accountPool) {
 	scrapeTimer := time.NewTimer(*scrapeInterval)
 	for {
 		select {
@@ -107,68 +241,121 @@ func scrape(ctx context.Context, cc *circ.Client) {
 			return
 		case <-scrapeTimer.C:
 			scrapeTimer.Stop()
-			doScrape(cc)
+			scrapeOrSkip(pool)
 			scrapeTimer = time.NewTimer(*scrapeInterval)
 		}
 	}
 }
 
-func doScrape(cc *circ.Client) {
+// scrapeOrSkip scrapes while scraping continuously, failed scrapes are skipped unless no account is left
+func scrapeOrSkip(pool *accountPool) {
+	if err := doScrape(pool); err == errNoAccounts {
+		sharealyzer.ExitOnError(err)
+	} else if err != nil {
+		log.Printf("[WARNING] Skipping scrape: %s", err)
+	}
+}
+
+// errNoAccounts is returned by doScrape if no account can authenticate anymore, scraping can't continue
+var errNoAccounts = sharealyzer.ExitErrorf(sharealyzer.ExitAuthError, "No account left which can authenticate with Circ")
+
+// doScrape scrapes the configured area once and writes the result. It returns an ExitError describing why
+// nothing was written if the scrape was skipped.
+func doScrape(pool *accountPool) error {
+	acc := pool.pick()
+	if acc == nil {
+		return errNoAccounts
+	}
 	retryCounter := 0
 	maxRetries := 5
+	// Give up on this scrape once the next one is due, so a hanging API can't stall the scrape loop
+	deadline := time.Now().Add(*scrapeInterval)
 
-	success := false
-	for ; retryCounter < maxRetries || !success; retryCounter = retryCounter + 1 {
-		if scooters, err := cc.Scooters(*latTopLeft, *lonTopLeft, *latBottomRight, *lonBottomRight); err != nil {
-			if circErr, ok := err.(circ.CircError); ok {
-				if circErr.Status >= 400 && circErr.Status < 500 {
-
-					for ; authCounter < maxAuthTries; authCounter = authCounter + 1 {
-						err := cc.Login(*phonePrefix, *phoneNumber, func() string {
-							fmt.Print("Please enter SMS code: ")
-							reader := bufio.NewReader(os.Stdin)
-							code, _ := reader.ReadString('\n')
-							code = strings.Replace(code, "\n", "", -1)
-							fmt.Println("Thank you")
-							return code
-						})
-						if err == nil {
-							break
-						}
-					}
-					if authCounter >= maxAuthTries {
-						log.Fatalf("Failed to authenticate with Circ")
-					}
-				} else {
-					log.Fatalf("Unhandable error from Circ: %s", circErr.Error())
-				}
-			} else {
-				retryCounter++
+	defer saveDriftReport()
 
-				if retryCounter == maxRetries {
-					log.Fatalf("Failed to retrieve scooters with unknown error: %s", err)
-				} else {
-					log.Printf("Failed to retrieve scooters with unknown error, retrying: %s", err)
+	for ; retryCounter < maxRetries; retryCounter = retryCounter + 1 {
+		if !time.Now().Before(deadline) {
+			return sharealyzer.ExitErrorf(sharealyzer.ExitNoData, "Scrape did not finish within the scrape interval")
+		}
+		scooters, err := acc.client.Scooters(*latTopLeft, *lonTopLeft, *latBottomRight, *lonBottomRight)
+		if err == nil {
+			return writeResult(scooters)
+		}
+		if driftErr, ok := sharealyzer.IsSchemaDrift(err); ok {
+			return sharealyzer.ExitErrorf(sharealyzer.ExitNoData, "The Circ API changed: %s", driftErr)
+		}
+		if rateErr, ok := sharealyzer.IsRateLimit(err); ok {
+			// The deadline limits how long we back off, so rate limits don't use up the retries
+			retryCounter--
+			backoff := rateErr.RetryAfter
+			if remaining := time.Until(deadline); remaining < backoff {
+				backoff = remaining
+			}
+			log.Printf("[WARNING] Rate limited by Circ, backing off for %s", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		if circ.IsAuthError(err) {
+			log.Printf("Authentication with Circ expired, logging in again: %s", err)
+			for ; acc.authCounter < maxAuthTries; acc.authCounter = acc.authCounter + 1 {
+				err := acc.client.LoginWith(acc.phonePrefix, acc.phoneNumber, codeProvider)
+				if err == nil {
+					break
+				}
+				if _, ok := err.(*circ.LoginCooldownError); ok {
+					return sharealyzer.ExitErrorf(sharealyzer.ExitAuthError, "%s", err)
+				}
+			}
+			if acc.authCounter >= maxAuthTries {
+				pool.disable(acc)
+				if acc = pool.pick(); acc == nil {
+					return errNoAccounts
 				}
-				time.Sleep(time.Second * 5)
-				continue
 			}
+		} else if _, ok := err.(circ.CircError); ok {
+			return sharealyzer.ExitErrorf(sharealyzer.ExitFailure, "Unhandable error from Circ: %s", err)
 		} else {
-			success = true
-			writeResult(scooters)
+			retryCounter++
+
+			if retryCounter == maxRetries {
+				return sharealyzer.ExitErrorf(sharealyzer.ExitFailure, "Failed to retrieve scooters with unknown error: %s", err)
+			}
+			log.Printf("Failed to retrieve scooters with unknown error, retrying: %s", err)
+			time.Sleep(time.Second * 5)
 		}
 	}
+	return sharealyzer.ExitErrorf(sharealyzer.ExitNoData, "Failed to retrieve scooters after %d attempts", maxRetries)
+}
 
+// saveDriftReport writes the schema drift report if it is configured and any drift was detected
+func saveDriftReport() {
+	if *driftReport == "" {
+		return
+	}
+	if drift := decoder.Drift(); drift.Drifted() {
+		if err := drift.Save(*driftReport); err != nil {
+			log.Printf("[WARNING] Failed to write schema drift report %s: %s", *driftReport, err)
+		}
+	}
 }
 
-func fileDoesExist(path string) bool {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return false
-	} else if os.IsExist(err) {
-		return true
-	} else if err == nil {
-		return true
-	} else {
-		return false
+// newCodeProvider creates the CodeProvider for the configured SMS code source. In non interactive mode
+// the code is read from a file unless another source is configured.
+func newCodeProvider() circ.CodeProvider {
+	source := *smsCodeSource
+	if source == "stdin" && *nonInteractive {
+		source = "file"
+	}
+	switch source {
+	case "stdin":
+		return &circ.StdinCodeProvider{}
+	case "file":
+		return &circ.FileCodeProvider{Path: *smsCodeFile, Timeout: *smsCodeTimeout}
+	case "http":
+		return &circ.HTTPCodeProvider{URL: *smsCodeURL, Timeout: *smsCodeTimeout}
+	case "telegram":
+		return &circ.TelegramCodeProvider{BotToken: *telegramToken, ChatID: *telegramChatID, Timeout: *smsCodeTimeout}
 	}
+	sharealyzer.Exitf(sharealyzer.ExitConfigError, "Unknown SMS code source %s", source)
+	return nil
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+)
+
+var (
+	baseDir         = flag.String("baseDir", "./out", "Base directory with scraped circ data")
+	tripStorePath   = flag.String("tripStore", "./trips.jsonl", "File with trips written by the ingester, used to find the hotspots")
+	cellSize        = flag.Float64("cellSize", sharealyzer.DefaultHotspotCellSize, "Edge length of the hotspot cells in degrees")
+	minTrips        = flag.Int("minTrips", 50, "Number of customer trips which need to have started in a cell to make it a hotspot")
+	minDuration     = flag.Duration("minDuration", 15*time.Minute, "Time a hotspot needs to be without available scooter before an alert is raised")
+	dayStart        = flag.Int("dayStart", sharealyzer.DefaultDayStart, "Hour of the day from which hotspots are monitored")
+	dayEnd          = flag.Int("dayEnd", sharealyzer.DefaultDayEnd, "Hour of the day until which hotspots are monitored")
+	timezone        = flag.String("timezone", "UTC", "Time zone of dayStart and dayEnd, i.e. Europe/Berlin")
+	webhook         = flag.String("webhook", "", "POST every alert as JSON to this URL, alerts are only logged if empty")
+	starvationsPath = flag.String("starvations", "./starvations.jsonl", "Append all starvations as JSON lines to this file, the statistics cover all starvations in it")
+	followFiles     = flag.Bool("follow", true, "Continuously evaluate new scrape files, otherwise stop after the existing files")
+	pprof           = flag.String("pprof", "", "Serve profiling endpoints on this address, i.e. localhost:6060")
+)
+
+func main() {
+	flag.Parse()
+	sharealyzer.ServeProfiling(*pprof)
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid time zone %s: %s", *timezone, err)
+	}
+	if *dayStart < 0 || *dayEnd > 24 || *dayStart >= *dayEnd {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid daytime from %d to %d", *dayStart, *dayEnd)
+	}
+	if *cellSize <= 0 {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "The cell size needs to be positive")
+	}
+
+	grid := sharealyzer.HotspotGrid{CellSize: *cellSize}
+	var trips []*sharealyzer.Trip
+	store := &sharealyzer.FileTripStore{Path: *tripStorePath}
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		if t.Type == sharealyzer.CUSTOMER_TRIP {
+			trips = append(trips, t)
+		}
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	hotspots := grid.Hotspots(trips, *minTrips)
+	if len(hotspots) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "None of the cells has %d of the %d customer trips", *minTrips, len(trips))
+	}
+	log.Printf("Monitoring %d hotspots", len(hotspots))
+
+	f, err := os.OpenFile(*starvationsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %s", *starvationsPath, err)
+	}
+	encoder := json.NewEncoder(f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("Exiting due to signal %s", sig.String())
+		cancel()
+	}()
+
+	results, err := circ.NewFileScraper(*baseDir).Scrape(ctx, *followFiles)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %s", *baseDir, err)
+	}
+	monitor := sharealyzer.NewStarvationMonitor(grid, hotspots, *minDuration, loc)
+	monitor.DayStart, monitor.DayEnd = *dayStart, *dayEnd
+	client := &http.Client{Timeout: sharealyzer.DefaultRequestTimeout}
+	for res := range circ.ConvertScrapeResult(results) {
+		alerts, ended := monitor.Observe(res)
+		for _, starvation := range alerts {
+			log.Printf("[WARNING] Hotspot %s at %.5f,%.5f has no available scooter since %s", starvation.Cell,
+				starvation.Center.Latitude, starvation.Center.Longitude, starvation.From.Format(time.RFC3339))
+			if *webhook != "" {
+				if err := postAlert(client, *webhook, starvation); err != nil {
+					log.Printf("[WARNING] Failed to send alert to %s: %s", *webhook, err)
+				}
+			}
+		}
+		for _, starvation := range ended {
+			if err := encoder.Encode(starvation); err != nil {
+				log.Fatalf("Failed to record starvation: %s", err)
+			}
+		}
+	}
+	// Starvations which still last are not recorded, they don't have a duration yet
+	f.Close()
+
+	showStatistics()
+}
+
+// postAlert sends a starvation as JSON to the webhook
+func postAlert(client *http.Client, url string, starvation *sharealyzer.Starvation) error {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(starvation); err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// showStatistics prints the statistics of all recorded starvations per hotspot
+func showStatistics() {
+	f, err := os.Open(*starvationsPath)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %s", *starvationsPath, err)
+	}
+	defer f.Close()
+	var starvations []*sharealyzer.Starvation
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		starvation := &sharealyzer.Starvation{}
+		if err := json.Unmarshal(scanner.Bytes(), starvation); err != nil {
+			log.Printf("[WARNING] Skipping invalid starvation: %s", err)
+			continue
+		}
+		starvations = append(starvations, starvation)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %s", *starvationsPath, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Hotspot\tCenter\tStarvations\tAlerts\tTotal\tLongest\t")
+	for _, stats := range sharealyzer.SummarizeStarvations(starvations) {
+		fmt.Fprintf(w, "%s\t%.5f,%.5f\t%d\t%d\t%s\t%s\t\n", stats.Cell, stats.Center.Latitude, stats.Center.Longitude,
+			stats.Starvations, stats.Alerts, stats.Total, stats.Longest)
+	}
+	w.Flush()
+}
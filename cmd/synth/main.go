@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/circ/circtest"
+)
+
+var (
+	defaults   = circtest.DefaultArchiveOptions()
+	timeFormat = "2006-01-02T15:04Z07:00"
+	baseDir    = flag.String("baseDir", "./synth", "Directory where to write the synthetic archive")
+	scooters   = flag.Int("scooters", defaults.Scooters, "Size of the simulated fleet")
+	startTime  = flag.String("from", defaults.From.Format(timeFormat), "Date of the first scrape including its zone")
+	files      = flag.Int("files", defaults.Files, "Number of scrape files")
+	interval   = flag.Duration("interval", defaults.Interval, "Time between two scrapes")
+	trips      = flag.Float64("tripProbability", defaults.TripProbability, "Chance of an available scooter to go on a trip between two scrapes")
+	seed       = flag.Int64("seed", defaults.Seed, "Seed of the simulation, the same seed generates the same archive")
+	fileFormat = flag.String("fileFormat", string(defaults.Format), "Format of the scrape files, json or jsonl")
+)
+
+func main() {
+	flag.Parse()
+
+	from, err := time.Parse(timeFormat, *startTime)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse start time: %s", err)
+	}
+	format, err := archive.ParseFormat(*fileFormat)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s", err)
+	}
+	dates, err := circtest.WriteArchive(*baseDir, circtest.ArchiveOptions{
+		Scooters:        *scooters,
+		From:            from,
+		Files:           *files,
+		Interval:        *interval,
+		TripProbability: *trips,
+		Seed:            *seed,
+		Format:          format,
+	})
+	if err != nil {
+		log.Fatalf("Failed to write archive: %s", err)
+	}
+	log.Printf("Wrote %d scrape files of %d scooters to %s", len(dates), *scooters, *baseDir)
+}
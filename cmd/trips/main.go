@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/report"
+)
+
+var (
+	tripStorePath  = flag.String("tripStore", "./trips.jsonl", "File with trips written by the ingester")
+	tokenStorePath = flag.String("tokenPath", "./.tokens", "The path of the persisted circ tokens, used by rides")
+	tolerance      = flag.Duration("tolerance", time.Minute*5, "Maximum start time difference between a ride and a detected trip")
+	perType        = flag.Int("perType", 20, "Number of trips of every type drawn by sample")
+	seed           = flag.Int64("seed", 0, "Seed of the random sample, 0 draws a different sample every time")
+	outPath        = flag.String("out", "sample.html", "Path of the HTML page written by sample")
+	timezone       = flag.String("timezone", "UTC", "Time zone of the hours of the day reported by corridor, i.e. Europe/Berlin")
+
+	// Thresholds of the classifier used by evaluate
+	relocationMinDistance   = flag.Float64("relocationMinDistance", sharealyzer.RelocationMinDistance, "Distance in km a relocation covers at least")
+	relocationMaxChargeLoss = flag.Float64("relocationMaxChargeLoss", sharealyzer.RelocationMaxChargeLoss, "Charge in percent a scooter loses at most while relocated")
+	swapMaxDistance         = flag.Float64("batterySwapMaxDistance", sharealyzer.BatterySwapMaxDistance, "Distance in km a scooter moves at most while its battery is swapped")
+	swapMaxDuration         = flag.Duration("batterySwapMaxDuration", sharealyzer.BatterySwapMaxDuration, "Time a battery swap takes at most")
+
+	// Period and assumptions of energy
+	energyFrom         = flag.String("from", "", "Only take trips started at or after this RFC3339 time into account, used by energy")
+	energyTo           = flag.String("to", "", "Only take trips started before this RFC3339 time into account, used by energy")
+	batteryCapacity    = flag.Float64("batteryCapacity", report.DefaultEnergyAssumptions().BatteryCapacity, "Energy of a full battery in kWh")
+	chargingEfficiency = flag.Float64("chargingEfficiency", report.DefaultEnergyAssumptions().ChargingEfficiency, "Share of the energy drawn from the grid which ends up in the battery")
+	gridIntensity      = flag.Float64("gridIntensity", report.DefaultEnergyAssumptions().GridIntensity, "Grams of CO2 equivalents per kWh drawn from the grid")
+	vanEmissions       = flag.Float64("vanEmissions", report.DefaultEnergyAssumptions().VanEmissions, "Grams of CO2 equivalents a collection van emits per km")
+	vanDistanceFactor  = flag.Float64("vanDistanceFactor", report.DefaultEnergyAssumptions().VanDistanceFactor, "Distance a van drives per km a scooter is moved")
+	scootersPerVan     = flag.Float64("scootersPerVan", report.DefaultEnergyAssumptions().ScootersPerVan, "Scooters collected or relocated in one van run")
+	swapVanDistance    = flag.Float64("swapVanDistance", report.DefaultEnergyAssumptions().SwapVanDistance, "Distance in km a van drives per battery swap")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] show <trip id>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] rides\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] sample\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] evaluate <labels.csv>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] corridor <from.geojson> <to.geojson>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] odometer\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] energy\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [flags] slowzones <zones.geojson>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	store := &sharealyzer.FileTripStore{Path: *tripStorePath}
+	switch {
+	case flag.NArg() == 2 && flag.Arg(0) == "show":
+		trip, err := store.Find(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to find trip %s: %s", flag.Arg(1), err)
+		}
+		showTrip(trip)
+	case flag.NArg() == 1 && flag.Arg(0) == "rides":
+		reconcileRides(store)
+	case flag.NArg() == 1 && flag.Arg(0) == "sample":
+		sampleTrips(store)
+	case flag.NArg() == 2 && flag.Arg(0) == "evaluate":
+		evaluateClassifier(store, flag.Arg(1))
+	case flag.NArg() == 3 && flag.Arg(0) == "corridor":
+		showCorridor(store, flag.Arg(1), flag.Arg(2))
+	case flag.NArg() == 1 && flag.Arg(0) == "odometer":
+		showOdometers(store)
+	case flag.NArg() == 1 && flag.Arg(0) == "energy":
+		showEnergy(store)
+	case flag.NArg() == 2 && flag.Arg(0) == "slowzones":
+		showSlowZoneEffect(store, flag.Arg(1))
+	default:
+		usage()
+		os.Exit(sharealyzer.ExitConfigError)
+	}
+}
+
+// reconcileRides compares the official ride history of the own account with the detected trips
+func reconcileRides(store *sharealyzer.FileTripStore) {
+	cc := circ.New(circ.WithTokenStore(&circ.FileTokenStore{Path: *tokenStorePath}))
+	rides, err := cc.Rides()
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitAuthError, "Failed to retrieve rides: %s", err)
+	}
+
+	detected := 0
+	for _, ride := range rides {
+		var match *sharealyzer.Trip
+		err := store.Each(func(t *sharealyzer.Trip) bool {
+			if t.ScooterID != ride.DeviceIdentifier {
+				return true
+			}
+			diff := t.StartTime.Sub(ride.StartTime())
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff <= *tolerance {
+				match = t
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			log.Fatalf("Failed to read trips: %s", err)
+		}
+		if match == nil {
+			fmt.Printf("%s %s: not detected\n", ride.StartTime().Format(time.RFC3339), ride.DeviceName)
+			continue
+		}
+		detected++
+		fmt.Printf("%s %s: trip %s, start off by %s, duration %s instead of %s\n",
+			ride.StartTime().Format(time.RFC3339), ride.DeviceName, match.ID,
+			match.StartTime.Sub(ride.StartTime()), match.Duration, ride.EndTime().Sub(ride.StartTime()))
+	}
+	fmt.Printf("Detected %d of %d rides\n", detected, len(rides))
+}
+
+// sampleTrips renders a random sample of trips of every type, so misclassifications can be spotted by eye
+func sampleTrips(store *sharealyzer.FileTripStore) {
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	sampler := report.NewTripSampler(*perType, *seed)
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		sampler.Add(t)
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	samples := sampler.Samples()
+	if len(samples) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No trips in %s", *tripStorePath)
+	}
+
+	f, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %s", *outPath, err)
+	}
+	if err := report.WriteSampleHTML(f, samples); err != nil {
+		log.Fatalf("Failed to render sample: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %s", *outPath, err)
+	}
+	log.Printf("Wrote sample of %d trip types with seed %d to %s", len(samples), *seed, *outPath)
+}
+
+// evaluateClassifier compares the classification of the labeled trips with the thresholds given by flags
+// to their labels
+func evaluateClassifier(store *sharealyzer.FileTripStore, labelsPath string) {
+	f, err := os.Open(labelsPath)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to open labels: %s", err)
+	}
+	labels, err := sharealyzer.ReadTripLabels(f)
+	f.Close()
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to read labels from %s: %s", labelsPath, err)
+	}
+
+	classifier := sharealyzer.Classifier{
+		RelocationMinDistance:   *relocationMinDistance,
+		RelocationMaxChargeLoss: *relocationMaxChargeLoss,
+		BatterySwapMaxDistance:  *swapMaxDistance,
+		BatterySwapMaxDuration:  *swapMaxDuration,
+	}
+	evaluator := sharealyzer.NewEvaluator(classifier, labels)
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		evaluator.Add(t)
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	for _, id := range evaluator.Missing() {
+		log.Printf("[WARNING] Labeled trip %s is not in the trip store", id)
+	}
+	eval := evaluator.Evaluation()
+	for _, id := range eval.Unclassified {
+		log.Printf("[WARNING] Labeled trip %s never finished and can't be classified", id)
+	}
+	if eval.Labeled == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "None of the %d labeled trips was found", len(labels))
+	}
+
+	fmt.Printf("Evaluated %d labeled trips, %d classified correctly (accuracy %.1f%%)\n\n", eval.Labeled, eval.Correct, eval.Accuracy()*100)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Type\tPrecision\tRecall\tF1\tTrue pos.\tFalse pos.\tFalse neg.")
+	for _, m := range eval.Metrics {
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\t%d\t%d\t%d\n", m.Type, m.Precision(), m.Recall(), m.F1(),
+			m.TruePositives, m.FalsePositives, m.FalseNegatives)
+	}
+	w.Flush()
+
+	fmt.Println("\nConfusion (rows are labels, columns the classification):")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "\t")
+	for _, m := range eval.Metrics {
+		fmt.Fprintf(w, "%s\t", m.Type)
+	}
+	fmt.Fprintln(w)
+	for _, label := range eval.Metrics {
+		fmt.Fprintf(w, "%s\t", label.Type)
+		for _, classified := range eval.Metrics {
+			fmt.Fprintf(w, "%d\t", eval.Confusion[label.Type][classified.Type])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// showCorridor lists the customer trips between the areas of two GeoJSON files with their distribution over
+// the hours of the day
+func showCorridor(store *sharealyzer.FileTripStore, fromPath, toPath string) {
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid time zone %s: %s", *timezone, err)
+	}
+	from, to := readArea(fromPath), readArea(toPath)
+	var trips []*sharealyzer.Trip
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		if t.Type == sharealyzer.CUSTOMER_TRIP {
+			trips = append(trips, t)
+		}
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	corridor := report.ComputeCorridor(trips, from, to, loc)
+	if len(corridor.Forward.Trips)+len(corridor.Backward.Trips) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "None of the %d customer trips went between %s and %s", len(trips), fromPath, toPath)
+	}
+
+	directions := []struct {
+		name      string
+		direction report.CorridorDirection
+	}{
+		{fromPath + " -> " + toPath, corridor.Forward},
+		{toPath + " -> " + fromPath, corridor.Backward},
+	}
+	for _, d := range directions {
+		fmt.Printf("%s: %d trips, median %.2f km, median %.1f minutes\n", d.name, len(d.direction.Trips),
+			d.direction.Distance.P50, d.direction.Duration.P50)
+	}
+
+	fmt.Printf("\nTrips per hour of day (%s):\n", loc)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Hour\tForward\tBackward\t")
+	for hour := 0; hour < 24; hour++ {
+		fmt.Fprintf(w, "%02d\t%d\t%d\t\n", hour, corridor.Forward.TripsPerHour[hour], corridor.Backward.TripsPerHour[hour])
+	}
+	w.Flush()
+
+	for _, d := range directions {
+		fmt.Printf("\n%s:\n", d.name)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, t := range d.direction.Trips {
+			fmt.Fprintf(w, "%s\t%s\t%.1f min\t%.2f km\t\n", t.ID, t.StartTime.In(loc).Format("2006-01-02 15:04"),
+				t.Duration.Minutes(), t.Distance)
+		}
+		w.Flush()
+	}
+}
+
+// showOdometers lists the estimated distance every scooter was ridden, the most ridden first
+func showOdometers(store *sharealyzer.FileTripStore) {
+	estimator := report.NewOdometerEstimator()
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		estimator.Add(t)
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	odometers := estimator.Odometers()
+	if len(odometers) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No customer trips in %s", *tripStorePath)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Provider\tScooter\tDistance\tTrips\tUnknown distance\tFirst trip\tLast trip\t")
+	for _, o := range odometers {
+		fmt.Fprintf(w, "%s\t%s\t%.1f km\t%d\t%d\t%s\t%s\t\n", o.Provider, o.ScooterID, o.Distance, o.Trips, o.UnknownDistance,
+			o.FirstTrip.Format(time.RFC3339), o.LastTrip.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// showEnergy estimates the energy and emissions of the fleet with the assumptions given by flags
+func showEnergy(store *sharealyzer.FileTripStore) {
+	var from, to time.Time
+	var err error
+	if *energyFrom != "" {
+		if from, err = time.Parse(time.RFC3339, *energyFrom); err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid start of the period: %s", err)
+		}
+	}
+	if *energyTo != "" {
+		if to, err = time.Parse(time.RFC3339, *energyTo); err != nil {
+			sharealyzer.Exitf(sharealyzer.ExitConfigError, "Invalid end of the period: %s", err)
+		}
+	}
+	var trips []*sharealyzer.Trip
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		trips = append(trips, t)
+		if *energyFrom == "" && (from.IsZero() || t.StartTime.Before(from)) {
+			from = t.StartTime
+		}
+		if *energyTo == "" && !t.StartTime.Before(to) {
+			to = t.StartTime.Add(time.Nanosecond)
+		}
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	if len(trips) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "No trips in %s", *tripStorePath)
+	}
+
+	r := report.ComputeEnergy(trips, from, to, report.EnergyAssumptions{
+		BatteryCapacity:    *batteryCapacity,
+		ChargingEfficiency: *chargingEfficiency,
+		GridIntensity:      *gridIntensity,
+		VanEmissions:       *vanEmissions,
+		VanDistanceFactor:  *vanDistanceFactor,
+		ScootersPerVan:     *scootersPerVan,
+		SwapVanDistance:    *swapVanDistance,
+	})
+	fmt.Printf("Energy and emissions from %s to %s\n\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	fmt.Printf("Ridden:           %.1f km using %.2f kWh of battery energy\n", r.RideDistance, r.RideEnergy)
+	fmt.Printf("Charged:          %.2f kWh, %.2f kWh from the grid\n", r.ChargedEnergy, r.GridEnergy)
+	fmt.Printf("Vans:             %.1f km\n", r.VanDistance)
+	fmt.Printf("CO2e charging:    %.2f kg\n", r.ChargingCO2)
+	fmt.Printf("CO2e logistics:   %.2f kg\n", r.VanCO2)
+	fmt.Printf("CO2e total:       %.2f kg, %.0f g per km ridden\n", r.TotalCO2(), r.CO2PerKm())
+}
+
+// readArea reads the polygons of a GeoJSON file
+// showSlowZoneEffect compares the customer trips crossing slow zones to the other trips
+func showSlowZoneEffect(store *sharealyzer.FileTripStore, zonesPath string) {
+	zones := readArea(zonesPath)
+	var trips []*sharealyzer.Trip
+	if err := store.Each(func(t *sharealyzer.Trip) bool {
+		if t.Type == sharealyzer.CUSTOMER_TRIP {
+			trips = append(trips, t)
+		}
+		return true
+	}); err != nil {
+		log.Fatalf("Failed to read trips: %s", err)
+	}
+	effect := report.ComputeSlowZoneEffect(trips, zones)
+	if effect.Crossing.Trips == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitNoData, "None of the %d customer trips crossed %s", len(trips), zonesPath)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tTrips\tMedian distance\tMedian duration\tMedian speed\t")
+	for _, group := range []struct {
+		name  string
+		trips report.SlowZoneTrips
+	}{{"Crossing", effect.Crossing}, {"Other", effect.Other}} {
+		fmt.Fprintf(w, "%s\t%d\t%.2f km\t%.1f min\t%.1f km/h\t\n", group.name, group.trips.Trips,
+			group.trips.Distance.P50, group.trips.Duration.P50, group.trips.Speed.P50)
+	}
+	w.Flush()
+	if effect.Other.Trips == 0 {
+		fmt.Println("\nNo trips outside of the slow zones to estimate the delay")
+		return
+	}
+	fmt.Printf("\nDelay of crossing trips: median %.1f min, average %.1f min, total %.1f h\n",
+		effect.Delay.P50, effect.Delay.Average, effect.TotalDelay/60)
+}
+
+func readArea(path string) sharealyzer.Polygons {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to read area: %s", err)
+	}
+	area, err := sharealyzer.ParseGeoJSONPolygons(data)
+	if err != nil {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "Failed to parse area %s: %s", path, err)
+	}
+	if len(area) == 0 {
+		sharealyzer.Exitf(sharealyzer.ExitConfigError, "%s contains no polygon", path)
+	}
+	return area
+}
+
+func showTrip(t *sharealyzer.Trip) {
+	fmt.Printf("Trip %s (%s)\n", t.ID, t.Type)
+	fmt.Printf("Scooter:      %s (%s)\n", t.ScooterID, t.ScooterProvider)
+	fmt.Printf("User:         %s\n", t.UserID)
+	fmt.Printf("Start:        %s at %s with %.0f%% charge\n", t.StartTime.Format(time.RFC3339),
+		formatLocation(t.StartLocation), t.StartChargeLevel)
+	fmt.Printf("End:          %s at %s with %.0f%% charge\n", t.EndTime.Format(time.RFC3339),
+		formatLocation(t.EndLocation), t.EndChargeLevel)
+	fmt.Printf("Duration:     %.1f minutes\n", t.Duration.Minutes())
+	fmt.Printf("Distance:     %.2f km\n", t.Distance)
+	fmt.Printf("Cost:         %.2f €\n", float64(t.Cost)/100.0)
+	if t.StartLocation == nil || t.EndLocation == nil {
+		// Lost and open trips have no end location
+		return
+	}
+	fmt.Printf("OpenStreetMap: %s\n", osmLink(t))
+	fmt.Printf("geojson.io:    %s\n", geoJSONLink(t))
+}
+
+func formatLocation(l *sharealyzer.GeoLocation) string {
+	if l == nil {
+		return "unknown location"
+	}
+	return fmt.Sprintf("%.6f,%.6f", l.Latitude, l.Longitude)
+}
+
+// osmLink and geoJSONLink require a start and end location
+func osmLink(t *sharealyzer.Trip) string {
+	return fmt.Sprintf("https://www.openstreetmap.org/directions?route=%.6f%%2C%.6f%%3B%.6f%%2C%.6f",
+		t.StartLocation.Latitude, t.StartLocation.Longitude, t.EndLocation.Latitude, t.EndLocation.Longitude)
+}
+
+func geoJSONLink(t *sharealyzer.Trip) string {
+	point := func(name string, l *sharealyzer.GeoLocation) map[string]interface{} {
+		return map[string]interface{}{
+			"type":       "Feature",
+			"properties": map[string]string{"name": name},
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{l.Longitude, l.Latitude},
+			},
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "FeatureCollection",
+		"features": []interface{}{
+			point("start", t.StartLocation),
+			point("end", t.EndLocation),
+			map[string]interface{}{
+				"type":       "Feature",
+				"properties": map[string]string{"trip": t.ID},
+				"geometry": map[string]interface{}{
+					"type": "LineString",
+					"coordinates": [][]float64{
+						{t.StartLocation.Longitude, t.StartLocation.Latitude},
+						{t.EndLocation.Longitude, t.EndLocation.Latitude},
+					},
+				},
+			},
+		},
+	})
+	return "http://geojson.io/#data=data:application/json," + url.PathEscape(string(data))
+}
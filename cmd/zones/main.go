@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/pkg/errors"
+)
+
+var (
+	phonePrefix    = flag.String("phonePrefix", "+49", "Country prefix of your phone number in + format")
+	phoneNumber    = flag.String("phoneNumber", "", "Your phone number to authenticate")
+	tokenStorePath = flag.String("tokenPath", "./.tokens", "The path where to persist tokens")
+	latTopLeft     = flag.Float64("latTopLef", 51.582780, "Latitude Top Left")
+	lonTopLeft     = flag.Float64("lonTopLeft", 7.325945, "Longitude Top Left")
+	latBottomRight = flag.Float64("larBottomLeft", 51.475727, "Latitude Bottom Left")
+	lonBottomRight = flag.Float64("lonBottomRight", 7.558172, "Longitude Bottom right")
+)
+
+func main() {
+	flag.Parse()
+
+	cc := circ.New(circ.WithTokenStore(&circ.FileTokenStore{Path: *tokenStorePath}))
+	scraper := circ.NewScraper(cc, *latTopLeft, *lonTopLeft, *latBottomRight, *lonBottomRight, *phonePrefix, *phoneNumber)
+	scooters, err := scraper.ScrapeOnce()
+	if err != nil {
+		if _, cooldown := errors.Cause(err).(*circ.LoginCooldownError); cooldown || circ.IsAuthError(errors.Cause(err)) {
+			sharealyzer.Exitf(sharealyzer.ExitAuthError, "Failed to authenticate with circ: %s", err)
+		}
+		sharealyzer.Exitf(sharealyzer.ExitFailure, "Failed to scrape circ: %s", err)
+	}
+
+	fmt.Printf("%-40s %s\n", "ZONE", "SCOOTERS")
+	for _, zone := range circ.CountZones(scooters) {
+		fmt.Printf("%-40s %d\n", zone.ZoneIdentifier, zone.Scooters)
+	}
+}
@@ -0,0 +1,143 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CoverageZone is an area in which a minimum number of charged, rentable scooters should be available at
+// any time
+type CoverageZone struct {
+	Name        string
+	Area        Polygons
+	MinScooters int
+	// MinCharge is the charge in percent a scooter needs to count as available
+	MinCharge float64
+}
+
+// Available returns the number of rentable scooters in the zone with at least MinCharge
+func (z *CoverageZone) Available(scooters []*Scooter) int {
+	available := 0
+	for _, scooter := range scooters {
+		if scooter.State != Broken && scooter.State != InUse && scooter.State != Missing && scooter.ChargeLevel >= z.MinCharge &&
+			z.Area.Contains(scooter.Location) {
+			available++
+		}
+	}
+	return available
+}
+
+type coverageFeatures struct {
+	Features []struct {
+		Properties struct {
+			Name        string   `json:"name"`
+			MinScooters *int     `json:"min_scooters"`
+			MinCharge   *float64 `json:"min_charge"`
+		} `json:"properties"`
+		Geometry json.RawMessage `json:"geometry"`
+	} `json:"features"`
+}
+
+// ParseCoverageZones reads zones from a GeoJSON FeatureCollection. Every feature with a polygon is a zone
+// named by its name property. The properties min_scooters and min_charge override the given defaults.
+func ParseCoverageZones(data []byte, minScooters int, minCharge float64) ([]CoverageZone, error) {
+	var collection coverageFeatures
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	var zones []CoverageZone
+	for i, feature := range collection.Features {
+		area, err := ParseGeoJSONPolygons(feature.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("Feature %d has an invalid geometry: %s", i, err)
+		}
+		if len(area) == 0 {
+			continue
+		}
+		zone := CoverageZone{Name: feature.Properties.Name, Area: area, MinScooters: minScooters, MinCharge: minCharge}
+		if zone.Name == "" {
+			zone.Name = fmt.Sprintf("zone %d", i)
+		}
+		if feature.Properties.MinScooters != nil {
+			zone.MinScooters = *feature.Properties.MinScooters
+		}
+		if feature.Properties.MinCharge != nil {
+			zone.MinCharge = *feature.Properties.MinCharge
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// CoverageViolation is a time range in which a zone had fewer available scooters than required
+type CoverageViolation struct {
+	Zone string    `json:"zone"`
+	From time.Time `json:"from"`
+	// To is the date of the first scrape result which satisfied the zone again, zero while the violation
+	// lasts
+	To       time.Time `json:"to"`
+	Required int       `json:"required"`
+	// MinAvailable is the lowest number of available scooters during the violation
+	MinAvailable int `json:"min_available"`
+}
+
+// Duration returns the length of a finished violation
+func (v *CoverageViolation) Duration() time.Duration {
+	if v.To.IsZero() {
+		return 0
+	}
+	return v.To.Sub(v.From)
+}
+
+// CoverageMonitor evaluates every scrape result against the coverage zones and tracks the violations
+type CoverageMonitor struct {
+	Zones []CoverageZone
+
+	open map[string]*CoverageViolation
+}
+
+// NewCoverageMonitor creates a monitor of the zones
+func NewCoverageMonitor(zones []CoverageZone) *CoverageMonitor {
+	return &CoverageMonitor{
+		Zones: zones,
+		open:  make(map[string]*CoverageViolation),
+	}
+}
+
+// Observe evaluates the zones for a scrape result. It returns the violations which started and the ones
+// which ended with it.
+func (m *CoverageMonitor) Observe(res ScrapeResult) (started, ended []*CoverageViolation) {
+	scooters := res.Scooters()
+	for i := range m.Zones {
+		zone := &m.Zones[i]
+		available := zone.Available(scooters)
+		violation, violated := m.open[zone.Name]
+		switch {
+		case available < zone.MinScooters && !violated:
+			violation = &CoverageViolation{Zone: zone.Name, From: res.ScrapeDate(), Required: zone.MinScooters, MinAvailable: available}
+			m.open[zone.Name] = violation
+			started = append(started, violation)
+		case available < zone.MinScooters && available < violation.MinAvailable:
+			violation.MinAvailable = available
+		case available >= zone.MinScooters && violated:
+			violation.To = res.ScrapeDate()
+			delete(m.open, zone.Name)
+			ended = append(ended, violation)
+		}
+	}
+	return started, ended
+}
+
+// Open returns the violations which didn't end yet ordered by zone
+func (m *CoverageMonitor) Open() []*CoverageViolation {
+	open := make([]*CoverageViolation, 0, len(m.open))
+	for _, violation := range m.open {
+		open = append(open, violation)
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].Zone < open[j].Zone
+	})
+	return open
+}
@@ -0,0 +1,73 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCoverageZones(t *testing.T) {
+	data := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "station", "min_scooters": 10},
+			"geometry": {"type": "Polygon", "coordinates": [[[7.40, 51.50], [7.42, 51.50], [7.42, 51.52], [7.40, 51.52]]]}},
+		{"type": "Feature", "properties": {"min_charge": 50},
+			"geometry": {"type": "Polygon", "coordinates": [[[7.50, 51.50], [7.52, 51.50], [7.52, 51.52], [7.50, 51.52]]]}},
+		{"type": "Feature", "properties": {"name": "landmark"}, "geometry": {"type": "Point", "coordinates": [7.41, 51.51]}}
+	]}`
+	zones, err := ParseCoverageZones([]byte(data), 3, 20)
+	require.NoError(t, err)
+	require.Len(t, zones, 2)
+	assert.Equal(t, "station", zones[0].Name)
+	assert.Equal(t, 10, zones[0].MinScooters)
+	assert.Equal(t, 20.0, zones[0].MinCharge)
+	assert.Equal(t, "zone 1", zones[1].Name)
+	assert.Equal(t, 3, zones[1].MinScooters)
+	assert.Equal(t, 50.0, zones[1].MinCharge)
+}
+
+func TestCoverageMonitor(t *testing.T) {
+	zone := CoverageZone{
+		Name: "station",
+		Area: Polygons{{
+			NewGeoLocation(51.50, 7.40), NewGeoLocation(51.50, 7.42), NewGeoLocation(51.52, 7.42), NewGeoLocation(51.52, 7.40),
+		}},
+		MinScooters: 2,
+		MinCharge:   20,
+	}
+	inside := NewGeoLocation(51.51, 7.41)
+	charged := &Scooter{ID: "a", ChargeLevel: 80, Location: inside}
+	charged2 := &Scooter{ID: "b", ChargeLevel: 50, Location: inside}
+	// Neither of them counts
+	empty := &Scooter{ID: "c", ChargeLevel: 10, Location: inside}
+	broken := &Scooter{ID: "d", ChargeLevel: 80, State: Broken, Location: inside}
+	elsewhere := &Scooter{ID: "e", ChargeLevel: 80, Location: NewGeoLocation(51.60, 7.41)}
+	assert.Equal(t, 2, zone.Available([]*Scooter{charged, charged2, empty, broken, elsewhere}))
+
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	snapshots := [][]*Scooter{
+		{charged, charged2},
+		{charged, empty, broken},
+		{empty, elsewhere},
+		{charged},
+		{charged, charged2},
+		{empty},
+	}
+	monitor := NewCoverageMonitor([]CoverageZone{zone})
+	var started, ended []*CoverageViolation
+	for i, snapshot := range snapshots {
+		s, e := monitor.Observe(NewScrapeResult("circ", start.Add(time.Duration(i)*time.Minute), snapshot))
+		started = append(started, s...)
+		ended = append(ended, e...)
+	}
+	require.Len(t, started, 2)
+	require.Len(t, ended, 1)
+	assert.Equal(t, &CoverageViolation{Zone: "station", From: start.Add(time.Minute), To: start.Add(4 * time.Minute),
+		Required: 2, MinAvailable: 0}, ended[0])
+	assert.Equal(t, 3*time.Minute, ended[0].Duration())
+	open := monitor.Open()
+	require.Len(t, open, 1)
+	assert.Equal(t, start.Add(5*time.Minute), open[0].From)
+	assert.True(t, open[0].To.IsZero())
+}
@@ -0,0 +1,230 @@
+package sharealyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DecodeMode decides how a RecordDecoder deals with records which don't match the expected schema
+type DecodeMode string
+
+// Valid DecodeModes
+const (
+	// DecodeLenient decodes whatever it can and only records unknown and missing fields
+	DecodeLenient DecodeMode = "lenient"
+	// DecodeStrict rejects records with unknown fields or without required fields
+	DecodeStrict DecodeMode = "strict"
+)
+
+// ParseDecodeMode parses the name of a DecodeMode
+func ParseDecodeMode(mode string) (DecodeMode, error) {
+	switch DecodeMode(mode) {
+	case DecodeLenient, DecodeStrict:
+		return DecodeMode(mode), nil
+	}
+	return "", fmt.Errorf("Unknown decode mode %s, expected lenient or strict", mode)
+}
+
+// SchemaDriftError is returned by a RecordDecoder in strict mode if a record doesn't match the schema
+type SchemaDriftError struct {
+	Unknown []string
+	Missing []string
+}
+
+func (s *SchemaDriftError) Error() string {
+	return fmt.Sprintf("Record doesn't match the schema, unknown fields: [%s], missing fields: [%s]",
+		strings.Join(s.Unknown, ", "), strings.Join(s.Missing, ", "))
+}
+
+// IsSchemaDrift returns the SchemaDriftError if err is one
+func IsSchemaDrift(err error) (*SchemaDriftError, bool) {
+	driftErr, ok := err.(*SchemaDriftError)
+	return driftErr, ok
+}
+
+// SchemaDrift counts the records with fields a RecordDecoder didn't expect or missed. A renamed field shows
+// up as both, unknown under its new name and missing under its old one.
+type SchemaDrift struct {
+	Records int            `json:"records"`
+	Unknown map[string]int `json:"unknown_fields"`
+	Missing map[string]int `json:"missing_fields"`
+}
+
+// Drifted returns true if any record didn't match the schema
+func (s SchemaDrift) Drifted() bool {
+	return len(s.Unknown) > 0 || len(s.Missing) > 0
+}
+
+// String describes the drift in a single line for logging
+func (s SchemaDrift) String() string {
+	return fmt.Sprintf("%d records, unknown fields: [%s], missing fields: [%s]",
+		s.Records, countList(s.Unknown), countList(s.Missing))
+}
+
+// Save writes the drift as JSON report to path
+func (s SchemaDrift) Save(path string) error {
+	tmpPath := path + ".tmp"
+	reportFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(reportFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		reportFile.Close()
+		return err
+	}
+	if err := reportFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func countList(counts map[string]int) string {
+	fields := make([]string, 0, len(counts))
+	for field, count := range counts {
+		fields = append(fields, fmt.Sprintf("%s: %d", field, count))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+// RecordDecoder decodes the JSON records of a provider API and detects schema drift, i.e. because the
+// provider added or renamed fields. Fields of the target struct are known, fields which are not in the
+// struct are silently lost by encoding/json, which this makes visible. It is safe for concurrent use.
+type RecordDecoder struct {
+	Mode DecodeMode
+	// Required fields need to be present and not null in every record
+	Required []string
+
+	lock  sync.Mutex
+	drift SchemaDrift
+	known map[reflect.Type]map[string]bool
+}
+
+// NewRecordDecoder creates a RecordDecoder for records with the given required fields
+func NewRecordDecoder(mode DecodeMode, required ...string) *RecordDecoder {
+	return &RecordDecoder{Mode: mode, Required: required}
+}
+
+// Decode decodes a single record into v, which needs to be a pointer to a struct. In lenient mode drift is
+// only recorded, in strict mode a SchemaDriftError is returned.
+func (d *RecordDecoder) Decode(record []byte, v interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return err
+	}
+	known := d.knownFields(reflect.TypeOf(v))
+	driftErr := &SchemaDriftError{}
+	for field := range fields {
+		if !known[field] {
+			driftErr.Unknown = append(driftErr.Unknown, field)
+		}
+	}
+	for _, field := range d.Required {
+		if value, exists := fields[field]; !exists || bytes.Equal(value, []byte("null")) {
+			driftErr.Missing = append(driftErr.Missing, field)
+		}
+	}
+	sort.Strings(driftErr.Unknown)
+	d.record(driftErr)
+
+	if d.Mode != DecodeStrict {
+		return json.Unmarshal(record, v)
+	}
+	if len(driftErr.Unknown) > 0 || len(driftErr.Missing) > 0 {
+		return driftErr
+	}
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// record counts the drift of a record and logs fields when they are seen for the first time
+func (d *RecordDecoder) record(driftErr *SchemaDriftError) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.drift.Records++
+	for _, field := range driftErr.Unknown {
+		if d.drift.Unknown == nil {
+			d.drift.Unknown = make(map[string]int)
+		}
+		if d.drift.Unknown[field] == 0 {
+			log.Printf("[WARNING] Provider sent unknown field %s", field)
+		}
+		d.drift.Unknown[field]++
+	}
+	for _, field := range driftErr.Missing {
+		if d.drift.Missing == nil {
+			d.drift.Missing = make(map[string]int)
+		}
+		if d.drift.Missing[field] == 0 {
+			log.Printf("[WARNING] Provider didn't send required field %s", field)
+		}
+		d.drift.Missing[field]++
+	}
+}
+
+// knownFields returns the JSON names of all fields of the struct t points to
+func (d *RecordDecoder) knownFields(t reflect.Type) map[string]bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if fields, exists := d.known[t]; exists {
+		return fields
+	}
+	fields := make(map[string]bool)
+	addFields(t, fields)
+	if d.known == nil {
+		d.known = make(map[reflect.Type]map[string]bool)
+	}
+	d.known[t] = fields
+	return fields
+}
+
+func addFields(t reflect.Type, fields map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			addFields(field.Type, fields)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+}
+
+// Drift returns a copy of the drift of all decoded records so far
+func (d *RecordDecoder) Drift() SchemaDrift {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	drift := SchemaDrift{Records: d.drift.Records, Unknown: make(map[string]int), Missing: make(map[string]int)}
+	for field, count := range d.drift.Unknown {
+		drift.Unknown[field] = count
+	}
+	for field, count := range d.drift.Missing {
+		drift.Missing[field] = count
+	}
+	return drift
+}
@@ -0,0 +1,68 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type decodedBase struct {
+	ID string `json:"id"`
+}
+
+type decodedRecord struct {
+	decodedBase
+	Charge  int     `json:"charge"`
+	Comment *string `json:"comment,omitempty"`
+	Ignored string  `json:"-"`
+}
+
+func TestRecordDecoder(t *testing.T) {
+	lenient := NewRecordDecoder(DecodeLenient, "id", "charge")
+	record := &decodedRecord{}
+	require.NoError(t, lenient.Decode([]byte(`{"id":"a","charge":50,"comment":null}`), record))
+	assert.Equal(t, "a", record.ID)
+	assert.False(t, lenient.Drift().Drifted())
+
+	// A renamed field is unknown under its new and missing under its old name
+	record = &decodedRecord{}
+	require.NoError(t, lenient.Decode([]byte(`{"id":"b","chargeLevel":50,"Ignored":"x"}`), record))
+	assert.Equal(t, "b", record.ID)
+	require.NoError(t, lenient.Decode([]byte(`{"id":null,"chargeLevel":20}`), &decodedRecord{}))
+	drift := lenient.Drift()
+	assert.Equal(t, 3, drift.Records)
+	assert.Equal(t, map[string]int{"chargeLevel": 2, "Ignored": 1}, drift.Unknown)
+	assert.Equal(t, map[string]int{"charge": 2, "id": 1}, drift.Missing)
+	assert.Equal(t, "3 records, unknown fields: [Ignored: 1, chargeLevel: 2], missing fields: [charge: 2, id: 1]", drift.String())
+
+	strict := NewRecordDecoder(DecodeStrict, "id")
+	require.NoError(t, strict.Decode([]byte(`{"id":"a","charge":50}`), &decodedRecord{}))
+	err := strict.Decode([]byte(`{"id":"a","chargeLevel":50}`), &decodedRecord{})
+	driftErr, ok := IsSchemaDrift(err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"chargeLevel"}, driftErr.Unknown)
+	assert.Empty(t, driftErr.Missing)
+
+	_, err = ParseDecodeMode("sloppy")
+	assert.Error(t, err)
+}
+
+func TestSchemaDriftSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "drift.json")
+	drift := SchemaDrift{Records: 2, Unknown: map[string]int{"lat": 2}, Missing: map[string]int{"latitude": 2}}
+	require.NoError(t, drift.Save(path))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var loaded SchemaDrift
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	assert.Equal(t, drift, loaded)
+}
@@ -0,0 +1,121 @@
+// Package duckdb materializes scrape archives and trips into a DuckDB database file and runs SQL against it.
+// It uses the duckdb command line tool, which needs to be installed, instead of linking DuckDB.
+package duckdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/export"
+	"github.com/pkg/errors"
+)
+
+// DefaultBinary is the name of the duckdb command line tool looked up in PATH
+const DefaultBinary = "duckdb"
+
+// DB is a DuckDB database file
+type DB struct {
+	Path string
+	// Binary is the duckdb command line tool, defaults to DefaultBinary
+	Binary string
+}
+
+// Open returns the database at path, which is created by the first statement if it doesn't exist
+func Open(path string) *DB {
+	return &DB{Path: path, Binary: DefaultBinary}
+}
+
+func (db *DB) run(sql string, args ...string) ([]byte, error) {
+	binary := db.Binary
+	if binary == "" {
+		binary = DefaultBinary
+	}
+	// -bail stops at the first failing statement and makes the command line tool exit with an error
+	cmd := exec.Command(binary, append(append([]string{"-bail"}, args...), db.Path)...)
+	cmd.Stdin = strings.NewReader(sql)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "duckdb failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Exec runs one or more SQL statements
+func (db *DB) Exec(sql string) error {
+	_, err := db.run(sql)
+	return err
+}
+
+// Query runs a SQL query and returns the rows as maps from column name to value. Numbers are returned as
+// float64 and timestamps as strings.
+func (db *DB) Query(sql string) ([]map[string]interface{}, error) {
+	out, err := db.run(sql, "-json")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, errors.Wrap(err, "Invalid duckdb output")
+	}
+	return rows, nil
+}
+
+// quote quotes s as SQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Materialize replaces the observations table with the observations of all results and the trips table
+// with the trips of the trip store at tripStorePath, which is skipped if it's empty. It returns the number
+// of observations.
+func Materialize(db *DB, results <-chan sharealyzer.ScrapeResult, tripStorePath string) (int, error) {
+	tmpDir, err := ioutil.TempDir("", "sharealyzer-duckdb")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	csvPath := filepath.Join(tmpDir, "observations.csv")
+	f, err := os.Create(csvPath)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := export.WriteObservationsCSV(f, results)
+	f.Close()
+	if err != nil {
+		return rows, errors.Wrap(err, "Failed to write observations")
+	}
+
+	sql := fmt.Sprintf(`CREATE OR REPLACE TABLE observations AS SELECT * FROM read_csv(%s, header = true, columns = {
+  'timestamp': 'TIMESTAMPTZ', 'provider': 'VARCHAR', 'scooter_id': 'VARCHAR', 'lat': 'DOUBLE',
+  'lon': 'DOUBLE', 'charge': 'DOUBLE', 'state': 'VARCHAR'});
+`, quote(csvPath))
+	if tripStorePath != "" {
+		absPath, err := filepath.Abs(tripStorePath)
+		if err != nil {
+			return rows, err
+		}
+		sql += fmt.Sprintf(`CREATE OR REPLACE TABLE trips AS SELECT
+  id, scooter_id, provider, type, user_id,
+  CAST(start_time AS TIMESTAMPTZ) AS start_time, CAST(end_time AS TIMESTAMPTZ) AS end_time,
+  duration / 1e9 AS duration_seconds, distance, cost,
+  start_location.latitude AS start_lat, start_location.longitude AS start_lon,
+  end_location.latitude AS end_lat, end_location.longitude AS end_lon,
+  start_charge_level, end_charge_level
+FROM read_json_auto(%s, format = 'newline_delimited');
+`, quote(absPath))
+	}
+	return rows, db.Exec(sql)
+}
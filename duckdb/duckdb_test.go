@@ -0,0 +1,101 @@
+package duckdb
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDuckDB creates a script which records its arguments and stdin and prints output
+func fakeDuckDB(t *testing.T, dir, output string) string {
+	path := filepath.Join(dir, "duckdb")
+	script := "#!/bin/sh\necho \"$@\" > " + dir + "/args\ncat > " + dir + "/stdin\nprintf '%s' '" + output + "'\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0700))
+	return path
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "duckdb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := &DB{Path: "analysis.duckdb", Binary: fakeDuckDB(t, dir, `[{"n":2,"state":"IN_USE"}]`)}
+	rows, err := db.Query("SELECT count(*) AS n, state FROM observations GROUP BY state")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"n": float64(2), "state": "IN_USE"}}, rows)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.Equal(t, "-bail -json analysis.duckdb\n", string(args))
+}
+
+func TestMaterialize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "duckdb")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	results := make(chan sharealyzer.ScrapeResult, 1)
+	results <- sharealyzer.NewScrapeResult("circ", time.Now(), []*sharealyzer.Scooter{{ID: "a"}, {ID: "b"}})
+	close(results)
+
+	db := &DB{Path: filepath.Join(dir, "analysis.duckdb"), Binary: fakeDuckDB(t, dir, "")}
+	rows, err := Materialize(db, results, "trips.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	sql, err := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	require.NoError(t, err)
+	assert.Contains(t, string(sql), "CREATE OR REPLACE TABLE observations")
+	assert.Contains(t, string(sql), "CREATE OR REPLACE TABLE trips")
+}
+
+func TestMissingBinary(t *testing.T) {
+	db := &DB{Path: "analysis.duckdb", Binary: "/nonexistent/duckdb"}
+	_, err := db.Query("SELECT 1")
+	assert.Error(t, err)
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "duckdb")
+	// Warnings on stderr are no failure
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\necho 'Error messages are explained in the docs' >&2\n"), 0700))
+	db := &DB{Path: "analysis.duckdb", Binary: path}
+	assert.NoError(t, db.Exec("SELECT 1"))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\necho 'Catalog Error: Table does not exist' >&2\nexit 1\n"), 0700))
+	err := db.Exec("SELECT 1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Catalog Error")
+}
+
+func TestDuckDB(t *testing.T) {
+	if _, err := exec.LookPath(DefaultBinary); err != nil {
+		t.Skip("duckdb is not installed")
+	}
+	db := Open(filepath.Join(t.TempDir(), "analysis.duckdb"))
+
+	results := make(chan sharealyzer.ScrapeResult, 1)
+	results <- sharealyzer.NewScrapeResult("circ", time.Now(), []*sharealyzer.Scooter{
+		{ID: "a", State: sharealyzer.InUse, Location: sharealyzer.NewGeoLocation(51.5, 7.4)},
+		{ID: "b", State: sharealyzer.InUse, Location: sharealyzer.NewGeoLocation(51.5, 7.4)},
+	})
+	close(results)
+	_, err := Materialize(db, results, "")
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT count(*) AS n, state FROM observations GROUP BY state")
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"n": float64(2), "state": "IN_USE"}}, rows)
+
+	_, err = db.Query("SELECT * FROM missing")
+	assert.Error(t, err)
+	assert.Error(t, db.Exec("SELECT 1; SELECT * FROM missing"))
+}
@@ -0,0 +1,185 @@
+package sharealyzer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// classifiedTypes are the types a Classifier decides between
+var classifiedTypes = []TripType{CUSTOMER_TRIP, CHARGING_TRIP, RELOCATION_TRIP, BATTERY_SWAP_TRIP}
+
+// TripLabels maps trip identifiers to the type a human decided the trip really has
+type TripLabels map[string]TripType
+
+// ReadTripLabels reads labels from CSV with the trip identifier in the first and the type in the second
+// column. A header row starting with "id" or "trip_id" is skipped.
+func ReadTripLabels(r io.Reader) (TripLabels, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	labels := make(TripLabels)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return labels, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line == 1 && (record[0] == "id" || record[0] == "trip_id") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("Line %d has no type", line)
+		}
+		tripType := TripType(strings.ToUpper(strings.TrimSpace(record[1])))
+		if !isClassified(tripType) {
+			return nil, fmt.Errorf("Line %d has unknown type %s, expected one of %v", line, record[1], classifiedTypes)
+		}
+		labels[strings.TrimSpace(record[0])] = tripType
+	}
+}
+
+func isClassified(tripType TripType) bool {
+	for _, classified := range classifiedTypes {
+		if tripType == classified {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassMetrics measures how well a Classifier detects a single type
+type ClassMetrics struct {
+	Type           TripType
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+}
+
+// Precision returns the share of trips classified as the type which really have it, 0 if none was
+func (m ClassMetrics) Precision() float64 {
+	if m.TruePositives+m.FalsePositives == 0 {
+		return 0
+	}
+	return float64(m.TruePositives) / float64(m.TruePositives+m.FalsePositives)
+}
+
+// Recall returns the share of trips of the type which were classified as it, 0 if there were none
+func (m ClassMetrics) Recall() float64 {
+	if m.TruePositives+m.FalseNegatives == 0 {
+		return 0
+	}
+	return float64(m.TruePositives) / float64(m.TruePositives+m.FalseNegatives)
+}
+
+// F1 returns the harmonic mean of precision and recall
+func (m ClassMetrics) F1() float64 {
+	precision, recall := m.Precision(), m.Recall()
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+// Evaluation compares the types a Classifier assigned to labeled trips with their labels
+type Evaluation struct {
+	// Labeled is the number of labeled trips which were found and classified
+	Labeled int
+	// Correct is the number of trips classified as labeled
+	Correct int
+	// Unclassified are labeled trips which didn't finish, so the classifier never saw them
+	Unclassified []string
+	// Confusion counts the trips by their label and the type they were classified as
+	Confusion map[TripType]map[TripType]int
+	// Metrics of every type ordered like the types of a Classifier
+	Metrics []ClassMetrics
+}
+
+// Accuracy returns the share of correctly classified trips
+func (e *Evaluation) Accuracy() float64 {
+	if e.Labeled == 0 {
+		return 0
+	}
+	return float64(e.Correct) / float64(e.Labeled)
+}
+
+// Evaluator classifies labeled trips with a Classifier and compares the result with the labels. Trips are
+// added one by one, so a whole trip store doesn't need to be kept in memory.
+type Evaluator struct {
+	Classifier Classifier
+	Labels     TripLabels
+
+	eval  *Evaluation
+	found map[string]bool
+}
+
+// NewEvaluator creates an Evaluator of the classifier against the labels
+func NewEvaluator(classifier Classifier, labels TripLabels) *Evaluator {
+	return &Evaluator{
+		Classifier: classifier,
+		Labels:     labels,
+		eval:       &Evaluation{Confusion: make(map[TripType]map[TripType]int)},
+		found:      make(map[string]bool),
+	}
+}
+
+// Add classifies the trip if it is labeled. The trip is not modified.
+func (e *Evaluator) Add(trip *Trip) {
+	label, labeled := e.Labels[trip.ID]
+	if !labeled || e.found[trip.ID] {
+		return
+	}
+	e.found[trip.ID] = true
+	if trip.Type == OPEN_TRIP || trip.Type == LOST_TRIP {
+		e.eval.Unclassified = append(e.eval.Unclassified, trip.ID)
+		return
+	}
+	classified := *trip
+	e.Classifier.Classify(&classified)
+	e.eval.Labeled++
+	if classified.Type == label {
+		e.eval.Correct++
+	}
+	if e.eval.Confusion[label] == nil {
+		e.eval.Confusion[label] = make(map[TripType]int)
+	}
+	e.eval.Confusion[label][classified.Type]++
+}
+
+// Missing returns the identifiers of labeled trips which were never added, sorted
+func (e *Evaluator) Missing() []string {
+	var missing []string
+	for id := range e.Labels {
+		if !e.found[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Evaluation returns the evaluation of all trips added so far
+func (e *Evaluator) Evaluation() *Evaluation {
+	eval := *e.eval
+	eval.Metrics = make([]ClassMetrics, 0, len(classifiedTypes))
+	for _, tripType := range classifiedTypes {
+		m := ClassMetrics{Type: tripType}
+		for label, classified := range eval.Confusion {
+			for classifiedType, count := range classified {
+				switch {
+				case label == tripType && classifiedType == tripType:
+					m.TruePositives += count
+				case label == tripType:
+					m.FalseNegatives += count
+				case classifiedType == tripType:
+					m.FalsePositives += count
+				}
+			}
+		}
+		eval.Metrics = append(eval.Metrics, m)
+	}
+	return &eval
+}
@@ -0,0 +1,66 @@
+package sharealyzer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTripLabels(t *testing.T) {
+	labels, err := ReadTripLabels(strings.NewReader("trip_id,type\na, customer_trip\nb,RELOCATION_TRIP,van seen\n"))
+	require.NoError(t, err)
+	assert.Equal(t, TripLabels{"a": CUSTOMER_TRIP, "b": RELOCATION_TRIP}, labels)
+
+	_, err = ReadTripLabels(strings.NewReader("a,SCOOTER_STOLEN\n"))
+	assert.Error(t, err)
+	_, err = ReadTripLabels(strings.NewReader("a\n"))
+	assert.Error(t, err)
+}
+
+func TestEvaluator(t *testing.T) {
+	trips := []*Trip{
+		// Relocated but lost more charge than expected, misclassified as customer trip
+		{ID: "relocated", Type: CUSTOMER_TRIP, StartChargeLevel: 80, EndChargeLevel: 78, Distance: 3},
+		{ID: "ridden", Type: CUSTOMER_TRIP, StartChargeLevel: 80, EndChargeLevel: 70, Distance: 2},
+		{ID: "swapped", Type: BATTERY_SWAP_TRIP, StartChargeLevel: 10, EndChargeLevel: 100, Distance: 0.01, Duration: 10 * time.Minute},
+		{ID: "open", Type: OPEN_TRIP},
+		{ID: "unlabeled", Type: CUSTOMER_TRIP},
+	}
+	labels := TripLabels{"relocated": RELOCATION_TRIP, "ridden": CUSTOMER_TRIP, "swapped": BATTERY_SWAP_TRIP,
+		"open": CUSTOMER_TRIP, "deleted": CUSTOMER_TRIP}
+
+	evaluate := func(classifier Classifier) *Evaluation {
+		evaluator := NewEvaluator(classifier, labels)
+		for _, trip := range trips {
+			evaluator.Add(trip)
+		}
+		assert.Equal(t, []string{"deleted"}, evaluator.Missing())
+		return evaluator.Evaluation()
+	}
+
+	eval := evaluate(DefaultClassifier())
+	assert.Equal(t, 3, eval.Labeled)
+	assert.Equal(t, 2, eval.Correct)
+	assert.InDelta(t, 2.0/3, eval.Accuracy(), 0.0001)
+	assert.Equal(t, []string{"open"}, eval.Unclassified)
+	assert.Equal(t, 1, eval.Confusion[RELOCATION_TRIP][CUSTOMER_TRIP])
+	metrics := make(map[TripType]ClassMetrics)
+	for _, m := range eval.Metrics {
+		metrics[m.Type] = m
+	}
+	assert.Equal(t, 0.5, metrics[CUSTOMER_TRIP].Precision())
+	assert.Equal(t, 1.0, metrics[CUSTOMER_TRIP].Recall())
+	assert.Equal(t, 0.0, metrics[RELOCATION_TRIP].Recall())
+	assert.Equal(t, 1.0, metrics[BATTERY_SWAP_TRIP].F1())
+	// Evaluating doesn't change the trips
+	assert.Equal(t, CUSTOMER_TRIP, trips[0].Type)
+
+	// Tolerating a higher charge loss during relocations fixes the misclassification
+	classifier := DefaultClassifier()
+	classifier.RelocationMaxChargeLoss = 3
+	eval = evaluate(classifier)
+	assert.Equal(t, 3, eval.Correct)
+}
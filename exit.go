@@ -0,0 +1,57 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes used by all sharealyzer commands, so scripts and cron jobs can react to the kind of failure
+const (
+	// ExitSuccess means everything went fine
+	ExitSuccess = 0
+	// ExitFailure is used for all errors which don't fit any of the more specific codes
+	ExitFailure = 1
+	// ExitConfigError means invalid flags, config files or environment variables
+	ExitConfigError = 2
+	// ExitAuthError means authentication against a provider failed
+	ExitAuthError = 3
+	// ExitPartialData means the command finished but had to skip some files or records
+	ExitPartialData = 4
+	// ExitNoData means there was nothing to process at all, i.e. because the archive is empty
+	ExitNoData = 5
+)
+
+// Exitf logs the message and exits the process with the given exit code
+func Exitf(code int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(code)
+}
+
+// ExitError is an error which ends a command with a specific exit code. Commands return it up to main, so
+// deferred cleanup runs before the process exits.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
+}
+
+// ExitErrorf returns an ExitError with the formatted message
+func ExitErrorf(code int, format string, v ...interface{}) error {
+	return &ExitError{Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+// ExitOnError logs err and exits the process with its exit code, ExitFailure if it isn't an ExitError. It
+// returns if err is nil.
+func ExitOnError(err error) {
+	if err == nil {
+		return
+	}
+	if exitErr, ok := err.(*ExitError); ok {
+		Exitf(exitErr.Code, "%s", exitErr.Message)
+	}
+	Exitf(ExitFailure, "%s", err)
+}
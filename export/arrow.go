@@ -0,0 +1,338 @@
+package export
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// DefaultArrowBatchSize is the maximum number of rows per Arrow record batch
+const DefaultArrowBatchSize = 64 * 1024
+
+// Constants of the Arrow IPC format, see https://arrow.apache.org/docs/format/Columnar.html
+const (
+	arrowMagic            = "ARROW1"
+	arrowMetadataV5 int16 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt             = 2
+	arrowTypeFloatingPoint   = 3
+	arrowTypeUtf8            = 5
+	arrowTypeTimestamp       = 10
+	arrowTypeDuration        = 18
+	arrowPrecisionDouble     = 2
+	arrowTimeUnitMillisecond = 1
+)
+
+// arrowColumn collects the values of one column of a record batch
+type arrowColumn struct {
+	name     string
+	typeType uint8
+	typ      fbTable
+	nullable bool
+
+	length  int
+	nulls   int
+	valid   []bool
+	offsets []byte
+	values  []byte
+}
+
+func stringColumn(name string) *arrowColumn {
+	return &arrowColumn{name: name, typeType: arrowTypeUtf8, typ: fbTable{}, offsets: make([]byte, 4)}
+}
+
+func float64Column(name string, nullable bool) *arrowColumn {
+	return &arrowColumn{name: name, typeType: arrowTypeFloatingPoint, typ: fbTable{fbInt16(arrowPrecisionDouble)}, nullable: nullable}
+}
+
+func int64Column(name string) *arrowColumn {
+	return &arrowColumn{name: name, typeType: arrowTypeInt, typ: fbTable{fbInt32(64), fbBool(true)}}
+}
+
+func timestampColumn(name string) *arrowColumn {
+	return &arrowColumn{name: name, typeType: arrowTypeTimestamp, typ: fbTable{fbInt16(arrowTimeUnitMillisecond), fbString("UTC")}}
+}
+
+func durationColumn(name string) *arrowColumn {
+	return &arrowColumn{name: name, typeType: arrowTypeDuration, typ: fbTable{fbInt16(arrowTimeUnitMillisecond)}}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func (c *arrowColumn) field() fbTable {
+	return fbTable{fbString(c.name), fbBool(c.nullable), fbUint8(c.typeType), c.typ, nil, fbTables{}}
+}
+
+func (c *arrowColumn) appendValue(value []byte) {
+	c.length++
+	c.valid = append(c.valid, true)
+	c.values = append(c.values, value...)
+	if c.typeType == arrowTypeUtf8 {
+		c.offsets = appendUint32(c.offsets, uint32(len(c.values)))
+	}
+}
+
+func (c *arrowColumn) appendString(s string) {
+	c.appendValue([]byte(s))
+}
+
+func (c *arrowColumn) appendInt64(v int64) {
+	c.appendValue(appendUint64(nil, uint64(v)))
+}
+
+func (c *arrowColumn) appendFloat64(f float64) {
+	c.appendValue(appendUint64(nil, math.Float64bits(f)))
+}
+
+func (c *arrowColumn) appendTime(t time.Time) {
+	c.appendInt64(t.UnixNano() / int64(time.Millisecond))
+}
+
+func (c *arrowColumn) appendNull() {
+	c.appendValue(make([]byte, 8))
+	c.valid[len(c.valid)-1] = false
+	c.nulls++
+}
+
+// reset removes all values after they were written
+func (c *arrowColumn) reset() {
+	c.length, c.nulls, c.valid, c.values = 0, 0, nil, nil
+	if c.typeType == arrowTypeUtf8 {
+		c.offsets = make([]byte, 4)
+	}
+}
+
+// flush writes the values of the columns as record batch if there are any and resets the columns
+func (a *arrowWriter) flush(columns []*arrowColumn) error {
+	if columns[0].length == 0 {
+		return nil
+	}
+	if err := a.writeBatch(columns); err != nil {
+		return err
+	}
+	for _, c := range columns {
+		c.reset()
+	}
+	return nil
+}
+
+// buffers returns the validity bitmap followed by the data buffers of the column. The bitmap is left
+// empty if there are no nulls.
+func (c *arrowColumn) buffers() [][]byte {
+	var validity []byte
+	if c.nulls > 0 {
+		validity = make([]byte, (c.length+7)/8)
+		for i, valid := range c.valid {
+			if valid {
+				validity[i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+	if c.typeType == arrowTypeUtf8 {
+		return [][]byte{validity, c.offsets, c.values}
+	}
+	return [][]byte{validity, c.values}
+}
+
+// arrowWriter writes the Arrow IPC file format, also known as Feather V2
+type arrowWriter struct {
+	w      io.Writer
+	pos    int64
+	schema fbTable
+	blocks []byte
+}
+
+func newArrowWriter(w io.Writer, columns []*arrowColumn) (*arrowWriter, error) {
+	fields := make(fbTables, 0, len(columns))
+	for _, c := range columns {
+		fields = append(fields, c.field())
+	}
+	a := &arrowWriter{w: w, schema: fbTable{fbInt16(0), fields}}
+	if err := a.write([]byte(arrowMagic + "\x00\x00")); err != nil {
+		return nil, err
+	}
+	_, err := a.writeMessage(arrowHeaderSchema, a.schema, nil)
+	return a, err
+}
+
+func (a *arrowWriter) write(p []byte) error {
+	n, err := a.w.Write(p)
+	a.pos += int64(n)
+	return err
+}
+
+// writeMessage writes an encapsulated message and returns the length of its metadata including the prefix
+func (a *arrowWriter) writeMessage(headerType uint8, header fbTable, body []byte) (int, error) {
+	meta := encodeFlatbuffer(fbTable{fbInt16(arrowMetadataV5), fbUint8(headerType), header, fbInt64(int64(len(body)))})
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint32(prefix, 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, p := range [][]byte{prefix, meta, body} {
+		if err := a.write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(prefix) + len(meta), nil
+}
+
+// writeBatch writes the collected values of the columns as record batch
+func (a *arrowWriter) writeBatch(columns []*arrowColumn) error {
+	var nodes, buffers, body []byte
+	for _, c := range columns {
+		nodes = appendUint64(nodes, uint64(c.length))
+		nodes = appendUint64(nodes, uint64(c.nulls))
+		for _, buf := range c.buffers() {
+			buffers = appendUint64(buffers, uint64(len(body)))
+			buffers = appendUint64(buffers, uint64(len(buf)))
+			body = append(body, buf...)
+			for len(body)%8 != 0 {
+				body = append(body, 0)
+			}
+		}
+	}
+	header := fbTable{fbInt64(int64(columns[0].length)), fbStructs{size: 16, data: nodes}, fbStructs{size: 16, data: buffers}}
+
+	offset := a.pos
+	metaLength, err := a.writeMessage(arrowHeaderRecordBatch, header, body)
+	if err != nil {
+		return err
+	}
+	a.blocks = appendUint64(a.blocks, uint64(offset))
+	a.blocks = appendUint64(a.blocks, uint64(metaLength))
+	a.blocks = appendUint64(a.blocks, uint64(len(body)))
+	return nil
+}
+
+// close writes the end of stream marker and the footer
+func (a *arrowWriter) close() error {
+	if err := a.write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	footer := encodeFlatbuffer(fbTable{fbInt16(arrowMetadataV5), a.schema, fbStructs{size: 24}, fbStructs{size: 24, data: a.blocks}})
+	footer = appendUint32(footer, uint32(len(footer)))
+	return a.write(append(footer, arrowMagic...))
+}
+
+func observationColumns() []*arrowColumn {
+	return []*arrowColumn{
+		timestampColumn("timestamp"),
+		stringColumn("provider"),
+		stringColumn("scooter_id"),
+		float64Column("lat", true),
+		float64Column("lon", true),
+		float64Column("charge", false),
+		stringColumn("state"),
+	}
+}
+
+// WriteObservationsArrow writes the observations of all results as Arrow IPC file with the columns of
+// ObservationHeader and returns the number of written rows. The file can be read as Feather file by
+// pandas, R and DuckDB.
+func WriteObservationsArrow(w io.Writer, results <-chan sharealyzer.ScrapeResult) (int, error) {
+	columns := observationColumns()
+	out, err := newArrowWriter(w, columns)
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	for res := range results {
+		for _, o := range Observations(res) {
+			columns[0].appendTime(o.Timestamp)
+			columns[1].appendString(o.Provider)
+			columns[2].appendString(o.ScooterID)
+			if o.Lat != nil {
+				columns[3].appendFloat64(*o.Lat)
+				columns[4].appendFloat64(*o.Lon)
+			} else {
+				columns[3].appendNull()
+				columns[4].appendNull()
+			}
+			columns[5].appendFloat64(o.Charge)
+			columns[6].appendString(string(o.State))
+			rows++
+			if columns[0].length == DefaultArrowBatchSize {
+				if err := out.flush(columns); err != nil {
+					return rows, err
+				}
+			}
+		}
+	}
+	if err := out.flush(columns); err != nil {
+		return rows, err
+	}
+	return rows, out.close()
+}
+
+// WriteTripsArrow writes the trips as Arrow IPC file
+func WriteTripsArrow(w io.Writer, trips []*sharealyzer.Trip) error {
+	columns := []*arrowColumn{
+		stringColumn("id"),
+		stringColumn("provider"),
+		stringColumn("scooter_id"),
+		stringColumn("type"),
+		timestampColumn("start_time"),
+		timestampColumn("end_time"),
+		durationColumn("duration"),
+		float64Column("start_lat", true),
+		float64Column("start_lon", true),
+		float64Column("end_lat", true),
+		float64Column("end_lon", true),
+		float64Column("start_charge", false),
+		float64Column("end_charge", false),
+		float64Column("distance", false),
+		int64Column("cost"),
+	}
+	out, err := newArrowWriter(w, columns)
+	if err != nil {
+		return err
+	}
+	appendLocation := func(lat, lon *arrowColumn, loc *sharealyzer.GeoLocation) {
+		if loc == nil {
+			lat.appendNull()
+			lon.appendNull()
+			return
+		}
+		lat.appendFloat64(loc.Latitude)
+		lon.appendFloat64(loc.Longitude)
+	}
+	for _, t := range trips {
+		columns[0].appendString(t.ID)
+		columns[1].appendString(t.ScooterProvider)
+		columns[2].appendString(t.ScooterID)
+		columns[3].appendString(string(t.Type))
+		columns[4].appendTime(t.StartTime)
+		columns[5].appendTime(t.EndTime)
+		columns[6].appendInt64(int64(t.Duration / time.Millisecond))
+		appendLocation(columns[7], columns[8], t.StartLocation)
+		appendLocation(columns[9], columns[10], t.EndLocation)
+		columns[11].appendFloat64(t.StartChargeLevel)
+		columns[12].appendFloat64(t.EndChargeLevel)
+		columns[13].appendFloat64(t.Distance)
+		columns[14].appendInt64(int64(t.Cost))
+		if columns[0].length == DefaultArrowBatchSize {
+			if err := out.flush(columns); err != nil {
+				return err
+			}
+		}
+	}
+	if err := out.flush(columns); err != nil {
+		return err
+	}
+	return out.close()
+}
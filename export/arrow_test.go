@@ -0,0 +1,114 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fbRef reads a table of a flatbuffer
+type fbRef struct {
+	buf []byte
+	pos int
+}
+
+func u32(buf []byte, pos int) int { return int(binary.LittleEndian.Uint32(buf[pos:])) }
+func u16(buf []byte, pos int) int { return int(binary.LittleEndian.Uint16(buf[pos:])) }
+
+func fbRoot(buf []byte) fbRef {
+	return fbRef{buf: buf, pos: u32(buf, 0)}
+}
+
+func (t fbRef) field(id int) int {
+	vtable := t.pos - int(int32(u32(t.buf, t.pos)))
+	if 4+2*id >= u16(t.buf, vtable) {
+		return 0
+	}
+	if off := u16(t.buf, vtable+4+2*id); off != 0 {
+		return t.pos + off
+	}
+	return 0
+}
+
+func (t fbRef) table(id int) fbRef {
+	pos := t.field(id)
+	return fbRef{buf: t.buf, pos: pos + u32(t.buf, pos)}
+}
+
+// vector returns the position of the first element and the number of elements
+func (t fbRef) vector(id int) (int, int) {
+	pos := t.field(id)
+	vec := pos + u32(t.buf, pos)
+	return vec + 4, u32(t.buf, vec)
+}
+
+func (t fbRef) str(id int) string {
+	start, n := t.vector(id)
+	return string(t.buf[start : start+n])
+}
+
+func TestWriteObservationsArrow(t *testing.T) {
+	var buf bytes.Buffer
+	rows, err := WriteObservationsArrow(&buf, observationResults())
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	file := buf.Bytes()
+	require.Equal(t, "ARROW1\x00\x00", string(file[:8]))
+	require.Equal(t, "ARROW1", string(file[len(file)-6:]))
+	footerLength := u32(file, len(file)-10)
+	footer := fbRoot(file[len(file)-10-footerLength : len(file)-10])
+
+	fields, n := footer.table(1).vector(1)
+	require.Equal(t, len(ObservationHeader), n)
+	for i, name := range ObservationHeader {
+		field := fbRef{buf: footer.buf, pos: fields + 4*i + u32(footer.buf, fields+4*i)}
+		assert.Equal(t, name, field.str(0))
+	}
+
+	blocks, n := footer.vector(3)
+	require.Equal(t, 1, n)
+	offset := int(binary.LittleEndian.Uint64(footer.buf[blocks:]))
+	metaLength := int(binary.LittleEndian.Uint64(footer.buf[blocks+8:]))
+	assert.Equal(t, 0, offset%8)
+	assert.Equal(t, uint32(0xFFFFFFFF), binary.LittleEndian.Uint32(file[offset:]))
+
+	message := fbRoot(file[offset+8 : offset+metaLength])
+	assert.Equal(t, byte(arrowHeaderRecordBatch), message.buf[message.field(1)])
+	batch := message.table(2)
+	assert.Equal(t, uint64(2), binary.LittleEndian.Uint64(batch.buf[batch.field(0):]))
+
+	// lat is the fourth column, after the timestamp with two and the strings with three buffers each
+	buffers, _ := batch.vector(2)
+	body := file[offset+metaLength:]
+	bufferAt := func(i int) []byte {
+		start := int(binary.LittleEndian.Uint64(batch.buf[buffers+16*i:]))
+		length := int(binary.LittleEndian.Uint64(batch.buf[buffers+16*i+8:]))
+		return body[start : start+length]
+	}
+	validity, values := bufferAt(8), bufferAt(9)
+	assert.Equal(t, []byte{1}, validity)
+	assert.Equal(t, 51.96, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+	assert.Equal(t, "scooter-1scooter-2", string(bufferAt(7)))
+}
+
+func TestWriteTripsArrow(t *testing.T) {
+	start := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	trips := []*sharealyzer.Trip{{ID: "trip-1", StartTime: start, EndTime: start.Add(time.Minute)}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTripsArrow(&buf, trips))
+	file := buf.Bytes()
+	footerLength := u32(file, len(file)-10)
+	footer := fbRoot(file[len(file)-10-footerLength : len(file)-10])
+	_, fields := footer.table(1).vector(1)
+	assert.Equal(t, 15, fields)
+	_, blocks := footer.vector(3)
+	assert.Equal(t, 1, blocks)
+}
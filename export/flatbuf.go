@@ -0,0 +1,151 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A minimal flatbuffers encoder for the Arrow IPC metadata. Unlike the official builder it lays out the
+// buffer front to back, every object is written before the objects it references, so all offsets point
+// forward as the format requires. Vtables are placed right in front of their tables and not shared.
+
+// fbTable is a table whose fields are indexed by their id, absent fields are nil
+type fbTable []interface{}
+
+// fbString is a string field
+type fbString string
+
+// fbTables is a vector of tables
+type fbTables []fbTable
+
+// fbStructs is a vector of structs of the given size, the elements are already encoded and 8 byte aligned
+type fbStructs struct {
+	size int
+	data []byte
+}
+
+// fbScalar is an inline scalar field of the given size in bytes
+type fbScalar struct {
+	size int
+	bits uint64
+}
+
+func fbBool(b bool) fbScalar {
+	if b {
+		return fbScalar{size: 1, bits: 1}
+	}
+	return fbScalar{size: 1}
+}
+
+func fbUint8(v uint8) fbScalar { return fbScalar{size: 1, bits: uint64(v)} }
+func fbInt16(v int16) fbScalar { return fbScalar{size: 2, bits: uint64(v)} }
+func fbInt32(v int32) fbScalar { return fbScalar{size: 4, bits: uint64(v)} }
+func fbInt64(v int64) fbScalar { return fbScalar{size: 8, bits: uint64(v)} }
+
+type fbEncoder struct {
+	buf []byte
+}
+
+// encodeFlatbuffer encodes root into a flatbuffer padded to a multiple of 8 bytes
+func encodeFlatbuffer(root fbTable) []byte {
+	e := &fbEncoder{}
+	e.reserve(4)
+	e.patch(0, e.table(root))
+	e.pad(8)
+	return e.buf
+}
+
+func (e *fbEncoder) pad(align int) {
+	for len(e.buf)%align != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *fbEncoder) reserve(n int) int {
+	pos := len(e.buf)
+	e.buf = append(e.buf, make([]byte, n)...)
+	return pos
+}
+
+// patch writes the offset from at to target into the uoffset at
+func (e *fbEncoder) patch(at, target int) {
+	binary.LittleEndian.PutUint32(e.buf[at:], uint32(target-at))
+}
+
+func (e *fbEncoder) table(t fbTable) int {
+	e.pad(2)
+	vtable := e.reserve(4 + 2*len(t))
+	e.pad(8)
+	start := e.reserve(4)
+	binary.LittleEndian.PutUint32(e.buf[start:], uint32(int32(start-vtable)))
+
+	type reference struct {
+		pos   int
+		value interface{}
+	}
+	var refs []reference
+	for id, field := range t {
+		if field == nil {
+			continue
+		}
+		size := 4
+		scalar, isScalar := field.(fbScalar)
+		if isScalar {
+			size = scalar.size
+		}
+		e.pad(size)
+		pos := e.reserve(size)
+		binary.LittleEndian.PutUint16(e.buf[vtable+4+2*id:], uint16(pos-start))
+		if !isScalar {
+			refs = append(refs, reference{pos: pos, value: field})
+			continue
+		}
+		switch size {
+		case 1:
+			e.buf[pos] = byte(scalar.bits)
+		case 2:
+			binary.LittleEndian.PutUint16(e.buf[pos:], uint16(scalar.bits))
+		case 4:
+			binary.LittleEndian.PutUint32(e.buf[pos:], uint32(scalar.bits))
+		case 8:
+			binary.LittleEndian.PutUint64(e.buf[pos:], scalar.bits)
+		}
+	}
+	binary.LittleEndian.PutUint16(e.buf[vtable:], uint16(4+2*len(t)))
+	binary.LittleEndian.PutUint16(e.buf[vtable+2:], uint16(len(e.buf)-start))
+
+	for _, ref := range refs {
+		e.patch(ref.pos, e.object(ref.value))
+	}
+	return start
+}
+
+func (e *fbEncoder) object(value interface{}) int {
+	switch v := value.(type) {
+	case fbTable:
+		return e.table(v)
+	case fbString:
+		e.pad(4)
+		pos := e.reserve(4 + len(v) + 1)
+		binary.LittleEndian.PutUint32(e.buf[pos:], uint32(len(v)))
+		copy(e.buf[pos+4:], v)
+		return pos
+	case fbTables:
+		e.pad(4)
+		pos := e.reserve(4 + 4*len(v))
+		binary.LittleEndian.PutUint32(e.buf[pos:], uint32(len(v)))
+		for i, t := range v {
+			e.patch(pos+4+4*i, e.table(t))
+		}
+		return pos
+	case fbStructs:
+		for (len(e.buf)+4)%8 != 0 {
+			e.buf = append(e.buf, 0)
+		}
+		pos := e.reserve(4 + len(v.data))
+		binary.LittleEndian.PutUint32(e.buf[pos:], uint32(len(v.data)/v.size))
+		copy(e.buf[pos+4:], v.data)
+		return pos
+	}
+	panic(fmt.Sprintf("unsupported flatbuffer value %T", value))
+}
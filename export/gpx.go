@@ -0,0 +1,122 @@
+// Package export writes trips and scooter observations in formats understood by GIS and analysis tools
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// TracePoint is an observed position of a scooter
+type TracePoint struct {
+	Time        time.Time
+	Location    *sharealyzer.GeoLocation
+	ChargeLevel float64
+}
+
+// ScooterTrace collects the positions of one scooter from the scrape results. Consecutive observations at
+// the same position are collapsed, so the trace only contains the points where the scooter moved.
+func ScooterTrace(results <-chan sharealyzer.ScrapeResult, scooterID string) []TracePoint {
+	var trace []TracePoint
+	for res := range results {
+		for _, scooter := range res.Scooters() {
+			if scooter.ID != scooterID || scooter.Location == nil {
+				continue
+			}
+			if len(trace) > 0 && *trace[len(trace)-1].Location == *scooter.Location {
+				continue
+			}
+			trace = append(trace, TracePoint{
+				Time:        res.ScrapeDate(),
+				Location:    scooter.Location,
+				ChargeLevel: scooter.ChargeLevel,
+			})
+		}
+	}
+	return trace
+}
+
+// GPX is a GPX 1.1 document
+type GPX struct {
+	XMLName xml.Name   `xml:"gpx"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	Tracks  []GPXTrack `xml:"trk"`
+}
+
+// GPXTrack is a track within a GPX document
+type GPXTrack struct {
+	Name     string            `xml:"name"`
+	Desc     string            `xml:"desc,omitempty"`
+	Segments []GPXTrackSegment `xml:"trkseg"`
+}
+
+// GPXTrackSegment is a continuous part of a track
+type GPXTrackSegment struct {
+	Points []GPXPoint `xml:"trkpt"`
+}
+
+// GPXPoint is a point of a track segment
+type GPXPoint struct {
+	Lat  float64   `xml:"lat,attr"`
+	Lon  float64   `xml:"lon,attr"`
+	Time time.Time `xml:"time"`
+	Desc string    `xml:"desc,omitempty"`
+}
+
+func newGPX(tracks []GPXTrack) *GPX {
+	return &GPX{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "sharealyzer",
+		Tracks:  tracks,
+	}
+}
+
+// TripsGPX creates a GPX document with a track from start to end location for every trip
+func TripsGPX(trips []*sharealyzer.Trip) *GPX {
+	tracks := make([]GPXTrack, 0, len(trips))
+	for _, t := range trips {
+		tracks = append(tracks, GPXTrack{
+			Name: "Trip " + t.ID,
+			Desc: fmt.Sprintf("%s trip of scooter %s, %.2f km in %.1f minutes", t.Type, t.ScooterID, t.Distance, t.Duration.Minutes()),
+			Segments: []GPXTrackSegment{{Points: []GPXPoint{
+				{Lat: t.StartLocation.Latitude, Lon: t.StartLocation.Longitude, Time: t.StartTime.UTC()},
+				{Lat: t.EndLocation.Latitude, Lon: t.EndLocation.Longitude, Time: t.EndTime.UTC()},
+			}}},
+		})
+	}
+	return newGPX(tracks)
+}
+
+// TraceGPX creates a GPX document with a single track following the trace
+func TraceGPX(name string, trace []TracePoint) *GPX {
+	points := make([]GPXPoint, 0, len(trace))
+	for _, p := range trace {
+		points = append(points, GPXPoint{
+			Lat:  p.Location.Latitude,
+			Lon:  p.Location.Longitude,
+			Time: p.Time.UTC(),
+			Desc: fmt.Sprintf("%.0f%% charge", p.ChargeLevel),
+		})
+	}
+	return newGPX([]GPXTrack{{Name: name, Segments: []GPXTrackSegment{{Points: points}}}})
+}
+
+// Write writes the GPX document
+func (g *GPX) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(g); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
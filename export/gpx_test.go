@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripsGPX(t *testing.T) {
+	start := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	trip := &sharealyzer.Trip{
+		ID:            "trip-1",
+		ScooterID:     "scooter-1",
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		StartTime:     start,
+		EndTime:       start.Add(10 * time.Minute),
+		Type:          sharealyzer.CUSTOMER_TRIP,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, TripsGPX([]*sharealyzer.Trip{trip}).Write(&buf))
+
+	var parsed GPX
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+	require.Len(t, parsed.Tracks, 1)
+	assert.Equal(t, "Trip trip-1", parsed.Tracks[0].Name)
+	points := parsed.Tracks[0].Segments[0].Points
+	require.Len(t, points, 2)
+	assert.Equal(t, 51.96, points[0].Lat)
+	assert.Equal(t, 7.63, points[1].Lon)
+	assert.True(t, start.Add(10*time.Minute).Equal(points[1].Time))
+}
+
+func TestScooterTrace(t *testing.T) {
+	start := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	results := make(chan sharealyzer.ScrapeResult, 3)
+	for i, loc := range []*sharealyzer.GeoLocation{
+		sharealyzer.NewGeoLocation(51.96, 7.62),
+		sharealyzer.NewGeoLocation(51.96, 7.62),
+		sharealyzer.NewGeoLocation(51.97, 7.63),
+	} {
+		results <- sharealyzer.NewScrapeResult("circ", start.Add(time.Duration(i)*time.Minute), []*sharealyzer.Scooter{
+			{ID: "scooter-1", Location: loc},
+			{ID: "scooter-2", Location: sharealyzer.NewGeoLocation(50, 7)},
+		})
+	}
+	close(results)
+
+	trace := ScooterTrace(results, "scooter-1")
+	require.Len(t, trace, 2)
+	assert.Equal(t, start, trace[0].Time)
+	assert.Equal(t, start.Add(2*time.Minute), trace[1].Time)
+}
@@ -0,0 +1,74 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// icsEscape escapes text values as required by RFC 5545
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsFold folds a content line into lines of at most 75 octets without splitting UTF-8 characters
+func icsFold(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+	return folded.String()
+}
+
+// WriteTripsICS writes the trips as iCalendar with one event per trip, which lets riders audit their
+// detected trips in any calendar application. created is used as timestamp of the events.
+func WriteTripsICS(w io.Writer, calendarName string, trips []*sharealyzer.Trip, created time.Time) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//sharealyzer//trips//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + icsEscape(calendarName),
+	}
+	for _, t := range trips {
+		description := fmt.Sprintf("%s trip of scooter %s\n%.2f km in %.0f minutes\nCost: %.2f EUR",
+			t.Type, t.ScooterID, t.Distance, t.Duration.Minutes(), float64(t.Cost)/100)
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+icsEscape(t.ID)+"@sharealyzer",
+			"DTSTAMP:"+created.UTC().Format(icsTimeFormat),
+			"DTSTART:"+t.StartTime.UTC().Format(icsTimeFormat),
+			"DTEND:"+t.EndTime.UTC().Format(icsTimeFormat),
+			"SUMMARY:"+icsEscape(fmt.Sprintf("Scooter trip (%.1f km)", t.Distance)),
+		)
+		if t.StartLocation != nil && t.EndLocation != nil {
+			description += fmt.Sprintf("\nFrom %f,%f to %f,%f", t.StartLocation.Latitude, t.StartLocation.Longitude,
+				t.EndLocation.Latitude, t.EndLocation.Longitude)
+			lines = append(lines,
+				fmt.Sprintf("GEO:%f;%f", t.StartLocation.Latitude, t.StartLocation.Longitude),
+				"LOCATION:"+icsEscape(fmt.Sprintf("%f,%f", t.StartLocation.Latitude, t.StartLocation.Longitude)),
+			)
+		}
+		lines = append(lines, "DESCRIPTION:"+icsEscape(description), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icsFold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTripsICS(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	trip := &sharealyzer.Trip{
+		ID:            "trip-1",
+		ScooterID:     "scooter-1",
+		Type:          sharealyzer.CUSTOMER_TRIP,
+		StartTime:     start,
+		EndTime:       start.Add(12 * time.Minute),
+		Duration:      12 * time.Minute,
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		Cost:          215,
+		Distance:      2.4,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTripsICS(&buf, "My trips", []*sharealyzer.Trip{trip}, start.Add(time.Hour)))
+	ics := buf.String()
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "\r\nDTSTART:20191006T080000Z\r\n")
+	assert.Contains(t, ics, "\r\nDTEND:20191006T081200Z\r\n")
+	assert.Contains(t, ics, "\r\nGEO:51.960000;7.620000\r\n")
+	assert.Contains(t, ics, "\r\nLOCATION:51.960000\\,7.620000\r\n")
+
+	// Unfold the lines to check the description
+	unfolded := strings.Replace(ics, "\r\n ", "", -1)
+	assert.Contains(t, unfolded, `DESCRIPTION:CUSTOMER_TRIP trip of scooter scooter-1\n2.40 km in 12 minutes\nCost: 2.15 EUR`)
+	for _, line := range strings.Split(ics, "\r\n") {
+		assert.True(t, len(line) <= 75, line)
+	}
+}
@@ -0,0 +1,201 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// KeplerField describes a column of a kepler.gl dataset
+type KeplerField struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Format string `json:"format"`
+}
+
+// KeplerDataset is a table loaded into kepler.gl. The same table can be written as CSV.
+type KeplerDataset struct {
+	ID     string          `json:"id"`
+	Label  string          `json:"label"`
+	Fields []KeplerField   `json:"fields"`
+	Rows   [][]interface{} `json:"allData"`
+}
+
+// TripsDataset creates a dataset with the origin and destination of every trip
+func TripsDataset(trips []*sharealyzer.Trip) *KeplerDataset {
+	d := &KeplerDataset{
+		ID:    "trips",
+		Label: "Trips",
+		Rows:  [][]interface{}{},
+		Fields: []KeplerField{
+			{Name: "id", Type: "string"},
+			{Name: "type", Type: "string"},
+			{Name: "start_time", Type: "timestamp", Format: "YYYY-M-DTHH:mm:ssZ"},
+			{Name: "start_lat", Type: "real"},
+			{Name: "start_lon", Type: "real"},
+			{Name: "end_lat", Type: "real"},
+			{Name: "end_lon", Type: "real"},
+			{Name: "duration_minutes", Type: "real"},
+			{Name: "distance_km", Type: "real"},
+		},
+	}
+	for _, t := range trips {
+		if t.StartLocation == nil || t.EndLocation == nil {
+			continue
+		}
+		d.Rows = append(d.Rows, []interface{}{
+			t.ID,
+			string(t.Type),
+			t.StartTime.UTC().Format(time.RFC3339),
+			t.StartLocation.Latitude,
+			t.StartLocation.Longitude,
+			t.EndLocation.Latitude,
+			t.EndLocation.Longitude,
+			t.Duration.Minutes(),
+			t.Distance,
+		})
+	}
+	return d
+}
+
+// DensityDataset creates a dataset with a row per cell and hour of the density
+func DensityDataset(id, label string, density *Density) *KeplerDataset {
+	d := &KeplerDataset{
+		ID:    id,
+		Label: label,
+		Rows:  [][]interface{}{},
+		Fields: []KeplerField{
+			{Name: "lat", Type: "real"},
+			{Name: "lon", Type: "real"},
+			{Name: "hour", Type: "integer"},
+			{Name: "value", Type: "real"},
+		},
+	}
+	for _, cell := range density.Cells() {
+		d.Rows = append(d.Rows, []interface{}{cell.Location.Latitude, cell.Location.Longitude, cell.Hour, cell.Value})
+	}
+	return d
+}
+
+// WriteCSV writes the dataset as CSV with a header row
+func (d *KeplerDataset) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := make([]string, 0, len(d.Fields))
+	for _, f := range d.Fields {
+		header = append(header, f.Name)
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, row := range d.Rows {
+		record := make([]string, 0, len(row))
+		for _, value := range row {
+			switch v := value.(type) {
+			case float64:
+				record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				record = append(record, fmt.Sprint(v))
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// center returns the mean of the given latitude and longitude columns
+func (d *KeplerDataset) center(lat, lon int) (float64, float64, bool) {
+	if len(d.Rows) == 0 {
+		return 0, 0, false
+	}
+	var sumLat, sumLon float64
+	for _, row := range d.Rows {
+		sumLat += row[lat].(float64)
+		sumLon += row[lon].(float64)
+	}
+	return sumLat / float64(len(d.Rows)), sumLon / float64(len(d.Rows)), true
+}
+
+type keplerLayer struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Config map[string]interface{} `json:"config"`
+}
+
+type keplerDatasetEntry struct {
+	Version string         `json:"version"`
+	Data    *KeplerDataset `json:"data"`
+}
+
+// KeplerMap is a kepler.gl map file with embedded datasets, which can be dropped into kepler.gl as is
+type KeplerMap struct {
+	Datasets []keplerDatasetEntry   `json:"datasets"`
+	Config   map[string]interface{} `json:"config"`
+	Info     map[string]string      `json:"info"`
+}
+
+// NewKeplerMap creates a map showing the trips as arcs and the density as hexagon layer aggregating the
+// value column. The map starts centered on the trip origins.
+func NewKeplerMap(trips, density *KeplerDataset) *KeplerMap {
+	layers := []keplerLayer{
+		{
+			ID:   "trip_arcs",
+			Type: "arc",
+			Config: map[string]interface{}{
+				"dataId":    trips.ID,
+				"label":     trips.Label,
+				"isVisible": true,
+				"columns":   map[string]string{"lat0": "start_lat", "lng0": "start_lon", "lat1": "end_lat", "lng1": "end_lon"},
+				"visConfig": map[string]interface{}{"opacity": 0.6, "thickness": 2},
+			},
+		},
+		{
+			ID:   "density_hexagons",
+			Type: "hexagon",
+			Config: map[string]interface{}{
+				"dataId":    density.ID,
+				"label":     density.Label,
+				"isVisible": true,
+				"columns":   map[string]string{"lat": "lat", "lng": "lon"},
+				"visConfig": map[string]interface{}{"opacity": 0.7, "worldUnitSize": 0.2, "coverage": 0.9, "colorAggregation": "sum"},
+			},
+		},
+	}
+	visualChannels := map[string]map[string]interface{}{
+		"density_hexagons": {"colorField": map[string]string{"name": "value", "type": "real"}, "colorScale": "quantile"},
+	}
+	for i := range layers {
+		layers[i].Config["visualChannels"] = visualChannels[layers[i].ID]
+	}
+
+	mapState := map[string]interface{}{"zoom": 12}
+	if lat, lon, ok := trips.center(3, 4); ok {
+		mapState["latitude"], mapState["longitude"] = lat, lon
+	} else if lat, lon, ok := density.center(0, 1); ok {
+		mapState["latitude"], mapState["longitude"] = lat, lon
+	}
+
+	return &KeplerMap{
+		Datasets: []keplerDatasetEntry{{Version: "v1", Data: trips}, {Version: "v1", Data: density}},
+		Config: map[string]interface{}{
+			"version": "v1",
+			"config": map[string]interface{}{
+				"visState": map[string]interface{}{"layers": layers},
+				"mapState": mapState,
+			},
+		},
+		Info: map[string]string{"app": "kepler.gl", "source": "sharealyzer"},
+	}
+}
+
+// Write writes the map as JSON
+func (k *KeplerMap) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(k)
+}
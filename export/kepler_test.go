@@ -0,0 +1,68 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeplerMap(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	trips := TripsDataset([]*sharealyzer.Trip{{
+		ID:            "trip-1",
+		Type:          sharealyzer.CUSTOMER_TRIP,
+		StartTime:     start,
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		Duration:      90 * time.Second,
+		Distance:      1.5,
+	}})
+	density := NewDensity(14, time.UTC)
+	density.Add(sharealyzer.NewGeoLocation(51.96, 7.62), start)
+	densityDataset := DensityDataset("scooter_density", "Available scooters", density)
+
+	var csv bytes.Buffer
+	require.NoError(t, trips.WriteCSV(&csv))
+	assert.Equal(t, "id,type,start_time,start_lat,start_lon,end_lat,end_lon,duration_minutes,distance_km\n"+
+		"trip-1,CUSTOMER_TRIP,2019-10-06T08:00:00Z,51.96,7.62,51.97,7.63,1.5,1.5\n", csv.String())
+
+	require.Len(t, densityDataset.Rows, 1)
+	assert.InDelta(t, 51.96, densityDataset.Rows[0][0], 0.01)
+	assert.InDelta(t, 7.62, densityDataset.Rows[0][1], 0.01)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewKeplerMap(trips, densityDataset).Write(&buf))
+	var parsed struct {
+		Datasets []struct {
+			Data struct {
+				ID      string          `json:"id"`
+				AllData [][]interface{} `json:"allData"`
+			} `json:"data"`
+		} `json:"datasets"`
+		Config struct {
+			Config struct {
+				VisState struct {
+					Layers []struct {
+						Type   string `json:"type"`
+						Config struct {
+							DataID string `json:"dataId"`
+						} `json:"config"`
+					} `json:"layers"`
+				} `json:"visState"`
+				MapState map[string]float64 `json:"mapState"`
+			} `json:"config"`
+		} `json:"config"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &parsed))
+	require.Len(t, parsed.Datasets, 2)
+	assert.Equal(t, "trips", parsed.Datasets[0].Data.ID)
+	require.Len(t, parsed.Config.Config.VisState.Layers, 2)
+	assert.Equal(t, "arc", parsed.Config.Config.VisState.Layers[0].Type)
+	assert.Equal(t, "scooter_density", parsed.Config.Config.VisState.Layers[1].Config.DataID)
+	assert.Equal(t, 51.96, parsed.Config.Config.MapState["latitude"])
+}
@@ -0,0 +1,183 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// KML is a KML 2.2 document as understood by Google Earth
+type KML struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document KMLDocument `xml:"Document"`
+}
+
+// KMLDocument contains the styles and placemarks of a KML file
+type KMLDocument struct {
+	Name       string         `xml:"name"`
+	Styles     []KMLStyle     `xml:"Style"`
+	Placemarks []KMLPlacemark `xml:"Placemark"`
+}
+
+// KMLStyle is a shared style referenced by placemarks
+type KMLStyle struct {
+	ID        string        `xml:"id,attr"`
+	IconStyle *KMLIconStyle `xml:"IconStyle,omitempty"`
+	LineStyle *KMLLineStyle `xml:"LineStyle,omitempty"`
+}
+
+// KMLIconStyle styles the icon of a point placemark. Colors are in KML's aabbggrr notation.
+type KMLIconStyle struct {
+	Color string `xml:"color"`
+	Icon  string `xml:"Icon>href"`
+}
+
+// KMLLineStyle styles a line placemark
+type KMLLineStyle struct {
+	Color string  `xml:"color"`
+	Width float64 `xml:"width"`
+}
+
+// KMLPlacemark is either a point or a line
+type KMLPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	TimeStamp   string         `xml:"TimeStamp>when,omitempty"`
+	StyleURL    string         `xml:"styleUrl,omitempty"`
+	Point       *KMLGeometry   `xml:"Point,omitempty"`
+	LineString  *KMLLineString `xml:"LineString,omitempty"`
+}
+
+// KMLGeometry holds the coordinates of a point
+type KMLGeometry struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// KMLLineString holds the coordinates of a line
+type KMLLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+const scooterIcon = "http://maps.google.com/mapfiles/kml/shapes/motorcycling.png"
+
+var (
+	scooterStyles = []KMLStyle{
+		{ID: stateStyle(sharealyzer.IdleRentable), IconStyle: &KMLIconStyle{Color: "ff00c000", Icon: scooterIcon}},
+		{ID: stateStyle(sharealyzer.InUse), IconStyle: &KMLIconStyle{Color: "ffff8000", Icon: scooterIcon}},
+		{ID: stateStyle(sharealyzer.Broken), IconStyle: &KMLIconStyle{Color: "ff0000ff", Icon: scooterIcon}},
+		{ID: stateStyle(sharealyzer.Missing), IconStyle: &KMLIconStyle{Color: "ff808080", Icon: scooterIcon}},
+	}
+	tripStyles = []KMLStyle{
+		{ID: tripStyle(sharealyzer.CUSTOMER_TRIP), LineStyle: &KMLLineStyle{Color: "ffff8000", Width: 2}},
+		{ID: tripStyle(sharealyzer.CHARGING_TRIP), LineStyle: &KMLLineStyle{Color: "ff00c0ff", Width: 2}},
+		{ID: tripStyle(sharealyzer.RELOCATION_TRIP), LineStyle: &KMLLineStyle{Color: "ffc000c0", Width: 2}},
+		{ID: tripStyle(sharealyzer.BATTERY_SWAP_TRIP), LineStyle: &KMLLineStyle{Color: "ff00ffff", Width: 2}},
+	}
+)
+
+func stateStyle(state sharealyzer.ScooterState) string {
+	return "state-" + strings.ToLower(string(state))
+}
+
+func tripStyle(tripType sharealyzer.TripType) string {
+	return "trip-" + strings.ToLower(string(tripType))
+}
+
+// coordinates formats locations as KML coordinate tuples, which are longitude first
+func coordinates(locs ...*sharealyzer.GeoLocation) string {
+	tuples := make([]string, 0, len(locs))
+	for _, loc := range locs {
+		tuples = append(tuples, fmt.Sprintf("%f,%f", loc.Longitude, loc.Latitude))
+	}
+	return strings.Join(tuples, " ")
+}
+
+func newKML(name string, styles []KMLStyle, placemarks []KMLPlacemark) *KML {
+	return &KML{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: KMLDocument{
+			Name:       name,
+			Styles:     styles,
+			Placemarks: placemarks,
+		},
+	}
+}
+
+// ScootersKML creates a KML document with a placemark for every scooter of the scrape, styled by its state
+func ScootersKML(res sharealyzer.ScrapeResult) *KML {
+	var placemarks []KMLPlacemark
+	for _, scooter := range res.Scooters() {
+		if scooter.Location == nil {
+			continue
+		}
+		placemarks = append(placemarks, KMLPlacemark{
+			Name:        scooter.ID,
+			Description: fmt.Sprintf("%s, %.0f%% charge", scooter.State, scooter.ChargeLevel),
+			TimeStamp:   res.ScrapeDate().UTC().Format(time.RFC3339),
+			StyleURL:    "#" + stateStyle(scooter.State),
+			Point:       &KMLGeometry{Coordinates: coordinates(scooter.Location)},
+		})
+	}
+	name := fmt.Sprintf("%s scooters at %s", res.Provider(), res.ScrapeDate().UTC().Format(time.RFC3339))
+	return newKML(name, scooterStyles, placemarks)
+}
+
+// TripsKML creates a KML document with a line from origin to destination for every trip, styled by its type
+func TripsKML(trips []*sharealyzer.Trip) *KML {
+	placemarks := make([]KMLPlacemark, 0, len(trips))
+	for _, t := range trips {
+		placemarks = append(placemarks, KMLPlacemark{
+			Name:        "Trip " + t.ID,
+			Description: fmt.Sprintf("%s trip of scooter %s, %.2f km in %.1f minutes", t.Type, t.ScooterID, t.Distance, t.Duration.Minutes()),
+			TimeStamp:   t.StartTime.UTC().Format(time.RFC3339),
+			StyleURL:    "#" + tripStyle(t.Type),
+			LineString:  &KMLLineString{Tessellate: 1, Coordinates: coordinates(t.StartLocation, t.EndLocation)},
+		})
+	}
+	return newKML("Trips", tripStyles, placemarks)
+}
+
+// Write writes the KML document
+func (k *KML) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(k); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteKMZ writes the KML document packaged as KMZ, a zip archive with the document as doc.kml
+func (k *KML) WriteKMZ(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	doc, err := archive.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	if err := k.Write(doc); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// ScrapeAt returns the last scrape taken at or before t, or nil if there is none
+func ScrapeAt(results <-chan sharealyzer.ScrapeResult, t time.Time) sharealyzer.ScrapeResult {
+	var found sharealyzer.ScrapeResult
+	for res := range results {
+		if !res.ScrapeDate().After(t) && (found == nil || res.ScrapeDate().After(found.ScrapeDate())) {
+			found = res
+		}
+	}
+	return found
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScootersKMZ(t *testing.T) {
+	date := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	res := sharealyzer.NewScrapeResult("circ", date, []*sharealyzer.Scooter{
+		{ID: "scooter-1", State: sharealyzer.IdleRentable, Location: sharealyzer.NewGeoLocation(51.96, 7.62)},
+		{ID: "scooter-2", State: sharealyzer.Broken},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, ScootersKML(res).WriteKMZ(&buf))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 1)
+	assert.Equal(t, "doc.kml", archive.File[0].Name)
+	f, err := archive.File[0].Open()
+	require.NoError(t, err)
+	defer f.Close()
+
+	var parsed KML
+	require.NoError(t, xml.NewDecoder(f).Decode(&parsed))
+	require.Len(t, parsed.Document.Placemarks, 1)
+	placemark := parsed.Document.Placemarks[0]
+	assert.Equal(t, "scooter-1", placemark.Name)
+	assert.Equal(t, "#state-idle_rentable", placemark.StyleURL)
+	assert.Equal(t, "7.620000,51.960000", placemark.Point.Coordinates)
+	assert.Equal(t, "2019-10-06T12:00:00Z", placemark.TimeStamp)
+}
+
+func TestTripsKML(t *testing.T) {
+	trip := &sharealyzer.Trip{
+		ID:            "trip-1",
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		Type:          sharealyzer.CHARGING_TRIP,
+	}
+	doc := TripsKML([]*sharealyzer.Trip{trip})
+	require.Len(t, doc.Document.Placemarks, 1)
+	assert.Equal(t, "#trip-charging_trip", doc.Document.Placemarks[0].StyleURL)
+	assert.Equal(t, "7.620000,51.960000 7.630000,51.970000", doc.Document.Placemarks[0].LineString.Coordinates)
+}
+
+func TestScrapeAt(t *testing.T) {
+	start := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	results := make(chan sharealyzer.ScrapeResult, 3)
+	for i := 0; i < 3; i++ {
+		results <- sharealyzer.NewScrapeResult("circ", start.Add(time.Duration(i)*time.Minute), nil)
+	}
+	close(results)
+
+	res := ScrapeAt(results, start.Add(90*time.Second))
+	require.NotNil(t, res)
+	assert.Equal(t, start.Add(time.Minute), res.ScrapeDate())
+}
@@ -0,0 +1,293 @@
+package export
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const (
+	// MVTExtent is the size of a tile in tile coordinates
+	MVTExtent = 4096
+	// densityCellBits determines the grid size, every tile is divided into 2^densityCellBits cells per side
+	densityCellBits = 6
+	densityCellSize = MVTExtent >> densityCellBits
+)
+
+// Density sums up points per hour of day on a grid which is fine enough for tiles up to MaxZoom
+type Density struct {
+	MaxZoom int
+	// Location is the time zone of the hours of day
+	Location *time.Location
+
+	cells   map[densityCell]float64
+	samples [24]int
+}
+
+type densityCell struct {
+	x, y uint32
+	hour int
+}
+
+// NewDensity creates an empty density grid for tiles up to maxZoom with hours of day in loc
+func NewDensity(maxZoom int, loc *time.Location) *Density {
+	return &Density{
+		MaxZoom:  maxZoom,
+		Location: loc,
+		cells:    make(map[densityCell]float64),
+	}
+}
+
+// Add adds a point seen at t
+func (d *Density) Add(loc *sharealyzer.GeoLocation, t time.Time) {
+	x, y := mercator(loc, d.MaxZoom+densityCellBits)
+	d.cells[densityCell{x: uint32(x), y: uint32(y), hour: t.In(d.Location).Hour()}]++
+}
+
+// AddSample counts a snapshot taken at t. If snapshots are counted, the value of a cell is the average
+// number of points per snapshot of that hour instead of the sum of all points.
+func (d *Density) AddSample(t time.Time) {
+	d.samples[t.In(d.Location).Hour()]++
+}
+
+// DensityCell is the aggregated value of a grid cell in one hour of day
+type DensityCell struct {
+	Location *sharealyzer.GeoLocation
+	Hour     int
+	Value    float64
+}
+
+// Cells returns all cells with a value, located at the cell centers
+func (d *Density) Cells() []DensityCell {
+	cells := make([]DensityCell, 0, len(d.cells))
+	for cell, sum := range d.cells {
+		if d.samples[cell.hour] > 0 {
+			sum /= float64(d.samples[cell.hour])
+		}
+		cells = append(cells, DensityCell{
+			Location: inverseMercator(float64(cell.x)+0.5, float64(cell.y)+0.5, d.MaxZoom+densityCellBits),
+			Hour:     cell.hour,
+			Value:    sum,
+		})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		if a.Hour != b.Hour {
+			return a.Hour < b.Hour
+		}
+		if a.Location.Latitude != b.Location.Latitude {
+			return a.Location.Latitude > b.Location.Latitude
+		}
+		return a.Location.Longitude < b.Location.Longitude
+	})
+	return cells
+}
+
+// inverseMercator is the inverse of mercator
+func inverseMercator(x, y float64, zoom int) *sharealyzer.GeoLocation {
+	n := math.Exp2(float64(zoom))
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+	return sharealyzer.NewGeoLocation(lat, x/n*360-180)
+}
+
+// mercator returns the position of loc in web mercator pixels at the given zoom level with a tile size of 1
+func mercator(loc *sharealyzer.GeoLocation, zoom int) (float64, float64) {
+	n := math.Exp2(float64(zoom))
+	lat := loc.Latitude * math.Pi / 180
+	x := (loc.Longitude + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * n
+	return math.Max(0, math.Min(n-1, x)), math.Max(0, math.Min(n-1, y))
+}
+
+// TileID identifies a tile in the XYZ scheme
+type TileID struct {
+	Z, X, Y int
+}
+
+type densityFeature struct {
+	x, y  int
+	hour  int
+	value float64
+}
+
+// features aggregates the grid into point features at the cell centers of every tile at zoom
+func (d *Density) features(zoom int) map[TileID][]densityFeature {
+	shift := uint(d.MaxZoom - zoom)
+	sums := make(map[TileID]map[densityCell]float64)
+	for cell, count := range d.cells {
+		x, y := cell.x>>shift, cell.y>>shift
+		tile := TileID{Z: zoom, X: int(x >> densityCellBits), Y: int(y >> densityCellBits)}
+		if sums[tile] == nil {
+			sums[tile] = make(map[densityCell]float64)
+		}
+		inTile := densityCell{x: x & (1<<densityCellBits - 1), y: y & (1<<densityCellBits - 1), hour: cell.hour}
+		sums[tile][inTile] += count
+	}
+
+	tiles := make(map[TileID][]densityFeature, len(sums))
+	for tile, cells := range sums {
+		features := make([]densityFeature, 0, len(cells))
+		for cell, sum := range cells {
+			if d.samples[cell.hour] > 0 {
+				sum /= float64(d.samples[cell.hour])
+			}
+			features = append(features, densityFeature{
+				x:     int(cell.x)*densityCellSize + densityCellSize/2,
+				y:     int(cell.y)*densityCellSize + densityCellSize/2,
+				hour:  cell.hour,
+				value: sum,
+			})
+		}
+		sort.Slice(features, func(i, j int) bool {
+			a, b := features[i], features[j]
+			if a.hour != b.hour {
+				return a.hour < b.hour
+			}
+			if a.y != b.y {
+				return a.y < b.y
+			}
+			return a.x < b.x
+		})
+		tiles[tile] = features
+	}
+	return tiles
+}
+
+// mvtBuffer encodes protobuf fields of the vector tile schema
+type mvtBuffer []byte
+
+func (b *mvtBuffer) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	*b = append(*b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (b *mvtBuffer) varintField(num int, v uint64) {
+	b.varint(uint64(num) << 3)
+	b.varint(v)
+}
+
+func (b *mvtBuffer) bytesField(num int, data []byte) {
+	b.varint(uint64(num)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *mvtBuffer) packedField(num int, values ...uint32) {
+	var packed mvtBuffer
+	for _, v := range values {
+		packed.varint(uint64(v))
+	}
+	b.bytesField(num, packed)
+}
+
+func zigzag(v int) uint32 {
+	return uint32((int32(v) << 1) ^ (int32(v) >> 31))
+}
+
+// encodeDensityLayer encodes the features as version 2 vector tile layer with the properties hour and value
+func encodeDensityLayer(name string, features []densityFeature) []byte {
+	var layer mvtBuffer
+	layer.varintField(15, 2)
+	layer.bytesField(1, []byte(name))
+
+	values := make(map[string]uint32)
+	var encodedValues []mvtBuffer
+	valueIndex := func(key string, encode func(*mvtBuffer)) uint32 {
+		if i, exists := values[key]; exists {
+			return i
+		}
+		var value mvtBuffer
+		encode(&value)
+		values[key] = uint32(len(encodedValues))
+		encodedValues = append(encodedValues, value)
+		return values[key]
+	}
+
+	for i, f := range features {
+		hour := valueIndex(fmt.Sprintf("h%d", f.hour), func(v *mvtBuffer) { v.varintField(5, uint64(f.hour)) })
+		value := valueIndex(fmt.Sprintf("v%g", f.value), func(v *mvtBuffer) {
+			v.varint(3<<3 | 1)
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f.value))
+			*v = append(*v, buf[:]...)
+		})
+		var feature mvtBuffer
+		feature.varintField(1, uint64(i+1))
+		feature.packedField(2, 0, hour, 1, value)
+		feature.varintField(3, 1) // POINT
+		feature.packedField(4, 1|1<<3, zigzag(f.x), zigzag(f.y))
+		layer.bytesField(2, feature)
+	}
+	layer.bytesField(3, []byte("hour"))
+	layer.bytesField(3, []byte("value"))
+	for _, value := range encodedValues {
+		layer.bytesField(4, value)
+	}
+	layer.varintField(5, MVTExtent)
+	return layer
+}
+
+// DensityLayer is a named density rendered as layer of the vector tiles
+type DensityLayer struct {
+	Name    string
+	Density *Density
+}
+
+// WriteMVTTiles renders the density layers as Mapbox Vector Tiles into dir/z/x/y.mvt for all zoom levels
+// from minZoom up to the MaxZoom of the densities, which all need the same MaxZoom, and describes them in dir/tiles.json (TileJSON). Every
+// layer contains a point feature per grid cell and hour of day with the properties hour and value. It
+// returns the number of written tiles.
+func WriteMVTTiles(dir string, minZoom int, layers ...DensityLayer) (int, error) {
+	if len(layers) == 0 {
+		return 0, nil
+	}
+	maxZoom := layers[0].Density.MaxZoom
+	written := 0
+	for zoom := minZoom; zoom <= maxZoom; zoom++ {
+		tiles := make(map[TileID][]byte)
+		for _, layer := range layers {
+			for tile, features := range layer.Density.features(zoom) {
+				var encoded mvtBuffer = tiles[tile]
+				encoded.bytesField(3, encodeDensityLayer(layer.Name, features))
+				tiles[tile] = encoded
+			}
+		}
+		for tile, data := range tiles {
+			path := filepath.Join(dir, fmt.Sprint(tile.Z), fmt.Sprint(tile.X), fmt.Sprintf("%d.mvt", tile.Y))
+			if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+				return written, err
+			}
+			if err := ioutil.WriteFile(path, data, 0660); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+
+	vectorLayers := make([]map[string]interface{}, 0, len(layers))
+	for _, layer := range layers {
+		vectorLayers = append(vectorLayers, map[string]interface{}{
+			"id":     layer.Name,
+			"fields": map[string]string{"hour": "Number", "value": "Number"},
+		})
+	}
+	tileJSON, err := json.MarshalIndent(map[string]interface{}{
+		"tilejson":      "3.0.0",
+		"tiles":         []string{"{z}/{x}/{y}.mvt"},
+		"minzoom":       minZoom,
+		"maxzoom":       maxZoom,
+		"vector_layers": vectorLayers,
+	}, "", "  ")
+	if err != nil {
+		return written, err
+	}
+	return written, ioutil.WriteFile(filepath.Join(dir, "tiles.json"), tileJSON, 0660)
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDensityFeatures(t *testing.T) {
+	d := NewDensity(2, time.UTC)
+	morning := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	d.AddSample(morning)
+	d.AddSample(morning.Add(time.Minute))
+	for i := 0; i < 4; i++ {
+		d.Add(sharealyzer.NewGeoLocation(0.001, 0.001), morning)
+	}
+	d.Add(sharealyzer.NewGeoLocation(0.001, 0.001), morning.Add(time.Hour))
+
+	tiles := d.features(2)
+	require.Len(t, tiles, 1)
+	features := tiles[TileID{Z: 2, X: 2, Y: 1}]
+	require.Len(t, features, 2)
+	assert.Equal(t, densityFeature{x: densityCellSize / 2, y: MVTExtent - densityCellSize/2, hour: 8, value: 2}, features[0])
+	assert.Equal(t, 9, features[1].hour)
+	assert.Equal(t, float64(1), features[1].value)
+
+	// All cells of the world end up in the single tile at zoom 0
+	assert.Len(t, d.features(0)[TileID{}], 2)
+}
+
+func TestDensityHoursInLocation(t *testing.T) {
+	d := NewDensity(2, time.FixedZone("", 2*60*60))
+	utcMorning := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	d.AddSample(utcMorning)
+	d.Add(sharealyzer.NewGeoLocation(0.001, 0.001), utcMorning)
+
+	cells := d.Cells()
+	require.Len(t, cells, 1)
+	assert.Equal(t, 10, cells[0].Hour)
+	assert.Equal(t, float64(1), cells[0].Value)
+}
+
+func TestWriteMVTTiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	scooters := NewDensity(3, time.UTC)
+	scooters.Add(sharealyzer.NewGeoLocation(51.96, 7.62), time.Now())
+	trips := NewDensity(3, time.UTC)
+
+	written, err := WriteMVTTiles(dir, 1, DensityLayer{Name: "scooters", Density: scooters}, DensityLayer{Name: "trip_starts", Density: trips})
+	require.NoError(t, err)
+	assert.Equal(t, 3, written)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "3", "4", "2.mvt"))
+	require.NoError(t, err)
+	// The tile starts with the layers field and contains the layer name
+	assert.Equal(t, byte(3<<3|2), data[0])
+	assert.Contains(t, string(data), "scooters")
+	_, err = os.Stat(filepath.Join(dir, "tiles.json"))
+	assert.NoError(t, err)
+}
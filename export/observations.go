@@ -0,0 +1,96 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// ObservationHeader are the CSV columns written by WriteObservationsCSV
+var ObservationHeader = []string{"timestamp", "provider", "scooter_id", "lat", "lon", "charge", "state"}
+
+// Observation is a single scooter seen in a single scrape, one row of the tidy export
+type Observation struct {
+	Timestamp time.Time                `json:"timestamp"`
+	Provider  string                   `json:"provider"`
+	ScooterID string                   `json:"scooter_id"`
+	Lat       *float64                 `json:"lat"`
+	Lon       *float64                 `json:"lon"`
+	Charge    float64                  `json:"charge"`
+	State     sharealyzer.ScooterState `json:"state"`
+}
+
+// Observations flattens a scrape into one observation per scooter
+func Observations(res sharealyzer.ScrapeResult) []Observation {
+	observations := make([]Observation, 0, len(res.Scooters()))
+	for _, scooter := range res.Scooters() {
+		o := Observation{
+			Timestamp: res.ScrapeDate().UTC(),
+			Provider:  res.Provider(),
+			ScooterID: scooter.ID,
+			Charge:    scooter.ChargeLevel,
+			State:     scooter.State,
+		}
+		if scooter.Location != nil {
+			o.Lat, o.Lon = &scooter.Location.Latitude, &scooter.Location.Longitude
+		}
+		observations = append(observations, o)
+	}
+	return observations
+}
+
+// WriteObservationsCSV writes the observations of all results as CSV with ObservationHeader and returns the
+// number of written rows. Missing locations are written as empty cells, which R and pandas read as NA.
+func WriteObservationsCSV(w io.Writer, results <-chan sharealyzer.ScrapeResult) (int, error) {
+	out := csv.NewWriter(w)
+	if err := out.Write(ObservationHeader); err != nil {
+		return 0, err
+	}
+	rows := 0
+	for res := range results {
+		for _, o := range Observations(res) {
+			err := out.Write([]string{
+				o.Timestamp.Format(time.RFC3339),
+				o.Provider,
+				o.ScooterID,
+				formatOptional(o.Lat),
+				formatOptional(o.Lon),
+				strconv.FormatFloat(o.Charge, 'f', -1, 64),
+				string(o.State),
+			})
+			if err != nil {
+				return rows, err
+			}
+			rows++
+		}
+	}
+	out.Flush()
+	return rows, out.Error()
+}
+
+// WriteObservationsJSONL writes the observations of all results as one JSON object per line and returns
+// the number of written lines
+func WriteObservationsJSONL(w io.Writer, results <-chan sharealyzer.ScrapeResult) (int, error) {
+	encoder := json.NewEncoder(w)
+	rows := 0
+	for res := range results {
+		for _, o := range Observations(res) {
+			if err := encoder.Encode(o); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func formatOptional(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func observationResults() <-chan sharealyzer.ScrapeResult {
+	results := make(chan sharealyzer.ScrapeResult, 1)
+	results <- sharealyzer.NewScrapeResult("circ", time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC), []*sharealyzer.Scooter{
+		{ID: "scooter-1", State: sharealyzer.IdleRentable, ChargeLevel: 87.5, Location: sharealyzer.NewGeoLocation(51.96, 7.62)},
+		{ID: "scooter-2", State: sharealyzer.InUse, ChargeLevel: 40},
+	})
+	close(results)
+	return results
+}
+
+func TestWriteObservationsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	rows, err := WriteObservationsCSV(&buf, observationResults())
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, strings.Join([]string{
+		"timestamp,provider,scooter_id,lat,lon,charge,state",
+		"2019-10-06T12:00:00Z,circ,scooter-1,51.96,7.62,87.5,IDLE_RENTABLE",
+		"2019-10-06T12:00:00Z,circ,scooter-2,,,40,IN_USE",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestWriteObservationsJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	rows, err := WriteObservationsJSONL(&buf, observationResults())
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var o map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &o))
+	assert.Equal(t, "scooter-2", o["scooter_id"])
+	assert.Nil(t, o["lat"])
+	assert.Equal(t, "IN_USE", o["state"])
+}
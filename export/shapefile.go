@@ -0,0 +1,179 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// wgs84PRJ is the projection file content for WGS 84 coordinates
+const wgs84PRJ = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],` +
+	`PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// Field types of shapefile attributes
+const (
+	ShapeCharacter = 'C'
+	ShapeNumeric   = 'N'
+)
+
+// ShapeField is an attribute column of a shapefile. Names are limited to 10 characters.
+type ShapeField struct {
+	Name     string
+	Type     byte
+	Length   int
+	Decimals int
+}
+
+// ShapePoint is a point with its attribute values in the order of the fields. Values of numeric fields
+// need to be float64 or int.
+type ShapePoint struct {
+	Location *sharealyzer.GeoLocation
+	Values   []interface{}
+}
+
+// WritePointShapefile writes the points as ESRI Shapefile, consisting of basePath.shp, .shx, .dbf and .prj
+func WritePointShapefile(basePath string, fields []ShapeField, points []ShapePoint) error {
+	for _, f := range fields {
+		if len(f.Name) > 10 {
+			return fmt.Errorf("Shapefile field name %s is longer than 10 characters", f.Name)
+		}
+	}
+
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p.Location.Longitude), math.Max(maxX, p.Location.Longitude)
+		minY, maxY = math.Min(minY, p.Location.Latitude), math.Max(maxY, p.Location.Latitude)
+	}
+	if len(points) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+
+	// Every point record consists of an 8 byte header and 20 bytes content, lengths are in 16 bit words
+	const headerWords, recordWords, contentWords = 50, 14, 10
+	shp := shapeHeader(headerWords+recordWords*len(points), minX, minY, maxX, maxY)
+	shx := shapeHeader(headerWords+4*len(points), minX, minY, maxX, maxY)
+	for i, p := range points {
+		binary.Write(shp, binary.BigEndian, []int32{int32(i + 1), contentWords})
+		binary.Write(shp, binary.LittleEndian, int32(1))
+		binary.Write(shp, binary.LittleEndian, []float64{p.Location.Longitude, p.Location.Latitude})
+		binary.Write(shx, binary.BigEndian, []int32{int32(headerWords + recordWords*i), contentWords})
+	}
+
+	dbf, err := dbaseTable(fields, points)
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		".shp": shp.Bytes(),
+		".shx": shx.Bytes(),
+		".dbf": dbf,
+		".prj": []byte(wgs84PRJ),
+	}
+	for ext, data := range files {
+		if err := ioutil.WriteFile(basePath+ext, data, 0660); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shapeHeader writes the 100 byte header of a point .shp or .shx file with the file length in 16 bit words
+func shapeHeader(fileWords int, minX, minY, maxX, maxY float64) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, []int32{9994, 0, 0, 0, 0, 0, int32(fileWords)})
+	binary.Write(buf, binary.LittleEndian, []int32{1000, 1})
+	binary.Write(buf, binary.LittleEndian, []float64{minX, minY, maxX, maxY, 0, 0, 0, 0})
+	return buf
+}
+
+// dbaseTable encodes the attributes as dBase III table
+func dbaseTable(fields []ShapeField, points []ShapePoint) ([]byte, error) {
+	recordLength := 1
+	for _, f := range fields {
+		recordLength += f.Length
+	}
+	buf := &bytes.Buffer{}
+	now := time.Now()
+	buf.Write([]byte{0x03, byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())})
+	binary.Write(buf, binary.LittleEndian, uint32(len(points)))
+	binary.Write(buf, binary.LittleEndian, []uint16{uint16(32 + 32*len(fields) + 1), uint16(recordLength)})
+	buf.Write(make([]byte, 20))
+	for _, f := range fields {
+		descriptor := make([]byte, 32)
+		copy(descriptor, f.Name)
+		descriptor[11] = f.Type
+		descriptor[16] = byte(f.Length)
+		descriptor[17] = byte(f.Decimals)
+		buf.Write(descriptor)
+	}
+	buf.WriteByte(0x0D)
+
+	for _, p := range points {
+		if len(p.Values) != len(fields) {
+			return nil, fmt.Errorf("Expected %d attribute values but got %d", len(fields), len(p.Values))
+		}
+		buf.WriteByte(' ')
+		for i, f := range fields {
+			var value string
+			switch v := p.Values[i].(type) {
+			case float64:
+				value = strconv.FormatFloat(v, 'f', f.Decimals, 64)
+			case int:
+				value = strconv.Itoa(v)
+			default:
+				value = fmt.Sprint(v)
+			}
+			if len(value) > f.Length {
+				if f.Type == ShapeNumeric {
+					return nil, fmt.Errorf("Value %s does not fit into field %s", value, f.Name)
+				}
+				value = value[:f.Length]
+			}
+			if f.Type == ShapeNumeric {
+				value = strings.Repeat(" ", f.Length-len(value)) + value
+			} else {
+				value += strings.Repeat(" ", f.Length-len(value))
+			}
+			buf.WriteString(value)
+		}
+	}
+	buf.WriteByte(0x1A)
+	return buf.Bytes(), nil
+}
+
+// TripEndpointsShapefile writes a point for the start and the end of every trip to basePath.shp
+func TripEndpointsShapefile(basePath string, trips []*sharealyzer.Trip) error {
+	fields := []ShapeField{
+		{Name: "trip_id", Type: ShapeCharacter, Length: 80},
+		{Name: "endpoint", Type: ShapeCharacter, Length: 5},
+		{Name: "type", Type: ShapeCharacter, Length: 20},
+		{Name: "time", Type: ShapeCharacter, Length: 20},
+		{Name: "minutes", Type: ShapeNumeric, Length: 10, Decimals: 1},
+		{Name: "km", Type: ShapeNumeric, Length: 10, Decimals: 3},
+	}
+	var points []ShapePoint
+	for _, t := range trips {
+		if t.StartLocation == nil || t.EndLocation == nil {
+			continue
+		}
+		for _, endpoint := range []struct {
+			name string
+			loc  *sharealyzer.GeoLocation
+			time time.Time
+		}{{"start", t.StartLocation, t.StartTime}, {"end", t.EndLocation, t.EndTime}} {
+			points = append(points, ShapePoint{
+				Location: endpoint.loc,
+				Values: []interface{}{t.ID, endpoint.name, string(t.Type), endpoint.time.UTC().Format(time.RFC3339),
+					t.Duration.Minutes(), t.Distance},
+			})
+		}
+	}
+	return WritePointShapefile(basePath, fields, points)
+}
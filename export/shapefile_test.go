@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripEndpointsShapefile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shapefile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	basePath := filepath.Join(dir, "trips")
+	require.NoError(t, TripEndpointsShapefile(basePath, []*sharealyzer.Trip{{
+		ID:            "trip-1",
+		Type:          sharealyzer.CUSTOMER_TRIP,
+		StartTime:     start,
+		EndTime:       start.Add(10 * time.Minute),
+		Duration:      10 * time.Minute,
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		Distance:      1.25,
+	}}))
+
+	shp, err := ioutil.ReadFile(basePath + ".shp")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(9994), binary.BigEndian.Uint32(shp))
+	assert.Equal(t, len(shp), 2*int(binary.BigEndian.Uint32(shp[24:])))
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(shp[32:]))
+	assert.Equal(t, 7.62, math.Float64frombits(binary.LittleEndian.Uint64(shp[36:])))
+	assert.Equal(t, 51.97, math.Float64frombits(binary.LittleEndian.Uint64(shp[60:])))
+	// The second record is the end point
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(shp[128:]))
+	assert.Equal(t, 7.63, math.Float64frombits(binary.LittleEndian.Uint64(shp[140:])))
+
+	shx, err := ioutil.ReadFile(basePath + ".shx")
+	require.NoError(t, err)
+	assert.Len(t, shx, 116)
+	assert.Equal(t, uint32(64), binary.BigEndian.Uint32(shx[108:]))
+
+	dbf, err := ioutil.ReadFile(basePath + ".dbf")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(dbf[4:]))
+	headerLength := int(binary.LittleEndian.Uint16(dbf[8:]))
+	recordLength := int(binary.LittleEndian.Uint16(dbf[10:]))
+	assert.Equal(t, 32+32*6+1, headerLength)
+	assert.Equal(t, headerLength+2*recordLength+1, len(dbf))
+	record := string(dbf[headerLength : headerLength+recordLength])
+	assert.Equal(t, " trip-1", record[:7])
+	assert.Equal(t, "     1.250", record[recordLength-10:])
+
+	_, err = os.Stat(basePath + ".prj")
+	assert.NoError(t, err)
+}
+
+func TestShapefileFieldNameLength(t *testing.T) {
+	err := WritePointShapefile("unused", []ShapeField{{Name: "much_too_long", Type: ShapeCharacter, Length: 1}}, nil)
+	assert.Error(t, err)
+}
@@ -3,25 +3,78 @@ package sharealyzer
 import (
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
-)
 
-const folderTimeFormat = "2006-01-02"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+)
 
+// GZippedFileWriter archives scrape results as compressed files in day folders within BaseDir
 type GZippedFileWriter struct {
 	BaseDir string
+	// Format of the written files, defaults to archive.FormatJSON
+	Format archive.Format
 }
 
+// ScrapeFile is the result of a single scrape of a provider which can be archived
 type ScrapeFile interface {
 	ScrapeDate() time.Time
 	Content() []byte
 	Provider() string
 }
 
+// LocalScrapeFile is a ScrapeFile which knows the time zone of the host which scraped it. Its file is named
+// after the local scrape date, so the UTC offset is kept and day folders split at local midnight.
+type LocalScrapeFile interface {
+	ScrapeFile
+	LocalDate() time.Time
+}
+
+// localDate returns the scrape date of f in the time zone of the host which scraped it if f knows it
+func localDate(f ScrapeFile) time.Time {
+	if local, ok := f.(LocalScrapeFile); ok {
+		return local.LocalDate()
+	}
+	return f.ScrapeDate()
+}
+
+// RawScrapeFile is a LocalScrapeFile of already decoded scooter records, i.e. of an archive which is
+// rewritten by merging or anonymizing it
+type RawScrapeFile struct {
+	ProviderName string
+	// Date is the scrape date in the time zone of the host which scraped the records
+	Date    time.Time
+	Records []json.RawMessage
+}
+
+// ScrapeDate returns the scrape date in UTC
+func (r *RawScrapeFile) ScrapeDate() time.Time {
+	return r.Date.UTC()
+}
+
+// LocalDate returns the scrape date in the time zone of the host which scraped the records
+func (r *RawScrapeFile) LocalDate() time.Time {
+	return r.Date
+}
+
+// Provider returns the provider the records were scraped from
+func (r *RawScrapeFile) Provider() string {
+	return r.ProviderName
+}
+
+// Content returns the records as JSON array
+func (r *RawScrapeFile) Content() []byte {
+	data, _ := archive.Marshal(r.Records, archive.FormatJSON)
+	return data
+}
+
+// FileWriteError is reported if a scrape file couldn't be written
 type FileWriteError struct {
 	FilePath string
 	Err      error
@@ -31,6 +84,8 @@ func (f FileWriteError) Error() string {
 	return "Writing " + f.FilePath + " failed: " + f.Err.Error()
 }
 
+// Write archives all scrape files received from in until ctx is done. Failed writes are reported on the
+// returned channel, which is closed when writing stops.
 func (g *GZippedFileWriter) Write(ctx context.Context, in chan ScrapeFile) chan error {
 	errChan := make(chan error, 10)
 	go func() {
@@ -40,7 +95,7 @@ func (g *GZippedFileWriter) Write(ctx context.Context, in chan ScrapeFile) chan
 				close(errChan)
 				return
 			case scrapeFile := <-in:
-				if err := g.writeTo(scrapeFile); err != nil {
+				if err := g.WriteFile(scrapeFile); err != nil {
 					errChan <- err
 				}
 			}
@@ -49,38 +104,92 @@ func (g *GZippedFileWriter) Write(ctx context.Context, in chan ScrapeFile) chan
 	return errChan
 }
 
-func (g *GZippedFileWriter) writeTo(f ScrapeFile) error {
-	folderName := fmt.Sprintf("%s_%s", f.Provider(), f.ScrapeDate().Format(folderTimeFormat))
-	fileName := fmt.Sprintf("%s_%s.json.gz", f.Provider(), f.ScrapeDate().Format(time.RFC3339))
+// WriteFile archives a single scrape file. The file is written to a temporary file first which is then
+// renamed, so readers never see a partially written file. Its checksum is added to the index of the day
+// folder, unless the index is stale.
+func (g *GZippedFileWriter) WriteFile(f ScrapeFile) error {
+	date := localDate(f)
+	folderName := archive.FolderName(f.Provider(), date)
+	fileName := archive.FileName(f.Provider(), date)
 	outFolder := filepath.Join(g.BaseDir, folderName)
 
+	// Only maintain the index of a folder if it is complete, an index created by the writer for a
+	// folder with files from other tools would miss them
+	maintainIndex := true
 	if !fileDoesExist(outFolder) {
 		if err := os.MkdirAll(outFolder, 0770); err != nil {
 			return err
 		}
+	} else {
+		maintainIndex = archive.IndexFresh(outFolder)
 	}
 
-	outFile, err := os.Create(filepath.Join(outFolder, fileName))
+	data := f.Content()
+	if g.Format == archive.FormatJSONL {
+		var err error
+		if data, err = archive.Marshal(json.RawMessage(data), archive.FormatJSONL); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(outFolder, fileName)
+	size, checksum, err := writeGzipped(path, data)
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
-
-	gzipWriter, err := gzip.NewWriterLevel(outFile, gzip.BestCompression)
+	if !maintainIndex {
+		return nil
+	}
+	records, err := archive.Records(data)
 	if err != nil {
 		return err
 	}
-	defer gzipWriter.Close()
+	return archive.AppendIndex(outFolder, archive.IndexEntry{
+		File:     fileName,
+		Date:     f.ScrapeDate().Truncate(time.Second),
+		Scooters: len(records),
+		Size:     size,
+		SHA256:   checksum,
+	})
+}
 
-	data := f.Content()
+// writeGzipped compresses data to a temporary file which is renamed to path afterwards and returns the size
+// and the hex encoded SHA-256 checksum of the compressed file
+func writeGzipped(path string, data []byte) (int64, string, error) {
+	tmpPath := path + ".tmp"
+	outFile, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmpPath)
+	defer outFile.Close()
+
+	// The checksum of the compressed file is calculated while writing it
+	checksum := sha256.New()
+	gzipWriter, err := archive.NewGzipWriter(io.MultiWriter(outFile, checksum), gzip.BestCompression)
+	if err != nil {
+		return 0, "", err
+	}
 	n, err := gzipWriter.Write(data)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	if n != len(data) {
-		return errors.New("Written less data than expected")
+		return 0, "", errors.New("Written less data than expected")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return 0, "", err
+	}
+	info, err := outFile.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	if err := outFile.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, "", err
 	}
-	return nil
+	return info.Size(), hex.EncodeToString(checksum.Sum(nil)), nil
 }
 
 func fileDoesExist(path string) bool {
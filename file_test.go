@@ -0,0 +1,125 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGZippedFileWriterMaintainsIndex(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "writer")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	writer := &GZippedFileWriter{BaseDir: baseDir, Format: archive.FormatJSONL}
+	date := time.Date(2019, 10, 8, 5, 11, 27, 0, time.UTC)
+	scooters := []*Scooter{{ID: "a"}, {ID: "b"}}
+	require.NoError(t, writer.WriteFile(NewScrapeResult("circ", date, scooters)))
+	require.NoError(t, writer.WriteFile(NewScrapeResult("circ", date.Add(time.Minute), scooters[:1])))
+
+	dayFolder := filepath.Join(baseDir, archive.FolderName("circ", date))
+	require.True(t, archive.IndexFresh(dayFolder))
+	entries, err := archive.ReadIndex(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, archive.FileName("circ", date), entries[0].File)
+	assert.Equal(t, 2, entries[0].Scooters)
+	assert.Equal(t, 1, entries[1].Scooters)
+	checksum, err := archive.FileChecksum(filepath.Join(dayFolder, entries[0].File))
+	require.NoError(t, err)
+	assert.Equal(t, checksum, entries[0].SHA256)
+	report := &archive.VerifyReport{}
+	require.NoError(t, archive.VerifyDay(dayFolder, report))
+	assert.False(t, report.Failed())
+	assert.Equal(t, 2, report.Checked)
+	// Files are written to a temporary file first, which doesn't remain
+	infos, err := ioutil.ReadDir(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, infos, 3)
+
+	// A folder changed by someone else keeps its stale index
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(dayFolder, future, future))
+	require.NoError(t, writer.WriteFile(NewScrapeResult("circ", date.Add(2*time.Minute), scooters)))
+	assert.False(t, archive.IndexFresh(dayFolder))
+	entries, err = archive.ReadIndex(dayFolder)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// localScrapeResult is scraped on a host in another time zone
+type localScrapeResult struct {
+	ScrapeResult
+	offset int
+}
+
+func (l *localScrapeResult) LocalDate() time.Time {
+	return l.ScrapeDate().In(time.FixedZone("", l.offset))
+}
+
+func TestGZippedFileWriterKeepsZoneOffset(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "writer")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	writer := &GZippedFileWriter{BaseDir: baseDir}
+	// Just before local midnight, but already the next day in UTC
+	date := time.Date(2019, 10, 8, 23, 30, 0, 0, time.FixedZone("CEST", 7200)).UTC()
+	res := &localScrapeResult{ScrapeResult: NewScrapeResult("circ", date, []*Scooter{{ID: "a"}}), offset: 7200}
+	require.NoError(t, writer.WriteFile(res))
+
+	dayFolder := filepath.Join(baseDir, "circ_2019-10-08")
+	files, err := archive.ScrapeFiles(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "circ_2019-10-08T23:30:00+02:00.json.gz", filepath.Base(files[0]))
+	_, fileDate, err := archive.ParseFileName(files[0])
+	require.NoError(t, err)
+	assert.True(t, fileDate.Equal(date))
+	_, offset, err := archive.ParseScrapeDate(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(files[0]), "circ_"), archive.FileSuffix))
+	require.NoError(t, err)
+	assert.Equal(t, 7200, offset)
+	entries, err := archive.ReadIndex(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, entries[0].Date.Equal(date))
+}
+
+func TestGZippedFileWriterRawScrapeFile(t *testing.T) {
+	baseDir := t.TempDir()
+	writer := &GZippedFileWriter{BaseDir: baseDir, Format: archive.FormatJSONL}
+	_, date, err := archive.ParseLocalFileName("circ_2019-10-08T23:30:00+02:00.json.gz")
+	require.NoError(t, err)
+	records := []json.RawMessage{json.RawMessage(`{"identifier":"a","unknown":1}`), json.RawMessage(`{"identifier":"b"}`)}
+	require.NoError(t, writer.WriteFile(&RawScrapeFile{ProviderName: "circ", Date: date, Records: records}))
+
+	dayFolder := filepath.Join(baseDir, "circ_2019-10-08")
+	path := filepath.Join(dayFolder, "circ_2019-10-08T23:30:00+02:00.json.gz")
+	var decoded []json.RawMessage
+	format, err := archive.DecodeFile(path, func(record json.RawMessage) error {
+		decoded = append(decoded, record)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, archive.FormatJSONL, format)
+	assert.Equal(t, records, decoded)
+	entries, err := archive.ReadIndex(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 2, entries[0].Scooters)
+
+	// Snapshots without scooters are written as well
+	require.NoError(t, writer.WriteFile(&RawScrapeFile{ProviderName: "circ", Date: date.Add(time.Minute)}))
+	entries, err = archive.ReadIndex(dayFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Zero(t, entries[1].Scooters)
+}
@@ -0,0 +1,155 @@
+// Package gbfs republishes scraped scooters as a General Bikeshare Feed Specification (GBFS) feed, so tools
+// which already speak GBFS can consume sharealyzer data
+package gbfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// Version is the implemented GBFS version
+const Version = "2.0"
+
+// Source returns the most recent scrape
+type Source func() (sharealyzer.ScrapeResult, error)
+
+// SystemInformation describes the system in system_information.json
+type SystemInformation struct {
+	SystemID string `json:"system_id"`
+	Language string `json:"language"`
+	Name     string `json:"name"`
+	Operator string `json:"operator,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Timezone string `json:"timezone"`
+}
+
+// Bike is a vehicle in free_bike_status.json
+type Bike struct {
+	BikeID     string  `json:"bike_id"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	IsReserved bool    `json:"is_reserved"`
+	IsDisabled bool    `json:"is_disabled"`
+}
+
+// Feed describes a feed in gbfs.json
+type Feed struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type response struct {
+	LastUpdated int64       `json:"last_updated"`
+	TTL         int         `json:"ttl"`
+	Version     string      `json:"version"`
+	Data        interface{} `json:"data"`
+}
+
+// Server serves the GBFS feed of the scrapes returned by Source. Bike identifiers are replaced with
+// pseudonyms which change after every state update of the scooter, as GBFS requires rotating identifiers
+// to protect the privacy of riders.
+type Server struct {
+	System  SystemInformation
+	Source  Source
+	BaseURL string
+	TTL     time.Duration
+
+	pseudonymizer *sharealyzer.Pseudonymizer
+	lock          sync.Mutex
+	cached        sharealyzer.ScrapeResult
+	cachedAt      time.Time
+	mux           *http.ServeMux
+}
+
+// NewServer creates a GBFS server. BaseURL is the public URL the feed is served under and is used
+// to build the feed URLs in gbfs.json.
+func NewServer(system SystemInformation, source Source, baseURL string, salt []byte) *Server {
+	s := &Server{
+		System:        system,
+		Source:        source,
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		TTL:           time.Minute,
+		pseudonymizer: sharealyzer.NewPseudonymizer(salt),
+		mux:           http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/gbfs.json", s.handleDiscovery)
+	s.mux.HandleFunc("/system_information.json", s.handleSystemInformation)
+	s.mux.HandleFunc("/free_bike_status.json", s.handleFreeBikeStatus)
+	return s
+}
+
+// ServeHTTP serves the GBFS files
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// latest returns the latest scrape, which is cached for TTL
+func (s *Server) latest() (sharealyzer.ScrapeResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cached != nil && time.Since(s.cachedAt) < s.TTL {
+		return s.cached, nil
+	}
+	res, err := s.Source()
+	if err != nil {
+		return nil, err
+	}
+	s.cached, s.cachedAt = res, time.Now()
+	return res, nil
+}
+
+func (s *Server) write(w http.ResponseWriter, lastUpdated time.Time, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response{
+		LastUpdated: lastUpdated.Unix(),
+		TTL:         int(s.TTL / time.Second),
+		Version:     Version,
+		Data:        data,
+	})
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	var feeds []Feed
+	for _, name := range []string{"system_information", "free_bike_status"} {
+		feeds = append(feeds, Feed{Name: name, URL: s.BaseURL + "/" + name + ".json"})
+	}
+	s.write(w, time.Now(), map[string]interface{}{
+		s.System.Language: map[string][]Feed{"feeds": feeds},
+	})
+}
+
+func (s *Server) handleSystemInformation(w http.ResponseWriter, r *http.Request) {
+	s.write(w, time.Now(), s.System)
+}
+
+func (s *Server) handleFreeBikeStatus(w http.ResponseWriter, r *http.Request) {
+	res, err := s.latest()
+	if err != nil {
+		http.Error(w, "No scrape available", http.StatusServiceUnavailable)
+		return
+	}
+	s.write(w, res.ScrapeDate(), map[string][]Bike{"bikes": s.Bikes(res.Scooters())})
+}
+
+// Bikes converts scooters into GBFS bikes. Scooters in use are omitted since they are not free.
+func (s *Server) Bikes(scooters []*sharealyzer.Scooter) []Bike {
+	bikes := make([]Bike, 0, len(scooters))
+	for _, scooter := range scooters {
+		if scooter.State == sharealyzer.InUse || scooter.Location == nil {
+			continue
+		}
+		bikes = append(bikes, Bike{
+			BikeID:     s.pseudonymizer.Pseudonym(scooter.ID + ":" + strconv.FormatInt(scooter.StateUpdatedAt.Unix(), 10)),
+			Lat:        scooter.Location.Latitude,
+			Lon:        scooter.Location.Longitude,
+			IsDisabled: scooter.State == sharealyzer.Broken || scooter.State == sharealyzer.Missing,
+		})
+	}
+	return bikes
+}
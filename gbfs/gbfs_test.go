@@ -0,0 +1,49 @@
+package gbfs
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeBikeStatus(t *testing.T) {
+	scrapeDate := time.Date(2019, 10, 6, 13, 0, 0, 0, time.UTC)
+	stateUpdate := scrapeDate.Add(-time.Hour)
+	scooters := []*sharealyzer.Scooter{
+		{ID: "a", State: sharealyzer.IdleRentable, Location: sharealyzer.NewGeoLocation(51.5, 7.4), StateUpdatedAt: stateUpdate},
+		{ID: "b", State: sharealyzer.Broken, Location: sharealyzer.NewGeoLocation(51.6, 7.5), StateUpdatedAt: stateUpdate},
+		{ID: "c", State: sharealyzer.InUse, Location: sharealyzer.NewGeoLocation(51.7, 7.6), StateUpdatedAt: stateUpdate},
+	}
+	server := NewServer(SystemInformation{SystemID: "test", Language: "en", Name: "Test", Timezone: "Europe/Berlin"},
+		func() (sharealyzer.ScrapeResult, error) {
+			return sharealyzer.NewScrapeResult("circ", scrapeDate, scooters), nil
+		}, "http://example.com/gbfs/", []byte("salt"))
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/free_bike_status.json", nil))
+	var feed struct {
+		LastUpdated int64 `json:"last_updated"`
+		TTL         int   `json:"ttl"`
+		Data        struct {
+			Bikes []Bike `json:"bikes"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&feed))
+	assert.Equal(t, scrapeDate.Unix(), feed.LastUpdated)
+	assert.Equal(t, 60, feed.TTL)
+	require.Len(t, feed.Data.Bikes, 2)
+	assert.NotEqual(t, "a", feed.Data.Bikes[0].BikeID)
+	assert.True(t, feed.Data.Bikes[1].IsDisabled)
+
+	scooters[0].StateUpdatedAt = scrapeDate
+	assert.NotEqual(t, feed.Data.Bikes[0].BikeID, server.Bikes(scooters)[0].BikeID)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/gbfs.json", nil))
+	assert.Contains(t, rec.Body.String(), "http://example.com/gbfs/free_bike_status.json")
+}
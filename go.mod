@@ -1,12 +1,19 @@
 module github.com/dereulenspiegel/sharealyzer
 
-go 1.13
+go 1.22
 
 require (
 	github.com/davecgh/go-spew v1.1.0
 	github.com/fsnotify/fsnotify v1.4.7
+	github.com/klauspost/compress v1.18.0
+	github.com/klauspost/pgzip v1.2.6
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.4.0
 	github.com/umahmood/haversine v0.0.0-20151105152445-808ab04add26
+)
+
+require (
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20191010194322-b09406accb47 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
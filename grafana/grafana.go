@@ -0,0 +1,12 @@
+// Package grafana ships the SQL views for the Grafana dashboard in dashboard.json on top of the trips table
+// written by the Postgres/Timescale sink
+package grafana
+
+import (
+	_ "embed"
+)
+
+// Views creates the trips table if it doesn't exist and the aggregate views the dashboard queries
+//
+//go:embed views.sql
+var Views string
@@ -0,0 +1,65 @@
+-- Aggregate views for Grafana on top of the trips table written by the Postgres/Timescale sink.
+-- The ingester applies this file when the sink is enabled with -postgres, it can also be applied
+-- manually with: psql -f grafana/views.sql
+CREATE TABLE IF NOT EXISTS trips (
+    id                 TEXT NOT NULL,
+    scooter_id         TEXT NOT NULL,
+    provider           TEXT NOT NULL,
+    start_charge_level DOUBLE PRECISION,
+    end_charge_level   DOUBLE PRECISION,
+    start_latitude     DOUBLE PRECISION,
+    start_longitude    DOUBLE PRECISION,
+    end_latitude       DOUBLE PRECISION,
+    end_longitude      DOUBLE PRECISION,
+    user_id            TEXT,
+    duration           INTERVAL,
+    cost               BIGINT,
+    start_time         TIMESTAMPTZ NOT NULL,
+    end_time           TIMESTAMPTZ NOT NULL,
+    distance           DOUBLE PRECISION,
+    type               TEXT,
+    -- Trips are delivered at least once, the sink skips trips which are already stored
+    PRIMARY KEY (id, start_time)
+);
+
+CREATE INDEX IF NOT EXISTS trips_start_time_idx ON trips (start_time);
+
+-- With TimescaleDB the trips are partitioned by their start time
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+        PERFORM create_hypertable('trips', 'start_time', if_not_exists => TRUE);
+    END IF;
+END
+$$;
+
+CREATE OR REPLACE VIEW daily_trips AS
+SELECT date_trunc('day', start_time) AS day,
+       provider,
+       type,
+       count(*)                      AS trips,
+       sum(cost) / 100.0             AS revenue_eur,
+       avg(distance)                 AS avg_distance_km,
+       avg(extract(epoch FROM duration) / 60) AS avg_duration_min
+FROM trips
+GROUP BY 1, 2, 3;
+
+CREATE OR REPLACE VIEW hourly_trips AS
+SELECT date_trunc('hour', start_time) AS hour,
+       provider,
+       count(*) FILTER (WHERE type = 'CUSTOMER_TRIP') AS customer_trips,
+       count(*) FILTER (WHERE type = 'CHARGING_TRIP') AS charging_trips,
+       count(*) FILTER (WHERE type = 'RELOCATION_TRIP') AS relocation_trips
+FROM trips
+GROUP BY 1, 2;
+
+-- Utilization is the number of customer trips per active scooter and day. A scooter counts as active
+-- on a day if it had any trip that day.
+CREATE OR REPLACE VIEW daily_utilization AS
+SELECT date_trunc('day', start_time) AS day,
+       provider,
+       count(DISTINCT scooter_id) AS active_scooters,
+       count(*) FILTER (WHERE type = 'CUSTOMER_TRIP')::DOUBLE PRECISION
+           / NULLIF(count(DISTINCT scooter_id), 0) AS trips_per_scooter
+FROM trips
+GROUP BY 1, 2;
@@ -0,0 +1,100 @@
+package sharealyzer
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// GroupMaxTimeDiff is the time by which the starts and ends of trips ridden together differ at most,
+	// which is mostly the interval between two scrapes
+	GroupMaxTimeDiff = 2 * time.Minute
+	// GroupMaxDistance is the distance in kilometers between the start and end locations of trips ridden
+	// together
+	GroupMaxDistance = 0.1
+)
+
+// GroupDetector finds customer trips which started and ended together in space and time, i.e. friends
+// riding together. Its zero value is not useful, start with DefaultGroupDetector.
+type GroupDetector struct {
+	MaxTimeDiff time.Duration
+	MaxDistance float64
+}
+
+// DefaultGroupDetector returns a GroupDetector with the default thresholds
+func DefaultGroupDetector() GroupDetector {
+	return GroupDetector{
+		MaxTimeDiff: GroupMaxTimeDiff,
+		MaxDistance: GroupMaxDistance,
+	}
+}
+
+// Detect sets the GroupID of all classified customer trips which were ridden together with another trip
+// and returns the number of groups. Trips are in a group if they are connected by pairs of trips whose
+// starts and ends are close, the ID of the group is the ID of its earliest trip.
+func (g GroupDetector) Detect(trips []*Trip) int {
+	var candidates []*Trip
+	for _, trip := range trips {
+		if trip.Type == CUSTOMER_TRIP && !trip.StaleLocation && trip.StartLocation != nil && trip.EndLocation != nil {
+			candidates = append(candidates, trip)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].StartTime.Equal(candidates[j].StartTime) {
+			return candidates[i].ID < candidates[j].ID
+		}
+		return candidates[i].StartTime.Before(candidates[j].StartTime)
+	})
+
+	// Union find over the candidates, the root of a group is its earliest trip
+	parents := make([]int, len(candidates))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+	for i, trip := range candidates {
+		for j := i + 1; j < len(candidates) && candidates[j].StartTime.Sub(trip.StartTime) <= g.MaxTimeDiff; j++ {
+			if g.together(trip, candidates[j]) {
+				ri, rj := root(i), root(j)
+				if ri > rj {
+					ri, rj = rj, ri
+				}
+				parents[rj] = ri
+			}
+		}
+	}
+
+	sizes := make(map[int]int)
+	for i := range candidates {
+		sizes[root(i)]++
+	}
+	for i, trip := range candidates {
+		if r := root(i); sizes[r] > 1 {
+			trip.GroupID = candidates[r].ID
+		}
+	}
+	groups := 0
+	for _, size := range sizes {
+		if size > 1 {
+			groups++
+		}
+	}
+	return groups
+}
+
+// together returns true if two trips of different scooters started and ended close to each other
+func (g GroupDetector) together(a, b *Trip) bool {
+	endDiff := a.EndTime.Sub(b.EndTime)
+	if endDiff < 0 {
+		endDiff = -endDiff
+	}
+	return a.ScooterID != b.ScooterID && endDiff <= g.MaxTimeDiff &&
+		distance(a.StartLocation, b.StartLocation) <= g.MaxDistance &&
+		distance(a.EndLocation, b.EndLocation) <= g.MaxDistance
+}
@@ -0,0 +1,47 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupDetector(t *testing.T) {
+	start := time.Date(2019, 10, 6, 20, 0, 0, 0, time.UTC)
+	trip := func(id, scooterID string, startOffset, endOffset time.Duration, startLat, endLat float64) *Trip {
+		return &Trip{
+			ID:            id,
+			ScooterID:     scooterID,
+			Type:          CUSTOMER_TRIP,
+			StartTime:     start.Add(startOffset),
+			EndTime:       start.Add(endOffset),
+			StartLocation: NewGeoLocation(startLat, 7.40),
+			EndLocation:   NewGeoLocation(endLat, 7.40),
+		}
+	}
+	// a, b and c were ridden together, c only close enough to b
+	a := trip("a", "1", 0, 15*time.Minute, 51.5000, 51.5200)
+	b := trip("b", "2", time.Minute, 16*time.Minute, 51.5005, 51.5205)
+	c := trip("c", "3", 2*time.Minute, 17*time.Minute, 51.5010, 51.5210)
+	// d started with them but went elsewhere, e started at the same place later
+	d := trip("d", "4", 0, 15*time.Minute, 51.5000, 51.5500)
+	e := trip("e", "5", 10*time.Minute, 25*time.Minute, 51.5000, 51.5200)
+	// f and g were relocated together by a van
+	f := trip("f", "6", 0, 15*time.Minute, 51.5000, 51.5200)
+	f.Type = RELOCATION_TRIP
+	g := trip("g", "7", 0, 15*time.Minute, 51.5000, 51.5200)
+	g.Type = RELOCATION_TRIP
+	// h and i are the same scooter
+	h := trip("h", "8", 30*time.Minute, 40*time.Minute, 51.6000, 51.6100)
+	i := trip("i", "8", 31*time.Minute, 41*time.Minute, 51.6000, 51.6100)
+
+	groups := DefaultGroupDetector().Detect([]*Trip{e, c, b, a, d, f, g, h, i})
+	assert.Equal(t, 1, groups)
+	for _, grouped := range []*Trip{a, b, c} {
+		assert.Equal(t, "a", grouped.GroupID)
+	}
+	for _, single := range []*Trip{d, e, f, g, h, i} {
+		assert.Empty(t, single.GroupID, single.ID)
+	}
+}
@@ -0,0 +1,130 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTripHistoryRetention is how long a TripHistory remembers completed trips
+const DefaultTripHistoryRetention = 24 * time.Hour
+
+// TripHistory remembers recently completed trips by their scooter and end time. Restarting the aggregation
+// over scrape files which were already aggregated before, i.e. when following an archive, finishes the
+// same trips again, the history allows to drop them instead of storing them twice. It is safe for
+// concurrent use.
+type TripHistory struct {
+	Path string
+	// Retention is how long trips are remembered before the end of the newest trip, defaults to
+	// DefaultTripHistoryRetention
+	Retention time.Duration
+
+	lock   sync.Mutex
+	trips  map[historyKey]bool
+	newest time.Time
+}
+
+type historyKey struct {
+	scooterID string
+	endTime   int64
+}
+
+type historyEntry struct {
+	ScooterID string    `json:"scooter_id"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+func newHistoryKey(scooterID string, endTime time.Time) historyKey {
+	return historyKey{scooterID: scooterID, endTime: endTime.Unix()}
+}
+
+// Load reads the history from Path. If no history exists yet the history stays empty.
+func (h *TripHistory) Load() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.trips = make(map[historyKey]bool)
+	h.newest = time.Time{}
+	historyFile, err := os.Open(h.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer historyFile.Close()
+	var entries []historyEntry
+	if err := json.NewDecoder(historyFile).Decode(&entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		h.add(entry.ScooterID, entry.EndTime)
+	}
+	return nil
+}
+
+func (h *TripHistory) add(scooterID string, endTime time.Time) {
+	if h.trips == nil {
+		h.trips = make(map[historyKey]bool)
+	}
+	h.trips[newHistoryKey(scooterID, endTime)] = true
+	if endTime.After(h.newest) {
+		h.newest = endTime
+	}
+}
+
+// Contains returns true if the finished trip is already in the history
+func (h *TripHistory) Contains(trip *Trip) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.trips[newHistoryKey(trip.ScooterID, trip.EndTime)]
+}
+
+// Add records the finished trips. Only trips which were stored should be added, everything else gets lost
+// on a restart.
+func (h *TripHistory) Add(trips []*Trip) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, trip := range trips {
+		h.add(trip.ScooterID, trip.EndTime)
+	}
+}
+
+// Len returns the number of remembered trips
+func (h *TripHistory) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.trips)
+}
+
+// Save forgets all trips older than the retention and stores the rest at Path
+func (h *TripHistory) Save() error {
+	h.lock.Lock()
+	retention := h.Retention
+	if retention <= 0 {
+		retention = DefaultTripHistoryRetention
+	}
+	oldest := h.newest.Add(-retention).Unix()
+	entries := make([]historyEntry, 0, len(h.trips))
+	for key := range h.trips {
+		if key.endTime < oldest {
+			delete(h.trips, key)
+			continue
+		}
+		entries = append(entries, historyEntry{ScooterID: key.scooterID, EndTime: time.Unix(key.endTime, 0).UTC()})
+	}
+	h.lock.Unlock()
+
+	tmpPath := h.Path + ".tmp"
+	historyFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(historyFile).Encode(entries); err != nil {
+		historyFile.Close()
+		return err
+	}
+	if err := historyFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.Path)
+}
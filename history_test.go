@@ -0,0 +1,71 @@
+package sharealyzer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	history := &TripHistory{Path: filepath.Join(dir, "history.json"), Retention: time.Hour}
+	require.NoError(t, history.Load())
+	assert.Equal(t, 0, history.Len())
+
+	end := time.Date(2019, 10, 6, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	old := &Trip{ScooterID: "a", EndTime: end.Add(-2 * time.Hour)}
+	recent := &Trip{ScooterID: "a", EndTime: end.Add(-30 * time.Minute)}
+	newest := &Trip{ScooterID: "b", EndTime: end}
+	history.Add([]*Trip{old, recent, newest})
+	assert.True(t, history.Contains(old))
+	assert.False(t, history.Contains(&Trip{ScooterID: "b", EndTime: recent.EndTime}))
+	require.NoError(t, history.Save())
+
+	// Trips older than the retention are forgotten
+	loaded := &TripHistory{Path: history.Path}
+	require.NoError(t, loaded.Load())
+	assert.Equal(t, 2, loaded.Len())
+	assert.False(t, loaded.Contains(old))
+	assert.True(t, loaded.Contains(recent))
+	assert.True(t, loaded.Contains(&Trip{ScooterID: "b", EndTime: end.UTC()}))
+}
+
+func TestTripAggregatorDropsStoredTrips(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	aBack := &Scooter{ID: "a", ChargeLevel: 70, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start.Add(20 * time.Minute)}
+	bBack := &Scooter{ID: "b", ChargeLevel: 50, Location: NewGeoLocation(51.53, 7.43), StateUpdatedAt: start.Add(40 * time.Minute)}
+
+	snapshots := [][]*Scooter{{a, b}, {b}, {aBack}, {aBack, bBack}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	// The first run stored the trip of a before it was restarted
+	first := aggregateTrips(NewTripAggregator(), results[:3])
+	require.Len(t, first, 1)
+	history := &TripHistory{}
+	for _, trip := range first {
+		trip := trip
+		history.Add([]*Trip{&trip})
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.History = history
+	trips := aggregateTrips(aggregator, results)
+	require.Len(t, trips, 1)
+	for _, trip := range trips {
+		assert.Equal(t, "b", trip.ScooterID)
+	}
+	assert.Equal(t, 1, aggregator.DuplicateTrips())
+}
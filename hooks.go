@@ -0,0 +1,33 @@
+package sharealyzer
+
+import (
+	"net/http"
+)
+
+// RequestHook is called with every request before a provider client sends it, i.e. to add tracing headers
+type RequestHook func(r *http.Request)
+
+// ResponseHook is called with every response a provider client receives, i.e. for logging or request capture.
+// Hooks reading the body need to replace it, so the client can still read it.
+type ResponseHook func(resp *http.Response)
+
+// Hooks holds the request and response hooks of a provider client
+type Hooks struct {
+	Request  []RequestHook
+	Response []ResponseHook
+}
+
+// Do sends the request with the given client and calls the hooks
+func (h *Hooks) Do(client *http.Client, r *http.Request) (*http.Response, error) {
+	for _, hook := range h.Request {
+		hook(r)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range h.Response {
+		hook(resp)
+	}
+	return resp, nil
+}
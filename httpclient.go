@@ -0,0 +1,48 @@
+package sharealyzer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRequestTimeout is the timeout of a single request to a provider API
+var DefaultRequestTimeout = time.Second * 30
+
+// NewHTTPClient creates a http client for provider clients, which routes all requests through the given
+// HTTP(S) or SOCKS5 proxy (i.e. socks5://localhost:1080) and trusts the CAs in the PEM encoded caBundle
+// in addition to the system CAs. Leave proxyURL or caBundle empty to use the defaults. Requests taking
+// longer than timeout are aborted, DefaultRequestTimeout is used if timeout is 0.
+func NewHTTPClient(proxyURL, caBundle string, timeout time.Duration) (*http.Client, error) {
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid proxy URL")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if caBundle != "" {
+		pemData, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read CA bundle")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, errors.Errorf("No certificates found in CA bundle %s", caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
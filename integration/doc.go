@@ -0,0 +1,10 @@
+// Package integration tests the whole pipeline from a fake provider API to the trip sinks against
+// containerized services. The tests only build with the integration build tag and expect the services
+// of docker-compose.yml to be running:
+//
+//	docker compose -f integration/docker-compose.yml up -d --wait
+//	go test -tags integration ./integration/...
+//
+// SCHEMA_REGISTRY_URL overrides the address of the schema registry. Queries run with the duckdb command
+// line tool and are skipped if it isn't installed.
+package integration
@@ -0,0 +1,231 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/archive"
+	"github.com/dereulenspiegel/sharealyzer/avro"
+	"github.com/dereulenspiegel/sharealyzer/circ"
+	"github.com/dereulenspiegel/sharealyzer/duckdb"
+	"github.com/dereulenspiegel/sharealyzer/providertest"
+	"github.com/dereulenspiegel/sharealyzer/sim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registryURL() string {
+	if url := os.Getenv("SCHEMA_REGISTRY_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8081"
+}
+
+// staticTokenStore provides a refresh token, so the client doesn't need to login
+type staticTokenStore struct{}
+
+func (staticTokenStore) Store(accessToken, refreshToken string) error {
+	return nil
+}
+
+func (staticTokenStore) Load() (string, string, error) {
+	return "access-token", "refresh-token", nil
+}
+
+// fleetServer serves the available scooters of a simulated fleet as circ API
+type fleetServer struct {
+	*providertest.Server
+
+	lock  sync.Mutex
+	fleet []*sharealyzer.Scooter
+}
+
+func newFleetServer() *fleetServer {
+	s := &fleetServer{Server: providertest.NewServer()}
+	s.Handle("/login/refresh", func(w http.ResponseWriter, r *http.Request) {
+		providertest.WriteJSON(w, http.StatusOK, circ.TokenRefreshResponse{AccessToken: "access-token", RefreshToken: "refresh-token"})
+	})
+	s.Handle("/devices", func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		devices := make([]*circ.Scooter, 0, len(s.fleet))
+		for _, scooter := range s.fleet {
+			devices = append(devices, &circ.Scooter{
+				Identifier:                   scooter.ID,
+				Latitude:                     scooter.Location.Latitude,
+				Longitude:                    scooter.Location.Longitude,
+				EnergyLevel:                  int(scooter.ChargeLevel),
+				QrCode:                       scooter.QRContent,
+				State:                        "ACTIVE",
+				StateUpdateAt:                uint64(scooter.StateUpdatedAt.UnixNano() / int64(time.Millisecond)),
+				StateUpdatedByUserIdentifier: scooter.StateUpdatedByUserID,
+				InitPrice:                    scooter.InitPrice,
+				Price:                        scooter.UnitPrice,
+			})
+		}
+		providertest.WriteJSON(w, http.StatusOK, map[string]interface{}{"devices": devices, "total": len(devices)})
+	})
+	return s
+}
+
+func (s *fleetServer) setFleet(fleet []*sharealyzer.Scooter) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.fleet = fleet
+}
+
+// registrySink serializes trips with schemas registered in the schema registry, like a Kafka producer would
+type registrySink struct {
+	serializer *avro.Serializer
+
+	lock     sync.Mutex
+	messages [][]byte
+}
+
+func (s *registrySink) StoreTrips(trips []*sharealyzer.Trip) error {
+	for _, trip := range trips {
+		msg, err := s.serializer.Trip(trip)
+		if err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.messages = append(s.messages, msg)
+		s.lock.Unlock()
+	}
+	return nil
+}
+
+// waitForFiles waits until the writer wrote count scrape files
+func waitForFiles(t *testing.T, baseDir string, from, to time.Time, count int, errs <-chan error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errs:
+			require.NoError(t, err)
+		default:
+		}
+		files, err := archive.FilesInRange(baseDir, from, to)
+		require.NoError(t, err)
+		if len(files) >= count {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Scrape files weren't written within 30s")
+}
+
+func TestPipeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "integration")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := sim.DefaultOptions()
+	// Trip identifiers depend on the provider, the trips are detected in circ scrape results
+	opts.Provider = "circ"
+	opts.Scooters = 50
+	opts.Scrapes = 180
+	opts.TripProbability = 0.05
+	from, to := opts.From, opts.From.Add(time.Duration(opts.Scrapes)*opts.Interval)
+	simulation := sim.New(opts)
+
+	server := newFleetServer()
+	defer server.Close()
+	client := circ.New(circ.WithBaseURL(server.URL), circ.WithTokenStore(staticTokenStore{}),
+		circ.WithDecoder(circ.NewScooterDecoder(sharealyzer.DecodeStrict)))
+
+	// Scrape the fake API once per simulated scrape and archive the results like the scraper does
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &sharealyzer.GZippedFileWriter{BaseDir: dir}
+	files := make(chan sharealyzer.ScrapeFile)
+	writeErrs := writer.Write(ctx, files)
+	observations := 0
+	for res := simulation.Next(); res != nil; res = simulation.Next() {
+		server.setFleet(res.Scooters())
+		scooters, err := client.Scooters(opts.Area.LatTopLeft, opts.Area.LonTopLeft, opts.Area.LatBottomRight, opts.Area.LonBottomRight)
+		require.NoError(t, err)
+		require.Len(t, scooters, len(res.Scooters()))
+		observations += len(scooters)
+		files <- &circ.ScrapeResult{Date: res.ScrapeDate(), Scooters: scooters}
+	}
+	waitForFiles(t, dir, from, to, opts.Scrapes, writeErrs)
+	assert.Equal(t, 1, server.Requests("/login/refresh"))
+
+	// Aggregate the archive and deliver the trips to a trip store and the schema registry
+	results, stats, err := circ.ReadArchive(dir, from, to)
+	require.NoError(t, err)
+	aggregator := sharealyzer.NewTripAggregator()
+	batches := sharealyzer.ClassifyTripBatches(aggregator.AggregateBatches(circ.ConvertScrapeResult(results), 25, 0))
+
+	tripStorePath := filepath.Join(dir, "trips.jsonl")
+	store := &sharealyzer.FileTripStore{Path: tripStorePath}
+	registry := &registrySink{serializer: &avro.Serializer{Registry: avro.NewRegistry(registryURL()), Topic: "sharealyzer-integration-trips"}}
+	sinks := &sharealyzer.SinkGroup{Sinks: map[string]sharealyzer.TripSink{
+		"tripStore": sharealyzer.TripStoreSink{TripStore: store},
+		"registry":  registry,
+	}}
+	var delivered []*sharealyzer.Trip
+	require.NoError(t, sinks.Deliver(batches, func(batch []*sharealyzer.Trip) {
+		delivered = append(delivered, batch...)
+	}))
+	require.NoError(t, store.Close())
+	assert.Empty(t, stats.Failed)
+
+	// The detected trips are the trips which happened in the simulation
+	truth := simulation.Trips()
+	require.NotEmpty(t, truth)
+	expected := make(map[string]*sharealyzer.Trip)
+	var expectedIDs, deliveredIDs, storedIDs []string
+	for _, trip := range truth {
+		expected[trip.ID] = trip
+		expectedIDs = append(expectedIDs, trip.ID)
+	}
+	for _, trip := range delivered {
+		deliveredIDs = append(deliveredIDs, trip.ID)
+		if expectedTrip, exists := expected[trip.ID]; exists {
+			assert.True(t, expectedTrip.StartTime.Equal(trip.StartTime))
+			assert.True(t, expectedTrip.EndTime.Equal(trip.EndTime))
+		}
+	}
+	assert.ElementsMatch(t, expectedIDs, deliveredIDs)
+	require.NoError(t, store.Each(func(trip *sharealyzer.Trip) bool {
+		storedIDs = append(storedIDs, trip.ID)
+		return true
+	}))
+	assert.ElementsMatch(t, expectedIDs, storedIDs)
+
+	require.Len(t, registry.messages, len(truth))
+	schemaID, payload, err := avro.ParseFrame(registry.messages[0])
+	require.NoError(t, err)
+	assert.True(t, schemaID > 0)
+	assert.Equal(t, avro.MarshalTrip(delivered[0]), payload)
+
+	t.Run("queries", func(t *testing.T) {
+		if _, err := exec.LookPath(duckdb.DefaultBinary); err != nil {
+			t.Skip("duckdb is not installed")
+		}
+		results, _, err := circ.ReadArchive(dir, from, to)
+		require.NoError(t, err)
+		db := duckdb.Open(filepath.Join(dir, "analysis.duckdb"))
+		rows, err := duckdb.Materialize(db, circ.ConvertScrapeResult(results), tripStorePath)
+		require.NoError(t, err)
+		assert.Equal(t, observations, rows)
+
+		counts, err := db.Query("SELECT (SELECT count(*) FROM observations) AS observations, (SELECT count(*) FROM trips) AS trips")
+		require.NoError(t, err)
+		require.Len(t, counts, 1)
+		assert.Equal(t, float64(observations), counts[0]["observations"])
+		assert.Equal(t, float64(len(truth)), counts[0]["trips"])
+	})
+}
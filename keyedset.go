@@ -0,0 +1,49 @@
+package sharealyzer
+
+// KeyedSet is a set of values identified by a key, i.e. the scooters of a scrape result by their
+// identifier. It makes it easy to compare consecutive scrape results of any provider.
+type KeyedSet[K comparable, V any] map[K]V
+
+// NewKeyedSet creates a KeyedSet from a slice of values with the key returned by key. If several values
+// have the same key the last one wins.
+func NewKeyedSet[K comparable, V any](in []V, key func(V) K) KeyedSet[K, V] {
+	s := make(KeyedSet[K, V], len(in))
+	for _, v := range in {
+		s[key(v)] = v
+	}
+	return s
+}
+
+// Difference returns all values which exist in ns but not in this set
+func (s KeyedSet[K, V]) Difference(ns KeyedSet[K, V]) KeyedSet[K, V] {
+	s2 := make(KeyedSet[K, V])
+	for key, v := range ns {
+		if _, exists := s[key]; !exists {
+			s2[key] = v
+		}
+	}
+	return s2
+}
+
+// Intersect returns the values of ns whose keys also exist in this set
+func (s KeyedSet[K, V]) Intersect(ns KeyedSet[K, V]) KeyedSet[K, V] {
+	s2 := make(KeyedSet[K, V])
+	for key, v := range ns {
+		if _, exists := s[key]; exists {
+			s2[key] = v
+		}
+	}
+	return s2
+}
+
+// Changed returns the values of ns which also exist in this set, but aren't equal to the value in this
+// set according to equal
+func (s KeyedSet[K, V]) Changed(ns KeyedSet[K, V], equal func(a, b V) bool) KeyedSet[K, V] {
+	s2 := make(KeyedSet[K, V])
+	for key, v := range ns {
+		if old, exists := s[key]; exists && !equal(old, v) {
+			s2[key] = v
+		}
+	}
+	return s2
+}
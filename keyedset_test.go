@@ -0,0 +1,33 @@
+package sharealyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedSet(t *testing.T) {
+	last := NewScooters([]*Scooter{
+		{ID: "a", ChargeLevel: 80},
+		{ID: "b", ChargeLevel: 50},
+		{ID: "c", ChargeLevel: 30},
+	})
+	current := NewScooters([]*Scooter{
+		{ID: "b", ChargeLevel: 50},
+		{ID: "c", ChargeLevel: 25},
+		{ID: "d", ChargeLevel: 100},
+	})
+
+	assert.Equal(t, Scooters{"a": last["a"]}, current.Difference(last))
+	assert.Equal(t, Scooters{"d": current["d"]}, last.Difference(current))
+	assert.Equal(t, Scooters{"b": current["b"], "c": current["c"]}, last.Intersect(current))
+	assert.Equal(t, Scooters{"c": current["c"]}, last.Changed(current, func(a, b *Scooter) bool {
+		return a.ChargeLevel == b.ChargeLevel
+	}))
+	assert.Empty(t, last.Difference(last))
+}
+
+func TestNewKeyedSetLastWins(t *testing.T) {
+	set := NewKeyedSet([]string{"apple", "avocado", "banana"}, func(s string) byte { return s[0] })
+	assert.Equal(t, KeyedSet[byte, string]{'a': "avocado", 'b': "banana"}, set)
+}
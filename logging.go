@@ -0,0 +1,61 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logLevelPrefixes = map[string]string{
+	"[ERROR]":   "error",
+	"[WARNING]": "warning",
+	"[TRACE]":   "trace",
+}
+
+type jsonLogWriter struct {
+	out io.Writer
+	mtx sync.Mutex
+}
+
+type jsonLogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+}
+
+// NewJSONLogWriter returns a writer to be used with log.SetOutput which writes every log line as
+// JSON object to out. Use it together with log.SetFlags(0). The level is derived from the [ERROR] and
+// [WARNING] prefixes used throughout sharealyzer.
+func NewJSONLogWriter(out io.Writer) io.Writer {
+	return &jsonLogWriter{
+		out: out,
+	}
+}
+
+func (j *jsonLogWriter) Write(p []byte) (int, error) {
+	line := jsonLogLine{
+		Time:    time.Now(),
+		Level:   "info",
+		Message: strings.TrimSpace(string(p)),
+	}
+	for prefix, level := range logLevelPrefixes {
+		if strings.HasPrefix(line.Message, prefix) {
+			line.Level = level
+			line.Message = strings.TrimSpace(strings.TrimPrefix(line.Message, prefix))
+			line.Message = strings.TrimSpace(strings.TrimPrefix(line.Message, ":"))
+			break
+		}
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return 0, err
+	}
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if _, err := j.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,155 @@
+// Package nominatim resolves places like cities via the OpenStreetMap Nominatim API, so the area to
+// scrape can be derived from a city name
+package nominatim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const (
+	searchURL = `https://nominatim.openstreetmap.org/search`
+
+	// DefaultUserAgent identifies us against Nominatim as required by its usage policy
+	DefaultUserAgent = "sharealyzer (https://github.com/dereulenspiegel/sharealyzer)"
+)
+
+// ClientOption lets you specify options for the client
+type ClientOption func(c *Client)
+
+// WithHTTPClient allows you to specify a custom http client instead of Go's default client
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithUserAgent sets the user agent sent to Nominatim
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRequestHook adds a hook which is called with every request before it is sent
+func WithRequestHook(hook sharealyzer.RequestHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Request = append(c.hooks.Request, hook)
+	}
+}
+
+// WithResponseHook adds a hook which is called with every received response
+func WithResponseHook(hook sharealyzer.ResponseHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Response = append(c.hooks.Response, hook)
+	}
+}
+
+// Client is a client to the Nominatim search API
+type Client struct {
+	httpClient *http.Client
+	userAgent  string
+	hooks      sharealyzer.Hooks
+}
+
+// New creates a new Nominatim client with the specified options
+func New(opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: &http.Client{Timeout: sharealyzer.DefaultRequestTimeout},
+		userAgent:  DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// BoundingBox is a rectangle described by its top left and bottom right corners, it is the
+// sharealyzer.BoundingBox the Validator checks areas with
+type BoundingBox = sharealyzer.BoundingBox
+
+// Place is a resolved place with its bounding box and boundary
+type Place struct {
+	DisplayName string
+	BoundingBox BoundingBox
+	Boundary    sharealyzer.Polygons
+}
+
+type searchResult struct {
+	DisplayName string          `json:"display_name"`
+	BoundingBox []string        `json:"boundingbox"` // south, north, west, east
+	GeoJSON     json.RawMessage `json:"geojson"`
+}
+
+// City resolves the boundary of the given city
+func (c *Client) City(city string) (*Place, error) {
+	q := url.Values{}
+	q.Add("city", city)
+	q.Add("format", "json")
+	q.Add("limit", "1")
+	q.Add("polygon_geojson", "1")
+	r, err := http.NewRequest(http.MethodGet, searchURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.hooks.Do(c.httpClient, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := sharealyzer.CheckRateLimit(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("Nominatim returned status %d", resp.StatusCode)
+	}
+	var results []searchResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("City %s not found", city)
+	}
+	return parseResult(results[0])
+}
+
+func parseResult(res searchResult) (*Place, error) {
+	if len(res.BoundingBox) != 4 {
+		return nil, fmt.Errorf("Unexpected bounding box %v", res.BoundingBox)
+	}
+	var box [4]float64
+	for i, s := range res.BoundingBox {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		box[i] = f
+	}
+	place := &Place{
+		DisplayName: res.DisplayName,
+		BoundingBox: BoundingBox{
+			LatTopLeft:     box[1],
+			LonTopLeft:     box[2],
+			LatBottomRight: box[0],
+			LonBottomRight: box[3],
+		},
+	}
+	if len(res.GeoJSON) == 0 {
+		return place, nil
+	}
+
+	boundary, err := sharealyzer.ParseGeoJSONPolygons(res.GeoJSON)
+	if err != nil {
+		return nil, err
+	}
+	place.Boundary = boundary
+	return place, nil
+}
@@ -0,0 +1,35 @@
+package nominatim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dortmundResult = `{
+	"display_name": "Dortmund, Nordrhein-Westfalen, Deutschland",
+	"boundingbox": ["51.4155", "51.6000", "7.3022", "7.6380"],
+	"geojson": {
+		"type": "Polygon",
+		"coordinates": [[[7.30, 51.41], [7.64, 51.41], [7.64, 51.60], [7.30, 51.60], [7.30, 51.41]]]
+	}
+}`
+
+func TestParseResult(t *testing.T) {
+	var res searchResult
+	require.NoError(t, json.Unmarshal([]byte(dortmundResult), &res))
+
+	place, err := parseResult(res)
+	require.NoError(t, err)
+	assert.Equal(t, 51.6, place.BoundingBox.LatTopLeft)
+	assert.Equal(t, 7.3022, place.BoundingBox.LonTopLeft)
+	assert.Equal(t, 51.4155, place.BoundingBox.LatBottomRight)
+	assert.Equal(t, 7.638, place.BoundingBox.LonBottomRight)
+
+	require.Len(t, place.Boundary, 1)
+	assert.True(t, place.Boundary.Contains(sharealyzer.NewGeoLocation(51.51, 7.46)))
+	assert.False(t, place.Boundary.Contains(sharealyzer.NewGeoLocation(52.51, 13.4)))
+}
@@ -0,0 +1,361 @@
+// Package overpass fetches context features like bike lanes, transit stops and city boundaries from
+// OpenStreetMap via the Overpass API and stores them alongside the scrape archive, so analyses can relate
+// scooters and trips to their surroundings
+package overpass
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/nominatim"
+	"github.com/umahmood/haversine"
+)
+
+const (
+	// DefaultURL is the interpreter endpoint of the public Overpass instance
+	DefaultURL = `https://overpass-api.de/api/interpreter`
+
+	// DefaultUserAgent identifies us against Overpass
+	DefaultUserAgent = "sharealyzer (https://github.com/dereulenspiegel/sharealyzer)"
+
+	// ContextFolder is the folder within the archive base directory where context layers are stored
+	ContextFolder = "context"
+)
+
+// Layer is a kind of context features
+type Layer string
+
+const (
+	// BikeLanes are cycleways and roads with cycle lanes or tracks
+	BikeLanes Layer = "bike_lanes"
+	// TransitStops are bus, tram and train stops
+	TransitStops Layer = "transit_stops"
+	// CityBoundaries are the administrative boundaries of cities and municipalities
+	CityBoundaries Layer = "city_boundaries"
+)
+
+// Layers lists all supported layers
+var Layers = []Layer{BikeLanes, TransitStops, CityBoundaries}
+
+// layerQueries contains the Overpass QL statements of every layer, {{bbox}} is replaced by the bounding box
+var layerQueries = map[Layer][]string{
+	BikeLanes: {
+		`way["highway"="cycleway"]({{bbox}})`,
+		`way["cycleway"~"^(lane|track|share_busway)$"]({{bbox}})`,
+		`way["cycleway:both"~"^(lane|track)$"]({{bbox}})`,
+		`way["cycleway:left"~"^(lane|track)$"]({{bbox}})`,
+		`way["cycleway:right"~"^(lane|track)$"]({{bbox}})`,
+	},
+	TransitStops: {
+		`node["highway"="bus_stop"]({{bbox}})`,
+		`node["railway"~"^(station|halt|tram_stop)$"]({{bbox}})`,
+		`node["public_transport"="stop_position"]({{bbox}})`,
+	},
+	CityBoundaries: {
+		`relation["boundary"="administrative"]["admin_level"="8"]({{bbox}})`,
+	},
+}
+
+// ClientOption lets you specify options for the client
+type ClientOption func(c *Client)
+
+// WithHTTPClient allows you to specify a custom http client instead of Go's default client
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithURL sets the interpreter endpoint, i.e. of a self hosted Overpass instance
+func WithURL(url string) ClientOption {
+	return func(c *Client) {
+		c.url = url
+	}
+}
+
+// WithUserAgent sets the user agent sent to Overpass
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRequestHook adds a hook which is called with every request before it is sent
+func WithRequestHook(hook sharealyzer.RequestHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Request = append(c.hooks.Request, hook)
+	}
+}
+
+// WithResponseHook adds a hook which is called with every received response
+func WithResponseHook(hook sharealyzer.ResponseHook) ClientOption {
+	return func(c *Client) {
+		c.hooks.Response = append(c.hooks.Response, hook)
+	}
+}
+
+// Client is a client to the Overpass API
+type Client struct {
+	httpClient *http.Client
+	url        string
+	userAgent  string
+	hooks      sharealyzer.Hooks
+}
+
+// New creates a new Overpass client with the specified options. Overpass queries can take a while, so
+// the default timeout is longer than for provider APIs.
+func New(opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+		url:        DefaultURL,
+		userAgent:  DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Feature is an OpenStreetMap element. Nodes have a Location, ways have a single line and relations
+// have a line for every outer member way.
+type Feature struct {
+	ID       int64                        `json:"id"`
+	Type     string                       `json:"type"`
+	Tags     map[string]string            `json:"tags,omitempty"`
+	Location *sharealyzer.GeoLocation     `json:"location,omitempty"`
+	Lines    [][]*sharealyzer.GeoLocation `json:"lines,omitempty"`
+}
+
+// ContextLayer is a set of features fetched for an area
+type ContextLayer struct {
+	Layer       Layer                 `json:"layer"`
+	BoundingBox nominatim.BoundingBox `json:"boundingBox"`
+	FetchedAt   time.Time             `json:"fetchedAt"`
+	Features    []*Feature            `json:"features"`
+}
+
+type point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type element struct {
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Lat      float64           `json:"lat"`
+	Lon      float64           `json:"lon"`
+	Tags     map[string]string `json:"tags"`
+	Geometry []point           `json:"geometry"`
+	Members  []struct {
+		Type     string  `json:"type"`
+		Role     string  `json:"role"`
+		Geometry []point `json:"geometry"`
+	} `json:"members"`
+}
+
+// Query builds the Overpass QL query of the layer within the bounding box
+func Query(layer Layer, box nominatim.BoundingBox) (string, error) {
+	statements, exists := layerQueries[layer]
+	if !exists {
+		return "", fmt.Errorf("Unknown context layer %s", layer)
+	}
+	// Overpass expects south, west, north, east
+	bbox := fmt.Sprintf("%f,%f,%f,%f", box.LatBottomRight, box.LonTopLeft, box.LatTopLeft, box.LonBottomRight)
+	query := "[out:json][timeout:90];("
+	for _, statement := range statements {
+		query += strings.Replace(statement, "{{bbox}}", bbox, -1) + ";"
+	}
+	return query + ");out geom;", nil
+}
+
+// Fetch queries the features of the layer within the bounding box
+func (c *Client) Fetch(layer Layer, box nominatim.BoundingBox) (*ContextLayer, error) {
+	query, err := Query(layer, box)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, c.url, strings.NewReader(url.Values{"data": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.hooks.Do(c.httpClient, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := sharealyzer.CheckRateLimit(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("Overpass returned status %d", resp.StatusCode)
+	}
+	var result struct {
+		Elements []element `json:"elements"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	features := make([]*Feature, 0, len(result.Elements))
+	for _, e := range result.Elements {
+		features = append(features, toFeature(e))
+	}
+	return &ContextLayer{
+		Layer:       layer,
+		BoundingBox: box,
+		FetchedAt:   time.Now(),
+		Features:    features,
+	}, nil
+}
+
+func toFeature(e element) *Feature {
+	f := &Feature{ID: e.ID, Type: e.Type, Tags: e.Tags}
+	switch e.Type {
+	case "node":
+		f.Location = sharealyzer.NewGeoLocation(e.Lat, e.Lon)
+	case "way":
+		f.Lines = append(f.Lines, toLine(e.Geometry))
+	case "relation":
+		for _, member := range e.Members {
+			if member.Type == "way" && member.Role == "outer" {
+				f.Lines = append(f.Lines, toLine(member.Geometry))
+			}
+		}
+	}
+	return f
+}
+
+func toLine(geometry []point) []*sharealyzer.GeoLocation {
+	line := make([]*sharealyzer.GeoLocation, len(geometry))
+	for i, p := range geometry {
+		line[i] = sharealyzer.NewGeoLocation(p.Lat, p.Lon)
+	}
+	return line
+}
+
+// Boundary joins the lines of a relation into closed rings. Member ways of boundaries are unordered and
+// may be reversed, so they are chained by their shared end points.
+func (f *Feature) Boundary() sharealyzer.Polygons {
+	remaining := make([][]*sharealyzer.GeoLocation, 0, len(f.Lines))
+	for _, line := range f.Lines {
+		if len(line) > 0 {
+			remaining = append(remaining, line)
+		}
+	}
+	same := func(a, b *sharealyzer.GeoLocation) bool {
+		return a.Latitude == b.Latitude && a.Longitude == b.Longitude
+	}
+	var polygons sharealyzer.Polygons
+	for len(remaining) > 0 {
+		ring := append([]*sharealyzer.GeoLocation{}, remaining[0]...)
+		remaining = remaining[1:]
+		for !same(ring[0], ring[len(ring)-1]) {
+			joined := false
+			for i, line := range remaining {
+				end := ring[len(ring)-1]
+				if same(line[0], end) {
+					ring = append(ring, line[1:]...)
+				} else if same(line[len(line)-1], end) {
+					for j := len(line) - 2; j >= 0; j-- {
+						ring = append(ring, line[j])
+					}
+				} else {
+					continue
+				}
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				joined = true
+				break
+			}
+			if !joined {
+				// The boundary is cut by the bounding box, the ring is closed implicitly
+				break
+			}
+		}
+		if len(ring) >= 3 {
+			polygons = append(polygons, sharealyzer.Polygon(ring))
+		}
+	}
+	return polygons
+}
+
+// Boundaries returns the boundaries of all relations in the layer
+func (l *ContextLayer) Boundaries() sharealyzer.Polygons {
+	var polygons sharealyzer.Polygons
+	for _, f := range l.Features {
+		if f.Type == "relation" {
+			polygons = append(polygons, f.Boundary()...)
+		}
+	}
+	return polygons
+}
+
+// Nearest returns the feature closest to loc and its distance in kilometers. The distance to lines is
+// measured to their nearest vertex, which is precise enough for the dense geometries of OpenStreetMap.
+func (l *ContextLayer) Nearest(loc *sharealyzer.GeoLocation) (*Feature, float64) {
+	var nearest *Feature
+	minDistance := math.Inf(1)
+	from := haversine.Coord{Lat: loc.Latitude, Lon: loc.Longitude}
+	check := func(f *Feature, p *sharealyzer.GeoLocation) {
+		if _, km := haversine.Distance(from, haversine.Coord{Lat: p.Latitude, Lon: p.Longitude}); km < minDistance {
+			nearest, minDistance = f, km
+		}
+	}
+	for _, f := range l.Features {
+		if f.Location != nil {
+			check(f, f.Location)
+		}
+		for _, line := range f.Lines {
+			for _, p := range line {
+				check(f, p)
+			}
+		}
+	}
+	return nearest, minDistance
+}
+
+// LayerPath returns the path of the layer within the archive base directory
+func LayerPath(baseDir string, layer Layer) string {
+	return filepath.Join(baseDir, ContextFolder, string(layer)+".json")
+}
+
+// Save stores the layer alongside the archive in baseDir
+func (l *ContextLayer) Save(baseDir string) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	path := LayerPath(baseDir, l.Layer)
+	if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Load reads a layer stored alongside the archive in baseDir
+func Load(baseDir string, layer Layer) (*ContextLayer, error) {
+	data, err := ioutil.ReadFile(LayerPath(baseDir, layer))
+	if err != nil {
+		return nil, err
+	}
+	var l ContextLayer
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,94 @@
+package overpass
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/nominatim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBox = nominatim.BoundingBox{LatTopLeft: 51.6, LonTopLeft: 7.3, LatBottomRight: 51.4, LonBottomRight: 7.6}
+
+const boundaryResponse = `{"elements": [{
+	"type": "relation", "id": 1, "tags": {"name": "Dortmund"},
+	"members": [
+		{"type": "way", "role": "outer", "geometry": [{"lat": 51.4, "lon": 7.3}, {"lat": 51.4, "lon": 7.6}]},
+		{"type": "way", "role": "outer", "geometry": [{"lat": 51.4, "lon": 7.3}, {"lat": 51.6, "lon": 7.3}, {"lat": 51.6, "lon": 7.6}]},
+		{"type": "way", "role": "outer", "geometry": [{"lat": 51.6, "lon": 7.6}, {"lat": 51.4, "lon": 7.6}]},
+		{"type": "way", "role": "inner", "geometry": [{"lat": 51.5, "lon": 7.4}, {"lat": 51.5, "lon": 7.5}]}
+	]
+}, {
+	"type": "node", "id": 2, "lat": 51.51, "lon": 7.46, "tags": {"highway": "bus_stop"}
+}]}`
+
+func TestQuery(t *testing.T) {
+	query, err := Query(TransitStops, testBox)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(query, "[out:json]"))
+	assert.Contains(t, query, `node["highway"="bus_stop"](51.400000,7.300000,51.600000,7.600000);`)
+	assert.True(t, strings.HasSuffix(query, "out geom;"))
+
+	_, err = Query(Layer("unknown"), testBox)
+	assert.Error(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Contains(t, r.FormValue("data"), `relation["boundary"="administrative"]`)
+		w.Write([]byte(boundaryResponse))
+	}))
+	defer server.Close()
+
+	layer, err := New(WithURL(server.URL)).Fetch(CityBoundaries, testBox)
+	require.NoError(t, err)
+	require.Len(t, layer.Features, 2)
+	assert.Equal(t, "Dortmund", layer.Features[0].Tags["name"])
+	assert.Len(t, layer.Features[0].Lines, 3)
+	assert.Equal(t, 51.51, layer.Features[1].Location.Latitude)
+
+	boundaries := layer.Boundaries()
+	require.Len(t, boundaries, 1)
+	assert.True(t, boundaries.Contains(sharealyzer.NewGeoLocation(51.5, 7.45)))
+	assert.False(t, boundaries.Contains(sharealyzer.NewGeoLocation(51.7, 7.45)))
+
+	nearest, km := layer.Nearest(sharealyzer.NewGeoLocation(51.511, 7.46))
+	assert.Equal(t, int64(2), nearest.ID)
+	assert.InDelta(t, 0.11, km, 0.01)
+}
+
+func TestFetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer server.Close()
+
+	_, err := New(WithURL(server.URL)).Fetch(BikeLanes, testBox)
+	assert.Error(t, err)
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overpass")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	layer := &ContextLayer{Layer: TransitStops, BoundingBox: testBox, Features: []*Feature{
+		{ID: 2, Type: "node", Location: sharealyzer.NewGeoLocation(51.51, 7.46)},
+	}}
+	require.NoError(t, layer.Save(dir))
+	loaded, err := Load(dir, TransitStops)
+	require.NoError(t, err)
+	assert.Equal(t, testBox, loaded.BoundingBox)
+	require.Len(t, loaded.Features, 1)
+	assert.Equal(t, 7.46, loaded.Features[0].Location.Longitude)
+
+	_, err = Load(dir, BikeLanes)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,235 @@
+// Package pb encodes the core sharealyzer types with the protobuf schema in sharealyzer.proto, so
+// transports and binary archives share one schema with other languages
+package pb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+var (
+	scooterStates = []sharealyzer.ScooterState{"", sharealyzer.IdleRentable, sharealyzer.Broken, sharealyzer.InUse,
+		sharealyzer.Missing}
+	tripTypes = []sharealyzer.TripType{"", sharealyzer.CUSTOMER_TRIP, sharealyzer.CHARGING_TRIP, sharealyzer.RELOCATION_TRIP,
+		sharealyzer.BATTERY_SWAP_TRIP, sharealyzer.OPEN_TRIP, sharealyzer.LOST_TRIP, sharealyzer.RESERVATION}
+)
+
+func scooterStateNumber(state sharealyzer.ScooterState) uint64 {
+	for i, s := range scooterStates {
+		if s == state {
+			return uint64(i)
+		}
+	}
+	return 0
+}
+
+func tripTypeNumber(tripType sharealyzer.TripType) uint64 {
+	for i, t := range tripTypes {
+		if t == tripType {
+			return uint64(i)
+		}
+	}
+	return 0
+}
+
+func marshalLocation(b *buffer, num int, loc *sharealyzer.GeoLocation) {
+	if loc == nil {
+		return
+	}
+	var buf buffer
+	buf.double(1, loc.Latitude)
+	buf.double(2, loc.Longitude)
+	b.bytes(num, buf)
+}
+
+func unmarshalLocation(data []byte) (*sharealyzer.GeoLocation, error) {
+	loc := &sharealyzer.GeoLocation{}
+	err := decode(data, func(f field) error {
+		switch f.num {
+		case 1:
+			loc.Latitude = f.double()
+		case 2:
+			loc.Longitude = f.double()
+		}
+		return nil
+	})
+	return loc, err
+}
+
+// MarshalScooter encodes the scooter as Scooter message
+func MarshalScooter(s *sharealyzer.Scooter) []byte {
+	var b buffer
+	b.string(1, s.ID)
+	b.string(2, s.Provider)
+	b.varint(3, scooterStateNumber(s.State))
+	marshalLocation(&b, 4, s.Location)
+	b.double(5, s.ChargeLevel)
+	b.timestamp(6, s.LastUpdate)
+	b.string(7, s.QRContent)
+	b.string(8, s.StateUpdatedByUserID)
+	b.timestamp(9, s.StateUpdatedAt)
+	b.varint(10, uint64(s.InitPrice))
+	b.varint(11, uint64(s.UnitPrice))
+	return b
+}
+
+// UnmarshalScooter decodes a Scooter message
+func UnmarshalScooter(data []byte) (*sharealyzer.Scooter, error) {
+	s := &sharealyzer.Scooter{}
+	err := decode(data, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			s.ID = string(f.data)
+		case 2:
+			s.Provider = string(f.data)
+		case 3:
+			if f.v < uint64(len(scooterStates)) {
+				s.State = scooterStates[f.v]
+			}
+		case 4:
+			s.Location, err = unmarshalLocation(f.data)
+		case 5:
+			s.ChargeLevel = f.double()
+		case 6:
+			s.LastUpdate, err = f.timestamp()
+		case 7:
+			s.QRContent = string(f.data)
+		case 8:
+			s.StateUpdatedByUserID = string(f.data)
+		case 9:
+			s.StateUpdatedAt, err = f.timestamp()
+		case 10:
+			s.InitPrice = int(int64(f.v))
+		case 11:
+			s.UnitPrice = int(int64(f.v))
+		}
+		return err
+	})
+	return s, err
+}
+
+// MarshalScrapeResult encodes the scrape as ScrapeResult message
+func MarshalScrapeResult(res sharealyzer.ScrapeResult) []byte {
+	var b buffer
+	b.string(1, res.Provider())
+	b.timestamp(2, res.ScrapeDate())
+	for _, s := range res.Scooters() {
+		b.bytes(3, MarshalScooter(s))
+	}
+	return b
+}
+
+// UnmarshalScrapeResult decodes a ScrapeResult message
+func UnmarshalScrapeResult(data []byte) (sharealyzer.ScrapeResult, error) {
+	var (
+		provider   string
+		scrapeDate time.Time
+		scooters   []*sharealyzer.Scooter
+	)
+	err := decode(data, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			provider = string(f.data)
+		case 2:
+			scrapeDate, err = f.timestamp()
+		case 3:
+			var s *sharealyzer.Scooter
+			if s, err = UnmarshalScooter(f.data); err == nil {
+				scooters = append(scooters, s)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sharealyzer.NewScrapeResult(provider, scrapeDate, scooters), nil
+}
+
+// MarshalTrip encodes the trip as Trip message
+func MarshalTrip(t *sharealyzer.Trip) []byte {
+	var b buffer
+	b.string(1, t.ID)
+	b.string(2, t.ScooterID)
+	b.string(3, t.ScooterProvider)
+	b.double(4, t.StartChargeLevel)
+	b.double(5, t.EndChargeLevel)
+	marshalLocation(&b, 6, t.StartLocation)
+	marshalLocation(&b, 7, t.EndLocation)
+	b.string(8, t.UserID)
+	b.duration(9, t.Duration)
+	b.varint(10, t.Cost)
+	b.timestamp(11, t.StartTime)
+	b.timestamp(12, t.EndTime)
+	b.double(13, t.Distance)
+	b.varint(14, tripTypeNumber(t.Type))
+	return b
+}
+
+// UnmarshalTrip decodes a Trip message
+func UnmarshalTrip(data []byte) (*sharealyzer.Trip, error) {
+	t := &sharealyzer.Trip{}
+	err := decode(data, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			t.ID = string(f.data)
+		case 2:
+			t.ScooterID = string(f.data)
+		case 3:
+			t.ScooterProvider = string(f.data)
+		case 4:
+			t.StartChargeLevel = f.double()
+		case 5:
+			t.EndChargeLevel = f.double()
+		case 6:
+			t.StartLocation, err = unmarshalLocation(f.data)
+		case 7:
+			t.EndLocation, err = unmarshalLocation(f.data)
+		case 8:
+			t.UserID = string(f.data)
+		case 9:
+			t.Duration, err = f.duration()
+		case 10:
+			t.Cost = f.v
+		case 11:
+			t.StartTime, err = f.timestamp()
+		case 12:
+			t.EndTime, err = f.timestamp()
+		case 13:
+			t.Distance = f.double()
+		case 14:
+			if f.v < uint64(len(tripTypes)) {
+				t.Type = tripTypes[f.v]
+			}
+		}
+		return err
+	})
+	return t, err
+}
+
+// WriteDelimited writes the message prefixed with its length as varint, the framing used by most
+// protobuf stream APIs like Java's writeDelimitedTo
+func WriteDelimited(w io.Writer, msg []byte) error {
+	if _, err := w.Write(appendVarint(nil, uint64(len(msg)))); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadDelimited reads a message written by WriteDelimited. It returns io.EOF if there are no more messages.
+func ReadDelimited(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	return msg, nil
+}
@@ -0,0 +1,115 @@
+package pb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScooterWireFormat(t *testing.T) {
+	// Encoding as produced by protoc generated code for id "a" and state IN_USE
+	data := MarshalScooter(&sharealyzer.Scooter{ID: "a", State: sharealyzer.InUse})
+	assert.Equal(t, "0a01611803", hex.EncodeToString(data))
+}
+
+func TestScrapeResultRoundTrip(t *testing.T) {
+	date := time.Date(2019, 10, 6, 12, 0, 0, 1234, time.UTC)
+	res := sharealyzer.NewScrapeResult("circ", date, []*sharealyzer.Scooter{
+		{
+			ID:             "scooter-1",
+			Provider:       "circ",
+			State:          sharealyzer.Broken,
+			Location:       sharealyzer.NewGeoLocation(51.96, 7.62),
+			ChargeLevel:    87.5,
+			StateUpdatedAt: date.Add(-time.Hour),
+			InitPrice:      100,
+			UnitPrice:      -1,
+		},
+		{ID: "scooter-2", State: sharealyzer.Missing},
+	})
+
+	decoded, err := UnmarshalScrapeResult(MarshalScrapeResult(res))
+	require.NoError(t, err)
+	assert.Equal(t, "circ", decoded.Provider())
+	assert.True(t, date.Equal(decoded.ScrapeDate()))
+	require.Len(t, decoded.Scooters(), 2)
+	assert.Equal(t, res.Scooters()[0], decoded.Scooters()[0])
+	assert.Equal(t, res.Scooters()[1], decoded.Scooters()[1])
+}
+
+func TestTripRoundTrip(t *testing.T) {
+	start := time.Date(2019, 10, 6, 12, 0, 0, 0, time.UTC)
+	trip := &sharealyzer.Trip{
+		ID:            "trip-1",
+		ScooterID:     "scooter-1",
+		StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+		EndLocation:   sharealyzer.NewGeoLocation(51.97, 7.63),
+		Duration:      90*time.Second + time.Millisecond,
+		Cost:          215,
+		StartTime:     start,
+		EndTime:       start.Add(90 * time.Second),
+		Distance:      1.2,
+		Type:          sharealyzer.RELOCATION_TRIP,
+	}
+	decoded, err := UnmarshalTrip(MarshalTrip(trip))
+	require.NoError(t, err)
+	assert.Equal(t, trip, decoded)
+}
+
+func TestTripTypes(t *testing.T) {
+	proto, err := ioutil.ReadFile("sharealyzer.proto")
+	require.NoError(t, err)
+	enum := regexp.MustCompile(`(?s)enum TripType \{(.*?)\}`).FindSubmatch(proto)
+	require.NotNil(t, enum)
+	values := regexp.MustCompile(`(\w+) = (\d+);`).FindAllSubmatch(enum[1], -1)
+
+	for _, tripType := range []sharealyzer.TripType{sharealyzer.CUSTOMER_TRIP, sharealyzer.CHARGING_TRIP,
+		sharealyzer.RELOCATION_TRIP, sharealyzer.BATTERY_SWAP_TRIP, sharealyzer.OPEN_TRIP, sharealyzer.LOST_TRIP, sharealyzer.RESERVATION} {
+		decoded, err := UnmarshalTrip(MarshalTrip(&sharealyzer.Trip{Type: tripType}))
+		require.NoError(t, err)
+		assert.Equal(t, tripType, decoded.Type)
+
+		// The number matches the enum value of the schema
+		number := tripTypeNumber(tripType)
+		require.True(t, int(number) < len(values), "%s is missing in the schema", tripType)
+		assert.Equal(t, string(tripType), string(values[number][1]))
+		assert.Equal(t, fmt.Sprintf("%d", number), string(values[number][2]))
+	}
+}
+
+func TestDelimited(t *testing.T) {
+	var buf bytes.Buffer
+	for _, id := range []string{"trip-1", "trip-2"} {
+		require.NoError(t, WriteDelimited(&buf, MarshalTrip(&sharealyzer.Trip{ID: id})))
+	}
+
+	r := bufio.NewReader(&buf)
+	var ids []string
+	for {
+		msg, err := ReadDelimited(r)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		trip, err := UnmarshalTrip(msg)
+		require.NoError(t, err)
+		ids = append(ids, trip.ID)
+	}
+	assert.Equal(t, []string{"trip-1", "trip-2"}, ids)
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	data := MarshalTrip(&sharealyzer.Trip{ID: "trip-1"})
+	_, err := UnmarshalTrip(data[:len(data)-2])
+	assert.Equal(t, ErrInvalidMessage, err)
+}
@@ -0,0 +1,164 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Wire types of the protobuf encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ErrInvalidMessage is returned if a message can't be decoded
+var ErrInvalidMessage = errors.New("Invalid protobuf message")
+
+// buffer appends fields to an encoded message. Fields with default values are omitted as in proto3.
+type buffer []byte
+
+func (b *buffer) tag(num int, wireType int) {
+	*b = appendVarint(*b, uint64(num)<<3|uint64(wireType))
+}
+
+func (b *buffer) varint(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(num, wireVarint)
+	*b = appendVarint(*b, v)
+}
+
+func (b *buffer) double(num int, f float64) {
+	if f == 0 {
+		return
+	}
+	b.tag(num, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	*b = append(*b, buf[:]...)
+}
+
+func (b *buffer) bytes(num int, data []byte) {
+	b.tag(num, wireBytes)
+	*b = appendVarint(*b, uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *buffer) string(num int, s string) {
+	if s != "" {
+		b.bytes(num, []byte(s))
+	}
+}
+
+// timestamp encodes t as google.protobuf.Timestamp, the zero time is omitted
+func (b *buffer) timestamp(num int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	var ts buffer
+	ts.varint(1, uint64(t.Unix()))
+	ts.varint(2, uint64(t.Nanosecond()))
+	b.bytes(num, ts)
+}
+
+// duration encodes d as google.protobuf.Duration
+func (b *buffer) duration(num int, d time.Duration) {
+	if d == 0 {
+		return
+	}
+	var buf buffer
+	buf.varint(1, uint64(int64(d/time.Second)))
+	buf.varint(2, uint64(int64(d%time.Second)))
+	b.bytes(num, buf)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// field is a decoded field, v holds varints and fixed values, data the content of length delimited fields
+type field struct {
+	num  int
+	v    uint64
+	data []byte
+}
+
+func (f field) double() float64 {
+	return math.Float64frombits(f.v)
+}
+
+func (f field) timestamp() (time.Time, error) {
+	var seconds, nanos int64
+	err := decode(f.data, func(f field) error {
+		switch f.num {
+		case 1:
+			seconds = int64(f.v)
+		case 2:
+			nanos = int64(f.v)
+		}
+		return nil
+	})
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+func (f field) duration() (time.Duration, error) {
+	var seconds, nanos int64
+	err := decode(f.data, func(f field) error {
+		switch f.num {
+		case 1:
+			seconds = int64(f.v)
+		case 2:
+			nanos = int64(f.v)
+		}
+		return nil
+	})
+	return time.Duration(seconds)*time.Second + time.Duration(nanos), err
+}
+
+// decode calls fn for every field of the message. Groups are not supported.
+func decode(data []byte, fn func(field) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return ErrInvalidMessage
+		}
+		data = data[n:]
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			if f.v, n = binary.Uvarint(data); n <= 0 {
+				return ErrInvalidMessage
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrInvalidMessage
+			}
+			f.v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrInvalidMessage
+			}
+			f.v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return ErrInvalidMessage
+			}
+			f.data, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return ErrInvalidMessage
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Polygon is a simple polygon described by its outer ring. The ring does not need to be closed.
+type Polygon []*GeoLocation
+
+// Contains returns true if loc lies within the polygon. Since the areas we look at are small, latitude
+// and longitude are treated as planar coordinates.
+func (p Polygon) Contains(loc *GeoLocation) bool {
+	if loc == nil || len(p) < 3 {
+		return false
+	}
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+		if (a.Latitude > loc.Latitude) != (b.Latitude > loc.Latitude) &&
+			loc.Longitude < (b.Longitude-a.Longitude)*(loc.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Crosses returns true if the straight line from a to b lies at least partially within the polygon
+func (p Polygon) Crosses(a, b *GeoLocation) bool {
+	if a == nil || b == nil || len(p) < 3 {
+		return false
+	}
+	if p.Contains(a) || p.Contains(b) {
+		return true
+	}
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if segmentsIntersect(a, b, p[j], p[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentsIntersect returns true if the segments ab and cd properly intersect
+func segmentsIntersect(a, b, c, d *GeoLocation) bool {
+	d1, d2 := orientation(c, d, a), orientation(c, d, b)
+	d3, d4 := orientation(a, b, c), orientation(a, b, d)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// orientation returns the sign of the cross product of ab and ac
+func orientation(a, b, c *GeoLocation) float64 {
+	return (b.Longitude-a.Longitude)*(c.Latitude-a.Latitude) - (b.Latitude-a.Latitude)*(c.Longitude-a.Longitude)
+}
+
+// Polygons is a set of polygons, i.e. a city consisting of several disjunct areas
+type Polygons []Polygon
+
+// Contains returns true if loc lies within any of the polygons
+func (p Polygons) Contains(loc *GeoLocation) bool {
+	for _, polygon := range p {
+		if polygon.Contains(loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// Crosses returns true if the straight line from a to b lies at least partially within any of the polygons
+func (p Polygons) Crosses(a, b *GeoLocation) bool {
+	for _, polygon := range p {
+		if polygon.Crosses(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+type geoJSON struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometry    json.RawMessage   `json:"geometry"`
+	Features    []json.RawMessage `json:"features"`
+}
+
+// ParseGeoJSONPolygons reads the outer rings of a GeoJSON Polygon or MultiPolygon, which may be wrapped in
+// a Feature or FeatureCollection. Features with other geometries are ignored.
+func ParseGeoJSONPolygons(data []byte) (Polygons, error) {
+	var geo geoJSON
+	if err := json.Unmarshal(data, &geo); err != nil {
+		return nil, err
+	}
+	var polygons Polygons
+	switch geo.Type {
+	case "Polygon":
+		var rings [][][2]float64
+		if err := json.Unmarshal(geo.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		if len(rings) > 0 {
+			polygons = append(polygons, geoJSONRing(rings[0]))
+		}
+	case "MultiPolygon":
+		var multi [][][][2]float64
+		if err := json.Unmarshal(geo.Coordinates, &multi); err != nil {
+			return nil, err
+		}
+		for _, rings := range multi {
+			if len(rings) > 0 {
+				polygons = append(polygons, geoJSONRing(rings[0]))
+			}
+		}
+	case "Feature":
+		if len(geo.Geometry) == 0 || string(geo.Geometry) == "null" {
+			return nil, nil
+		}
+		return ParseGeoJSONPolygons(geo.Geometry)
+	case "FeatureCollection":
+		for _, feature := range geo.Features {
+			featurePolygons, err := ParseGeoJSONPolygons(feature)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, featurePolygons...)
+		}
+	case "Point", "MultiPoint", "LineString", "MultiLineString", "GeometryCollection":
+	default:
+		return nil, fmt.Errorf("Unknown GeoJSON type %q", geo.Type)
+	}
+	return polygons, nil
+}
+
+// geoJSONRing converts a GeoJSON ring, where coordinates are ordered longitude, latitude
+func geoJSONRing(ring [][2]float64) Polygon {
+	polygon := make(Polygon, len(ring))
+	for i, coord := range ring {
+		polygon[i] = NewGeoLocation(coord[1], coord[0])
+	}
+	return polygon
+}
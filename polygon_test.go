@@ -0,0 +1,51 @@
+package sharealyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGeoJSONPolygons(t *testing.T) {
+	square := `{"type": "Polygon", "coordinates": [[[7.40, 51.50], [7.42, 51.50], [7.42, 51.52], [7.40, 51.52], [7.40, 51.50]]]}`
+	polygons, err := ParseGeoJSONPolygons([]byte(square))
+	require.NoError(t, err)
+	require.Len(t, polygons, 1)
+	assert.Equal(t, NewGeoLocation(51.50, 7.42), polygons[0][1])
+	assert.True(t, polygons.Contains(NewGeoLocation(51.51, 7.41)))
+	assert.False(t, polygons.Contains(NewGeoLocation(51.53, 7.41)))
+
+	collection := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "campus"}, "geometry": ` + square + `},
+		{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [7.41, 51.51]}},
+		{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [
+			[[[7.50, 51.50], [7.52, 51.50], [7.52, 51.52]]],
+			[[[7.60, 51.50], [7.62, 51.50], [7.62, 51.52]]]
+		]}}
+	]}`
+	polygons, err = ParseGeoJSONPolygons([]byte(collection))
+	require.NoError(t, err)
+	assert.Len(t, polygons, 3)
+
+	_, err = ParseGeoJSONPolygons([]byte(`{"type": "Circle"}`))
+	assert.Error(t, err)
+	_, err = ParseGeoJSONPolygons([]byte(`{"type": "Polygon", "coordinates": "broken"}`))
+	assert.Error(t, err)
+}
+
+func TestPolygonsCrosses(t *testing.T) {
+	square := Polygons{{
+		NewGeoLocation(51.50, 7.40),
+		NewGeoLocation(51.50, 7.42),
+		NewGeoLocation(51.52, 7.42),
+		NewGeoLocation(51.52, 7.40),
+	}}
+	// Ends within the square
+	assert.True(t, square.Crosses(NewGeoLocation(51.49, 7.41), NewGeoLocation(51.51, 7.41)))
+	// Passes through the square
+	assert.True(t, square.Crosses(NewGeoLocation(51.51, 7.39), NewGeoLocation(51.51, 7.43)))
+	// Passes by the square
+	assert.False(t, square.Crosses(NewGeoLocation(51.53, 7.39), NewGeoLocation(51.53, 7.43)))
+	assert.False(t, square.Crosses(nil, NewGeoLocation(51.51, 7.41)))
+}
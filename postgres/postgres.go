@@ -0,0 +1,124 @@
+// Package postgres stores trips in a Postgres or TimescaleDB database for the Grafana dashboard. It uses the
+// psql command line tool, which needs to be installed, instead of linking a database driver.
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/grafana"
+	"github.com/pkg/errors"
+)
+
+// DefaultBinary is the name of the psql command line tool looked up in PATH
+const DefaultBinary = "psql"
+
+// DB is a Postgres database
+type DB struct {
+	// URL is the connection string of the database, i.e. postgres://user@localhost/sharealyzer
+	URL string
+	// Binary is the psql command line tool, defaults to DefaultBinary
+	Binary string
+}
+
+// Open returns the database at url. The connection is only made by the first statement.
+func Open(url string) *DB {
+	return &DB{URL: url, Binary: DefaultBinary}
+}
+
+// Exec runs one or more SQL statements in a single transaction
+func (db *DB) Exec(sql string) error {
+	binary := db.Binary
+	if binary == "" {
+		binary = DefaultBinary
+	}
+	// ON_ERROR_STOP makes psql exit with an error at the first failing statement, which rolls back the
+	// transaction of --single-transaction
+	cmd := exec.Command(binary, "--no-psqlrc", "--quiet", "--single-transaction", "--set", "ON_ERROR_STOP=1",
+		"--dbname", db.URL)
+	cmd.Stdin = strings.NewReader(sql)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "psql failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Provision creates the trips table if it doesn't exist and the aggregate views of the Grafana dashboard
+func Provision(db *DB) error {
+	return errors.Wrap(db.Exec(grafana.Views), "Failed to provision the database")
+}
+
+// Sink is a sharealyzer.TripSink inserting the trips into the trips table. Trips which are already stored are
+// skipped, so batches may be delivered again.
+type Sink struct {
+	DB *DB
+}
+
+// StoreTrips inserts all trips of the batch with a single statement
+func (s *Sink) StoreTrips(trips []*sharealyzer.Trip) error {
+	if len(trips) == 0 {
+		return nil
+	}
+	return s.DB.Exec(InsertTrips(trips))
+}
+
+// InsertTrips returns the statement inserting the trips into the trips table
+func InsertTrips(trips []*sharealyzer.Trip) string {
+	var sql strings.Builder
+	sql.WriteString(`INSERT INTO trips (id, scooter_id, provider, start_charge_level, end_charge_level,
+  start_latitude, start_longitude, end_latitude, end_longitude, user_id, duration, cost, start_time, end_time,
+  distance, type) VALUES
+`)
+	for i, trip := range trips {
+		if i > 0 {
+			sql.WriteString(",\n")
+		}
+		id := trip.ID
+		if id == "" {
+			id = sharealyzer.TripID(trip.ScooterProvider, trip.ScooterID, trip.StartTime)
+		}
+		startLat, startLon := location(trip.StartLocation)
+		endLat, endLon := location(trip.EndLocation)
+		fmt.Fprintf(&sql, "  (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %d, %s, %s, %s, %s)",
+			quote(id), quote(trip.ScooterID), quote(trip.ScooterProvider),
+			number(trip.StartChargeLevel), number(trip.EndChargeLevel), startLat, startLon, endLat, endLon,
+			quote(trip.UserID), quote(fmt.Sprintf("%d microseconds", trip.Duration/time.Microsecond))+"::INTERVAL", trip.Cost,
+			timestamp(trip.StartTime), timestamp(trip.EndTime), number(trip.Distance), quote(string(trip.Type)))
+	}
+	sql.WriteString("\nON CONFLICT DO NOTHING;\n")
+	return sql.String()
+}
+
+// quote quotes s as SQL string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// number formats f as SQL number literal, NaN and infinities are unknown values
+func number(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "NULL"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// timestamp formats t as SQL timestamp with time zone literal
+func timestamp(t time.Time) string {
+	return quote(t.Format(time.RFC3339Nano)) + "::TIMESTAMPTZ"
+}
+
+// location returns the latitude and longitude of loc as SQL literals, which are NULL without location
+func location(loc *sharealyzer.GeoLocation) (string, string) {
+	if loc == nil {
+		return "NULL", "NULL"
+	}
+	return number(loc.Latitude), number(loc.Longitude)
+}
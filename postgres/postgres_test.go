@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/dereulenspiegel/sharealyzer/grafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePsql creates a script which records its arguments and stdin and exits with the given status
+func fakePsql(t *testing.T, dir string, status int) string {
+	path := filepath.Join(dir, "psql")
+	script := "#!/bin/sh\necho \"$@\" > " + dir + "/args\ncat >> " + dir + "/stdin\necho 'ERROR: failed' >&2\nexit " +
+		strconv.Itoa(status) + "\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0700))
+	return path
+}
+
+func TestSink(t *testing.T) {
+	dir := t.TempDir()
+	db := &DB{URL: "postgres://localhost/sharealyzer", Binary: fakePsql(t, dir, 0)}
+	require.NoError(t, Provision(db))
+	sink := &Sink{DB: db}
+	// Empty batches don't run psql
+	require.NoError(t, sink.StoreTrips(nil))
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	require.NoError(t, sink.StoreTrips([]*sharealyzer.Trip{
+		{ID: "trip-1", ScooterID: "a", ScooterProvider: "circ", StartLocation: sharealyzer.NewGeoLocation(51.96, 7.62),
+			UserID: "O'Brien", Duration: 90 * time.Second, Cost: 215, StartTime: start, EndTime: start.Add(90 * time.Second),
+			Distance: 1.2, Type: sharealyzer.CUSTOMER_TRIP},
+		{ScooterID: "b", ScooterProvider: "circ", StartTime: start, EndTime: start, Type: sharealyzer.LOST_TRIP},
+	}))
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.Equal(t, "--no-psqlrc --quiet --single-transaction --set ON_ERROR_STOP=1 --dbname postgres://localhost/sharealyzer\n",
+		string(args))
+	sql, err := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	require.NoError(t, err)
+	assert.Equal(t, grafana.Views, string(sql[:len(grafana.Views)]))
+	assert.Contains(t, string(sql), "\n  ('trip-1', 'a', 'circ', 0, 0, 51.96, 7.62, NULL, NULL, 'O''Brien', "+
+		"'90000000 microseconds'::INTERVAL, 215, '2019-10-06T08:00:00Z'::TIMESTAMPTZ, '2019-10-06T08:01:30Z'::TIMESTAMPTZ, "+
+		"1.2, 'CUSTOMER_TRIP'),\n")
+	// Trips without identifier get the deterministic one
+	assert.Contains(t, string(sql), "\n  ('"+sharealyzer.TripID("circ", "b", start)+"', 'b', ")
+	assert.Contains(t, string(sql), "ON CONFLICT DO NOTHING;")
+}
+
+func TestExecFailure(t *testing.T) {
+	dir := t.TempDir()
+	db := &DB{URL: "postgres://localhost/sharealyzer", Binary: fakePsql(t, dir, 3)}
+	err := (&Sink{DB: db}).StoreTrips([]*sharealyzer.Trip{{ID: "trip-1"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ERROR: failed")
+
+	db.Binary = filepath.Join(dir, "missing")
+	assert.Error(t, Provision(db))
+}
@@ -0,0 +1,32 @@
+package sharealyzer
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// ProfilingHandler serves the pprof endpoints below /debug/pprof/
+func ProfilingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// ServeProfiling serves the pprof endpoints on addr in the background. Profiling is disabled if addr is
+// empty. Since profiles reveal internals, addr should only be reachable locally.
+func ServeProfiling(addr string) {
+	if addr == "" {
+		return
+	}
+	log.Printf("Serving profiling endpoints on http://%s/debug/pprof/", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, ProfilingHandler()); err != nil {
+			log.Printf("[WARNING] Failed to serve profiling endpoints: %s", err)
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+// Package providertest provides a fake provider API server based on httptest, which lets tests register
+// handlers for the provider endpoints and inject errors like rate limits or server failures
+package providertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Failure describes an error response the server sends instead of calling the registered handler
+type Failure struct {
+	// Path restricts the failure to requests for this path, leave empty to fail the next request to any path
+	Path   string
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// Server is a fake provider API server
+type Server struct {
+	*httptest.Server
+
+	mux      *http.ServeMux
+	lock     sync.Mutex
+	failures []Failure
+	requests map[string]int
+}
+
+// NewServer creates and starts a new server. Close it after use.
+func NewServer() *Server {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Handle registers the handler for the given pattern as in http.ServeMux
+func (s *Server) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// InjectFailure makes the server respond to the next matching request with the failure. Several failures
+// are used in the order they were injected.
+func (s *Server) InjectFailure(failure Failure) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = append(s.failures, failure)
+}
+
+// RateLimit makes the server respond to the next request for path with status 429 and the given Retry-After
+func (s *Server) RateLimit(path string, retryAfter time.Duration) {
+	header := make(http.Header)
+	header.Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	s.InjectFailure(Failure{Path: path, Status: http.StatusTooManyRequests, Header: header})
+}
+
+// Requests returns how many requests for path the server received
+func (s *Server) Requests(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[path]
+}
+
+// nextFailure removes and returns the first failure matching path
+func (s *Server) nextFailure(path string) (Failure, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests[path]++
+	for i, failure := range s.failures {
+		if failure.Path == "" || failure.Path == path {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return failure, true
+		}
+	}
+	return Failure{}, false
+}
+
+// ServeHTTP serves injected failures or passes the request to the registered handlers
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if failure, exists := s.nextFailure(r.URL.Path); exists {
+		for name, values := range failure.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(failure.Status)
+		w.Write([]byte(failure.Body))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// WriteJSON writes v as JSON response with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
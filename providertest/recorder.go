@@ -0,0 +1,232 @@
+package providertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode determines whether a Recorder records real responses or replays recorded ones
+type Mode int
+
+const (
+	// ModeReplay serves responses from the fixture file and never contacts the real API
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real API and records the sanitized interactions
+	ModeRecord
+)
+
+var (
+	// SensitiveHeaders are removed from recorded interactions by DefaultSanitizer
+	SensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Vault-Token"}
+	// SensitiveFields are JSON object fields whose values are redacted by DefaultSanitizer
+	SensitiveFields = []string{"accessToken", "refreshToken", "token", "phoneNumber", "phoneMobile", "email",
+		"firstName", "lastName", "birthday"}
+)
+
+// Redacted replaces sensitive values in recorded interactions
+const Redacted = "REDACTED"
+
+// RecordedRequest is the part of a request stored in a fixture
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the part of a response stored in a fixture
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Interaction is a request with its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Recorder is a http.RoundTripper which records interactions with a real API to a fixture file
+// or replays them from it. Call Save after recording to write the fixture.
+type Recorder struct {
+	Mode      Mode
+	Path      string
+	Transport http.RoundTripper
+	// Sanitize is applied to every recorded interaction, DefaultSanitizer is used if it is nil
+	Sanitize func(*Interaction)
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	replayed     map[int]bool
+}
+
+// NewRecorder creates a Recorder. In replay mode the fixture at path is loaded immediately.
+func NewRecorder(mode Mode, path string) (*Recorder, error) {
+	r := &Recorder{
+		Mode:      mode,
+		Path:      path,
+		Transport: http.DefaultTransport,
+		replayed:  make(map[int]bool),
+	}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("Invalid fixture %s: %s", path, err)
+		}
+	}
+	return r, nil
+}
+
+// Client returns a http client using the recorder as transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip records or replays the request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.Mode == ModeReplay {
+		return r.replay(req)
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Body:   string(body),
+		},
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: resp.Header.Clone(),
+			Body:   string(respBody),
+		},
+	}
+	sanitize := r.Sanitize
+	if sanitize == nil {
+		sanitize = DefaultSanitizer
+	}
+	sanitize(interaction)
+	r.lock.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.lock.Unlock()
+	return resp, nil
+}
+
+// replay returns the first not yet replayed interaction with the same method and URL
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || interaction.Request.Method != req.Method || interaction.Request.URL != req.URL.String() {
+			continue
+		}
+		r.replayed[i] = true
+		header := interaction.Response.Header
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("No recorded interaction for %s %s in %s", req.Method, req.URL, r.Path)
+}
+
+// Save writes the recorded interactions to the fixture file
+func (r *Recorder) Save() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, data, os.FileMode(0644))
+}
+
+// DefaultSanitizer removes SensitiveHeaders and redacts SensitiveFields in JSON bodies
+func DefaultSanitizer(interaction *Interaction) {
+	for _, name := range SensitiveHeaders {
+		interaction.Request.Header.Del(name)
+		interaction.Response.Header.Del(name)
+	}
+	interaction.Request.Body = redactJSON(interaction.Request.Body)
+	interaction.Response.Body = redactJSON(interaction.Response.Body)
+}
+
+// redactJSON redacts SensitiveFields in body if it is JSON and returns it unchanged otherwise
+func redactJSON(body string) string {
+	var value interface{}
+	if body == "" || json.Unmarshal([]byte(body), &value) != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return body
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitiveField(key) && field != nil {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+func isSensitiveField(name string) bool {
+	for _, field := range SensitiveFields {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
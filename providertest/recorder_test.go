@@ -0,0 +1,56 @@
+package providertest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.Handle("/login", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"accessToken": "secret-token",
+			"profile":     map[string]string{"phoneMobile": "+491701234567", "language": "de"},
+		})
+	})
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "login.json")
+
+	recorder, err := NewRecorder(ModeRecord, fixture)
+	require.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/login", strings.NewReader(`{"token":"1234"}`))
+	req.Header.Set("Authorization", "secret-token")
+	resp, err := recorder.Client().Do(req)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "secret-token")
+	require.NoError(t, recorder.Save())
+
+	data, err := ioutil.ReadFile(fixture)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-token")
+	assert.NotContains(t, string(data), "1701234567")
+	assert.NotContains(t, string(data), "1234")
+
+	replayer, err := NewRecorder(ModeReplay, fixture)
+	require.NoError(t, err)
+	resp, err = replayer.Client().Post(server.URL+"/login", "application/json", nil)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"language":"de"`)
+	assert.Contains(t, string(body), Redacted)
+
+	_, err = replayer.Client().Post(server.URL+"/login", "application/json", nil)
+	assert.Error(t, err)
+}
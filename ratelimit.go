@@ -0,0 +1,58 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRetryAfter is used as back off if a provider signals a rate limit without a usable Retry-After header
+var DefaultRetryAfter = time.Minute * 1
+
+// RateLimitError is returned by provider clients if the API signals that we are sending too many requests
+type RateLimitError struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (r *RateLimitError) Error() string {
+	return fmt.Sprintf("Rate limited with status %d, retry after %s", r.Status, r.RetryAfter)
+}
+
+// IsRateLimit returns the RateLimitError if err is one
+func IsRateLimit(err error) (*RateLimitError, bool) {
+	rateErr, ok := err.(*RateLimitError)
+	return rateErr, ok
+}
+
+// CheckRateLimit returns a RateLimitError if the response signals a rate limit, i.e. status 429 or
+// status 503 with a Retry-After header
+func CheckRateLimit(resp *http.Response) error {
+	retryAfter := resp.Header.Get("Retry-After")
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		!(resp.StatusCode == http.StatusServiceUnavailable && retryAfter != "") {
+		return nil
+	}
+	return &RateLimitError{
+		Status:     resp.StatusCode,
+		RetryAfter: ParseRetryAfter(retryAfter, time.Now()),
+	}
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or a HTTP date.
+// DefaultRetryAfter is returned if the value can't be parsed.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return DefaultRetryAfter
+}
@@ -0,0 +1,63 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// CorridorDirection are the customer trips from one area to another
+type CorridorDirection struct {
+	Trips        []*sharealyzer.Trip `json:"trips"`
+	TripsPerHour [24]int             `json:"trips_per_hour"`
+	Distance     Summary             `json:"distance"`
+	Duration     Summary             `json:"duration"` // Duration in minutes
+}
+
+// Corridor are the customer trips between two areas in both directions, i.e. between a campus and a
+// train station
+type Corridor struct {
+	// Forward are the trips from the first to the second area, Backward the trips the other way
+	Forward  CorridorDirection `json:"forward"`
+	Backward CorridorDirection `json:"backward"`
+}
+
+// ComputeCorridor finds the customer trips which started in one of the areas and ended in the other. Hours
+// of the day are in the time zone loc, trips of a direction are ordered by their start time.
+func ComputeCorridor(trips []*sharealyzer.Trip, from, to sharealyzer.Polygons, loc *time.Location) *Corridor {
+	var forward, backward []*sharealyzer.Trip
+	for _, trip := range trips {
+		if trip.Type != sharealyzer.CUSTOMER_TRIP {
+			continue
+		}
+		switch {
+		case from.Contains(trip.StartLocation) && to.Contains(trip.EndLocation):
+			forward = append(forward, trip)
+		case to.Contains(trip.StartLocation) && from.Contains(trip.EndLocation):
+			backward = append(backward, trip)
+		}
+	}
+	return &Corridor{
+		Forward:  corridorDirection(forward, loc),
+		Backward: corridorDirection(backward, loc),
+	}
+}
+
+func corridorDirection(trips []*sharealyzer.Trip, loc *time.Location) CorridorDirection {
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].StartTime.Before(trips[j].StartTime)
+	})
+	d := CorridorDirection{Trips: trips}
+	var distances, durations []float64
+	for _, trip := range trips {
+		d.TripsPerHour[trip.StartTime.In(loc).Hour()]++
+		if !trip.StaleLocation {
+			distances = append(distances, trip.Distance)
+		}
+		durations = append(durations, trip.Duration.Minutes())
+	}
+	d.Distance = NewSummary(distances)
+	d.Duration = NewSummary(durations)
+	return d
+}
@@ -0,0 +1,58 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func square(lat, lon float64) sharealyzer.Polygons {
+	return sharealyzer.Polygons{{
+		sharealyzer.NewGeoLocation(lat, lon),
+		sharealyzer.NewGeoLocation(lat, lon+0.01),
+		sharealyzer.NewGeoLocation(lat+0.01, lon+0.01),
+		sharealyzer.NewGeoLocation(lat+0.01, lon),
+	}}
+}
+
+func TestComputeCorridor(t *testing.T) {
+	campus, station := square(51.50, 7.40), square(51.52, 7.45)
+	start := time.Date(2019, 10, 7, 0, 0, 0, 0, time.UTC)
+	trip := func(id string, hour int, startLat, startLon, endLat, endLon float64) *sharealyzer.Trip {
+		return &sharealyzer.Trip{
+			ID:            id,
+			Type:          sharealyzer.CUSTOMER_TRIP,
+			StartTime:     start.Add(time.Duration(hour) * time.Hour),
+			StartLocation: sharealyzer.NewGeoLocation(startLat, startLon),
+			EndLocation:   sharealyzer.NewGeoLocation(endLat, endLon),
+			Duration:      10 * time.Minute,
+			Distance:      3.5,
+		}
+	}
+	relocation := trip("relocation", 3, 51.505, 7.405, 51.525, 7.455)
+	relocation.Type = sharealyzer.RELOCATION_TRIP
+	trips := []*sharealyzer.Trip{
+		trip("late", 16, 51.505, 7.405, 51.525, 7.455),
+		trip("early", 7, 51.505, 7.405, 51.525, 7.455),
+		trip("back", 17, 51.525, 7.455, 51.505, 7.405),
+		trip("elsewhere", 8, 51.505, 7.405, 51.60, 7.60),
+		trip("within", 9, 51.505, 7.405, 51.506, 7.406),
+		relocation,
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	corridor := ComputeCorridor(trips, campus, station, berlin)
+	require.Len(t, corridor.Forward.Trips, 2)
+	assert.Equal(t, "early", corridor.Forward.Trips[0].ID)
+	assert.Equal(t, "late", corridor.Forward.Trips[1].ID)
+	assert.Equal(t, 1, corridor.Forward.TripsPerHour[9])
+	assert.Equal(t, 1, corridor.Forward.TripsPerHour[18])
+	assert.Equal(t, 3.5, corridor.Forward.Distance.P50)
+	require.Len(t, corridor.Backward.Trips, 1)
+	assert.Equal(t, "back", corridor.Backward.Trips[0].ID)
+	assert.Equal(t, 10.0, corridor.Backward.Duration.Average)
+}
@@ -0,0 +1,139 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// DemandCell is the demand for scooters in a zone in an hour of the day
+type DemandCell struct {
+	Zone string `json:"zone"`
+	Hour int    `json:"hour"`
+	// Trips is the number of customer trips started in the zone in this hour
+	Trips int `json:"trips"`
+	// ScooterHours is the time available scooters stood in the zone in this hour, summed over all scooters
+	ScooterHours float64 `json:"scooter_hours"`
+	// TripsPerScooterHour are the trips normalized by the supply, nil if there was no supply at all. Zones
+	// without supply have no trips, but not necessarily no demand.
+	TripsPerScooterHour *float64 `json:"trips_per_scooter_hour"`
+}
+
+type demandKey struct {
+	zone string
+	hour int
+}
+
+// DemandEstimator counts customer trips per zone and hour of the day and the supply of available scooters
+// they started from
+type DemandEstimator struct {
+	// Location is the time zone of the hours of the day
+	Location *time.Location
+	// MaxInterval is the longest time a scrape result accounts for, so outages don't count as supply.
+	// Defaults to sharealyzer.DefaultMaxScrapeGap.
+	MaxInterval time.Duration
+
+	trips        map[demandKey]int
+	scooterHours map[demandKey]float64
+	lastDate     time.Time
+	lastCounts   map[string]int
+}
+
+// NewDemandEstimator creates a DemandEstimator with hours of the day in loc
+func NewDemandEstimator(loc *time.Location) *DemandEstimator {
+	return &DemandEstimator{
+		Location:     loc,
+		MaxInterval:  sharealyzer.DefaultMaxScrapeGap,
+		trips:        make(map[demandKey]int),
+		scooterHours: make(map[demandKey]float64),
+	}
+}
+
+// Observe adds the supply of a scrape result. Every result accounts for the time until the next one, results
+// out of order don't add supply.
+func (d *DemandEstimator) Observe(res sharealyzer.ScrapeResult) {
+	if interval := res.ScrapeDate().Sub(d.lastDate); d.lastCounts != nil && interval > 0 {
+		if interval > d.MaxInterval {
+			interval = d.MaxInterval
+		}
+		hour := d.lastDate.In(d.Location).Hour()
+		for zone, count := range d.lastCounts {
+			d.scooterHours[demandKey{zone: zone, hour: hour}] += float64(count) * interval.Hours()
+		}
+	}
+	counts := make(map[string]int)
+	for _, scooter := range res.Scooters() {
+		if scooter.State != sharealyzer.Broken && scooter.State != sharealyzer.InUse && scooter.State != sharealyzer.Missing {
+			counts[scooter.Zone]++
+		}
+	}
+	d.lastDate, d.lastCounts = res.ScrapeDate(), counts
+}
+
+// AddTrip counts the trip if it is a customer trip
+func (d *DemandEstimator) AddTrip(trip *sharealyzer.Trip) {
+	if trip.Type == sharealyzer.CUSTOMER_TRIP {
+		d.trips[demandKey{zone: trip.Zone, hour: trip.StartTime.In(d.Location).Hour()}]++
+	}
+}
+
+// Demand returns the raw and normalized demand of all zones and hours with supply or trips ordered by zone
+// and hour
+func (d *DemandEstimator) Demand() []DemandCell {
+	keys := make(map[demandKey]bool)
+	for key := range d.trips {
+		keys[key] = true
+	}
+	for key := range d.scooterHours {
+		keys[key] = true
+	}
+	cells := make([]DemandCell, 0, len(keys))
+	for key := range keys {
+		cell := DemandCell{Zone: key.zone, Hour: key.hour, Trips: d.trips[key], ScooterHours: d.scooterHours[key]}
+		if cell.ScooterHours > 0 {
+			normalized := float64(cell.Trips) / cell.ScooterHours
+			cell.TripsPerScooterHour = &normalized
+		}
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Zone != cells[j].Zone {
+			return cells[i].Zone < cells[j].Zone
+		}
+		return cells[i].Hour < cells[j].Hour
+	})
+	return cells
+}
+
+// DemandHeader are the CSV columns written by WriteDemandCSV
+var DemandHeader = []string{"zone", "hour", "trips", "scooter_hours", "trips_per_scooter_hour"}
+
+// WriteDemandCSV writes the demand cells as CSV. The normalized demand of cells without supply is empty.
+func WriteDemandCSV(w io.Writer, cells []DemandCell) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(DemandHeader); err != nil {
+		return err
+	}
+	for _, cell := range cells {
+		normalized := ""
+		if cell.TripsPerScooterHour != nil {
+			normalized = strconv.FormatFloat(*cell.TripsPerScooterHour, 'f', 4, 64)
+		}
+		err := out.Write([]string{
+			cell.Zone,
+			strconv.Itoa(cell.Hour),
+			strconv.Itoa(cell.Trips),
+			strconv.FormatFloat(cell.ScooterHours, 'f', 2, 64),
+			normalized,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemandEstimator(t *testing.T) {
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	center := func(id string) *sharealyzer.Scooter {
+		return &sharealyzer.Scooter{ID: id, Zone: "center"}
+	}
+	broken := &sharealyzer.Scooter{ID: "c", Zone: "center", State: sharealyzer.Broken}
+	demand := NewDemandEstimator(time.UTC)
+	// Two scooters stand in the center for an hour, then the scraper is down for two hours
+	for i, snapshot := range [][]*sharealyzer.Scooter{{center("a"), center("b"), broken}, {center("a"), center("b")}, {center("a")}} {
+		demand.Observe(sharealyzer.NewScrapeResult("circ", start.Add(time.Duration(i)*30*time.Minute), snapshot))
+	}
+	demand.Observe(sharealyzer.NewScrapeResult("circ", start.Add(3*time.Hour), nil))
+	trip := func(zone string, hour int, tripType sharealyzer.TripType) *sharealyzer.Trip {
+		return &sharealyzer.Trip{Zone: zone, Type: tripType, StartTime: start.Add(time.Duration(hour) * time.Hour)}
+	}
+	for _, t := range []*sharealyzer.Trip{
+		trip("center", 0, sharealyzer.CUSTOMER_TRIP),
+		trip("center", 0, sharealyzer.CUSTOMER_TRIP),
+		trip("center", 0, sharealyzer.CHARGING_TRIP),
+		trip("north", 2, sharealyzer.CUSTOMER_TRIP),
+	} {
+		demand.AddTrip(t)
+	}
+
+	cells := demand.Demand()
+	require.Len(t, cells, 3)
+	assert.Equal(t, "center", cells[0].Zone)
+	assert.Equal(t, 8, cells[0].Hour)
+	assert.Equal(t, 2, cells[0].Trips)
+	assert.Equal(t, 2.0, cells[0].ScooterHours)
+	require.NotNil(t, cells[0].TripsPerScooterHour)
+	assert.Equal(t, 1.0, *cells[0].TripsPerScooterHour)
+	// The outage only counts up to the maximum interval
+	assert.Equal(t, 9, cells[1].Hour)
+	assert.Equal(t, 0.5, cells[1].ScooterHours)
+	// Trips without supply have no normalized demand
+	assert.Equal(t, DemandCell{Zone: "north", Hour: 10, Trips: 1}, cells[2])
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDemandCSV(&buf, cells))
+	assert.Equal(t, "zone,hour,trips,scooter_hours,trips_per_scooter_hour\ncenter,8,2,2.00,1.0000\ncenter,9,0,0.50,0.0000\nnorth,10,1,0.00,\n", buf.String())
+}
@@ -0,0 +1,122 @@
+package report
+
+import (
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// EnergyAssumptions are the figures the energy and CO2 estimate is based on. They differ between providers,
+// scooter models and countries, so they are configurable.
+type EnergyAssumptions struct {
+	// BatteryCapacity is the energy of a full battery in kWh
+	BatteryCapacity float64 `json:"battery_capacity"`
+	// ChargingEfficiency is the share of the energy drawn from the grid which ends up in the battery
+	ChargingEfficiency float64 `json:"charging_efficiency"`
+	// GridIntensity are the grams of CO2 equivalents emitted per kWh drawn from the grid
+	GridIntensity float64 `json:"grid_intensity"`
+	// VanEmissions are the grams of CO2 equivalents a collection van emits per km
+	VanEmissions float64 `json:"van_emissions"`
+	// VanDistanceFactor is the distance a van drives per km a scooter is moved, i.e. 2 if it drives back
+	// empty
+	VanDistanceFactor float64 `json:"van_distance_factor"`
+	// ScootersPerVan is the number of scooters collected or relocated in one run, which share its distance
+	ScootersPerVan float64 `json:"scooters_per_van"`
+	// SwapVanDistance is the distance in km a van drives per battery swap
+	SwapVanDistance float64 `json:"swap_van_distance"`
+}
+
+// DefaultEnergyAssumptions returns assumptions for typical shared scooters and a diesel van in Germany
+func DefaultEnergyAssumptions() EnergyAssumptions {
+	return EnergyAssumptions{
+		BatteryCapacity:    0.5,
+		ChargingEfficiency: 0.85,
+		GridIntensity:      400,
+		VanEmissions:       250,
+		VanDistanceFactor:  2,
+		ScootersPerVan:     10,
+		SwapVanDistance:    0.5,
+	}
+}
+
+// EnergyReport estimates the energy consumed and the CO2 equivalents emitted by a fleet in a period
+type EnergyReport struct {
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Assumptions EnergyAssumptions `json:"assumptions"`
+	// RideEnergy is the energy in kWh customers drew from the batteries
+	RideEnergy float64 `json:"ride_energy"`
+	// RideDistance is the distance of all customer trips with known distance in km
+	RideDistance float64 `json:"ride_distance"`
+	// ChargedEnergy is the energy in kWh charged into the batteries by charging trips and battery swaps
+	ChargedEnergy float64 `json:"charged_energy"`
+	// GridEnergy is the energy in kWh drawn from the grid to charge the batteries
+	GridEnergy float64 `json:"grid_energy"`
+	// VanDistance is the estimated distance in km vans drove for charging, battery swaps and relocations
+	VanDistance float64 `json:"van_distance"`
+	// ChargingCO2 and VanCO2 are the emissions of charging and the logistics in kg CO2 equivalents
+	ChargingCO2 float64 `json:"charging_co2"`
+	VanCO2      float64 `json:"van_co2"`
+}
+
+// TotalCO2 returns the emissions of charging and logistics in kg CO2 equivalents
+func (r *EnergyReport) TotalCO2() float64 {
+	return r.ChargingCO2 + r.VanCO2
+}
+
+// CO2PerKm returns the emissions in grams CO2 equivalents per km ridden by customers, 0 without rides
+func (r *EnergyReport) CO2PerKm() float64 {
+	if r.RideDistance == 0 {
+		return 0
+	}
+	return r.TotalCO2() * 1000 / r.RideDistance
+}
+
+// ComputeEnergy estimates the energy and emissions of the trips which started between from and to.
+// Charging and relocation trips with stale locations are assumed to be as long as the average of these trips
+// with known distance.
+func ComputeEnergy(trips []*sharealyzer.Trip, from, to time.Time, assumptions EnergyAssumptions) *EnergyReport {
+	r := &EnergyReport{From: from, To: to, Assumptions: assumptions}
+	var vanTrips, unknownVanTrips int
+	var movedDistance float64
+	for _, trip := range trips {
+		if trip.StartTime.Before(from) || !trip.StartTime.Before(to) {
+			continue
+		}
+		chargeChange := (trip.EndChargeLevel - trip.StartChargeLevel) / 100 * assumptions.BatteryCapacity
+		switch trip.Type {
+		case sharealyzer.CUSTOMER_TRIP:
+			if chargeChange < 0 {
+				r.RideEnergy -= chargeChange
+			}
+			if !trip.StaleLocation {
+				r.RideDistance += trip.Distance
+			}
+		case sharealyzer.BATTERY_SWAP_TRIP:
+			r.ChargedEnergy += chargeChange
+			r.VanDistance += assumptions.SwapVanDistance
+		case sharealyzer.CHARGING_TRIP, sharealyzer.RELOCATION_TRIP:
+			if chargeChange > 0 {
+				r.ChargedEnergy += chargeChange
+			}
+			if trip.StaleLocation {
+				unknownVanTrips++
+			} else {
+				vanTrips++
+				movedDistance += trip.Distance
+			}
+		}
+	}
+	if vanTrips > 0 {
+		movedDistance += float64(unknownVanTrips) * movedDistance / float64(vanTrips)
+	}
+	if assumptions.ScootersPerVan > 0 {
+		r.VanDistance += movedDistance * assumptions.VanDistanceFactor / assumptions.ScootersPerVan
+	}
+	if assumptions.ChargingEfficiency > 0 {
+		r.GridEnergy = r.ChargedEnergy / assumptions.ChargingEfficiency
+	}
+	r.ChargingCO2 = r.GridEnergy * assumptions.GridIntensity / 1000
+	r.VanCO2 = r.VanDistance * assumptions.VanEmissions / 1000
+	return r
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeEnergy(t *testing.T) {
+	start := time.Date(2019, 10, 7, 0, 0, 0, 0, time.UTC)
+	trip := func(tripType sharealyzer.TripType, startCharge, endCharge, distance float64) *sharealyzer.Trip {
+		return &sharealyzer.Trip{Type: tripType, StartTime: start.Add(time.Hour), StartChargeLevel: startCharge,
+			EndChargeLevel: endCharge, Distance: distance}
+	}
+	staleCharging := trip(sharealyzer.CHARGING_TRIP, 10, 90, 0)
+	staleCharging.StaleLocation = true
+	outside := trip(sharealyzer.CHARGING_TRIP, 0, 100, 100)
+	outside.StartTime = start.Add(48 * time.Hour)
+	trips := []*sharealyzer.Trip{
+		trip(sharealyzer.CUSTOMER_TRIP, 80, 60, 3),
+		trip(sharealyzer.CUSTOMER_TRIP, 60, 40, 2),
+		trip(sharealyzer.CHARGING_TRIP, 20, 100, 4),
+		staleCharging,
+		trip(sharealyzer.BATTERY_SWAP_TRIP, 5, 100, 0),
+		trip(sharealyzer.RELOCATION_TRIP, 50, 50, 6),
+		outside,
+	}
+	assumptions := EnergyAssumptions{
+		BatteryCapacity:    0.5,
+		ChargingEfficiency: 0.8,
+		GridIntensity:      400,
+		VanEmissions:       200,
+		VanDistanceFactor:  2,
+		ScootersPerVan:     5,
+		SwapVanDistance:    1,
+	}
+	r := ComputeEnergy(trips, start, start.Add(24*time.Hour), assumptions)
+	assert.InDelta(t, 0.2, r.RideEnergy, 1e-9)
+	assert.InDelta(t, 5, r.RideDistance, 1e-9)
+	// (80 + 80 + 95)% of 0.5 kWh
+	assert.InDelta(t, 1.275, r.ChargedEnergy, 1e-9)
+	assert.InDelta(t, 1.59375, r.GridEnergy, 1e-9)
+	// The stale charging trip is assumed to be 5km like the average, 15km moved in vans of 5 scooters
+	// which drive back, plus the battery swap
+	assert.InDelta(t, 7, r.VanDistance, 1e-9)
+	assert.InDelta(t, 0.6375, r.ChargingCO2, 1e-9)
+	assert.InDelta(t, 1.4, r.VanCO2, 1e-9)
+	assert.InDelta(t, 2.0375, r.TotalCO2(), 1e-9)
+	assert.InDelta(t, 407.5, r.CO2PerKm(), 1e-9)
+}
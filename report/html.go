@@ -0,0 +1,131 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"math"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const (
+	mapWidth  = 800.0
+	mapHeight = 600.0
+)
+
+type mapLine struct {
+	X1, Y1, X2, Y2 float64
+}
+
+// mapLines projects all customer trips into the map's SVG coordinate system. Since the covered area is
+// small an equirectangular projection is good enough.
+func (s *Stats) mapLines() []mapLine {
+	minLat, minLon := math.MaxFloat64, math.MaxFloat64
+	maxLat, maxLon := -math.MaxFloat64, -math.MaxFloat64
+	for _, trip := range s.customerTrips {
+		for _, l := range []*sharealyzer.GeoLocation{trip.StartLocation, trip.EndLocation} {
+			minLat, maxLat = math.Min(minLat, l.Latitude), math.Max(maxLat, l.Latitude)
+			minLon, maxLon = math.Min(minLon, l.Longitude), math.Max(maxLon, l.Longitude)
+		}
+	}
+	latRange, lonRange := maxLat-minLat, maxLon-minLon
+	if latRange <= 0 || lonRange <= 0 {
+		return nil
+	}
+	x := func(lon float64) float64 { return (lon - minLon) / lonRange * mapWidth }
+	y := func(lat float64) float64 { return mapHeight - (lat-minLat)/latRange*mapHeight }
+
+	lines := make([]mapLine, 0, len(s.customerTrips))
+	for _, trip := range s.customerTrips {
+		lines = append(lines, mapLine{
+			X1: x(trip.StartLocation.Longitude),
+			Y1: y(trip.StartLocation.Latitude),
+			X2: x(trip.EndLocation.Longitude),
+			Y2: y(trip.EndLocation.Latitude),
+		})
+	}
+	return lines
+}
+
+// WriteHTML renders the Stats as a self contained HTML page. Charts are drawn with a few lines of
+// embedded JavaScript, so the report can be viewed offline.
+func WriteHTML(w io.Writer, s *Stats) error {
+	return htmlTemplate.Execute(w, struct {
+		*Stats
+		MapLines  []mapLine
+		MapWidth  float64
+		MapHeight float64
+	}{
+		Stats:     s,
+		MapLines:  s.mapLines(),
+		MapWidth:  mapWidth,
+		MapHeight: mapHeight,
+	})
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"euro": func(cents uint64) float64 { return float64(cents) / 100.0 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sharealyzer report {{.From.Format "2006-01-02 15:04"}} - {{.To.Format "2006-01-02 15:04"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+canvas { margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>Trips from {{.From.Format "2006-01-02 15:04"}} to {{.To.Format "2006-01-02 15:04"}}</h1>
+<table>
+<tr><th>Trips</th><td>{{.Trips}}</td></tr>
+{{range $type, $count := .TripsByType}}<tr><th>{{$type}}</th><td>{{$count}}</td></tr>
+{{end}}<tr><th>Fleet size</th><td>{{.FleetSize}}</td></tr>
+<tr><th>Trips per scooter and day</th><td>{{printf "%.2f" .Utilization}}</td></tr>
+<tr><th>Trips ridden in groups</th><td>{{.GroupedTrips}}</td></tr>
+<tr><th>Total cost</th><td>{{printf "%.2f €" (euro .TotalCost)}}</td></tr>
+</table>
+<table>
+<tr><th></th><th>Average</th><th>Median</th><th>P90</th><th>P99</th><th>Max</th></tr>
+<tr><th>Distance (km)</th><td>{{printf "%.2f" .Distance.Average}}</td><td>{{printf "%.2f" .Distance.P50}}</td><td>{{printf "%.2f" .Distance.P90}}</td><td>{{printf "%.2f" .Distance.P99}}</td><td>{{printf "%.2f" .Distance.Max}}</td></tr>
+<tr><th>Duration (min)</th><td>{{printf "%.1f" .Duration.Average}}</td><td>{{printf "%.1f" .Duration.P50}}</td><td>{{printf "%.1f" .Duration.P90}}</td><td>{{printf "%.1f" .Duration.P99}}</td><td>{{printf "%.1f" .Duration.Max}}</td></tr>
+<tr><th>Cost (€)</th><td>{{printf "%.2f" .Cost.Average}}</td><td>{{printf "%.2f" .Cost.P50}}</td><td>{{printf "%.2f" .Cost.P90}}</td><td>{{printf "%.2f" .Cost.P99}}</td><td>{{printf "%.2f" .Cost.Max}}</td></tr>
+</table>
+<h2>Trips per hour of day</h2>
+<canvas id="hours" width="800" height="250"></canvas>
+<h2>Distance distribution</h2>
+<canvas id="distance" width="800" height="250"></canvas>
+<h2>Duration distribution</h2>
+<canvas id="duration" width="800" height="250"></canvas>
+<h2>Cost distribution</h2>
+<canvas id="cost" width="800" height="250"></canvas>
+<h2>Customer trips</h2>
+<svg width="{{.MapWidth}}" height="{{.MapHeight}}" style="border: 1px solid #ccc">
+{{range .MapLines}}<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}" stroke="#1f77b4" stroke-opacity="0.3"/><circle cx="{{.X1}}" cy="{{.Y1}}" r="2" fill="#2ca02c"/><circle cx="{{.X2}}" cy="{{.Y2}}" r="2" fill="#d62728"/>
+{{end}}</svg>
+<script>
+function bar(id, labels, values) {
+  var canvas = document.getElementById(id), ctx = canvas.getContext("2d");
+  var max = Math.max.apply(null, values.concat([1])), w = canvas.width / values.length, h = canvas.height - 30;
+  ctx.font = "10px sans-serif";
+  for (var i = 0; i < values.length; i++) {
+    var bh = values[i] / max * (h - 15);
+    ctx.fillStyle = "#1f77b4";
+    ctx.fillRect(i * w + 2, h - bh, w - 4, bh);
+    ctx.fillStyle = "#000";
+    ctx.fillText(values[i], i * w + 4, h - bh - 3);
+    ctx.fillText(labels[i], i * w + 2, canvas.height - 10);
+  }
+}
+var hours = [];
+for (var i = 0; i < 24; i++) { hours.push(i + "h"); }
+bar("hours", hours, {{.TripsPerHour}});
+bar("distance", {{.DistanceHist.Labels}}, {{.DistanceHist.Counts}});
+bar("duration", {{.DurationHist.Labels}}, {{.DurationHist.Counts}});
+bar("cost", {{.CostHist.Labels}}, {{.CostHist.Counts}});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// Odometer is the estimated distance a scooter was ridden
+type Odometer struct {
+	Provider  string `json:"provider"`
+	ScooterID string `json:"scooter_id"`
+	// Distance is the sum of the distances of all customer trips with known distance in kilometers
+	Distance float64 `json:"distance"`
+	Trips    int     `json:"trips"`
+	// UnknownDistance is the number of customer trips with stale locations, which aren't part of the distance
+	UnknownDistance int       `json:"unknown_distance"`
+	FirstTrip       time.Time `json:"first_trip"`
+	LastTrip        time.Time `json:"last_trip"`
+}
+
+// OdometerEstimator accumulates the distance of customer trips per scooter. Other trips move scooters on a
+// van, which doesn't wear them. Trips are added one by one, so a whole trip store doesn't need to be kept in
+// memory.
+type OdometerEstimator struct {
+	odometers map[[2]string]*Odometer
+}
+
+// NewOdometerEstimator creates an OdometerEstimator without trips
+func NewOdometerEstimator() *OdometerEstimator {
+	return &OdometerEstimator{odometers: make(map[[2]string]*Odometer)}
+}
+
+// Add accumulates the trip if it is a customer trip
+func (e *OdometerEstimator) Add(trip *sharealyzer.Trip) {
+	if trip.Type != sharealyzer.CUSTOMER_TRIP {
+		return
+	}
+	key := [2]string{trip.ScooterProvider, trip.ScooterID}
+	o, exists := e.odometers[key]
+	if !exists {
+		o = &Odometer{Provider: trip.ScooterProvider, ScooterID: trip.ScooterID, FirstTrip: trip.StartTime, LastTrip: trip.StartTime}
+		e.odometers[key] = o
+	}
+	o.Trips++
+	if trip.StaleLocation {
+		o.UnknownDistance++
+	} else {
+		o.Distance += trip.Distance
+	}
+	if trip.StartTime.Before(o.FirstTrip) {
+		o.FirstTrip = trip.StartTime
+	}
+	if trip.StartTime.After(o.LastTrip) {
+		o.LastTrip = trip.StartTime
+	}
+}
+
+// Odometers returns the odometers of all scooters, the most ridden first
+func (e *OdometerEstimator) Odometers() []Odometer {
+	odometers := make([]Odometer, 0, len(e.odometers))
+	for _, o := range e.odometers {
+		odometers = append(odometers, *o)
+	}
+	sort.Slice(odometers, func(i, j int) bool {
+		if odometers[i].Distance != odometers[j].Distance {
+			return odometers[i].Distance > odometers[j].Distance
+		}
+		if odometers[i].Provider != odometers[j].Provider {
+			return odometers[i].Provider < odometers[j].Provider
+		}
+		return odometers[i].ScooterID < odometers[j].ScooterID
+	})
+	return odometers
+}
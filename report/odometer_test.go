@@ -0,0 +1,33 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOdometerEstimator(t *testing.T) {
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	trips := []*sharealyzer.Trip{
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.CUSTOMER_TRIP, Distance: 1.5, StartTime: start.Add(time.Hour)},
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.CUSTOMER_TRIP, Distance: 2.0, StartTime: start},
+		// The distance of trips with stale locations is unknown and vans don't wear scooters
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.CUSTOMER_TRIP, StaleLocation: true, StartTime: start.Add(2 * time.Hour)},
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.RELOCATION_TRIP, Distance: 5, StartTime: start.Add(3 * time.Hour)},
+		{ScooterProvider: "circ", ScooterID: "b", Type: sharealyzer.CUSTOMER_TRIP, Distance: 4.0, StartTime: start},
+		{ScooterProvider: "sim", ScooterID: "a", Type: sharealyzer.CUSTOMER_TRIP, Distance: 0.5, StartTime: start},
+	}
+	estimator := NewOdometerEstimator()
+	for _, trip := range trips {
+		estimator.Add(trip)
+	}
+	odometers := estimator.Odometers()
+	require.Len(t, odometers, 3)
+	assert.Equal(t, "b", odometers[0].ScooterID)
+	assert.Equal(t, Odometer{Provider: "circ", ScooterID: "a", Distance: 3.5, Trips: 3, UnknownDistance: 1,
+		FirstTrip: start, LastTrip: start.Add(2 * time.Hour)}, odometers[1])
+	assert.Equal(t, "sim", odometers[2].Provider)
+}
@@ -0,0 +1,142 @@
+// Package report computes statistics over aggregated trips and renders them as reports
+package report
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// Histogram is a simple histogram with labeled buckets
+type Histogram struct {
+	Labels []string `json:"labels"`
+	Counts []int    `json:"counts"`
+}
+
+// NewHistogram sorts values into buckets of bucketSize. All values beyond the last bucket are counted
+// in the last bucket.
+func NewHistogram(values []float64, bucketSize float64, buckets int, unit string) Histogram {
+	h := Histogram{
+		Labels: make([]string, buckets),
+		Counts: make([]int, buckets),
+	}
+	for i := 0; i < buckets; i++ {
+		h.Labels[i] = fmt.Sprintf("%g-%g%s", float64(i)*bucketSize, float64(i+1)*bucketSize, unit)
+	}
+	h.Labels[buckets-1] = fmt.Sprintf(">%g%s", float64(buckets-1)*bucketSize, unit)
+	for _, v := range values {
+		bucket := int(v / bucketSize)
+		if bucket >= buckets {
+			bucket = buckets - 1
+		} else if bucket < 0 {
+			bucket = 0
+		}
+		h.Counts[bucket]++
+	}
+	return h
+}
+
+// Summary contains the average and some percentiles of a set of values
+type Summary struct {
+	Average float64 `json:"average"`
+	Max     float64 `json:"max"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+}
+
+// NewSummary calculates the Summary of values
+func NewSummary(values []float64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum = sum + v
+	}
+	return Summary{
+		Average: sum / float64(len(sorted)),
+		Max:     sorted[len(sorted)-1],
+		P50:     percentile(sorted, 0.5),
+		P90:     percentile(sorted, 0.9),
+		P99:     percentile(sorted, 0.99),
+	}
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// Stats are the statistics of all trips in a period
+type Stats struct {
+	From        time.Time                    `json:"from"`
+	To          time.Time                    `json:"to"`
+	Trips       int                          `json:"trips"`
+	TripsByType map[sharealyzer.TripType]int `json:"trips_by_type"`
+	FleetSize   int                          `json:"fleet_size"`
+	// Utilization is the average number of customer trips per scooter and day
+	Utilization float64 `json:"utilization"`
+	// GroupedTrips is the number of customer trips ridden together with others
+	GroupedTrips int       `json:"grouped_trips"`
+	TotalCost    uint64    `json:"total_cost"` // Total cost of all customer trips in euro cents
+	Distance     Summary   `json:"distance"`
+	Duration     Summary   `json:"duration"` // Duration in minutes
+	Cost         Summary   `json:"cost"`
+	TripsPerHour [24]int   `json:"trips_per_hour"` // Hours are in the time zone of From
+	DistanceHist Histogram `json:"distance_histogram"`
+	DurationHist Histogram `json:"duration_histogram"`
+	CostHist     Histogram `json:"cost_histogram"`
+
+	customerTrips []*sharealyzer.Trip
+}
+
+// Compute calculates the Stats for the given trips. Distances, durations and costs only take customer trips
+// into account, distances only of trips without stale location. fleetSize is the number of distinct scooters seen in the period.
+func Compute(trips []*sharealyzer.Trip, from, to time.Time, fleetSize int) *Stats {
+	s := &Stats{
+		From:        from,
+		To:          to,
+		Trips:       len(trips),
+		TripsByType: make(map[sharealyzer.TripType]int),
+		FleetSize:   fleetSize,
+	}
+	var distances, durations, costs []float64
+	for _, trip := range trips {
+		s.TripsByType[trip.Type]++
+		if trip.Type != sharealyzer.CUSTOMER_TRIP {
+			continue
+		}
+		s.customerTrips = append(s.customerTrips, trip)
+		if trip.GroupID != "" {
+			s.GroupedTrips++
+		}
+		s.TotalCost = s.TotalCost + trip.Cost
+		s.TripsPerHour[trip.StartTime.In(from.Location()).Hour()]++
+		if !trip.StaleLocation {
+			distances = append(distances, trip.Distance)
+		}
+		durations = append(durations, trip.Duration.Minutes())
+		costs = append(costs, float64(trip.Cost)/100.0)
+	}
+	days := to.Sub(from).Hours() / 24
+	if fleetSize > 0 && days > 0 {
+		s.Utilization = float64(len(s.customerTrips)) / float64(fleetSize) / days
+	}
+	s.Distance = NewSummary(distances)
+	s.Duration = NewSummary(durations)
+	s.Cost = NewSummary(costs)
+	s.DistanceHist = NewHistogram(distances, 0.5, 12, "km")
+	s.DurationHist = NewHistogram(durations, 5, 12, "min")
+	s.CostHist = NewHistogram(costs, 1, 10, "€")
+	return s
+}
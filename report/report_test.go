@@ -0,0 +1,67 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeAndRender(t *testing.T) {
+	start := time.Date(2019, 10, 6, 0, 0, 0, 0, time.UTC)
+	trips := []*sharealyzer.Trip{
+		{
+			Type:          sharealyzer.CUSTOMER_TRIP,
+			StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40),
+			EndLocation:   sharealyzer.NewGeoLocation(51.51, 7.42),
+			StartTime:     start.Add(time.Hour * 8),
+			Duration:      time.Minute * 12,
+			Distance:      1.7,
+			Cost:          280,
+		},
+		{
+			// The distance of trips with stale locations is unknown
+			Type:          sharealyzer.CUSTOMER_TRIP,
+			StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40),
+			EndLocation:   sharealyzer.NewGeoLocation(51.50, 7.40),
+			StartTime:     start.Add(time.Hour * 9),
+			Duration:      time.Minute * 20,
+			Cost:          400,
+			StaleLocation: true,
+		},
+		{
+			Type:          sharealyzer.CHARGING_TRIP,
+			StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40),
+			EndLocation:   sharealyzer.NewGeoLocation(51.52, 7.45),
+		},
+	}
+
+	stats := Compute(trips, start, start.Add(time.Hour*24), 2)
+	assert.Equal(t, 3, stats.Trips)
+	assert.Equal(t, 2, stats.TripsByType[sharealyzer.CUSTOMER_TRIP])
+	assert.Equal(t, 1, stats.TripsPerHour[8])
+
+	// Trips are counted by the hour in the time zone of the report
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	inBerlin := Compute(trips, start.In(berlin), start.Add(time.Hour*24).In(berlin), 2)
+	assert.Equal(t, 0, inBerlin.TripsPerHour[8])
+	// 08:00 UTC is 10:00 CEST
+	assert.Equal(t, 1, inBerlin.TripsPerHour[10])
+	assert.InDelta(t, 1, stats.Utilization, 0.001)
+	assert.InDelta(t, 1.7, stats.Distance.P50, 0.001)
+	assert.InDelta(t, 1.7, stats.Distance.Max, 0.001)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteHTML(buf, stats))
+	assert.Contains(t, buf.String(), "<line")
+}
+
+func TestHistogramOverflow(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 0.6, 42}, 0.5, 3, "km")
+	assert.Equal(t, []int{1, 1, 1}, h.Counts)
+	assert.Equal(t, ">1km", h.Labels[2])
+}
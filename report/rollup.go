@@ -0,0 +1,204 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// Period is the length of the time range covered by a Rollup
+type Period string
+
+const (
+	Hourly Period = "hourly"
+	Daily  Period = "daily"
+)
+
+// Duration returns the length of the period, or 0 for unknown periods
+func (p Period) Duration() time.Duration {
+	switch p {
+	case Hourly:
+		return time.Hour
+	case Daily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Rollup contains the aggregated trips which finished within a period and the scooters seen in it. Rollups
+// of consecutive periods are combined to the Stats of a longer range, so long ranges don't need to be
+// rescanned. Customer trips are kept, since percentiles and the trip map can't be derived from counts.
+type Rollup struct {
+	Period        Period                       `json:"period"`
+	Start         time.Time                    `json:"start"`
+	TripsByType   map[sharealyzer.TripType]int `json:"trips_by_type"`
+	Scooters      []string                     `json:"scooters"`
+	CustomerTrips []*sharealyzer.Trip          `json:"customer_trips"`
+}
+
+// End returns the end of the period of the rollup
+func (r *Rollup) End() time.Time {
+	return r.Start.Add(r.Period.Duration())
+}
+
+// PeriodStarts returns the start of every period overlapping the range between from and to. Periods
+// begin at multiples of their duration in UTC.
+func PeriodStarts(period Period, from, to time.Time) []time.Time {
+	length := period.Duration()
+	if length <= 0 {
+		return nil
+	}
+	var starts []time.Time
+	for start := from.UTC().Truncate(length); start.Before(to); start = start.Add(length) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// Combine calculates the Stats of the range between from and to out of the rollups covering it
+func Combine(rollups []*Rollup, from, to time.Time) *Stats {
+	fleet := make(map[string]bool)
+	tripsByType := make(map[sharealyzer.TripType]int)
+	var customerTrips []*sharealyzer.Trip
+	for _, r := range rollups {
+		for _, id := range r.Scooters {
+			fleet[id] = true
+		}
+		for tripType, count := range r.TripsByType {
+			tripsByType[tripType] = tripsByType[tripType] + count
+		}
+		customerTrips = append(customerTrips, r.CustomerTrips...)
+	}
+	s := Compute(customerTrips, from, to, len(fleet))
+	s.TripsByType = tripsByType
+	s.Trips = 0
+	for _, count := range tripsByType {
+		s.Trips = s.Trips + count
+	}
+	return s
+}
+
+// Roller sorts observed scooters and finished trips into the rollups of their periods. Trips belong to
+// the period in which they finished. It is safe for concurrent use.
+type Roller struct {
+	Period Period
+
+	lock    sync.Mutex
+	rollups map[time.Time]*Rollup
+	fleets  map[time.Time]map[string]bool
+}
+
+// NewRoller creates a Roller for rollups of the given period
+func NewRoller(period Period) *Roller {
+	return &Roller{
+		Period:  period,
+		rollups: make(map[time.Time]*Rollup),
+		fleets:  make(map[time.Time]map[string]bool),
+	}
+}
+
+func (r *Roller) rollup(date time.Time) *Rollup {
+	start := date.UTC().Truncate(r.Period.Duration())
+	rollup, exists := r.rollups[start]
+	if !exists {
+		rollup = &Rollup{
+			Period:      r.Period,
+			Start:       start,
+			TripsByType: make(map[sharealyzer.TripType]int),
+		}
+		r.rollups[start] = rollup
+		r.fleets[start] = make(map[string]bool)
+	}
+	return rollup
+}
+
+// Observe records the scooters seen in a scrape at date
+func (r *Roller) Observe(date time.Time, scooterIDs []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rollup := r.rollup(date)
+	fleet := r.fleets[rollup.Start]
+	for _, id := range scooterIDs {
+		if !fleet[id] {
+			fleet[id] = true
+			rollup.Scooters = append(rollup.Scooters, id)
+		}
+	}
+}
+
+// Add records a classified trip
+func (r *Roller) Add(trip *sharealyzer.Trip) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rollup := r.rollup(trip.EndTime)
+	rollup.TripsByType[trip.Type]++
+	if trip.Type == sharealyzer.CUSTOMER_TRIP {
+		rollup.CustomerTrips = append(rollup.CustomerTrips, trip)
+	}
+}
+
+// Rollups returns the rollups of all periods overlapping the range between from and to in order. Periods
+// without observations get empty rollups.
+func (r *Roller) Rollups(from, to time.Time) []*Rollup {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var rollups []*Rollup
+	for _, start := range PeriodStarts(r.Period, from, to) {
+		rollup := r.rollup(start)
+		sort.Strings(rollup.Scooters)
+		rollups = append(rollups, rollup)
+	}
+	return rollups
+}
+
+// FileRollupStore persists rollups as JSON files in Dir
+type FileRollupStore struct {
+	Dir string
+}
+
+// Path returns the path of the rollup of the period beginning at start
+func (f *FileRollupStore) Path(period Period, start time.Time) string {
+	return filepath.Join(f.Dir, fmt.Sprintf("%s_%s.json", period, start.UTC().Format("2006-01-02T15")))
+}
+
+// Load reads the rollup of the period beginning at start. An error satisfying os.IsNotExist is returned if
+// the rollup wasn't stored yet.
+func (f *FileRollupStore) Load(period Period, start time.Time) (*Rollup, error) {
+	rollupFile, err := os.Open(f.Path(period, start))
+	if err != nil {
+		return nil, err
+	}
+	defer rollupFile.Close()
+	rollup := &Rollup{}
+	if err := json.NewDecoder(rollupFile).Decode(rollup); err != nil {
+		return nil, fmt.Errorf("Invalid rollup %s: %s", rollupFile.Name(), err)
+	}
+	return rollup, nil
+}
+
+// Store writes the rollup, replacing a previously stored rollup of the same period
+func (f *FileRollupStore) Store(r *Rollup) error {
+	if err := os.MkdirAll(f.Dir, 0770); err != nil {
+		return err
+	}
+	path := f.Path(r.Period, r.Start)
+	tmpPath := path + ".tmp"
+	rollupFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(rollupFile).Encode(r); err != nil {
+		rollupFile.Close()
+		return err
+	}
+	if err := rollupFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
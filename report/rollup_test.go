@@ -0,0 +1,78 @@
+package report
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollups(t *testing.T) {
+	start := time.Date(2019, 10, 6, 0, 0, 0, 0, time.UTC)
+	trips := []*sharealyzer.Trip{
+		{Type: sharealyzer.CUSTOMER_TRIP, StartTime: start.Add(8 * time.Hour), EndTime: start.Add(8*time.Hour + 12*time.Minute),
+			Duration: 12 * time.Minute, Distance: 1.7, Cost: 280,
+			StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40), EndLocation: sharealyzer.NewGeoLocation(51.51, 7.42)},
+		{Type: sharealyzer.CHARGING_TRIP, StartTime: start.Add(20 * time.Hour), EndTime: start.Add(30 * time.Hour)},
+		{Type: sharealyzer.CUSTOMER_TRIP, StartTime: start.Add(33 * time.Hour), EndTime: start.Add(33*time.Hour + 20*time.Minute),
+			Duration: 20 * time.Minute, Distance: 2.5, Cost: 420,
+			StartLocation: sharealyzer.NewGeoLocation(51.51, 7.42), EndLocation: sharealyzer.NewGeoLocation(51.53, 7.44)},
+	}
+
+	roller := NewRoller(Daily)
+	roller.Observe(start.Add(time.Hour), []string{"a", "b"})
+	roller.Observe(start.Add(2*time.Hour), []string{"a"})
+	roller.Observe(start.Add(25*time.Hour), []string{"c"})
+	for _, trip := range trips {
+		roller.Add(trip)
+	}
+	rollups := roller.Rollups(start.Add(time.Hour), start.Add(72*time.Hour))
+	require.Len(t, rollups, 3)
+	assert.Equal(t, start, rollups[0].Start)
+	assert.Equal(t, []string{"a", "b"}, rollups[0].Scooters)
+	assert.Equal(t, 1, rollups[0].TripsByType[sharealyzer.CUSTOMER_TRIP])
+	// Trips belong to the period they finished in
+	assert.Equal(t, 1, rollups[1].TripsByType[sharealyzer.CHARGING_TRIP])
+	assert.Len(t, rollups[1].CustomerTrips, 1)
+	assert.Empty(t, rollups[2].Scooters)
+
+	dir, err := ioutil.TempDir("", "rollups")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := &FileRollupStore{Dir: dir}
+	_, err = store.Load(Daily, start)
+	assert.True(t, os.IsNotExist(err))
+	for _, r := range rollups {
+		require.NoError(t, store.Store(r))
+	}
+	var loaded []*Rollup
+	for _, periodStart := range PeriodStarts(Daily, start, start.Add(72*time.Hour)) {
+		r, err := store.Load(Daily, periodStart)
+		require.NoError(t, err)
+		loaded = append(loaded, r)
+	}
+
+	// Combined rollups equal the stats computed from all trips
+	expected := Compute(trips, start, start.Add(72*time.Hour), 3)
+	combined := Combine(loaded, start, start.Add(72*time.Hour))
+	assert.Equal(t, expected.Trips, combined.Trips)
+	assert.Equal(t, expected.TripsByType, combined.TripsByType)
+	assert.Equal(t, expected.FleetSize, combined.FleetSize)
+	assert.Equal(t, expected.TotalCost, combined.TotalCost)
+	assert.Equal(t, expected.TripsPerHour, combined.TripsPerHour)
+	assert.Equal(t, expected.Distance, combined.Distance)
+	assert.Equal(t, expected.DurationHist, combined.DurationHist)
+	assert.InDelta(t, expected.Utilization, combined.Utilization, 0.0001)
+	assert.Len(t, combined.mapLines(), 2)
+}
+
+func TestPeriodStarts(t *testing.T) {
+	start := time.Date(2019, 10, 6, 10, 30, 0, 0, time.UTC)
+	assert.Len(t, PeriodStarts(Hourly, start, start.Add(2*time.Hour)), 3)
+	assert.Equal(t, []time.Time{time.Date(2019, 10, 6, 0, 0, 0, 0, time.UTC)}, PeriodStarts(Daily, start, start.Add(time.Hour)))
+	assert.Nil(t, PeriodStarts(Period("weekly"), start, start.Add(time.Hour)))
+}
@@ -0,0 +1,193 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+const (
+	miniMapSize = 200.0
+	// minMiniMapKm is the smallest extent of a mini map, so trips which hardly moved aren't zoomed in
+	// until GPS noise looks like a trip
+	minMiniMapKm = 0.5
+)
+
+// TripSampler draws a uniform random sample of trips per type from a stream of trips of unknown length
+// by reservoir sampling, so a whole trip store doesn't need to be kept in memory
+type TripSampler struct {
+	PerType int
+
+	random  *rand.Rand
+	seen    map[sharealyzer.TripType]int
+	samples map[sharealyzer.TripType][]*sharealyzer.Trip
+}
+
+// NewTripSampler creates a sampler which keeps perType trips of every type. The same seed and trips
+// give the same sample.
+func NewTripSampler(perType int, seed int64) *TripSampler {
+	return &TripSampler{
+		PerType: perType,
+		random:  rand.New(rand.NewSource(seed)),
+		seen:    make(map[sharealyzer.TripType]int),
+		samples: make(map[sharealyzer.TripType][]*sharealyzer.Trip),
+	}
+}
+
+// Add offers a trip to the sample
+func (s *TripSampler) Add(trip *sharealyzer.Trip) {
+	s.seen[trip.Type]++
+	if len(s.samples[trip.Type]) < s.PerType {
+		s.samples[trip.Type] = append(s.samples[trip.Type], trip)
+		return
+	}
+	if i := s.random.Intn(s.seen[trip.Type]); i < s.PerType {
+		s.samples[trip.Type][i] = trip
+	}
+}
+
+// TripSample are the sampled trips of a type
+type TripSample struct {
+	Type sharealyzer.TripType
+	// Total is the number of trips of the type the sample was drawn from
+	Total int
+	Trips []*sharealyzer.Trip
+}
+
+// Samples returns the samples of all types ordered by type, the trips of a sample are ordered by their
+// start time
+func (s *TripSampler) Samples() []TripSample {
+	samples := make([]TripSample, 0, len(s.samples))
+	for tripType, trips := range s.samples {
+		sorted := append([]*sharealyzer.Trip(nil), trips...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].StartTime.Before(sorted[j].StartTime)
+		})
+		samples = append(samples, TripSample{Type: tripType, Total: s.seen[tripType], Trips: sorted})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Type < samples[j].Type
+	})
+	return samples
+}
+
+// miniMap is a trip projected into its own small SVG map
+type miniMap struct {
+	StartX, StartY float64
+	EndX, EndY     float64
+	HasEnd         bool
+	// ScaleKm is the distance covered by the width of the map
+	ScaleKm float64
+}
+
+// newMiniMap centers the trip in a square map which covers at least minMiniMapKm, so the scale of
+// different trips is comparable at a glance
+func newMiniMap(trip *sharealyzer.Trip) miniMap {
+	start, end := trip.StartLocation, trip.EndLocation
+	if start == nil {
+		start = end
+	}
+	if start == nil {
+		return miniMap{}
+	}
+	hasEnd := end != nil
+	if !hasEnd {
+		end = start
+	}
+	centerLat, centerLon := (start.Latitude+end.Latitude)/2, (start.Longitude+end.Longitude)/2
+	kmPerLat := 111.32
+	kmPerLon := 111.32 * math.Cos(centerLat*math.Pi/180)
+	extentKm := math.Max(math.Abs(start.Latitude-end.Latitude)*kmPerLat, math.Abs(start.Longitude-end.Longitude)*kmPerLon)
+	// Leave a margin around the trip
+	extentKm = math.Max(extentKm*1.4, minMiniMapKm)
+	x := func(lon float64) float64 { return miniMapSize/2 + (lon-centerLon)*kmPerLon/extentKm*miniMapSize }
+	y := func(lat float64) float64 { return miniMapSize/2 - (lat-centerLat)*kmPerLat/extentKm*miniMapSize }
+	return miniMap{
+		StartX:  x(start.Longitude),
+		StartY:  y(start.Latitude),
+		EndX:    x(end.Longitude),
+		EndY:    y(end.Latitude),
+		HasEnd:  hasEnd,
+		ScaleKm: extentKm,
+	}
+}
+
+type sampledTrip struct {
+	*sharealyzer.Trip
+	Map     miniMap
+	MapLink string
+}
+
+// WriteSampleHTML renders the sampled trips as a self contained HTML page with a mini map of every trip,
+// so systematic misclassifications can be spotted by looking through it
+func WriteSampleHTML(w io.Writer, samples []TripSample) error {
+	type section struct {
+		Type  sharealyzer.TripType
+		Total int
+		Trips []sampledTrip
+	}
+	sections := make([]section, 0, len(samples))
+	for _, sample := range samples {
+		s := section{Type: sample.Type, Total: sample.Total}
+		for _, trip := range sample.Trips {
+			s.Trips = append(s.Trips, sampledTrip{Trip: trip, Map: newMiniMap(trip), MapLink: osmLink(trip)})
+		}
+		sections = append(sections, s)
+	}
+	return sampleTemplate.Execute(w, struct {
+		Sections []section
+		Size     float64
+	}{Sections: sections, Size: miniMapSize})
+}
+
+// osmLink links to the trip on OpenStreetMap, so the surroundings of a suspicious trip can be checked
+func osmLink(trip *sharealyzer.Trip) string {
+	if trip.StartLocation == nil {
+		return ""
+	}
+	if trip.EndLocation == nil {
+		return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=17/%.6f/%.6f",
+			trip.StartLocation.Latitude, trip.StartLocation.Longitude, trip.StartLocation.Latitude, trip.StartLocation.Longitude)
+	}
+	return fmt.Sprintf("https://www.openstreetmap.org/directions?route=%.6f%%2C%.6f%%3B%.6f%%2C%.6f",
+		trip.StartLocation.Latitude, trip.StartLocation.Longitude, trip.EndLocation.Latitude, trip.EndLocation.Longitude)
+}
+
+var sampleTemplate = template.Must(template.New("sample").Funcs(template.FuncMap{
+	"euro": func(cents uint64) float64 { return float64(cents) / 100.0 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sharealyzer trip sample</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.trips { display: flex; flex-wrap: wrap; }
+.trip { margin: 0 1em 1em 0; font-size: 12px; width: {{.Size}}px; }
+svg { border: 1px solid #ccc; background: #f8f8f8; }
+</style>
+</head>
+<body>
+<h1>Trip sample</h1>
+<p>Green is the start and red the end of a trip, the width of a map is given below it.</p>
+{{range .Sections}}<h2>{{.Type}} ({{len .Trips}} of {{.Total}})</h2>
+<div class="trips">
+{{range .Trips}}<div class="trip">
+<a href="{{.MapLink}}"><svg width="{{$.Size}}" height="{{$.Size}}">
+{{if .Map.HasEnd}}<line x1="{{.Map.StartX}}" y1="{{.Map.StartY}}" x2="{{.Map.EndX}}" y2="{{.Map.EndY}}" stroke="#1f77b4" stroke-width="2"/>
+<circle cx="{{.Map.EndX}}" cy="{{.Map.EndY}}" r="4" fill="#d62728"/>
+{{end}}<circle cx="{{.Map.StartX}}" cy="{{.Map.StartY}}" r="4" fill="#2ca02c"/>
+</svg></a>
+<div>{{.ID}} &middot; {{printf "%.2f" .Map.ScaleKm}} km wide</div>
+<div>{{.StartTime.Format "2006-01-02 15:04"}}, {{printf "%.0f" .Duration.Minutes}} min, {{printf "%.2f" .Distance}} km</div>
+<div>Charge {{printf "%.0f" .StartChargeLevel}}% &rarr; {{printf "%.0f" .EndChargeLevel}}%, {{printf "%.2f €" (euro .Cost)}}{{if .StaleLocation}}, stale location{{end}}</div>
+</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
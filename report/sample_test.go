@@ -0,0 +1,75 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripSampler(t *testing.T) {
+	start := time.Date(2019, 10, 6, 0, 0, 0, 0, time.UTC)
+	sample := func(seed int64) []TripSample {
+		sampler := NewTripSampler(5, seed)
+		for i := 0; i < 100; i++ {
+			sampler.Add(&sharealyzer.Trip{ID: fmt.Sprintf("customer-%d", i), Type: sharealyzer.CUSTOMER_TRIP, StartTime: start.Add(time.Duration(i) * time.Minute)})
+		}
+		for i := 0; i < 3; i++ {
+			sampler.Add(&sharealyzer.Trip{ID: fmt.Sprintf("charging-%d", i), Type: sharealyzer.CHARGING_TRIP, StartTime: start.Add(time.Duration(i) * time.Minute)})
+		}
+		return sampler.Samples()
+	}
+
+	samples := sample(1)
+	require.Len(t, samples, 2)
+	assert.Equal(t, sharealyzer.CHARGING_TRIP, samples[0].Type)
+	assert.Equal(t, 3, samples[0].Total)
+	assert.Len(t, samples[0].Trips, 3)
+	assert.Equal(t, sharealyzer.CUSTOMER_TRIP, samples[1].Type)
+	assert.Equal(t, 100, samples[1].Total)
+	require.Len(t, samples[1].Trips, 5)
+	for i := 1; i < len(samples[1].Trips); i++ {
+		assert.True(t, samples[1].Trips[i-1].StartTime.Before(samples[1].Trips[i].StartTime))
+	}
+	assert.Equal(t, samples, sample(1))
+	assert.NotEqual(t, samples, sample(2))
+}
+
+func TestMiniMap(t *testing.T) {
+	trip := &sharealyzer.Trip{StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40), EndLocation: sharealyzer.NewGeoLocation(51.52, 7.40)}
+	m := newMiniMap(trip)
+	assert.True(t, m.HasEnd)
+	assert.InDelta(t, miniMapSize/2, m.StartX, 0.001)
+	assert.True(t, m.EndY < m.StartY, "north is up")
+	assert.InDelta(t, 2.226*1.4, m.ScaleKm, 0.01)
+
+	// Trips which hardly moved are shown at the minimum scale
+	trip.EndLocation = sharealyzer.NewGeoLocation(51.50001, 7.40)
+	assert.Equal(t, minMiniMapKm, newMiniMap(trip).ScaleKm)
+
+	// Open trips have no end
+	trip.EndLocation = nil
+	m = newMiniMap(trip)
+	assert.False(t, m.HasEnd)
+	assert.Equal(t, miniMapSize/2, m.StartX)
+}
+
+func TestWriteSampleHTML(t *testing.T) {
+	sampler := NewTripSampler(2, 1)
+	sampler.Add(&sharealyzer.Trip{ID: "relocated", Type: sharealyzer.RELOCATION_TRIP,
+		StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40), EndLocation: sharealyzer.NewGeoLocation(51.52, 7.45)})
+	sampler.Add(&sharealyzer.Trip{ID: "open", Type: sharealyzer.OPEN_TRIP, StartLocation: sharealyzer.NewGeoLocation(51.50, 7.40)})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteSampleHTML(buf, sampler.Samples()))
+	html := buf.String()
+	assert.Contains(t, html, "RELOCATION_TRIP (1 of 1)")
+	assert.Contains(t, html, "OPEN_TRIP (1 of 1)")
+	assert.Contains(t, html, "relocated")
+	assert.Contains(t, html, "openstreetmap.org/directions")
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("<line")))
+}
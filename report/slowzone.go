@@ -0,0 +1,85 @@
+package report
+
+import (
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// SlowZoneTrips summarizes a set of customer trips
+type SlowZoneTrips struct {
+	Trips    int     `json:"trips"`
+	Distance Summary `json:"distance"`
+	Duration Summary `json:"duration"` // Duration in minutes
+	Speed    Summary `json:"speed"`    // Average speed of the trips in km/h
+}
+
+// SlowZoneEffect compares the customer trips which crossed slow zones to the ones which didn't
+type SlowZoneEffect struct {
+	Crossing SlowZoneTrips `json:"crossing"`
+	Other    SlowZoneTrips `json:"other"`
+	// Delay is the time in minutes crossing trips took longer than riding their distance at the median speed of
+	// the other trips would have taken. It is empty if there are no other trips to compare to.
+	Delay Summary `json:"delay"`
+	// TotalDelay is the sum of the delays in minutes
+	TotalDelay float64 `json:"total_delay"`
+}
+
+// TripCrosses returns true if the route of a trip, its start, the path it was followed on and its end,
+// touches the area. Between the known locations the scooter is assumed to go straight.
+func TripCrosses(trip *sharealyzer.Trip, area sharealyzer.Polygons) bool {
+	from := trip.StartLocation
+	for _, location := range trip.Path {
+		if area.Crosses(from, location) {
+			return true
+		}
+		from = location
+	}
+	return area.Crosses(from, trip.EndLocation)
+}
+
+// ComputeSlowZoneEffect estimates how much slow zones delay customer trips. Trips with stale locations or
+// without distance are left out, since their speed is unknown.
+func ComputeSlowZoneEffect(trips []*sharealyzer.Trip, zones sharealyzer.Polygons) *SlowZoneEffect {
+	var crossing, other []*sharealyzer.Trip
+	for _, trip := range trips {
+		if trip.Type != sharealyzer.CUSTOMER_TRIP || trip.StaleLocation || trip.Distance <= 0 || trip.Duration <= 0 {
+			continue
+		}
+		if TripCrosses(trip, zones) {
+			crossing = append(crossing, trip)
+		} else {
+			other = append(other, trip)
+		}
+	}
+	effect := &SlowZoneEffect{
+		Crossing: slowZoneTrips(crossing),
+		Other:    slowZoneTrips(other),
+	}
+	if len(other) == 0 || effect.Other.Speed.P50 <= 0 {
+		return effect
+	}
+	delays := make([]float64, len(crossing))
+	for i, trip := range crossing {
+		expected := trip.Distance / effect.Other.Speed.P50 * 60
+		delays[i] = trip.Duration.Minutes() - expected
+		effect.TotalDelay += delays[i]
+	}
+	effect.Delay = NewSummary(delays)
+	return effect
+}
+
+func slowZoneTrips(trips []*sharealyzer.Trip) SlowZoneTrips {
+	distances := make([]float64, len(trips))
+	durations := make([]float64, len(trips))
+	speeds := make([]float64, len(trips))
+	for i, trip := range trips {
+		distances[i] = trip.Distance
+		durations[i] = trip.Duration.Minutes()
+		speeds[i] = trip.Distance / trip.Duration.Hours()
+	}
+	return SlowZoneTrips{
+		Trips:    len(trips),
+		Distance: NewSummary(distances),
+		Duration: NewSummary(durations),
+		Speed:    NewSummary(speeds),
+	}
+}
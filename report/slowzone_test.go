@@ -0,0 +1,50 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeSlowZoneEffect(t *testing.T) {
+	zone := square(51.50, 7.40)
+	trip := func(id string, startLat, startLon, endLat, endLon float64, duration time.Duration, distance float64) *sharealyzer.Trip {
+		return &sharealyzer.Trip{
+			ID:            id,
+			Type:          sharealyzer.CUSTOMER_TRIP,
+			StartLocation: sharealyzer.NewGeoLocation(startLat, startLon),
+			EndLocation:   sharealyzer.NewGeoLocation(endLat, endLon),
+			Duration:      duration,
+			Distance:      distance,
+		}
+	}
+	// Trips outside of the zone go 12 km/h
+	outside := []*sharealyzer.Trip{
+		trip("outside 1", 51.52, 7.40, 51.53, 7.40, 10*time.Minute, 2),
+		trip("outside 2", 51.52, 7.40, 51.53, 7.40, 5*time.Minute, 1),
+	}
+	// Passes through the zone without a location within it
+	through := trip("through", 51.505, 7.39, 51.505, 7.42, 15*time.Minute, 2)
+	// Was followed into the zone
+	followed := trip("followed", 51.52, 7.40, 51.53, 7.40, 8*time.Minute, 1)
+	followed.Path = []*sharealyzer.GeoLocation{sharealyzer.NewGeoLocation(51.505, 7.405)}
+	stale := trip("stale", 51.505, 7.405, 51.505, 7.405, 30*time.Minute, 0.5)
+	stale.StaleLocation = true
+	relocation := trip("relocation", 51.505, 7.405, 51.52, 7.40, 30*time.Minute, 2)
+	relocation.Type = sharealyzer.RELOCATION_TRIP
+
+	trips := append([]*sharealyzer.Trip{through, followed, stale, relocation}, outside...)
+	effect := ComputeSlowZoneEffect(trips, zone)
+	assert.Equal(t, 2, effect.Crossing.Trips)
+	assert.Equal(t, 2, effect.Other.Trips)
+	assert.InDelta(t, 12, effect.Other.Speed.P50, 1e-9)
+	// through is 5 minutes late, followed 3 minutes
+	assert.InDelta(t, 8, effect.TotalDelay, 1e-9)
+	assert.InDelta(t, 5, effect.Delay.Max, 1e-9)
+
+	effect = ComputeSlowZoneEffect([]*sharealyzer.Trip{through}, zone)
+	assert.Equal(t, 1, effect.Crossing.Trips)
+	assert.Zero(t, effect.TotalDelay)
+}
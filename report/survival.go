@@ -0,0 +1,183 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// InitialCohort is the cohort of scooters which were already deployed when the observation started, so their
+// deployment date is unknown
+const InitialCohort = "initial"
+
+// Lifetime is the time a scooter was seen in the fleet
+type Lifetime struct {
+	Provider  string    `json:"provider"`
+	ScooterID string    `json:"scooter_id"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Initial is set if the scooter was seen in the first scrape result, its deployment date is unknown
+	Initial bool `json:"initial"`
+	// Retired is set if the scooter disappeared permanently, otherwise its lifetime is censored by the end of
+	// the observation
+	Retired bool `json:"retired"`
+}
+
+// Duration returns the observed lifetime
+func (l Lifetime) Duration() time.Duration {
+	return l.LastSeen.Sub(l.FirstSeen)
+}
+
+// LifetimeTracker records when every scooter was seen first and last in a sequence of scrape results
+type LifetimeTracker struct {
+	lifetimes  map[[2]string]*Lifetime
+	first, end time.Time
+}
+
+// NewLifetimeTracker creates a LifetimeTracker without scrape results
+func NewLifetimeTracker() *LifetimeTracker {
+	return &LifetimeTracker{lifetimes: make(map[[2]string]*Lifetime)}
+}
+
+// Observe records the scooters of a scrape result. Results need to be observed in order.
+func (t *LifetimeTracker) Observe(res sharealyzer.ScrapeResult) {
+	date := res.ScrapeDate()
+	if t.first.IsZero() {
+		t.first = date
+	}
+	t.end = date
+	for _, scooter := range res.Scooters() {
+		provider := scooter.Provider
+		if provider == "" {
+			provider = res.Provider()
+		}
+		key := [2]string{provider, scooter.ID}
+		l, exists := t.lifetimes[key]
+		if !exists {
+			l = &Lifetime{Provider: provider, ScooterID: scooter.ID, FirstSeen: date, Initial: date.Equal(t.first)}
+			t.lifetimes[key] = l
+		}
+		l.LastSeen = date
+	}
+}
+
+// Lifetimes returns the lifetimes of all scooters ordered by their first sighting. Scooters not seen within
+// retiredAfter before the last scrape result are retired.
+func (t *LifetimeTracker) Lifetimes(retiredAfter time.Duration) []Lifetime {
+	lifetimes := make([]Lifetime, 0, len(t.lifetimes))
+	for _, l := range t.lifetimes {
+		lifetime := *l
+		lifetime.Retired = t.end.Sub(l.LastSeen) > retiredAfter
+		lifetimes = append(lifetimes, lifetime)
+	}
+	sort.Slice(lifetimes, func(i, j int) bool {
+		if !lifetimes[i].FirstSeen.Equal(lifetimes[j].FirstSeen) {
+			return lifetimes[i].FirstSeen.Before(lifetimes[j].FirstSeen)
+		}
+		return lifetimes[i].ScooterID < lifetimes[j].ScooterID
+	})
+	return lifetimes
+}
+
+// SurvivalPoint is a step of a survival curve
+type SurvivalPoint struct {
+	// Age is the time since the scooters were seen first
+	Age time.Duration `json:"age"`
+	// AtRisk is the number of scooters which were still observed at this age
+	AtRisk int `json:"at_risk"`
+	// Retired is the number of scooters which disappeared at this age
+	Retired int `json:"retired"`
+	// Survival is the estimated share of scooters which are still in the fleet after this age
+	Survival float64 `json:"survival"`
+}
+
+// SurvivalCurve is the Kaplan-Meier estimate of the lifetime of a cohort of scooters
+type SurvivalCurve struct {
+	Cohort   string          `json:"cohort"`
+	Scooters int             `json:"scooters"`
+	Retired  int             `json:"retired"`
+	Points   []SurvivalPoint `json:"points"`
+}
+
+// MedianLifetime returns the age at which half of the scooters are retired. It is false if the survival
+// never dropped to a half.
+func (c SurvivalCurve) MedianLifetime() (time.Duration, bool) {
+	for _, p := range c.Points {
+		if p.Survival <= 0.5 {
+			return p.Age, true
+		}
+	}
+	return 0, false
+}
+
+// KaplanMeier estimates the survival curve of the lifetimes. Lifetimes of scooters which didn't retire are
+// censored.
+func KaplanMeier(cohort string, lifetimes []Lifetime) SurvivalCurve {
+	sorted := append([]Lifetime(nil), lifetimes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Duration() < sorted[j].Duration()
+	})
+	curve := SurvivalCurve{Cohort: cohort, Scooters: len(sorted), Points: []SurvivalPoint{{AtRisk: len(sorted), Survival: 1}}}
+	survival := 1.0
+	for i := 0; i < len(sorted); {
+		age := sorted[i].Duration()
+		retired, j := 0, i
+		for ; j < len(sorted) && sorted[j].Duration() == age; j++ {
+			if sorted[j].Retired {
+				retired++
+			}
+		}
+		if retired > 0 {
+			atRisk := len(sorted) - i
+			survival *= 1 - float64(retired)/float64(atRisk)
+			curve.Retired += retired
+			curve.Points = append(curve.Points, SurvivalPoint{Age: age, AtRisk: atRisk, Retired: retired, Survival: survival})
+		}
+		i = j
+	}
+	return curve
+}
+
+// Cohort names the deployment cohort of a first sighting
+type Cohort func(firstSeen time.Time) string
+
+// MonthlyCohort puts scooters deployed in the same month in the time zone loc into a cohort
+func MonthlyCohort(loc *time.Location) Cohort {
+	return func(firstSeen time.Time) string {
+		return firstSeen.In(loc).Format("2006-01")
+	}
+}
+
+// WeeklyCohort puts scooters deployed in the same ISO week in the time zone loc into a cohort
+func WeeklyCohort(loc *time.Location) Cohort {
+	return func(firstSeen time.Time) string {
+		year, week := firstSeen.In(loc).ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+}
+
+// SurvivalCurves estimates a survival curve per deployment cohort, ordered by cohort. Scooters deployed
+// before the observation started form the InitialCohort, which comes first.
+func SurvivalCurves(lifetimes []Lifetime, cohort Cohort) []SurvivalCurve {
+	cohorts := make(map[string][]Lifetime)
+	for _, l := range lifetimes {
+		name := InitialCohort
+		if !l.Initial {
+			name = cohort(l.FirstSeen)
+		}
+		cohorts[name] = append(cohorts[name], l)
+	}
+	curves := make([]SurvivalCurve, 0, len(cohorts))
+	for name, members := range cohorts {
+		curves = append(curves, KaplanMeier(name, members))
+	}
+	sort.Slice(curves, func(i, j int) bool {
+		if curves[i].Cohort == InitialCohort || curves[j].Cohort == InitialCohort {
+			return curves[i].Cohort == InitialCohort
+		}
+		return curves[i].Cohort < curves[j].Cohort
+	})
+	return curves
+}
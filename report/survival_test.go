@@ -0,0 +1,72 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifetimeTracker(t *testing.T) {
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tracker := NewLifetimeTracker()
+	snapshots := [][]string{{"a", "b"}, {"a", "b", "c"}, {"b", "c"}, {"c"}, {"c"}, {"c", "d"}}
+	for i, ids := range snapshots {
+		var scooters []*sharealyzer.Scooter
+		for _, id := range ids {
+			scooters = append(scooters, &sharealyzer.Scooter{ID: id})
+		}
+		tracker.Observe(sharealyzer.NewScrapeResult("circ", start.Add(time.Duration(i)*day), scooters))
+	}
+	lifetimes := tracker.Lifetimes(2 * day)
+	require.Len(t, lifetimes, 4)
+	assert.Equal(t, Lifetime{Provider: "circ", ScooterID: "a", FirstSeen: start, LastSeen: start.Add(day), Initial: true, Retired: true}, lifetimes[0])
+	assert.Equal(t, Lifetime{Provider: "circ", ScooterID: "b", FirstSeen: start, LastSeen: start.Add(2 * day), Initial: true, Retired: true}, lifetimes[1])
+	assert.Equal(t, Lifetime{Provider: "circ", ScooterID: "c", FirstSeen: start.Add(day), LastSeen: start.Add(5 * day)}, lifetimes[2])
+	assert.Equal(t, "d", lifetimes[3].ScooterID)
+	assert.False(t, lifetimes[3].Retired)
+}
+
+func TestKaplanMeier(t *testing.T) {
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	lifetime := func(days int, retired bool) Lifetime {
+		return Lifetime{FirstSeen: start, LastSeen: start.Add(time.Duration(days) * day), Retired: retired}
+	}
+	// One scooter is censored before the second retirement, which lowers the number at risk
+	curve := KaplanMeier("2019-10", []Lifetime{
+		lifetime(10, true), lifetime(30, true), lifetime(20, false), lifetime(10, true), lifetime(40, false),
+	})
+	assert.Equal(t, 5, curve.Scooters)
+	assert.Equal(t, 3, curve.Retired)
+	require.Len(t, curve.Points, 3)
+	assert.Equal(t, SurvivalPoint{AtRisk: 5, Survival: 1}, curve.Points[0])
+	assert.Equal(t, SurvivalPoint{Age: 10 * day, AtRisk: 5, Retired: 2, Survival: 0.6}, curve.Points[1])
+	assert.Equal(t, 30*day, curve.Points[2].Age)
+	assert.Equal(t, 2, curve.Points[2].AtRisk)
+	assert.InDelta(t, 0.3, curve.Points[2].Survival, 1e-9)
+	median, found := curve.MedianLifetime()
+	assert.True(t, found)
+	assert.Equal(t, 30*day, median)
+
+	_, found = KaplanMeier("", []Lifetime{lifetime(10, false)}).MedianLifetime()
+	assert.False(t, found)
+}
+
+func TestSurvivalCurves(t *testing.T) {
+	start := time.Date(2019, 10, 31, 0, 0, 0, 0, time.UTC)
+	lifetimes := []Lifetime{
+		{ScooterID: "a", FirstSeen: start, LastSeen: start.Add(time.Hour), Initial: true},
+		{ScooterID: "b", FirstSeen: start.Add(2 * time.Hour), LastSeen: start.Add(3 * time.Hour)},
+		{ScooterID: "c", FirstSeen: start.Add(48 * time.Hour), LastSeen: start.Add(50 * time.Hour)},
+	}
+	curves := SurvivalCurves(lifetimes, MonthlyCohort(time.UTC))
+	require.Len(t, curves, 3)
+	assert.Equal(t, InitialCohort, curves[0].Cohort)
+	assert.Equal(t, "2019-10", curves[1].Cohort)
+	assert.Equal(t, "2019-11", curves[2].Cohort)
+	assert.Equal(t, "2019-W44", WeeklyCohort(time.UTC)(start))
+}
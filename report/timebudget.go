@@ -0,0 +1,239 @@
+package report
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+)
+
+// Missing is the state of a known scooter which is absent from a scrape result, i.e. because it is collected
+// for charging or repair
+const Missing = sharealyzer.Missing
+
+// DefaultMaxMissing is the time after which a missing scooter is considered gone and no longer accounted for
+const DefaultMaxMissing = 7 * 24 * time.Hour
+
+// TimeBudget is the time a scooter spent in each state on a day
+type TimeBudget struct {
+	Provider  string `json:"provider"`
+	ScooterID string `json:"scooter_id"`
+	Day       string `json:"day"`
+	// Hours are the hours spent per state
+	Hours map[sharealyzer.ScooterState]float64 `json:"hours"`
+}
+
+// Total returns the hours accounted for in all states
+func (b TimeBudget) Total() float64 {
+	total := 0.0
+	for _, hours := range b.Hours {
+		total += hours
+	}
+	return total
+}
+
+// FleetTimeBudget is the time all scooters spent in each state on a day
+type FleetTimeBudget struct {
+	Day      string `json:"day"`
+	Scooters int    `json:"scooters"`
+	// Hours are the hours spent per state summed over all scooters
+	Hours map[sharealyzer.ScooterState]float64 `json:"hours"`
+}
+
+// Share returns the fraction of the accounted time the fleet spent in state
+func (b FleetTimeBudget) Share(state sharealyzer.ScooterState) float64 {
+	total := 0.0
+	for _, hours := range b.Hours {
+		total += hours
+	}
+	if total == 0 {
+		return 0
+	}
+	return b.Hours[state] / total
+}
+
+type budgetKey struct {
+	provider  string
+	scooterID string
+}
+
+// TimeBudgetTracker accounts the time every scooter spends in each state per day from a sequence of scrape
+// results
+type TimeBudgetTracker struct {
+	// Location is the time zone of the days
+	Location *time.Location
+	// MaxInterval is the longest time a scrape result accounts for, so outages aren't attributed to any
+	// state. Defaults to sharealyzer.DefaultMaxScrapeGap.
+	MaxInterval time.Duration
+	// MaxMissing is the time a scooter may be missing before it is no longer accounted for. Defaults to
+	// DefaultMaxMissing.
+	MaxMissing time.Duration
+
+	budgets  map[budgetKey]map[string]map[sharealyzer.ScooterState]float64
+	states   map[budgetKey]sharealyzer.ScooterState
+	lastSeen map[budgetKey]time.Time
+	lastDate time.Time
+}
+
+// NewTimeBudgetTracker creates a TimeBudgetTracker with days in loc
+func NewTimeBudgetTracker(loc *time.Location) *TimeBudgetTracker {
+	return &TimeBudgetTracker{
+		Location:    loc,
+		MaxInterval: sharealyzer.DefaultMaxScrapeGap,
+		MaxMissing:  DefaultMaxMissing,
+		budgets:     make(map[budgetKey]map[string]map[sharealyzer.ScooterState]float64),
+		states:      make(map[budgetKey]sharealyzer.ScooterState),
+		lastSeen:    make(map[budgetKey]time.Time),
+	}
+}
+
+// Observe accounts the time since the previous scrape result to the states the scooters had in it and
+// records the states of this result. Results out of order are ignored.
+func (t *TimeBudgetTracker) Observe(res sharealyzer.ScrapeResult) {
+	date := res.ScrapeDate()
+	if !t.lastDate.IsZero() {
+		if !date.After(t.lastDate) {
+			return
+		}
+		end := date
+		if end.Sub(t.lastDate) > t.MaxInterval {
+			end = t.lastDate.Add(t.MaxInterval)
+		}
+		for key, state := range t.states {
+			t.account(key, state, t.lastDate, end)
+		}
+	}
+
+	seen := make(map[budgetKey]bool)
+	for _, scooter := range res.Scooters() {
+		provider := scooter.Provider
+		if provider == "" {
+			provider = res.Provider()
+		}
+		key := budgetKey{provider: provider, scooterID: scooter.ID}
+		seen[key] = true
+		t.states[key] = scooter.State
+		t.lastSeen[key] = date
+	}
+	for key := range t.states {
+		if seen[key] {
+			continue
+		}
+		if date.Sub(t.lastSeen[key]) > t.MaxMissing {
+			delete(t.states, key)
+			delete(t.lastSeen, key)
+			continue
+		}
+		t.states[key] = Missing
+	}
+	t.lastDate = date
+}
+
+// account adds the time from from to to to the state of a scooter
+func (t *TimeBudgetTracker) account(key budgetKey, state sharealyzer.ScooterState, from, to time.Time) {
+	days := t.budgets[key]
+	if days == nil {
+		days = make(map[string]map[sharealyzer.ScooterState]float64)
+		t.budgets[key] = days
+	}
+	t.splitDays(from, to, func(name string, hours float64) {
+		if days[name] == nil {
+			days[name] = make(map[sharealyzer.ScooterState]float64)
+		}
+		days[name][state] += hours
+	})
+}
+
+// splitDays calls fn with the name and the hours of every day between from and to, split at midnight
+func (t *TimeBudgetTracker) splitDays(from, to time.Time, fn func(name string, hours float64)) {
+	for from.Before(to) {
+		local := from.In(t.Location)
+		year, month, day := local.Date()
+		end := time.Date(year, month, day+1, 0, 0, 0, 0, t.Location)
+		if end.After(to) {
+			end = to
+		}
+		fn(local.Format("2006-01-02"), end.Sub(from).Hours())
+		from = end
+	}
+}
+
+// AddTrips accounts the time during customer trips as in use instead of missing. Providers like circ hide
+// rented scooters, so their scooters are absent from the scrape results while on a trip. The trips need to
+// be added after the results up to their end were observed.
+func (t *TimeBudgetTracker) AddTrips(trips []*sharealyzer.Trip) {
+	for _, trip := range trips {
+		if trip.Type != sharealyzer.CUSTOMER_TRIP {
+			continue
+		}
+		days := t.budgets[budgetKey{provider: trip.ScooterProvider, scooterID: trip.ScooterID}]
+		if days == nil {
+			continue
+		}
+		t.splitDays(trip.StartTime, trip.EndTime, func(name string, hours float64) {
+			budget := days[name]
+			if budget == nil {
+				return
+			}
+			// Only time the scooter was missing is in use, results may have missed parts of the trip
+			inUse := math.Min(hours, budget[Missing])
+			if inUse <= 0 {
+				return
+			}
+			budget[sharealyzer.InUse] += inUse
+			if budget[Missing] -= inUse; budget[Missing] == 0 {
+				delete(budget, Missing)
+			}
+		})
+	}
+}
+
+// Budgets returns the time budgets of all scooters ordered by day, provider and scooter
+func (t *TimeBudgetTracker) Budgets() []TimeBudget {
+	var budgets []TimeBudget
+	for key, days := range t.budgets {
+		for day, hours := range days {
+			budget := TimeBudget{Provider: key.provider, ScooterID: key.scooterID, Day: day,
+				Hours: make(map[sharealyzer.ScooterState]float64, len(hours))}
+			for state, h := range hours {
+				budget.Hours[state] = h
+			}
+			budgets = append(budgets, budget)
+		}
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		if budgets[i].Day != budgets[j].Day {
+			return budgets[i].Day < budgets[j].Day
+		}
+		if budgets[i].Provider != budgets[j].Provider {
+			return budgets[i].Provider < budgets[j].Provider
+		}
+		return budgets[i].ScooterID < budgets[j].ScooterID
+	})
+	return budgets
+}
+
+// FleetTimeBudgets sums the time budgets of the scooters per day, ordered by day
+func FleetTimeBudgets(budgets []TimeBudget) []FleetTimeBudget {
+	fleet := make(map[string]*FleetTimeBudget)
+	var days []string
+	for _, budget := range budgets {
+		f, exists := fleet[budget.Day]
+		if !exists {
+			f = &FleetTimeBudget{Day: budget.Day, Hours: make(map[sharealyzer.ScooterState]float64)}
+			fleet[budget.Day] = f
+			days = append(days, budget.Day)
+		}
+		f.Scooters++
+		for state, hours := range budget.Hours {
+			f.Hours[state] += hours
+		}
+	}
+	sort.Strings(days)
+	result := make([]FleetTimeBudget, len(days))
+	for i, day := range days {
+		result[i] = *fleet[day]
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeBudgetTracker(t *testing.T) {
+	start := time.Date(2019, 10, 7, 23, 0, 0, 0, time.UTC)
+	scooter := func(id string, state sharealyzer.ScooterState) *sharealyzer.Scooter {
+		return &sharealyzer.Scooter{ID: id, State: state}
+	}
+	tracker := NewTimeBudgetTracker(time.UTC)
+	tracker.MaxInterval = 2 * time.Hour
+	tracker.MaxMissing = time.Hour
+	for _, snapshot := range []struct {
+		offset   time.Duration
+		scooters []*sharealyzer.Scooter
+	}{
+		{0, []*sharealyzer.Scooter{scooter("a", sharealyzer.IdleRentable), scooter("b", sharealyzer.IdleRentable)}},
+		{30 * time.Minute, []*sharealyzer.Scooter{scooter("a", sharealyzer.InUse)}},
+		// Out of order
+		{20 * time.Minute, []*sharealyzer.Scooter{scooter("a", sharealyzer.Broken)}},
+		// b is missing for longer than allowed and forgotten
+		{90 * time.Minute, []*sharealyzer.Scooter{scooter("a", sharealyzer.Broken)}},
+		{2 * time.Hour, nil},
+		{3 * time.Hour, []*sharealyzer.Scooter{scooter("a", sharealyzer.IdleRentable)}},
+	} {
+		tracker.Observe(sharealyzer.NewScrapeResult("circ", start.Add(snapshot.offset), snapshot.scooters))
+	}
+
+	budgets := tracker.Budgets()
+	require.Len(t, budgets, 4)
+	assert.Equal(t, TimeBudget{Provider: "circ", ScooterID: "a", Day: "2019-10-07", Hours: map[sharealyzer.ScooterState]float64{
+		sharealyzer.IdleRentable: 0.5, sharealyzer.InUse: 0.5,
+	}}, budgets[0])
+	assert.Equal(t, TimeBudget{Provider: "circ", ScooterID: "b", Day: "2019-10-07", Hours: map[sharealyzer.ScooterState]float64{
+		sharealyzer.IdleRentable: 0.5, Missing: 0.5,
+	}}, budgets[1])
+	assert.Equal(t, TimeBudget{Provider: "circ", ScooterID: "a", Day: "2019-10-08", Hours: map[sharealyzer.ScooterState]float64{
+		sharealyzer.InUse: 0.5, sharealyzer.Broken: 0.5, Missing: 1,
+	}}, budgets[2])
+	assert.Equal(t, 2.0, budgets[2].Total())
+	assert.Equal(t, "b", budgets[3].ScooterID)
+	assert.Equal(t, map[sharealyzer.ScooterState]float64{Missing: 0.5}, budgets[3].Hours)
+
+	fleet := FleetTimeBudgets(budgets)
+	require.Len(t, fleet, 2)
+	assert.Equal(t, "2019-10-07", fleet[0].Day)
+	assert.Equal(t, 2, fleet[0].Scooters)
+	assert.Equal(t, 0.5, fleet[0].Share(sharealyzer.IdleRentable))
+	assert.Equal(t, map[sharealyzer.ScooterState]float64{
+		sharealyzer.InUse: 0.5, sharealyzer.Broken: 0.5, Missing: 1.5,
+	}, fleet[1].Hours)
+	assert.Zero(t, FleetTimeBudget{}.Share(Missing))
+}
+
+func TestTimeBudgetTrackerAddTrips(t *testing.T) {
+	start := time.Date(2019, 10, 7, 23, 0, 0, 0, time.UTC)
+	idle := []*sharealyzer.Scooter{{ID: "a", State: sharealyzer.IdleRentable}}
+	tracker := NewTimeBudgetTracker(time.UTC)
+	tracker.MaxInterval = 2 * time.Hour
+	tracker.MaxMissing = 4 * time.Hour
+	for _, snapshot := range []struct {
+		offset   time.Duration
+		scooters []*sharealyzer.Scooter
+	}{
+		{0, idle},
+		{30 * time.Minute, nil},
+		{90 * time.Minute, nil},
+		{2 * time.Hour, idle},
+		{3 * time.Hour, nil},
+		{4 * time.Hour, idle},
+	} {
+		tracker.Observe(sharealyzer.NewScrapeResult("circ", start.Add(snapshot.offset), snapshot.scooters))
+	}
+
+	tracker.AddTrips([]*sharealyzer.Trip{
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.CUSTOMER_TRIP,
+			StartTime: start.Add(30 * time.Minute), EndTime: start.Add(2 * time.Hour)},
+		// Only customer trips are in use
+		{ScooterProvider: "circ", ScooterID: "a", Type: sharealyzer.CHARGING_TRIP,
+			StartTime: start.Add(3 * time.Hour), EndTime: start.Add(4 * time.Hour)},
+		{ScooterProvider: "circ", ScooterID: "unknown", Type: sharealyzer.CUSTOMER_TRIP,
+			StartTime: start, EndTime: start.Add(time.Hour)},
+	})
+
+	budgets := tracker.Budgets()
+	require.Len(t, budgets, 2)
+	assert.Equal(t, map[sharealyzer.ScooterState]float64{
+		sharealyzer.IdleRentable: 0.5, sharealyzer.InUse: 0.5,
+	}, budgets[0].Hours)
+	assert.Equal(t, map[sharealyzer.ScooterState]float64{
+		sharealyzer.InUse: 1, sharealyzer.IdleRentable: 1, Missing: 1,
+	}, budgets[1].Hours)
+}
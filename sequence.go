@@ -0,0 +1,125 @@
+package sharealyzer
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultReorderWindow is how long scrape results wait for older results which arrive late
+const DefaultReorderWindow = 2 * time.Minute
+
+// SequenceStats count the scrape results which a Sequencer had to fix
+type SequenceStats struct {
+	// Reordered results arrived after a newer result
+	Reordered int `json:"reordered"`
+	// Duplicates had the same scrape date as another result
+	Duplicates int `json:"duplicates"`
+	// Late results arrived after newer results were already sent and were dropped
+	Late int `json:"late"`
+}
+
+func (s SequenceStats) String() string {
+	return fmt.Sprintf("reordered %d, dropped %d duplicates and %d late results", s.Reordered, s.Duplicates, s.Late)
+}
+
+// Sequencer brings scrape results into the order of their scrape dates before they are aggregated. Clock
+// jumps or several scrapers writing into the same archive result in dates which are out of order or
+// duplicated, which the trip detection can't deal with. Results are held back until a result at least
+// Window newer arrived and sent sorted. Of several results with the same date only the one with the most
+// scooters is kept. It is safe for concurrent use.
+type Sequencer struct {
+	// Window is how long results wait for older ones, 0 only drops duplicates and late results
+	Window time.Duration
+
+	lock  sync.Mutex
+	stats SequenceStats
+}
+
+type resultHeap []ScrapeResult
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].ScrapeDate().Before(h[j].ScrapeDate()) }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(ScrapeResult)) }
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	res := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return res
+}
+
+// Stats returns the counts of all fixed results so far
+func (s *Sequencer) Stats() SequenceStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+func (s *Sequencer) count(fn func(stats *SequenceStats)) {
+	s.lock.Lock()
+	fn(&s.stats)
+	s.lock.Unlock()
+}
+
+// Sequence sends the results from in sorted by their scrape date and without duplicates
+func (s *Sequencer) Sequence(in <-chan ScrapeResult) <-chan ScrapeResult {
+	out := make(chan ScrapeResult, 100)
+	go func() {
+		var buffered resultHeap
+		var newest, released time.Time
+		// pending is the next result to send, it is held back until the next date is known to replace it by
+		// a duplicate with more scooters
+		var pending ScrapeResult
+		release := func(res ScrapeResult) {
+			if pending != nil && res.ScrapeDate().Equal(pending.ScrapeDate()) {
+				s.count(func(stats *SequenceStats) { stats.Duplicates++ })
+				if len(res.Scooters()) > len(pending.Scooters()) {
+					pending = res
+				}
+				return
+			}
+			if pending != nil {
+				out <- pending
+			}
+			pending = res
+			released = res.ScrapeDate()
+		}
+
+		for res := range in {
+			date := res.ScrapeDate()
+			if pending != nil && date.Equal(pending.ScrapeDate()) {
+				// Not sent yet, so it might still be replaced
+				release(res)
+				continue
+			}
+			if !released.IsZero() && date.Before(released) {
+				s.count(func(stats *SequenceStats) { stats.Late++ })
+				continue
+			}
+			if date.Before(newest) {
+				s.count(func(stats *SequenceStats) { stats.Reordered++ })
+			} else {
+				newest = date
+			}
+			heap.Push(&buffered, res)
+			for buffered.Len() > 0 && newest.Sub(buffered[0].ScrapeDate()) >= s.Window {
+				release(heap.Pop(&buffered).(ScrapeResult))
+			}
+		}
+		for buffered.Len() > 0 {
+			release(heap.Pop(&buffered).(ScrapeResult))
+		}
+		if pending != nil {
+			out <- pending
+		}
+		close(out)
+		if stats := s.Stats(); stats != (SequenceStats{}) {
+			log.Printf("[WARNING] Fixed the order of scrape results: %s", stats)
+		}
+	}()
+	return out
+}
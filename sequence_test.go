@@ -0,0 +1,67 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sequence(sequencer *Sequencer, results []ScrapeResult) []ScrapeResult {
+	in := make(chan ScrapeResult, len(results))
+	for _, res := range results {
+		in <- res
+	}
+	close(in)
+	var sequenced []ScrapeResult
+	for res := range sequencer.Sequence(in) {
+		sequenced = append(sequenced, res)
+	}
+	return sequenced
+}
+
+func TestSequencer(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int, scooters int) ScrapeResult {
+		return NewScrapeResult("circ", start.Add(time.Duration(minutes)*time.Minute), make([]*Scooter, scooters))
+	}
+	complete := at(2, 3)
+	results := []ScrapeResult{
+		at(0, 1),
+		at(2, 1),
+		// A second scraper wrote a more complete result at the same time
+		complete,
+		// The clock jumped back
+		at(1, 1),
+		at(3, 1),
+		at(2, 1),
+		at(6, 1),
+		// Too late, newer results were already released
+		at(1, 1),
+		at(5, 1),
+		at(7, 1),
+	}
+
+	sequencer := &Sequencer{Window: 2 * time.Minute}
+	var minutes []int
+	sequenced := sequence(sequencer, results)
+	for _, res := range sequenced {
+		minutes = append(minutes, int(res.ScrapeDate().Sub(start).Minutes()))
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 5, 6, 7}, minutes)
+	assert.Equal(t, complete, sequenced[2])
+	assert.Equal(t, SequenceStats{Reordered: 3, Duplicates: 2, Late: 1}, sequencer.Stats())
+}
+
+func TestSequencerWithoutWindow(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	results := []ScrapeResult{
+		NewScrapeResult("circ", start, nil),
+		NewScrapeResult("circ", start.Add(time.Minute), nil),
+		NewScrapeResult("circ", start, nil),
+		NewScrapeResult("circ", start.Add(time.Minute), nil),
+	}
+	sequencer := &Sequencer{}
+	assert.Equal(t, results[:2], sequence(sequencer, results))
+	assert.Equal(t, SequenceStats{Duplicates: 1, Late: 1}, sequencer.Stats())
+}
@@ -0,0 +1,263 @@
+// Package sim simulates a scooter sharing fleet. It generates the scrape results a scraper would see,
+// together with the trips which really happened, so trip detection can be tested and demonstrated
+// without data of a real provider. The same options and seed always generate the same fleet.
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/umahmood/haversine"
+)
+
+// DemandCurve is the relative demand for every hour of the day between 0 and 1
+type DemandCurve [24]float64
+
+// DefaultDemandCurve has little demand at night and peaks during the commutes and in the afternoon
+func DefaultDemandCurve() DemandCurve {
+	return DemandCurve{
+		0.1, 0.05, 0.05, 0.05, 0.05, 0.1, 0.3, 0.8, 1.0, 0.6, 0.4, 0.5,
+		0.6, 0.6, 0.6, 0.7, 0.9, 1.0, 0.8, 0.6, 0.5, 0.4, 0.3, 0.2,
+	}
+}
+
+// Options describe the simulated fleet and how often it is scraped
+type Options struct {
+	// Provider is the provider of the scrape results and trips
+	Provider string
+	// Scooters is the size of the fleet
+	Scooters int
+	// Area is where the fleet is deployed
+	Area sharealyzer.BoundingBox
+	// From is the date of the first scrape, the demand curve uses its zone
+	From time.Time
+	// Scrapes is the number of scrape results
+	Scrapes int
+	// Interval is the time between two scrapes
+	Interval time.Duration
+	// TripProbability is the chance of an available scooter to be rented between two scrapes at peak demand
+	TripProbability float64
+	// Demand scales TripProbability by the hour of the day
+	Demand DemandCurve
+	// RelocationProbability is the chance of an available scooter to be relocated by the provider between
+	// two scrapes
+	RelocationProbability float64
+	// ChargeLevel is the charge level below which scooters are taken away for charging
+	ChargeLevel float64
+	// Seed makes the simulation reproducible
+	Seed int64
+}
+
+// DefaultOptions describe a day of scrapes every minute of a fleet of 500 scooters in Dortmund
+func DefaultOptions() Options {
+	return Options{
+		Provider:              "sim",
+		Scooters:              500,
+		Area:                  sharealyzer.BoundingBox{LatTopLeft: 51.582780, LonTopLeft: 7.325945, LatBottomRight: 51.475727, LonBottomRight: 7.558172},
+		From:                  time.Date(2019, 10, 6, 0, 0, 0, 0, time.UTC),
+		Scrapes:               24 * 60,
+		Interval:              time.Minute,
+		TripProbability:       0.01,
+		Demand:                DefaultDemandCurve(),
+		RelocationProbability: 0.0005,
+		ChargeLevel:           15,
+		Seed:                  1,
+	}
+}
+
+// simulatedScooter is a scooter of the fleet and the trip it is on
+type simulatedScooter struct {
+	scooter sharealyzer.Scooter
+	trip    *sharealyzer.Trip
+	// tripScrapes is the number of scrapes until the scooter is available again, 0 if it is available
+	tripScrapes int
+}
+
+// Simulation generates the scrape results of a simulated fleet one by one
+type Simulation struct {
+	opts   Options
+	random *rand.Rand
+	fleet  []*simulatedScooter
+	scrape int
+	trips  []*sharealyzer.Trip
+}
+
+// New creates a simulation of a fleet described by opts
+func New(opts Options) *Simulation {
+	s := &Simulation{opts: opts, random: rand.New(rand.NewSource(opts.Seed))}
+	s.fleet = make([]*simulatedScooter, opts.Scooters)
+	for i := range s.fleet {
+		s.fleet[i] = &simulatedScooter{scooter: sharealyzer.Scooter{
+			ID:             fmt.Sprintf("SIM-%05d", i),
+			Provider:       opts.Provider,
+			State:          sharealyzer.IdleRentable,
+			Location:       s.randomLocation(),
+			ChargeLevel:    float64(10 + s.random.Intn(91)),
+			QRContent:      fmt.Sprintf("QR%05d", i),
+			StateUpdatedAt: opts.From,
+			InitPrice:      100,
+			UnitPrice:      15,
+		}}
+	}
+	return s
+}
+
+// Done returns true once all scrapes were generated
+func (s *Simulation) Done() bool {
+	return s.scrape >= s.opts.Scrapes
+}
+
+// Next advances the simulation by one scrape interval and returns the scrape result of the available
+// scooters. It returns nil once all scrapes were generated.
+func (s *Simulation) Next() sharealyzer.ScrapeResult {
+	if s.Done() {
+		return nil
+	}
+	date := s.opts.From.Add(time.Duration(s.scrape) * s.opts.Interval)
+	demand := s.opts.TripProbability * s.opts.Demand[date.In(s.opts.From.Location()).Hour()]
+	available := make([]*sharealyzer.Scooter, 0, len(s.fleet))
+	for _, sim := range s.fleet {
+		if sim.tripScrapes > 0 {
+			sim.tripScrapes--
+			if sim.tripScrapes > 0 {
+				continue
+			}
+			s.finish(sim, date)
+		} else if s.scrape > 0 {
+			if s.start(sim, date, demand) {
+				continue
+			}
+		}
+		// Every scrape gets its own copies, so the scrape results stay untouched by the simulation
+		scooter := sim.scooter
+		scooter.LastUpdate = date
+		available = append(available, &scooter)
+	}
+	s.scrape++
+	return sharealyzer.NewScrapeResult(s.opts.Provider, date, available)
+}
+
+// start sends an available scooter on a trip if it is due for charging, relocated or rented
+func (s *Simulation) start(sim *simulatedScooter, date time.Time, demand float64) bool {
+	var tripType sharealyzer.TripType
+	switch {
+	case sim.scooter.ChargeLevel < s.opts.ChargeLevel:
+		tripType = sharealyzer.CHARGING_TRIP
+		sim.tripScrapes = s.scrapes(2*time.Hour, 8*time.Hour)
+	case s.random.Float64() < s.opts.RelocationProbability:
+		tripType = sharealyzer.RELOCATION_TRIP
+		sim.tripScrapes = s.scrapes(10*time.Minute, 40*time.Minute)
+	case s.random.Float64() < demand:
+		tripType = sharealyzer.CUSTOMER_TRIP
+		sim.tripScrapes = s.scrapes(3*time.Minute, 30*time.Minute)
+	default:
+		return false
+	}
+	sim.trip = &sharealyzer.Trip{
+		ID:               sharealyzer.TripID(s.opts.Provider, sim.scooter.ID, date),
+		ScooterID:        sim.scooter.ID,
+		ScooterProvider:  s.opts.Provider,
+		StartChargeLevel: sim.scooter.ChargeLevel,
+		StartLocation:    sim.scooter.Location,
+		StartTime:        date,
+		Type:             tripType,
+	}
+	return true
+}
+
+// finish makes a scooter available again at the end of its trip
+func (s *Simulation) finish(sim *simulatedScooter, date time.Time) {
+	trip := sim.trip
+	switch trip.Type {
+	case sharealyzer.CHARGING_TRIP:
+		sim.scooter.Location = s.randomLocation()
+		sim.scooter.ChargeLevel = 100
+		sim.scooter.StateUpdatedByUserID = "staff"
+	case sharealyzer.RELOCATION_TRIP:
+		// Relocated scooters are moved far, but hardly lose any charge on a van
+		sim.scooter.Location = s.move(sim.scooter.Location, 1.5+s.random.Float64()*2)
+		sim.scooter.StateUpdatedByUserID = "staff"
+	default:
+		sim.scooter.Location = s.move(sim.scooter.Location, 0.3+s.random.Float64()*3.7)
+		sim.scooter.ChargeLevel = math.Max(0, sim.scooter.ChargeLevel-float64(2+s.random.Intn(9)))
+		sim.scooter.StateUpdatedByUserID = fmt.Sprintf("user-%d", s.random.Intn(len(s.fleet)*4+1))
+	}
+	sim.scooter.StateUpdatedAt = date
+
+	trip.EndChargeLevel = sim.scooter.ChargeLevel
+	trip.EndLocation = sim.scooter.Location
+	trip.UserID = sim.scooter.StateUpdatedByUserID
+	trip.EndTime = date
+	trip.Duration = trip.EndTime.Sub(trip.StartTime)
+	trip.Tariff = &sharealyzer.Tariff{InitPrice: sim.scooter.InitPrice, UnitPrice: sim.scooter.UnitPrice}
+	trip.Cost = trip.Tariff.Cost(trip.Duration)
+	_, trip.Distance = haversine.Distance(
+		haversine.Coord{Lat: trip.StartLocation.Latitude, Lon: trip.StartLocation.Longitude},
+		haversine.Coord{Lat: trip.EndLocation.Latitude, Lon: trip.EndLocation.Longitude},
+	)
+	s.trips = append(s.trips, trip)
+	sim.trip = nil
+}
+
+// scrapes returns a random number of scrapes lasting between min and max, at least one
+func (s *Simulation) scrapes(min, max time.Duration) int {
+	n := int((min + time.Duration(s.random.Int63n(int64(max-min)+1))) / s.opts.Interval)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (s *Simulation) randomLocation() *sharealyzer.GeoLocation {
+	area := s.opts.Area
+	return sharealyzer.NewGeoLocation(
+		area.LatBottomRight+s.random.Float64()*(area.LatTopLeft-area.LatBottomRight),
+		area.LonTopLeft+s.random.Float64()*(area.LonBottomRight-area.LonTopLeft),
+	)
+}
+
+// move returns a location about km kilometers away from loc in a random direction within the area. The
+// opposite direction is taken if the destination is outside of the area.
+func (s *Simulation) move(loc *sharealyzer.GeoLocation, km float64) *sharealyzer.GeoLocation {
+	angle := s.random.Float64() * 2 * math.Pi
+	dLat := km * math.Cos(angle) / 111.32
+	dLon := km * math.Sin(angle) / (111.32 * math.Cos(loc.Latitude*math.Pi/180))
+	dest := sharealyzer.NewGeoLocation(loc.Latitude+dLat, loc.Longitude+dLon)
+	if !s.opts.Area.Contains(dest) {
+		dest = sharealyzer.NewGeoLocation(loc.Latitude-dLat, loc.Longitude-dLon)
+	}
+	area := s.opts.Area
+	dest.Latitude = math.Min(math.Max(dest.Latitude, area.LatBottomRight), area.LatTopLeft)
+	dest.Longitude = math.Min(math.Max(dest.Longitude, area.LonTopLeft), area.LonBottomRight)
+	return dest
+}
+
+// Trips returns the trips which finished so far ordered by their end, they must not be modified
+func (s *Simulation) Trips() []*sharealyzer.Trip {
+	return s.trips
+}
+
+// Results sends the scrape results of all remaining scrapes and closes the channel afterwards
+func (s *Simulation) Results() <-chan sharealyzer.ScrapeResult {
+	out := make(chan sharealyzer.ScrapeResult, 100)
+	go func() {
+		for res := s.Next(); res != nil; res = s.Next() {
+			out <- res
+		}
+		close(out)
+	}()
+	return out
+}
+
+// Generate runs a whole simulation and returns its scrape results and finished trips
+func Generate(opts Options) ([]sharealyzer.ScrapeResult, []*sharealyzer.Trip) {
+	s := New(opts)
+	results := make([]sharealyzer.ScrapeResult, 0, opts.Scrapes)
+	for res := s.Next(); res != nil; res = s.Next() {
+		results = append(results, res)
+	}
+	return results, s.Trips()
+}
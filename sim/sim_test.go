@@ -0,0 +1,74 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/dereulenspiegel/sharealyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.Scooters = 100
+	opts.Scrapes = 12 * 60
+	opts.RelocationProbability = 0.002
+	return opts
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	results, trips := Generate(testOptions())
+	again, againTrips := Generate(testOptions())
+	require.Len(t, results, 12*60)
+	assert.Equal(t, results, again)
+	assert.Equal(t, trips, againTrips)
+
+	opts := testOptions()
+	opts.Seed = 2
+	_, otherTrips := Generate(opts)
+	assert.NotEqual(t, trips, otherTrips)
+}
+
+func TestSimulatedTrips(t *testing.T) {
+	opts := testOptions()
+	results, trips := Generate(opts)
+	assert.Len(t, results[0].Scooters(), opts.Scooters)
+
+	byType := make(map[sharealyzer.TripType]int)
+	for _, trip := range trips {
+		byType[trip.Type]++
+		assert.True(t, trip.EndTime.After(trip.StartTime))
+		assert.True(t, opts.Area.Contains(trip.EndLocation))
+	}
+	assert.NotZero(t, byType[sharealyzer.CUSTOMER_TRIP])
+	assert.NotZero(t, byType[sharealyzer.RELOCATION_TRIP])
+	assert.NotZero(t, byType[sharealyzer.CHARGING_TRIP])
+
+	// Demand is highest during the morning commute
+	hours := make(map[int]int)
+	for _, trip := range trips {
+		if trip.Type == sharealyzer.CUSTOMER_TRIP {
+			hours[trip.StartTime.Hour()]++
+		}
+	}
+	assert.True(t, hours[8] > hours[3])
+}
+
+func TestTripAggregatorFindsSimulatedTrips(t *testing.T) {
+	s := New(testOptions())
+	aggregator := sharealyzer.NewTripAggregator()
+	aggregator.OpenTrips = func(trip *sharealyzer.Trip) {}
+	detected := make(map[string]*sharealyzer.Trip)
+	for trip := range sharealyzer.ClassifyTrip(aggregator.Aggregate(s.Results())) {
+		detected[trip.ID] = trip
+	}
+
+	require.NotEmpty(t, s.Trips())
+	assert.Len(t, detected, len(s.Trips()))
+	for _, expected := range s.Trips() {
+		trip, exists := detected[expected.ID]
+		if assert.True(t, exists, expected.ID) {
+			assert.Equal(t, expected, trip)
+		}
+	}
+}
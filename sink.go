@@ -0,0 +1,177 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TripSink consumes batches of trips, i.e. by inserting them into a database or publishing them
+type TripSink interface {
+	StoreTrips(trips []*Trip) error
+}
+
+// TripStoreSink stores the trips of every batch one by one in a TripStore
+type TripStoreSink struct {
+	TripStore
+}
+
+// StoreTrips stores all trips of the batch
+func (s TripStoreSink) StoreTrips(trips []*Trip) error {
+	for _, trip := range trips {
+		if err := s.Store(trip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultSinkQueueSize is the number of batches a sink may fall behind the fastest sink
+const DefaultSinkQueueSize = 16
+
+// SinkGroup delivers batches of trips to several sinks concurrently. Every sink consumes the batches in
+// order on its own goroutine, so a slow sink only holds back the others once it is QueueSize batches
+// behind. A batch is acknowledged once all sinks stored it and acknowledgements happen in the order of
+// the batches. Everything up to the last acknowledged batch is stored in every sink, everything after it
+// has to be delivered again after a failure, which gives at-least-once delivery.
+type SinkGroup struct {
+	Sinks map[string]TripSink
+	// QueueSize is the number of batches queued per sink, defaults to DefaultSinkQueueSize
+	QueueSize int
+
+	lock  sync.Mutex
+	acked map[string]int
+}
+
+type sinkBatch struct {
+	seq   int
+	trips []*Trip
+}
+
+type sinkAck struct {
+	sink string
+	seq  int
+	err  error
+}
+
+// Acked returns the number of batches the sink stored so far
+func (g *SinkGroup) Acked(sink string) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.acked[sink]
+}
+
+// Deliver sends every batch from in to all sinks until in is closed and calls acked with every batch stored
+// by all sinks in order. If a sink fails, Deliver stops all sinks and returns the error without draining
+// in, so the producer needs to be stopped as well.
+func (g *SinkGroup) Deliver(in <-chan []*Trip, acked func(batch []*Trip)) error {
+	queueSize := g.QueueSize
+	if queueSize < 1 {
+		queueSize = DefaultSinkQueueSize
+	}
+	g.lock.Lock()
+	g.acked = make(map[string]int)
+	g.lock.Unlock()
+
+	acks := make(chan sinkAck, len(g.Sinks))
+	stop := make(chan struct{})
+	queues := make(map[string]chan sinkBatch)
+	var wg sync.WaitGroup
+	for name, sink := range g.Sinks {
+		queue := make(chan sinkBatch, queueSize)
+		queues[name] = queue
+		wg.Add(1)
+		go func(name string, sink TripSink) {
+			defer wg.Done()
+			for batch := range queue {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				err := sink.StoreTrips(batch.trips)
+				select {
+				case acks <- sinkAck{sink: name, seq: batch.seq, err: err}:
+				case <-stop:
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(name, sink)
+	}
+	shutdown := func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}
+
+	type pendingBatch struct {
+		trips     []*Trip
+		remaining int
+	}
+	pending := make(map[int]*pendingBatch)
+	next, seq := 0, 0
+	handleAck := func(ack sinkAck) error {
+		if ack.err != nil {
+			return fmt.Errorf("Sink %s failed: %s", ack.sink, ack.err)
+		}
+		g.lock.Lock()
+		g.acked[ack.sink]++
+		g.lock.Unlock()
+		pending[ack.seq].remaining--
+		for p, exists := pending[next]; exists && p.remaining == 0; p, exists = pending[next] {
+			delete(pending, next)
+			next++
+			if acked != nil {
+				acked(p.trips)
+			}
+		}
+		return nil
+	}
+
+	fail := func(err error) error {
+		close(stop)
+		shutdown()
+		return err
+	}
+
+	for in != nil || len(pending) > 0 {
+		select {
+		case trips, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			if len(g.Sinks) == 0 {
+				if acked != nil {
+					acked(trips)
+				}
+				continue
+			}
+			pending[seq] = &pendingBatch{trips: trips, remaining: len(g.Sinks)}
+			for _, queue := range queues {
+				// Keep handling acknowledgements while waiting for a full queue, a failed sink never
+				// empties its queue again
+				for sent := false; !sent; {
+					select {
+					case queue <- sinkBatch{seq: seq, trips: trips}:
+						sent = true
+					case ack := <-acks:
+						if err := handleAck(ack); err != nil {
+							return fail(err)
+						}
+					}
+				}
+			}
+			seq++
+		case ack := <-acks:
+			if err := handleAck(ack); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	shutdown()
+	return nil
+}
@@ -0,0 +1,102 @@
+package sharealyzer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink records the identifiers of stored trips and fails once failAfter batches were stored
+type recordingSink struct {
+	delay     time.Duration
+	failAfter int
+
+	lock sync.Mutex
+	ids  []string
+}
+
+func (r *recordingSink) StoreTrips(trips []*Trip) error {
+	time.Sleep(r.delay)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.failAfter > 0 && len(r.ids) >= r.failAfter {
+		return errors.New("sink unavailable")
+	}
+	for _, trip := range trips {
+		r.ids = append(r.ids, trip.ID)
+	}
+	return nil
+}
+
+func tripBatches(n int) <-chan []*Trip {
+	in := make(chan []*Trip)
+	go func() {
+		for i := 0; i < n; i++ {
+			in <- []*Trip{{ID: fmt.Sprintf("%02d", i)}}
+		}
+		close(in)
+	}()
+	return in
+}
+
+func TestSinkGroupAcknowledgesInOrder(t *testing.T) {
+	fast := &recordingSink{}
+	slow := &recordingSink{delay: time.Millisecond}
+	group := &SinkGroup{Sinks: map[string]TripSink{"fast": fast, "slow": slow}, QueueSize: 2}
+
+	var acked []string
+	err := group.Deliver(tripBatches(20), func(batch []*Trip) {
+		// Acknowledged batches are stored in every sink
+		slow.lock.Lock()
+		assert.Contains(t, slow.ids, batch[0].ID)
+		slow.lock.Unlock()
+		acked = append(acked, batch[0].ID)
+	})
+	require.NoError(t, err)
+	require.Len(t, acked, 20)
+	for i, id := range acked {
+		assert.Equal(t, fmt.Sprintf("%02d", i), id)
+	}
+	assert.Equal(t, acked, fast.ids)
+	assert.Equal(t, acked, slow.ids)
+	assert.Equal(t, 20, group.Acked("fast"))
+	assert.Equal(t, 20, group.Acked("slow"))
+}
+
+func TestSinkGroupStopsOnFailure(t *testing.T) {
+	failing := &recordingSink{failAfter: 5}
+	healthy := &recordingSink{}
+	group := &SinkGroup{Sinks: map[string]TripSink{"failing": failing, "healthy": healthy}, QueueSize: 1}
+
+	var acked []string
+	in := make(chan []*Trip)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case in <- []*Trip{{ID: fmt.Sprintf("%02d", i)}}:
+			case <-time.After(time.Second):
+				// Deliver stopped consuming
+				return
+			}
+		}
+	}()
+	err := group.Deliver(in, func(batch []*Trip) {
+		acked = append(acked, batch[0].ID)
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failing")
+	assert.Equal(t, 5, group.Acked("failing"))
+	// Only batches stored by both sinks were acknowledged, the healthy sink may lag behind
+	assert.True(t, len(acked) <= 5)
+	healthy.lock.Lock()
+	defer healthy.lock.Unlock()
+	for i, id := range acked {
+		assert.Equal(t, failing.ids[i], id)
+		assert.Equal(t, healthy.ids[i], id)
+	}
+}
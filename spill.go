@@ -0,0 +1,180 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// TripSpill keeps unfinished trips in a file on disk, so only a small index per trip stays in memory.
+// Trips are keyed by their scooter, since a scooter can only be on one trip at a time.
+type TripSpill struct {
+	// Dir is the directory of the spill file, the default temporary directory is used if it is empty
+	Dir string
+
+	file    *os.File
+	size    int64
+	entries map[string]spillEntry
+}
+
+type spillEntry struct {
+	offset    int64
+	length    int
+	startTime time.Time
+}
+
+func (s *TripSpill) open() error {
+	if s.file != nil {
+		return nil
+	}
+	file, err := ioutil.TempFile(s.Dir, "trips-*.spill")
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.size = 0
+	s.entries = make(map[string]spillEntry)
+	return nil
+}
+
+// Put moves the trip to disk
+func (s *TripSpill) Put(t *Trip) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		return err
+	}
+	s.entries[t.ScooterID] = spillEntry{offset: s.size, length: len(data), startTime: t.StartTime}
+	s.size = s.size + int64(len(data))
+	return nil
+}
+
+// Take reads the spilled trip of the scooter and removes it from the spill. nil is returned if the scooter
+// has no spilled trip.
+func (s *TripSpill) Take(scooterID string) (*Trip, error) {
+	entry, exists := s.entries[scooterID]
+	if !exists {
+		return nil, nil
+	}
+	data := make([]byte, entry.length)
+	if _, err := s.file.ReadAt(data, entry.offset); err != nil {
+		return nil, err
+	}
+	t := &Trip{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	s.remove(scooterID)
+	return t, nil
+}
+
+// TakeAll reads all spilled trips ordered by their scooter and empties the spill
+func (s *TripSpill) TakeAll() ([]*Trip, error) {
+	ids := make([]string, 0, len(s.entries))
+	for id := range s.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	trips := make([]*Trip, 0, len(ids))
+	for _, id := range ids {
+		trip, err := s.Take(id)
+		if err != nil {
+			return trips, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, nil
+}
+
+// TakeStartedBefore reads the spilled trips which started before the given time, ordered by their start
+// time, and removes them from the spill
+func (s *TripSpill) TakeStartedBefore(startedBefore time.Time) ([]*Trip, error) {
+	var ids []string
+	for id, entry := range s.entries {
+		if entry.startTime.Before(startedBefore) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return s.entries[ids[i]].startTime.Before(s.entries[ids[j]].startTime)
+	})
+	trips := make([]*Trip, 0, len(ids))
+	for _, id := range ids {
+		trip, err := s.Take(id)
+		if err != nil {
+			return trips, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, nil
+}
+
+// Drop removes the spilled trips which started before the given time and returns their number
+func (s *TripSpill) Drop(startedBefore time.Time) int {
+	dropped := 0
+	for id, entry := range s.entries {
+		if entry.startTime.Before(startedBefore) {
+			s.remove(id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+func (s *TripSpill) remove(scooterID string) {
+	delete(s.entries, scooterID)
+	if len(s.entries) == 0 && s.file != nil {
+		// Nothing is referenced anymore, so the file can be reused from the beginning
+		if err := s.file.Truncate(0); err == nil {
+			s.size = 0
+		}
+	}
+}
+
+// Len returns the number of spilled trips
+func (s *TripSpill) Len() int {
+	return len(s.entries)
+}
+
+// Close removes the spill file
+func (s *TripSpill) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	err := os.Remove(s.file.Name())
+	s.file = nil
+	s.entries = nil
+	return err
+}
+
+// SpillUnfinishedTrips enforces a memory budget of maxTrips unfinished trips. If the budget is exceeded the
+// trips which are inactive for the longest time are spilled, until a tenth of the budget is free again,
+// so spilling doesn't happen with every scrape. A budget of 0 disables spilling.
+func SpillUnfinishedTrips(unfinishedTrips map[string]*Trip, spill *TripSpill, maxTrips int) error {
+	if maxTrips <= 0 || spill == nil || len(unfinishedTrips) <= maxTrips {
+		return nil
+	}
+	keep := maxTrips - maxTrips/10
+	trips := make([]*Trip, 0, len(unfinishedTrips))
+	for _, trip := range unfinishedTrips {
+		trips = append(trips, trip)
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].StartTime.Before(trips[j].StartTime)
+	})
+	for _, trip := range trips[:len(trips)-keep] {
+		if err := spill.Put(trip); err != nil {
+			return err
+		}
+		delete(unfinishedTrips, trip.ScooterID)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	spill := &TripSpill{Dir: dir}
+	require.NoError(t, spill.Put(&Trip{ID: "1", ScooterID: "a", StartTime: start, StartLocation: NewGeoLocation(51.5, 7.4)}))
+	require.NoError(t, spill.Put(&Trip{ID: "2", ScooterID: "b", StartTime: start.Add(time.Hour)}))
+	assert.Equal(t, 2, spill.Len())
+
+	trip, err := spill.Take("a")
+	require.NoError(t, err)
+	require.NotNil(t, trip)
+	assert.Equal(t, "1", trip.ID)
+	assert.True(t, start.Equal(trip.StartTime))
+	assert.InDelta(t, 51.5, trip.StartLocation.Latitude, 0.0001)
+	trip, err = spill.Take("a")
+	require.NoError(t, err)
+	assert.Nil(t, trip)
+
+	assert.Equal(t, 1, spill.Drop(start.Add(2*time.Hour)))
+	assert.Equal(t, 0, spill.Len())
+
+	require.NoError(t, spill.Close())
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+// aggregateTrips runs the scrape results through aggregator and returns the trips by their identifier
+func aggregateTrips(aggregator *TripAggregator, results []ScrapeResult) map[string]Trip {
+	in := make(chan ScrapeResult, len(results))
+	for _, res := range results {
+		in <- res
+	}
+	close(in)
+	trips := make(map[string]Trip)
+	for trip := range aggregator.Aggregate(in) {
+		trips[trip.ID] = *trip
+	}
+	return trips
+}
+
+func TestTripAggregatorSpillsUnfinishedTrips(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	var fleet []*Scooter
+	for i := 0; i < 20; i++ {
+		fleet = append(fleet, &Scooter{ID: fmt.Sprintf("scooter-%d", i), ChargeLevel: 80, Location: NewGeoLocation(51.5, 7.4)})
+	}
+	// Every scooter goes on a trip one after another and shows up again ten scrapes later
+	var results []ScrapeResult
+	for scrape := 0; scrape < 40; scrape++ {
+		var available []*Scooter
+		for i, scooter := range fleet {
+			if scrape <= i || scrape > i+10 {
+				available = append(available, scooter)
+			}
+		}
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(scrape)*time.Minute), available))
+	}
+
+	expected := aggregateTrips(NewTripAggregator(), results)
+	require.Len(t, expected, 20)
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxUnfinishedTrips = 3
+	aggregator.Spill = &TripSpill{}
+	defer aggregator.Spill.Close()
+	assert.Equal(t, expected, aggregateTrips(aggregator, results))
+	assert.Equal(t, 0, aggregator.Spill.Len())
+}
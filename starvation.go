@@ -0,0 +1,224 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultHotspotCellSize is the edge length of hotspot cells in degrees, roughly 200m in latitude
+	DefaultHotspotCellSize = 0.002
+	// DefaultDayStart and DefaultDayEnd are the hours of the day during which starvation is monitored
+	DefaultDayStart = 7
+	DefaultDayEnd   = 22
+)
+
+// HotspotGrid divides the map into square cells of CellSize degrees
+type HotspotGrid struct {
+	CellSize float64
+}
+
+// HotspotCell identifies a cell of a HotspotGrid
+type HotspotCell struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+func (c HotspotCell) String() string {
+	return fmt.Sprintf("%d:%d", c.Row, c.Col)
+}
+
+// Cell returns the cell containing loc
+func (g HotspotGrid) Cell(loc *GeoLocation) HotspotCell {
+	return HotspotCell{
+		Row: int(math.Floor(loc.Latitude / g.CellSize)),
+		Col: int(math.Floor(loc.Longitude / g.CellSize)),
+	}
+}
+
+// Center returns the center of a cell
+func (g HotspotGrid) Center(cell HotspotCell) *GeoLocation {
+	return NewGeoLocation((float64(cell.Row)+0.5)*g.CellSize, (float64(cell.Col)+0.5)*g.CellSize)
+}
+
+// Hotspot is a cell in which many customer trips started
+type Hotspot struct {
+	Cell   HotspotCell  `json:"cell"`
+	Center *GeoLocation `json:"center"`
+	Trips  int          `json:"trips"`
+}
+
+// Hotspots returns the cells in which at least minTrips customer trips started, ordered by the number of
+// trips descending
+func (g HotspotGrid) Hotspots(trips []*Trip, minTrips int) []Hotspot {
+	counts := make(map[HotspotCell]int)
+	for _, trip := range trips {
+		if trip.Type == CUSTOMER_TRIP && trip.StartLocation != nil {
+			counts[g.Cell(trip.StartLocation)]++
+		}
+	}
+	var hotspots []Hotspot
+	for cell, count := range counts {
+		if count >= minTrips {
+			hotspots = append(hotspots, Hotspot{Cell: cell, Center: g.Center(cell), Trips: count})
+		}
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Trips != hotspots[j].Trips {
+			return hotspots[i].Trips > hotspots[j].Trips
+		}
+		return hotspots[i].Cell.String() < hotspots[j].Cell.String()
+	})
+	return hotspots
+}
+
+// Starvation is a time range in which a hotspot had no available scooter
+type Starvation struct {
+	Cell   HotspotCell  `json:"cell"`
+	Center *GeoLocation `json:"center"`
+	From   time.Time    `json:"from"`
+	// To is the date of the first scrape result with an available scooter in the hotspot or outside of the
+	// daytime, zero while the starvation lasts
+	To time.Time `json:"to"`
+	// Alerted is set once the starvation lasted longer than the minimum duration of the monitor
+	Alerted bool `json:"alerted"`
+}
+
+// Duration returns the length of a finished starvation
+func (s *Starvation) Duration() time.Duration {
+	if s.To.IsZero() {
+		return 0
+	}
+	return s.To.Sub(s.From)
+}
+
+// StarvationMonitor tracks hotspots without available scooters during daytime and raises an alert once a
+// hotspot starved for MinDuration
+type StarvationMonitor struct {
+	Grid     HotspotGrid
+	Hotspots []Hotspot
+	// MinDuration is the time a hotspot needs to starve before an alert is raised
+	MinDuration time.Duration
+	// Location is the time zone of DayStart and DayEnd, the hours of the day between which hotspots are
+	// monitored
+	Location         *time.Location
+	DayStart, DayEnd int
+
+	hotspots map[HotspotCell]*Hotspot
+	open     map[HotspotCell]*Starvation
+}
+
+// NewStarvationMonitor creates a monitor of the hotspots during the default daytime in loc
+func NewStarvationMonitor(grid HotspotGrid, hotspots []Hotspot, minDuration time.Duration, loc *time.Location) *StarvationMonitor {
+	m := &StarvationMonitor{
+		Grid:        grid,
+		Hotspots:    hotspots,
+		MinDuration: minDuration,
+		Location:    loc,
+		DayStart:    DefaultDayStart,
+		DayEnd:      DefaultDayEnd,
+		hotspots:    make(map[HotspotCell]*Hotspot),
+		open:        make(map[HotspotCell]*Starvation),
+	}
+	for i := range hotspots {
+		m.hotspots[hotspots[i].Cell] = &hotspots[i]
+	}
+	return m
+}
+
+// Observe evaluates the hotspots for a scrape result. It returns the starvations which reached MinDuration
+// with it and the ones which ended.
+func (m *StarvationMonitor) Observe(res ScrapeResult) (alerts, ended []*Starvation) {
+	date := res.ScrapeDate()
+	available := make(map[HotspotCell]int)
+	for _, scooter := range res.Scooters() {
+		if scooter.State == Broken || scooter.State == InUse || scooter.State == Missing || scooter.Location == nil {
+			continue
+		}
+		if cell := m.Grid.Cell(scooter.Location); m.hotspots[cell] != nil {
+			available[cell]++
+		}
+	}
+	daytime := m.daytime(date)
+	for _, hotspot := range m.Hotspots {
+		starvation, starving := m.open[hotspot.Cell]
+		switch {
+		case daytime && available[hotspot.Cell] == 0 && !starving:
+			m.open[hotspot.Cell] = &Starvation{Cell: hotspot.Cell, Center: hotspot.Center, From: date}
+		case daytime && available[hotspot.Cell] == 0:
+			if !starvation.Alerted && date.Sub(starvation.From) >= m.MinDuration {
+				starvation.Alerted = true
+				alerts = append(alerts, starvation)
+			}
+		case starving:
+			starvation.To = date
+			delete(m.open, hotspot.Cell)
+			ended = append(ended, starvation)
+		}
+	}
+	return alerts, ended
+}
+
+func (m *StarvationMonitor) daytime(date time.Time) bool {
+	hour := date.In(m.Location).Hour()
+	return hour >= m.DayStart && hour < m.DayEnd
+}
+
+// Open returns the starvations which didn't end yet ordered by cell
+func (m *StarvationMonitor) Open() []*Starvation {
+	open := make([]*Starvation, 0, len(m.open))
+	for _, starvation := range m.open {
+		open = append(open, starvation)
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].Cell.String() < open[j].Cell.String()
+	})
+	return open
+}
+
+// StarvationStats summarizes the finished starvations of a hotspot
+type StarvationStats struct {
+	Cell        HotspotCell   `json:"cell"`
+	Center      *GeoLocation  `json:"center"`
+	Starvations int           `json:"starvations"`
+	Alerts      int           `json:"alerts"`
+	Total       time.Duration `json:"total"`
+	Longest     time.Duration `json:"longest"`
+}
+
+// SummarizeStarvations returns statistics of the finished starvations per hotspot, ordered by the total
+// starvation time descending
+func SummarizeStarvations(starvations []*Starvation) []StarvationStats {
+	byCell := make(map[HotspotCell]*StarvationStats)
+	for _, starvation := range starvations {
+		if starvation.To.IsZero() {
+			continue
+		}
+		stats, exists := byCell[starvation.Cell]
+		if !exists {
+			stats = &StarvationStats{Cell: starvation.Cell, Center: starvation.Center}
+			byCell[starvation.Cell] = stats
+		}
+		stats.Starvations++
+		if starvation.Alerted {
+			stats.Alerts++
+		}
+		stats.Total += starvation.Duration()
+		if starvation.Duration() > stats.Longest {
+			stats.Longest = starvation.Duration()
+		}
+	}
+	result := make([]StarvationStats, 0, len(byCell))
+	for _, stats := range byCell {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Cell.String() < result[j].Cell.String()
+	})
+	return result
+}
@@ -0,0 +1,68 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotspotGrid(t *testing.T) {
+	grid := HotspotGrid{CellSize: 0.01}
+	cell := grid.Cell(NewGeoLocation(51.505, 7.405))
+	assert.Equal(t, HotspotCell{Row: 5150, Col: 740}, cell)
+	assert.InDelta(t, 51.505, grid.Center(cell).Latitude, 1e-9)
+
+	trip := func(lat float64, tripType TripType) *Trip {
+		return &Trip{Type: tripType, StartLocation: NewGeoLocation(lat, 7.405)}
+	}
+	hotspots := grid.Hotspots([]*Trip{
+		trip(51.505, CUSTOMER_TRIP), trip(51.506, CUSTOMER_TRIP), trip(51.507, CUSTOMER_TRIP),
+		trip(51.515, CUSTOMER_TRIP), trip(51.516, CUSTOMER_TRIP),
+		trip(51.525, CUSTOMER_TRIP), trip(51.525, RELOCATION_TRIP),
+	}, 2)
+	require.Len(t, hotspots, 2)
+	assert.Equal(t, 3, hotspots[0].Trips)
+	assert.Equal(t, HotspotCell{Row: 5151, Col: 740}, hotspots[1].Cell)
+}
+
+func TestStarvationMonitor(t *testing.T) {
+	grid := HotspotGrid{CellSize: 0.01}
+	hotspot := Hotspot{Cell: grid.Cell(NewGeoLocation(51.505, 7.405))}
+	inside := &Scooter{ID: "a", Location: NewGeoLocation(51.505, 7.405)}
+	rented := &Scooter{ID: "b", Location: NewGeoLocation(51.505, 7.405), State: InUse}
+	elsewhere := &Scooter{ID: "c", Location: NewGeoLocation(51.515, 7.405)}
+
+	monitor := NewStarvationMonitor(grid, []Hotspot{hotspot}, 10*time.Minute, time.UTC)
+	start := time.Date(2019, 10, 7, 21, 30, 0, 0, time.UTC)
+	var alerts, ended []*Starvation
+	for i, snapshot := range [][]*Scooter{
+		{inside},
+		// Starves for 5 minutes without alert
+		{rented, elsewhere},
+		{inside},
+		// Starves for 10 minutes and raises an alert
+		{elsewhere},
+		{elsewhere},
+		{elsewhere},
+		// Ends at night
+		{elsewhere},
+	} {
+		a, e := monitor.Observe(NewScrapeResult("circ", start.Add(time.Duration(i)*5*time.Minute), snapshot))
+		alerts = append(alerts, a...)
+		ended = append(ended, e...)
+	}
+	require.Len(t, alerts, 1)
+	assert.Equal(t, start.Add(15*time.Minute), alerts[0].From)
+	require.Len(t, ended, 2)
+	assert.False(t, ended[0].Alerted)
+	assert.Equal(t, 5*time.Minute, ended[0].Duration())
+	assert.True(t, ended[1].Alerted)
+	assert.Equal(t, 15*time.Minute, ended[1].Duration())
+	assert.Empty(t, monitor.Open())
+
+	stats := SummarizeStarvations(append(ended, &Starvation{Cell: hotspot.Cell, From: start}))
+	require.Len(t, stats, 1)
+	assert.Equal(t, StarvationStats{Cell: hotspot.Cell, Starvations: 2, Alerts: 1, Total: 20 * time.Minute, Longest: 15 * time.Minute}, stats[0])
+}
@@ -0,0 +1,143 @@
+package sharealyzer
+
+import (
+	"sort"
+	"time"
+)
+
+// Tariff is the price of renting a scooter in euro cents
+type Tariff struct {
+	InitPrice int `json:"init_price"`
+	// UnitPrice is the price per started minute
+	UnitPrice int `json:"unit_price"`
+}
+
+// Cost returns the cost of a trip of the given duration
+func (t Tariff) Cost(duration time.Duration) uint64 {
+	return uint64(t.InitPrice + t.UnitPrice*int(duration.Minutes()))
+}
+
+func scooterTariff(scooter *Scooter) Tariff {
+	return Tariff{InitPrice: scooter.InitPrice, UnitPrice: scooter.UnitPrice}
+}
+
+// TariffChange is the date from which a provider charges a different tariff in a zone
+type TariffChange struct {
+	Provider string    `json:"provider"`
+	Zone     string    `json:"zone"`
+	Date     time.Time `json:"date"`
+	// Previous is the tariff charged before, nil for the first tariff seen in the zone
+	Previous *Tariff `json:"previous"`
+	Tariff   Tariff  `json:"tariff"`
+}
+
+type tariffKey struct {
+	provider string
+	zone     string
+}
+
+// TariffTracker detects changes of the tariffs per provider and zone in a sequence of scrape results. The
+// tariff of a zone is the one most of its scooters show, so scooters which are updated one by one during a
+// tariff change don't flap between tariffs.
+type TariffTracker struct {
+	current map[tariffKey]Tariff
+	changes []TariffChange
+}
+
+// NewTariffTracker creates a TariffTracker without known tariffs
+func NewTariffTracker() *TariffTracker {
+	return &TariffTracker{current: make(map[tariffKey]Tariff)}
+}
+
+// Observe updates the tariffs with a scrape result and returns the changes it contains
+func (t *TariffTracker) Observe(res ScrapeResult) []TariffChange {
+	counts := make(map[tariffKey]map[Tariff]int)
+	for _, scooter := range res.Scooters() {
+		provider := scooter.Provider
+		if provider == "" {
+			provider = res.Provider()
+		}
+		key := tariffKey{provider: provider, zone: scooter.Zone}
+		if counts[key] == nil {
+			counts[key] = make(map[Tariff]int)
+		}
+		counts[key][scooterTariff(scooter)]++
+	}
+
+	var changes []TariffChange
+	for key, tariffs := range counts {
+		tariff := mostCommonTariff(tariffs)
+		previous, known := t.current[key]
+		if known && previous == tariff {
+			continue
+		}
+		change := TariffChange{Provider: key.provider, Zone: key.zone, Date: res.ScrapeDate(), Tariff: tariff}
+		if known {
+			change.Previous = &previous
+		}
+		t.current[key] = tariff
+		changes = append(changes, change)
+	}
+	sortTariffChanges(changes)
+	t.changes = append(t.changes, changes...)
+	return changes
+}
+
+// mostCommonTariff returns the tariff with the highest count, ties go to the cheaper tariff
+func mostCommonTariff(tariffs map[Tariff]int) Tariff {
+	var common Tariff
+	max := 0
+	for tariff, count := range tariffs {
+		if count > max || (count == max && (tariff.InitPrice < common.InitPrice ||
+			(tariff.InitPrice == common.InitPrice && tariff.UnitPrice < common.UnitPrice))) {
+			common, max = tariff, count
+		}
+	}
+	return common
+}
+
+// Timeline returns all changes seen so far
+func (t *TariffTracker) Timeline() TariffTimeline {
+	return TariffTimeline(append([]TariffChange(nil), t.changes...))
+}
+
+// TariffTimeline are tariff changes ordered by date
+type TariffTimeline []TariffChange
+
+// At returns the tariff the provider charged in the zone at date
+func (tl TariffTimeline) At(provider, zone string, date time.Time) (Tariff, bool) {
+	var tariff Tariff
+	found := false
+	for _, change := range tl {
+		if change.Date.After(date) {
+			break
+		}
+		if change.Provider == provider && change.Zone == zone {
+			tariff, found = change.Tariff, true
+		}
+	}
+	return tariff, found
+}
+
+// Annotate sets the tariff of a finished trip to the one valid in its zone at its start and estimates its
+// cost with it. Trips of zones without known tariff are left unchanged.
+func (tl TariffTimeline) Annotate(trip *Trip) {
+	tariff, found := tl.At(trip.ScooterProvider, trip.Zone, trip.StartTime)
+	if !found {
+		return
+	}
+	trip.Tariff = &tariff
+	trip.Cost = tariff.Cost(trip.Duration)
+}
+
+func sortTariffChanges(changes []TariffChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].Date.Equal(changes[j].Date) {
+			return changes[i].Date.Before(changes[j].Date)
+		}
+		if changes[i].Provider != changes[j].Provider {
+			return changes[i].Provider < changes[j].Provider
+		}
+		return changes[i].Zone < changes[j].Zone
+	})
+}
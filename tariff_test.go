@@ -0,0 +1,74 @@
+package sharealyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTariffTracker(t *testing.T) {
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	scooter := func(id, zone string, initPrice, unitPrice int) *Scooter {
+		return &Scooter{ID: id, Provider: "circ", Zone: zone, InitPrice: initPrice, UnitPrice: unitPrice}
+	}
+	snapshots := [][]*Scooter{
+		{scooter("a", "center", 100, 15), scooter("b", "center", 100, 15), scooter("c", "north", 100, 20)},
+		// The tariff of the center changes scooter by scooter
+		{scooter("a", "center", 100, 20), scooter("b", "center", 100, 15), scooter("c", "north", 100, 20)},
+		{scooter("a", "center", 100, 20), scooter("b", "center", 100, 20), scooter("c", "north", 100, 20)},
+		{scooter("a", "center", 100, 20), scooter("b", "center", 100, 20)},
+	}
+	tracker := NewTariffTracker()
+	var changes [][]TariffChange
+	for i, snapshot := range snapshots {
+		changes = append(changes, tracker.Observe(NewScrapeResult("circ", start.Add(time.Duration(i)*time.Hour), snapshot)))
+	}
+	require.Len(t, changes[0], 2)
+	assert.Equal(t, TariffChange{Provider: "circ", Zone: "center", Date: start, Tariff: Tariff{100, 15}}, changes[0][0])
+	assert.Equal(t, "north", changes[0][1].Zone)
+	// A tie keeps the cheaper tariff
+	assert.Empty(t, changes[1])
+	require.Len(t, changes[2], 1)
+	assert.Equal(t, TariffChange{Provider: "circ", Zone: "center", Date: start.Add(2 * time.Hour), Previous: &Tariff{100, 15},
+		Tariff: Tariff{100, 20}}, changes[2][0])
+	assert.Empty(t, changes[3])
+
+	timeline := tracker.Timeline()
+	assert.Len(t, timeline, 3)
+	tariff, found := timeline.At("circ", "center", start.Add(time.Hour))
+	assert.True(t, found)
+	assert.Equal(t, Tariff{100, 15}, tariff)
+	tariff, _ = timeline.At("circ", "center", start.Add(3*time.Hour))
+	assert.Equal(t, Tariff{100, 20}, tariff)
+	_, found = timeline.At("circ", "center", start.Add(-time.Hour))
+	assert.False(t, found)
+
+	trip := &Trip{ScooterProvider: "circ", Zone: "center", StartTime: start.Add(90 * time.Minute), Duration: 10 * time.Minute}
+	timeline.Annotate(trip)
+	assert.Equal(t, &Tariff{100, 15}, trip.Tariff)
+	assert.Equal(t, uint64(250), trip.Cost)
+	unknown := &Trip{ScooterProvider: "circ", Zone: "south", StartTime: start, Duration: 10 * time.Minute, Cost: 42}
+	timeline.Annotate(unknown)
+	assert.Nil(t, unknown.Tariff)
+	assert.Equal(t, uint64(42), unknown.Cost)
+}
+
+func TestTripAggregatorChargesTariffAtStart(t *testing.T) {
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", Zone: "center", Location: NewGeoLocation(51.50, 7.40), InitPrice: 100, UnitPrice: 15, StateUpdatedAt: start}
+	// The tariff changed during the trip
+	aBack := &Scooter{ID: "a", Zone: "center", Location: NewGeoLocation(51.51, 7.40), InitPrice: 100, UnitPrice: 20,
+		StateUpdatedAt: start.Add(20 * time.Minute)}
+	var results []ScrapeResult
+	for i, snapshot := range [][]*Scooter{{a}, {}, {aBack}} {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+	trips := aggregateTrips(NewTripAggregator(), results)
+	require.Len(t, trips, 1)
+	trip := trips[TripID("circ", "a", start.Add(10*time.Minute))]
+	assert.Equal(t, "center", trip.Zone)
+	assert.Equal(t, &Tariff{100, 15}, trip.Tariff)
+	assert.Equal(t, uint64(250), trip.Cost)
+}
@@ -1,31 +1,99 @@
 package sharealyzer
 
 import (
+	"log"
+	"math"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/umahmood/haversine"
 )
 
 var (
+	// TripNeverFinishedTime is the default age after which an unfinished trip is considered lost
 	TripNeverFinishedTime = time.Hour * 48
 )
 
+// DefaultMaxLocationAge is the age of a GPS fix after which the location of a scooter is considered stale,
+// i.e. because it is parked underground
+const DefaultMaxLocationAge = 10 * time.Minute
+
+const (
+	// BatterySwapMaxDistance is the distance in kilometers a scooter may move between two GPS fixes while
+	// its battery is swapped in place
+	BatterySwapMaxDistance = 0.05
+	// BatterySwapMaxDuration is the longest a scooter disappears while its battery is swapped in place,
+	// charging it elsewhere takes considerably longer
+	BatterySwapMaxDuration = 30 * time.Minute
+)
+
+const (
+	// DefaultMaxReservationDuration is the longest a scooter disappears while it is reserved or unlocked
+	// without riding it
+	DefaultMaxReservationDuration = 3 * time.Minute
+	// ReservationMaxDistance is the distance in kilometers a reserved scooter may move, which is GPS noise
+	ReservationMaxDistance = 0.02
+)
+
+// DefaultMaxScrapeGap is the time without scrape results after which the provider or the scraper is
+// considered to have been down
+const DefaultMaxScrapeGap = 30 * time.Minute
+
+const (
+	// RelocationMinDistance is the distance in kilometers a trip needs to cover to be a relocation
+	RelocationMinDistance = 1.0
+	// RelocationMaxChargeLoss is the charge in percent a scooter loses at most while it is relocated, since
+	// scooters usually don't loose more than a percent of energy on a van
+	RelocationMaxChargeLoss = 1.1
+)
+
+// Classifier decides the type of finished trips by thresholds on their distance, duration and charge. Its
+// zero value is not useful, start with DefaultClassifier.
+type Classifier struct {
+	RelocationMinDistance   float64
+	RelocationMaxChargeLoss float64
+	BatterySwapMaxDistance  float64
+	BatterySwapMaxDuration  time.Duration
+}
+
+// DefaultClassifier returns the classifier used by ClassifyTrip and ClassifyTripBatches
+func DefaultClassifier() Classifier {
+	return Classifier{
+		RelocationMinDistance:   RelocationMinDistance,
+		RelocationMaxChargeLoss: RelocationMaxChargeLoss,
+		BatterySwapMaxDistance:  BatterySwapMaxDistance,
+		BatterySwapMaxDuration:  BatterySwapMaxDuration,
+	}
+}
+
+// Classify sets the type of the trip
+func (c Classifier) Classify(trip *Trip) {
+	if trip.EndChargeLevel > trip.StartChargeLevel {
+		// Without fresh locations a scooter taken away can't be told apart from one which didn't move
+		if !trip.StaleLocation && trip.Distance < c.BatterySwapMaxDistance && trip.Duration <= c.BatterySwapMaxDuration {
+			trip.Type = BATTERY_SWAP_TRIP
+			return
+		}
+		trip.Type = CHARGING_TRIP
+		return
+	}
+	if (trip.StartChargeLevel-trip.EndChargeLevel) < c.RelocationMaxChargeLoss && trip.Distance > c.RelocationMinDistance {
+		trip.Type = RELOCATION_TRIP
+		return
+	}
+	trip.Type = CUSTOMER_TRIP
+}
+
+func classify(trip *Trip) {
+	DefaultClassifier().Classify(trip)
+}
+
 func ClassifyTrip(in <-chan *Trip) <-chan *Trip {
 	out := make(chan *Trip, 100)
 	go func() {
 		for trip := range in {
-			if trip.EndChargeLevel > trip.StartChargeLevel {
-				trip.Type = CHARGING_TRIP
-				out <- trip
-				continue
-			}
-			// Scooters usually don't loose more than a percent of energy during relocation
-			if (trip.StartChargeLevel-trip.EndChargeLevel) < 1.1 && trip.Distance > 1.0 {
-				trip.Type = RELOCATION_TRIP
-				out <- trip
-				continue
-			}
-			trip.Type = CUSTOMER_TRIP
+			classify(trip)
 			out <- trip
 		}
 		close(out)
@@ -33,85 +101,492 @@ func ClassifyTrip(in <-chan *Trip) <-chan *Trip {
 	return out
 }
 
+// ClassifyTripBatches classifies the trips of every batch like ClassifyTrip
+func ClassifyTripBatches(in <-chan []*Trip) <-chan []*Trip {
+	out := make(chan []*Trip, 10)
+	go func() {
+		for batch := range in {
+			for _, trip := range batch {
+				classify(trip)
+			}
+			out <- batch
+		}
+		close(out)
+	}()
+	return out
+}
+
+// TripAggregator detects trips in a sequence of scrape results. Its state belongs to the goroutine started
+// by Aggregate or AggregateBatches, so only one of them may run at a time, which is enforced at runtime.
+// Results of the accessors like LostTripCount are only complete after the output channel was closed.
 type TripAggregator struct {
+	// MaxUnfinishedTrips is the number of unfinished trips kept in memory, 0 means no limit. The trips
+	// inactive for the longest time are moved to Spill if the limit is exceeded.
+	MaxUnfinishedTrips int
+	Spill              *TripSpill
+	// History drops finished trips which were already stored before a restart, if it is set
+	History *TripHistory
+	// MaxLocationAge is the age of a GPS fix after which a location is stale, 0 disables the check. Trips
+	// start at the last fresh location of their scooter and trips with a stale end location have no distance.
+	MaxLocationAge time.Duration
+	// MaxTripAge is the age after which an unfinished trip is considered lost, defaults to
+	// TripNeverFinishedTime
+	MaxTripAge time.Duration
+	// LostTrips is called with every trip which didn't finish within MaxTripAge, if it is set. The trips
+	// are marked as LOST_TRIP.
+	LostTrips func(trip *Trip)
+	// OpenTrips is called with every unfinished trip, including spilled ones, when the input ends, ordered
+	// by their start time. The trips are marked as open with MarkOpen.
+	OpenTrips func(trip *Trip)
+	// MaxReservationDuration is the longest disappearance which is considered a reservation or a cancelled
+	// unlock instead of a trip if the scooter didn't move and didn't lose charge, 0 disables the check
+	MaxReservationDuration time.Duration
+	// Reservations is called with every reservation, if it is set. Reservations are marked as RESERVATION
+	// and aren't passed on as trips, since they would skew the statistics of trips.
+	Reservations func(trip *Trip)
+	// MaxScrapeGap is the time between two scrape results after which they are considered to be separated
+	// by an outage, 0 disables outage detection. The first result after an outage becomes the new baseline
+	// instead of starting and finishing trips for every scooter which changed in the meantime.
+	MaxScrapeGap time.Duration
+
 	unfinishedTrips map[string]*Trip
-	lastScooters    Scooters
+	// freshLocations are the last locations of every scooter which weren't stale
+	freshLocations map[string]*GeoLocation
+	// lastScooters is built from lastSnapshot when it is needed, unchanged snapshots never need it
+	lastScooters   Scooters
+	lastSnapshot   []*Scooter
+	lastHash       uint64
+	unchangedCount int
+	duplicateCount int
+	lostCount      int
+	reservedCount  int
+	outageCount    int
+	lastDate       time.Time
+	// running is 1 while a goroutine owns the state
+	running int32
 }
 
 func NewTripAggregator() *TripAggregator {
 	return &TripAggregator{
 		unfinishedTrips: make(map[string]*Trip),
+		freshLocations:  make(map[string]*GeoLocation),
 		lastScooters:    NewScooters([]*Scooter{}),
 	}
 }
 
+// DuplicateTrips returns the number of finished trips which were dropped because they are in the History
+func (t *TripAggregator) DuplicateTrips() int {
+	return t.duplicateCount
+}
+
+// claim makes the calling aggregation the owner of the state. It panics if another aggregation is still
+// running, since they would corrupt the unfinished trips of each other.
+func (t *TripAggregator) claim() {
+	if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		panic("sharealyzer: TripAggregator is already aggregating, use one aggregator per pipeline")
+	}
+}
+
+func (t *TripAggregator) release() {
+	atomic.StoreInt32(&t.running, 0)
+}
+
 func (t *TripAggregator) Aggregate(in <-chan ScrapeResult) <-chan *Trip {
+	t.claim()
 	out := make(chan *Trip, 100)
 	go func() {
 		for res := range in {
-			scooters := NewScooters(res.Scooters())
-			vanishedScooter := scooters.Difference(t.lastScooters)
-			for id, scooter := range vanishedScooter {
-				trip := &Trip{
-					ScooterID:        id,
-					ScooterProvider:  "circ",
-					StartChargeLevel: float64(scooter.ChargeLevel),
-					StartLocation:    scooter.Location,
-					StartTime:        res.ScrapeDate(),
+			t.observe(res, func(trip *Trip) {
+				out <- trip
+			})
+		}
+		t.flushOpenTrips()
+		t.release()
+		close(out)
+	}()
+	return out
+}
+
+// AggregateBatches aggregates trips like Aggregate, but sends them in batches of up to size trips. A batch is
+// sent early if its first trip waited for maxLatency, a maxLatency of 0 disables this.
+func (t *TripAggregator) AggregateBatches(in <-chan ScrapeResult, size int, maxLatency time.Duration) <-chan []*Trip {
+	t.claim()
+	b := newTripBatcher(size, maxLatency)
+	go func() {
+		for {
+			select {
+			case res, ok := <-in:
+				if !ok {
+					b.flush()
+					t.flushOpenTrips()
+					t.release()
+					close(b.out)
+					return
 				}
-				t.unfinishedTrips[id] = trip
+				t.observe(res, b.add)
+			case <-b.expired():
+				b.flush()
 			}
+		}
+	}()
+	return b.out
+}
 
-			for id, trip := range t.unfinishedTrips {
-				if scooter, exists := scooters[id]; exists {
-					trip.EndChargeLevel = float64(scooter.ChargeLevel)
-					trip.EndLocation = scooter.Location
-					trip.UserID = scooter.StateUpdatedByUserID
-					trip.EndTime = res.ScrapeDate()
-					trip.Duration = trip.EndTime.Sub(trip.StartTime)
-					trip.Cost = uint64(scooter.InitPrice + (scooter.UnitPrice * int(trip.Duration.Minutes())))
-
-					_, distanceKm := haversine.Distance(
-						haversine.Coord{Lat: trip.StartLocation.Latitude, Lon: trip.StartLocation.Longitude},
-						haversine.Coord{Lat: trip.EndLocation.Latitude, Lon: trip.EndLocation.Longitude},
-					)
-					trip.Distance = distanceKm
-					delete(t.unfinishedTrips, id)
-					out <- trip
-				} else if trip.StartTime.After(time.Now().Add(TripNeverFinishedTime)) {
-					// Ensure that our trip map doesn't grow without bounds. After 48h we assume that a trip will
-					// never finish. The scooter may be broken, lost etc.
-					delete(t.unfinishedTrips, id)
+// observe updates the unfinished trips with a scrape result and calls finished for every finished trip
+func (t *TripAggregator) observe(res ScrapeResult, finished func(trip *Trip)) {
+	outage := t.MaxScrapeGap > 0 && !t.lastDate.IsZero() && res.ScrapeDate().Sub(t.lastDate) > t.MaxScrapeGap
+	if outage {
+		log.Printf("[WARNING] No scrape results between %s and %s, restarting trip detection",
+			t.lastDate.Format(time.RFC3339), res.ScrapeDate().Format(time.RFC3339))
+		t.outageCount++
+	}
+	t.lastDate = res.ScrapeDate()
+	snapshot := res.Scooters()
+	hash := snapshotHash(snapshot)
+	if hash == t.lastHash && len(snapshot) == len(t.lastSnapshot) {
+		// No scooter appeared or vanished, so no trip can start or finish. Trips still get lost over time.
+		t.lastSnapshot = snapshot
+		t.lastScooters = nil
+		t.unchangedCount++
+		t.expire(res.ScrapeDate())
+		if t.MaxLocationAge > 0 {
+			for _, scooter := range snapshot {
+				if scooter.State != InUse {
+					t.rememberLocation(scooter)
 				}
 			}
-			t.lastScooters = scooters
 		}
-		close(out)
-	}()
-	return out
+		t.spill()
+		return
+	}
+	if t.lastScooters == nil {
+		t.lastScooters, _ = availableScooters(t.lastSnapshot)
+	}
+	// Rented scooters which are still visible are on a trip, they don't count as available
+	scooters, inUse := availableScooters(snapshot)
+	if outage {
+		// Scooters which vanished or reappeared during the outage can't be told apart from trips. Trips
+		// which were already unfinished still finish when their scooter is back.
+		t.lastScooters = scooters
+	}
+	vanished, reappeared := diffScooters(t.lastScooters, scooters)
+	for id, scooter := range vanished {
+		trip := startTrip(res.Provider(), scooter, res.ScrapeDate())
+		if t.staleLocation(scooter) {
+			if location, exists := t.freshLocations[id]; exists {
+				trip.StartLocation = location
+			} else {
+				trip.StaleLocation = true
+			}
+		}
+		t.unfinishedTrips[id] = trip
+	}
+
+	if t.Spill != nil && t.Spill.Len() > 0 {
+		// Spilled trips finish when their scooter shows up again and continue when it is seen riding. Every
+		// scooter of the new baseline may have come back during an outage.
+		seenAgain := reappeared
+		if outage {
+			seenAgain = scooters
+		}
+		for _, seen := range []Scooters{seenAgain, inUse} {
+			for id := range seen {
+				trip, err := t.Spill.Take(id)
+				if err != nil {
+					log.Printf("[WARNING] Failed to read spilled trip of scooter %s: %s", id, err)
+				} else if trip != nil {
+					t.unfinishedTrips[id] = trip
+				}
+			}
+		}
+	}
+	for id, scooter := range inUse {
+		if trip, exists := t.unfinishedTrips[id]; exists {
+			t.follow(trip, scooter)
+		}
+	}
+
+	for id, trip := range t.unfinishedTrips {
+		if scooter, exists := scooters[id]; exists {
+			finishTrip(trip, scooter, res.ScrapeDate(), t.staleLocation(scooter))
+			delete(t.unfinishedTrips, id)
+			if t.isReservation(trip) {
+				t.reserve(trip)
+				continue
+			}
+			if t.History != nil && t.History.Contains(trip) {
+				t.duplicateCount++
+				continue
+			}
+			finished(trip)
+		}
+	}
+	t.expire(res.ScrapeDate())
+	if t.MaxLocationAge > 0 {
+		for _, scooter := range scooters {
+			t.rememberLocation(scooter)
+		}
+	}
+	t.lastScooters = scooters
+	t.lastSnapshot = snapshot
+	t.lastHash = hash
+	t.spill()
 }
 
-// Scooters is a map of Scooters in a ScrapeResult. This makes it easier to create differences
-// from other sets of Scooters and to look up Scooters
-type Scooters map[string]*Scooter
+// expire loses the unfinished and spilled trips which are older than MaxTripAge at now, so the unfinished
+// trips don't grow without bounds. Their scooters may be broken, lost etc.
+func (t *TripAggregator) expire(now time.Time) {
+	for id, trip := range t.unfinishedTrips {
+		if now.Sub(trip.StartTime) > t.maxTripAge() {
+			delete(t.unfinishedTrips, id)
+			t.lose(trip, now)
+		}
+	}
+	if t.Spill != nil && t.Spill.Len() > 0 {
+		lost, err := t.Spill.TakeStartedBefore(now.Add(-t.maxTripAge()))
+		if err != nil {
+			log.Printf("[WARNING] Failed to read lost spilled trips: %s", err)
+		}
+		for _, trip := range lost {
+			t.lose(trip, now)
+		}
+	}
+}
 
-// NewScooters creates a new map based Scooters type from a slice of Scooters
-func NewScooters(in []*Scooter) Scooters {
-	s := make(Scooters)
-	for _, scooter := range in {
-		s[scooter.ID] = scooter
+// rememberLocation keeps the location of an available scooter if it isn't stale
+func (t *TripAggregator) rememberLocation(scooter *Scooter) {
+	if !t.staleLocation(scooter) && scooter.Location != nil {
+		t.freshLocations[scooter.ID] = scooter.Location
 	}
-	return s
 }
 
-// Difference returns all scooters which exist in ns but not in this Scooters instance
-func (s Scooters) Difference(ns Scooters) Scooters {
-	s2 := make(Scooters)
+// spill moves the unfinished trips above MaxUnfinishedTrips to the Spill
+func (t *TripAggregator) spill() {
+	if err := SpillUnfinishedTrips(t.unfinishedTrips, t.Spill, t.MaxUnfinishedTrips); err != nil {
+		log.Printf("[WARNING] Failed to spill unfinished trips: %s", err)
+	}
+}
 
-	for id, scooter := range ns {
-		if _, exists := s[id]; !exists {
-			s2[id] = scooter
+// availableScooters splits a snapshot into the available scooters and the rented ones which the provider
+// shows while they are in use
+func availableScooters(snapshot []*Scooter) (available, inUse Scooters) {
+	available, inUse = make(Scooters, len(snapshot)), make(Scooters)
+	for _, scooter := range snapshot {
+		if scooter.State == InUse {
+			inUse[scooter.ID] = scooter
+		} else {
+			available[scooter.ID] = scooter
 		}
 	}
-	return s2
+	return available, inUse
+}
+
+// diffScooters returns the scooters which vanished since the last scrape result and the ones which
+// reappeared in the current one
+func diffScooters(last, current Scooters) (vanished, reappeared Scooters) {
+	return current.Difference(last), last.Difference(current)
+}
+
+// startTrip creates the trip of a scooter which vanished at date, starting where it was seen last
+func startTrip(provider string, scooter *Scooter, date time.Time) *Trip {
+	tariff := scooterTariff(scooter)
+	return &Trip{
+		ID:               TripID(provider, scooter.ID, date),
+		ScooterID:        scooter.ID,
+		ScooterProvider:  provider,
+		StartChargeLevel: float64(scooter.ChargeLevel),
+		StartLocation:    scooter.Location,
+		StartTime:        date,
+		Zone:             scooter.Zone,
+		Tariff:           &tariff,
+	}
+}
+
+// finishTrip ends a trip with the scooter which reappeared at date. staleEnd marks the location of the
+// scooter as outdated, trips with a stale location have no distance.
+func finishTrip(trip *Trip, scooter *Scooter, date time.Time, staleEnd bool) {
+	trip.EndChargeLevel = float64(scooter.ChargeLevel)
+	trip.EndLocation = scooter.Location
+	trip.UserID = scooter.StateUpdatedByUserID
+	trip.EndTime = date
+	trip.Duration = trip.EndTime.Sub(trip.StartTime)
+	if trip.Tariff == nil {
+		// Trips spilled by older versions have no tariff
+		tariff := scooterTariff(scooter)
+		trip.Tariff = &tariff
+	}
+	trip.Cost = trip.Tariff.Cost(trip.Duration)
+	if staleEnd {
+		trip.StaleLocation = true
+	}
+	if !trip.StaleLocation {
+		trip.Distance = tripDistance(trip)
+	}
+}
+
+// follow adds the location of a rented scooter to the path of its trip. Stale locations and locations
+// where the scooter didn't move are skipped.
+func (t *TripAggregator) follow(trip *Trip, scooter *Scooter) {
+	if scooter.Location == nil || t.staleLocation(scooter) {
+		return
+	}
+	if last := len(trip.Path) - 1; last >= 0 && *trip.Path[last] == *scooter.Location {
+		return
+	}
+	trip.Path = append(trip.Path, scooter.Location)
+}
+
+// tripDistance returns the distance in kilometers from the start of the trip along its path to its end
+func tripDistance(trip *Trip) float64 {
+	km := 0.0
+	from := trip.StartLocation
+	for _, location := range trip.Path {
+		km += distance(from, location)
+		from = location
+	}
+	return km + distance(from, trip.EndLocation)
+}
+
+// distance returns the distance between two locations in kilometers
+func distance(from, to *GeoLocation) float64 {
+	_, km := haversine.Distance(
+		haversine.Coord{Lat: from.Latitude, Lon: from.Longitude},
+		haversine.Coord{Lat: to.Latitude, Lon: to.Longitude},
+	)
+	return km
+}
+
+func (t *TripAggregator) maxTripAge() time.Duration {
+	if t.MaxTripAge > 0 {
+		return t.MaxTripAge
+	}
+	return TripNeverFinishedTime
+}
+
+// lose marks a trip which never finished until now as LOST_TRIP and passes it to LostTrips
+func (t *TripAggregator) lose(trip *Trip, now time.Time) {
+	t.lostCount++
+	trip.Type = LOST_TRIP
+	trip.Duration = now.Sub(trip.StartTime)
+	if t.LostTrips != nil {
+		t.LostTrips(trip)
+	}
+}
+
+// isReservation returns true if the finished trip is too short and didn't go anywhere, so the scooter was
+// only reserved or unlocked without being ridden
+func (t *TripAggregator) isReservation(trip *Trip) bool {
+	return t.MaxReservationDuration > 0 && trip.Duration < t.MaxReservationDuration && !trip.StaleLocation &&
+		len(trip.Path) == 0 && trip.Distance <= ReservationMaxDistance && trip.EndChargeLevel == trip.StartChargeLevel
+}
+
+// reserve marks a finished trip as RESERVATION and passes it to Reservations
+func (t *TripAggregator) reserve(trip *Trip) {
+	t.reservedCount++
+	trip.Type = RESERVATION
+	if t.Reservations != nil {
+		t.Reservations(trip)
+	}
+}
+
+// ReservationCount returns the number of disappearances which were reservations instead of trips
+func (t *TripAggregator) ReservationCount() int {
+	return t.reservedCount
+}
+
+// LostTripCount returns the number of trips which didn't finish within MaxTripAge
+func (t *TripAggregator) LostTripCount() int {
+	return t.lostCount
+}
+
+// OutageCount returns the number of gaps longer than MaxScrapeGap in the scrape results
+func (t *TripAggregator) OutageCount() int {
+	return t.outageCount
+}
+
+// flushOpenTrips passes all unfinished trips to OpenTrips and forgets them
+func (t *TripAggregator) flushOpenTrips() {
+	if t.OpenTrips == nil {
+		return
+	}
+	open := make([]*Trip, 0, len(t.unfinishedTrips))
+	for id, trip := range t.unfinishedTrips {
+		open = append(open, trip)
+		delete(t.unfinishedTrips, id)
+	}
+	if t.Spill != nil && t.Spill.Len() > 0 {
+		spilled, err := t.Spill.TakeAll()
+		if err != nil {
+			log.Printf("[WARNING] Failed to read spilled trips: %s", err)
+		}
+		open = append(open, spilled...)
+	}
+	sort.Slice(open, func(i, j int) bool {
+		if open[i].StartTime.Equal(open[j].StartTime) {
+			return open[i].ScooterID < open[j].ScooterID
+		}
+		return open[i].StartTime.Before(open[j].StartTime)
+	})
+	for _, trip := range open {
+		MarkOpen(trip, t.lastDate)
+		t.OpenTrips(trip)
+	}
+}
+
+// MarkOpen marks a trip which didn't finish until cutoff, the end of the input, as OPEN_TRIP. Its
+// duration is the time until cutoff, it has no end.
+func MarkOpen(trip *Trip, cutoff time.Time) {
+	trip.Type = OPEN_TRIP
+	trip.Duration = cutoff.Sub(trip.StartTime)
+}
+
+// staleLocation returns true if the location of the scooter is an outdated GPS fix
+func (t *TripAggregator) staleLocation(scooter *Scooter) bool {
+	return t.MaxLocationAge > 0 && scooter.LocationAge > t.MaxLocationAge
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// snapshotHash combines FNV-1a hashes of the identifier and state update time of every scooter independent
+// of their order. The location of rented scooters is included, since it extends the path of their trip.
+// Equal hashes of consecutive snapshots mean that the same scooters are available.
+func snapshotHash(scooters []*Scooter) uint64 {
+	var sum uint64
+	for _, scooter := range scooters {
+		h := uint64(fnvOffset64)
+		for i := 0; i < len(scooter.ID); i++ {
+			h ^= uint64(scooter.ID[i])
+			h *= fnvPrime64
+		}
+		updated := uint64(scooter.StateUpdatedAt.UnixNano())
+		for i := 0; i < 8; i++ {
+			h ^= updated & 0xff
+			h *= fnvPrime64
+			updated >>= 8
+		}
+		if scooter.State == InUse && scooter.Location != nil {
+			for _, v := range []uint64{math.Float64bits(scooter.Location.Latitude), math.Float64bits(scooter.Location.Longitude)} {
+				for i := 0; i < 8; i++ {
+					h ^= v & 0xff
+					h *= fnvPrime64
+					v >>= 8
+				}
+			}
+		}
+		sum = sum + h
+	}
+	return sum
+}
+
+// Scooters is a map of Scooters in a ScrapeResult. This makes it easier to create differences
+// from other sets of Scooters and to look up Scooters. It is never modified after NewScooters, so it
+// can be read from several goroutines.
+type Scooters = KeyedSet[string, *Scooter]
+
+// NewScooters creates a new map based Scooters type from a slice of Scooters
+func NewScooters(in []*Scooter) Scooters {
+	return NewKeyedSet(in, func(scooter *Scooter) string { return scooter.ID })
 }
@@ -0,0 +1,150 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scrapeSequence is a random sequence of scrape results of a small fleet, together with the number of times
+// every scooter vanished and reappeared in it
+type scrapeSequence struct {
+	results []ScrapeResult
+	trips   map[string]int
+	open    map[string]bool
+}
+
+// Generate creates sequences in which every scooter randomly vanishes and reappears, implementing
+// quick.Generator
+func (scrapeSequence) Generate(random *rand.Rand, size int) reflect.Value {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	seq := scrapeSequence{trips: make(map[string]int), open: make(map[string]bool)}
+	fleet := make([]*Scooter, 1+random.Intn(10))
+	seen := make([]bool, len(fleet))
+	gone := make([]bool, len(fleet))
+	for i := range fleet {
+		fleet[i] = &Scooter{ID: fmt.Sprintf("scooter-%d", i), StateUpdatedAt: start}
+	}
+	scrapes := 2 + random.Intn(size+1)
+	for scrape := 0; scrape < scrapes; scrape++ {
+		date := start.Add(time.Duration(scrape) * time.Minute)
+		var available []*Scooter
+		for i, scooter := range fleet {
+			if random.Intn(3) == 0 {
+				gone[i] = seen[i]
+				continue
+			}
+			if gone[i] {
+				seq.trips[scooter.ID]++
+				gone[i] = false
+			}
+			if !seen[i] || random.Intn(4) == 0 {
+				// Scooters report a new state and location after a trip and sometimes while parked
+				scooter = &Scooter{
+					ID:             scooter.ID,
+					ChargeLevel:    float64(random.Intn(101)),
+					Location:       NewGeoLocation(51.4+random.Float64()*0.2, 7.3+random.Float64()*0.3),
+					StateUpdatedAt: date,
+				}
+				fleet[i] = scooter
+			}
+			seen[i] = true
+			available = append(available, scooter)
+		}
+		// The order of scooters in scrape results is arbitrary
+		random.Shuffle(len(available), func(a, b int) {
+			available[a], available[b] = available[b], available[a]
+		})
+		seq.results = append(seq.results, NewScrapeResult("circ", date, available))
+	}
+	for i, scooter := range fleet {
+		seq.open[scooter.ID] = gone[i]
+	}
+	return reflect.ValueOf(seq)
+}
+
+func TestTripInvariants(t *testing.T) {
+	property := func(seq scrapeSequence) bool {
+		aggregator := NewTripAggregator()
+		open := make(map[string]int)
+		aggregator.OpenTrips = func(trip *Trip) {
+			open[trip.ScooterID]++
+		}
+		trips := make(map[string][]Trip)
+		for _, trip := range aggregateTrips(aggregator, seq.results) {
+			trips[trip.ScooterID] = append(trips[trip.ScooterID], trip)
+		}
+
+		valid := true
+		for id, count := range seq.trips {
+			// Every time a scooter vanished and reappeared is exactly one trip
+			valid = assert.Len(t, trips[id], count, "trips of %s", id) && valid
+		}
+		for id, isOpen := range seq.open {
+			if isOpen {
+				valid = assert.Equal(t, 1, open[id], "open trips of %s", id) && valid
+			} else {
+				valid = assert.Zero(t, open[id], "open trips of %s", id) && valid
+			}
+		}
+		for id, scooterTrips := range trips {
+			valid = assert.Contains(t, seq.trips, id) && valid
+			for _, trip := range scooterTrips {
+				valid = assert.False(t, trip.EndTime.Before(trip.StartTime), "trip %s ends before it starts", trip.ID) && valid
+				valid = assert.Equal(t, trip.EndTime.Sub(trip.StartTime), trip.Duration) && valid
+				valid = assert.True(t, trip.Distance >= 0, "trip %s has negative distance", trip.ID) && valid
+			}
+		}
+		return valid
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+func TestFinishTripInvariants(t *testing.T) {
+	// Coordinates are generated within the valid range
+	lat := func(v uint32) float64 { return float64(v)/math.MaxUint32*180 - 90 }
+	lon := func(v uint32) float64 { return float64(v)/math.MaxUint32*360 - 180 }
+	property := func(startLat, startLon, endLat, endLon uint32, minutes uint16, charge uint8) bool {
+		start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+		scooter := &Scooter{ID: "a", ChargeLevel: float64(charge), Location: NewGeoLocation(lat(startLat), lon(startLon))}
+		trip := startTrip("circ", scooter, start)
+		back := &Scooter{ID: "a", Location: NewGeoLocation(lat(endLat), lon(endLon))}
+		finishTrip(trip, back, start.Add(time.Duration(minutes)*time.Minute), false)
+		return !trip.EndTime.Before(trip.StartTime) && trip.Duration >= 0 && trip.Distance >= 0 &&
+			trip.ID == TripID("circ", "a", start)
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
+
+func TestDiffScooters(t *testing.T) {
+	property := func(last, current []uint8) bool {
+		lastScooters, currentScooters := make(Scooters), make(Scooters)
+		for _, id := range last {
+			lastScooters[fmt.Sprint(id%16)] = &Scooter{ID: fmt.Sprint(id % 16)}
+		}
+		for _, id := range current {
+			currentScooters[fmt.Sprint(id%16)] = &Scooter{ID: fmt.Sprint(id % 16)}
+		}
+		vanished, reappeared := diffScooters(lastScooters, currentScooters)
+		for id := range lastScooters {
+			_, isCurrent := currentScooters[id]
+			if _, isVanished := vanished[id]; isVanished == isCurrent {
+				return false
+			}
+		}
+		for id := range currentScooters {
+			_, wasLast := lastScooters[id]
+			if _, isReappeared := reappeared[id]; isReappeared == wasLast {
+				return false
+			}
+		}
+		return len(vanished)+len(currentScooters) == len(reappeared)+len(lastScooters)
+	}
+	assert.NoError(t, quick.Check(property, nil))
+}
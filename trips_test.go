@@ -0,0 +1,387 @@
+package sharealyzer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripAggregatorSkipsUnchangedSnapshots(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	// b moved without a state update, its last position is where the trip starts
+	bMoved := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	bBack := &Scooter{ID: "b", ChargeLevel: 50, Location: NewGeoLocation(51.53, 7.43), StateUpdatedAt: start.Add(20 * time.Minute)}
+
+	snapshots := [][]*Scooter{
+		{a, b},
+		{b, a},
+		{a, bMoved},
+		{a},
+		{a},
+		{a, bBack},
+		{bBack, a},
+	}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	aggregator := NewTripAggregator()
+	trips := aggregateTrips(aggregator, results)
+	require.Len(t, trips, 1)
+	for _, trip := range trips {
+		assert.Equal(t, "b", trip.ScooterID)
+		assert.Equal(t, start.Add(30*time.Minute), trip.StartTime)
+		assert.Equal(t, start.Add(50*time.Minute), trip.EndTime)
+		assert.Equal(t, bMoved.Location, trip.StartLocation)
+		assert.Equal(t, bBack.Location, trip.EndLocation)
+	}
+	assert.Equal(t, 4, aggregator.unchangedCount)
+}
+
+func TestSnapshotHash(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", StateUpdatedAt: start}
+	b := &Scooter{ID: "b", StateUpdatedAt: start}
+	assert.Equal(t, snapshotHash([]*Scooter{a, b}), snapshotHash([]*Scooter{b, a}))
+	assert.NotEqual(t, snapshotHash([]*Scooter{a}), snapshotHash([]*Scooter{b}))
+	assert.NotEqual(t, snapshotHash([]*Scooter{a}), snapshotHash([]*Scooter{{ID: "a", StateUpdatedAt: start.Add(time.Second)}}))
+	// Rented scooters change the snapshot by moving
+	riding := &Scooter{ID: "a", State: InUse, Location: NewGeoLocation(51.5, 7.4), StateUpdatedAt: start}
+	moved := &Scooter{ID: "a", State: InUse, Location: NewGeoLocation(51.6, 7.4), StateUpdatedAt: start}
+	assert.NotEqual(t, snapshotHash([]*Scooter{riding}), snapshotHash([]*Scooter{moved}))
+	assert.Equal(t, uint64(0), snapshotHash(nil))
+}
+
+func TestTripAggregatorStaleLocations(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	// a lost its GPS fix, i.e. in an underground car park, and reports an old location
+	aStale := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.60, 7.60), StateUpdatedAt: start.Add(time.Minute),
+		LocationAge: time.Hour}
+	aBack := &Scooter{ID: "a", ChargeLevel: 70, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start.Add(20 * time.Minute)}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	bStale := &Scooter{ID: "b", ChargeLevel: 50, Location: NewGeoLocation(51.53, 7.43), StateUpdatedAt: start.Add(40 * time.Minute),
+		LocationAge: time.Hour}
+
+	snapshots := [][]*Scooter{{a, b}, {aStale, b}, {b}, {aBack, b}, {aBack}, {aBack, bStale}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxLocationAge = DefaultMaxLocationAge
+	trips := make(map[string]Trip)
+	for _, trip := range aggregateTrips(aggregator, results) {
+		trips[trip.ScooterID] = trip
+	}
+	require.Len(t, trips, 2)
+	// The trip starts at the last fresh location
+	assert.Equal(t, a.Location, trips["a"].StartLocation)
+	assert.Equal(t, aBack.Location, trips["a"].EndLocation)
+	assert.False(t, trips["a"].StaleLocation)
+	assert.True(t, trips["a"].Distance > 0)
+	// The end location is stale, so the distance is unknown
+	assert.True(t, trips["b"].StaleLocation)
+	assert.Equal(t, 0.0, trips["b"].Distance)
+
+	// Without the check stale locations are used like any other
+	trips = make(map[string]Trip)
+	for _, trip := range aggregateTrips(NewTripAggregator(), results) {
+		trips[trip.ScooterID] = trip
+	}
+	assert.Equal(t, aStale.Location, trips["a"].StartLocation)
+	assert.False(t, trips["b"].StaleLocation)
+}
+
+func TestTripAggregatorFollowsScootersInUse(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	inUse := func(lat, lon float64) *Scooter {
+		return &Scooter{ID: "a", ChargeLevel: 75, State: InUse, Location: NewGeoLocation(lat, lon), StateUpdatedAt: start.Add(10 * time.Minute)}
+	}
+	aBack := &Scooter{ID: "a", ChargeLevel: 70, Location: NewGeoLocation(51.50, 7.42), StateUpdatedAt: start.Add(50 * time.Minute)}
+
+	// a is rented, rides a detour, waits and is parked close to where it started
+	snapshots := [][]*Scooter{{a}, {inUse(51.51, 7.40)}, {inUse(51.51, 7.42)}, {inUse(51.51, 7.42)}, {}, {aBack}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	trips := aggregateTrips(NewTripAggregator(), results)
+	require.Len(t, trips, 1)
+	trip := trips[TripID("circ", "a", start.Add(10*time.Minute))]
+	assert.Equal(t, start.Add(10*time.Minute), trip.StartTime)
+	assert.Equal(t, start.Add(50*time.Minute), trip.EndTime)
+	assert.Equal(t, a.Location, trip.StartLocation)
+	assert.Equal(t, aBack.Location, trip.EndLocation)
+	assert.Equal(t, []*GeoLocation{NewGeoLocation(51.51, 7.40), NewGeoLocation(51.51, 7.42)}, trip.Path)
+	assert.InDelta(t, 2*distance(a.Location, trip.Path[0])+distance(trip.Path[0], trip.Path[1]), trip.Distance, 1e-9)
+	assert.True(t, trip.Distance > distance(a.Location, aBack.Location))
+}
+
+func TestTripAggregatorDetectsReservations(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	// a was reserved and the reservation was cancelled, b was ridden shortly
+	aBack := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50001, 7.40001), StateUpdatedAt: start.Add(2 * time.Minute)}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	bBack := &Scooter{ID: "b", ChargeLevel: 59, Location: NewGeoLocation(51.521, 7.42), StateUpdatedAt: start.Add(2 * time.Minute)}
+
+	snapshots := [][]*Scooter{{a, b}, {}, {aBack, bBack}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*time.Minute), snapshot))
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxReservationDuration = DefaultMaxReservationDuration
+	var reservations []*Trip
+	aggregator.Reservations = func(trip *Trip) {
+		reservations = append(reservations, trip)
+	}
+	trips := aggregateTrips(aggregator, results)
+	require.Len(t, trips, 1)
+	assert.Contains(t, trips, TripID("circ", "b", start.Add(time.Minute)))
+	require.Len(t, reservations, 1)
+	assert.Equal(t, "a", reservations[0].ScooterID)
+	assert.Equal(t, RESERVATION, reservations[0].Type)
+	assert.Equal(t, 1, aggregator.ReservationCount())
+
+	// Without the check the reservation is a trip
+	assert.Len(t, aggregateTrips(NewTripAggregator(), results), 2)
+}
+
+func TestTripAggregatorFlushesOpenTrips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "open")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	c := &Scooter{ID: "c", ChargeLevel: 70, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	snapshots := [][]*Scooter{{a, b, c}, {b, c}, {c}, {}}
+	var results []ScrapeResult
+	for i, snapshot := range snapshots {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	aggregator := NewTripAggregator()
+	// The oldest trip is spilled, it is flushed as well
+	aggregator.MaxUnfinishedTrips = 2
+	aggregator.Spill = &TripSpill{Dir: dir}
+	defer aggregator.Spill.Close()
+	var open []*Trip
+	aggregator.OpenTrips = func(trip *Trip) {
+		open = append(open, trip)
+	}
+	assert.Empty(t, aggregateTrips(aggregator, results))
+	require.Len(t, open, 3)
+	for i, id := range []string{"a", "b", "c"} {
+		assert.Equal(t, id, open[i].ScooterID)
+		assert.Equal(t, OPEN_TRIP, open[i].Type)
+		assert.True(t, open[i].EndTime.IsZero())
+		assert.Equal(t, time.Duration(20-i*10)*time.Minute, open[i].Duration)
+	}
+	assert.Equal(t, 0, aggregator.Spill.Len())
+}
+
+func TestTripAggregatorLosesExpiredTrips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lost")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	var results []ScrapeResult
+	for i := 0; i < 8; i++ {
+		// c keeps changing, so no snapshot is skipped
+		c := &Scooter{ID: "c", ChargeLevel: 70, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start.Add(time.Duration(i) * time.Minute)}
+		snapshot := []*Scooter{c}
+		switch {
+		case i == 0:
+			snapshot = append(snapshot, a, b)
+		case i == 1:
+			snapshot = append(snapshot, b)
+		case i == 7:
+			// a is back after its trip was lost
+			snapshot = append(snapshot, a)
+		}
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), snapshot))
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxTripAge = 30 * time.Minute
+	// The older trip of a is spilled, it gets lost as well
+	aggregator.MaxUnfinishedTrips = 1
+	aggregator.Spill = &TripSpill{Dir: dir}
+	defer aggregator.Spill.Close()
+	var lost []*Trip
+	aggregator.LostTrips = func(trip *Trip) {
+		lost = append(lost, trip)
+	}
+	assert.Empty(t, aggregateTrips(aggregator, results))
+	require.Len(t, lost, 2)
+	assert.Equal(t, "a", lost[0].ScooterID)
+	assert.Equal(t, LOST_TRIP, lost[0].Type)
+	assert.Equal(t, 40*time.Minute, lost[0].Duration)
+	assert.Equal(t, "b", lost[1].ScooterID)
+	assert.Equal(t, 40*time.Minute, lost[1].Duration)
+	assert.Equal(t, 2, aggregator.LostTripCount())
+	assert.Equal(t, 0, aggregator.Spill.Len())
+}
+
+func TestTripAggregatorLosesTripsInUnchangedSnapshots(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	results := []ScrapeResult{NewScrapeResult("circ", start, []*Scooter{a, b})}
+	// Nothing changes after a vanished
+	for i := 1; i < 8; i++ {
+		results = append(results, NewScrapeResult("circ", start.Add(time.Duration(i)*10*time.Minute), []*Scooter{b}))
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxTripAge = 30 * time.Minute
+	var lost, open []*Trip
+	aggregator.LostTrips = func(trip *Trip) {
+		lost = append(lost, trip)
+	}
+	aggregator.OpenTrips = func(trip *Trip) {
+		open = append(open, trip)
+	}
+	assert.Empty(t, aggregateTrips(aggregator, results))
+	require.Len(t, lost, 1)
+	assert.Equal(t, "a", lost[0].ScooterID)
+	assert.Equal(t, 40*time.Minute, lost[0].Duration)
+	assert.Empty(t, open)
+	assert.Equal(t, 6, aggregator.unchangedCount)
+}
+
+func TestTripAggregatorRestartsAfterOutage(t *testing.T) {
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	c := &Scooter{ID: "c", ChargeLevel: 70, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	aBack := &Scooter{ID: "a", ChargeLevel: 70, Location: NewGeoLocation(51.53, 7.43), StateUpdatedAt: start.Add(3 * time.Hour)}
+	d := &Scooter{ID: "d", ChargeLevel: 90, Location: NewGeoLocation(51.54, 7.44), StateUpdatedAt: start.Add(3 * time.Hour)}
+
+	results := []ScrapeResult{
+		NewScrapeResult("circ", start, []*Scooter{a, b, c}),
+		NewScrapeResult("circ", start.Add(time.Minute), []*Scooter{b, c}),
+		// b vanished during the outage and d appeared, neither is a trip
+		NewScrapeResult("circ", start.Add(3*time.Hour), []*Scooter{aBack, c, d}),
+		NewScrapeResult("circ", start.Add(3*time.Hour+time.Minute), []*Scooter{aBack, d}),
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxScrapeGap = time.Hour
+	var open []*Trip
+	aggregator.OpenTrips = func(trip *Trip) {
+		open = append(open, trip)
+	}
+	trips := aggregateTrips(aggregator, results)
+	// The trip of a started before the outage still finishes
+	require.Len(t, trips, 1)
+	for _, trip := range trips {
+		assert.Equal(t, "a", trip.ScooterID)
+	}
+	require.Len(t, open, 1)
+	assert.Equal(t, "c", open[0].ScooterID)
+	assert.Equal(t, 1, aggregator.OutageCount())
+
+	// Without outage detection b is mistaken for a trip which started after the outage
+	aggregator = NewTripAggregator()
+	open = nil
+	aggregator.OpenTrips = func(trip *Trip) {
+		open = append(open, trip)
+	}
+	assert.Len(t, aggregateTrips(aggregator, results), 1)
+	require.Len(t, open, 2)
+	assert.Equal(t, "b", open[0].ScooterID)
+	assert.Equal(t, 0, aggregator.OutageCount())
+}
+
+func TestTripAggregatorTakesSpilledTripsAfterOutage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	a := &Scooter{ID: "a", ChargeLevel: 80, Location: NewGeoLocation(51.50, 7.40), StateUpdatedAt: start}
+	b := &Scooter{ID: "b", ChargeLevel: 60, Location: NewGeoLocation(51.51, 7.41), StateUpdatedAt: start}
+	c := &Scooter{ID: "c", ChargeLevel: 70, Location: NewGeoLocation(51.52, 7.42), StateUpdatedAt: start}
+	aBack := &Scooter{ID: "a", ChargeLevel: 70, Location: NewGeoLocation(51.53, 7.43), StateUpdatedAt: start.Add(3 * time.Hour)}
+	bBack := &Scooter{ID: "b", ChargeLevel: 50, Location: NewGeoLocation(51.54, 7.44), StateUpdatedAt: start.Add(3 * time.Hour)}
+
+	results := []ScrapeResult{
+		NewScrapeResult("circ", start, []*Scooter{a, b, c}),
+		NewScrapeResult("circ", start.Add(time.Minute), []*Scooter{c}),
+		// a and b came back during the outage
+		NewScrapeResult("circ", start.Add(3*time.Hour), []*Scooter{aBack, bBack, c}),
+	}
+
+	aggregator := NewTripAggregator()
+	aggregator.MaxScrapeGap = time.Hour
+	// One of the trips is spilled
+	aggregator.MaxUnfinishedTrips = 1
+	aggregator.Spill = &TripSpill{Dir: dir}
+	defer aggregator.Spill.Close()
+	var open []*Trip
+	aggregator.OpenTrips = func(trip *Trip) {
+		open = append(open, trip)
+	}
+	trips := aggregateTrips(aggregator, results)
+	require.Len(t, trips, 2)
+	for _, trip := range trips {
+		assert.Equal(t, start.Add(3*time.Hour), trip.EndTime)
+	}
+	assert.Empty(t, open)
+	assert.Equal(t, 0, aggregator.Spill.Len())
+}
+
+func TestClassifyChargingTrips(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		trip     Trip
+		expected TripType
+	}{
+		{"swapped in place", Trip{StartChargeLevel: 10, EndChargeLevel: 100, Distance: 0.01, Duration: 10 * time.Minute}, BATTERY_SWAP_TRIP},
+		{"taken away", Trip{StartChargeLevel: 10, EndChargeLevel: 100, Distance: 2.5, Duration: 5 * time.Hour}, CHARGING_TRIP},
+		{"returned to the same spot", Trip{StartChargeLevel: 10, EndChargeLevel: 100, Distance: 0.01, Duration: 5 * time.Hour}, CHARGING_TRIP},
+		{"stale location", Trip{StartChargeLevel: 10, EndChargeLevel: 100, Duration: 10 * time.Minute, StaleLocation: true}, CHARGING_TRIP},
+		{"ridden", Trip{StartChargeLevel: 80, EndChargeLevel: 70, Distance: 2.5, Duration: 10 * time.Minute}, CUSTOMER_TRIP},
+	} {
+		trip := test.trip
+		classify(&trip)
+		assert.Equal(t, test.expected, trip.Type, test.name)
+	}
+}
+
+func TestTripAggregatorRejectsConcurrentAggregation(t *testing.T) {
+	aggregator := NewTripAggregator()
+	in := make(chan ScrapeResult)
+	out := aggregator.Aggregate(in)
+	assert.Panics(t, func() {
+		aggregator.AggregateBatches(make(chan ScrapeResult), 10, 0)
+	})
+	close(in)
+	for range out {
+	}
+
+	// Once the first aggregation finished the aggregator can be used again
+	assert.NotPanics(t, func() {
+		results := []ScrapeResult{NewScrapeResult("circ", time.Now(), nil)}
+		aggregateTrips(aggregator, results)
+	})
+}
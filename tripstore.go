@@ -0,0 +1,95 @@
+package sharealyzer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TripID returns a deterministic identifier for a trip, so the same trip gets the same identifier
+// when an archive is processed again
+func TripID(provider, scooterID string, startTime time.Time) string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", provider, scooterID, startTime.Unix())))
+	return hex.EncodeToString(hash[:8])
+}
+
+// ErrTripNotFound is returned if a trip does not exist in a TripStore
+var ErrTripNotFound = fmt.Errorf("Trip not found")
+
+// FileTripStore is a simple TripStore which appends trips as JSON lines to a file
+type FileTripStore struct {
+	Path string
+
+	file *os.File
+	mtx  sync.Mutex
+}
+
+// Store appends the trip to the file
+func (f *FileTripStore) Store(t *Trip) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.file == nil {
+		file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+	return json.NewEncoder(f.file).Encode(t)
+}
+
+// Close closes the underlying file
+func (f *FileTripStore) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Each calls fn for every stored trip until fn returns false
+func (f *FileTripStore) Each(fn func(t *Trip) bool) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		var t Trip
+		if err := decoder.Decode(&t); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fn(&t) {
+			return nil
+		}
+	}
+}
+
+// Find returns the trip with the given identifier
+func (f *FileTripStore) Find(id string) (*Trip, error) {
+	var found *Trip
+	if err := f.Each(func(t *Trip) bool {
+		if t.ID == id {
+			found = t
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrTripNotFound
+	}
+	return found, nil
+}
@@ -0,0 +1,61 @@
+package sharealyzer
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripID(t *testing.T) {
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	id := TripID("circ", "a", start)
+	assert.Len(t, id, 16)
+	assert.Equal(t, id, TripID("circ", "a", start.In(time.FixedZone("CEST", 2*60*60))))
+	assert.NotEqual(t, id, TripID("circ", "b", start))
+	assert.NotEqual(t, id, TripID("tier", "a", start))
+	assert.NotEqual(t, id, TripID("circ", "a", start.Add(time.Second)))
+}
+
+func TestFileTripStore(t *testing.T) {
+	store := &FileTripStore{Path: filepath.Join(t.TempDir(), "trips.jsonl")}
+	start := time.Date(2019, 10, 7, 8, 0, 0, 0, time.UTC)
+	first := &Trip{ID: TripID("circ", "a", start), ScooterID: "a", StartTime: start, Type: CUSTOMER_TRIP}
+	second := &Trip{ID: TripID("circ", "b", start), ScooterID: "b", StartTime: start, Type: LOST_TRIP}
+	require.NoError(t, store.Store(first))
+	require.NoError(t, store.Close())
+	// Appends after reopening
+	require.NoError(t, store.Store(second))
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close())
+
+	found, err := store.Find(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "b", found.ScooterID)
+	assert.Equal(t, LOST_TRIP, found.Type)
+	assert.Nil(t, found.EndLocation)
+
+	_, err = store.Find("unknown")
+	assert.Equal(t, ErrTripNotFound, err)
+
+	var ids []string
+	require.NoError(t, store.Each(func(trip *Trip) bool {
+		ids = append(ids, trip.ID)
+		return false
+	}))
+	assert.Equal(t, []string{first.ID}, ids)
+
+	_, err = (&FileTripStore{Path: filepath.Join(t.TempDir(), "missing")}).Find(first.ID)
+	assert.Error(t, err)
+}
+
+func TestTripTypeKey(t *testing.T) {
+	for _, data := range []string{`{"id": "1", "Type": "CHARGING_TRIP"}`, `{"id": "1", "type": "CHARGING_TRIP"}`} {
+		var trip Trip
+		require.NoError(t, json.Unmarshal([]byte(data), &trip))
+		assert.Equal(t, CHARGING_TRIP, trip.Type, data)
+	}
+}
@@ -13,6 +13,9 @@ const (
 	IdleRentable ScooterState = "IDLE_RENTABLE"
 	Broken       ScooterState = "BROKEN"
 	InUse        ScooterState = "IN_USE"
+	// Missing is a scooter which the provider reports as missing or which is absent from a scrape result,
+	// i.e. because it is collected for charging or repair
+	Missing ScooterState = "MISSING"
 )
 
 // GeoLocation represents simple latitude and longitude based geographic locations
@@ -75,8 +78,13 @@ type Scooter struct {
 	LastUpdate           time.Time
 	QRContent            string
 	StateUpdatedByUserID string
+	StateUpdatedAt       time.Time
 	InitPrice            int
 	UnitPrice            int
+	// LocationAge is how old the GPS fix of the location was when the scooter reported it, 0 if unknown
+	LocationAge time.Duration
+	// Zone is the tariff zone of the provider the scooter is in, if the provider has zones
+	Zone string
 }
 
 type TripType string
@@ -85,6 +93,17 @@ const (
 	CUSTOMER_TRIP   TripType = "CUSTOMER_TRIP"
 	CHARGING_TRIP   TripType = "CHARGING_TRIP"
 	RELOCATION_TRIP TripType = "RELOCATION_TRIP"
+	// BATTERY_SWAP_TRIP is a scooter which gained charge without being moved, its battery was swapped
+	// in place
+	BATTERY_SWAP_TRIP TripType = "BATTERY_SWAP_TRIP"
+	// OPEN_TRIP is a trip which didn't finish until the input ended
+	OPEN_TRIP TripType = "OPEN_TRIP"
+	// LOST_TRIP is a trip which didn't finish within the maximum trip age, the scooter was likely removed
+	// from service
+	LOST_TRIP TripType = "LOST_TRIP"
+	// RESERVATION is a scooter which disappeared shortly without moving or losing charge, it was reserved
+	// or unlocked without being ridden
+	RESERVATION TripType = "RESERVATION"
 )
 
 // Trip represents a user initiated journey between two locations.
@@ -102,7 +121,19 @@ type Trip struct {
 	StartTime        time.Time     `json:"start_time"`
 	EndTime          time.Time     `json:"end_time"`
 	Distance         float64       `json:"distance"` // Distance in kilometers
-	Type             TripType
+	// Type was written with the key "Type" before, decoding is case insensitive and accepts both
+	Type TripType `json:"type"`
+	// StaleLocation is set if the start or end location is an outdated GPS fix, the distance is unknown then
+	StaleLocation bool `json:"stale_location,omitempty"`
+	// Path are the locations between start and end where the scooter was seen while it was rented, only
+	// providers which show scooters in use have it. The distance follows the path.
+	Path []*GeoLocation `json:"path,omitempty"`
+	// GroupID is the ID of the group of trips ridden together, set by a GroupDetector
+	GroupID string `json:"group_id,omitempty"`
+	// Zone is the zone the trip started in and Tariff the tariff charged there at the start, the cost is
+	// estimated with it
+	Zone   string  `json:"zone,omitempty"`
+	Tariff *Tariff `json:"tariff,omitempty"`
 }
 
 type TripStore interface {
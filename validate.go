@@ -0,0 +1,172 @@
+package sharealyzer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reasons why a Validator drops an observation
+const (
+	InvalidMissingID       = "missing_id"
+	InvalidMissingLocation = "missing_location"
+	InvalidCoordinates     = "invalid_coordinates"
+	InvalidNullIsland      = "null_island"
+	InvalidOutsideArea     = "outside_area"
+	InvalidChargeLevel     = "negative_charge_level"
+)
+
+// BoundingBox is a rectangle described by its top left and bottom right corners
+type BoundingBox struct {
+	LatTopLeft     float64
+	LonTopLeft     float64
+	LatBottomRight float64
+	LonBottomRight float64
+}
+
+// ParseBoundingBox parses a box given as "latTopLeft,lonTopLeft,latBottomRight,lonBottomRight"
+func ParseBoundingBox(box string) (*BoundingBox, error) {
+	parts := strings.Split(box, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("Bounding box %s doesn't consist of four coordinates", box)
+	}
+	coords := make([]float64, len(parts))
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid coordinate %s in bounding box: %s", part, err)
+		}
+		coords[i] = coord
+	}
+	return &BoundingBox{LatTopLeft: coords[0], LonTopLeft: coords[1], LatBottomRight: coords[2], LonBottomRight: coords[3]}, nil
+}
+
+// Contains returns true if loc lies within the box or on its border
+func (b *BoundingBox) Contains(loc *GeoLocation) bool {
+	return loc != nil &&
+		loc.Latitude <= b.LatTopLeft && loc.Latitude >= b.LatBottomRight &&
+		loc.Longitude >= b.LonTopLeft && loc.Longitude <= b.LonBottomRight
+}
+
+// ValidationStats count the observations checked by a Validator
+type ValidationStats struct {
+	Accepted int            `json:"accepted"`
+	Dropped  map[string]int `json:"dropped"`
+}
+
+// DroppedTotal returns the number of dropped observations for all reasons
+func (s ValidationStats) DroppedTotal() int {
+	total := 0
+	for _, count := range s.Dropped {
+		total = total + count
+	}
+	return total
+}
+
+// String describes the stats in a single line for logging
+func (s ValidationStats) String() string {
+	reasons := make([]string, 0, len(s.Dropped))
+	for reason, count := range s.Dropped {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("accepted %d, dropped %d (%s)", s.Accepted, s.DroppedTotal(), strings.Join(reasons, ", "))
+}
+
+// Validator drops scooter observations which can't be right, i.e. without identifier, with a location at
+// 0,0 or outside of the scraped area or with a negative charge level. A dropped observation looks like a
+// missing scooter to the trip detection, which is less harmful than a trip to the coast of Africa. It is
+// safe for concurrent use.
+type Validator struct {
+	// Area is the scraped area, locations outside are dropped if it is set
+	Area *BoundingBox
+
+	lock  sync.Mutex
+	stats ValidationStats
+}
+
+// Check returns the reason why the scooter is invalid or an empty string if it is valid
+func (v *Validator) Check(scooter *Scooter) string {
+	switch {
+	case scooter.ID == "":
+		return InvalidMissingID
+	case scooter.Location == nil:
+		return InvalidMissingLocation
+	case math.IsNaN(scooter.Location.Latitude) || math.IsNaN(scooter.Location.Longitude) ||
+		math.Abs(scooter.Location.Latitude) > 90 || math.Abs(scooter.Location.Longitude) > 180:
+		return InvalidCoordinates
+	case scooter.Location.Latitude == 0 && scooter.Location.Longitude == 0:
+		return InvalidNullIsland
+	case v.Area != nil && !v.Area.Contains(scooter.Location):
+		return InvalidOutsideArea
+	case scooter.ChargeLevel < 0:
+		return InvalidChargeLevel
+	}
+	return ""
+}
+
+// Validate returns res without invalid scooters. res itself is returned if all scooters are valid.
+func (v *Validator) Validate(res ScrapeResult) ScrapeResult {
+	scooters := res.Scooters()
+	var valid []*Scooter
+	dropped := make(map[string]int)
+	for i, scooter := range scooters {
+		reason := v.Check(scooter)
+		if reason == "" {
+			if valid != nil {
+				valid = append(valid, scooter)
+			}
+			continue
+		}
+		if valid == nil {
+			valid = make([]*Scooter, i, len(scooters))
+			copy(valid, scooters[:i])
+		}
+		dropped[reason]++
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.stats.Dropped == nil {
+		v.stats.Dropped = make(map[string]int)
+	}
+	for reason, count := range dropped {
+		v.stats.Dropped[reason] = v.stats.Dropped[reason] + count
+	}
+	if valid == nil {
+		v.stats.Accepted = v.stats.Accepted + len(scooters)
+		return res
+	}
+	v.stats.Accepted = v.stats.Accepted + len(valid)
+	return NewScrapeResult(res.Provider(), res.ScrapeDate(), valid)
+}
+
+// Stats returns a copy of the counts of all checked observations so far
+func (v *Validator) Stats() ValidationStats {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	stats := ValidationStats{Accepted: v.stats.Accepted, Dropped: make(map[string]int)}
+	for reason, count := range v.stats.Dropped {
+		stats.Dropped[reason] = count
+	}
+	return stats
+}
+
+// ValidateScrapeResults drops the invalid scooters of every scrape result
+func ValidateScrapeResults(in <-chan ScrapeResult, v *Validator) <-chan ScrapeResult {
+	out := make(chan ScrapeResult, 100)
+	go func() {
+		for res := range in {
+			out <- v.Validate(res)
+		}
+		close(out)
+		if stats := v.Stats(); stats.DroppedTotal() > 0 {
+			log.Printf("[WARNING] Dropped invalid observations: %s", stats)
+		}
+	}()
+	return out
+}
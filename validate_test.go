@@ -0,0 +1,73 @@
+package sharealyzer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBoundingBox(t *testing.T) {
+	box, err := ParseBoundingBox("51.582780, 7.325945,51.475727,7.558172")
+	require.NoError(t, err)
+	assert.Equal(t, &BoundingBox{LatTopLeft: 51.582780, LonTopLeft: 7.325945, LatBottomRight: 51.475727, LonBottomRight: 7.558172}, box)
+	assert.True(t, box.Contains(NewGeoLocation(51.5, 7.4)))
+	assert.False(t, box.Contains(NewGeoLocation(51.6, 7.4)))
+	assert.False(t, box.Contains(NewGeoLocation(51.5, 7.3)))
+
+	_, err = ParseBoundingBox("51.5,7.3,51.4")
+	assert.Error(t, err)
+	_, err = ParseBoundingBox("51.5,7.3,51.4,north")
+	assert.Error(t, err)
+}
+
+func TestValidator(t *testing.T) {
+	validator := &Validator{Area: &BoundingBox{LatTopLeft: 52, LonTopLeft: 7, LatBottomRight: 51, LonBottomRight: 8}}
+	valid := &Scooter{ID: "valid", Location: NewGeoLocation(51.5, 7.5), ChargeLevel: 50}
+	scooters := []*Scooter{
+		valid,
+		{ID: "", Location: NewGeoLocation(51.5, 7.5)},
+		{ID: "nowhere"},
+		{ID: "nan", Location: NewGeoLocation(math.NaN(), 7.5)},
+		{ID: "pole", Location: NewGeoLocation(91, 7.5)},
+		{ID: "null", Location: NewGeoLocation(0, 0)},
+		{ID: "berlin", Location: NewGeoLocation(52.52, 13.4)},
+		{ID: "negative", Location: NewGeoLocation(51.5, 7.5), ChargeLevel: -1},
+	}
+	for i, reason := range []string{"", InvalidMissingID, InvalidMissingLocation, InvalidCoordinates, InvalidCoordinates,
+		InvalidNullIsland, InvalidOutsideArea, InvalidChargeLevel} {
+		assert.Equal(t, reason, validator.Check(scooters[i]), scooters[i].ID)
+	}
+
+	date := time.Date(2019, 10, 6, 8, 0, 0, 0, time.UTC)
+	res := validator.Validate(NewScrapeResult("circ", date, scooters))
+	assert.Equal(t, []*Scooter{valid}, res.Scooters())
+	assert.Equal(t, date, res.ScrapeDate())
+	assert.Equal(t, "circ", res.Provider())
+
+	// Results without invalid scooters are passed on as they are
+	unchanged := NewScrapeResult("circ", date, []*Scooter{valid})
+	assert.Equal(t, unchanged, validator.Validate(unchanged))
+
+	stats := validator.Stats()
+	assert.Equal(t, 2, stats.Accepted)
+	assert.Equal(t, 7, stats.DroppedTotal())
+	assert.Equal(t, 2, stats.Dropped[InvalidCoordinates])
+	assert.Equal(t, 1, stats.Dropped[InvalidOutsideArea])
+}
+
+func TestValidateScrapeResults(t *testing.T) {
+	validator := &Validator{}
+	in := make(chan ScrapeResult, 2)
+	in <- NewScrapeResult("circ", time.Now(), []*Scooter{{ID: "a", Location: NewGeoLocation(51.5, 7.5)}})
+	in <- NewScrapeResult("circ", time.Now(), []*Scooter{{ID: "a", Location: NewGeoLocation(0, 0)}})
+	close(in)
+	var counts []int
+	for res := range ValidateScrapeResults(in, validator) {
+		counts = append(counts, len(res.Scooters()))
+	}
+	assert.Equal(t, []int{1, 0}, counts)
+	assert.Equal(t, 1, validator.Stats().Dropped[InvalidNullIsland])
+}